@@ -21,11 +21,16 @@ package config
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -41,6 +46,18 @@ var TSHome string = "/opt/trafficserver"
 
 const DefaultTSConfigDir = "/opt/trafficserver/etc/trafficserver"
 
+// DefaultServiceName is the ATS service name, when no --instance is given.
+const DefaultServiceName = "trafficserver"
+
+// DefaultLockFilePath is the t3c-apply lock file, when no --instance is given.
+const DefaultLockFilePath = "/var/run/t3c.lock"
+
+// DefaultStatsdPrefix is the prefix of the names of the metrics sent to the --statsd-address.
+const DefaultStatsdPrefix = "t3c.apply"
+
+// instanceNameRe matches valid --instance names, which are used in file paths and service names.
+var instanceNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
 const (
 	StatusDir          = "/var/lib/trafficcontrol-cache-config/status"
 	GenerateCmd        = "/usr/bin/t3c-generate" // TODO don't make absolute?
@@ -72,6 +89,12 @@ func (s SvcManagement) String() string {
 	return "Unknown"
 }
 
+// MarshalText implements encoding.TextMarshaler, so the SvcManagement is
+// printed by name in JSON.
+func (s SvcManagement) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 type Cfg struct {
 	LogLocationDebug    string
 	LogLocationErr      string
@@ -107,20 +130,239 @@ type Cfg struct {
 	MaxMindLocation string
 	TsHome          string
 	TsConfigDir     string
+	// Instance is the name of the ATS instance to manage, for hosts running
+	// multiple ATS instances. Empty means the single default instance.
+	Instance string
+	// StatusDir is the directory of the server status file.
+	StatusDir string
+	// LockFilePath is the lock file, which prevents concurrent runs for the same instance.
+	LockFilePath string
+	// ServiceName is the ATS service to restart or reload.
+	ServiceName string
+	// ConfigCachePath is the file the Traffic Ops config data is cached in.
+	ConfigCachePath string
 
 	ServiceAction     t3cutil.ApplyServiceActionFlag
 	ReportOnly        bool
 	Files             t3cutil.ApplyFilesFlag
+	FilesFilter       string // glob of config file names to apply. If empty, all files are applied.
 	InstallPackages   bool
 	IgnoreUpdateFlag  bool
 	NoUnsetUpdateFlag bool
 	UpdateIPAllow     bool
 	Version           string
 	GitRevision       string
+	// PrintConfig is whether to print the resolved config and exit, without
+	// doing any work.
+	PrintConfig bool
+	// RunTimeout is the maximum duration of the run, after acquiring the lock,
+	// before it's aborted. Zero means no timeout.
+	RunTimeout time.Duration
+	// PreApplyCommand is a shell command to run before doing any work.
+	// If it fails, the run is aborted. Empty means no command is run.
+	PreApplyCommand string
+	// PostApplyCommand is a shell command to run after a successful run.
+	// Empty means no command is run.
+	PostApplyCommand string
+	// PostApplyCommandFatal is whether a failure of the PostApplyCommand fails the run.
+	PostApplyCommandFatal bool
+	// StatsdAddress is the host:port of a statsd server to send run metrics to over UDP.
+	// Empty means no metrics are sent.
+	StatsdAddress string
+	// StatsdPrefix is the prefix of the names of the metrics sent to StatsdAddress.
+	StatsdPrefix string
+	// ClearUpdateFlagOnly is whether to only clear the update or revalidate
+	// pending flag in Traffic Ops, without generating or applying any files.
+	ClearUpdateFlagOnly bool
+	// OrphanedConfigFiles is what to do with per-Delivery Service config files
+	// on disk which Traffic Ops no longer generates.
+	OrphanedConfigFiles OrphanedConfigFilesFlag
+	// VerifyEnabledServices is what to do when a service enabled by
+	// CheckSystemServices isn't running at the end of the run.
+	VerifyEnabledServices VerifyEnabledServicesFlag
+	// RequireConfirmDestructive is whether a run which would restart services
+	// or uninstall packages must be confirmed with ConfirmDestructive.
+	RequireConfirmDestructive bool
+	// ConfirmDestructive is whether the run may restart services or uninstall
+	// packages, when RequireConfirmDestructive.
+	ConfirmDestructive bool
+	// AuditJSON is the path to write the audit result of each config file to
+	// as JSON, or "-" for stdout. Empty is not to write them.
+	AuditJSON string
+	// SymlinkedConfigFiles is what to do when the path of a config file to
+	// replace is a symlink.
+	SymlinkedConfigFiles SymlinkedConfigFilesFlag
+	// ExternallyModifiedConfigFiles is what to do when a config file to
+	// replace was modified by another process after it was audited.
+	ExternallyModifiedConfigFiles ExternallyModifiedConfigFilesFlag
+	// PreserveFilePermissions is whether replacing an existing config file
+	// keeps its mode and ownership, rather than applying those from Traffic
+	// Ops, which are then only applied to new files.
+	PreserveFilePermissions bool
+	// MinFileMode is the permission bits always set on replaced config files.
+	MinFileMode os.FileMode
+	// MaxFileMode is the permission bits replaced config files may have at
+	// most; others are cleared. MinFileMode takes precedence. Zero is no maximum.
+	MaxFileMode os.FileMode
+	// NoStatus is whether to converge the config files without reading or
+	// changing the update status of the server in Traffic Ops, or the local
+	// status files.
+	NoStatus bool
+	// ReloadOnlyConfigFiles are glob patterns of the names of config files
+	// which, when changed, only require trafficserver to be reloaded, never
+	// restarted.
+	ReloadOnlyConfigFiles []string
+	// ServiceActionsJSON is the path to write the actions services need to
+	// with --report-only, or "-" for stdout. Empty is not to write them.
+	ServiceActionsJSON string
+	// ChangeID is the ID of the external change the run is part of, e.g. a
+	// ticket, sanitized by SanitizeChangeID. Empty is no change.
+	ChangeID string
 }
 
 func (cfg Cfg) AppVersion() string { return t3cutil.VersionStr(AppName, cfg.Version, cfg.GitRevision) }
 
+// RedactedValue replaces credentials in the output of RedactedJSON.
+const RedactedValue = "REDACTED"
+
+// RedactedJSON returns the Cfg as indented JSON, with the Traffic Ops password,
+// including any in the Traffic Ops URL, redacted.
+func (cfg Cfg) RedactedJSON() ([]byte, error) {
+	if cfg.TOPass != "" {
+		cfg.TOPass = RedactedValue
+	}
+	if toURL, err := url.Parse(cfg.TOURL); err == nil && toURL.User != nil {
+		if _, hasPass := toURL.User.Password(); hasPass {
+			toURL.User = url.UserPassword(toURL.User.Username(), RedactedValue)
+			cfg.TOURL = toURL.String()
+		}
+	}
+	return json.MarshalIndent(struct {
+		Cfg
+		TOTimeoutMS string // shadows the Cfg fields, to print the durations readably
+		RunTimeout  string
+	}{
+		Cfg:         cfg,
+		TOTimeoutMS: cfg.TOTimeoutMS.String(),
+		RunTimeout:  cfg.RunTimeout.String(),
+	}, "", "  ")
+}
+
+// The environment variables the Traffic Ops connection settings may be given
+// with, e.g. to parameterize a container image without changing its command
+// line. An option takes precedence over its environment variable, which takes
+// precedence over the option's default.
+const (
+	TOURLEnvVar         = "TO_URL"
+	TOUserEnvVar        = "TO_USER"
+	TOPassEnvVar        = "TO_PASS"
+	TOInsecureEnvVar    = "TO_INSECURE"
+	TOTimeoutMSEnvVar   = "TO_TIMEOUT_MS"
+	CacheHostNameEnvVar = "T3C_CACHE_HOST_NAME"
+)
+
+// The environment variables the guards against unintended destructive runs may
+// be given with, so they can be set for a whole fleet, or by automation.
+const (
+	RequireConfirmDestructiveEnvVar = "T3C_REQUIRE_CONFIRM_DESTRUCTIVE"
+	ConfirmDestructiveEnvVar        = "T3C_CONFIRM_DESTRUCTIVE"
+	AllowedRunModesEnvVar           = "T3C_ALLOWED_RUN_MODES"
+)
+
+// ChangeIDEnvVar is the environment variable the --change-id may be given with.
+const ChangeIDEnvVar = "T3C_CHANGE_ID"
+
+// MaxChangeIDLen is the maximum length of a change ID, longer ones are truncated.
+const MaxChangeIDLen = 128
+
+// changeIDInvalidCharRe matches the characters not allowed in change IDs.
+var changeIDInvalidCharRe = regexp.MustCompile(`[^a-zA-Z0-9._:/#@+=-]`)
+
+// SanitizeChangeID returns the change ID with every character which isn't a
+// letter, number, or one of "._:/#@+=-" replaced with an underscore, truncated
+// to MaxChangeIDLen, so it's safe to embed in git commit messages and logs.
+func SanitizeChangeID(changeID string) string {
+	changeID = changeIDInvalidCharRe.ReplaceAllString(strings.TrimSpace(changeID), "_")
+	if len(changeID) > MaxChangeIDLen {
+		changeID = changeID[:MaxChangeIDLen]
+	}
+	return changeID
+}
+
+// The sources of a setting returned by resolveEnvSetting.
+const (
+	settingSourceArgument = "argument"
+	settingSourceEnv      = "environment variable"
+	settingSourceDefault  = "default"
+)
+
+// resolveEnvSetting returns the value of a setting: flagVal if its option was
+// given, else the value of the environment variable env if it's set and not
+// empty, else defaultVal. It also returns where the value came from, for log
+// and error messages.
+func resolveEnvSetting(flagSet bool, flagVal string, env string, defaultVal string) (string, string) {
+	if flagSet {
+		return flagVal, settingSourceArgument
+	}
+	if val := os.Getenv(env); val != "" {
+		return val, settingSourceEnv + " " + env
+	}
+	return defaultVal, settingSourceDefault
+}
+
+// destructiveActions returns descriptions of the destructive actions a run
+// with the given settings would take, which must be confirmed if
+// RequireConfirmDestructive. A run which only reports takes none. Nor does a
+// run with --service-action=reload, which never restarts services, even if a
+// changed config file needs a restart.
+func destructiveActions(serviceAction t3cutil.ApplyServiceActionFlag, installPackages bool, reportOnly bool) []string {
+	if reportOnly {
+		return nil
+	}
+	actions := []string{}
+	if serviceAction == t3cutil.ApplyServiceActionFlagRestart {
+		actions = append(actions, "restart services (--service-action=restart)")
+	}
+	if installPackages {
+		actions = append(actions, "uninstall packages (--install-packages)")
+	}
+	return actions
+}
+
+// parseAllowedRunModes parses the comma-delimited --allowed-run-modes. An
+// empty string allows every mode.
+func parseAllowedRunModes(str string) (map[t3cutil.Mode]struct{}, error) {
+	if strings.TrimSpace(str) == "" {
+		return nil, nil
+	}
+	modes := map[t3cutil.Mode]struct{}{}
+	for _, modeStr := range strings.Split(str, ",") {
+		mode := t3cutil.StrToMode(strings.TrimSpace(modeStr))
+		if mode == t3cutil.ModeInvalid {
+			return nil, errors.New("'" + modeStr + "' is an invalid mode")
+		}
+		modes[mode] = struct{}{}
+	}
+	return modes, nil
+}
+
+// parseReloadOnlyConfigFiles parses the comma-delimited glob patterns of
+// --reload-only-config-files. An empty string is no patterns.
+func parseReloadOnlyConfigFiles(str string) ([]string, error) {
+	patterns := []string{}
+	for _, pattern := range strings.Split(str, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, errors.New("'" + pattern + "' is an invalid pattern: " + err.Error())
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
 type UseGitFlag string
 
 const (
@@ -145,6 +387,107 @@ func StrToUseGitFlag(str string) UseGitFlag {
 	}
 }
 
+// OrphanedConfigFilesFlag is what to do with per-Delivery Service config files
+// on disk which Traffic Ops no longer generates, e.g. because the Delivery
+// Service was removed.
+type OrphanedConfigFilesFlag string
+
+const (
+	OrphanedConfigFilesIgnore  = "ignore"
+	OrphanedConfigFilesWarn    = "warn"
+	OrphanedConfigFilesRemove  = "remove"
+	OrphanedConfigFilesInvalid = ""
+)
+
+// StrToOrphanedConfigFilesFlag parses the --orphaned-config-files option.
+func StrToOrphanedConfigFilesFlag(str string) OrphanedConfigFilesFlag {
+	str = strings.ToLower(strings.TrimSpace(str))
+	switch str {
+	case OrphanedConfigFilesIgnore, OrphanedConfigFilesWarn, OrphanedConfigFilesRemove:
+		return OrphanedConfigFilesFlag(str)
+	default:
+		return OrphanedConfigFilesInvalid
+	}
+}
+
+// VerifyEnabledServicesFlag is what to do when a service which should be
+// enabled at startup isn't running at the end of the run.
+type VerifyEnabledServicesFlag string
+
+const (
+	VerifyEnabledServicesIgnore  = "ignore"
+	VerifyEnabledServicesWarn    = "warn"
+	VerifyEnabledServicesError   = "error"
+	VerifyEnabledServicesInvalid = ""
+)
+
+// StrToVerifyEnabledServicesFlag parses the --verify-enabled-services option.
+func StrToVerifyEnabledServicesFlag(str string) VerifyEnabledServicesFlag {
+	str = strings.ToLower(strings.TrimSpace(str))
+	switch str {
+	case VerifyEnabledServicesIgnore, VerifyEnabledServicesWarn, VerifyEnabledServicesError:
+		return VerifyEnabledServicesFlag(str)
+	default:
+		return VerifyEnabledServicesInvalid
+	}
+}
+
+// SymlinkedConfigFilesFlag is what to do when the path of a config file to
+// replace is a symlink, e.g. to a config file kept elsewhere.
+type SymlinkedConfigFilesFlag string
+
+const (
+	SymlinkedConfigFilesFollow  = "follow"
+	SymlinkedConfigFilesRefuse  = "refuse"
+	SymlinkedConfigFilesInvalid = ""
+)
+
+// StrToSymlinkedConfigFilesFlag parses the --symlinked-config-files option.
+func StrToSymlinkedConfigFilesFlag(str string) SymlinkedConfigFilesFlag {
+	str = strings.ToLower(strings.TrimSpace(str))
+	switch str {
+	case SymlinkedConfigFilesFollow, SymlinkedConfigFilesRefuse:
+		return SymlinkedConfigFilesFlag(str)
+	default:
+		return SymlinkedConfigFilesInvalid
+	}
+}
+
+// ExternallyModifiedConfigFilesFlag is what to do when a config file to
+// replace was modified by another process, e.g. another tool managing ATS
+// config, after it was audited.
+type ExternallyModifiedConfigFilesFlag string
+
+const (
+	ExternallyModifiedConfigFilesSkip    = "skip"
+	ExternallyModifiedConfigFilesReaudit = "reaudit"
+	ExternallyModifiedConfigFilesInvalid = ""
+)
+
+// StrToExternallyModifiedConfigFilesFlag parses the
+// --externally-modified-config-files option.
+func StrToExternallyModifiedConfigFilesFlag(str string) ExternallyModifiedConfigFilesFlag {
+	str = strings.ToLower(strings.TrimSpace(str))
+	switch str {
+	case ExternallyModifiedConfigFilesSkip, ExternallyModifiedConfigFilesReaudit:
+		return ExternallyModifiedConfigFilesFlag(str)
+	default:
+		return ExternallyModifiedConfigFilesInvalid
+	}
+}
+
+// parseFileMode parses the octal permission bits of a file mode option.
+func parseFileMode(str string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimSpace(str), 8, 32)
+	if err != nil {
+		return 0, errors.New("must be octal permission bits, e.g. 0644")
+	}
+	if os.FileMode(mode)&^os.ModePerm != 0 {
+		return 0, errors.New("must be permission bits, at most 0777")
+	}
+	return os.FileMode(mode), nil
+}
+
 type WaitForParentsFlag string
 
 const WaitForParentsDefault = WaitForParentsReval
@@ -227,18 +570,38 @@ func GetCfg(appVersion string, gitRevision string) (Cfg, error) {
 	toInfoLog := []string{}
 
 	version := getopt.BoolLong("version", 'E', "Print version information and exit.")
-	cacheHostNamePtr := getopt.StringLong("cache-host-name", 'H', "", "Host name of the cache to generate config for. Must be the server host name in Traffic Ops, not a URL, and not the FQDN")
+	cacheHostNamePtr := getopt.StringLong("cache-host-name", 'H', "", "Host name of the cache to generate config for. Must be the server host name in Traffic Ops, not a URL, and not the FQDN. May also be set with the environment variable "+CacheHostNameEnvVar)
 	retriesPtr := getopt.IntLong("num-retries", 'r', 3, "[number] retry connection to Traffic Ops URL [number] times, default is 3")
 	reverseProxyDisablePtr := getopt.BoolLong("reverse-proxy-disable", 'p', "[false | true] bypass the reverse proxy even if one has been configured default is false")
 	skipOSCheckPtr := getopt.BoolLong("skip-os-check", 'C', "[false | true] skip os check, default is false")
-	toInsecurePtr := getopt.BoolLong("traffic-ops-insecure", 'I', "[true | false] ignore certificate errors from Traffic Ops")
-	toTimeoutMSPtr := getopt.IntLong("traffic-ops-timeout-milliseconds", 't', 30000, "Timeout in milli-seconds for Traffic Ops requests, default is 30000")
+	const toInsecureFlagName = "traffic-ops-insecure"
+	toInsecurePtr := getopt.BoolLong(toInsecureFlagName, 'I', "[true | false] ignore certificate errors from Traffic Ops. May also be set with the environment variable "+TOInsecureEnvVar)
+	const toTimeoutMSFlagName = "traffic-ops-timeout-milliseconds"
+	const defaultTOTimeoutMS = 30000
+	toTimeoutMSPtr := getopt.IntLong(toTimeoutMSFlagName, 't', defaultTOTimeoutMS, "Timeout in milli-seconds for Traffic Ops requests, default is 30000. May also be set with the environment variable "+TOTimeoutMSEnvVar)
+	runTimeoutPtr := getopt.DurationLong("run-timeout", 0, 0, "Maximum duration of the entire run, e.g. '30m'. If exceeded, running commands are killed, partial changes are committed to git if enabled, and the run fails. Default is no timeout.")
 	toURLPtr := getopt.StringLong("traffic-ops-url", 'u', "", "Traffic Ops URL. Must be the full URL, including the scheme. Required. May also be set with the environment variable TO_URL")
 	toUserPtr := getopt.StringLong("traffic-ops-user", 'U', "", "Traffic Ops username. Required. May also be set with the environment variable TO_USER")
 	toPassPtr := getopt.StringLong("traffic-ops-password", 'P', "", "Traffic Ops password. Required. May also be set with the environment variable TO_PASS")
 	tsHomePtr := getopt.StringLong("trafficserver-home", 'R', "", "Trafficserver Package directory. May also be set with the environment variable TS_HOME")
 	dnsLocalBindPtr := getopt.BoolLong("dns-local-bind", 'b', "[true | false] whether to use the server's Service Addresses to set the ATS DNS local bind address")
 	help := getopt.BoolLong("help", 'h', "Print usage information and exit")
+	instancePtr := getopt.StringLong("instance", 0, "", "Name of the ATS instance to manage, for hosts running multiple ATS instances. Changes the config directory, status directory, lock file, config cache, and service name. The --cache-host-name is required with this flag. Default is the single default instance.")
+	statsdAddressPtr := getopt.StringLong("statsd-address", 0, "", "host:port of a statsd server to send run metrics to over UDP. Default is to not send metrics.")
+	statsdPrefixPtr := getopt.StringLong("statsd-prefix", 0, DefaultStatsdPrefix, "Prefix of the names of the metrics sent to the --statsd-address. Default is '"+DefaultStatsdPrefix+"'")
+	preApplyCommandPtr := getopt.StringLong("pre-apply-command", 0, "", "Shell command to run after acquiring the lock, before contacting Traffic Ops. If it exits non-zero, the run is aborted. Default is no command.")
+	postApplyCommandPtr := getopt.StringLong("post-apply-command", 0, "", "Shell command to run after a successful run, after updating Traffic Ops. The result is passed in T3C_APPLY_* environment variables. Default is no command.")
+	postApplyCommandFatalPtr := getopt.BoolLong("post-apply-command-fatal", 0, "Whether a failure of the --post-apply-command fails the run. Default is false, failures are logged.")
+	symlinkedConfigFilesStr := getopt.StringLong("symlinked-config-files", 0, SymlinkedConfigFilesFollow, "What to do when the path of a config file to replace is a symlink. Options are follow, to replace the file the symlink resolves to, keeping the symlink, and refuse, to warn and not replace it. Default is follow.")
+	externallyModifiedConfigFilesStr := getopt.StringLong("externally-modified-config-files", 0, ExternallyModifiedConfigFilesSkip, "What to do when a config file to replace was modified by another process after it was audited. Options are skip, to warn and not replace it, and reaudit, to warn and replace it only if it still differs. Default is skip.")
+	preserveFilePermissionsPtr := getopt.BoolLong("preserve-file-permissions", 0, "Whether replacing an existing config file keeps its mode and ownership, so deliberately hardened permissions are never loosened. The mode and ownership from Traffic Ops are then only applied to new files. Default is false.")
+	minFileModeStr := getopt.StringLong("min-file-mode", 0, "0000", "Octal permission bits always set on replaced config files, e.g. 0600. Default is 0000.")
+	maxFileModeStr := getopt.StringLong("max-file-mode", 0, "0777", "Octal permission bits replaced config files may have at most, e.g. 0640 to never make config files world readable. Default is 0777.")
+	changeIDPtr := getopt.StringLong("change-id", 0, "", "ID of the external change the run is part of, e.g. a ticket, which is included in the logs, the git commit message, the audit JSON, and the pre- and post-apply command environment. Characters other than letters, numbers, and '._:/#@+=-' are replaced with underscores. May also be set with the environment variable "+ChangeIDEnvVar+". Default is none.")
+	serviceActionsJSONPtr := getopt.StringLong("service-actions-json", 0, "", "Path of a file to write the action each service needs for the changes to take effect, i.e. restart, reload, or none, to as JSON with --report-only, or '-' for stdout, so they can be taken out-of-band. Default is to not write them.")
+	auditJSONPtr := getopt.StringLong("audit-json", 0, "", "Path of a file to write the audit result of each config file to as JSON, after config files are processed, or '-' for stdout. Default is to not write them.")
+	printConfigPtr := getopt.BoolLong("print-config", 0, "Print the resolved configuration as JSON, with credentials redacted, and exit without doing any work.")
+	orphanedConfigFilesStr := getopt.StringLong("orphaned-config-files", 0, OrphanedConfigFilesIgnore, "What to do with per-Delivery Service config files on disk, like hdr_rw_*.config and regex_remap_*.config, which Traffic Ops no longer generates. Options are ignore, warn, and remove. Files are only considered with --files=all and no --files-filter. Default is ignore.")
 	useGitStr := getopt.StringLong("git", 'g', "auto", "Create and use a git repo in the config directory. Options are yes, no, and auto. If yes, create and use. If auto, use if it exist. Default is auto.")
 	noCachePtr := getopt.BoolLong("no-cache", 'n', "Whether to not use a cache and make conditional requests to Traffic Ops")
 	syncdsUpdatesIPAllowPtr := getopt.BoolLong("syncds-updates-ipallow", 'S', "Whether syncds mode will update ipallow. This exists because ATS had a bug where reloading after changing ipallow would block everything. Default is false.")
@@ -266,11 +629,23 @@ func GetCfg(appVersion string, gitRevision string) (Cfg, error) {
 	const defaultFiles = t3cutil.ApplyFilesFlagAll
 	filesPtr := getopt.EnumLong(filesFlagName, 'f', []string{string(t3cutil.ApplyFilesFlagAll), string(t3cutil.ApplyFilesFlagReval), ""}, "", "[all | reval] Which files to generate. If reval, the Traffic Ops server reval_pending flag is used instead of the upd_pending flag. Default is 'all'")
 
+	const filesFilterFlagName = "files-filter"
+	filesFilterPtr := getopt.StringLong(filesFilterFlagName, 0, "", "Glob pattern of config file names to apply, e.g. 'hdr_rw_*'. Files not matching are generated but not applied, and only matching files are considered for reload or restart. Default is all files.")
+
 	const installPackagesFlagName = "install-packages"
 	installPackagesPtr := getopt.BoolLong(installPackagesFlagName, 'k', "Whether to install necessary packages. Default is false.")
+	verifyEnabledServicesStr := getopt.StringLong("verify-enabled-services", 0, VerifyEnabledServicesIgnore, "What to do when a service enabled at startup with --install-packages and --service-action=restart isn't running at the end of the run. Options are ignore, warn, and error. Default is ignore.")
 
 	const ignoreUpdateFlagName = "ignore-update-flag"
 	ignoreUpdateFlagPtr := getopt.BoolLong(ignoreUpdateFlagName, 'F', "Whether to ignore the upd_pending or reval_pending flag in Traffic Ops, and always generate and apply files. If true, the flag is still unset in Traffic Ops after files are applied. Default is false.")
+	const requireConfirmDestructiveFlagName = "require-confirm-destructive"
+	requireConfirmDestructivePtr := getopt.BoolLong(requireConfirmDestructiveFlagName, 0, "Whether a run which would restart services or uninstall packages must be confirmed with --confirm-destructive, to prevent accidental restarts. May also be set with the environment variable "+RequireConfirmDestructiveEnvVar+". Default is false.")
+	const confirmDestructiveFlagName = "confirm-destructive"
+	confirmDestructivePtr := getopt.BoolLong(confirmDestructiveFlagName, 0, "Confirm that the run may restart services or uninstall packages, with --require-confirm-destructive. May also be set with the environment variable "+ConfirmDestructiveEnvVar+".")
+	allowedRunModesPtr := getopt.StringLong("allowed-run-modes", 0, "", "Comma-delimited list of the run modes which may be run, e.g. 'syncds,revalidate'. No --run-mode is the syncds mode. May also be set with the environment variable "+AllowedRunModesEnvVar+". Default is all modes.")
+	clearUpdateFlagOnlyPtr := getopt.BoolLong("clear-update-flag-only", 0, "Whether to only clear the update flag in Traffic Ops, or the reval flag with --files=reval, if it's set, without generating or applying any files, e.g. to clear a flag stuck on a cache whose config is already correct. Default is false.")
+	reloadOnlyConfigFilesPtr := getopt.StringLong("reload-only-config-files", 0, "", "Comma-delimited glob patterns of config file names which, when changed, only require trafficserver to be reloaded, never restarted, e.g. 'plugin.config' when every plugin supports reloading. A warning is logged whenever a restart is avoided. Default is none.")
+	noStatusPtr := getopt.BoolLong("no-status", 0, "Whether to apply files without reading or changing the update status of the server in Traffic Ops, or the local status files, e.g. when the status is managed elsewhere. Files are always generated and applied, as with --ignore-update-flag, and the update flag is never unset, as with --no-unset-update-flag. With --files=reval, the revalidate files are applied whether or not a revalidation is pending. Default is false.")
 	noUnsetUpdateFlagPtr := getopt.BoolLong("no-unset-update-flag", 'd', "Whether to not unset the update flag in Traffic Ops after applying files. This option makes it possible to generate test or debug configuration from a production Traffic Ops without un-setting queue or reval flags. Default is false.")
 
 	const updateIPAllowFlagName = "update-ipallow"
@@ -310,6 +685,22 @@ If any of the related flags are also set, they override the mode's default behav
 	// so we want to log what flags the mode set here, to aid debugging.
 	// But we can't do that until the loggers are initialized.
 	modeLogStrs := []string{}
+
+	allowedRunModesStr, allowedRunModesSource := resolveEnvSetting(*allowedRunModesPtr != "", *allowedRunModesPtr, AllowedRunModesEnvVar, "")
+	allowedRunModes, err := parseAllowedRunModes(allowedRunModesStr)
+	if err != nil {
+		return Cfg{}, errors.New("Invalid allowed run modes from " + allowedRunModesSource + " '" + allowedRunModesStr + "': " + err.Error())
+	}
+	if allowedRunModes != nil {
+		runMode := t3cutil.ModeSyncDS // no mode is effectively syncds
+		if getopt.IsSet(runModeFlagName) {
+			runMode = t3cutil.StrToMode(*runModePtr)
+		}
+		if _, ok := allowedRunModes[runMode]; !ok && runMode != t3cutil.ModeInvalid {
+			return Cfg{}, errors.New("Run mode '" + runMode.String() + "' is not allowed by the allowed run modes from " + allowedRunModesSource + " '" + allowedRunModesStr + "'.")
+		}
+	}
+
 	if getopt.IsSet(runModeFlagName) {
 
 		// --run-modeから取得する
@@ -378,6 +769,23 @@ If any of the related flags are also set, they override the mode's default behav
 		*filesPtr = defaultFiles.String()
 	}
 
+	requireConfirmDestructiveStr, requireConfirmDestructiveSource := resolveEnvSetting(getopt.IsSet(requireConfirmDestructiveFlagName), strconv.FormatBool(*requireConfirmDestructivePtr), RequireConfirmDestructiveEnvVar, "false")
+	requireConfirmDestructive, err := strconv.ParseBool(requireConfirmDestructiveStr)
+	if err != nil {
+		return Cfg{}, errors.New("Invalid require confirm destructive from " + requireConfirmDestructiveSource + " '" + requireConfirmDestructiveStr + "', must be true or false.")
+	}
+	confirmDestructiveStr, confirmDestructiveSource := resolveEnvSetting(getopt.IsSet(confirmDestructiveFlagName), strconv.FormatBool(*confirmDestructivePtr), ConfirmDestructiveEnvVar, "false")
+	confirmDestructive, err := strconv.ParseBool(confirmDestructiveStr)
+	if err != nil {
+		return Cfg{}, errors.New("Invalid confirm destructive from " + confirmDestructiveSource + " '" + confirmDestructiveStr + "', must be true or false.")
+	}
+	// 破壊的な操作(サービスの再起動、パッケージのアンインストール)は、確認が必要な場合に--confirm-destructiveがなければ何もせずに中止する
+	if requireConfirmDestructive && !confirmDestructive && !*printConfigPtr && !*clearUpdateFlagOnlyPtr && !*help && !*version {
+		if actions := destructiveActions(t3cutil.ApplyServiceActionFlag(*serviceActionPtr), *installPackagesPtr, *reportOnlyPtr); len(actions) > 0 {
+			return Cfg{}, errors.New("This run would " + strings.Join(actions, " and ") + ", which must be confirmed with --" + confirmDestructiveFlagName + " or the environment variable " + ConfirmDestructiveEnvVar + "=true, because --" + requireConfirmDestructiveFlagName + " is set by " + requireConfirmDestructiveSource + ". Aborting without doing anything.")
+		}
+	}
+
 	if !getopt.IsSet(useStrategiesFlagName) {
 		*useStrategiesPtr = defaultUseStrategies.String()
 	}
@@ -402,10 +810,8 @@ If any of the related flags are also set, they override the mode's default behav
 		return Cfg{}, errors.New("Too many verbose options. The maximum log verbosity level is 2 (-vv or --verbose=2) for errors (0), warnings (1), and info (2)")
 	}
 
-	var cacheHostName string
-	if len(*cacheHostNamePtr) > 0 {
-		cacheHostName = *cacheHostNamePtr
-	} else {
+	cacheHostName, cacheHostNameSource := resolveEnvSetting(*cacheHostNamePtr != "", *cacheHostNamePtr, CacheHostNameEnvVar, "")
+	if cacheHostNameSource == settingSourceDefault {
 		cacheHostName, err = os.Hostname()
 		if err != nil {
 			return Cfg{}, errors.New("Could not get the hostname from the O.S., please supply a hostname: " + err.Error())
@@ -420,15 +826,96 @@ If any of the related flags are also set, they override the mode's default behav
 		return Cfg{}, errors.New("Invalid git flag '" + *useGitStr + "'. Valid options are yes, no, auto.")
 	}
 
+	orphanedConfigFiles := StrToOrphanedConfigFilesFlag(*orphanedConfigFilesStr)
+	if orphanedConfigFiles == OrphanedConfigFilesInvalid {
+		return Cfg{}, errors.New("Invalid --orphaned-config-files '" + *orphanedConfigFilesStr + "'. Valid options are ignore, warn, remove.")
+	}
+
+	minFileMode, err := parseFileMode(*minFileModeStr)
+	if err != nil {
+		return Cfg{}, errors.New("Invalid --min-file-mode '" + *minFileModeStr + "', " + err.Error() + ".")
+	}
+	maxFileMode, err := parseFileMode(*maxFileModeStr)
+	if err != nil {
+		return Cfg{}, errors.New("Invalid --max-file-mode '" + *maxFileModeStr + "', " + err.Error() + ".")
+	}
+	if minFileMode&^maxFileMode != 0 {
+		return Cfg{}, errors.New("Invalid --min-file-mode '" + *minFileModeStr + "', must not set bits not allowed by --max-file-mode '" + *maxFileModeStr + "'.")
+	}
+
+	symlinkedConfigFiles := StrToSymlinkedConfigFilesFlag(*symlinkedConfigFilesStr)
+	if symlinkedConfigFiles == SymlinkedConfigFilesInvalid {
+		return Cfg{}, errors.New("Invalid --symlinked-config-files '" + *symlinkedConfigFilesStr + "'. Valid options are follow, refuse.")
+	}
+
+	externallyModifiedConfigFiles := StrToExternallyModifiedConfigFilesFlag(*externallyModifiedConfigFilesStr)
+	if externallyModifiedConfigFiles == ExternallyModifiedConfigFilesInvalid {
+		return Cfg{}, errors.New("Invalid --externally-modified-config-files '" + *externallyModifiedConfigFilesStr + "'. Valid options are skip, reaudit.")
+	}
+
+	verifyEnabledServices := StrToVerifyEnabledServicesFlag(*verifyEnabledServicesStr)
+	if verifyEnabledServices == VerifyEnabledServicesInvalid {
+		return Cfg{}, errors.New("Invalid --verify-enabled-services '" + *verifyEnabledServicesStr + "'. Valid options are ignore, warn, error.")
+	}
+
+	reloadOnlyConfigFiles, err := parseReloadOnlyConfigFiles(*reloadOnlyConfigFilesPtr)
+	if err != nil {
+		return Cfg{}, errors.New("Invalid --reload-only-config-files '" + *reloadOnlyConfigFilesPtr + "': " + err.Error())
+	}
+
+	changeIDStr, changeIDSource := resolveEnvSetting(*changeIDPtr != "", *changeIDPtr, ChangeIDEnvVar, "")
+	changeID := SanitizeChangeID(changeIDStr)
+	if changeID != "" {
+		toInfoLog = append(toInfoLog, "change ID '"+changeID+"' from "+changeIDSource)
+	}
+	if changeID != strings.TrimSpace(changeIDStr) {
+		toInfoLog = append(toInfoLog, "change ID from "+changeIDSource+" was sanitized to '"+changeID+"'")
+	}
+
+	if *noStatusPtr && *clearUpdateFlagOnlyPtr {
+		return Cfg{}, errors.New("Invalid --no-status with --clear-update-flag-only, which only changes the update status.")
+	}
+
+	if *runTimeoutPtr < 0 {
+		return Cfg{}, errors.New("Invalid --run-timeout '" + runTimeoutPtr.String() + "', must not be negative.")
+	}
+
+	if *statsdAddressPtr != "" {
+		if _, _, err := net.SplitHostPort(*statsdAddressPtr); err != nil {
+			return Cfg{}, errors.New("Invalid --statsd-address '" + *statsdAddressPtr + "', must be host:port: " + err.Error())
+		}
+	}
+
+	if *instancePtr != "" {
+		if !instanceNameRe.MatchString(*instancePtr) {
+			return Cfg{}, errors.New("Invalid --instance '" + *instancePtr + "', must be only letters, numbers, underscores, and dashes, and start with a letter or number.")
+		}
+		if cacheHostNameSource == settingSourceDefault {
+			return Cfg{}, errors.New("Missing required argument --cache-host-name or " + CacheHostNameEnvVar + " environment variable, which is required with --instance, because each instance is a separate server in Traffic Ops.")
+		}
+	}
+
+	if _, err := filepath.Match(*filesFilterPtr, ""); err != nil {
+		return Cfg{}, errors.New("Invalid --" + filesFilterFlagName + " pattern '" + *filesFilterPtr + "': " + err.Error())
+	}
+
 	retries := *retriesPtr
 	reverseProxyDisable := *reverseProxyDisablePtr
 	skipOsCheck := *skipOSCheckPtr
 	useStrategies := t3cutil.UseStrategiesFlag(*useStrategiesPtr)
-	toInsecure := *toInsecurePtr
-	toTimeoutMS := time.Millisecond * time.Duration(*toTimeoutMSPtr)
-	toURL := *toURLPtr
-	toUser := *toUserPtr
-	toPass := *toPassPtr
+
+	toInsecureStr, toInsecureSource := resolveEnvSetting(getopt.IsSet(toInsecureFlagName), strconv.FormatBool(*toInsecurePtr), TOInsecureEnvVar, "false")
+	toInsecure, err := strconv.ParseBool(toInsecureStr)
+	if err != nil {
+		return Cfg{}, errors.New("Invalid Traffic Ops insecure from " + toInsecureSource + " '" + toInsecureStr + "', must be true or false.")
+	}
+	toTimeoutMSStr, toTimeoutMSSource := resolveEnvSetting(getopt.IsSet(toTimeoutMSFlagName), strconv.Itoa(*toTimeoutMSPtr), TOTimeoutMSEnvVar, strconv.Itoa(defaultTOTimeoutMS))
+	toTimeoutMSInt, err := strconv.Atoi(toTimeoutMSStr)
+	if err != nil || toTimeoutMSInt < 0 {
+		return Cfg{}, errors.New("Invalid Traffic Ops timeout from " + toTimeoutMSSource + " '" + toTimeoutMSStr + "', must be a number of milliseconds.")
+	}
+	toTimeoutMS := time.Millisecond * time.Duration(toTimeoutMSInt)
+
 	dnsLocalBind := *dnsLocalBindPtr
 	maxmindLocation := *maxmindLocationPtr
 
@@ -441,23 +928,20 @@ If any of the related flags are also set, they override the mode's default behav
 		return Cfg{}, nil
 	}
 
-	urlSourceStr := "argument" // for error messages
-	if toURL == "" {
-		urlSourceStr = "environment variable"
-		toURL = os.Getenv("TO_URL")
-	} else {
-		os.Setenv("TO_URL", toURL)
+	// the sub-commands read the credentials from the environment, so arguments are exported to it
+	toURL, urlSourceStr := resolveEnvSetting(*toURLPtr != "", *toURLPtr, TOURLEnvVar, "")
+	if urlSourceStr == settingSourceArgument {
+		os.Setenv(TOURLEnvVar, toURL)
 	}
-	if toUser == "" {
-		toUser = os.Getenv("TO_USER")
-	} else {
-		os.Setenv("TO_USER", toUser)
+	toUser, toUserSource := resolveEnvSetting(*toUserPtr != "", *toUserPtr, TOUserEnvVar, "")
+	if toUserSource == settingSourceArgument {
+		os.Setenv(TOUserEnvVar, toUser)
 	}
-	if *toPassPtr == "" {
-		toPass = os.Getenv("TO_PASS")
-	} else {
-		os.Setenv("TO_PASS", toPass)
+	toPass, toPassSource := resolveEnvSetting(*toPassPtr != "", *toPassPtr, TOPassEnvVar, "")
+	if toPassSource == settingSourceArgument {
+		os.Setenv(TOPassEnvVar, toPass)
 	}
+	toInfoLog = append(toInfoLog, fmt.Sprintf("Traffic Ops URL from %s, user from %s, password from %s, insecure from %s, timeout from %s, cache host name from %s", urlSourceStr, toUserSource, toPassSource, toInsecureSource, toTimeoutMSSource, cacheHostNameSource))
 
 	// set TSHome
 	var tsHome = ""
@@ -487,6 +971,11 @@ If any of the related flags are also set, they override the mode's default behav
 		toInfoLog = append(toInfoLog, fmt.Sprintf("TSHome: %s, TSConfigDir: %s\n", TSHome, tsConfigDir))
 	}
 
+	paths := GetInstancePaths(tsConfigDir, *instancePtr)
+	if *instancePtr != "" {
+		toInfoLog = append(toInfoLog, fmt.Sprintf("Instance: %s, TSConfigDir: %s, ServiceName: %s\n", *instancePtr, paths.TsConfigDir, paths.ServiceName))
+	}
+
 	usageStr := "basic usage: t3c-apply --traffic-ops-url=myurl --traffic-ops-user=myuser --traffic-ops-password=mypass --cache-host-name=my-cache"
 	if strings.TrimSpace(toURL) == "" {
 		return Cfg{}, errors.New("Missing required argument --traffic-ops-url or TO_URL environment variable. " + usageStr)
@@ -498,7 +987,7 @@ If any of the related flags are also set, they override the mode's default behav
 		return Cfg{}, errors.New("Missing required argument --traffic-ops-password or TO_PASS environment variable. " + usageStr)
 	}
 	if strings.TrimSpace(cacheHostName) == "" {
-		return Cfg{}, errors.New("Missing required argument --cache-host-name. " + usageStr)
+		return Cfg{}, errors.New("Missing required argument --cache-host-name or " + CacheHostNameEnvVar + " environment variable. " + usageStr)
 	}
 
 	toURLParsed, err := url.Parse(toURL)
@@ -541,16 +1030,54 @@ If any of the related flags are also set, they override the mode's default behav
 		DefaultClientTLSVersions:    defaultClientTLSVersions,
 		MaxMindLocation:             maxmindLocation,
 		TsHome:                      TSHome,
-		TsConfigDir:                 tsConfigDir,
+		TsConfigDir:                 paths.TsConfigDir,
+		Instance:                    *instancePtr,
+		StatusDir:                   paths.StatusDir,
+		LockFilePath:                paths.LockFilePath,
+		ServiceName:                 paths.ServiceName,
+		ConfigCachePath:             paths.ConfigCachePath,
 
 		ServiceAction:     t3cutil.ApplyServiceActionFlag(*serviceActionPtr),
 		ReportOnly:        *reportOnlyPtr,
 		Files:             t3cutil.ApplyFilesFlag(*filesPtr),
+		FilesFilter:       *filesFilterPtr,
 		InstallPackages:   *installPackagesPtr,
 		IgnoreUpdateFlag:  *ignoreUpdateFlagPtr,
 		NoUnsetUpdateFlag: *noUnsetUpdateFlagPtr,
 		Version:           appVersion,
 		GitRevision:       gitRevision,
+		PrintConfig:       *printConfigPtr,
+		RunTimeout:        *runTimeoutPtr,
+
+		PreApplyCommand:       *preApplyCommandPtr,
+		PostApplyCommand:      *postApplyCommandPtr,
+		PostApplyCommandFatal: *postApplyCommandFatalPtr,
+
+		StatsdAddress: *statsdAddressPtr,
+		StatsdPrefix:  *statsdPrefixPtr,
+
+		ClearUpdateFlagOnly: *clearUpdateFlagOnlyPtr,
+		OrphanedConfigFiles: orphanedConfigFiles,
+		VerifyEnabledServices:      verifyEnabledServices,
+
+		RequireConfirmDestructive: requireConfirmDestructive,
+		ConfirmDestructive:        confirmDestructive,
+
+		AuditJSON:            *auditJSONPtr,
+		SymlinkedConfigFiles: symlinkedConfigFiles,
+
+		PreserveFilePermissions: *preserveFilePermissionsPtr,
+		MinFileMode:             minFileMode,
+		MaxFileMode:             maxFileMode,
+
+		ExternallyModifiedConfigFiles: externallyModifiedConfigFiles,
+
+		NoStatus: *noStatusPtr,
+
+		ReloadOnlyConfigFiles: reloadOnlyConfigFiles,
+		ServiceActionsJSON:    *serviceActionsJSONPtr,
+
+		ChangeID: changeID,
 	}
 
 	if err = log.InitCfg(cfg); err != nil {
@@ -577,6 +1104,65 @@ If any of the related flags are also set, they override the mode's default behav
 	return cfg, nil
 }
 
+// InstancePaths are the locations which differ between ATS instances on the same host.
+type InstancePaths struct {
+	TsConfigDir     string
+	StatusDir       string
+	LockFilePath    string
+	ServiceName     string
+	ConfigCachePath string
+}
+
+// GetInstancePaths returns the paths for the given ATS instance, whose default
+// config directory is tsConfigDir.
+//
+// If instance is empty, the default paths are returned. Otherwise, each path is
+// suffixed with the instance name, and the service name is the systemd template
+// instance 'trafficserver@instance'.
+func GetInstancePaths(tsConfigDir string, instance string) InstancePaths {
+	if instance == "" {
+		return InstancePaths{
+			TsConfigDir:     tsConfigDir,
+			StatusDir:       StatusDir,
+			LockFilePath:    DefaultLockFilePath,
+			ServiceName:     DefaultServiceName,
+			ConfigCachePath: t3cutil.ApplyCachePath,
+		}
+	}
+	return InstancePaths{
+		TsConfigDir:     tsConfigDir + "-" + instance,
+		StatusDir:       StatusDir + "-" + instance,
+		LockFilePath:    strings.TrimSuffix(DefaultLockFilePath, ".lock") + "-" + instance + ".lock",
+		ServiceName:     DefaultServiceName + "@" + instance,
+		ConfigCachePath: strings.TrimSuffix(t3cutil.ApplyCachePath, ".json") + "-" + instance + ".json",
+	}
+}
+
+// InstanceConfigDir returns the directory a config file whose location is dir
+// is written to for the ATS instance of cfg.
+//
+// For the default instance, dir is returned as-is. For a named instance, a dir
+// in the default instance's config directory is moved to the same place in
+// the named instance's config directory, so instances don't overwrite each
+// other's files. Any other absolute dir outside the named instance's config
+// directory would be shared by every instance on the host, so an error is
+// returned for it.
+func (cfg Cfg) InstanceConfigDir(dir string) (string, error) {
+	if cfg.Instance == "" || !filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	instanceDir := filepath.Clean(cfg.TsConfigDir)
+	defaultDir := strings.TrimSuffix(instanceDir, "-"+cfg.Instance)
+	dir = filepath.Clean(dir)
+	if dir == instanceDir || strings.HasPrefix(dir, instanceDir+"/") {
+		return dir, nil
+	}
+	if dir == defaultDir || strings.HasPrefix(dir, defaultDir+"/") {
+		return instanceDir + strings.TrimPrefix(dir, defaultDir), nil
+	}
+	return "", errors.New("location '" + dir + "' is outside the config directory '" + instanceDir + "' of instance '" + cfg.Instance + "', and would be shared with the other instances")
+}
+
 func validateURL(u *url.URL) error {
 	if u == nil {
 		return errors.New("nil url")
@@ -636,6 +1222,33 @@ func printConfig(cfg Cfg) {
 	log.Debugf("WaitForParents: %v\n", cfg.WaitForParents)
 	log.Debugf("YumOptions: %s\n", cfg.YumOptions)
 	log.Debugf("MaxmindLocation: %s\n", cfg.MaxMindLocation)
+	log.Debugf("FilesFilter: %s\n", cfg.FilesFilter)
+	log.Debugf("RunTimeout: %v\n", cfg.RunTimeout)
+	log.Debugf("PreApplyCommand: %s\n", cfg.PreApplyCommand)
+	log.Debugf("PostApplyCommand: %s\n", cfg.PostApplyCommand)
+	log.Debugf("PostApplyCommandFatal: %t\n", cfg.PostApplyCommandFatal)
+	log.Debugf("StatsdAddress: %s\n", cfg.StatsdAddress)
+	log.Debugf("StatsdPrefix: %s\n", cfg.StatsdPrefix)
+	log.Debugf("ClearUpdateFlagOnly: %t\n", cfg.ClearUpdateFlagOnly)
+	log.Debugf("OrphanedConfigFiles: %s\n", cfg.OrphanedConfigFiles)
+	log.Debugf("VerifyEnabledServices: %s\n", cfg.VerifyEnabledServices)
+	log.Debugf("RequireConfirmDestructive: %t\n", cfg.RequireConfirmDestructive)
+	log.Debugf("ConfirmDestructive: %t\n", cfg.ConfirmDestructive)
+	log.Debugf("AuditJSON: %s\n", cfg.AuditJSON)
+	log.Debugf("SymlinkedConfigFiles: %s\n", cfg.SymlinkedConfigFiles)
+	log.Debugf("PreserveFilePermissions: %t\n", cfg.PreserveFilePermissions)
+	log.Debugf("MinFileMode: %#o\n", cfg.MinFileMode)
+	log.Debugf("MaxFileMode: %#o\n", cfg.MaxFileMode)
+	log.Debugf("ExternallyModifiedConfigFiles: %s\n", cfg.ExternallyModifiedConfigFiles)
+	log.Debugf("NoStatus: %t\n", cfg.NoStatus)
+	log.Debugf("ReloadOnlyConfigFiles: %v\n", cfg.ReloadOnlyConfigFiles)
+	log.Debugf("ServiceActionsJSON: %s\n", cfg.ServiceActionsJSON)
+	log.Debugf("ChangeID: %s\n", cfg.ChangeID)
+	log.Debugf("Instance: %s\n", cfg.Instance)
+	log.Debugf("TSConfigDir: %s\n", cfg.TsConfigDir)
+	log.Debugf("StatusDir: %s\n", cfg.StatusDir)
+	log.Debugf("LockFilePath: %s\n", cfg.LockFilePath)
+	log.Debugf("ServiceName: %s\n", cfg.ServiceName)
 }
 
 func Usage() {
@@ -20,8 +20,15 @@ package main
  */
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
@@ -51,6 +58,9 @@ const (
 	ExitCodeServicesError     = 138
 	ExitCodeSyncDSError       = 139
 	ExitCodeUserCheckError    = 140
+	ExitCodePostApplyError    = 141
+	ExitCodePreApplyError     = 142
+	ExitCodeUpdateFlagError   = 143
 )
 
 func runSysctl(cfg config.Cfg) {
@@ -71,10 +81,14 @@ func runSysctl(cfg config.Cfg) {
 
 }
 
-const LockFilePath = "/var/run/t3c.lock"
 const LockFileRetryInterval = time.Second
 const LockFileRetryTimeout = time.Minute
 
+// RunAbortGracePeriod is how long an aborted run is given to return after --run-timeout is exceeded.
+// Not every step honors the cancelled context, so the run is abandoned once this passes.
+// It's a var so tests can shorten it.
+var RunAbortGracePeriod = 30 * time.Second
+
 const FailureExitMsg = `CRITICAL FAILURE, ABORTING`
 const PostConfigFailureExitMsg = `CRITICAL FAILURE AFTER SETTING CONFIG, ABORTING`
 const SuccessExitMsg = `SUCCESS`
@@ -90,22 +104,43 @@ func main() {
 // t3c-applyは「t3c apply」コマンドから呼ばれます。
 func Main() int {
 
-	var syncdsUpdate torequest.UpdateStatus
-	var lock util.FileLock
-
 	// t3c-applyコマンドに指定されたオプションの解析処理を行います
 	cfg, err := config.GetCfg(Version, GitRevision)
 	if err != nil {
 		fmt.Println(err)
 		fmt.Println(FailureExitMsg)
 		return ExitCodeConfigError
-	} else if cfg == (config.Cfg{}) { // user used the --help option
+	} else if reflect.DeepEqual(cfg, config.Cfg{}) { // user used the --help option
+		return ExitCodeSuccess
+	} else if cfg.PrintConfig {
+		cfgJSON, err := cfg.RedactedJSON()
+		if err != nil {
+			fmt.Println("printing config: " + err.Error())
+			fmt.Println(FailureExitMsg)
+			return ExitCodeConfigError
+		}
+		fmt.Println(string(cfgJSON))
 		return ExitCodeSuccess
 	}
 
+	start := time.Now()
+	stats := &runStats{}
+	exitCode := lockAndRun(cfg, stats)
+	if trops := stats.getTrops(); trops != nil {
+		trops.LogUpdateStatusTransitions()
+	}
+	sendRunMetrics(cfg, stats, exitCode, time.Since(start))
+	return exitCode
+}
+
+// lockAndRun acquires the lock, runs the --pre-apply-command if any, and then does the run.
+// Returns the application exit code.
+func lockAndRun(cfg config.Cfg, stats *runStats) int {
+	var lock util.FileLock
+
 	// /var/run/t3c.lockがあるかどうかでこのプロセスがロックされているかをチェックします。
 	log.Infoln("Trying to acquire app lock")
-	for lockStart := time.Now(); !lock.GetLock(LockFilePath); {
+	for lockStart := time.Now(); !lock.GetLock(cfg.LockFilePath); {
 
 		if time.Since(lockStart) > LockFileRetryTimeout {
 			log.Errorf("Failed to get app lock after %v seconds, another instance is running, exiting without running\n", int(LockFileRetryTimeout/time.Second))
@@ -118,6 +153,137 @@ func Main() int {
 	}
 	log.Infoln("Acquired app lock")
 
+	if cfg.PreApplyCommand != "" {
+		if err := runPreApplyCommand(context.Background(), cfg); err != nil {
+			log.Errorln("pre-apply command failed, aborting without contacting Traffic Ops: " + err.Error())
+			log.Infoln(FailureExitMsg)
+			lock.Unlock()
+			return ExitCodePreApplyError
+		}
+	}
+
+	if cfg.RunTimeout > 0 {
+		return runWithTimeout(cfg, &lock, func(ctx context.Context) int { return run(ctx, cfg, &lock, stats) })
+	}
+	return run(context.Background(), cfg, &lock, stats)
+}
+
+// runStats is the state of a run needed for its metrics.
+// It is safe for concurrent use.
+type runStats struct {
+	mutex sync.Mutex
+	trops *torequest.TrafficOpsReq
+}
+
+// setTrops sets the TrafficOpsReq of the run.
+func (s *runStats) setTrops(trops *torequest.TrafficOpsReq) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.trops = trops
+}
+
+// getTrops returns the TrafficOpsReq of the run, or nil if the run never created one.
+func (s *runStats) getTrops() *torequest.TrafficOpsReq {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.trops
+}
+
+// sendRunMetrics sends the metrics of the run to the --statsd-address, if any.
+// Errors are logged, and never change the exit code of the run.
+func sendRunMetrics(cfg config.Cfg, stats *runStats, exitCode int, runDuration time.Duration) {
+	if cfg.StatsdAddress == "" {
+		return
+	}
+	success := int64(0)
+	if exitCode == ExitCodeSuccess {
+		success = 1
+	}
+	metrics := []util.StatsdMetric{
+		util.StatsdCounter("runs", 1),
+		util.StatsdTiming("run_duration", runDuration),
+		util.StatsdGauge("exit_code", int64(exitCode)),
+		util.StatsdGauge("success", success),
+	}
+	if trops := stats.getTrops(); trops != nil {
+		reload, restart := int64(0), int64(0)
+		if trops.TrafficCtlReload || trops.RemapConfigReload {
+			reload = 1
+		}
+		if trops.TrafficServerRestart {
+			restart = 1
+		}
+		metrics = append(metrics,
+			util.StatsdGauge("files_changed", int64(len(trops.ChangedFiles()))),
+			util.StatsdGauge("packages_installed", int64(trops.InstalledPackageCount())),
+			util.StatsdGauge("packages_removed", int64(trops.RemovedPackageCount())),
+			util.StatsdGauge("reload", reload),
+			util.StatsdGauge("restart", restart),
+		)
+	}
+	if err := util.SendStatsd(cfg.StatsdAddress, cfg.StatsdPrefix, metrics); err != nil {
+		log.Errorln("sending run metrics: " + err.Error())
+	}
+}
+
+// runWithTimeout calls runFunc, aborting it if it takes longer than cfg.RunTimeout.
+// On timeout, the context of runFunc is cancelled, which kills the commands it started and makes it
+// return at its next step, committing any partial changes to git as it does on any failure.
+// runWithTimeout waits up to RunAbortGracePeriod for runFunc to return, so changes are committed exactly once,
+// then releases the lock and returns ExitCodeGeneralFailure, unless the run succeeded regardless.
+// A run which ignores the cancellation and doesn't return within the grace period is abandoned.
+func runWithTimeout(cfg config.Cfg, lock *util.FileLock, runFunc func(ctx context.Context) int) int {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RunTimeout)
+	defer cancel()
+
+	exitCode := make(chan int, 1)
+	go func() {
+		exitCode <- LogPanic(func() int { return runFunc(ctx) })
+	}()
+
+	select {
+	case code := <-exitCode:
+		return code
+	case <-ctx.Done():
+	}
+
+	log.Errorf("run exceeded --run-timeout of %v, aborting\n", cfg.RunTimeout)
+	defer lock.Unlock()
+	select {
+	case code := <-exitCode:
+		if code == ExitCodeSuccess {
+			log.Infoln("run completed successfully as it was aborted")
+			return code
+		}
+		log.Errorln("run aborted after exceeding --run-timeout")
+	case <-time.After(RunAbortGracePeriod):
+		log.Errorf("run did not return within %v of being aborted, abandoning it\n", RunAbortGracePeriod)
+	}
+	log.Infoln(FailureExitMsg)
+	return ExitCodeGeneralFailure
+}
+
+// runAborted returns whether ctx is done, e.g. because the --run-timeout was exceeded, logging if so.
+// run checks it before each step which changes the server, so an aborted run stops as soon as the step it was in returns.
+func runAborted(ctx context.Context, step string) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	log.Errorln("run aborted, not " + step + ": " + ctx.Err().Error())
+	return true
+}
+
+// run does the work of t3c-apply, after the config is loaded and the lock is acquired.
+// The commands it runs are killed if ctx is done before they complete.
+// Returns the application exit code.
+func run(ctx context.Context, cfg config.Cfg, lock *util.FileLock, stats *runStats) int {
+	var syncdsUpdate torequest.UpdateStatus
+	var err error
+
+	if cfg.ChangeID != "" {
+		log.Infoln("running for change id '" + cfg.ChangeID + "'")
+	}
+
 	// オプションに--git=yesが指定されている場合
 	if cfg.UseGit == config.UseGitYes {
 		// gitレポジトリがなければgit initにより生成する
@@ -142,7 +308,13 @@ func Main() int {
 	}
 
 	// オブジェクトの生成を行う
-	trops := torequest.NewTrafficOpsReq(cfg)
+	trops := torequest.NewTrafficOpsReq(ctx, cfg)
+	stats.setTrops(trops)
+
+	// --clear-update-flag-onlyが指定された場合には、ファイルの生成・適用を行わずにTrafficOpsの更新フラグだけを解除して終了する
+	if cfg.ClearUpdateFlagOnly {
+		return clearUpdateFlag(cfg, trops)
+	}
 
 	// if doing os checks, insure there is a 'systemctl' or 'service' and 'chkconfig' commands.
 	//
@@ -279,6 +451,21 @@ func Main() int {
 	if err != nil {
 		log.Errorf("Error while processing config files: %s\n", err.Error())
 	}
+	configFilesProcessed := err == nil && syncdsUpdate != torequest.UpdateTropsFailed
+
+	if runAborted(ctx, "processing config files") {
+		return GitCommitAndExit(ExitCodeGeneralFailure, FailureExitMsg, cfg)
+	}
+
+	// --orphaned-config-filesの指定に従って、TrafficOpsが生成しなくなったDelivery Service毎の設定ファイルを警告または削除する
+	trops.ReconcileOrphanedConfigFiles(configFilesProcessed)
+
+	// --audit-jsonが指定されている場合、各設定ファイルの監査結果をJSONで出力する
+	if cfg.AuditJSON != "" {
+		if err := trops.WriteAuditJSON(cfg.AuditJSON); err != nil {
+			log.Errorln(err.Error())
+		}
+	}
 
 	// check for maxmind db updates
 	// If we've updated also reload remap to reload the plugin and pick up the new database
@@ -288,7 +475,8 @@ func Main() int {
 	}
 
 	// trops.RemapConfigReloadのフラグはこの上の直前でセットされる
-	if trops.RemapConfigReload == true {
+	// --report-onlyの場合は、remap.configが変更されていても何も書き換えない
+	if trops.RemapConfigReload == true && !cfg.ReportOnly {
 		// remap.configのパス情報を取得して、そのパスに対してtouchして時刻を更新している。
 		cfg, ok := trops.GetConfigFile("remap.config")
 		_, rc, err := util.ExecCommand("/usr/bin/touch", cfg.Path)
@@ -300,6 +488,10 @@ func Main() int {
 		}
 	}
 
+	if runAborted(ctx, "starting services") {
+		return GitCommitAndExit(ExitCodeGeneralFailure, FailureExitMsg, cfg)
+	}
+
 	// --service-action=restart オプションやt3c-check-reloadの実行結果によってtrafficserverを再起動・再読み込み・何もしない・不正かを判断し、
 	// それに従ってtrafficserverを再起動します
 	if err := trops.StartServices(&syncdsUpdate); err != nil {
@@ -307,6 +499,13 @@ func Main() int {
 		return GitCommitAndExit(ExitCodeServicesError, PostConfigFailureExitMsg, cfg)
 	}
 
+	// --report-only かつ --service-actions-jsonが指定されている場合、各サービスに必要な再起動・再読込をJSONで出力する
+	if cfg.ReportOnly && cfg.ServiceActionsJSON != "" {
+		if err := trops.WriteServiceActionsJSON(cfg.ServiceActionsJSON); err != nil {
+			log.Errorln(err.Error())
+		}
+	}
+
 	// start 'teakd' if installed.
 	// このパッケージがtrafficcontrolで利用されている形跡を見つけることができない。
 	if trops.IsPackageInstalled("teakd") {
@@ -314,7 +513,7 @@ func Main() int {
 		if err != nil {
 			log.Errorf("not starting 'teakd', error getting 'teakd' run status: %s\n", err)
 		} else if svcStatus == util.SvcNotRunning {
-			running, err := util.ServiceStart("teakd", "start")
+			running, err := util.ServiceStart(ctx, "teakd", "start")
 			if err != nil {
 				log.Errorf("'teakd' was not started: %s\n", err)
 			} else if running {
@@ -325,6 +524,12 @@ func Main() int {
 		}
 	}
 
+	// --verify-enabled-services=warn|errorの場合、CheckSystemServicesで有効にしたサービスが起動しているかを確認する
+	if err := trops.VerifyEnabledServices(); err != nil {
+		log.Errorln("failed to verify enabled services: " + err.Error())
+		return GitCommitAndExit(ExitCodeServicesError, PostConfigFailureExitMsg, cfg)
+	}
+
 	// reload sysctl
 	if trops.SysCtlReload == true {
 		// --service-action=restart が指定されている場合には、「sysctl -p」が実行される
@@ -335,14 +540,96 @@ func Main() int {
 	trops.PrintWarnings()
 
 	// TrafficOps APIに対してserverStatusの更新処理を行う
+	toUpdateFailed := false
 	if err := trops.UpdateTrafficOps(&syncdsUpdate); err != nil {
-		log.Errorf("failed to update Traffic Ops: %s\n", err.Error())
+		if errors.Is(err, torequest.ErrTrafficOpsUpdateFailed) {
+			toUpdateFailed = true
+			log.Errorf("TRAFFIC OPS NOT UPDATED: it still reports an update pending for this server, which must be cleared by the next run or manually: %s\n", err.Error())
+		} else {
+			log.Errorf("failed to update Traffic Ops: %s\n", err.Error())
+		}
+	}
+
+	if runAborted(ctx, "completing the run") {
+		return GitCommitAndExit(ExitCodeGeneralFailure, PostConfigFailureExitMsg, cfg)
+	}
+
+	if cfg.PostApplyCommand != "" {
+		if err := runPostApplyCommand(ctx, cfg, trops, syncdsUpdate, toUpdateFailed); err != nil {
+			log.Errorln("post-apply command failed: " + err.Error())
+			if cfg.PostApplyCommandFatal {
+				return GitCommitAndExit(ExitCodePostApplyError, PostConfigFailureExitMsg, cfg)
+			}
+		}
 	}
 
 	// ローカルにあるgitにcommitして成功として終了する。
 	return GitCommitAndExit(ExitCodeSuccess, SuccessExitMsg, cfg)
 }
 
+// clearUpdateFlag clears the update, or with --files=reval the revalidate,
+// pending flag of the server in Traffic Ops if it's set, without generating or
+// applying any files, for --clear-update-flag-only.
+// Returns the application exit code.
+func clearUpdateFlag(cfg config.Cfg, trops *torequest.TrafficOpsReq) int {
+	log.Infoln("======== Clearing the update flag in Traffic Ops only, no files will be generated or applied ========")
+	if err := trops.ClearUpdateFlag(); err != nil {
+		log.Errorf("failed to clear the update flag in Traffic Ops: %s\n", err.Error())
+		return GitCommitAndExit(ExitCodeUpdateFlagError, FailureExitMsg, cfg)
+	}
+	return GitCommitAndExit(ExitCodeSuccess, SuccessExitMsg, cfg)
+}
+
+// runPreApplyCommand runs the --pre-apply-command with sh, passing the run options
+// in T3C_APPLY_* environment variables, and logs its output.
+// Returns an error if the command fails, in which case the run must be aborted.
+func runPreApplyCommand(ctx context.Context, cfg config.Cfg) error {
+	env := []string{
+		"T3C_APPLY_CACHE_HOST_NAME=" + cfg.CacheHostName,
+		"T3C_APPLY_FILES=" + cfg.Files.String(),
+		"T3C_APPLY_CHANGE_ID=" + cfg.ChangeID,
+	}
+	return runHookCommand(ctx, "pre-apply", cfg.PreApplyCommand, env)
+}
+
+// runPostApplyCommand runs the --post-apply-command with sh, passing the result of the run
+// in T3C_APPLY_* environment variables, and logs its output.
+func runPostApplyCommand(ctx context.Context, cfg config.Cfg, trops *torequest.TrafficOpsReq, syncdsUpdate torequest.UpdateStatus, toUpdateFailed bool) error {
+	changedFiles := trops.ChangedFiles()
+	env := []string{
+		"T3C_APPLY_EXIT_REASON=" + SuccessExitMsg,
+		"T3C_APPLY_CACHE_HOST_NAME=" + cfg.CacheHostName,
+		"T3C_APPLY_FILES=" + cfg.Files.String(),
+		"T3C_APPLY_UPDATE_STATUS=" + syncdsUpdate.String(),
+		"T3C_APPLY_CHANGED_FILES=" + strings.Join(changedFiles, ","),
+		"T3C_APPLY_CHANGED_FILES_COUNT=" + strconv.Itoa(len(changedFiles)),
+		"T3C_APPLY_RELOAD=" + strconv.FormatBool(trops.TrafficCtlReload || trops.RemapConfigReload),
+		"T3C_APPLY_RESTART_NEEDED=" + strconv.FormatBool(trops.TrafficServerRestart),
+		"T3C_APPLY_TRAFFIC_OPS_UPDATE_FAILED=" + strconv.FormatBool(toUpdateFailed),
+		"T3C_APPLY_UPDATE_STATUS_TRANSITIONS=" + trops.UpdateStatusTransitionsJSON(),
+		"T3C_APPLY_CHANGE_ID=" + cfg.ChangeID,
+	}
+	return runHookCommand(ctx, "post-apply", cfg.PostApplyCommand, env)
+}
+
+// runHookCommand runs command with sh, with env added to the environment, and logs its output.
+// Returns an error if the command couldn't be run or exited non-zero.
+func runHookCommand(ctx context.Context, name string, command string, env []string) error {
+	log.Infoln("running " + name + " command '" + command + "'")
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			log.Infoln(name + " command: " + line)
+		}
+	}
+	if err != nil {
+		return errors.New("running '" + command + "': " + err.Error())
+	}
+	return nil
+}
+
 func LogPanic(f func() int) (exitCode int) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -366,6 +653,9 @@ func GitCommitAndExit(exitCode int, exitMsg string, cfg config.Cfg) int {
 			log.Errorln("git committing existing changes, dir '" + cfg.TsConfigDir + "': " + err.Error())
 		}
 	}
+	if cfg.ChangeID != "" {
+		log.Infoln("change id '" + cfg.ChangeID + "'")
+	}
 	log.Infoln(exitMsg)
 	return exitCode
 }
@@ -0,0 +1,257 @@
+package main
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/torequest"
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/util"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+func TestRunWithTimeout(t *testing.T) {
+	cfg := config.Cfg{RunTimeout: 20 * time.Millisecond}
+
+	// a run which finishes in time keeps its exit code.
+	code := runWithTimeout(cfg, &util.FileLock{}, func(ctx context.Context) int { return ExitCodeServicesError })
+	if code != ExitCodeServicesError {
+		t.Errorf("expected a run finishing in time to exit with %d, actual: %d", ExitCodeServicesError, code)
+	}
+
+	// a run which is aborted returns once its interrupted step does, committing once, and fails.
+	commits := int32(0)
+	returned := int32(0)
+	code = runWithTimeout(cfg, &util.FileLock{}, func(ctx context.Context) int {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond) // the interrupted step returning
+		atomic.AddInt32(&commits, 1)
+		atomic.StoreInt32(&returned, 1)
+		return ExitCodeServicesError
+	})
+	if code != ExitCodeGeneralFailure {
+		t.Errorf("expected an aborted run to exit with %d, actual: %d", ExitCodeGeneralFailure, code)
+	}
+	if atomic.LoadInt32(&returned) != 1 {
+		t.Error("expected the aborted run to return before runWithTimeout")
+	}
+	if c := atomic.LoadInt32(&commits); c != 1 {
+		t.Errorf("expected the aborted run to commit once, actual: %d", c)
+	}
+
+	// a run which succeeds as it's aborted keeps its success.
+	code = runWithTimeout(cfg, &util.FileLock{}, func(ctx context.Context) int {
+		<-ctx.Done()
+		return ExitCodeSuccess
+	})
+	if code != ExitCodeSuccess {
+		t.Errorf("expected a run succeeding at the deadline to exit with %d, actual: %d", ExitCodeSuccess, code)
+	}
+
+	// a run which panics when aborted fails.
+	code = runWithTimeout(cfg, &util.FileLock{}, func(ctx context.Context) int {
+		<-ctx.Done()
+		panic("aborted")
+	})
+	if code != ExitCodeGeneralFailure {
+		t.Errorf("expected a run panicking when aborted to exit with %d, actual: %d", ExitCodeGeneralFailure, code)
+	}
+}
+
+func TestRunWithTimeoutIgnoredCancel(t *testing.T) {
+	oldGrace := RunAbortGracePeriod
+	RunAbortGracePeriod = 50 * time.Millisecond
+	defer func() { RunAbortGracePeriod = oldGrace }()
+
+	cfg := config.Cfg{RunTimeout: 20 * time.Millisecond}
+
+	// a run whose step ignores ctx, e.g. a command not started with it, is abandoned after the grace period.
+	stuck := make(chan struct{})
+	defer close(stuck)
+	done := make(chan int, 1)
+	go func() {
+		done <- runWithTimeout(cfg, &util.FileLock{}, func(ctx context.Context) int {
+			<-stuck
+			return ExitCodeSuccess
+		})
+	}()
+
+	select {
+	case code := <-done:
+		if code != ExitCodeGeneralFailure {
+			t.Errorf("expected an abandoned run to exit with %d, actual: %d", ExitCodeGeneralFailure, code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected runWithTimeout to return after the grace period when the run ignores its context")
+	}
+}
+
+func TestRunAborted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if runAborted(ctx, "testing") {
+		t.Error("expected a run with a live context not to be aborted")
+	}
+	cancel()
+	if !runAborted(ctx, "testing") {
+		t.Error("expected a run with a cancelled context to be aborted")
+	}
+}
+
+// readHookEnv reads the T3C_APPLY_* environment variables a hook command wrote to path with env.
+func readHookEnv(t *testing.T, path string) map[string]string {
+	t.Helper()
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading the hook command's environment: %v", err)
+	}
+	env := map[string]string{}
+	for _, line := range strings.Split(string(bts), "\n") {
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 && strings.HasPrefix(kv[0], "T3C_APPLY_") {
+			env[kv[0]] = kv[1]
+		}
+	}
+	return env
+}
+
+func TestRunPostApplyCommand(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "env")
+	cfg := config.Cfg{PostApplyCommand: "env > " + envFile, ChangeID: "CHG-1", Files: t3cutil.ApplyFilesFlagAll}
+	cfg.CacheHostName = "edge1"
+	trops := torequest.NewTrafficOpsReq(context.Background(), cfg)
+	trops.TrafficCtlReload = true
+
+	if err := runPostApplyCommand(context.Background(), cfg, trops, torequest.UpdateTropsSuccessful, true); err != nil {
+		t.Fatalf("expected the post-apply command to succeed, actual: %v", err)
+	}
+	env := readHookEnv(t, envFile)
+	for name, expected := range map[string]string{
+		"T3C_APPLY_EXIT_REASON":               SuccessExitMsg,
+		"T3C_APPLY_CACHE_HOST_NAME":           "edge1",
+		"T3C_APPLY_FILES":                     t3cutil.ApplyFilesFlagAll.String(),
+		"T3C_APPLY_UPDATE_STATUS":             torequest.UpdateTropsSuccessful.String(),
+		"T3C_APPLY_CHANGED_FILES":             "",
+		"T3C_APPLY_CHANGED_FILES_COUNT":       "0",
+		"T3C_APPLY_RELOAD":                    "true",
+		"T3C_APPLY_RESTART_NEEDED":            "false",
+		"T3C_APPLY_TRAFFIC_OPS_UPDATE_FAILED": "true",
+		"T3C_APPLY_UPDATE_STATUS_TRANSITIONS": "[]",
+		"T3C_APPLY_CHANGE_ID":                 "CHG-1",
+	} {
+		if actual, ok := env[name]; !ok || actual != expected {
+			t.Errorf("expected the post-apply command to get %s '%s', actual: '%s' (set: %t)", name, expected, actual, ok)
+		}
+	}
+
+	cfg.PostApplyCommand = "echo failing; exit 3"
+	if err := runPostApplyCommand(context.Background(), cfg, trops, torequest.UpdateTropsSuccessful, false); err == nil {
+		t.Error("expected an error from a post-apply command exiting non-zero")
+	}
+}
+
+func TestPreApplyCommandAbort(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Cfg{LockFilePath: filepath.Join(dir, "t3c.lock"), PreApplyCommand: "echo change freeze; exit 1"}
+	stats := &runStats{}
+
+	if code := lockAndRun(cfg, stats); code != ExitCodePreApplyError {
+		t.Errorf("expected a failing pre-apply command to exit with %d, actual: %d", ExitCodePreApplyError, code)
+	}
+	if stats.getTrops() != nil {
+		t.Error("expected a failing pre-apply command to abort before the run")
+	}
+	lock := util.FileLock{}
+	if !lock.GetLock(cfg.LockFilePath) {
+		t.Error("expected a failing pre-apply command to release the lock")
+	}
+	lock.Unlock()
+}
+
+func TestRunPreApplyCommand(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "env")
+	cfg := config.Cfg{PreApplyCommand: "env > " + envFile, ChangeID: "CHG-1", Files: t3cutil.ApplyFilesFlagReval}
+	cfg.CacheHostName = "edge1"
+
+	if err := runPreApplyCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("expected the pre-apply command to succeed, actual: %v", err)
+	}
+	env := readHookEnv(t, envFile)
+	for name, expected := range map[string]string{
+		"T3C_APPLY_CACHE_HOST_NAME": "edge1",
+		"T3C_APPLY_FILES":           t3cutil.ApplyFilesFlagReval.String(),
+		"T3C_APPLY_CHANGE_ID":       "CHG-1",
+	} {
+		if actual := env[name]; actual != expected {
+			t.Errorf("expected the pre-apply command to get %s '%s', actual: '%s'", name, expected, actual)
+		}
+	}
+}
+
+func TestSendRunMetrics(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listening for statsd: %v", err)
+	}
+	defer conn.Close()
+	cfg := config.Cfg{StatsdAddress: conn.LocalAddr().String(), StatsdPrefix: config.DefaultStatsdPrefix}
+	stats := &runStats{}
+	trops := torequest.NewTrafficOpsReq(context.Background(), cfg)
+	trops.TrafficServerRestart = true
+	stats.setTrops(trops)
+
+	// a failed run is counted too.
+	sendRunMetrics(cfg, stats, ExitCodeServicesError, 2*time.Second)
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("reading metrics: %v", err)
+	}
+	metrics := strings.Split(string(buf[:n]), "\n")
+	for _, expected := range []string{
+		"t3c.apply.runs:1|c",
+		"t3c.apply.run_duration:2000|ms",
+		"t3c.apply.exit_code:138|g",
+		"t3c.apply.success:0|g",
+		"t3c.apply.files_changed:0|g",
+		"t3c.apply.reload:0|g",
+		"t3c.apply.restart:1|g",
+	} {
+		found := false
+		for _, metric := range metrics {
+			found = found || metric == expected
+		}
+		if !found {
+			t.Errorf("expected metric '%s', actual: %v", expected, metrics)
+		}
+	}
+
+	// failing to send is only logged.
+	cfg.StatsdAddress = "not an address"
+	sendRunMetrics(cfg, stats, ExitCodeSuccess, time.Second)
+}
@@ -0,0 +1,87 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// ConfigFileAuditResult is the result of processing a config file, for
+// consumers outside t3c-apply, such as a policy engine gating deployments on
+// there being no failed prerequisites.
+type ConfigFileAuditResult struct {
+	Name          string   `json:"name"`
+	Path          string   `json:"path"`
+	Service       string   `json:"service"`
+	AuditComplete bool     `json:"auditComplete"`
+	AuditFailed   bool     `json:"auditFailed"`
+	ChangeNeeded  bool     `json:"changeNeeded"`
+	ChangeApplied bool     `json:"changeApplied"`
+	PreReqFailed  bool     `json:"prereqFailed"`
+	Warnings      []string `json:"warnings"`
+	ChangeID      string   `json:"changeId,omitempty"`
+}
+
+// AuditResults returns the audit result of each config file, sorted by path.
+// It must be called after ProcessConfigFiles, before which no file has been
+// audited.
+func (r *TrafficOpsReq) AuditResults() []ConfigFileAuditResult {
+	results := make([]ConfigFileAuditResult, 0, len(r.configFiles))
+	for _, cfg := range r.configFiles {
+		warnings := append([]string{}, r.configFileWarnings[cfg.Name]...)
+		results = append(results, ConfigFileAuditResult{
+			Name:          cfg.Name,
+			Path:          cfg.Path,
+			Service:       cfg.Service,
+			AuditComplete: cfg.AuditComplete,
+			AuditFailed:   cfg.AuditFailed,
+			ChangeNeeded:  cfg.ChangeNeeded,
+			ChangeApplied: cfg.ChangeApplied,
+			PreReqFailed:  cfg.PreReqFailed,
+			Warnings:      warnings,
+			ChangeID:      r.Cfg.ChangeID,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	return results
+}
+
+// WriteAuditJSON writes the AuditResults as a JSON array to the file at path,
+// or to stdout if path is "-".
+func (r *TrafficOpsReq) WriteAuditJSON(path string) error {
+	bts, err := json.MarshalIndent(r.AuditResults(), "", "  ")
+	if err != nil {
+		return errors.New("marshalling audit results: " + err.Error())
+	}
+	bts = append(bts, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(bts)
+	} else {
+		err = ioutil.WriteFile(path, bts, 0644)
+	}
+	if err != nil {
+		return errors.New("writing audit results to '" + path + "': " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAuditResults(t *testing.T) {
+	r := NewTrafficOpsReq(context.Background(), testCfg)
+	r.configFiles = map[string]*ConfigFile{
+		"remap.config":         {Name: "remap.config", Path: "/opt/trafficserver/etc/trafficserver/remap.config", Service: "trafficserver", AuditComplete: true, ChangeNeeded: true, PreReqFailed: true},
+		"records.config":       {Name: "records.config", Path: "/opt/trafficserver/etc/trafficserver/records.config", Service: "trafficserver", AuditComplete: true, ChangeNeeded: true, ChangeApplied: true},
+		"ssl_multicert.config": {Name: "ssl_multicert.config", Path: "/opt/trafficserver/etc/trafficserver/ssl_multicert.config", Service: "trafficserver", AuditComplete: true},
+		"":                     {Name: "", AuditFailed: true},
+	}
+	r.configFileWarnings = map[string][]string{"records.config": {"deprecated parameter"}}
+
+	expected := []ConfigFileAuditResult{
+		{Name: "", AuditFailed: true, Warnings: []string{}},
+		{Name: "records.config", Path: "/opt/trafficserver/etc/trafficserver/records.config", Service: "trafficserver", AuditComplete: true, ChangeNeeded: true, ChangeApplied: true, Warnings: []string{"deprecated parameter"}},
+		{Name: "remap.config", Path: "/opt/trafficserver/etc/trafficserver/remap.config", Service: "trafficserver", AuditComplete: true, ChangeNeeded: true, PreReqFailed: true, Warnings: []string{}},
+		{Name: "ssl_multicert.config", Path: "/opt/trafficserver/etc/trafficserver/ssl_multicert.config", Service: "trafficserver", AuditComplete: true, Warnings: []string{}},
+	}
+	results := r.AuditResults()
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected audit results %+v, actual: %+v", expected, results)
+	}
+
+	results[1].Warnings[0] = "changed"
+	if r.configFileWarnings["records.config"][0] != "deprecated parameter" {
+		t.Error("expected the audit results to not share the warnings of the run")
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.json")
+	if err := r.WriteAuditJSON(path); err != nil {
+		t.Fatalf("writing audit JSON: %v", err)
+	}
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading audit JSON: %v", err)
+	}
+	written := []map[string]interface{}{}
+	if err := json.Unmarshal(bts, &written); err != nil {
+		t.Fatalf("expected valid JSON, actual error: %v", err)
+	}
+	if len(written) != 4 || written[2]["name"] != "remap.config" || written[2]["prereqFailed"] != true || written[1]["prereqFailed"] != false {
+		t.Errorf("expected the audit results as JSON, actual: %s", bts)
+	}
+
+	if err := r.WriteAuditJSON(filepath.Join(t.TempDir(), "nonexistent", "audit.json")); err == nil {
+		t.Error("expected an error writing to a nonexistent directory")
+	}
+}
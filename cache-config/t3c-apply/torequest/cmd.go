@@ -23,6 +23,7 @@ package torequest
 
 import (
 	"bytes"
+	"context"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
@@ -49,8 +50,8 @@ type ServerAndConfigs struct {
 }
 
 // generate runs t3c-generate and returns the result.
-func generate(cfg config.Cfg) ([]t3cutil.ATSConfigFile, error) {
-	configData, err := requestConfig(cfg)
+func generate(ctx context.Context, cfg config.Cfg) ([]t3cutil.ATSConfigFile, error) {
+	configData, err := requestConfig(ctx, cfg)
 	if err != nil {
 		return nil, errors.New("requesting: " + err.Error())
 	}
@@ -85,7 +86,7 @@ func generate(cfg config.Cfg) ([]t3cutil.ATSConfigFile, error) {
 	args = append(args, "--disable-parent-config-comments="+strconv.FormatBool(cfg.DisableParentConfigComments))
 	args = append(args, "--use-strategies="+cfg.UseStrategies.String())
 
-	generatedFiles, stdErr, code := t3cutil.DoInput(configData, config.GenerateCmd, args...)
+	generatedFiles, stdErr, code := t3cutil.DoInputContext(ctx, configData, config.GenerateCmd, args...)
 	if code != 0 {
 		logSubAppErr(`t3c-generate stdout`, generatedFiles)
 		logSubAppErr(`t3c-generate stderr`, stdErr)
@@ -93,7 +94,7 @@ func generate(cfg config.Cfg) ([]t3cutil.ATSConfigFile, error) {
 	}
 	logSubApp(`t3c-generate`, stdErr)
 
-	preprocessedBytes, err := preprocess(cfg, configData, generatedFiles)
+	preprocessedBytes, err := preprocess(ctx, cfg, configData, generatedFiles)
 	if err != nil {
 		return nil, errors.New("preprocessing config files: " + err.Error())
 	}
@@ -108,7 +109,7 @@ func generate(cfg config.Cfg) ([]t3cutil.ATSConfigFile, error) {
 
 // preprocess takes the to Data from 't3c-request --get-data=config' and the generated files from 't3c-generate', passes them to `t3c-preprocess`, and returns the result.
 // t3c-preprocessは「t3c-request --get-data=config」や「t3c-generate」で生成された値を標準入力で受け付けます。
-func preprocess(cfg config.Cfg, configData []byte, generatedFiles []byte) ([]byte, error) {
+func preprocess(ctx context.Context, cfg config.Cfg, configData []byte, generatedFiles []byte) ([]byte, error) {
 	args := []string{}
 
 	if cfg.LogLocationErr == log.LogLocationNull {
@@ -122,7 +123,7 @@ func preprocess(cfg config.Cfg, configData []byte, generatedFiles []byte) ([]byt
 	}
 
 	// t3c-preprocessを実行します
-	cmd := exec.Command(`t3c-preprocess`, args...)
+	cmd := exec.CommandContext(ctx, `t3c-preprocess`, args...)
 	outbuf := bytes.Buffer{}
 	errbuf := bytes.Buffer{}
 	cmd.Stdout = &outbuf
@@ -176,9 +177,9 @@ func preprocess(cfg config.Cfg, configData []byte, generatedFiles []byte) ([]byt
 	return stdOut, nil
 }
 
-func getStatuses(cfg config.Cfg) ([]string, error) {
+func getStatuses(ctx context.Context, cfg config.Cfg) ([]string, error) {
 	statuses := []tc.StatusNullable{}
-	if err := requestJSON(cfg, "statuses", &statuses); err != nil {
+	if err := requestJSON(ctx, cfg, "statuses", &statuses); err != nil {
 		return nil, errors.New("requesting json: " + err.Error())
 	}
 	sl := []string{}
@@ -190,36 +191,36 @@ func getStatuses(cfg config.Cfg) ([]string, error) {
 	return sl, nil
 }
 
-func getChkconfig(cfg config.Cfg) ([]map[string]string, error) {
+func getChkconfig(ctx context.Context, cfg config.Cfg) ([]map[string]string, error) {
 	result := []map[string]string{}
 	// t3c-request --get-data=chkconfigが実行される
-	if err := requestJSON(cfg, "chkconfig", &result); err != nil {
+	if err := requestJSON(ctx, cfg, "chkconfig", &result); err != nil {
 		return nil, errors.New("requesting json: " + err.Error())
 	}
 	return result, nil
 }
 
-func getUpdateStatus(cfg config.Cfg) (*atscfg.ServerUpdateStatus, error) {
+func getUpdateStatus(ctx context.Context, cfg config.Cfg) (*atscfg.ServerUpdateStatus, error) {
 	status := atscfg.ServerUpdateStatus{}
 	// t3c-request --get-data=update-status が実行される
-	if err := requestJSON(cfg, "update-status", &status); err != nil {
+	if err := requestJSON(ctx, cfg, "update-status", &status); err != nil {
 		return nil, errors.New("requesting json: " + err.Error())
 	}
 	return &status, nil
 }
 
-func getSystemInfo(cfg config.Cfg) (map[string]interface{}, error) {
+func getSystemInfo(ctx context.Context, cfg config.Cfg) (map[string]interface{}, error) {
 	result := map[string]interface{}{}
-	if err := requestJSON(cfg, "system-info", &result); err != nil {
+	if err := requestJSON(ctx, cfg, "system-info", &result); err != nil {
 		return nil, errors.New("requesting json: " + err.Error())
 	}
 	return result, nil
 }
 
-func getPackages(cfg config.Cfg) ([]Package, error) {
+func getPackages(ctx context.Context, cfg config.Cfg) ([]Package, error) {
 	pkgs := []Package{}
 	// t3c-request --get-data=packages ... を実行する
-	if err := requestJSON(cfg, "packages", &pkgs); err != nil {
+	if err := requestJSON(ctx, cfg, "packages", &pkgs); err != nil {
 		return nil, errors.New("requesting json: " + err.Error())
 	}
 	return pkgs, nil
@@ -227,7 +228,7 @@ func getPackages(cfg config.Cfg) ([]Package, error) {
 
 // sendUpdate updates the given cache's queue update and reval status in Traffic Ops.
 // Note the statuses are the value to be set, not whether to set the value.
-func sendUpdate(cfg config.Cfg, configApplyTime, revalApplyTime *time.Time, configApplyBool, revalApplyBool *bool) error {
+func sendUpdate(ctx context.Context, cfg config.Cfg, configApplyTime, revalApplyTime *time.Time, configApplyBool, revalApplyBool *bool) error {
 	args := []string{
 		"--traffic-ops-timeout-milliseconds=" + strconv.FormatInt(int64(cfg.TOTimeoutMS), 10),
 		"--traffic-ops-user=" + cfg.TOUser,
@@ -281,7 +282,7 @@ func sendUpdate(cfg config.Cfg, configApplyTime, revalApplyTime *time.Time, conf
 	}
 
 	// ここで t3c-updateを呼び出しTrafficOps APIにリクエストしてステータスを更新させる
-	stdOut, stdErr, code := t3cutil.Do(`t3c-update`, args...)
+	stdOut, stdErr, code := t3cutil.DoContext(ctx, `t3c-update`, args...)
 	if code != 0 {
 		logSubAppErr(`t3c-update stdout`, stdOut)
 		logSubAppErr(`t3c-update stderr`, stdErr)
@@ -396,12 +397,12 @@ func checkCert(c []byte) error {
 }
 
 // checkReload is a helper for the sub-command t3c-check-reload.
-func checkReload(changedConfigFiles []string) (t3cutil.ServiceNeeds, error) {
+func checkReload(ctx context.Context, changedConfigFiles []string) (t3cutil.ServiceNeeds, error) {
 	log.Infof("t3c-check-reload calling with changedConfigFiles '%v'\n", changedConfigFiles)
 
 	changedFiles := []byte(strings.Join(changedConfigFiles, ","))
 
-	cmd := exec.Command(`t3c-check-reload`)
+	cmd := exec.CommandContext(ctx, `t3c-check-reload`)
 	outBuf := bytes.Buffer{}
 	errBuf := bytes.Buffer{}
 	cmd.Stdout = &outBuf
@@ -454,8 +455,8 @@ func checkReload(changedConfigFiles []string) (t3cutil.ServiceNeeds, error) {
 }
 
 // requestJSON calls t3c-request with the given command, and deserializes the result as JSON into obj.
-func requestJSON(cfg config.Cfg, command string, obj interface{}) error {
-	stdOut, err := request(cfg, command)
+func requestJSON(ctx context.Context, cfg config.Cfg, command string, obj interface{}) error {
+	stdOut, err := request(ctx, cfg, command)
 	if err != nil {
 		return errors.New("requesting: " + err.Error())
 	}
@@ -466,7 +467,7 @@ func requestJSON(cfg config.Cfg, command string, obj interface{}) error {
 }
 
 // request calls t3c-request with the given command, and returns the stdout bytes.
-func request(cfg config.Cfg, command string) ([]byte, error) {
+func request(ctx context.Context, cfg config.Cfg, command string) ([]byte, error) {
 	args := []string{
 		"--traffic-ops-insecure=" + strconv.FormatBool(cfg.TOInsecure),
 		"--traffic-ops-timeout-milliseconds=" + strconv.FormatInt(int64(cfg.TOTimeoutMS), 10),
@@ -493,7 +494,7 @@ func request(cfg config.Cfg, command string) ([]byte, error) {
 	if _, used := os.LookupEnv("TO_URL"); !used {
 		args = append(args, "--traffic-ops-url="+cfg.TOURL)
 	}
-	stdOut, stdErr, code := t3cutil.Do(`t3c-request`, args...)
+	stdOut, stdErr, code := t3cutil.DoContext(ctx, `t3c-request`, args...)
 	if code != 0 {
 		logSubAppErr(`t3c-request stdout`, stdOut)
 		logSubAppErr(`t3c-request stderr`, stdErr)
@@ -507,13 +508,13 @@ func request(cfg config.Cfg, command string) ([]byte, error) {
 
 // requestConfig calls t3c-request and returns the stdout bytes.
 // It also caches the config in /var/lib/trafficcontrol-cache-config and uses the cache to issue IMS requests.
-func requestConfig(cfg config.Cfg) ([]byte, error) {
+func requestConfig(ctx context.Context, cfg config.Cfg) ([]byte, error) {
 	// TODO support /opt
 
 	cacheBts := ([]byte)(nil)
 	if !cfg.NoCache {
 		err := error(nil)
-		if cacheBts, err = ioutil.ReadFile(t3cutil.ApplyCachePath); err != nil {
+		if cacheBts, err = ioutil.ReadFile(cfg.ConfigCachePath); err != nil {
 			// don't log an error if the cache didn't exist
 			if !os.IsNotExist(err) {
 				log.Errorln("getting cached config data failed, not using cache! Error: " + err.Error())
@@ -558,9 +559,9 @@ func requestConfig(cfg config.Cfg) ([]byte, error) {
 	stdErr := ([]byte)(nil)
 	code := 0
 	if len(cacheBts) > 0 {
-		stdOut, stdErr, code = t3cutil.DoInput(cacheBts, `t3c`, args...)
+		stdOut, stdErr, code = t3cutil.DoInputContext(ctx, cacheBts, `t3c`, args...)
 	} else {
-		stdOut, stdErr, code = t3cutil.Do(`t3c`, args...)
+		stdOut, stdErr, code = t3cutil.DoContext(ctx, `t3c`, args...)
 	}
 	if code != 0 {
 		logSubAppErr(`t3c-request stdout`, stdOut)
@@ -569,7 +570,7 @@ func requestConfig(cfg config.Cfg) ([]byte, error) {
 	}
 	logSubApp(`t3c-request`, stdErr)
 
-	if err := ioutil.WriteFile(t3cutil.ApplyCachePath, stdOut, 0600); err != nil {
+	if err := ioutil.WriteFile(cfg.ConfigCachePath, stdOut, 0600); err != nil {
 		log.Errorln("writing config data to cache failed: " + err.Error())
 	}
 
@@ -0,0 +1,118 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// configFileState is the state of a config file on disk, used to detect
+// another process changing it between when it's audited and replaced.
+type configFileState struct {
+	Exists  bool
+	Size    int64
+	ModTime time.Time
+	SHA256  [sha256.Size]byte
+}
+
+// Equal returns whether the states are of the same file contents.
+func (s configFileState) Equal(other configFileState) bool {
+	return s.Exists == other.Exists &&
+		s.Size == other.Size &&
+		s.ModTime.Equal(other.ModTime) &&
+		s.SHA256 == other.SHA256
+}
+
+// getConfigFileState returns the state of the file at path, following
+// symlinks. A file which doesn't exist is not an error.
+func getConfigFileState(path string) (configFileState, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return configFileState{}, nil
+		}
+		return configFileState{}, err
+	}
+	fl, err := os.Open(path)
+	if err != nil {
+		return configFileState{}, err
+	}
+	defer fl.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fl); err != nil {
+		return configFileState{}, errors.New("reading: " + err.Error())
+	}
+	state := configFileState{
+		Exists:  true,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}
+	copy(state.SHA256[:], hash.Sum(nil))
+	return state, nil
+}
+
+// checkExternallyModified returns whether the config file at path, which
+// replaceCfgFile is about to replace with cfg, may be replaced, because it
+// wasn't changed since it was audited, or because it was and
+// --externally-modified-config-files=reaudit found it still needs changing.
+//
+// A change is logged and added to the warning summary, and with
+// --externally-modified-config-files=skip, the file is never replaced and an
+// error is returned, so the change made by another tool isn't overwritten.
+func (r *TrafficOpsReq) checkExternallyModified(cfg *ConfigFile, path string) (bool, error) {
+	if cfg.auditState == nil {
+		return true, nil
+	}
+	state, err := getConfigFileState(path)
+	if err != nil {
+		return false, errors.New("getting the state of '" + path + "': " + err.Error())
+	}
+	if state.Equal(*cfg.auditState) {
+		return true, nil
+	}
+
+	warn := "was modified by another process after it was audited"
+	log.Warnln(path + ": " + warn)
+	r.configFileWarnings[cfg.Name] = append(r.configFileWarnings[cfg.Name], warn)
+
+	if r.Cfg.ExternallyModifiedConfigFiles != config.ExternallyModifiedConfigFilesReaudit {
+		return false, errors.New("'" + path + "' " + warn + ", not replacing it")
+	}
+
+	log.Infof("Re-auditing config file '%s'\n", path)
+	changeNeeded, err := r.diff(r.Cfg, cfg.Body, cfg.Path, r.Cfg.ReportOnly, cfg.Perm, cfg.Uid, cfg.Gid)
+	if err != nil {
+		return false, errors.New("re-auditing '" + path + "': " + err.Error())
+	}
+	cfg.auditState = &state
+	cfg.ChangeNeeded = changeNeeded
+	if !changeNeeded {
+		log.Infof("Config file '%s' no longer needs changing after it was modified, not replacing it\n", path)
+	}
+	return changeNeeded, nil
+}
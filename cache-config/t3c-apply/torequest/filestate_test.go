@@ -0,0 +1,138 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+func TestGetConfigFileState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.config")
+
+	state, err := getConfigFileState(path)
+	if err != nil {
+		t.Fatalf("getting the state of a missing file: %v", err)
+	}
+	if state.Exists {
+		t.Error("expected a missing file to not exist")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("foo"), 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	state, err = getConfigFileState(path)
+	if err != nil {
+		t.Fatalf("getting the state: %v", err)
+	}
+	if !state.Exists || state.Size != 3 {
+		t.Errorf("expected an existing file of size 3, actual: %+v", state)
+	}
+	if again, err := getConfigFileState(path); err != nil || !again.Equal(state) {
+		t.Errorf("expected the state of an unchanged file to be equal, actual: %+v %v", again, err)
+	}
+
+	// the same size and modification time, but different contents.
+	if err := ioutil.WriteFile(path, []byte("bar"), 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	if err := os.Chtimes(path, state.ModTime, state.ModTime); err != nil {
+		t.Fatalf("setting modification time: %v", err)
+	}
+	if changed, err := getConfigFileState(path); err != nil || changed.Equal(state) {
+		t.Errorf("expected the state of a changed file to differ, actual: %+v %v", changed, err)
+	}
+}
+
+// TestReplaceCfgFileExternallyModified simulates another process modifying a
+// config file after it's audited and before it's replaced.
+func TestReplaceCfgFileExternallyModified(t *testing.T) {
+	tests := []struct {
+		name        string
+		modified    config.ExternallyModifiedConfigFilesFlag // empty is not modified
+		modifiedTo  string
+		expected    string
+		expectErr   bool
+		expectApply bool
+	}{
+		{"unmodified", "", "", "new", false, true},
+		{"skip", config.ExternallyModifiedConfigFilesSkip, "external", "external", true, false},
+		{"reaudit still differs", config.ExternallyModifiedConfigFilesReaudit, "external", "new", false, true},
+		{"reaudit no longer differs", config.ExternallyModifiedConfigFilesReaudit, "new", "new", false, false},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "records.config")
+		if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+			t.Fatalf("%s: writing file: %v", test.name, err)
+		}
+
+		cfg := testCfg
+		cfg.Files = t3cutil.ApplyFilesFlagAll
+		cfg.ExternallyModifiedConfigFiles = test.modified
+		r := NewTrafficOpsReq(context.Background(), cfg)
+		r.configFileWarnings = map[string][]string{}
+		r.diff = func(cfg config.Cfg, newFile []byte, fileLocation string, reportOnly bool, perm os.FileMode, uid int, gid int) (bool, error) {
+			current, err := ioutil.ReadFile(fileLocation)
+			return err != nil || string(current) != string(newFile), nil
+		}
+		cfgFile := &ConfigFile{Name: "records.config", Dir: dir, Path: path, Body: []byte("new"), Perm: 0644, Uid: os.Getuid(), Gid: os.Getgid()}
+
+		if err := r.checkConfigFile(cfgFile, nil); err != nil {
+			t.Fatalf("%s: auditing: %v", test.name, err)
+		}
+		if !cfgFile.ChangeNeeded {
+			t.Fatalf("%s: expected a change to be needed", test.name)
+		}
+		if test.modified != "" {
+			if err := ioutil.WriteFile(path, []byte(test.modifiedTo), 0644); err != nil {
+				t.Fatalf("%s: modifying file: %v", test.name, err)
+			}
+		}
+
+		_, err := r.replaceCfgFile(cfgFile)
+		if test.expectErr != (err != nil) {
+			t.Errorf("%s: expected error %t, actual: %v", test.name, test.expectErr, err)
+		}
+		if cfgFile.ChangeApplied != test.expectApply {
+			t.Errorf("%s: expected change applied %t, actual: %t", test.name, test.expectApply, cfgFile.ChangeApplied)
+		}
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: reading file: %v", test.name, err)
+		}
+		if string(body) != test.expected {
+			t.Errorf("%s: expected file contents '%s', actual: '%s'", test.name, test.expected, body)
+		}
+		if _, err := os.Stat(path + configFileTempSuffix); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no temp file to be left, actual: %v", test.name, err)
+		}
+		if warned := len(r.configFileWarnings["records.config"]) > 0; warned != (test.modified != "") {
+			t.Errorf("%s: expected a warning %t, actual: %v", test.name, test.modified != "", r.configFileWarnings)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// orphanedConfigFilePrefixes are the name prefixes of the per-Delivery Service
+// config files Traffic Ops generates. Only files named with one of them, and
+// the atscfg.ConfigSuffix, are ever considered orphaned.
+var orphanedConfigFilePrefixes = []string{
+	atscfg.HeaderRewritePrefix,
+	atscfg.RegexRemapPrefix,
+	atscfg.CacheUrlPrefix,
+	"url_sig_",
+	"uri_signing_",
+}
+
+// isPerDSConfigFileName returns whether name is the name of a per-Delivery
+// Service config file.
+func isPerDSConfigFileName(name string) bool {
+	if !strings.HasSuffix(name, atscfg.ConfigSuffix) {
+		return false
+	}
+	for _, prefix := range orphanedConfigFilePrefixes {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix)+len(atscfg.ConfigSuffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReconcileOrphanedConfigFiles warns about, or with
+// --orphaned-config-files=remove removes, the per-Delivery Service config files
+// on disk which Traffic Ops no longer generates, e.g. because the Delivery
+// Service was removed. It must be called after ProcessConfigFiles, with
+// whether it succeeded.
+//
+// Files are only considered when every file was generated and is being
+// applied, since otherwise a file which wasn't generated may still be in use.
+// Files are only removed if processing succeeded, since otherwise the
+// remap.config or plugin.config on disk may not be the generated one, and
+// may still reference them; they are warned about instead.
+func (r *TrafficOpsReq) ReconcileOrphanedConfigFiles(processed bool) {
+	if r.Cfg.OrphanedConfigFiles != config.OrphanedConfigFilesWarn && r.Cfg.OrphanedConfigFiles != config.OrphanedConfigFilesRemove {
+		return
+	}
+	if r.Cfg.Files != t3cutil.ApplyFilesFlagAll || r.Cfg.FilesFilter != "" {
+		log.Infoln("not checking for orphaned config files, because not every config file is being applied")
+		return
+	}
+	if len(r.configFiles) == 0 {
+		log.Warnln("not checking for orphaned config files, because no config files were generated")
+		return
+	}
+
+	orphans, err := findOrphanedConfigFiles(r.configFiles, r.Cfg.TsConfigDir)
+	if err != nil {
+		log.Errorln("checking for orphaned config files: " + err.Error())
+		return
+	}
+
+	remove := r.Cfg.OrphanedConfigFiles == config.OrphanedConfigFilesRemove && !r.Cfg.ReportOnly
+	if remove && !processed && len(orphans) > 0 {
+		log.Warnln("not removing orphaned config files, because processing the config files failed")
+		remove = false
+	}
+	for _, path := range orphans {
+		if !remove {
+			warn := "is no longer generated by Traffic Ops, and may be removed"
+			log.Warnln(path + ": " + warn)
+			r.configFileWarnings[filepath.Base(path)] = append(r.configFileWarnings[filepath.Base(path)], warn)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Errorln("removing orphaned config file '" + path + "': " + err.Error())
+			continue
+		}
+		log.Infoln("removed orphaned config file '" + path + "', which is no longer generated by Traffic Ops")
+	}
+}
+
+// findOrphanedConfigFiles returns the paths of the per-Delivery Service config
+// files which aren't in configFiles, sorted. To avoid ever returning a file
+// t3c doesn't manage, a file is only returned if it:
+//   - is in tsConfigDir, or a directory a generated per-Delivery Service config file is in, and not in a subdirectory of one,
+//   - is named like a per-Delivery Service config file,
+//   - is a regular file, not a symlink or anything else,
+//   - isn't referenced by the generated remap.config or plugin.config, or the ones on disk.
+func findOrphanedConfigFiles(configFiles map[string]*ConfigFile, tsConfigDir string) ([]string, error) {
+	if tsConfigDir == "" {
+		return nil, errors.New("no config directory")
+	}
+
+	dirs := map[string]struct{}{filepath.Clean(tsConfigDir): {}}
+	generated := map[string]struct{}{}
+	for _, cfg := range configFiles {
+		generated[filepath.Clean(cfg.Path)] = struct{}{}
+		if isPerDSConfigFileName(cfg.Name) && cfg.Dir != "" {
+			dirs[filepath.Clean(cfg.Dir)] = struct{}{}
+		}
+	}
+
+	referenced := map[string]struct{}{}
+	for _, refFileName := range []string{"remap.config", "plugin.config"} {
+		path := filepath.Join(tsConfigDir, refFileName)
+		if cfg, ok := configFiles[refFileName]; ok {
+			path = cfg.Path
+			for _, ref := range t3cutil.ConfigFileRefs(string(cfg.Body)) {
+				referenced[filepath.Base(ref)] = struct{}{}
+			}
+		}
+		// the file on disk is still in use if writing the generated one failed or was skipped
+		onDisk, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.New("reading '" + path + "' for the files it references: " + err.Error())
+		}
+		for _, ref := range t3cutil.ConfigFileRefs(string(onDisk)) {
+			referenced[filepath.Base(ref)] = struct{}{}
+		}
+	}
+
+	orphans := []string{}
+	for dir := range dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.New("reading directory '" + dir + "': " + err.Error())
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			path := filepath.Join(dir, name)
+			if !entry.Mode().IsRegular() || !isPerDSConfigFileName(name) {
+				continue
+			}
+			if _, ok := generated[path]; ok {
+				continue
+			}
+			if _, ok := configFiles[name]; ok {
+				continue // generated, but into another directory; leave it to the operator
+			}
+			if _, ok := referenced[name]; ok {
+				continue
+			}
+			orphans = append(orphans, path)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
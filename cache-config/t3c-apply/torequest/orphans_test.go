@@ -0,0 +1,153 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+// writeOrphanTestFiles creates the files of the orphaned config file tests in
+// dir, returning the generated config files.
+func writeOrphanTestFiles(t *testing.T, dir string) map[string]*ConfigFile {
+	t.Helper()
+	for _, name := range []string{
+		"hdr_rw_ds1.config",           // generated
+		"hdr_rw_removed.config",       // orphaned
+		"regex_remap_removed.config",  // orphaned
+		"url_sig_referenced.config",   // referenced by remap.config
+		"hdr_rw_.config",              // no Delivery Service name
+		"hdr_rw_notes.txt",            // not a config file
+		"my_custom.config",            // not a per-Delivery Service config file
+		"records.config",              // not a per-Delivery Service config file
+		"cacheurl_elsewhere.config",   // generated into another directory
+		"uri_signing_removed.config~", // editor backup
+		"regex_remap_on_disk.config",  // referenced by the remap.config on disk
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+	// the remap.config on disk isn't the generated one, e.g. because writing it failed.
+	if err := ioutil.WriteFile(filepath.Join(dir, "remap.config"), []byte("map http://c/ http://d/ @plugin=regex_remap.so @pparam=regex_remap_on_disk.config\n"), 0644); err != nil {
+		t.Fatalf("writing remap.config: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "regex_remap_dir.config"), 0755); err != nil {
+		t.Fatalf("creating directory: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "my_custom.config"), filepath.Join(dir, "hdr_rw_link.config")); err != nil {
+		t.Fatalf("creating symlink: %v", err)
+	}
+	subdir := filepath.Join(dir, "sub")
+	if err := os.Mkdir(subdir, 0755); err != nil {
+		t.Fatalf("creating directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(subdir, "hdr_rw_nested.config"), []byte("x"), 0644); err != nil {
+		t.Fatalf("writing nested file: %v", err)
+	}
+
+	return map[string]*ConfigFile{
+		"hdr_rw_ds1.config":         {Name: "hdr_rw_ds1.config", Dir: dir, Path: filepath.Join(dir, "hdr_rw_ds1.config")},
+		"cacheurl_elsewhere.config": {Name: "cacheurl_elsewhere.config", Dir: "/nonexistent", Path: "/nonexistent/cacheurl_elsewhere.config"},
+		"remap.config": {Name: "remap.config", Dir: dir, Path: filepath.Join(dir, "remap.config"),
+			Body: []byte("map http://a/ http://b/ @plugin=url_sig.so @pparam=url_sig_referenced.config\n")},
+	}
+}
+
+func TestFindOrphanedConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	configFiles := writeOrphanTestFiles(t, dir)
+
+	orphans, err := findOrphanedConfigFiles(configFiles, dir)
+	if err != nil {
+		t.Fatalf("finding orphaned config files: %v", err)
+	}
+	expected := []string{filepath.Join(dir, "hdr_rw_removed.config"), filepath.Join(dir, "regex_remap_removed.config")}
+	if !reflect.DeepEqual(orphans, expected) {
+		t.Errorf("expected orphaned config files %v, actual: %v", expected, orphans)
+	}
+
+	if _, err := findOrphanedConfigFiles(configFiles, ""); err == nil {
+		t.Error("expected an error without a config directory")
+	}
+}
+
+func TestReconcileOrphanedConfigFiles(t *testing.T) {
+	exists := func(path string) bool {
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+
+	tests := []struct {
+		name      string
+		setCfg    func(cfg *config.Cfg)
+		processed bool
+		removed   bool
+		warned    bool
+	}{
+		{"ignore", func(cfg *config.Cfg) { cfg.OrphanedConfigFiles = config.OrphanedConfigFilesIgnore }, true, false, false},
+		{"warn", func(cfg *config.Cfg) { cfg.OrphanedConfigFiles = config.OrphanedConfigFilesWarn }, true, false, true},
+		{"remove", func(cfg *config.Cfg) { cfg.OrphanedConfigFiles = config.OrphanedConfigFilesRemove }, true, true, false},
+		{"remove processing failed", func(cfg *config.Cfg) { cfg.OrphanedConfigFiles = config.OrphanedConfigFilesRemove }, false, false, true},
+		{"remove report only", func(cfg *config.Cfg) {
+			cfg.OrphanedConfigFiles = config.OrphanedConfigFilesRemove
+			cfg.ReportOnly = true
+		}, true, false, true},
+		{"remove reval", func(cfg *config.Cfg) {
+			cfg.OrphanedConfigFiles = config.OrphanedConfigFilesRemove
+			cfg.Files = t3cutil.ApplyFilesFlagReval
+		}, true, false, false},
+		{"remove files filter", func(cfg *config.Cfg) {
+			cfg.OrphanedConfigFiles = config.OrphanedConfigFilesRemove
+			cfg.FilesFilter = "hdr_rw_*"
+		}, true, false, false},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		cfg := testCfg
+		cfg.TsConfigDir = dir
+		cfg.Files = t3cutil.ApplyFilesFlagAll
+		test.setCfg(&cfg)
+		r := NewTrafficOpsReq(context.Background(), cfg)
+		r.configFiles = writeOrphanTestFiles(t, dir)
+		r.configFileWarnings = map[string][]string{}
+
+		r.ReconcileOrphanedConfigFiles(test.processed)
+
+		if actual := !exists(filepath.Join(dir, "hdr_rw_removed.config")); actual != test.removed {
+			t.Errorf("%s: expected orphaned config file removed %t, actual: %t", test.name, test.removed, actual)
+		}
+		if actual := len(r.configFileWarnings["hdr_rw_removed.config"]) > 0; actual != test.warned {
+			t.Errorf("%s: expected a warning about the orphaned config file %t, actual: %t", test.name, test.warned, actual)
+		}
+		for _, name := range []string{"hdr_rw_ds1.config", "url_sig_referenced.config", "regex_remap_on_disk.config", "hdr_rw_.config", "hdr_rw_notes.txt", "my_custom.config", "records.config", "cacheurl_elsewhere.config", "uri_signing_removed.config~", "regex_remap_dir.config", "hdr_rw_link.config", "sub/hdr_rw_nested.config"} {
+			if !exists(filepath.Join(dir, name)) {
+				t.Errorf("%s: expected unmanaged or generated file '%s' to be kept", test.name, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"os/user"
+	"strconv"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// lookupATSOwner returns the uid and gid of the config.TrafficServerOwner user.
+func lookupATSOwner() (int, int, error) {
+	atsUser, err := user.Lookup(config.TrafficServerOwner)
+	if err != nil {
+		return 0, 0, err
+	}
+	uid, err := strconv.Atoi(atsUser.Uid)
+	if err != nil {
+		return 0, 0, errors.New("parsing uid '" + atsUser.Uid + "': " + err.Error())
+	}
+	gid, err := strconv.Atoi(atsUser.Gid)
+	if err != nil {
+		return 0, 0, errors.New("parsing gid '" + atsUser.Gid + "': " + err.Error())
+	}
+	return uid, gid, nil
+}
+
+// refreshATSOwner looks up the trafficserver owner again, in case its uid or
+// gid changed since the config files were generated, e.g. because
+// trafficserver was installed, and its user created, in the meantime. If they
+// did, it warns, and changes the ownership of the config files owned by the
+// previous uid or gid to the current ones, so they aren't written with stale
+// ownership. If the owner can't be looked up, the previous ownership is kept.
+func (r *TrafficOpsReq) refreshATSOwner() {
+	uid, gid, err := r.lookupATSOwner()
+	if err != nil {
+		log.Errorf("could not lookup the trafficserver, '%s', owner again, keeping uid %d gid %d: %s\n", config.TrafficServerOwner, r.atsUid, r.atsGid, err.Error())
+		return
+	}
+	if uid == r.atsUid && gid == r.atsGid {
+		return
+	}
+	log.Warnf("the trafficserver, '%s', owner changed from uid %d gid %d to uid %d gid %d since the config files were generated, using the new ownership\n", config.TrafficServerOwner, r.atsUid, r.atsGid, uid, gid)
+	for _, cfg := range r.configFiles {
+		if cfg.Uid == r.atsUid {
+			cfg.Uid = uid
+		}
+		if cfg.Gid == r.atsGid {
+			cfg.Gid = gid
+		}
+	}
+	r.atsUid, r.atsGid = uid, gid
+}
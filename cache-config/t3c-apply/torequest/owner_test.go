@@ -0,0 +1,62 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRefreshATSOwner(t *testing.T) {
+	tests := []struct {
+		name        string
+		uid         int
+		gid         int
+		err         error
+		expectedUid int
+		expectedGid int
+	}{
+		{"unchanged", 100, 200, nil, 100, 200},
+		{"changed", 300, 400, nil, 300, 400},
+		{"lookup failed", 300, 400, errors.New("unknown user"), 100, 200},
+	}
+	for _, test := range tests {
+		r := NewTrafficOpsReq(context.Background(), testCfg)
+		r.atsUid, r.atsGid = 100, 200
+		r.configFiles = map[string]*ConfigFile{
+			"records.config": {Name: "records.config", Uid: 100, Gid: 200},
+			"sysctl.conf":    {Name: "sysctl.conf", Uid: 0, Gid: 0},
+		}
+		r.lookupATSOwner = func() (int, int, error) { return test.uid, test.gid, test.err }
+
+		r.refreshATSOwner()
+
+		if cfg := r.configFiles["records.config"]; cfg.Uid != test.expectedUid || cfg.Gid != test.expectedGid {
+			t.Errorf("%s: expected the config file to be owned by %d:%d, actual: %d:%d", test.name, test.expectedUid, test.expectedGid, cfg.Uid, cfg.Gid)
+		}
+		if r.atsUid != test.expectedUid || r.atsGid != test.expectedGid {
+			t.Errorf("%s: expected the trafficserver owner %d:%d, actual: %d:%d", test.name, test.expectedUid, test.expectedGid, r.atsUid, r.atsGid)
+		}
+		if cfg := r.configFiles["sysctl.conf"]; cfg.Uid != 0 || cfg.Gid != 0 {
+			t.Errorf("%s: expected a config file owned by another user to be unchanged, actual: %d:%d", test.name, cfg.Uid, cfg.Gid)
+		}
+	}
+}
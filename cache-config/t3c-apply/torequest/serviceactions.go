@@ -0,0 +1,97 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+// ServiceActionNeeded is the action a service needs for the config changes of
+// a run to take effect.
+type ServiceActionNeeded string
+
+const (
+	ServiceActionNeededRestart = ServiceActionNeeded("restart")
+	ServiceActionNeededReload  = ServiceActionNeeded("reload")
+	ServiceActionNeededNone    = ServiceActionNeeded("none")
+)
+
+// ServiceActionResult is the action a service needs, but which wasn't taken
+// because of --report-only, so that orchestration can take it out-of-band.
+type ServiceActionResult struct {
+	Service string              `json:"service"`
+	Action  ServiceActionNeeded `json:"action"`
+}
+
+// setReportOnlyServiceActions records the actions the services need, given
+// what trafficserver needs, for a run with --report-only, which takes none
+// of them.
+func (r *TrafficOpsReq) setReportOnlyServiceActions(serviceNeeds t3cutil.ServiceNeeds) {
+	tsAction := ServiceActionNeededNone
+	if serviceNeeds == t3cutil.ServiceNeedsRestart {
+		tsAction = ServiceActionNeededRestart
+	} else if serviceNeeds == t3cutil.ServiceNeedsReload {
+		tsAction = ServiceActionNeededReload
+	}
+	ntpdAction := ServiceActionNeededNone
+	if r.NtpdRestart {
+		ntpdAction = ServiceActionNeededRestart
+	}
+	sysctlAction := ServiceActionNeededNone
+	if r.SysCtlReload {
+		sysctlAction = ServiceActionNeededReload
+	}
+	r.serviceActions = []ServiceActionResult{
+		{Service: r.Cfg.ServiceName, Action: tsAction},
+		{Service: "ntpd", Action: ntpdAction},
+		{Service: "sysctl", Action: sysctlAction},
+	}
+}
+
+// ServiceActions returns the actions the services need for the config changes
+// of the run to take effect. They're only known with --report-only, after
+// StartServices; otherwise, the actions were taken, and none are returned.
+func (r *TrafficOpsReq) ServiceActions() []ServiceActionResult {
+	return append([]ServiceActionResult{}, r.serviceActions...)
+}
+
+// WriteServiceActionsJSON writes the ServiceActions as a JSON array to the file
+// at path, or to stdout if path is "-".
+func (r *TrafficOpsReq) WriteServiceActionsJSON(path string) error {
+	bts, err := json.MarshalIndent(r.ServiceActions(), "", "  ")
+	if err != nil {
+		return errors.New("marshalling service actions: " + err.Error())
+	}
+	bts = append(bts, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(bts)
+	} else {
+		err = ioutil.WriteFile(path, bts, 0644)
+	}
+	if err != nil {
+		return errors.New("writing service actions to '" + path + "': " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+)
+
+func TestServiceActions(t *testing.T) {
+	cfg := testCfg
+	cfg.ReportOnly = true
+	cfg.ServiceName = "trafficserver"
+	r := NewTrafficOpsReq(context.Background(), cfg)
+	if actions := r.ServiceActions(); len(actions) != 0 {
+		t.Errorf("expected no service actions before StartServices, actual: %+v", actions)
+	}
+
+	r.NtpdRestart = true
+	r.setReportOnlyServiceActions(t3cutil.ServiceNeedsRestart)
+	expected := []ServiceActionResult{
+		{Service: "trafficserver", Action: ServiceActionNeededRestart},
+		{Service: "ntpd", Action: ServiceActionNeededRestart},
+		{Service: "sysctl", Action: ServiceActionNeededNone},
+	}
+	if actions := r.ServiceActions(); !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expected service actions %+v, actual: %+v", expected, actions)
+	}
+
+	r.NtpdRestart = false
+	r.SysCtlReload = true
+	r.setReportOnlyServiceActions(t3cutil.ServiceNeedsReload)
+	path := filepath.Join(t.TempDir(), "service-actions.json")
+	if err := r.WriteServiceActionsJSON(path); err != nil {
+		t.Fatalf("writing service actions JSON: %v", err)
+	}
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading service actions JSON: %v", err)
+	}
+	written := []map[string]string{}
+	if err := json.Unmarshal(bts, &written); err != nil {
+		t.Fatalf("expected valid JSON, actual error: %v", err)
+	}
+	expectedJSON := []map[string]string{
+		{"service": "trafficserver", "action": "reload"},
+		{"service": "ntpd", "action": "none"},
+		{"service": "sysctl", "action": "reload"},
+	}
+	if !reflect.DeepEqual(written, expectedJSON) {
+		t.Errorf("expected the service actions as JSON, actual: %s", bts)
+	}
+
+	r.setReportOnlyServiceActions(t3cutil.ServiceNeedsNothing)
+	if actions := r.ServiceActions(); actions[0].Action != ServiceActionNeededNone {
+		t.Errorf("expected trafficserver to need no action, actual: %+v", actions)
+	}
+}
+
+// TestReportOnlyServiceActions runs --report-only against changed config files,
+// from auditing them through reporting the service actions they need.
+func TestReportOnlyServiceActions(t *testing.T) {
+	dir := t.TempDir()
+	recordsPath := filepath.Join(dir, "records.config")
+	ntpdPath := filepath.Join(dir, "ntpd.conf")
+	for _, path := range []string{recordsPath, ntpdPath} {
+		if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+			t.Fatalf("writing file: %v", err)
+		}
+	}
+
+	cfg := testCfg
+	cfg.ReportOnly = true
+	cfg.Files = t3cutil.ApplyFilesFlagAll
+	cfg.ServiceName = "trafficserver"
+	cfg.TsConfigDir = dir
+	r := NewTrafficOpsReq(context.Background(), cfg)
+	r.configFileWarnings = map[string][]string{}
+	r.pkgs["trafficserver"] = true
+	r.atsUid, r.atsGid = os.Getuid(), os.Getgid()
+	r.lookupATSOwner = func() (int, int, error) { return os.Getuid(), os.Getgid(), nil }
+	r.diff = func(cfg config.Cfg, newFile []byte, fileLocation string, reportOnly bool, perm os.FileMode, uid int, gid int) (bool, error) {
+		current, err := ioutil.ReadFile(fileLocation)
+		return err != nil || string(current) != string(newFile), nil
+	}
+	checkedFiles := []string{}
+	r.checkReload = func(ctx context.Context, changedConfigFiles []string) (t3cutil.ServiceNeeds, error) {
+		checkedFiles = append(checkedFiles, changedConfigFiles...)
+		return t3cutil.ServiceNeedsReload, nil
+	}
+	r.configFiles = map[string]*ConfigFile{
+		"records.config": {Name: "records.config", Dir: dir, Path: recordsPath, Body: []byte("new"), Perm: 0644, Uid: os.Getuid(), Gid: os.Getgid()},
+		"ntpd.conf":      {Name: "ntpd.conf", Dir: dir, Path: ntpdPath, Body: []byte("new"), Perm: 0644, Uid: os.Getuid(), Gid: os.Getgid()},
+	}
+
+	syncdsUpdate, err := r.ProcessConfigFiles()
+	if err != nil {
+		t.Fatalf("processing config files: %v", err)
+	}
+	if changed := r.ChangedFiles(); len(changed) != 2 {
+		t.Errorf("expected both files to be reported as changed, actual: %v", changed)
+	}
+	if !r.TrafficCtlReload || !r.NtpdRestart || r.SysCtlReload {
+		t.Errorf("expected a trafficserver reload and an ntpd restart to be needed, actual: %+v", r.RestartData)
+	}
+	if err := r.StartServices(&syncdsUpdate); err != nil {
+		t.Fatalf("starting services: %v", err)
+	}
+	sort.Strings(checkedFiles)
+	if expected := []string{ntpdPath, recordsPath}; !reflect.DeepEqual(checkedFiles, expected) {
+		t.Errorf("expected t3c-check-reload to be given the changed files %v, actual: %v", expected, checkedFiles)
+	}
+
+	path := filepath.Join(dir, "service-actions.json")
+	if err := r.WriteServiceActionsJSON(path); err != nil {
+		t.Fatalf("writing service actions JSON: %v", err)
+	}
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading service actions JSON: %v", err)
+	}
+	written := []map[string]string{}
+	if err := json.Unmarshal(bts, &written); err != nil {
+		t.Fatalf("expected valid JSON, actual error: %v", err)
+	}
+	expectedJSON := []map[string]string{
+		{"service": "trafficserver", "action": "reload"},
+		{"service": "ntpd", "action": "restart"},
+		{"service": "sysctl", "action": "none"},
+	}
+	if !reflect.DeepEqual(written, expectedJSON) {
+		t.Errorf("expected the service actions as JSON %v, actual: %s", expectedJSON, bts)
+	}
+
+	for _, path := range []string{recordsPath, ntpdPath} {
+		if body, err := ioutil.ReadFile(path); err != nil {
+			t.Errorf("reading file: %v", err)
+		} else if string(body) != "old" {
+			t.Errorf("expected --report-only not to replace '%s', actual contents: '%s'", path, body)
+		}
+	}
+}
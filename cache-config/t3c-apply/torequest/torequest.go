@@ -20,6 +20,7 @@ package torequest
  */
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -29,13 +30,16 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
 	"github.com/apache/trafficcontrol/cache-config/t3c-apply/util"
 	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
 	"github.com/apache/trafficcontrol/lib/go-log"
+	tcutil "github.com/apache/trafficcontrol/lib/go-util"
 )
 
 type UpdateStatus int
@@ -54,15 +58,45 @@ type Package struct {
 
 type TrafficOpsReq struct {
 	Cfg     config.Cfg
+	ctx     context.Context // kills sub-commands, package actions, and service reloads when done
 	pkgs    map[string]bool // map of packages which are installed, either already installed or newly installed by this run.
 	plugins map[string]bool // map of verified plugins
 
 	installedPkgs map[string]struct{} // map of packages which were installed by us.
+	removedPkgs   map[string]struct{} // map of packages which were removed by us.
 	changedFiles  []string            // list of config files which were changed
 
 	configFiles        map[string]*ConfigFile
 	configFileWarnings map[string][]string
 
+	sendUpdate func(ctx context.Context, cfg config.Cfg, configApplyTime, revalApplyTime *time.Time, configApplyBool, revalApplyBool *bool) error // sends the update to Traffic Ops, replaced by tests
+
+	// packagesInstall installs packages in a single transaction, replaced by tests
+	packagesInstall func(ctx context.Context, names []string) (bool, error)
+
+	enabledServices []string                      // services enabled by CheckSystemServices
+	serviceStatuses map[string]util.ServiceStatus // status of each of the enabledServices, set by VerifyEnabledServices
+
+	// getServiceStatus gets the status of a service, replaced by tests
+	getServiceStatus func(svcManagement config.SvcManagement, name string) (util.ServiceStatus, int, error)
+
+	// diff audits a config file against the one on disk, replaced by tests
+	diff func(cfg config.Cfg, newFile []byte, fileLocation string, reportOnly bool, perm os.FileMode, uid int, gid int) (bool, error)
+
+	// checkReload runs t3c-check-reload to get what trafficserver needs for the changed files, replaced by tests
+	checkReload func(ctx context.Context, changedConfigFiles []string) (t3cutil.ServiceNeeds, error)
+
+	// lookupATSOwner gets the uid and gid of the trafficserver owner, replaced by tests
+	lookupATSOwner func() (int, int, error)
+	atsUid         int // uid of the trafficserver owner the config files are owned by
+	atsGid         int // gid of the trafficserver owner the config files are owned by
+
+	updateStatusMutex       sync.Mutex               // guards updateStatus and updateStatusTransitions, which may be read while the run sets them
+	updateStatus            UpdateStatus             // status of the run, as last set by setUpdateStatus
+	updateStatusTransitions []UpdateStatusTransition // each change of the updateStatus, in order
+
+	serviceActions []ServiceActionResult // actions the services need, set by StartServices with --report-only
+
 	RestartData
 }
 
@@ -102,6 +136,10 @@ type ConfigFile struct {
 	Uid               int         // owner uid, default is 0
 	Gid               int         // owner gid, default is 0
 	Warnings          []string
+
+	// auditState is the state of the file on disk when it was audited, to
+	// detect another process changing it before it's replaced. Nil if unknown.
+	auditState *configFileState
 }
 
 func (u UpdateStatus) String() string {
@@ -180,13 +218,23 @@ func (r *TrafficOpsReq) DumpConfigFiles() {
 }
 
 // NewTrafficOpsReq returns a new TrafficOpsReq object.
-func NewTrafficOpsReq(cfg config.Cfg) *TrafficOpsReq {
+// The sub-commands, package actions, and service starts it runs are killed if ctx is done before they complete.
+func NewTrafficOpsReq(ctx context.Context, cfg config.Cfg) *TrafficOpsReq {
 	return &TrafficOpsReq{
 		Cfg:           cfg,
+		ctx:           ctx,
 		pkgs:          map[string]bool{},
 		plugins:       map[string]bool{},
 		configFiles:   map[string]*ConfigFile{},
 		installedPkgs: map[string]struct{}{},
+		removedPkgs:   map[string]struct{}{},
+		sendUpdate:    sendUpdate,
+
+		packagesInstall:  util.PackagesInstall,
+		getServiceStatus: util.GetServiceStatusByManagement,
+		diff:             diff,
+		checkReload:      checkReload,
+		lookupATSOwner:   lookupATSOwner,
 	}
 }
 
@@ -228,6 +276,7 @@ func (r *TrafficOpsReq) checkConfigFile(cfg *ConfigFile, filesAdding []string) e
 	// perform plugin verification
 	if cfg.Name == "remap.config" || cfg.Name == "plugin.config" {
 		if err := checkRefs(r.Cfg, cfg.Body, filesAdding); err != nil {
+			cfg.PreReqFailed = true
 			r.configFileWarnings[cfg.Name] = append(r.configFileWarnings[cfg.Name], "failed to verify '"+cfg.Name+"': "+err.Error())
 			return errors.New("failed to verify '" + cfg.Name + "': " + err.Error())
 		}
@@ -245,8 +294,20 @@ func (r *TrafficOpsReq) checkConfigFile(cfg *ConfigFile, filesAdding []string) e
 		}
 	}
 
+	// --preserve-file-permissions, --min-file-mode, --max-file-modeに従って、差分の確認と置き換えに使うパーミッションと所有者を決める
+	if err := applyFilePermissionPolicy(cfg, r.Cfg.PreserveFilePermissions, r.Cfg.MinFileMode, r.Cfg.MaxFileMode); err != nil {
+		return errors.New("getting permissions of '" + cfg.Path + "': " + err.Error())
+	}
+
+	// 置き換える直前に他のプロセスによる変更を検出できるように、監査時のファイルの状態を記録する
+	auditState, err := getConfigFileState(cfg.Path)
+	if err != nil {
+		return errors.New("getting the state of '" + cfg.Path + "': " + err.Error())
+	}
+	cfg.auditState = &auditState
+
 	// t3c-diffにファイルを指定することで、その設定ファイルの差分情報をTrafficOps APIから取得する
-	changeNeeded, err := diff(r.Cfg, cfg.Body, cfg.Path, r.Cfg.ReportOnly, cfg.Perm, cfg.Uid, cfg.Gid)
+	changeNeeded, err := r.diff(r.Cfg, cfg.Body, cfg.Path, r.Cfg.ReportOnly, cfg.Perm, cfg.Uid, cfg.Gid)
 
 	if err != nil {
 		return errors.New("getting diff: " + err.Error())
@@ -281,21 +342,21 @@ func (r *TrafficOpsReq) checkStatusFiles(svrStatus string) error {
 	}
 
 	// statusファイルのパス
-	statusFile := filepath.Join(config.StatusDir, svrStatus)  // 「/var/lib/trafficcontrol-cache-config/status/REPORTED」 のようなファイルパスとなる。
+	statusFile := filepath.Join(r.Cfg.StatusDir, svrStatus)  // 「/var/lib/trafficcontrol-cache-config/status/REPORTED」 のようなファイルパスとなる。
 	fileExists, _ := util.FileExists(statusFile)
 	if !fileExists {
 		log.Errorf("status file %s does not exist.\n", statusFile)
 	}
 
 	// t3c-request --get-data=statuses を実行することで、現行のサーバステータスを取得することができる
-	statuses, err := getStatuses(r.Cfg)
+	statuses, err := getStatuses(r.ctx, r.Cfg)
 	if err != nil {
 		return fmt.Errorf("could not retrieves a statuses list from Traffic Ops: %s\n", err)
 	}
 
 	// TODO: rangeで回しているのはいったいなぜか?
 	for f := range statuses {
-		otherStatus := filepath.Join(config.StatusDir, statuses[f])
+		otherStatus := filepath.Join(r.Cfg.StatusDir, statuses[f])
 		// 次回更新予定のステータスと現状のステータスをによる生成したファイルパスを比較して、同一ならば何もしない
 		if otherStatus == statusFile {
 			continue
@@ -315,8 +376,8 @@ func (r *TrafficOpsReq) checkStatusFiles(svrStatus string) error {
 	// --report-only=falseの場合、statusFile用のディレクトリを生成して、statusFileに対してtouchする
 	if !r.Cfg.ReportOnly {
 		// statusを配置するディレクトリ(/var/lib/trafficcontrol-cache-config/status/)を生成しておく
-		if !util.MkDir(config.StatusDir, r.Cfg) {
-			return fmt.Errorf("unable to create '%s'\n", config.StatusDir)
+		if !util.MkDir(r.Cfg.StatusDir, r.Cfg) {
+			return fmt.Errorf("unable to create '%s'\n", r.Cfg.StatusDir)
 		}
 
 		// statusFileが存在していなければtouchしてstatusFileを生成する。
@@ -493,16 +554,95 @@ func (r *TrafficOpsReq) readCfgFile(cfg *ConfigFile, dir string) ([]byte, error)
 
 const configFileTempSuffix = `.tmp`
 
+// applyFilePermissionPolicy sets the mode and ownership cfg is checked against
+// and written with. If preserve and the file exists, its current mode and
+// ownership are kept, rather than those from Traffic Ops. Then the minMode
+// bits are set, and any bits not in a non-zero maxMode are cleared.
+func applyFilePermissionPolicy(cfg *ConfigFile, preserve bool, minMode os.FileMode, maxMode os.FileMode) error {
+	if preserve {
+		fi, err := os.Stat(cfg.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			cfg.Perm = fi.Mode().Perm()
+			if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+				cfg.Uid = int(stat.Uid)
+				cfg.Gid = int(stat.Gid)
+			}
+			log.Debugf("Preserving the mode '%#o' and owner %d:%d of '%s'\n", cfg.Perm, cfg.Uid, cfg.Gid, cfg.Path)
+		}
+	}
+
+	perm := cfg.Perm
+	if maxMode != 0 {
+		perm &= maxMode | ^os.ModePerm
+	}
+	perm |= minMode
+	if perm != cfg.Perm {
+		log.Infof("Changing the mode of '%s' from '%#o' to '%#o', per the minimum '%#o' and maximum '%#o'\n", cfg.Path, cfg.Perm, perm, minMode, maxMode)
+		cfg.Perm = perm
+	}
+	return nil
+}
+
+// resolveConfigFileSymlink returns the path to write the config file at path
+// to. That's path itself, unless it's a symlink, because replacing it would
+// replace the symlink with a regular file. Then, if follow, it's the path of
+// the file the symlink resolves to; otherwise an error is returned.
+func resolveConfigFileSymlink(path string, follow bool) (string, error) {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return path, nil
+	} else if err != nil {
+		return "", errors.New("getting info of '" + path + "': " + err.Error())
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return path, nil
+	}
+	if !follow {
+		return "", errors.New("'" + path + "' is a symlink, and --symlinked-config-files is " + config.SymlinkedConfigFilesRefuse)
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", errors.New("resolving symlink '" + path + "': " + err.Error())
+	}
+	if fi, err := os.Stat(target); err != nil {
+		return "", errors.New("getting info of '" + target + "', which '" + path + "' resolves to: " + err.Error())
+	} else if !fi.Mode().IsRegular() {
+		return "", errors.New("'" + path + "' resolves to '" + target + "', which is not a regular file")
+	}
+	return target, nil
+}
+
 // replaceCfgFile replaces an ATS configuration file with one from Traffic Ops.
 func (r *TrafficOpsReq) replaceCfgFile(cfg *ConfigFile) (*FileRestartData, error) {
-	if r.Cfg.ReportOnly ||
-		(r.Cfg.Files != t3cutil.ApplyFilesFlagAll && r.Cfg.Files != t3cutil.ApplyFilesFlagReval) {
+	// --report-only replaces nothing, but records the file as it would have been changed,
+	// so the service actions needed for the change can be reported.
+	if r.Cfg.ReportOnly {
+		log.Infof("Reporting only: not replacing %s with the version from Traffic Ops.\n", cfg.Name)
+		cfg.ChangeApplied = false
+		r.changedFiles = append(r.changedFiles, cfg.Path)
+		return &FileRestartData{Name: cfg.Name, RestartData: r.configFileRestartData(cfg)}, nil
+	}
+	if r.Cfg.Files != t3cutil.ApplyFilesFlagAll && r.Cfg.Files != t3cutil.ApplyFilesFlagReval {
 		log.Infof("You elected not to replace %s with the version from Traffic Ops.\n", cfg.Name)
 		cfg.ChangeApplied = false
 		return &FileRestartData{Name: cfg.Name}, nil
 	}
 
-	tmpFileName := cfg.Path + configFileTempSuffix
+	// cfg.Pathがシンボリックリンクの場合、リンクを置き換えずにリンク先のファイルを置き換える
+	path, err := resolveConfigFileSymlink(cfg.Path, r.Cfg.SymlinkedConfigFiles == config.SymlinkedConfigFilesFollow)
+	if err != nil {
+		r.configFileWarnings[cfg.Name] = append(r.configFileWarnings[cfg.Name], "not replaced: "+err.Error())
+		return &FileRestartData{Name: cfg.Name}, errors.New("Failed to replace config file '" + cfg.Path + "': " + err.Error())
+	}
+	if path != cfg.Path {
+		log.Infof("Config file '%s' is a symlink, replacing the file it resolves to, '%s'\n", cfg.Path, path)
+	}
+
+	// the temp file is in the same directory as the file it replaces, so the move is atomic
+	tmpFileName := path + configFileTempSuffix
 	log.Infof("Writing temp file '%s' with file mode: '%#o' \n", tmpFileName, cfg.Perm)
 
 	// write a new file, then move to the real location
@@ -514,13 +654,31 @@ func (r *TrafficOpsReq) replaceCfgFile(cfg *ConfigFile) (*FileRestartData, error
 		return &FileRestartData{Name: cfg.Name}, errors.New("Failed to write temp config file '" + tmpFileName + "': " + err.Error())
 	}
 
-	log.Infof("Copying temp file '%s' to real '%s'\n", tmpFileName, cfg.Path)
-	if err := os.Rename(tmpFileName, cfg.Path); err != nil {
-		return &FileRestartData{Name: cfg.Name}, errors.New("Failed to move temp '" + tmpFileName + "' to real '" + cfg.Path + "': " + err.Error())
+	// 監査後に他のプロセスがファイルを変更していれば、--externally-modified-config-filesに従って再監査するか置き換えない
+	if replace, err := r.checkExternallyModified(cfg, path); err != nil || !replace {
+		if rmErr := os.Remove(tmpFileName); rmErr != nil {
+			log.Errorln("removing temp config file '" + tmpFileName + "': " + rmErr.Error())
+		}
+		cfg.ChangeApplied = false
+		if err != nil {
+			return &FileRestartData{Name: cfg.Name}, errors.New("Failed to replace config file '" + cfg.Path + "': " + err.Error())
+		}
+		return &FileRestartData{Name: cfg.Name}, nil
+	}
+
+	log.Infof("Copying temp file '%s' to real '%s'\n", tmpFileName, path)
+	if err := os.Rename(tmpFileName, path); err != nil {
+		return &FileRestartData{Name: cfg.Name}, errors.New("Failed to move temp '" + tmpFileName + "' to real '" + path + "': " + err.Error())
 	}
 	cfg.ChangeApplied = true
 	r.changedFiles = append(r.changedFiles, cfg.Path)
 
+	log.Debugf("Setting change applied for '%s'\n", cfg.Name)
+	return &FileRestartData{Name: cfg.Name, RestartData: r.configFileRestartData(cfg)}, nil
+}
+
+// configFileRestartData returns the reloads and restarts needed for a change to cfg to take effect.
+func (r *TrafficOpsReq) configFileRestartData(cfg *ConfigFile) RestartData {
 	remapConfigReload := cfg.RemapPluginConfig ||
 		cfg.Name == "remap.config" ||
 		strings.HasPrefix(cfg.Name, "bg_fetch") ||
@@ -532,6 +690,7 @@ func (r *TrafficOpsReq) replaceCfgFile(cfg *ConfigFile) (*FileRestartData, error
 		strings.HasSuffix(cfg.Name, ".lua")
 
 	trafficCtlReload := strings.HasSuffix(cfg.Dir, "trafficserver") ||
+		filepath.Clean(cfg.Dir) == filepath.Clean(r.Cfg.TsConfigDir) ||
 		remapConfigReload ||
 		cfg.Name == "ssl_multicert.config" ||
 		cfg.Name == "records.config" ||
@@ -544,17 +703,13 @@ func (r *TrafficOpsReq) replaceCfgFile(cfg *ConfigFile) (*FileRestartData, error
 
 	log.Debugf("Reload state after %s: remap.config: %t reload: %t restart: %t ntpd: %t sysctl: %t", cfg.Name, remapConfigReload, trafficCtlReload, trafficServerRestart, ntpdRestart, sysCtlReload)
 
-	log.Debugf("Setting change applied for '%s'\n", cfg.Name)
-	return &FileRestartData{
-		Name: cfg.Name,
-		RestartData: RestartData{
-			TrafficCtlReload:     trafficCtlReload,
-			SysCtlReload:         sysCtlReload,
-			NtpdRestart:          ntpdRestart,
-			TrafficServerRestart: trafficServerRestart,
-			RemapConfigReload:    remapConfigReload,
-		},
-	}, nil
+	return RestartData{
+		TrafficCtlReload:     trafficCtlReload,
+		SysCtlReload:         sysCtlReload,
+		NtpdRestart:          ntpdRestart,
+		TrafficServerRestart: trafficServerRestart,
+		RemapConfigReload:    remapConfigReload,
+	}
 }
 
 // CheckSystemServices is used to verify that packages installed
@@ -565,7 +720,7 @@ func (r *TrafficOpsReq) CheckSystemServices() error {
 		return nil
 	}
 
-	result, err := getChkconfig(r.Cfg) // t3c-request --get-data=chkconfig
+	result, err := getChkconfig(r.ctx, r.Cfg) // t3c-request --get-data=chkconfig
 	if err != nil {
 		log.Errorln(err)
 		return err
@@ -602,6 +757,7 @@ func (r *TrafficOpsReq) CheckSystemServices() error {
 
 			if rc == 0 {
 				log.Infof("The %s service has been enabled\n", name)
+				r.enabledServices = append(r.enabledServices, name)
 			}
 
 		} else if r.Cfg.SvcManagement == config.SystemV {
@@ -614,6 +770,7 @@ func (r *TrafficOpsReq) CheckSystemServices() error {
 
 			if rc == 0 {
 				log.Infof("The %s service has been enabled\n", name)
+				r.enabledServices = append(r.enabledServices, name)
 			}
 
 		} else {
@@ -624,6 +781,40 @@ func (r *TrafficOpsReq) CheckSystemServices() error {
 	return nil
 }
 
+// VerifyEnabledServices checks that each service enabled by
+// CheckSystemServices is running, per --verify-enabled-services. It must be
+// called after StartServices, so services started by this run aren't reported.
+// Services which aren't running are warned about, and added to the summary of
+// PrintWarnings. With --verify-enabled-services=error, an error is returned if
+// any isn't running.
+func (r *TrafficOpsReq) VerifyEnabledServices() error {
+	if r.Cfg.VerifyEnabledServices != config.VerifyEnabledServicesWarn && r.Cfg.VerifyEnabledServices != config.VerifyEnabledServicesError {
+		return nil
+	}
+
+	r.serviceStatuses = map[string]util.ServiceStatus{}
+	notRunning := []string{}
+	for _, name := range r.enabledServices {
+		status, pid, err := r.getServiceStatus(r.Cfg.SvcManagement, name)
+		if err != nil {
+			log.Warnf("could not verify the enabled %s service %s is running: %s\n", r.Cfg.SvcManagement, name, err.Error())
+		}
+		r.serviceStatuses[name] = status
+		switch status {
+		case util.SvcRunning:
+			log.Infof("The enabled %s service %s is running, pid: %v\n", r.Cfg.SvcManagement, name, pid)
+		case util.SvcNotRunning:
+			log.Warnf("The enabled %s service %s is not running\n", r.Cfg.SvcManagement, name)
+			notRunning = append(notRunning, name)
+		}
+	}
+
+	if len(notRunning) > 0 && r.Cfg.VerifyEnabledServices == config.VerifyEnabledServicesError {
+		return errors.New("enabled services are not running: " + strings.Join(notRunning, ", "))
+	}
+	return nil
+}
+
 // IsPackageInstalled returns true/false if the named rpm package is installed.
 // the prefix before the version is matched.
 func (r *TrafficOpsReq) IsPackageInstalled(name string) bool {
@@ -653,6 +844,22 @@ func (r *TrafficOpsReq) IsPackageInstalled(name string) bool {
 	return false
 }
 
+// ChangedFiles returns the paths of the config files which were changed by this run.
+// With --report-only, they're the files which would have been changed.
+func (r *TrafficOpsReq) ChangedFiles() []string {
+	return r.changedFiles
+}
+
+// InstalledPackageCount returns the number of packages which were installed by this run.
+func (r *TrafficOpsReq) InstalledPackageCount() int {
+	return len(r.installedPkgs)
+}
+
+// RemovedPackageCount returns the number of packages which were removed by this run.
+func (r *TrafficOpsReq) RemovedPackageCount() int {
+	return len(r.removedPkgs)
+}
+
 // GetConfigFile fetchs a 'Configfile' by file name.
 func (r *TrafficOpsReq) GetConfigFile(name string) (*ConfigFile, bool) {
 	cfg, ok := r.configFiles[name]
@@ -663,33 +870,17 @@ func (r *TrafficOpsReq) GetConfigFile(name string) (*ConfigFile, bool) {
 // for a cache from traffic ops and loads them into the configFiles map.
 func (r *TrafficOpsReq) GetConfigFileList() error {
 
-	var atsUid int = 0
-	var atsGid int = 0
-
-	// trafficserverの設定として指定された「ats」オーナーであることのチェック。その後にatsのuidやgidを取得する
-	atsUser, err := user.Lookup(config.TrafficServerOwner)
+	// trafficserverの設定として指定された「ats」オーナーのuidやgidを取得する。ファイルの書き込み前にもProcessConfigFilesで再取得される
+	atsUid, atsGid, err := r.lookupATSOwner()
 	if err != nil {
-		log.Errorf("could not lookup the trafficserver, '%s', owner uid, using uid/gid 0",
-			config.TrafficServerOwner)
-	} else {
-
-		// uidをint型に変換する
-		atsUid, err = strconv.Atoi(atsUser.Uid)
-		if err != nil {
-			log.Errorf("could not parse the ats UID.")
-			atsUid = 0
-		}
-
-		// gidをint型に変換する
-		atsGid, err = strconv.Atoi(atsUser.Gid)
-		if err != nil {
-			log.Errorf("could not parse the ats GID.")
-			atsUid = 0
-		}
+		log.Errorf("could not lookup the trafficserver, '%s', owner uid, using uid/gid 0: %s\n",
+			config.TrafficServerOwner, err.Error())
+		atsUid, atsGid = 0, 0
 	}
+	r.atsUid, r.atsGid = atsUid, atsGid
 
 	// t3c-generateによるTrafficOpsから設定情報を取得しての設定生成処理はここで行われます。
-	allFiles, err := generate(r.Cfg)
+	allFiles, err := generate(r.ctx, r.Cfg)
 	if err != nil {
 		return errors.New("requesting data generating config files: " + err.Error())
 	}
@@ -707,11 +898,17 @@ func (r *TrafficOpsReq) GetConfigFileList() error {
 			mode = 0644
 		}
 
+		// --instanceが指定された場合、デフォルトインスタンスの設定ディレクトリ配下のファイルはインスタンスの設定ディレクトリ配下に置き換える
+		dir, err := r.Cfg.InstanceConfigDir(file.Path)
+		if err != nil {
+			return errors.New("config file '" + file.Name + "': " + err.Error())
+		}
+
 		// ファイル情報をConfigFile構造体に格納する
 		r.configFiles[file.Name] = &ConfigFile{
 			Name:     file.Name,
-			Path:     filepath.Join(file.Path, file.Name),
-			Dir:      file.Path,
+			Path:     filepath.Join(dir, file.Name),
+			Dir:      dir,
 			Body:     []byte(file.Text),
 			Uid:      atsUid,
 			Gid:      atsGid,
@@ -732,9 +929,50 @@ func (r *TrafficOpsReq) GetConfigFileList() error {
 		}
 	}
 
+	r.checkMissingConfigFileRefs()
+
 	return nil
 }
 
+// checkMissingConfigFileRefs warns about plugin config files referenced by remap.config or plugin.config
+// which are neither being written nor already exist on disk.
+// These would otherwise fail t3c-check-refs verification, or cause ATS reload failures.
+func (r *TrafficOpsReq) checkMissingConfigFileRefs() {
+	for _, refFileName := range []string{"remap.config", "plugin.config"} {
+		cfg, ok := r.configFiles[refFileName]
+		if !ok {
+			continue
+		}
+		for _, ref := range missingConfigFileRefs(cfg.Body, r.configFiles, r.Cfg.FilesFilter, r.Cfg.TsConfigDir) {
+			warn := "references plugin config file '" + ref + "' which was not generated and does not exist on disk"
+			log.Warnln(refFileName + ": " + warn)
+			r.configFileWarnings[refFileName] = append(r.configFileWarnings[refFileName], warn)
+		}
+	}
+}
+
+// missingConfigFileRefs returns the plugin config files referenced in body which are not being written
+// (the configFiles matching filesFilter) and don't exist on disk, relative to tsConfigDir if not absolute.
+func missingConfigFileRefs(body []byte, configFiles map[string]*ConfigFile, filesFilter string, tsConfigDir string) []string {
+	missing := []string{}
+	for _, ref := range t3cutil.ConfigFileRefs(string(body)) {
+		// refs may be paths, but generated files are keyed by name, same as t3c-check-refs.
+		name := filepath.Base(ref)
+		if _, ok := configFiles[name]; ok && configFileMatchesFilter(filesFilter, name) {
+			continue
+		}
+		path := ref
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(tsConfigDir, ref)
+		}
+		if exists, _ := util.FileExists(path); exists {
+			continue
+		}
+		missing = append(missing, ref)
+	}
+	return missing
+}
+
 func (r *TrafficOpsReq) PrintWarnings() {
 	log.Infoln("======== Summary of config warnings that may need attention. ========")
 	for file, warning := range r.configFileWarnings {
@@ -742,6 +980,11 @@ func (r *TrafficOpsReq) PrintWarnings() {
 			log.Warnf("%s: %s", file, warning)
 		}
 	}
+	for _, name := range r.enabledServices {
+		if status, ok := r.serviceStatuses[name]; ok && status != util.SvcRunning {
+			log.Warnf("service %s: enabled, but its status is %s", name, status)
+		}
+	}
 	log.Infoln("======== End warning summary ========")
 }
 
@@ -757,11 +1000,17 @@ func (r *TrafficOpsReq) CheckRevalidateState(sleepOverride bool) (UpdateStatus,
 		return updateStatus, nil
 	}
 
+	// --no-status の場合にはTrafficOpsのステータスを参照せずに、常にrevalのファイルを適用する
+	if r.Cfg.NoStatus {
+		log.Infoln("Not checking the revalidate state in Traffic Ops, because of --no-status.")
+		return r.setUpdateStatus(UpdateTropsNeeded, "not checking the revalidate state in Traffic Ops, because of --no-status"), nil
+	}
+
 	updateStatus := UpdateTropsNotNeeded
 
 	// 下記ではt3c-request --get-data=update-status が実行される
 	// see: https://traffic-control-cdn.readthedocs.io/en/latest/api/v4/servers_hostname_update_status.html
-	serverStatus, err := getUpdateStatus(r.Cfg)
+	serverStatus, err := getUpdateStatus(r.ctx, r.Cfg)
 	if err != nil {
 		log.Errorln("getting update status: " + err.Error())
 		return UpdateTropsNotNeeded, errors.New("getting update status: " + err.Error())
@@ -772,17 +1021,21 @@ func (r *TrafficOpsReq) CheckRevalidateState(sleepOverride bool) (UpdateStatus,
 	// APIのjsonレスポンスの戻り値として `use_reval_pending=false` が含まれている場合
 	if serverStatus.UseRevalPending == false {
 		log.Errorln("Update URL: Instant invalidate is not enabled.  Separated revalidation requires upgrading to Traffic Ops version 2.2 and enabling this feature.")
-		return UpdateTropsNotNeeded, nil
+		return r.setUpdateStatus(UpdateTropsNotNeeded, "instant invalidate is not enabled in Traffic Ops"), nil
 	}
 
+	reason := ""
+
 	// APIのjsonレスポンスの戻り値として `reval_pending=true` が含まれている場合
 	if serverStatus.RevalPending == true {
 		log.Errorln("Traffic Ops is signaling that a revalidation is waiting to be applied.")
 		updateStatus = UpdateTropsNeeded
+		reason = "Traffic Ops is signaling that a revalidation is waiting to be applied"
 		if serverStatus.ParentRevalPending == true { // `parent_reval_pending=true`が含まれている場合
 			if r.Cfg.WaitForParents {
 				log.Infoln("Traffic Ops is signaling that my parents need to revalidate, not revalidating.")
 				updateStatus = UpdateTropsNotNeeded
+				reason = "Traffic Ops is signaling that my parents need to revalidate, and waiting for parents"
 			} else {
 				log.Infoln("Traffic Ops is signaling that my parents need to revalidate, but wait-for-parents is false, revalidating anyway.")
 			}
@@ -790,10 +1043,10 @@ func (r *TrafficOpsReq) CheckRevalidateState(sleepOverride bool) (UpdateStatus,
 	} else if serverStatus.RevalPending == false && !r.Cfg.ReportOnly && r.Cfg.Files == t3cutil.ApplyFilesFlagReval {
 		// `reval_pending=false` かつ `--report-only=false` かつ `--files=reval` の場合 には更新しない
 		log.Errorln("In revalidate mode, but no update needs to be applied. I'm outta here.")
-		return UpdateTropsNotNeeded, nil
+		return r.setUpdateStatus(UpdateTropsNotNeeded, "Traffic Ops is signaling that no revalidations are waiting to be applied"), nil
 	} else {
 		log.Errorln("Traffic Ops is signaling that no revalidations are waiting to be applied.")
-		return UpdateTropsNotNeeded, nil
+		return r.setUpdateStatus(UpdateTropsNotNeeded, "Traffic Ops is signaling that no revalidations are waiting to be applied"), nil
 	}
 
 	// /var/lib/trafficcontrol-cache-config/status/に存在するステータスファイル(REPORTED等)のステータスに変更があれば該当ステータスのファイルを作成する。古いステータスファイルは削除する。
@@ -804,6 +1057,7 @@ func (r *TrafficOpsReq) CheckRevalidateState(sleepOverride bool) (UpdateStatus,
 		log.Infoln("CheckRevalidateState checkStatusFiles returned nil error")
 	}
 
+	updateStatus = r.setUpdateStatus(updateStatus, reason)
 	log.Infof("CheckRevalidateState returning %v\n", updateStatus)
 	return updateStatus, nil
 }
@@ -819,10 +1073,16 @@ func (r *TrafficOpsReq) CheckSyncDSState() (UpdateStatus, error) {
 	//	if r.Cfg.RunMode == t3cutil.ModeSyncDS || r.Cfg.RunMode == t3cutil.ModeBadAss || r.Cfg.RunMode == t3cutil.ModeReport
 	if r.Cfg.Files != t3cutil.ApplyFilesFlagReval { // 「--files=revalでない値」が指定された場合(関数呼び出しの手前でもチェックされるが、関数の中でもチェックされる)
 
+		// --no-status の場合にはTrafficOpsのステータスもローカルのステータスファイルも参照せずに、常にファイルを適用する
+		if r.Cfg.NoStatus {
+			log.Infoln("Not checking the update state in Traffic Ops, because of --no-status.")
+			return r.setUpdateStatus(UpdateTropsNeeded, "not checking the update state in Traffic Ops, because of --no-status"), nil
+		}
+
 		// t3c-request --get-data=update-status を実行してサーバのステータス情報を取得します
 		// serverStatusオブジェクトには下記APIのレスポンスが格納されます。
 		//   See: https://traffic-control-cdn.readthedocs.io/en/latest/api/v4/servers_hostname_update_status.html
-		serverStatus, err := getUpdateStatus(r.Cfg)
+		serverStatus, err := getUpdateStatus(r.ctx, r.Cfg)
 		if err != nil {
 			log.Errorln("getting '" + r.Cfg.CacheHostName + "' update status: " + err.Error())
 			return updateStatus, err
@@ -830,7 +1090,7 @@ func (r *TrafficOpsReq) CheckSyncDSState() (UpdateStatus, error) {
 
 		// APIレスポンスの`upd_pending=true`の値によって処理を分岐する。
 		if serverStatus.UpdatePending {
-			updateStatus = UpdateTropsNeeded
+			updateStatus = r.setUpdateStatus(UpdateTropsNeeded, "Traffic Ops is signaling that an update is waiting to be applied")
 			log.Errorln("Traffic Ops is signaling that an update is waiting to be applied")
 
 			// 取得したレスポンスで 「parent_pending=true」 かつ オプションに「--wait-for-parents=true」 が指定されている場合には、parentが更新されたことを待つ
@@ -840,7 +1100,7 @@ func (r *TrafficOpsReq) CheckSyncDSState() (UpdateStatus, error) {
 				// 「--report-only=false」 かつ 「--files=revalでない値」 が指定された場合 (--files=revalのチェックは呼び出し元でチェックしているがここでも実施している)
 				if !r.Cfg.ReportOnly && r.Cfg.Files != t3cutil.ApplyFilesFlagReval {
 					log.Infof("sleeping for %ds to see if the update my parents need is cleared.", randDispSec/time.Second)
-					serverStatus, err = getUpdateStatus(r.Cfg)
+					serverStatus, err = getUpdateStatus(r.ctx, r.Cfg)
 					if err != nil {
 						return updateStatus, err
 					}
@@ -848,7 +1108,7 @@ func (r *TrafficOpsReq) CheckSyncDSState() (UpdateStatus, error) {
 					// APIレスポンスが`parent_pending=true` または `parent_reval_pending=true`の場合には、parent側の処理がまだ完了していないということでまだ処理を実施しない
 					if serverStatus.ParentPending || serverStatus.ParentRevalPending {
 						log.Errorln("My parents still need an update, bailing.")
-						return UpdateTropsNotNeeded, nil
+						return r.setUpdateStatus(UpdateTropsNotNeeded, "my parents still need an update, and waiting for parents"), nil
 					} else {
 						log.Debugln("The update on my parents cleared; continuing.")
 					}
@@ -859,7 +1119,7 @@ func (r *TrafficOpsReq) CheckSyncDSState() (UpdateStatus, error) {
 		} else if !r.Cfg.IgnoreUpdateFlag { // `upd_pending=false` かつ --ignore-update-flag=false が指定された場合
 			log.Errorln("no queued update needs to be applied.  Running revalidation before exiting.")
 			r.RevalidateWhileSleeping()
-			return UpdateTropsNotNeeded, nil
+			return r.setUpdateStatus(UpdateTropsNotNeeded, "no queued update needs to be applied"), nil
 		} else {
 			log.Errorln("Traffic Ops is signaling that no update is waiting to be applied.")
 		}
@@ -875,9 +1135,15 @@ func (r *TrafficOpsReq) CheckSyncDSState() (UpdateStatus, error) {
 }
 
 // CheckReloadRestart determines the final reload/restart state after all config files are processed.
+// Files matching --reload-only-config-files which would require a trafficserver restart only require a reload.
 func (r *TrafficOpsReq) CheckReloadRestart(data []FileRestartData) RestartData {
 	rd := RestartData{}
 	for _, changedFile := range data {
+		if changedFile.TrafficServerRestart && isReloadOnlyConfigFile(r.Cfg.ReloadOnlyConfigFiles, changedFile.Name) {
+			warnReloadOnlyConfigFile(changedFile.Name)
+			changedFile.TrafficServerRestart = false
+			changedFile.TrafficCtlReload = true
+		}
 		rd.TrafficCtlReload = rd.TrafficCtlReload || changedFile.TrafficCtlReload
 		rd.SysCtlReload = rd.SysCtlReload || changedFile.SysCtlReload
 		rd.NtpdRestart = rd.NtpdRestart || changedFile.NtpdRestart
@@ -888,19 +1154,113 @@ func (r *TrafficOpsReq) CheckReloadRestart(data []FileRestartData) RestartData {
 	return rd
 }
 
+// isReloadOnlyConfigFile returns whether the config file name, or the base
+// name of the path, matches any of the --reload-only-config-files patterns.
+func isReloadOnlyConfigFile(patterns []string, name string) bool {
+	name = filepath.Base(name)
+	for _, pattern := range patterns {
+		if match, err := filepath.Match(pattern, name); err == nil && match {
+			return true
+		}
+	}
+	return false
+}
+
+// warnReloadOnlyConfigFile warns that a restart isn't done for a changed
+// config file, because it's one of the --reload-only-config-files.
+func warnReloadOnlyConfigFile(name string) {
+	log.Warnf("%s changed, which requires a trafficserver restart, but it matches --reload-only-config-files, so trafficserver will only be reloaded. The operator is responsible for the change taking effect on reload.\n", name)
+}
+
+// splitReloadOnlyChangedFiles returns the changed files which don't match the
+// --reload-only-config-files patterns, and those which do.
+func (r *TrafficOpsReq) splitReloadOnlyChangedFiles() ([]string, []string) {
+	if len(r.Cfg.ReloadOnlyConfigFiles) == 0 {
+		return r.changedFiles, nil
+	}
+	others := []string{}
+	reloadOnly := []string{}
+	for _, path := range r.changedFiles {
+		if isReloadOnlyConfigFile(r.Cfg.ReloadOnlyConfigFiles, path) {
+			reloadOnly = append(reloadOnly, path)
+		} else {
+			others = append(others, path)
+		}
+	}
+	return others, reloadOnly
+}
+
+// configFileMatchesFilter returns whether the config file name matches the --files-filter glob.
+// An empty filter matches all files.
+func configFileMatchesFilter(filter string, name string) bool {
+	if filter == "" {
+		return true
+	}
+	match, err := filepath.Match(filter, name)
+	if err != nil {
+		log.Errorf("matching config file '%s' against files filter '%s': %s\n", name, filter, err.Error())
+		return false
+	}
+	return match
+}
+
+// filterConfigFiles returns the config files matching the --files-filter, which are the only files to be replaced.
+func (r *TrafficOpsReq) filterConfigFiles() map[string]*ConfigFile {
+	if r.Cfg.FilesFilter == "" {
+		return r.configFiles
+	}
+	filtered := map[string]*ConfigFile{}
+	for name, cfg := range r.configFiles {
+		if !configFileMatchesFilter(r.Cfg.FilesFilter, name) {
+			log.Debugf("config file '%s' does not match files filter '%s', skipping\n", name, r.Cfg.FilesFilter)
+			continue
+		}
+		filtered[name] = cfg
+	}
+	log.Infof("files filter '%s' matched %d of %d config files\n", r.Cfg.FilesFilter, len(filtered), len(r.configFiles))
+	return filtered
+}
+
+// auditConfigFiles returns the config files which must be audited in order to process processFiles.
+// This is processFiles, plus remap.config and plugin.config if either of them is being processed,
+// because each depends on the other's verification before it may be replaced.
+func auditConfigFiles(allFiles map[string]*ConfigFile, processFiles map[string]*ConfigFile) map[string]*ConfigFile {
+	_, remapOk := processFiles["remap.config"]
+	_, pluginOk := processFiles["plugin.config"]
+	if !remapOk && !pluginOk {
+		return processFiles
+	}
+	audit := map[string]*ConfigFile{}
+	for name, cfg := range processFiles {
+		audit[name] = cfg
+	}
+	for _, name := range []string{"remap.config", "plugin.config"} {
+		if cfg, ok := allFiles[name]; ok {
+			audit[name] = cfg
+		}
+	}
+	return audit
+}
+
 // ProcessConfigFiles processes all config files retrieved from Traffic Ops.
+// If a --files-filter is set, only matching files are replaced.
 func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 	var updateStatus UpdateStatus = UpdateTropsNotNeeded
+	failedReason := ""
 
 	log.Infoln(" ======== Start processing config files ========")
 
+	// 設定ファイル生成後にtrafficserverがインストールされてuid/gidが変わっていても、正しいオーナーで監査・書き込みできるように再取得する
+	r.refreshATSOwner()
+
+	processFiles := r.filterConfigFiles()
 	filesAdding := []string{} // list of file names being added, needed for verification.
-	for fileName, _ := range r.configFiles {
+	for fileName, _ := range processFiles {
 		filesAdding = append(filesAdding, fileName)
 	}
 
 	// r.configFilesはmainのtrops.GetConfigFileList()にてオブジェクト内容が登録される。TrafficOpsから取得・生成したファイルパス情報が含まれている
-	for _, cfg := range r.configFiles {
+	for _, cfg := range auditConfigFiles(r.configFiles, processFiles) {
 		// add service metadata
 		// ファイルパスに含まれる情報からどのサービスかを判断してcfg.Serviceに値を設定する。trafficserver, puppet, system ntpd, unknownがある。 ログへの出力にしか使われてなさそう。
 		if strings.Contains(cfg.Path, "/opt/trafficserver/") || strings.Contains(cfg.Dir, "udev") {
@@ -929,7 +1289,7 @@ func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 	changesRequired := 0
 	shouldRestartReload := ShouldReloadRestart{[]FileRestartData{}}
 
-	for _, cfg := range r.configFiles {
+	for _, cfg := range processFiles {
 		if cfg.ChangeNeeded &&
 			!cfg.ChangeApplied &&
 			cfg.AuditComplete &&
@@ -939,10 +1299,12 @@ func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 			changesRequired++
 			if cfg.Name == "plugin.config" && r.configFiles["remap.config"].PreReqFailed == true {
 				updateStatus = UpdateTropsFailed
+				failedReason = "plugin.config changed, but prereqs failed for remap.config"
 				log.Errorln("plugin.config changed however, prereqs failed for remap.config so I am skipping updates for plugin.config")
 				continue
 			} else if cfg.Name == "remap.config" && r.configFiles["plugin.config"].PreReqFailed == true {
 				updateStatus = UpdateTropsFailed
+				failedReason = "remap.config changed, but prereqs failed for plugin.config"
 				log.Errorln("remap.config changed however, prereqs failed for plugin.config so I am skipping updates for remap.config")
 				continue
 			} else if cfg.Name == "ip_allow.config" && !r.Cfg.UpdateIPAllow {
@@ -965,11 +1327,13 @@ func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 		log.Infof("Final state: remap.config: %t reload: %t restart: %t ntpd: %t sysctl: %t", r.RemapConfigReload, r.TrafficCtlReload, r.TrafficServerRestart, r.NtpdRestart, r.SysCtlReload)
 	}
 
-	if updateStatus != UpdateTropsFailed && changesRequired > 0 {
-		return UpdateTropsNeeded, nil
+	if updateStatus == UpdateTropsFailed {
+		return r.setUpdateStatus(UpdateTropsFailed, failedReason), nil
+	} else if changesRequired > 0 {
+		return r.setUpdateStatus(UpdateTropsNeeded, strconv.Itoa(changesRequired)+" config files need to be changed"), nil
 	}
 
-	return updateStatus, nil
+	return r.setUpdateStatus(updateStatus, "no config files need to be changed"), nil
 }
 
 // ProcessPackages retrieves a list of required RPM's from Traffic Ops
@@ -979,7 +1343,7 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 
 	// get the package list for this cache from Traffic Ops. 
 	// t3c-request --get-data=packagesの実行してTrafficOpsからこのサーバで取得するパッケージリストを取得する
-	pkgs, err := getPackages(r.Cfg)
+	pkgs, err := getPackages(r.ctx, r.Cfg)
 	if err != nil {
 		return errors.New("getting packages: " + err.Error())
 	}
@@ -987,6 +1351,7 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 
 	var install []string   // install package list.
 	var uninstall []string // uninstall package list
+
 	// loop through the package list to build an install and uninstall list.
 	// t3c-request --get-data=packagesのレスポンスで取得したpkgsに対してrangeでイテレーションする
 	for ii := range pkgs {
@@ -1110,7 +1475,7 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 		// インストール数が1件以上でも存在する場合
 		if len(install) > 0 {
 			for ii := range install {
-				result, err := util.PackageAction("info", install[ii])    // 指定されたパッケージのyum infoを実施し、失敗したらエラーにする
+				result, err := util.PackageAction(r.ctx, "info", install[ii])    // 指定されたパッケージのyum infoを実施し、失敗したらエラーにする
 				if err != nil || result != true {
 					return errors.New("Package " + install[ii] + " is not available to install: " + err.Error())
 				}
@@ -1121,28 +1486,20 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 			if len(install) > 0 && r.Cfg.InstallPackages {                // --install-packages=trueの場合
 				for jj := range uninstall {
 					log.Infof("Uninstalling %s\n", uninstall[jj])
-					r, err := util.PackageAction("remove", uninstall[jj]) // 指定されたパッケージのyum removeを実施する
+					result, err := util.PackageAction(r.ctx, "remove", uninstall[jj]) // 指定されたパッケージのyum removeを実施する
 					if err != nil {
 						// パッケージのuninstallに失敗した場合
 						return errors.New("Unable to uninstall " + uninstall[jj] + " : " + err.Error())
-					} else if r == true {
+					} else if result == true {
 						// パッケージのuninstallに成功した場合
+						r.removedPkgs[uninstall[jj]] = struct{}{}
 						log.Infof("Package %s was uninstalled\n", uninstall[jj])
 					}
 				}
 
 				// install the required packages
-				for jj := range install {
-					pkg := install[jj]
-					log.Infof("Installing %s\n", pkg)
-					result, err := util.PackageAction("install", pkg)  // 指定されたパッケージのyum installを実施する
-					if err != nil {
-						return errors.New("Unable to install " + pkg + " : " + err.Error())
-					} else if result == true {
-						r.pkgs[pkg] = true
-						r.installedPkgs[pkg] = struct{}{}
-						log.Infof("Package %s was installed\n", pkg)
-					}
+				if err := r.installPackages(install); err != nil {
+					return err
 				}
 			}
 		}
@@ -1158,6 +1515,24 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 	return nil
 }
 
+// installPackages installs the given packages in a single yum transaction,
+// so yum orders them by their dependencies and either installs all of them or none.
+func (r *TrafficOpsReq) installPackages(install []string) error {
+	log.Infof("Installing %s\n", strings.Join(install, " "))
+	result, err := r.packagesInstall(r.ctx, install) // 指定されたパッケージをまとめてyum installする
+	if err != nil {
+		return errors.New("Unable to install " + strings.Join(install, ", ") + " : " + err.Error())
+	} else if result != true {
+		return errors.New("Unable to install " + strings.Join(install, ", "))
+	}
+	for _, pkg := range install {
+		r.pkgs[pkg] = true
+		r.installedPkgs[pkg] = struct{}{}
+		log.Infof("Package %s was installed\n", pkg)
+	}
+	return nil
+}
+
 func (r *TrafficOpsReq) RevalidateWhileSleeping() (UpdateStatus, error) {
 
 	updateStatus, err := r.CheckRevalidateState(true)
@@ -1207,10 +1582,22 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 		serviceNeeds = t3cutil.ServiceNeedsRestart
 	} else {
 		// --service-action=restart以外の場合にはt3c-check-reloadを実行して、次回の状態をどうするか決める(何もしない、再起動、再読込、不正の4種類)
+		// --reload-only-config-files に一致するファイルは再起動の判定から除外し、再読込だけを行う
+		changedFiles, reloadOnlyFiles := r.splitReloadOnlyChangedFiles()
 		err := error(nil)
-		if serviceNeeds, err = checkReload(r.changedFiles); err != nil {
+		if serviceNeeds, err = r.checkReload(r.ctx, changedFiles); err != nil {
 			return errors.New("determining if service needs restarted - not reloading or restarting! : " + err.Error())
 		}
+		if len(reloadOnlyFiles) > 0 && serviceNeeds != t3cutil.ServiceNeedsRestart {
+			if reloadOnlyNeeds, err := r.checkReload(r.ctx, reloadOnlyFiles); err != nil {
+				return errors.New("determining if service needs restarted - not reloading or restarting! : " + err.Error())
+			} else if reloadOnlyNeeds == t3cutil.ServiceNeedsRestart {
+				log.Warnf("trafficserver would be restarted for changes to %s, but they match --reload-only-config-files, so it will only be reloaded\n", strings.Join(reloadOnlyFiles, ", "))
+				serviceNeeds = t3cutil.ServiceNeedsReload
+			} else if reloadOnlyNeeds == t3cutil.ServiceNeedsReload {
+				serviceNeeds = t3cutil.ServiceNeedsReload
+			}
+		}
 	}
 
 	log.Infof("t3c-check-reload returned '%+v'\n", serviceNeeds)
@@ -1232,22 +1619,26 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 		return errors.New("trafficserver needs " + serviceNeeds.String() + " but is not installed.")
 	}
 
-	// 「/usr/sbin/service trafficserver status」を実行してActiveが帰ってきているかによって、サービス状態を判定する。
-	svcStatus, _, err := util.GetServiceStatus("trafficserver")
-	if err != nil {
-		return errors.New("getting trafficserver service status: " + err.Error())
-	}
-
 	if r.Cfg.ReportOnly {  // --report-only=trueが指定された場合
 
+		// 外部から再起動・再読込を実行できるように、各サービスに必要な操作を記録しておく
+		r.setReportOnlyServiceActions(serviceNeeds)
+
 		if serviceNeeds == t3cutil.ServiceNeedsRestart {
 			log.Errorln("ATS configuration has changed.  The new config will be picked up the next time ATS is started.")
 		} else if serviceNeeds == t3cutil.ServiceNeedsReload {
 			log.Errorln("ATS configuration has changed. 'traffic_ctl config reload' needs to be run")
 		}
 		return nil
+	}
 
-	} else if r.Cfg.ServiceAction == t3cutil.ApplyServiceActionFlagRestart { // --service-action=restart が指定されている場合
+	// 「/usr/sbin/service trafficserver status」を実行してActiveが帰ってきているかによって、サービス状態を判定する。
+	svcStatus, _, err := util.GetServiceStatus(r.Cfg.ServiceName)
+	if err != nil {
+		return errors.New("getting " + r.Cfg.ServiceName + " service status: " + err.Error())
+	}
+
+	if r.Cfg.ServiceAction == t3cutil.ApplyServiceActionFlagRestart { // --service-action=restart が指定されている場合
 
 		// デフォルトは「restart」
 		startStr := "restart"
@@ -1258,14 +1649,14 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 		}
 
 		// ここでtrafficserverサービスのstartやrestartが行われる
-		if _, err := util.ServiceStart("trafficserver", startStr); err != nil {
-			return errors.New("failed to restart trafficserver")
+		if _, err := util.ServiceStart(r.ctx, r.Cfg.ServiceName, startStr); err != nil {
+			return errors.New("failed to restart " + r.Cfg.ServiceName)
 		}
-		log.Infoln("trafficserver has been " + startStr + "ed")
+		log.Infoln(r.Cfg.ServiceName + " has been " + startStr + "ed")
 
 		// syncdsUpdate中の「UpdateTropsNeeded」の値は「UpdateTropsSuccessful」に変更する
 		if *syncdsUpdate == UpdateTropsNeeded {
-			*syncdsUpdate = UpdateTropsSuccessful
+			*syncdsUpdate = r.setUpdateStatus(UpdateTropsSuccessful, r.Cfg.ServiceName+" has been "+startStr+"ed")
 		}
 
 		return nil // we restarted, so no need to reload
@@ -1278,7 +1669,7 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 
 			// syncdsUpdate中の「UpdateTropsNeeded」の値は「UpdateTropsSuccessful」に変更する
 			if *syncdsUpdate == UpdateTropsNeeded {
-				*syncdsUpdate = UpdateTropsSuccessful
+				*syncdsUpdate = r.setUpdateStatus(UpdateTropsSuccessful, "ATS configuration has changed, and will be picked up the next time ATS is started")
 			}
 			log.Errorln("ATS configuration has changed.  The new config will be picked up the next time ATS is started.")
 
@@ -1287,10 +1678,10 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 			log.Infoln("ATS configuration has changed, Running 'traffic_ctl config reload' now.")
 
 			// 「traffic_ctl config reload」が実行される
-			if _, _, err := util.ExecCommand(config.TSHome+config.TrafficCtl, "config", "reload"); err != nil {
+			if err := r.reloadTrafficServer(); err != nil {
 
 				if *syncdsUpdate == UpdateTropsNeeded {
-					*syncdsUpdate = UpdateTropsFailed
+					*syncdsUpdate = r.setUpdateStatus(UpdateTropsFailed, "'traffic_ctl config reload' failed")
 				}
 
 				return errors.New("ATS configuration has changed and 'traffic_ctl config reload' failed, check ATS logs: " + err.Error())
@@ -1298,7 +1689,7 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 
 			// syncdsUpdate中の「UpdateTropsNeeded」の値は「UpdateTropsSuccessful」に変更する
 			if *syncdsUpdate == UpdateTropsNeeded {
-				*syncdsUpdate = UpdateTropsSuccessful
+				*syncdsUpdate = r.setUpdateStatus(UpdateTropsSuccessful, "'traffic_ctl config reload' was successful")
 			}
 
 			log.Infoln("ATS 'traffic_ctl config reload' was successful")
@@ -1306,7 +1697,7 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 
 		// syncdsUpdate中の「UpdateTropsNeeded」の値は「UpdateTropsSuccessful」に変更する
 		if *syncdsUpdate == UpdateTropsNeeded {
-			*syncdsUpdate = UpdateTropsSuccessful
+			*syncdsUpdate = r.setUpdateStatus(UpdateTropsSuccessful, "ATS needed no reload")
 		}
 
 		return nil
@@ -1315,13 +1706,79 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 	return nil
 }
 
+// reloadTrafficServer reloads the ATS config.
+// The default instance is reloaded with 'traffic_ctl config reload'. Named instances
+// are reloaded via their service, because traffic_ctl only talks to the default instance
+// unless given the instance's runroot.
+func (r *TrafficOpsReq) reloadTrafficServer() error {
+	if r.Cfg.Instance == "" {
+		_, _, err := util.ExecCommandContext(r.ctx, config.TSHome+config.TrafficCtl, "config", "reload")
+		return err
+	}
+	_, err := util.ServiceStart(r.ctx, r.Cfg.ServiceName, "reload")
+	return err
+}
+
+// ErrTrafficOpsUpdateFailed is returned by UpdateTrafficOps when every attempt
+// to clear the update or revalidate pending flag of the server in Traffic Ops
+// failed, so Traffic Ops still reports that an update is pending.
+var ErrTrafficOpsUpdateFailed = errors.New("Traffic Ops update failed, the update pending flag was not cleared")
+
+// The bounds of the wait between attempts to update Traffic Ops.
+var (
+	sendUpdateMinBackoff = time.Second
+	sendUpdateMaxBackoff = 30 * time.Second
+)
+
+// sendUpdateWithRetry sends the update to Traffic Ops, retrying with backoff
+// up to the configured number of retries if it fails, e.g. because Traffic Ops
+// was briefly unavailable. If every attempt fails, the returned error wraps
+// ErrTrafficOpsUpdateFailed.
+func (r *TrafficOpsReq) sendUpdateWithRetry(configApplyTime, revalApplyTime *time.Time, configApplyBool, revalApplyBool *bool) error {
+	backoff, err := tcutil.NewBackoff(sendUpdateMinBackoff, sendUpdateMaxBackoff, tcutil.DefaultFactor)
+	if err != nil {
+		return fmt.Errorf("%w: creating backoff: %v", ErrTrafficOpsUpdateFailed, err)
+	}
+	retries := r.Cfg.Retries
+	if retries < 0 {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		err = r.sendUpdate(r.ctx, r.Cfg, configApplyTime, revalApplyTime, configApplyBool, revalApplyBool)
+		if err == nil {
+			return nil
+		}
+		if attempt >= retries {
+			return fmt.Errorf("%w after %d attempts: %v", ErrTrafficOpsUpdateFailed, attempt+1, err)
+		}
+		wait := backoff.BackoffDuration()
+		log.Warnf("updating Traffic Ops failed, retrying in %v: %v\n", wait, err)
+		select {
+		case <-time.After(wait):
+		case <-r.ctx.Done():
+			return fmt.Errorf("%w after %d attempts: %v", ErrTrafficOpsUpdateFailed, attempt+1, r.ctx.Err())
+		}
+	}
+}
+
 // 関数の引数で更新後のステータスを受け取り、「t3c-request --get-data=update-status」の結果を再取得して取得ステータスと実際の処理で乖離していたらログを出す。
 // その後、t3c applyにより設定が更新された場合にはsendUpdate()によってt3c-updateが実行され、TrafficOps APIへのステータスの更新リクエストされます。
 func (r *TrafficOpsReq) UpdateTrafficOps(syncdsUpdate *UpdateStatus) error {
 	var performUpdate bool
 
+	if r.Cfg.NoStatus {
+		log.Infoln("Not updating Traffic Ops, because of --no-status.")
+		return nil
+	}
+
+	// 一部のファイルしか適用していないので、フラグを解除すると残りのファイルが適用されなくなる
+	if r.Cfg.FilesFilter != "" {
+		log.Infoln("Not updating Traffic Ops, because not every config file was applied with --files-filter.")
+		return nil
+	}
+
 	// t3c-request --get-data=update-statusを実行して更新後のステータスを取得する
-	serverStatus, err := getUpdateStatus(r.Cfg)
+	serverStatus, err := getUpdateStatus(r.ctx, r.Cfg)
 	if err != nil {
 		return errors.New("failed to update Traffic Ops: " + err.Error())
 	}
@@ -1354,20 +1811,57 @@ func (r *TrafficOpsReq) UpdateTrafficOps(syncdsUpdate *UpdateStatus) error {
 		return nil
 	}
 
-	// TODO: The boolean flags/representation can be removed after ATC (v7.0+)
 	// sendUpdate()の中でTrafficOpsに対してserverStatusの更新処理を行う(実際にはt3c-updateが実行される)
 	if !r.Cfg.ReportOnly && !r.Cfg.NoUnsetUpdateFlag {  // --report-only=false かつ --no-unset-update-flag=false
-		if r.Cfg.Files == t3cutil.ApplyFilesFlagAll { // --files=all
-			b := false
-			err = sendUpdate(r.Cfg, serverStatus.ConfigUpdateTime, nil, &b, nil)
-		} else if r.Cfg.Files == t3cutil.ApplyFilesFlagReval { // --files=reval
-			b := false
-			err = sendUpdate(r.Cfg, nil, serverStatus.RevalidateUpdateTime, nil, &b)
-		}
-		if err != nil {
-			return errors.New("Traffic Ops Update failed: " + err.Error())
+		if err := r.unsetPendingFlag(serverStatus); err != nil {
+			return err
 		}
 		log.Infoln("Traffic Ops has been updated.")
 	}
 	return nil
 }
+
+// ClearUpdateFlag clears the update, or with --files=reval the revalidate,
+// pending flag of the server in Traffic Ops if it's set, for
+// --clear-update-flag-only. Unlike UpdateTrafficOps, it doesn't depend on the
+// result of applying files, because none are applied.
+func (r *TrafficOpsReq) ClearUpdateFlag() error {
+	serverStatus, err := getUpdateStatus(r.ctx, r.Cfg)
+	if err != nil {
+		return errors.New("failed to get the update status from Traffic Ops: " + err.Error())
+	}
+	return r.clearUpdateFlag(serverStatus)
+}
+
+// clearUpdateFlag clears the pending flag of --files in Traffic Ops, if it's set in serverStatus.
+func (r *TrafficOpsReq) clearUpdateFlag(serverStatus *atscfg.ServerUpdateStatus) error {
+	flag, pending := "update", serverStatus.UpdatePending
+	if r.Cfg.Files == t3cutil.ApplyFilesFlagReval {
+		flag, pending = "revalidate", serverStatus.RevalPending
+	}
+	if !pending {
+		log.Infoln("The " + flag + " pending flag is not set in Traffic Ops, nothing to clear.")
+		return nil
+	}
+	if r.Cfg.ReportOnly || r.Cfg.NoUnsetUpdateFlag {
+		log.Infoln("The " + flag + " pending flag is set in Traffic Ops, but not clearing it because of --report-only or --no-unset-update-flag.")
+		return nil
+	}
+	log.Infoln("Clearing the " + flag + " pending flag in Traffic Ops.")
+	if err := r.unsetPendingFlag(serverStatus); err != nil {
+		return err
+	}
+	log.Infoln("Traffic Ops has been updated.")
+	return nil
+}
+
+// unsetPendingFlag unsets the update, or with --files=reval the revalidate,
+// pending flag in Traffic Ops, as of the apply time of serverStatus.
+// TODO: The boolean flags/representation can be removed after ATC (v7.0+)
+func (r *TrafficOpsReq) unsetPendingFlag(serverStatus *atscfg.ServerUpdateStatus) error {
+	b := false
+	if r.Cfg.Files == t3cutil.ApplyFilesFlagReval { // --files=reval
+		return r.sendUpdateWithRetry(nil, serverStatus.RevalidateUpdateTime, nil, &b)
+	}
+	return r.sendUpdateWithRetry(serverStatus.ConfigUpdateTime, nil, &b, nil) // --files=all
+}
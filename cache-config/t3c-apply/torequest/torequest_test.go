@@ -20,10 +20,19 @@ package torequest
  */
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/util"
 	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
 )
 
 var testCfg config.Cfg = config.Cfg{
@@ -85,7 +94,7 @@ func TestUnencodeFilter(t *testing.T) {
 }
 
 func TestIsPackageInstalled(t *testing.T) {
-	trops := NewTrafficOpsReq(testCfg)
+	trops := NewTrafficOpsReq(context.Background(), testCfg)
 	trops.pkgs["trafficserver"] = true
 
 	if trops.IsPackageInstalled("mouse") {
@@ -103,7 +112,7 @@ func TestIsPackageInstalled(t *testing.T) {
 }
 
 func TestGetConfigFile(t *testing.T) {
-	trops := NewTrafficOpsReq(testCfg)
+	trops := NewTrafficOpsReq(context.Background(), testCfg)
 
 	cfgFile := ConfigFile{
 		Name:              "remap.config",
@@ -138,3 +147,455 @@ func TestGetConfigFile(t *testing.T) {
 		t.Errorf("GetConfigFile('remap.config') failed, expected 'remap.config' got '" + cfg.Name + "'.")
 	}
 }
+
+func TestConfigFileMatchesFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		name     string
+		expected bool
+	}{
+		{"", "remap.config", true},
+		{"hdr_rw_*", "hdr_rw_foo.config", true},
+		{"hdr_rw_*", "remap.config", false},
+		{"*.cer", "foo.example.net_cert.cer", true},
+		{"[", "remap.config", false},
+	}
+	for _, test := range tests {
+		if actual := configFileMatchesFilter(test.filter, test.name); actual != test.expected {
+			t.Errorf("configFileMatchesFilter('%s', '%s') expected %v actual %v", test.filter, test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestFilterConfigFiles(t *testing.T) {
+	cfg := testCfg
+	cfg.FilesFilter = "plugin.config"
+	trops := NewTrafficOpsReq(context.Background(), cfg)
+	for _, name := range []string{"remap.config", "plugin.config", "hdr_rw_foo.config"} {
+		trops.configFiles[name] = &ConfigFile{Name: name}
+	}
+
+	processFiles := trops.filterConfigFiles()
+	if len(processFiles) != 1 || processFiles["plugin.config"] == nil {
+		t.Fatalf("filterConfigFiles() expected only plugin.config, actual %+v", processFiles)
+	}
+
+	auditFiles := auditConfigFiles(trops.configFiles, processFiles)
+	if len(auditFiles) != 2 || auditFiles["plugin.config"] == nil || auditFiles["remap.config"] == nil {
+		t.Errorf("auditConfigFiles() expected plugin.config and remap.config, actual %+v", auditFiles)
+	}
+
+	trops.Cfg.FilesFilter = "hdr_rw_*"
+	processFiles = trops.filterConfigFiles()
+	if auditFiles = auditConfigFiles(trops.configFiles, processFiles); len(auditFiles) != 1 || auditFiles["hdr_rw_foo.config"] == nil {
+		t.Errorf("auditConfigFiles() expected only hdr_rw_foo.config, actual %+v", auditFiles)
+	}
+}
+
+func TestMissingConfigFileRefs(t *testing.T) {
+	tsConfigDir, err := ioutil.TempDir("", "t3c-apply-refs")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tsConfigDir)
+	if err := ioutil.WriteFile(filepath.Join(tsConfigDir, "on_disk.config"), []byte("foo"), 0644); err != nil {
+		t.Fatalf("writing temp file: %v", err)
+	}
+
+	remap := `# @pparam=commented_out.config
+map http://a.example.net http://origin.example.net @plugin=header_rewrite.so @pparam=hdr_rw_a.config
+map http://b.example.net http://origin.example.net @plugin=regex_remap.so @pparam=regex_remap_b.config \
+	@plugin=header_rewrite.so @pparam=on_disk.config
+map http://c.example.net http://origin.example.net @plugin=cachekey.so @pparam=--static-prefix=c.example.net
+`
+	configFiles := map[string]*ConfigFile{
+		"remap.config":    {Name: "remap.config"},
+		"hdr_rw_a.config": {Name: "hdr_rw_a.config"},
+	}
+
+	missing := missingConfigFileRefs([]byte(remap), configFiles, "", tsConfigDir)
+	if len(missing) != 1 || missing[0] != "regex_remap_b.config" {
+		t.Errorf("missingConfigFileRefs() expected [regex_remap_b.config], actual %v", missing)
+	}
+
+	missing = missingConfigFileRefs([]byte(remap), configFiles, "remap.config", tsConfigDir)
+	if len(missing) != 2 {
+		t.Errorf("missingConfigFileRefs() with filter excluding hdr_rw_a.config expected 2 missing, actual %v", missing)
+	}
+
+	plugin := "header_rewrite.so " + filepath.Join(tsConfigDir, "on_disk.config") + "\nbackground_fetch.so --config bg_fetch.config\n"
+	missing = missingConfigFileRefs([]byte(plugin), configFiles, "", tsConfigDir)
+	if len(missing) != 1 || missing[0] != "bg_fetch.config" {
+		t.Errorf("missingConfigFileRefs() expected [bg_fetch.config], actual %v", missing)
+	}
+}
+
+func TestSendUpdateWithRetry(t *testing.T) {
+	defer func(min, max time.Duration) { sendUpdateMinBackoff, sendUpdateMaxBackoff = min, max }(sendUpdateMinBackoff, sendUpdateMaxBackoff)
+	sendUpdateMinBackoff, sendUpdateMaxBackoff = time.Millisecond, 2*time.Millisecond
+
+	r := NewTrafficOpsReq(context.Background(), testCfg)
+	calls := 0
+	failures := 0
+	r.sendUpdate = func(ctx context.Context, cfg config.Cfg, configApplyTime, revalApplyTime *time.Time, configApplyBool, revalApplyBool *bool) error {
+		calls++
+		if calls <= failures {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	b := false
+
+	// a transient failure is retried.
+	failures = 2
+	if err := r.sendUpdateWithRetry(nil, nil, nil, &b); err != nil {
+		t.Errorf("expected the update to succeed after retrying, actual: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, actual: %d", calls)
+	}
+
+	// a persistent failure is retried the configured number of times, then fails distinctly.
+	calls, failures = 0, 100
+	err := r.sendUpdateWithRetry(nil, nil, nil, &b)
+	if !errors.Is(err, ErrTrafficOpsUpdateFailed) {
+		t.Errorf("expected ErrTrafficOpsUpdateFailed, actual: %v", err)
+	}
+	if expected := testCfg.Retries + 1; calls != expected {
+		t.Errorf("expected %d attempts, actual: %d", expected, calls)
+	}
+
+	// a done context stops retrying.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.ctx = ctx
+	calls = 0
+	if err := r.sendUpdateWithRetry(nil, nil, nil, &b); !errors.Is(err, ErrTrafficOpsUpdateFailed) {
+		t.Errorf("expected ErrTrafficOpsUpdateFailed when the context is done, actual: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected no retries after the context is done, actual attempts: %d", calls)
+	}
+}
+
+func TestNoStatus(t *testing.T) {
+	sendUpdate := func(ctx context.Context, cfg config.Cfg, configApplyTime, revalApplyTime *time.Time, configApplyBool, revalApplyBool *bool) error {
+		t.Error("expected no update to be sent to Traffic Ops with --no-status")
+		return nil
+	}
+
+	for _, files := range []t3cutil.ApplyFilesFlag{t3cutil.ApplyFilesFlagAll, t3cutil.ApplyFilesFlagReval} {
+		cfg := testCfg
+		cfg.Files = files
+		cfg.NoStatus = true
+		cfg.StatusDir = filepath.Join(t.TempDir(), "status")
+		r := NewTrafficOpsReq(context.Background(), cfg)
+		r.sendUpdate = sendUpdate
+
+		var status UpdateStatus
+		var err error
+		if files == t3cutil.ApplyFilesFlagReval {
+			status, err = r.CheckRevalidateState(false)
+		} else {
+			status, err = r.CheckSyncDSState()
+		}
+		if err != nil {
+			t.Fatalf("files %s: expected the state to be checked without Traffic Ops, actual error: %v", files, err)
+		}
+		if status != UpdateTropsNeeded {
+			t.Errorf("files %s: expected %s, actual: %s", files, UpdateTropsNeeded, status)
+		}
+		if _, err := os.Stat(cfg.StatusDir); !os.IsNotExist(err) {
+			t.Errorf("files %s: expected no status files to be written, actual: %v", files, err)
+		}
+
+		status = UpdateTropsSuccessful
+		if err := r.UpdateTrafficOps(&status); err != nil {
+			t.Errorf("files %s: expected Traffic Ops to not be updated, actual error: %v", files, err)
+		}
+	}
+}
+
+func TestUpdateTrafficOpsFilesFilter(t *testing.T) {
+	cfg := testCfg
+	cfg.Files = t3cutil.ApplyFilesFlagAll
+	cfg.FilesFilter = "hdr_rw_*"
+	r := NewTrafficOpsReq(context.Background(), cfg)
+	r.sendUpdate = func(ctx context.Context, cfg config.Cfg, configApplyTime, revalApplyTime *time.Time, configApplyBool, revalApplyBool *bool) error {
+		t.Error("expected the update flags to be left set in Traffic Ops by a run with a files filter")
+		return nil
+	}
+
+	for _, status := range []UpdateStatus{UpdateTropsSuccessful, UpdateTropsNotNeeded} {
+		if err := r.UpdateTrafficOps(&status); err != nil {
+			t.Errorf("%s: expected Traffic Ops to not be updated, actual error: %v", status, err)
+		}
+	}
+}
+
+func TestClearUpdateFlag(t *testing.T) {
+	updateTime := time.Now()
+	sent := 0
+	var sentConfigApplyTime, sentRevalApplyTime *time.Time
+	sendUpdate := func(ctx context.Context, cfg config.Cfg, configApplyTime, revalApplyTime *time.Time, configApplyBool, revalApplyBool *bool) error {
+		sent++
+		sentConfigApplyTime, sentRevalApplyTime = configApplyTime, revalApplyTime
+		return nil
+	}
+
+	cfg := testCfg
+	cfg.Files = t3cutil.ApplyFilesFlagAll
+	r := NewTrafficOpsReq(context.Background(), cfg)
+	r.sendUpdate = sendUpdate
+	if err := r.clearUpdateFlag(&atscfg.ServerUpdateStatus{RevalPending: true, ConfigUpdateTime: &updateTime}); err != nil {
+		t.Fatalf("expected no error, actual: %v", err)
+	}
+	if sent != 0 {
+		t.Errorf("expected the update flag not to be cleared when only the reval flag is set, actual sends: %d", sent)
+	}
+	if err := r.clearUpdateFlag(&atscfg.ServerUpdateStatus{UpdatePending: true, ConfigUpdateTime: &updateTime}); err != nil {
+		t.Fatalf("expected no error, actual: %v", err)
+	}
+	if sent != 1 || sentConfigApplyTime != &updateTime || sentRevalApplyTime != nil {
+		t.Errorf("expected the update flag to be cleared as of its update time, actual sends: %d", sent)
+	}
+
+	cfg.Files = t3cutil.ApplyFilesFlagReval
+	r = NewTrafficOpsReq(context.Background(), cfg)
+	r.sendUpdate = sendUpdate
+	sent = 0
+	if err := r.clearUpdateFlag(&atscfg.ServerUpdateStatus{RevalPending: true, RevalidateUpdateTime: &updateTime}); err != nil {
+		t.Fatalf("expected no error, actual: %v", err)
+	}
+	if sent != 1 || sentRevalApplyTime != &updateTime || sentConfigApplyTime != nil {
+		t.Errorf("expected the reval flag to be cleared as of its update time with --files=reval, actual sends: %d", sent)
+	}
+}
+
+func TestCheckReloadRestartReloadOnly(t *testing.T) {
+	data := []FileRestartData{
+		{Name: "plugin.config", RestartData: RestartData{TrafficServerRestart: true}},
+		{Name: "records.config", RestartData: RestartData{TrafficCtlReload: true}},
+	}
+
+	r := NewTrafficOpsReq(context.Background(), testCfg)
+	if rd := r.CheckReloadRestart(data); !rd.TrafficServerRestart {
+		t.Errorf("expected a changed plugin.config to require a restart, actual: %+v", rd)
+	}
+
+	cfg := testCfg
+	cfg.ReloadOnlyConfigFiles = []string{"plugin.*"}
+	r = NewTrafficOpsReq(context.Background(), cfg)
+	if rd := r.CheckReloadRestart(data); rd.TrafficServerRestart || !rd.TrafficCtlReload {
+		t.Errorf("expected a changed plugin.config matching --reload-only-config-files to require only a reload, actual: %+v", rd)
+	}
+	if !data[0].TrafficServerRestart {
+		t.Error("expected the file restart data to not be modified")
+	}
+
+	r.changedFiles = []string{"/opt/trafficserver/etc/trafficserver/plugin.config", "/opt/trafficserver/etc/trafficserver/remap.config"}
+	others, reloadOnly := r.splitReloadOnlyChangedFiles()
+	if len(others) != 1 || others[0] != r.changedFiles[1] || len(reloadOnly) != 1 || reloadOnly[0] != r.changedFiles[0] {
+		t.Errorf("expected plugin.config to be split from the other changed files, actual: %v %v", others, reloadOnly)
+	}
+}
+
+func TestInstallPackages(t *testing.T) {
+	pkgs := []string{"a-1", "b-1", "c-1"}
+	calls := [][]string{}
+	r := NewTrafficOpsReq(context.Background(), testCfg)
+	r.packagesInstall = func(ctx context.Context, names []string) (bool, error) {
+		calls = append(calls, names)
+		return true, nil
+	}
+	if err := r.installPackages(pkgs); err != nil {
+		t.Fatalf("expected no error installing packages, actual: %v", err)
+	}
+	if len(calls) != 1 || strings.Join(calls[0], " ") != strings.Join(pkgs, " ") {
+		t.Errorf("expected every package to be installed in a single transaction, actual: %v", calls)
+	}
+	if r.InstalledPackageCount() != len(pkgs) {
+		t.Errorf("expected every package to be recorded as installed, actual: %v", r.installedPkgs)
+	}
+
+	// a failed transaction installs none of the packages.
+	r = NewTrafficOpsReq(context.Background(), testCfg)
+	r.packagesInstall = func(ctx context.Context, names []string) (bool, error) {
+		return false, errors.New("no such package")
+	}
+	if err := r.installPackages(pkgs); err == nil {
+		t.Error("expected an error when the install transaction fails")
+	}
+	if r.InstalledPackageCount() != 0 || len(r.pkgs) != 0 {
+		t.Errorf("expected no package to be recorded as installed, actual: %v", r.installedPkgs)
+	}
+}
+
+func TestVerifyEnabledServices(t *testing.T) {
+	statuses := map[string]util.ServiceStatus{
+		"trafficserver": util.SvcRunning,
+		"ntpd":          util.SvcNotRunning,
+		"teakd":         util.SvcUnknown,
+	}
+	newReq := func(verify config.VerifyEnabledServicesFlag, svcManagement config.SvcManagement) *TrafficOpsReq {
+		cfg := testCfg
+		cfg.VerifyEnabledServices = verify
+		cfg.SvcManagement = svcManagement
+		r := NewTrafficOpsReq(context.Background(), cfg)
+		r.enabledServices = []string{"trafficserver", "ntpd", "teakd"}
+		r.getServiceStatus = func(management config.SvcManagement, name string) (util.ServiceStatus, int, error) {
+			if management != svcManagement {
+				t.Errorf("expected the status to be gotten with %s, actual: %s", svcManagement, management)
+			}
+			if statuses[name] == util.SvcUnknown {
+				return util.SvcUnknown, -1, errors.New("no such service")
+			}
+			return statuses[name], -1, nil
+		}
+		return r
+	}
+
+	r := newReq(config.VerifyEnabledServicesIgnore, config.SystemD)
+	if err := r.VerifyEnabledServices(); err != nil {
+		t.Errorf("expected no error with ignore, actual: %v", err)
+	}
+	if r.serviceStatuses != nil {
+		t.Errorf("expected no services verified with ignore, actual: %v", r.serviceStatuses)
+	}
+
+	r = newReq(config.VerifyEnabledServicesWarn, config.SystemV)
+	if err := r.VerifyEnabledServices(); err != nil {
+		t.Errorf("expected no error with warn, actual: %v", err)
+	}
+	for name, status := range statuses {
+		if r.serviceStatuses[name] != status {
+			t.Errorf("expected service %s status %s, actual: %s", name, status, r.serviceStatuses[name])
+		}
+	}
+
+	r = newReq(config.VerifyEnabledServicesError, config.SystemD)
+	if err := r.VerifyEnabledServices(); err == nil {
+		t.Error("expected an error with error when an enabled service isn't running")
+	}
+
+	statuses["ntpd"] = util.SvcRunning
+	r = newReq(config.VerifyEnabledServicesError, config.SystemD)
+	if err := r.VerifyEnabledServices(); err != nil {
+		t.Errorf("expected no error when the only unverified service has an unknown status, actual: %v", err)
+	}
+}
+
+func TestReplaceCfgFileSymlink(t *testing.T) {
+	dir := t.TempDir()
+	realDir := filepath.Join(dir, "real")
+	if err := os.Mkdir(realDir, 0755); err != nil {
+		t.Fatalf("creating directory: %v", err)
+	}
+	target := filepath.Join(realDir, "records.config")
+	link := filepath.Join(dir, "records.config")
+
+	for _, symlinked := range []config.SymlinkedConfigFilesFlag{config.SymlinkedConfigFilesFollow, config.SymlinkedConfigFilesRefuse} {
+		os.Remove(link)
+		if err := ioutil.WriteFile(target, []byte("old"), 0644); err != nil {
+			t.Fatalf("writing target: %v", err)
+		}
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatalf("creating symlink: %v", err)
+		}
+
+		cfg := testCfg
+		cfg.Files = t3cutil.ApplyFilesFlagAll
+		cfg.SymlinkedConfigFiles = symlinked
+		r := NewTrafficOpsReq(context.Background(), cfg)
+		r.configFileWarnings = map[string][]string{}
+		cfgFile := &ConfigFile{Name: "records.config", Dir: dir, Path: link, Body: []byte("new"), Perm: 0644, Uid: os.Getuid(), Gid: os.Getgid()}
+		_, err := r.replaceCfgFile(cfgFile)
+
+		if fi, lerr := os.Lstat(link); lerr != nil || fi.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%s: expected the symlink to be kept, actual: %v %v", symlinked, fi, lerr)
+		}
+		body, rerr := ioutil.ReadFile(target)
+		if rerr != nil {
+			t.Fatalf("%s: reading target: %v", symlinked, rerr)
+		}
+		if _, serr := os.Stat(target + configFileTempSuffix); !os.IsNotExist(serr) {
+			t.Errorf("%s: expected no temp file to be left, actual: %v", symlinked, serr)
+		}
+
+		if symlinked == config.SymlinkedConfigFilesFollow {
+			if err != nil {
+				t.Errorf("%s: expected no error, actual: %v", symlinked, err)
+			}
+			if string(body) != "new" || !cfgFile.ChangeApplied {
+				t.Errorf("%s: expected the symlink target to be replaced, actual: '%s'", symlinked, body)
+			}
+		} else {
+			if err == nil {
+				t.Errorf("%s: expected an error", symlinked)
+			}
+			if string(body) != "old" || cfgFile.ChangeApplied {
+				t.Errorf("%s: expected the symlink target to not be replaced, actual: '%s'", symlinked, body)
+			}
+			if len(r.configFileWarnings["records.config"]) == 0 {
+				t.Errorf("%s: expected a warning", symlinked)
+			}
+		}
+	}
+
+	// a dangling symlink is never followed.
+	os.Remove(link)
+	if err := os.Symlink(filepath.Join(dir, "nonexistent"), link); err != nil {
+		t.Fatalf("creating symlink: %v", err)
+	}
+	if path, err := resolveConfigFileSymlink(link, true); err == nil {
+		t.Errorf("expected an error following a dangling symlink, actual path: %s", path)
+	}
+	if path, err := resolveConfigFileSymlink(target, false); err != nil || path != target {
+		t.Errorf("expected a regular file to be its own path, actual: '%s' %v", path, err)
+	}
+}
+
+func TestApplyFilePermissionPolicy(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "hardened.config")
+	if err := ioutil.WriteFile(existing, []byte("x"), 0600); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	if err := os.Chmod(existing, 0600); err != nil {
+		t.Fatalf("changing mode: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		perm     os.FileMode
+		preserve bool
+		minMode  os.FileMode
+		maxMode  os.FileMode
+		expected os.FileMode
+	}{
+		{"traffic ops mode", existing, 0644, false, 0, 0, 0644},
+		{"preserve existing", existing, 0644, true, 0, 0, 0600},
+		{"preserve new", filepath.Join(dir, "new.config"), 0644, true, 0, 0, 0644},
+		{"enforce max", existing, 0664, false, 0, 0640, 0640},
+		{"enforce min", existing, 0400, false, 0600, 0, 0600},
+		{"preserve and enforce max", existing, 0644, true, 0, 0400, 0400},
+		{"min over max", existing, 0644, false, 0600, 0400, 0600},
+	}
+	for _, test := range tests {
+		cfg := &ConfigFile{Name: filepath.Base(test.path), Path: test.path, Perm: test.perm, Uid: 12345, Gid: 12345}
+		if err := applyFilePermissionPolicy(cfg, test.preserve, test.minMode, test.maxMode); err != nil {
+			t.Errorf("%s: expected no error, actual: %v", test.name, err)
+			continue
+		}
+		if cfg.Perm != test.expected {
+			t.Errorf("%s: expected mode %#o, actual: %#o", test.name, test.expected, cfg.Perm)
+		}
+		preserved := test.preserve && test.path == existing
+		if preserved && (cfg.Uid != os.Getuid() || cfg.Gid != os.Getgid()) {
+			t.Errorf("%s: expected the existing owner %d:%d, actual: %d:%d", test.name, os.Getuid(), os.Getgid(), cfg.Uid, cfg.Gid)
+		} else if !preserved && (cfg.Uid != 12345 || cfg.Gid != 12345) {
+			t.Errorf("%s: expected the owner from Traffic Ops, actual: %d:%d", test.name, cfg.Uid, cfg.Gid)
+		}
+	}
+}
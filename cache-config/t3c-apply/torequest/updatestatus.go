@@ -0,0 +1,98 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// MarshalText implements encoding.TextMarshaler, so the UpdateStatus is
+// printed by name in JSON.
+func (u UpdateStatus) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UpdateStatusTransition is a change of the UpdateStatus of a run.
+type UpdateStatusTransition struct {
+	From   UpdateStatus `json:"from"`
+	To     UpdateStatus `json:"to"`
+	Reason string       `json:"reason"`
+	Time   time.Time    `json:"time"`
+}
+
+// setUpdateStatus records the transition of the UpdateStatus of the run to
+// the given status, for the given reason, and returns the status. Nothing is
+// recorded if the status doesn't change.
+//
+// The run starts at UpdateTropsNotNeeded, and every function which determines
+// or changes the status of the run must set it here, so the transitions
+// follow the status the caller holds.
+func (r *TrafficOpsReq) setUpdateStatus(to UpdateStatus, reason string) UpdateStatus {
+	r.updateStatusMutex.Lock()
+	defer r.updateStatusMutex.Unlock()
+	from := r.updateStatus
+	if from == to {
+		return to
+	}
+	r.updateStatus = to
+	r.updateStatusTransitions = append(r.updateStatusTransitions, UpdateStatusTransition{
+		From:   from,
+		To:     to,
+		Reason: reason,
+		Time:   time.Now(),
+	})
+	log.Debugf("update status changed from %s to %s: %s\n", from, to, reason)
+	return to
+}
+
+// UpdateStatusTransitions returns the transitions of the UpdateStatus of the
+// run, in the order they happened. It is safe to call while the run is still
+// setting the status.
+func (r *TrafficOpsReq) UpdateStatusTransitions() []UpdateStatusTransition {
+	r.updateStatusMutex.Lock()
+	defer r.updateStatusMutex.Unlock()
+	return append([]UpdateStatusTransition{}, r.updateStatusTransitions...)
+}
+
+// UpdateStatusTransitionsJSON returns the UpdateStatusTransitions as a JSON array.
+func (r *TrafficOpsReq) UpdateStatusTransitionsJSON() string {
+	bts, err := json.Marshal(r.UpdateStatusTransitions())
+	if err != nil {
+		log.Errorln("marshalling update status transitions: " + err.Error())
+		return "[]"
+	}
+	return string(bts)
+}
+
+// LogUpdateStatusTransitions logs the history of the UpdateStatus of the run
+// at the debug level, to show why the run ended in its status.
+func (r *TrafficOpsReq) LogUpdateStatusTransitions() {
+	r.updateStatusMutex.Lock()
+	status := r.updateStatus
+	r.updateStatusMutex.Unlock()
+	transitions := r.UpdateStatusTransitions()
+	log.Debugf("update status is %s after %d transitions\n", status, len(transitions))
+	for i, transition := range transitions {
+		log.Debugf("update status transition %d at %s: %s -> %s: %s\n", i+1, transition.Time.Format(time.RFC3339Nano), transition.From, transition.To, transition.Reason)
+	}
+}
@@ -0,0 +1,118 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// checkTransitions checks that the recorded transitions go through the
+// expected statuses, starting from UpdateTropsNotNeeded.
+func checkTransitions(t *testing.T, name string, r *TrafficOpsReq, expected ...UpdateStatus) {
+	t.Helper()
+	transitions := r.UpdateStatusTransitions()
+	if len(transitions) != len(expected) {
+		t.Fatalf("%s: expected %d transitions, actual: %+v", name, len(expected), transitions)
+	}
+	from := UpdateTropsNotNeeded
+	for i, transition := range transitions {
+		if transition.From != from || transition.To != expected[i] {
+			t.Errorf("%s: expected transition %d from %s to %s, actual: %s to %s", name, i, from, expected[i], transition.From, transition.To)
+		}
+		if transition.Reason == "" {
+			t.Errorf("%s: expected transition %d to have a reason", name, i)
+		}
+		if i > 0 && transition.Time.Before(transitions[i-1].Time) {
+			t.Errorf("%s: expected transition %d to be after the previous one", name, i)
+		}
+		from = expected[i]
+	}
+}
+
+func TestSetUpdateStatus(t *testing.T) {
+	// an update which is applied and reloaded.
+	r := NewTrafficOpsReq(context.Background(), testCfg)
+	status := r.setUpdateStatus(UpdateTropsNeeded, "update pending")
+	status = r.setUpdateStatus(UpdateTropsNeeded, "config files changed")
+	status = r.setUpdateStatus(UpdateTropsSuccessful, "reloaded")
+	if status != UpdateTropsSuccessful {
+		t.Errorf("expected the set status to be returned, actual: %s", status)
+	}
+	checkTransitions(t, "successful", r, UpdateTropsNeeded, UpdateTropsSuccessful)
+
+	// an update which fails to reload.
+	r = NewTrafficOpsReq(context.Background(), testCfg)
+	r.setUpdateStatus(UpdateTropsNeeded, "update pending")
+	r.setUpdateStatus(UpdateTropsFailed, "reload failed")
+	checkTransitions(t, "failed", r, UpdateTropsNeeded, UpdateTropsFailed)
+
+	transitions := []map[string]interface{}{}
+	if err := json.Unmarshal([]byte(r.UpdateStatusTransitionsJSON()), &transitions); err != nil {
+		t.Fatalf("expected the transitions as JSON, actual error: %v", err)
+	}
+	if len(transitions) != 2 || transitions[1]["from"] != "UpdateTropsNeeded" || transitions[1]["to"] != "UpdateTropsFailed" || transitions[1]["reason"] != "reload failed" {
+		t.Errorf("expected the transitions by status name in JSON, actual: %v", transitions)
+	}
+
+	// no update pending.
+	r = NewTrafficOpsReq(context.Background(), testCfg)
+	r.setUpdateStatus(UpdateTropsNotNeeded, "no update pending")
+	checkTransitions(t, "not needed", r)
+	if r.UpdateStatusTransitionsJSON() != "[]" {
+		t.Errorf("expected no transitions as an empty JSON array, actual: %s", r.UpdateStatusTransitionsJSON())
+	}
+}
+
+func TestProcessConfigFilesUpdateStatus(t *testing.T) {
+	// an update is pending, but no config files need to be changed.
+	r := NewTrafficOpsReq(context.Background(), testCfg)
+	r.setUpdateStatus(UpdateTropsNeeded, "update pending")
+	status, err := r.ProcessConfigFiles()
+	if err != nil {
+		t.Fatalf("processing config files: %v", err)
+	}
+	if status != UpdateTropsNotNeeded {
+		t.Errorf("expected %s, actual: %s", UpdateTropsNotNeeded, status)
+	}
+	checkTransitions(t, "no changes", r, UpdateTropsNeeded, UpdateTropsNotNeeded)
+}
+
+func TestUpdateStatusTransitionsConcurrent(t *testing.T) {
+	// the transitions may be read while the run is still setting the status, e.g. after it's aborted.
+	r := NewTrafficOpsReq(context.Background(), testCfg)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			r.setUpdateStatus(UpdateTropsNeeded, "update pending")
+			r.setUpdateStatus(UpdateTropsNotNeeded, "no changes")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		r.UpdateStatusTransitions()
+		r.LogUpdateStatusTransitions()
+	}
+	<-done
+	if transitions := r.UpdateStatusTransitions(); len(transitions) != 200 {
+		t.Errorf("expected 200 transitions, actual: %d", len(transitions))
+	}
+}
@@ -190,7 +190,11 @@ func makeGitCommitMsg(cfg config.Cfg, now time.Time, self bool, success bool) st
 		" update-ipallow=" + strconv.FormatBool(cfg.UpdateIPAllow) +
 		" wait-for-parents=" + strconv.FormatBool(cfg.WaitForParents) +
 		" no-unset-update-flag=" + strconv.FormatBool(cfg.NoUnsetUpdateFlag) +
+		" no-status=" + strconv.FormatBool(cfg.NoStatus) +
 		" report-only=" + strconv.FormatBool(cfg.ReportOnly)
+	if cfg.ChangeID != "" {
+		modeStr += " change-id=" + cfg.ChangeID
+	}
 
 	successStr := "fail"
 	if success {
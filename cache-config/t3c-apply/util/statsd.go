@@ -0,0 +1,78 @@
+package util
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsdTimeout is the timeout for sending metrics to a statsd server.
+const StatsdTimeout = 5 * time.Second
+
+// StatsdMetric is a single statsd metric.
+type StatsdMetric struct {
+	Name  string
+	Value int64
+	Type  string // the statsd metric type, e.g. "c", "g", or "ms"
+}
+
+// StatsdGauge returns a statsd gauge metric.
+func StatsdGauge(name string, val int64) StatsdMetric {
+	return StatsdMetric{Name: name, Value: val, Type: "g"}
+}
+
+// StatsdCounter returns a statsd counter metric.
+func StatsdCounter(name string, val int64) StatsdMetric {
+	return StatsdMetric{Name: name, Value: val, Type: "c"}
+}
+
+// StatsdTiming returns a statsd timing metric, in milliseconds.
+func StatsdTiming(name string, dur time.Duration) StatsdMetric {
+	return StatsdMetric{Name: name, Value: int64(dur / time.Millisecond), Type: "ms"}
+}
+
+// SendStatsd sends the given metrics to the statsd server at addr over UDP, in a single packet.
+// Each metric name is prefixed with prefix and a dot, if prefix is not empty.
+func SendStatsd(addr string, prefix string, metrics []StatsdMetric) error {
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	lines := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		lines = append(lines, prefix+metric.Name+":"+strconv.FormatInt(metric.Value, 10)+"|"+metric.Type)
+	}
+
+	conn, err := net.DialTimeout("udp", addr, StatsdTimeout)
+	if err != nil {
+		return errors.New("connecting to statsd '" + addr + "': " + err.Error())
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(StatsdTimeout)); err != nil {
+		return errors.New("setting statsd deadline: " + err.Error())
+	}
+	if _, err := conn.Write([]byte(strings.Join(lines, "\n"))); err != nil {
+		return errors.New("sending metrics to statsd '" + addr + "': " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package util
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// listenStatsd returns a UDP listener for a test statsd server.
+func listenStatsd(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listening for statsd: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestSendStatsd(t *testing.T) {
+	conn := listenStatsd(t)
+	metrics := []StatsdMetric{
+		StatsdCounter("runs", 1),
+		StatsdTiming("run_duration", 1500*time.Millisecond),
+		StatsdGauge("exit_code", 138),
+	}
+	if err := SendStatsd(conn.LocalAddr().String(), "t3c.apply", metrics); err != nil {
+		t.Fatalf("sending metrics: %v", err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("reading metrics: %v", err)
+	}
+	expected := "t3c.apply.runs:1|c\nt3c.apply.run_duration:1500|ms\nt3c.apply.exit_code:138|g"
+	if actual := string(buf[:n]); actual != expected {
+		t.Errorf("expected metrics '%s', actual: '%s'", expected, actual)
+	}
+
+	if err := SendStatsd("not an address", "", metrics); err == nil {
+		t.Error("expected an error sending to an invalid address")
+	}
+}
@@ -21,6 +21,7 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -103,9 +104,14 @@ func DirectoryExists(dir string) (bool, os.FileInfo) {
 }
 
 func ExecCommand(fullCommand string, arg ...string) ([]byte, int, error) {
+	return ExecCommandContext(context.Background(), fullCommand, arg...)
+}
+
+// ExecCommandContext is like ExecCommand, but kills the command if the given context is done before it completes.
+func ExecCommandContext(ctx context.Context, fullCommand string, arg ...string) ([]byte, int, error) {
 	var outbuf bytes.Buffer
 	var errbuf bytes.Buffer
-	cmd := exec.Command(fullCommand, arg...)
+	cmd := exec.CommandContext(ctx, fullCommand, arg...)
 	cmd.Stdout = &outbuf
 	cmd.Stderr = &errbuf
 	err := cmd.Run()
@@ -178,9 +184,27 @@ func GetServiceStatus(name string) (ServiceStatus, int, error) {
 	}
 }
 
+// GetServiceStatusByManagement returns the status of the service like
+// GetServiceStatus, which parses the SystemD status output. SystemV init
+// scripts print no such output, so with SystemV the service is running if its
+// status succeeds, per the LSB init script exit codes.
+func GetServiceStatusByManagement(svcManagement config.SvcManagement, name string) (ServiceStatus, int, error) {
+	if svcManagement != config.SystemV {
+		return GetServiceStatus(name)
+	}
+	_, rc, err := ExecCommand("/usr/sbin/service", name, "status")
+	if rc == 0 && err == nil {
+		return SvcRunning, -1, nil
+	} else if rc >= 1 && rc <= 3 { // dead with a pid file, dead with a lock file, or not running
+		return SvcNotRunning, -1, nil
+	}
+	return SvcUnknown, -1, errors.New("could not get status for service '" + name + "'\n")
+}
+
 // start or restart the service 'service'. cmd is 'start | restart'
+// The start or restart is killed if ctx is done before it completes.
 // GetServiceStatus関数でサービスの起動状態を判断した後に、「/usr/sbin/service <service> start|restart」を実行します。
-func ServiceStart(service string, cmd string) (bool, error) {
+func ServiceStart(ctx context.Context, service string, cmd string) (bool, error) {
 
 	log.Infof("ServiceStart called for '%s'\n", service)
 
@@ -193,7 +217,7 @@ func ServiceStart(service string, cmd string) (bool, error) {
 	} else {
 		// サービスの起動や再起動を行う
 		// 例えば、serviceには「trafficserver」、cmdには「start」、「restart」などが指定されます。
-		_, rc, err := ExecCommand("/usr/sbin/service", service, cmd)
+		_, rc, err := ExecCommandContext(ctx, "/usr/sbin/service", service, cmd)
 		if err != nil {
 			return false, errors.New("Could not " + cmd + " the '" + service + "' service: " + err.Error())
 		} else if rc == 0 {
@@ -228,18 +252,20 @@ func WriteFileWithOwner(fn string, data []byte, uid *int, gid *int, perm os.File
 	return c, nil
 }
 
-func PackageAction(cmdstr string, name string) (bool, error) {
+// PackageAction runs the yum command cmdstr ('info | install | remove') on the package name.
+// The command is killed if ctx is done before it completes.
+func PackageAction(ctx context.Context, cmdstr string, name string) (bool, error) {
 	var rc int = -1
 	var err error = nil
 	var result bool = false
 
 	switch cmdstr {
 	case "info":
-		_, rc, err = ExecCommand("/usr/bin/yum", "info", "-y", name)
+		_, rc, err = ExecCommandContext(ctx, "/usr/bin/yum", "info", "-y", name)
 	case "install":
-		_, rc, err = ExecCommand("/usr/bin/yum", "install", "-y", name)
+		_, rc, err = ExecCommandContext(ctx, "/usr/bin/yum", "install", "-y", name)
 	case "remove":
-		_, rc, err = ExecCommand("/usr/bin/yum", "remove", "-y", name)
+		_, rc, err = ExecCommandContext(ctx, "/usr/bin/yum", "remove", "-y", name)
 	}
 
 	if rc == 0 {
@@ -249,6 +275,17 @@ func PackageAction(cmdstr string, name string) (bool, error) {
 	return result, err
 }
 
+// PackagesInstall installs all of the named packages in a single yum transaction,
+// returning true if yum succeeded, in which case all of them were installed.
+func PackagesInstall(ctx context.Context, names []string) (bool, error) {
+	args := append([]string{"install", "-y"}, names...)
+	_, rc, err := ExecCommandContext(ctx, "/usr/bin/yum", args...)
+	if rc == 0 {
+		return true, nil
+	}
+	return false, err
+}
+
 // runs the rpm command.
 // if the return code from rpm == 0, then a valid package list is returned.
 //
@@ -30,6 +30,7 @@ import (
 	"strings"
 
 	"github.com/apache/trafficcontrol/cache-config/t3c-check-refs/config"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
 	"github.com/apache/trafficcontrol/lib/go-log"
 )
 
@@ -83,12 +84,7 @@ func checkConfigLine(line string, lineNumber int, filesAdding map[string]struct{
 	// remap.configは3つのフィールドが必要: https://docs.trafficserver.apache.org/admin-guide/files/remap.config.en.html#reverse-proxy-mapping-rules
 	// 以下の6つのtypeはremap.configのタイプで規定されている。regex_mapやregex_redirect, regex_map_with_recv_portは下記の分岐には含まれていない模様
 	// see: https://docs.trafficserver.apache.org/admin-guide/files/remap.config.en.html#format
-	if length > 3 && (fields[0] == "map" ||
-		fields[0] == "map_with_recv_port" ||
-		fields[0] == "map_with_referer" ||
-		fields[0] == "reverse_map" ||
-		fields[0] == "redirect" ||
-		fields[0] == "redirect_temporary") {
+	if length > 3 && t3cutil.IsRemapRuleType(fields[0]) {
 
 		// remap.configの各行の処理となる。最初のフィールドは上のifでチェックされていて、3つ以上のフィールドがないとエラー
 		// see: https://docs.trafficserver.apache.org/admin-guide/files/remap.config.en.html#reverse-proxy-mapping-rules
@@ -122,7 +118,7 @@ func checkConfigLine(line string, lineNumber int, filesAdding map[string]struct{
 				// are assumed to be configuration files and are checked that they
 				// exist in the filesystem at the absolute location in the name
 				// or relative to the ATS configuration files directory.
-				m := regexp.MustCompile(`^*(\.config|\.cfg|\.txt|\.yml|\.yaml)+`)
+				m := t3cutil.RemapPParamConfigFileRe
 
 				// @pparam=xxxx.txtのようになっているので"="でセパレートする
 				sa := strings.Split(fields[ii], "=")
@@ -187,7 +183,7 @@ func checkConfigLine(line string, lineNumber int, filesAdding map[string]struct{
 		// assumed to be configuration files and are checked that they
 		// exist in the filesystem at the absolute location in the name
 		// or relative to the ATS configuration files directory.
-		m := regexp.MustCompile(`([^=]+\.config$|[^=]\.cfg$|[^=]+\.txt$|[^=]+\.yml$|[^=]+\.yaml$)`)
+		m := t3cutil.PluginArgConfigFileRe
 		for ii := 1; ii < length; ii++ {
 			param := strings.TrimSpace(fields[ii])
 			cfg := m.FindStringSubmatch(param)
@@ -0,0 +1,92 @@
+package t3cutil
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RemapPParamConfigFileRe matches remap.config @pparam values which are assumed to be plugin config files.
+var RemapPParamConfigFileRe = regexp.MustCompile(`^*(\.config|\.cfg|\.txt|\.yml|\.yaml)+`)
+
+// PluginArgConfigFileRe matches plugin.config plugin arguments which are assumed to be plugin config files.
+var PluginArgConfigFileRe = regexp.MustCompile(`([^=]+\.config$|[^=]\.cfg$|[^=]+\.txt$|[^=]+\.yml$|[^=]+\.yaml$)`)
+
+var whitespaceRe = regexp.MustCompile(`\s+`)
+
+// IsRemapRuleType returns whether the first field of a remap.config line is a remap rule which may have plugins.
+func IsRemapRuleType(field string) bool {
+	switch field {
+	case "map", "map_with_recv_port", "map_with_referer", "reverse_map", "redirect", "redirect_temporary":
+		return true
+	}
+	return false
+}
+
+// ConfigFileRefs returns the plugin config files referenced by the text of a remap.config or plugin.config.
+// These are the same references verified by t3c-check-refs: remap.config @pparam values and plugin.config
+// plugin arguments ending in .config, .cfg, .txt, .yml, or .yaml.
+//
+// The returned references are as written in the file, and may be absolute paths or relative to the ATS config directory.
+func ConfigFileRefs(text string) []string {
+	refs := []string{}
+	textArray := []string{}
+	for _, text := range strings.Split(text, "\n") {
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+		textArray = append(textArray, text)
+		if strings.HasSuffix(text, `\`) {
+			continue
+		}
+		line := strings.ReplaceAll(strings.Join(textArray, " "), `\`, " ")
+		textArray = []string{}
+		refs = append(refs, configLineFileRefs(line)...)
+	}
+	return refs
+}
+
+// configLineFileRefs returns the plugin config files referenced by a single, joined remap.config or plugin.config line.
+func configLineFileRefs(line string) []string {
+	refs := []string{}
+	fields := whitespaceRe.Split(strings.TrimSpace(line), -1)
+	if len(fields) > 3 && IsRemapRuleType(fields[0]) {
+		for _, field := range fields[3:] {
+			if !strings.HasPrefix(field, "@pparam") {
+				continue
+			}
+			sa := strings.Split(field, "=")
+			if len(sa) != 2 && len(sa) != 3 {
+				continue
+			}
+			if param := strings.TrimSpace(sa[1]); RemapPParamConfigFileRe.MatchString(param) {
+				refs = append(refs, param)
+			}
+		}
+		return refs
+	}
+	for _, field := range fields[1:] {
+		if match := PluginArgConfigFileRe.FindStringSubmatch(strings.TrimSpace(field)); len(match) == 2 {
+			refs = append(refs, match[0])
+		}
+	}
+	return refs
+}
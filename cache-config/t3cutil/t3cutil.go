@@ -21,6 +21,7 @@ package t3cutil
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html"
@@ -168,7 +169,12 @@ func UnencodeFilter(body []string) []string {
 // which will differ from what would have been returned by a command line.
 //
 func Do(cmdStr string, args ...string) ([]byte, []byte, int) {
-	cmd := exec.Command(cmdStr, args...)
+	return DoContext(context.Background(), cmdStr, args...)
+}
+
+// DoContext is like Do but takes a context, which kills the command if it is done before the command completes.
+func DoContext(ctx context.Context, cmdStr string, args ...string) ([]byte, []byte, int) {
+	cmd := exec.CommandContext(ctx, cmdStr, args...)
 
 	var outbuf bytes.Buffer
 	var errbuf bytes.Buffer
@@ -191,7 +197,12 @@ func Do(cmdStr string, args ...string) ([]byte, []byte, int) {
 
 // DoInput is like Do but takes the stdin to pass to the command.
 func DoInput(input []byte, cmdStr string, args ...string) ([]byte, []byte, int) {
-	cmd := exec.Command(cmdStr, args...)
+	return DoInputContext(context.Background(), input, cmdStr, args...)
+}
+
+// DoInputContext is like DoInput but takes a context, which kills the command if it is done before the command completes.
+func DoInputContext(ctx context.Context, input []byte, cmdStr string, args ...string) ([]byte, []byte, int) {
+	cmd := exec.CommandContext(ctx, cmdStr, args...)
 
 	var outbuf bytes.Buffer
 	var errbuf bytes.Buffer
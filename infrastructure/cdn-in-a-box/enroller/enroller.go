@@ -23,13 +23,17 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/apache/trafficcontrol/lib/go-log"
@@ -44,12 +48,149 @@ var startedFile = "enroller-started"
 
 type session struct {
 	*client.Session
+	// writeResults is whether the enrolled objects are written to results files, so objects which
+	// already exist, or which Traffic Ops doesn't return from their creation, are looked up to write them.
+	writeResults bool
+}
+
+// enrollerUserAgent is the User-Agent of the enroller's requests to Traffic Ops.
+const enrollerUserAgent = "cdn-in-a-box-enroller"
+
+// transportConfig is the tuning of the session's connections to Traffic Ops. Bulk enrollment makes
+// many requests, often concurrently, so idle connections are kept for reuse rather than re-dialed.
+type transportConfig struct {
+	// RequestTimeout is the maximum time of each request, including reading its response.
+	RequestTimeout time.Duration `envconfig:"TO_REQUEST_TIMEOUT" default:"60s"`
+	// MaxIdleConns is the maximum number of idle connections kept for reuse.
+	MaxIdleConns int `envconfig:"TO_MAX_IDLE_CONNS" default:"100"`
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept for reuse to each host.
+	// The net/http default of 2 is fewer than the requests the enroller makes at once.
+	MaxIdleConnsPerHost int `envconfig:"TO_MAX_IDLE_CONNS_PER_HOST" default:"16"`
+	// IdleConnTimeout is how long an idle connection is kept before it's closed.
+	IdleConnTimeout time.Duration `envconfig:"TO_IDLE_CONN_TIMEOUT" default:"90s"`
+	// KeepAlive is the interval of TCP keep-alive probes of the connections. Negative disables them.
+	KeepAlive time.Duration `envconfig:"TO_KEEP_ALIVE" default:"30s"`
+}
+
+// validate returns an error if any setting is out of range.
+func (cfg transportConfig) validate() error {
+	if cfg.RequestTimeout <= 0 {
+		return fmt.Errorf("Traffic Ops request timeout must be positive, got %v", cfg.RequestTimeout)
+	}
+	if cfg.MaxIdleConns < 0 || cfg.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("Traffic Ops maximum idle connections must not be negative, got %d and %d per host", cfg.MaxIdleConns, cfg.MaxIdleConnsPerHost)
+	}
+	if cfg.IdleConnTimeout < 0 {
+		return fmt.Errorf("Traffic Ops idle connection timeout must not be negative, got %v", cfg.IdleConnTimeout)
+	}
+	return nil
+}
+
+// apply sets the connection pool and keep-alive settings on t.
+func (cfg transportConfig) apply(t *http.Transport) {
+	t.MaxIdleConns = cfg.MaxIdleConns
+	t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	t.IdleConnTimeout = cfg.IdleConnTimeout
+	t.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: cfg.KeepAlive}).DialContext
 }
 
 // TrafficOpsのログインエンドポイントにアクセスしてCookie情報を取得する
-func newSession(reqTimeout time.Duration, toURL string, toUser string, toPass string) (session, error) {
-	s, _, err := client.LoginWithAgent(toURL, toUser, toPass, true, "cdn-in-a-box-enroller", true, reqTimeout)
-	return session{s}, err
+// The session logs in again when its cookie expires; see reauthTransport.
+func newSession(transportCfg transportConfig, toURL string, toUser string, toPass string) (session, error) {
+	reqTimeout := transportCfg.RequestTimeout
+	s, _, err := client.LoginWithAgent(toURL, toUser, toPass, true, enrollerUserAgent, true, reqTimeout)
+	if err != nil {
+		return session{Session: s}, err
+	}
+	// ログイン後の全リクエストで接続を使い回せるよう、Transportの設定を適用する
+	if t, ok := s.Client.Transport.(*http.Transport); ok {
+		transportCfg.apply(t)
+	}
+	u, err := url.Parse(toURL)
+	if err != nil {
+		return session{Session: s}, fmt.Errorf("parsing Traffic Ops URL '%s': %v", toURL, err)
+	}
+	jar := s.Client.Jar
+	s.Client.Transport = &reauthTransport{
+		RoundTripper: s.Client.Transport,
+		jar:          jar,
+		login: func() error {
+			fresh, _, err := client.LoginWithAgent(toURL, toUser, toPass, true, enrollerUserAgent, true, reqTimeout)
+			if err != nil {
+				return err
+			}
+			jar.SetCookies(u, fresh.Client.Jar.Cookies(u))
+			fresh.Client.CloseIdleConnections() // only its cookie is used
+			return nil
+		},
+	}
+	return session{Session: s}, nil
+}
+
+// reauthTransport is an http.RoundTripper which, when Traffic Ops responds to a request with a 401
+// because the session cookie expired, logs in again and retries the request once.
+// Logins are serialized, so concurrent requests which fail together only log in once.
+type reauthTransport struct {
+	http.RoundTripper
+	// jar is the cookie jar of the client, which has the auth cookie.
+	jar http.CookieJar
+	// login logs in to Traffic Ops, setting the new auth cookie in jar.
+	login func() error
+
+	mutex sync.Mutex
+	// logins is the number of times login has succeeded, so a request can tell whether
+	// someone else already logged in again since it was sent.
+	logins uint64
+}
+
+func (t *reauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	logins := t.logins
+	t.mutex.Unlock()
+
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || strings.HasSuffix(req.URL.Path, "/user/login") {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, err // can't resend the body
+	}
+
+	if err := t.relogin(logins); err != nil {
+		log.Warnf("logging in to Traffic Ops again after %s %s was unauthorized: %v\n", req.Method, req.URL.Path, err)
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	retry.Header.Del("Cookie")
+	for _, cookie := range t.jar.Cookies(req.URL) {
+		retry.AddCookie(cookie)
+	}
+	log.Close(resp.Body, "could not close unauthorized response body")
+	return t.RoundTripper.RoundTrip(retry)
+}
+
+// relogin logs in again, unless someone else has since the request which got a 401 was sent,
+// which is indicated by the number of logins having changed from logins.
+func (t *reauthTransport) relogin(logins uint64) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.logins != logins {
+		return nil
+	}
+	log.Infoln("Traffic Ops session expired, logging in again")
+	if err := t.login(); err != nil {
+		return err
+	}
+	t.logins++
+	return nil
 }
 
 func (s session) getParameter(m tc.Parameter, header http.Header) (tc.Parameter, error) {
@@ -72,16 +213,44 @@ func (s session) getParameter(m tc.Parameter, header http.Header) (tc.Parameter,
 	return m, fmt.Errorf("no parameter matching name %s, configFile %s, value %s", m.Name, m.ConfigFile, m.Value)
 }
 
-// enrollType takes a json file and creates a Type object using the TO API
-// 「/shared/enroller/types/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollType(toSession *session, r io.Reader) error {
+// lookupResult returns the object lookup finds as the result of enrolling what, or nil without looking it
+// up if the session doesn't write results. lookup returns a nil object if Traffic Ops has no such object.
+func (s session) lookupResult(what string, lookup func() (interface{}, tc.Alerts, error)) (interface{}, error) {
+	if !s.writeResults {
+		return nil, nil
+	}
+	obj, alerts, err := lookup()
+	if err != nil {
+		err = fmt.Errorf("getting %s: %v - alerts: %+v", what, err, alerts.Alerts)
+		log.Infoln(err)
+		return nil, err
+	}
+	if obj == nil {
+		err = fmt.Errorf("could not find %s", what)
+		log.Infoln(err)
+		return nil, err
+	}
+	return obj, nil
+}
 
+// decodeType decodes a Type from JSON.
+func decodeType(r io.Reader) (tc.Type, error) {
 	dec := json.NewDecoder(r)
 	var s tc.Type
 	err := dec.Decode(&s)
 	if err != nil {
 		log.Infof("error decoding Type: %s", err)
-		return err
+	}
+	return s, err
+}
+
+// enrollType takes a json file and creates a Type object using the TO API
+// 「/shared/enroller/types/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollType(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeType(r)
+	if err != nil {
+		return nil, err
 	}
 
 	// POST /api/4.0/typeへのアクセスを行ないtype情報を生成する
@@ -91,31 +260,54 @@ func enrollType(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts {
 			if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
 				log.Infof("Type '%s' already exists", s.Name)
-				return nil
+				return typeResult(toSession, s.Name)
 			}
 		}
 		err = fmt.Errorf("error creating Type: %v - alerts: %+v", err, alerts.Alerts)
 		log.Infoln(err)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
-	err = enc.Encode(&alerts)
+	if err = enc.Encode(&alerts); err != nil {
+		return nil, err
+	}
 
-	return err
+	return typeResult(toSession, s.Name)
 }
 
-// enrollCDN takes a json file and creates a CDN object using the TO API
-// 「/shared/enroller/cdns/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollCDN(toSession *session, r io.Reader) error {
+// typeResult returns the Type named name as the result of enrolling it, if the session writes results.
+func typeResult(toSession *session, name string) (interface{}, error) {
+	return toSession.lookupResult("Type '"+name+"'", func() (interface{}, tc.Alerts, error) {
+		opts := client.NewRequestOptions()
+		opts.QueryParameters.Set("name", name)
+		resp, _, err := toSession.GetTypes(opts)
+		if len(resp.Response) < 1 {
+			return nil, resp.Alerts, err
+		}
+		return resp.Response[0], resp.Alerts, err
+	})
+}
 
+// decodeCDN decodes a CDN from JSON.
+func decodeCDN(r io.Reader) (tc.CDN, error) {
 	dec := json.NewDecoder(r)
 	var s tc.CDN
 	err := dec.Decode(&s)
 	if err != nil {
 		log.Infof("error decoding CDN: %v", err)
-		return err
+	}
+	return s, err
+}
+
+// enrollCDN takes a json file and creates a CDN object using the TO API
+// 「/shared/enroller/cdns/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollCDN(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeCDN(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreateCDN(s, client.RequestOptions{})
@@ -123,29 +315,52 @@ func enrollCDN(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts {
 			if strings.Contains(alert.Text, "already exists") {
 				log.Infof("CDN '%s' already exists", s.Name)
-				return nil
+				return cdnResult(toSession, s.Name)
 			}
 		}
 		log.Infof("error creating CDN: %v - alerts: %+v", err, alerts.Alerts)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
-	err = enc.Encode(&alerts)
+	if err = enc.Encode(&alerts); err != nil {
+		return nil, err
+	}
 
-	return err
+	return cdnResult(toSession, s.Name)
 }
 
-// 「/shared/enroller/asns/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollASN(toSession *session, r io.Reader) error {
+// cdnResult returns the CDN named name as the result of enrolling it, if the session writes results.
+func cdnResult(toSession *session, name string) (interface{}, error) {
+	return toSession.lookupResult("CDN '"+name+"'", func() (interface{}, tc.Alerts, error) {
+		opts := client.NewRequestOptions()
+		opts.QueryParameters.Set("name", name)
+		resp, _, err := toSession.GetCDNs(opts)
+		if len(resp.Response) < 1 {
+			return nil, resp.Alerts, err
+		}
+		return resp.Response[0], resp.Alerts, err
+	})
+}
 
+// decodeASN decodes an ASN from JSON.
+func decodeASN(r io.Reader) (tc.ASN, error) {
 	dec := json.NewDecoder(r)
 	var s tc.ASN
 	err := dec.Decode(&s)
 	if err != nil {
 		log.Infof("error decoding ASN: %s\n", err)
-		return err
+	}
+	return s, err
+}
+
+// 「/shared/enroller/asns/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollASN(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeASN(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreateASN(s, client.RequestOptions{})
@@ -153,31 +368,54 @@ func enrollASN(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts {
 			if strings.Contains(alert.Text, "already exists") {
 				log.Infof("asn %d already exists", s.ASN)
-				return nil
+				return asnResult(toSession, s.ASN)
 			}
 		}
 		err = fmt.Errorf("error creating ASN: %s - alerts: %+v", err, alerts.Alerts)
 		log.Infoln(err)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
-	err = enc.Encode(&alerts)
+	if err = enc.Encode(&alerts); err != nil {
+		return nil, err
+	}
 
-	return err
+	return asnResult(toSession, s.ASN)
 }
 
-// enrollCachegroup takes a json file and creates a Cachegroup object using the TO API
-// 「/shared/enroller/cachegroups/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollCachegroup(toSession *session, r io.Reader) error {
+// asnResult returns the ASN with the ASN asn as the result of enrolling it, if the session writes results.
+func asnResult(toSession *session, asn int) (interface{}, error) {
+	return toSession.lookupResult(fmt.Sprintf("ASN %d", asn), func() (interface{}, tc.Alerts, error) {
+		opts := client.NewRequestOptions()
+		opts.QueryParameters.Set("asn", strconv.Itoa(asn))
+		resp, _, err := toSession.GetASNs(opts)
+		if len(resp.Response) < 1 {
+			return nil, resp.Alerts, err
+		}
+		return resp.Response[0], resp.Alerts, err
+	})
+}
 
+// decodeCachegroup decodes a Cache Group from JSON.
+func decodeCachegroup(r io.Reader) (tc.CacheGroupNullable, error) {
 	dec := json.NewDecoder(r)
 	var s tc.CacheGroupNullable
 	err := dec.Decode(&s)
 	if err != nil {
 		log.Infof("error decoding Cache Group: '%s'", err)
-		return err
+	}
+	return s, err
+}
+
+// enrollCachegroup takes a json file and creates a Cachegroup object using the TO API
+// 「/shared/enroller/cachegroups/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollCachegroup(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeCachegroup(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreateCacheGroup(s, client.RequestOptions{})
@@ -185,29 +423,46 @@ func enrollCachegroup(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts.Alerts {
 			if strings.Contains(alert.Text, "already exists") {
 				log.Infof("Cache Group '%s' already exists", *s.Name)
-				return nil
+				return toSession.lookupResult("Cache Group '"+*s.Name+"'", func() (interface{}, tc.Alerts, error) {
+					opts := client.NewRequestOptions()
+					opts.QueryParameters.Set("name", *s.Name)
+					resp, _, err := toSession.GetCacheGroups(opts)
+					if len(resp.Response) < 1 {
+						return nil, resp.Alerts, err
+					}
+					return resp.Response[0], resp.Alerts, err
+				})
 			}
 		}
 		err = fmt.Errorf("error creating Cache Group: %v - alerts: %+v", err, alerts.Alerts)
 		log.Infoln(err)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
 	err = enc.Encode(&alerts)
 
-	return err
+	return alerts.Response, err
 }
 
-// 「/shared/enroller/topologies/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollTopology(toSession *session, r io.Reader) error {
+// decodeTopology decodes a Topology from JSON. An empty file is an empty Topology.
+func decodeTopology(r io.Reader) (tc.Topology, error) {
 	dec := json.NewDecoder(r)
 	var s tc.Topology
 	err := dec.Decode(&s)
 	if err != nil && err != io.EOF {
 		log.Infof("error decoding Topology: %s", err)
-		return err
+		return s, err
+	}
+	return s, nil
+}
+
+// 「/shared/enroller/topologies/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollTopology(toSession *session, r io.Reader) (interface{}, error) {
+	s, err := decodeTopology(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreateTopology(s, client.RequestOptions{})
@@ -215,30 +470,120 @@ func enrollTopology(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts.Alerts {
 			if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
 				log.Infof("topology %s already exists", s.Name)
-				return nil
+				return toSession.lookupResult("Topology '"+s.Name+"'", func() (interface{}, tc.Alerts, error) {
+					opts := client.NewRequestOptions()
+					opts.QueryParameters.Set("name", s.Name)
+					resp, _, err := toSession.GetTopologies(opts)
+					if len(resp.Response) < 1 {
+						return nil, resp.Alerts, err
+					}
+					return resp.Response[0], resp.Alerts, err
+				})
 			}
 		}
 		err = fmt.Errorf("error creating Topology: %v - alerts: %+v", err, alerts.Alerts.Alerts)
 		log.Infoln(err)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
 	err = enc.Encode(&alerts)
 
-	return err
+	return alerts.Response, err
 }
 
-// 「/shared/enroller/deliveryservices/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollDeliveryService(toSession *session, r io.Reader) error {
+// decodeServiceCategory decodes a Service Category from JSON.
+func decodeServiceCategory(r io.Reader) (tc.ServiceCategory, error) {
+	dec := json.NewDecoder(r)
+	var s tc.ServiceCategory
+	err := dec.Decode(&s)
+	if err != nil {
+		log.Infof("error decoding Service Category: %s", err)
+	}
+	return s, err
+}
+
+// enrollServiceCategory takes a json file and creates a ServiceCategory object using the TO API
+// 「/shared/enroller/service_categories/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollServiceCategory(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeServiceCategory(r)
+	if err != nil {
+		return nil, err
+	}
 
+	// POST /api/4.0/service_categoriesへのアクセスを行ないservice category情報を生成する
+	// cf. https://traffic-control-cdn.readthedocs.io/en/latest/api/v4/service_categories.html#post
+	alerts, _, err := toSession.CreateServiceCategory(s, client.RequestOptions{})
+	if err != nil {
+		for _, alert := range alerts.Alerts {
+			if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
+				log.Infof("Service Category '%s' already exists", s.Name)
+				return serviceCategoryResult(toSession, s.Name)
+			}
+		}
+		err = fmt.Errorf("error creating Service Category: %v - alerts: %+v", err, alerts.Alerts)
+		log.Infoln(err)
+		return nil, err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(&alerts); err != nil {
+		return nil, err
+	}
+
+	return serviceCategoryResult(toSession, s.Name)
+}
+
+// serviceCategoryResult returns the Service Category named name as the result of enrolling it, if the session writes results.
+func serviceCategoryResult(toSession *session, name string) (interface{}, error) {
+	return toSession.lookupResult("Service Category '"+name+"'", func() (interface{}, tc.Alerts, error) {
+		opts := client.NewRequestOptions()
+		opts.QueryParameters.Set("name", name)
+		resp, _, err := toSession.GetServiceCategories(opts)
+		if len(resp.Response) < 1 {
+			return nil, resp.Alerts, err
+		}
+		return resp.Response[0], resp.Alerts, err
+	})
+}
+
+// decodeDeliveryService decodes a Delivery Service from JSON.
+func decodeDeliveryService(r io.Reader) (tc.DeliveryServiceV4, error) {
 	dec := json.NewDecoder(r)
 	var s tc.DeliveryServiceV4
 	err := dec.Decode(&s)
 	if err != nil {
 		log.Infof("error decoding DeliveryService: %v", err)
-		return err
+	}
+	return s, err
+}
+
+// 「/shared/enroller/deliveryservices/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollDeliveryService(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeDeliveryService(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// the Service Category is referenced by name, so make sure it exists for a clear error
+	if s.ServiceCategory != nil && *s.ServiceCategory != "" {
+		opts := client.NewRequestOptions()
+		opts.QueryParameters.Set("name", *s.ServiceCategory)
+		scs, _, err := toSession.GetServiceCategories(opts)
+		if err != nil {
+			err = fmt.Errorf("getting Service Category '%s': %v - alerts: %+v", *s.ServiceCategory, err, scs.Alerts)
+			log.Infoln(err)
+			return nil, err
+		}
+		if len(scs.Response) < 1 {
+			err = fmt.Errorf("Delivery Service references Service Category '%s', which does not exist", *s.ServiceCategory)
+			log.Infoln(err)
+			return nil, err
+		}
 	}
 
 	alerts, _, err := toSession.CreateDeliveryService(s, client.RequestOptions{})
@@ -246,36 +591,57 @@ func enrollDeliveryService(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts.Alerts {
 			if strings.Contains(alert.Text, "already exists") {
 				log.Infof("Delivery Service '%s' already exists", *s.XMLID)
-				return nil
+				return toSession.lookupResult("Delivery Service '"+*s.XMLID+"'", func() (interface{}, tc.Alerts, error) {
+					opts := client.NewRequestOptions()
+					opts.QueryParameters.Set("xmlId", *s.XMLID)
+					resp, _, err := toSession.GetDeliveryServices(opts)
+					if len(resp.Response) < 1 {
+						return nil, resp.Alerts, err
+					}
+					return resp.Response[0], resp.Alerts, err
+				})
 			}
 		}
 		log.Infof("error creating Delivery Service: %v - alerts: %+v", err, alerts.Alerts)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
 	err = enc.Encode(&alerts)
 
-	return err
+	if len(alerts.Response) < 1 {
+		return nil, err
+	}
+	return alerts.Response[0], err
 }
 
-// enrollDeliveryServicesRequiredCapability takes a json file and creates a DeliveryServicesRequiredCapability object using the TO API
-// 「/shared/enroller/deliveryservices_required_capabilities/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollDeliveryServicesRequiredCapability(toSession *session, r io.Reader) error {
-
+// decodeDeliveryServicesRequiredCapability decodes a Delivery Services Required Capability from JSON,
+// which must have the XMLID of its Delivery Service.
+func decodeDeliveryServicesRequiredCapability(r io.Reader) (tc.DeliveryServicesRequiredCapability, error) {
 	// jsonデコードする。jsonの内容はDeliveryServicesRequiredCapability構造体としてdsrc(Delivery SeRviCe)にマッピングされる
 	dec := json.NewDecoder(r)
 	var dsrc tc.DeliveryServicesRequiredCapability
 	err := dec.Decode(&dsrc)
 	if err != nil {
 		log.Infof("error decoding Delivery Services Required Capability: %s\n", err)
-		return err
+		return dsrc, err
 	}
 
 	// JSON中にDeliveryServiceのXMLIDが存在しなければエラー
 	if dsrc.XMLID == nil {
-		return errors.New("required capability had no XMLID")
+		return dsrc, errors.New("required capability had no XMLID")
+	}
+	return dsrc, nil
+}
+
+// enrollDeliveryServicesRequiredCapability takes a json file and creates a DeliveryServicesRequiredCapability object using the TO API
+// 「/shared/enroller/deliveryservices_required_capabilities/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollDeliveryServicesRequiredCapability(toSession *session, r io.Reader) (interface{}, error) {
+
+	dsrc, err := decodeDeliveryServicesRequiredCapability(r)
+	if err != nil {
+		return nil, err
 	}
 
 	// リクエストにxmlIdを指定する
@@ -287,14 +653,14 @@ func enrollDeliveryServicesRequiredCapability(toSession *session, r io.Reader) e
 	dses, _, err := toSession.GetDeliveryServices(opts)
 	if err != nil {
 		log.Infof("getting Delivery Service by XMLID %s: %s", *dsrc.XMLID, err.Error())
-		return err
+		return nil, err
 	}
 
 	// $.responseに1件もなければエラー
 	if len(dses.Response) < 1 {
 		err = fmt.Errorf("could not find a Delivey Service with XMLID %s", *dsrc.XMLID)
 		log.Infoln(err)
-		return err
+		return nil, err
 	}
 
 	// リクエスト時に指定したxmlId=<xmlId>に対応するDeliveryServiceのIDを取得する
@@ -306,7 +672,7 @@ func enrollDeliveryServicesRequiredCapability(toSession *session, r io.Reader) e
 	alerts, _, err := toSession.CreateDeliveryServicesRequiredCapability(dsrc, client.RequestOptions{})
 	if err != nil {
 		log.Infof("error creating Delivery Services Required Capability: %v", err)
-		return err
+		return nil, err
 	}
 
 	// 標準出力をそのままjson形式にして、半角スペース2つをindentとしてセットしてreturn
@@ -314,12 +680,11 @@ func enrollDeliveryServicesRequiredCapability(toSession *session, r io.Reader) e
 	enc.SetIndent("", "  ")
 	err = enc.Encode(&alerts)
 
-	return err
+	return dsrc, err
 }
 
-// 「/shared/enroller/deliveryservice_servers/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollDeliveryServiceServer(toSession *session, r io.Reader) error {
-
+// decodeDeliveryServiceServers decodes the assignment of servers to a Delivery Service from JSON.
+func decodeDeliveryServiceServers(r io.Reader) (tc.DeliveryServiceServers, error) {
 	dec := json.NewDecoder(r)
 
 	// DeliveryServiceServers lists ds xmlid and array of server names.  Use that to create multiple DeliveryServiceServer objects
@@ -327,19 +692,28 @@ func enrollDeliveryServiceServer(toSession *session, r io.Reader) error {
 	err := dec.Decode(&dss)
 	if err != nil {
 		log.Infof("error decoding DeliveryServiceServer: %s\n", err)
-		return err
+	}
+	return dss, err
+}
+
+// 「/shared/enroller/deliveryservice_servers/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollDeliveryServiceServer(toSession *session, r io.Reader) (interface{}, error) {
+
+	dss, err := decodeDeliveryServiceServers(r)
+	if err != nil {
+		return nil, err
 	}
 
 	opts := client.RequestOptions{QueryParameters: url.Values{"xmlId": []string{dss.XmlId}}}
 	dses, _, err := toSession.GetDeliveryServices(opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if len(dses.Response) == 0 {
-		return errors.New("no deliveryservice with name " + dss.XmlId)
+		return nil, errors.New("no deliveryservice with name " + dss.XmlId)
 	}
 	if dses.Response[0].ID == nil {
-		return errors.New("Deliveryservice with name " + dss.XmlId + " has a nil ID")
+		return nil, errors.New("Deliveryservice with name " + dss.XmlId + " has a nil ID")
 	}
 	dsID := *dses.Response[0].ID
 
@@ -349,33 +723,234 @@ func enrollDeliveryServiceServer(toSession *session, r io.Reader) error {
 		opts.QueryParameters.Set("hostName", sn)
 		servers, _, err := toSession.GetServers(opts)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if len(servers.Response) == 0 {
-			return errors.New("no server with hostName " + sn)
+			return nil, errors.New("no server with hostName " + sn)
 		}
 		if servers.Response[0].ID == nil {
-			return fmt.Errorf("Traffic Ops gave back a representation for server '%s' with null or undefined ID", sn)
+			return nil, fmt.Errorf("Traffic Ops gave back a representation for server '%s' with null or undefined ID", sn)
 		}
 		serverIDs = append(serverIDs, *servers.Response[0].ID)
 	}
 	resp, _, err := toSession.CreateDeliveryServiceServers(dsID, serverIDs, true, client.RequestOptions{})
 	if err != nil {
 		log.Infof("error assigning servers %v to Delivery Service #%d: %v - alerts: %+v", serverIDs, dsID, err, resp.Alerts)
+		return nil, err
 	}
 
-	return err
+	return resp.Response, nil
 }
 
-// 「/shared/enroller/divisions/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollDivision(toSession *session, r io.Reader) error {
+// errMissingDependency is wrapped by the errors of enrolling objects which reference objects that don't exist
+// yet, such as a Delivery Service which hasn't been enrolled. Files which fail with it are retried, rather
+// than rejected at once.
+var errMissingDependency = errors.New("missing dependency")
 
+// getDeliveryServiceID returns the ID of the Delivery Service with the given XMLID, or an error wrapping
+// errMissingDependency if it doesn't exist yet.
+func getDeliveryServiceID(toSession *session, xmlID string) (int, error) {
+	opts := client.RequestOptions{QueryParameters: url.Values{"xmlId": []string{xmlID}}}
+	dses, _, err := toSession.GetDeliveryServices(opts)
+	if err != nil {
+		return 0, fmt.Errorf("getting Delivery Service by XMLID %s: %v", xmlID, err)
+	}
+	if len(dses.Response) == 0 {
+		return 0, fmt.Errorf("%w: no Delivery Service with XMLID %s", errMissingDependency, xmlID)
+	}
+	if dses.Response[0].ID == nil {
+		return 0, fmt.Errorf("Traffic Ops gave back a representation for Delivery Service '%s' with null or undefined ID", xmlID)
+	}
+	return *dses.Response[0].ID, nil
+}
+
+// decodeDeliveryServiceRegexes decodes the regular expressions of a Delivery Service from JSON.
+func decodeDeliveryServiceRegexes(r io.Reader) (tc.DeliveryServiceRegexes, error) {
+	dec := json.NewDecoder(r)
+	var dsr tc.DeliveryServiceRegexes
+	err := dec.Decode(&dsr)
+	if err != nil {
+		log.Infof("error decoding Delivery Service Regexes: %s\n", err)
+		return dsr, err
+	}
+	if dsr.DSName == "" {
+		return dsr, errors.New("Delivery Service Regexes had no dsName")
+	}
+	for _, regex := range dsr.Regexes {
+		if regex.Type == "" || regex.Pattern == "" {
+			return dsr, fmt.Errorf("Delivery Service Regex of %s must have a type and a pattern", dsr.DSName)
+		}
+	}
+	return dsr, nil
+}
+
+// enrollDeliveryServiceRegex takes a json file and adds the regular expressions in it to the Delivery Service
+// with the XMLID dsName. The types of the regular expressions are given by name, e.g. HOST_REGEXP.
+// Regular expressions the Delivery Service already has, such as the one created with it, are skipped.
+// 「/shared/enroller/deliveryservice_regexes/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollDeliveryServiceRegex(toSession *session, r io.Reader) (interface{}, error) {
+
+	dsr, err := decodeDeliveryServiceRegexes(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Delivery Serviceがまだ作成されていなければリトライされる
+	dsID, err := getDeliveryServiceID(toSession, dsr.DSName)
+	if err != nil {
+		log.Infoln(err)
+		return nil, err
+	}
+
+	existing, _, err := toSession.GetDeliveryServiceRegexesByDSID(dsID, client.RequestOptions{})
+	if err != nil {
+		log.Infof("error getting the Regexes of Delivery Service %s: %v", dsr.DSName, err)
+		return nil, err
+	}
+
+	created := []tc.DeliveryServiceRegex{}
+	typeIDs := map[string]int{}
+	for _, regex := range dsr.Regexes {
+		exists := false
+		for _, e := range existing.Response {
+			if e.TypeName == regex.Type && e.Pattern == regex.Pattern && e.SetNumber == regex.SetNumber {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			log.Infof("Delivery Service %s already has %s Regex '%s'\n", dsr.DSName, regex.Type, regex.Pattern)
+			continue
+		}
+
+		typeID, ok := typeIDs[regex.Type]
+		if !ok {
+			opts := client.RequestOptions{QueryParameters: url.Values{"name": []string{regex.Type}}}
+			types, _, err := toSession.GetTypes(opts)
+			if err != nil {
+				log.Infof("error getting Type %s: %v", regex.Type, err)
+				return nil, err
+			}
+			if len(types.Response) == 0 {
+				return nil, errors.New("no type with name " + regex.Type)
+			}
+			typeID = types.Response[0].ID
+			typeIDs[regex.Type] = typeID
+		}
+
+		post := tc.DeliveryServiceRegexPost{Type: typeID, SetNumber: regex.SetNumber, Pattern: regex.Pattern}
+		alerts, _, err := toSession.PostDeliveryServiceRegexesByDSID(dsID, post, client.RequestOptions{})
+		if err != nil {
+			log.Infof("error creating %s Regex '%s' of Delivery Service %s: %v - alerts: %+v", regex.Type, regex.Pattern, dsr.DSName, err, alerts.Alerts)
+			return nil, err
+		}
+		created = append(created, regex)
+	}
+
+	return tc.DeliveryServiceRegexes{DSName: dsr.DSName, Regexes: created}, nil
+}
+
+// deliveryServiceSigningKeys is the URL and URI signing keys of a Delivery Service to enroll.
+type deliveryServiceSigningKeys struct {
+	// XMLID is the XMLID of the Delivery Service.
+	XMLID string `json:"xmlId"`
+	// GenerateURLSigKeys is whether to generate URL signing keys, if the Delivery Service doesn't have any.
+	GenerateURLSigKeys bool `json:"generateUrlSigKeys"`
+	// URISigningKeys are the URI signing keys to set, by issuer.
+	URISigningKeys tc.JWKSMap `json:"uriSigningKeys,omitempty"`
+}
+
+// decodeURLSigKeys decodes the signing keys of a Delivery Service from JSON.
+func decodeURLSigKeys(r io.Reader) (deliveryServiceSigningKeys, error) {
+	dec := json.NewDecoder(r)
+	var keys deliveryServiceSigningKeys
+	err := dec.Decode(&keys)
+	if err != nil {
+		log.Infof("error decoding Delivery Service signing keys: %s\n", err)
+		return keys, err
+	}
+	if keys.XMLID == "" {
+		return keys, errors.New("Delivery Service signing keys had no xmlId")
+	}
+	if !keys.GenerateURLSigKeys && len(keys.URISigningKeys) == 0 {
+		return keys, fmt.Errorf("signing keys of Delivery Service %s must generate URL signing keys or have URI signing keys", keys.XMLID)
+	}
+	return keys, nil
+}
+
+// enrollURLSigKeys takes a json file and generates URL signing keys for the Delivery Service with the XMLID
+// in it, unless it already has them, and sets its URI signing keys, if any are given.
+// 「/shared/enroller/url_sig_keys/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollURLSigKeys(toSession *session, r io.Reader) (interface{}, error) {
+
+	keys, err := decodeURLSigKeys(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Delivery Serviceがまだ作成されていなければリトライされる
+	if _, err := getDeliveryServiceID(toSession, keys.XMLID); err != nil {
+		log.Infoln(err)
+		return nil, err
+	}
+
+	if keys.GenerateURLSigKeys {
+		// 既に鍵があれば再生成しない(再生成すると既存の署名済みURLが無効になる)
+		existing, _, err := toSession.GetDeliveryServiceURLSignatureKeys(keys.XMLID, client.RequestOptions{})
+		if err == nil && len(existing.Response) > 0 {
+			log.Infof("Delivery Service %s already has URL signing keys\n", keys.XMLID)
+		} else {
+			alerts, _, err := toSession.CreateDeliveryServiceURLSignatureKeys(keys.XMLID, client.RequestOptions{})
+			if err != nil {
+				log.Infof("error generating URL signing keys of Delivery Service %s: %v - alerts: %+v", keys.XMLID, err, alerts.Alerts)
+				return nil, err
+			}
+		}
+	}
+
+	if len(keys.URISigningKeys) > 0 {
+		alerts, _, err := toSession.CreateDeliveryServiceURISigningKeys(keys.XMLID, keys.URISigningKeys, client.RequestOptions{})
+		if err != nil {
+			log.Infof("error setting URI signing keys of Delivery Service %s: %v - alerts: %+v", keys.XMLID, err, alerts.Alerts)
+			return nil, err
+		}
+	}
+
+	// 鍵そのものは結果ファイルに書き出さない
+	return struct {
+		XMLID              string   `json:"xmlId"`
+		GenerateURLSigKeys bool     `json:"generateUrlSigKeys"`
+		URISigningIssuers  []string `json:"uriSigningIssuers,omitempty"`
+	}{keys.XMLID, keys.GenerateURLSigKeys, uriSigningIssuers(keys.URISigningKeys)}, nil
+}
+
+// uriSigningIssuers returns the issuers of the given URI signing keys, in order.
+func uriSigningIssuers(keys tc.JWKSMap) []string {
+	issuers := make([]string, 0, len(keys))
+	for issuer := range keys {
+		issuers = append(issuers, issuer)
+	}
+	sort.Strings(issuers)
+	return issuers
+}
+
+// decodeDivision decodes a Division from JSON.
+func decodeDivision(r io.Reader) (tc.Division, error) {
 	dec := json.NewDecoder(r)
 	var s tc.Division
 	err := dec.Decode(&s)
 	if err != nil {
 		log.Infof("error decoding Division: %s", err)
-		return err
+	}
+	return s, err
+}
+
+// 「/shared/enroller/divisions/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollDivision(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeDivision(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreateDivision(s, client.RequestOptions{})
@@ -383,32 +958,56 @@ func enrollDivision(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts {
 			if strings.Contains(alert.Text, "already exists") {
 				log.Infof("division %s already exists", s.Name)
-				return nil
+				return divisionResult(toSession, s.Name)
 			}
 		}
 		log.Infof("error creating Division: %v - alerts: %+v", err, alerts.Alerts)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
-	err = enc.Encode(&alerts)
+	if err = enc.Encode(&alerts); err != nil {
+		return nil, err
+	}
 
-	return err
+	return divisionResult(toSession, s.Name)
 }
 
-// 「/shared/enroller/origins/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollOrigin(toSession *session, r io.Reader) error {
+// divisionResult returns the Division named name as the result of enrolling it, if the session writes results.
+func divisionResult(toSession *session, name string) (interface{}, error) {
+	return toSession.lookupResult("Division '"+name+"'", func() (interface{}, tc.Alerts, error) {
+		opts := client.NewRequestOptions()
+		opts.QueryParameters.Set("name", name)
+		resp, _, err := toSession.GetDivisions(opts)
+		if len(resp.Response) < 1 {
+			return nil, resp.Alerts, err
+		}
+		return resp.Response[0], resp.Alerts, err
+	})
+}
 
+// decodeOrigin decodes an Origin from JSON, which must have a name.
+func decodeOrigin(r io.Reader) (tc.Origin, error) {
 	dec := json.NewDecoder(r)
 	var s tc.Origin
 	err := dec.Decode(&s)
 	if err != nil {
 		log.Infof("error decoding Origin: %v", err)
-		return err
+		return s, err
 	}
 	if s.Name == nil {
-		return errors.New("cannot create an Origin with no name")
+		return s, errors.New("cannot create an Origin with no name")
+	}
+	return s, nil
+}
+
+// 「/shared/enroller/origins/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollOrigin(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeOrigin(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreateOrigin(s, client.RequestOptions{})
@@ -416,31 +1015,48 @@ func enrollOrigin(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts.Alerts {
 			if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
 				log.Infof("Origin '%s' already exists", *s.Name)
-				return nil
+				return toSession.lookupResult("Origin '"+*s.Name+"'", func() (interface{}, tc.Alerts, error) {
+					opts := client.NewRequestOptions()
+					opts.QueryParameters.Set("name", *s.Name)
+					resp, _, err := toSession.GetOrigins(opts)
+					if len(resp.Response) < 1 {
+						return nil, resp.Alerts, err
+					}
+					return resp.Response[0], resp.Alerts, err
+				})
 			}
 		}
 		log.Infof("error creating Origin: %v - alerts: %+v", err, alerts.Alerts)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
 	err = enc.Encode(&alerts)
 
-	return err
+	return alerts.Response, err
 }
 
-// 「/shared/enroller/parameters/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollParameter(toSession *session, r io.Reader) error {
-
+// decodeParameters decodes Parameters from JSON.
+func decodeParameters(r io.Reader) ([]tc.Parameter, error) {
 	dec := json.NewDecoder(r)
 	var params []tc.Parameter
 	err := dec.Decode(&params)
 	if err != nil {
 		log.Infof("error decoding Parameter: %s\n", err)
-		return err
 	}
+	return params, err
+}
+
+// 「/shared/enroller/parameters/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollParameter(toSession *session, r io.Reader) (interface{}, error) {
 
+	params, err := decodeParameters(r)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []tc.Parameter{}
 	for _, p := range params {
 		eparam, err := toSession.getParameter(p, nil)
 		var alerts tc.Alerts
@@ -451,15 +1067,16 @@ func enrollParameter(toSession *session, r io.Reader) error {
 				log.Infof("error updating parameter %d: %v with %+v - alerts: %+v ", eparam.ID, err, p, alerts.Alerts)
 				break
 			}
+			eparam.Secure = p.Secure
 		} else {
 			alerts, _, err = toSession.CreateParameter(p, client.RequestOptions{})
 			if err != nil {
 				log.Infof("error creating parameter: %v from %+v - alerts: %+v", err, p, alerts.Alerts)
-				return err
+				return nil, err
 			}
 			eparam, err = toSession.getParameter(p, nil)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
 
@@ -469,7 +1086,7 @@ func enrollParameter(toSession *session, r io.Reader) error {
 			err = json.Unmarshal(p.Profiles, &profiles)
 			if err != nil {
 				log.Infof("%v", err)
-				return err
+				return nil, err
 			}
 
 			opts := client.NewRequestOptions()
@@ -477,10 +1094,10 @@ func enrollParameter(toSession *session, r io.Reader) error {
 				opts.QueryParameters.Set("name", n)
 				profiles, _, err := toSession.GetProfiles(opts)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				if len(profiles.Response) == 0 {
-					return errors.New("no profile with name " + n)
+					return nil, errors.New("no profile with name " + n)
 				}
 
 				pp := tc.ProfileParameterCreationRequest{ParameterID: eparam.ID, ProfileID: profiles.Response[0].ID}
@@ -505,20 +1122,32 @@ func enrollParameter(toSession *session, r io.Reader) error {
 		enc := json.NewEncoder(os.Stdout)
 		enc.SetIndent("", "  ")
 		err = enc.Encode(&alerts)
+		results = append(results, eparam)
 	}
-	return err
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
-// 「/shared/enroller/phys_locations/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollPhysLocation(toSession *session, r io.Reader) error {
-
+// decodePhysLocation decodes a Physical Location from JSON.
+func decodePhysLocation(r io.Reader) (tc.PhysLocation, error) {
 	dec := json.NewDecoder(r)
 	var s tc.PhysLocation
 	err := dec.Decode(&s)
 	if err != nil {
 		err = fmt.Errorf("error decoding Physical Location: %v", err)
 		log.Infoln(err)
-		return err
+	}
+	return s, err
+}
+
+// 「/shared/enroller/phys_locations/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollPhysLocation(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodePhysLocation(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreatePhysLocation(s, client.RequestOptions{})
@@ -526,30 +1155,54 @@ func enrollPhysLocation(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts {
 			if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
 				log.Infof("Physical Location %s already exists", s.Name)
-				return nil
+				return physLocationResult(toSession, s.Name)
 			}
 
 		}
 		err = fmt.Errorf("error creating Physical Location '%s': %v - alerts: %+v", s.Name, err, alerts.Alerts)
-		log.Infoln(err) return err
+		log.Infoln(err)
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
-	err = enc.Encode(&alerts)
+	if err = enc.Encode(&alerts); err != nil {
+		return nil, err
+	}
 
-	return err
+	return physLocationResult(toSession, s.Name)
 }
 
-// 「/shared/enroller/regions/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollRegion(toSession *session, r io.Reader) error {
+// physLocationResult returns the Physical Location named name as the result of enrolling it, if the session writes results.
+func physLocationResult(toSession *session, name string) (interface{}, error) {
+	return toSession.lookupResult("Physical Location '"+name+"'", func() (interface{}, tc.Alerts, error) {
+		opts := client.NewRequestOptions()
+		opts.QueryParameters.Set("name", name)
+		resp, _, err := toSession.GetPhysLocations(opts)
+		if len(resp.Response) < 1 {
+			return nil, resp.Alerts, err
+		}
+		return resp.Response[0], resp.Alerts, err
+	})
+}
 
+// decodeRegion decodes a Region from JSON.
+func decodeRegion(r io.Reader) (tc.Region, error) {
 	dec := json.NewDecoder(r)
 	var s tc.Region
 	err := dec.Decode(&s)
 	if err != nil {
 		log.Infof("error decoding Region: %s\n", err)
-		return err
+	}
+	return s, err
+}
+
+// 「/shared/enroller/regions/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollRegion(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeRegion(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreateRegion(s, client.RequestOptions{})
@@ -557,30 +1210,53 @@ func enrollRegion(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts {
 			if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
 				log.Infof("a Region named '%s' already exists", s.Name)
-				return nil
+				return regionResult(toSession, s.Name)
 			}
 		}
 		err = fmt.Errorf("error creating Region '%s': %v - alerts: %+v", s.Name, err, alerts.Alerts)
 		log.Infoln(err)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
-	err = enc.Encode(&alerts)
+	if err = enc.Encode(&alerts); err != nil {
+		return nil, err
+	}
 
-	return err
+	return regionResult(toSession, s.Name)
 }
 
-// 「/shared/enroller/statuses/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollStatus(toSession *session, r io.Reader) error {
+// regionResult returns the Region named name as the result of enrolling it, if the session writes results.
+func regionResult(toSession *session, name string) (interface{}, error) {
+	return toSession.lookupResult("Region '"+name+"'", func() (interface{}, tc.Alerts, error) {
+		opts := client.NewRequestOptions()
+		opts.QueryParameters.Set("name", name)
+		resp, _, err := toSession.GetRegions(opts)
+		if len(resp.Response) < 1 {
+			return nil, resp.Alerts, err
+		}
+		return resp.Response[0], resp.Alerts, err
+	})
+}
 
+// decodeStatus decodes a Status from JSON.
+func decodeStatus(r io.Reader) (tc.StatusNullable, error) {
 	dec := json.NewDecoder(r)
 	var s tc.StatusNullable
 	err := dec.Decode(&s)
 	if err != nil {
 		log.Infof("error decoding Status: %s", err)
-		return err
+	}
+	return s, err
+}
+
+// 「/shared/enroller/statuses/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollStatus(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeStatus(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreateStatus(s, client.RequestOptions{})
@@ -588,29 +1264,52 @@ func enrollStatus(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts {
 			if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
 				log.Infof("status %s already exists", *s.Name)
-				return nil
+				return statusResult(toSession, *s.Name)
 			}
 		}
 		err = fmt.Errorf("error creating Status: %v - alerts: %+v", err, alerts.Alerts)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
-	err = enc.Encode(&alerts)
+	if err = enc.Encode(&alerts); err != nil {
+		return nil, err
+	}
 
-	return err
+	return statusResult(toSession, *s.Name)
 }
 
-// 「/shared/enroller/tenants/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollTenant(toSession *session, r io.Reader) error {
+// statusResult returns the Status named name as the result of enrolling it, if the session writes results.
+func statusResult(toSession *session, name string) (interface{}, error) {
+	return toSession.lookupResult("Status '"+name+"'", func() (interface{}, tc.Alerts, error) {
+		opts := client.NewRequestOptions()
+		opts.QueryParameters.Set("name", name)
+		resp, _, err := toSession.GetStatuses(opts)
+		if len(resp.Response) < 1 {
+			return nil, resp.Alerts, err
+		}
+		return resp.Response[0], resp.Alerts, err
+	})
+}
 
+// decodeTenant decodes a Tenant from JSON.
+func decodeTenant(r io.Reader) (tc.Tenant, error) {
 	dec := json.NewDecoder(r)
 	var s tc.Tenant
 	err := dec.Decode(&s)
 	if err != nil {
 		log.Infof("error decoding Tenant: %s", err)
-		return err
+	}
+	return s, err
+}
+
+// 「/shared/enroller/tenants/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollTenant(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeTenant(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreateTenant(s, client.RequestOptions{})
@@ -618,31 +1317,47 @@ func enrollTenant(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts.Alerts {
 			if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
 				log.Infof("tenant %s already exists", s.Name)
-				return nil
+				return toSession.lookupResult("Tenant '"+s.Name+"'", func() (interface{}, tc.Alerts, error) {
+					opts := client.NewRequestOptions()
+					opts.QueryParameters.Set("name", s.Name)
+					resp, _, err := toSession.GetTenants(opts)
+					if len(resp.Response) < 1 {
+						return nil, resp.Alerts, err
+					}
+					return resp.Response[0], resp.Alerts, err
+				})
 			}
 		}
 		err = fmt.Errorf("error creating Tenant: %v - alerts: %+v", err, alerts.Alerts)
 		log.Infoln(err)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
 	err = enc.Encode(&alerts)
 
-	return err
+	return alerts.Response, err
 }
 
-// 「/shared/enroller/users/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollUser(toSession *session, r io.Reader) error {
-
+// decodeUser decodes a User from JSON.
+func decodeUser(r io.Reader) (tc.UserV4, error) {
 	dec := json.NewDecoder(r)
 	var s tc.UserV4
 	err := dec.Decode(&s)
 	log.Infof("User is %++v\n", s)
 	if err != nil {
 		log.Infof("error decoding User: %v", err)
-		return err
+	}
+	return s, err
+}
+
+// 「/shared/enroller/users/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollUser(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeUser(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreateUser(s, client.RequestOptions{})
@@ -650,25 +1365,31 @@ func enrollUser(toSession *session, r io.Reader) error {
 		for _, alert := range alerts.Alerts.Alerts {
 			if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
 				log.Infof("user %s already exists\n", s.Username)
-				return nil
+				return toSession.lookupResult("User '"+s.Username+"'", func() (interface{}, tc.Alerts, error) {
+					opts := client.NewRequestOptions()
+					opts.QueryParameters.Set("username", s.Username)
+					resp, _, err := toSession.GetUsers(opts)
+					if len(resp.Response) < 1 {
+						return nil, resp.Alerts, err
+					}
+					return resp.Response[0], resp.Alerts, err
+				})
 			}
 		}
 		err = fmt.Errorf("error creating User: %v - alerts: %+v", err, alerts.Alerts)
 		log.Infoln(err)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
 	err = enc.Encode(&alerts)
 
-	return err
+	return alerts.Response, err
 }
 
-// enrollProfile takes a json file and creates a Profile object using the TO API
-// 「/shared/enroller/profiles/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollProfile(toSession *session, r io.Reader) error {
-
+// decodeProfile decodes a Profile, with its Parameters, from JSON.
+func decodeProfile(r io.Reader) (tc.Profile, error) {
 	// JSONデコード
 	dec := json.NewDecoder(r)
 	var profile tc.Profile
@@ -677,7 +1398,17 @@ func enrollProfile(toSession *session, r io.Reader) error {
 	err := dec.Decode(&profile)
 	if err != nil {
 		log.Infof("error decoding Profile: %s\n", err)
-		return err
+	}
+	return profile, err
+}
+
+// enrollProfile takes a json file and creates a Profile object using the TO API
+// 「/shared/enroller/profiles/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollProfile(toSession *session, r io.Reader) (interface{}, error) {
+
+	profile, err := decodeProfile(r)
+	if err != nil {
+		return nil, err
 	}
 
 	// get a copy of the parameters
@@ -689,7 +1420,7 @@ func enrollProfile(toSession *session, r io.Reader) error {
 
 	if len(profile.Name) == 0 {
 		log.Infoln("missing name on profile")
-		return errors.New("missing name on profile")
+		return nil, errors.New("missing name on profile")
 	}
 
 	// /api/4.0/profiles?name=<profile.Name> (GET)から取得する
@@ -747,7 +1478,7 @@ func enrollProfile(toSession *session, r io.Reader) error {
 		if len(profiles.Response) == 0 {
 			err = fmt.Errorf("no results returned for getting profile ID from %+v", profile)
 			log.Infoln(err)
-			return err
+			return nil, err
 		}
 
 		// 取得したprofileを格納して、actionには作成したことを示す「creating」を登録する
@@ -767,7 +1498,7 @@ func enrollProfile(toSession *session, r io.Reader) error {
 	// 何かerrに引っ掛かったらエラーメッセージを出力して、returnする
 	if err != nil {
 		log.Infof("error "+action+" from %s: %s", err)
-		return err
+		return nil, err
 	}
 
 	// parametersは`json:params`の数によりイテレーションしている
@@ -786,28 +1517,13 @@ func enrollProfile(toSession *session, r io.Reader) error {
 	//			"secure": false,
 	//			"value": "STRING /opt/trafficserver/etc/trafficserver"
 	//		},
-	for _, p := range parameters {
-
-		var name, configFile, value string
-		var secure bool
-
-		// 「configFile」を取得する
-		if p.ConfigFile != nil {
-			configFile = *p.ConfigFile
-		}
-
-		// 「name」を取得する
-		if p.Name != nil {
-			name = *p.Name
-		}
-
-		// 「value」を取得する
-		if p.Value != nil {
-			value = *p.Value
-		}
+	params, duplicates := dedupProfileParameters(parameters)
+	for _, dup := range duplicates {
+		log.Warnf("profile %s has duplicate parameter %+v, ignoring the duplicate\n", profile.Name, dup)
+	}
 
-		// paramにtc.Parameter構造体をセット
-		param := tc.Parameter{ConfigFile: configFile, Name: name, Value: value, Secure: secure}
+	paramIDs := []int64{}
+	for _, param := range params {
 
 		// /api/4.0/parameters (GET) によりparameterを取得する
 		// https://traffic-control-cdn.readthedocs.io/en/latest/api/v4/parameters.html#get
@@ -842,27 +1558,18 @@ func enrollProfile(toSession *session, r io.Reader) error {
 			log.Infof("param ID not found for %v", eparam)
 			continue
 		}
+		paramIDs = append(paramIDs, int64(eparam.ID))
+	}
 
-		// GETリクエストによって取得したprofile情報にparam IDが1つもなければcontinueする
-		pp := tc.ProfileParameterCreationRequest{ProfileID: profile.ID, ParameterID: eparam.ID}
-
-		// ProfileにParameterを割り当てる
-		// /api/4.0/profileparameters (POST)
-		resp, _, err := toSession.CreateProfileParameter(pp, client.RequestOptions{})
+	// ProfileにParameterをまとめて割り当てる。既に割り当てられているParameterは無視される
+	// /api/4.0/profileparameter (POST)
+	if len(paramIDs) > 0 {
+		profileID := int64(profile.ID)
+		replace := false
+		pp := tc.PostProfileParam{ProfileID: &profileID, ParamIDs: &paramIDs, Replace: &replace}
+		resp, _, err := toSession.CreateProfileWithMultipleParameters(pp, client.RequestOptions{})
 		if err != nil {
-			// エラーの場合
-			found := false
-			for _, alert := range resp.Alerts {
-				if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
-					// すでに登録されていて、何かしらのエラーが表示されてしまった場合
-					found = true
-					break
-				}
-			}
-
-			if !found {
-				log.Infof("error creating profileparameter %+v: %v - alerts: %+v", pp, err, resp.Alerts)
-			}
+			log.Infof("error assigning parameters %v to profile %s: %v - alerts: %+v", paramIDs, profile.Name, err, resp.Alerts)
 		}
 	}
 
@@ -870,77 +1577,199 @@ func enrollProfile(toSession *session, r io.Reader) error {
 	enc.SetIndent("", "  ")
 	err = enc.Encode(&alerts)
 
-	return err
+	return profile, err
+}
+
+// dedupProfileParameters returns the parameters of a profile as Parameters, without any
+// parameters with the same name, config file, and value as an earlier one, which are returned as duplicates.
+func dedupProfileParameters(parameters []tc.ParameterNullable) ([]tc.Parameter, []tc.Parameter) {
+	type paramKey struct {
+		name       string
+		configFile string
+		value      string
+	}
+	seen := map[paramKey]struct{}{}
+	params := []tc.Parameter{}
+	duplicates := []tc.Parameter{}
+	for _, p := range parameters {
+
+		var name, configFile, value string
+		var secure bool
+
+		// 「configFile」を取得する
+		if p.ConfigFile != nil {
+			configFile = *p.ConfigFile
+		}
+
+		// 「name」を取得する
+		if p.Name != nil {
+			name = *p.Name
+		}
+
+		// 「value」を取得する
+		if p.Value != nil {
+			value = *p.Value
+		}
+
+		// paramにtc.Parameter構造体をセット
+		param := tc.Parameter{ConfigFile: configFile, Name: name, Value: value, Secure: secure}
+
+		key := paramKey{name: name, configFile: configFile, value: value}
+		if _, ok := seen[key]; ok {
+			duplicates = append(duplicates, param)
+			continue
+		}
+		seen[key] = struct{}{}
+		params = append(params, param)
+	}
+	return params, duplicates
+}
+
+// decodeServer decodes a Server from JSON, which must have a hostName.
+func decodeServer(r io.Reader) (tc.ServerV40, error) {
+	// JSONをデコードする
+	dec := json.NewDecoder(r)
+	var s tc.ServerV40
+	err := dec.Decode(&s)
+	if err != nil {
+		log.Infof("error decoding Server: %v", err)
+		return s, err
+	}
+
+	if s.HostName == nil {
+		err = errors.New("cannot enroll a Server with no hostName")
+		log.Infoln(err)
+		return s, err
+	}
+	return s, nil
 }
 
 // enrollServer takes a json file and creates a Server object using the TO API
 // 「/shared/enroller/servers/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollServer(toSession *session, r io.Reader) error {
+func enrollServer(toSession *session, r io.Reader) (interface{}, error) {
 
-	// JSONをデコードする
-	dec := json.NewDecoder(r)
-	var s tc.ServerV40
-	err := dec.Decode(&s)
+	s, err := decodeServer(r)
 	if err != nil {
-		log.Infof("error decoding Server: %v", err)
-		return err
+		return nil, err
 	}
 
-	alerts, _, err := toSession.CreateServer(s, client.RequestOptions{})
+	// 既存のサーバを /api/4.0/servers?hostName=<hostName> (GET) により取得する
+	opts := client.NewRequestOptions()
+	opts.QueryParameters.Set("hostName", *s.HostName)
+	if s.CDNID != nil {
+		opts.QueryParameters.Set("cdnId", strconv.Itoa(*s.CDNID))
+	}
+	resp, _, err := toSession.GetServers(opts)
 	if err != nil {
-		err = fmt.Errorf("error creating Server: %v - alerts: %+v", err, alerts.Alerts)
+		err = fmt.Errorf("getting Server '%s': %v - alerts: %+v", *s.HostName, err, resp.Alerts)
 		log.Infoln(err)
-		return err
+		return nil, err
+	}
+
+	var alerts tc.Alerts
+	action := "creating"
+	if len(resp.Response) > 0 && resp.Response[0].ID != nil {
+		// existing server -- update
+		// 既に存在するサーバであれば、新規作成ではなく更新処理とする
+		action = "updating"
+		alerts, _, err = toSession.UpdateServer(*resp.Response[0].ID, s, client.RequestOptions{})
+	} else {
+		alerts, _, err = toSession.CreateServer(s, client.RequestOptions{})
+	}
+	if err != nil {
+		err = fmt.Errorf("error %s Server '%s': %v - alerts: %+v", action, *s.HostName, err, alerts.Alerts)
+		log.Infoln(err)
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")  // 半角スペース2つをインデントに使用する
-	err = enc.Encode(&alerts)
+	if err = enc.Encode(&alerts); err != nil {
+		return nil, err
+	}
 
-	return err
+	// 作成または更新したサーバを取得する
+	return toSession.lookupResult("Server '"+*s.HostName+"' after "+action+" it", func() (interface{}, tc.Alerts, error) {
+		resp, _, err := toSession.GetServers(opts)
+		if len(resp.Response) < 1 {
+			return nil, resp.Alerts, err
+		}
+		return resp.Response[0], resp.Alerts, err
+	})
 }
 
-// enrollServerCapability takes a json file and creates a ServerCapability object using the TO API
-// 「/shared/enroller/server_capabilities/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollServerCapability(toSession *session, r io.Reader) error {
-
+// decodeServerCapability decodes a Server Capability from JSON.
+func decodeServerCapability(r io.Reader) (tc.ServerCapability, error) {
 	dec := json.NewDecoder(r)
 	var s tc.ServerCapability
 	err := dec.Decode(&s)
 	if err != nil {
 		err = fmt.Errorf("error decoding Server Capability: %v", err)
 		log.Infoln(err)
-		return err
+	}
+	return s, err
+}
+
+// enrollServerCapability takes a json file and creates a ServerCapability object using the TO API
+// 「/shared/enroller/server_capabilities/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollServerCapability(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeServerCapability(r)
+	if err != nil {
+		return nil, err
 	}
 
 	alerts, _, err := toSession.CreateServerCapability(s, client.RequestOptions{})
 	if err != nil {
+		for _, alert := range alerts.Alerts.Alerts {
+			if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
+				log.Infof("Server Capability '%s' already exists", s.Name)
+				return toSession.lookupResult("Server Capability '"+s.Name+"'", func() (interface{}, tc.Alerts, error) {
+					opts := client.NewRequestOptions()
+					opts.QueryParameters.Set("name", s.Name)
+					resp, _, err := toSession.GetServerCapabilities(opts)
+					if len(resp.Response) < 1 {
+						return nil, resp.Alerts, err
+					}
+					return resp.Response[0], resp.Alerts, err
+				})
+			}
+		}
 		err = fmt.Errorf("error creating Server Capability: %v - alerts: %+v", err, alerts.Alerts)
 		log.Infoln(err)
-		return err
+		return nil, err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
 	err = enc.Encode(&alerts)
 
-	return err
+	return alerts.Response, err
+}
+
+// decodeFederation decodes a Federation from JSON.
+func decodeFederation(r io.Reader) (tc.AllDeliveryServiceFederationsMapping, error) {
+	dec := json.NewDecoder(r)
+	var federation tc.AllDeliveryServiceFederationsMapping
+	err := dec.Decode(&federation)
+	if err != nil {
+		log.Infof("error decoding Server Capability: %s\n", err)
+	}
+	return federation, err
 }
 
 // enrollFederation takes a json file and creates a Federation object using the TO API.
 // It also assigns a Delivery Service, the CDN in a Box admin user, IPv4 resolvers,
 // and IPv6 resolvers to that Federation.
 // 「/shared/enroller/federations/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollFederation(toSession *session, r io.Reader) error {
+func enrollFederation(toSession *session, r io.Reader) (interface{}, error) {
 
-	dec := json.NewDecoder(r)
-	var federation tc.AllDeliveryServiceFederationsMapping
-	err := dec.Decode(&federation)
+	federation, err := decodeFederation(r)
 	if err != nil {
-		log.Infof("error decoding Server Capability: %s\n", err)
-		return err
+		return nil, err
 	}
 	opts := client.NewRequestOptions()
+	results := []tc.CDNFederation{}
 	for _, mapping := range federation.Mappings {
 		var cdnFederation tc.CDNFederation
 		var cdnName string
@@ -952,18 +1781,18 @@ func enrollFederation(toSession *session, r io.Reader) error {
 			if err != nil {
 				err = fmt.Errorf("getting Delivery Service '%s': %v - alerts: %+v", xmlID, err, deliveryServices.Alerts)
 				log.Infoln(err)
-				return err
+				return nil, err
 			}
 			if len(deliveryServices.Response) != 1 {
 				err = fmt.Errorf("wanted 1 Delivery Service with XMLID %s but received %d Delivery Services", xmlID, len(deliveryServices.Response))
 				log.Infoln(err)
-				return err
+				return nil, err
 			}
 			deliveryService := deliveryServices.Response[0]
 			if deliveryService.CDNName == nil || deliveryService.ID == nil || deliveryService.XMLID == nil {
 				err = fmt.Errorf("Delivery Service '%s' as returned from Traffic Ops had null or undefined CDN name and/or ID", xmlID)
 				log.Infoln(err)
-				return err
+				return nil, err
 			}
 			cdnName = *deliveryService.CDNName
 			cdnFederation = tc.CDNFederation{
@@ -974,18 +1803,18 @@ func enrollFederation(toSession *session, r io.Reader) error {
 			if err != nil {
 				err = fmt.Errorf("creating CDN Federation: %v - alerts: %+v", err, resp.Alerts)
 				log.Infoln(err)
-				return err
+				return nil, err
 			}
 			cdnFederation = resp.Response
 			if cdnFederation.ID == nil {
 				err = fmt.Errorf("federation returned from creation through Traffic Ops with null or undefined ID")
 				log.Infoln(err)
-				return err
+				return nil, err
 			}
 			if alerts, _, err := toSession.CreateFederationDeliveryServices(*cdnFederation.ID, []int{*deliveryService.ID}, true, client.RequestOptions{}); err != nil {
 				err = fmt.Errorf("assigning Delivery Service %s to Federation with ID %d: %v - alerts: %+v", xmlID, *cdnFederation.ID, err, alerts.Alerts)
 				log.Infoln(err)
-				return err
+				return nil, err
 			}
 		}
 		{
@@ -993,19 +1822,19 @@ func enrollFederation(toSession *session, r io.Reader) error {
 			if err != nil {
 				err = fmt.Errorf("getting the Current User: %v - alerts: %+v", err, user.Alerts)
 				log.Infoln(err)
-				return err
+				return nil, err
 			}
 			if user.Response.ID == nil {
 				err = errors.New("current user returned from Traffic Ops had null or undefined ID")
 				log.Infoln(err)
-				return err
+				return nil, err
 			}
 			resp, _, err := toSession.CreateFederationUsers(*cdnFederation.ID, []int{*user.Response.ID}, true, client.RequestOptions{})
 			if err != nil {
 				username := user.Response.Username
 				err = fmt.Errorf("assigning User '%s' to Federation with ID %d: %v - alerts: %+v", username, *cdnFederation.ID, err, resp.Alerts)
 				log.Infoln(err)
-				return err
+				return nil, err
 			}
 		}
 		var allResolverIDs []int
@@ -1015,7 +1844,7 @@ func enrollFederation(toSession *session, r io.Reader) error {
 			for index, resolvers := range resolverArrays {
 				resolverIDs, err := createFederationResolversOfType(toSession, resolverTypes[index], resolvers)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				allResolverIDs = append(allResolverIDs, resolverIDs...)
 			}
@@ -1023,21 +1852,14 @@ func enrollFederation(toSession *session, r io.Reader) error {
 		if resp, _, err := toSession.AssignFederationFederationResolver(*cdnFederation.ID, allResolverIDs, true, client.RequestOptions{}); err != nil {
 			err = fmt.Errorf("assigning Federation Resolvers to Federation with ID %d: %v - alerts: %+v", *cdnFederation.ID, err, resp.Alerts)
 			log.Infoln(err)
-			return err
-		}
-		opts.QueryParameters.Set("id", strconv.Itoa(*cdnFederation.ID))
-		response, _, err := toSession.GetCDNFederationsByName(cdnName, opts)
-		opts.QueryParameters.Del("id")
-		if err != nil {
-			err = fmt.Errorf("getting CDN Federation with ID %d: %v - alerts: %+v", *cdnFederation.ID, err, response.Alerts)
-			return err
+			return nil, err
 		}
-		if len(response.Response) < 1 {
-			err = fmt.Errorf("unable to GET a CDN Federation ID %d in CDN %s", *cdnFederation.ID, cdnName)
-			log.Infoln(err)
-			return err
+		if confirmed, err := getCreatedCDNFederation(toSession, cdnName, *cdnFederation.ID); err != nil {
+			// the federation was created, so don't fail just because it can't be read back yet
+			log.Warnf("confirming creation of CDN Federation with ID %d, using the created federation: %v\n", *cdnFederation.ID, err)
+		} else {
+			cdnFederation = confirmed
 		}
-		cdnFederation = response.Response[0]
 
 		enc := json.NewEncoder(os.Stdout)
 		enc.SetIndent("", "  ")
@@ -1045,10 +1867,42 @@ func enrollFederation(toSession *session, r io.Reader) error {
 		if err != nil {
 			err = fmt.Errorf("encoding CDNFederation %s with ID %d: %v", *cdnFederation.CName, *cdnFederation.ID, err)
 			log.Infoln(err)
-			return err
+			return nil, err
+		}
+		results = append(results, cdnFederation)
+	}
+	return results, err
+}
+
+// federationConfirmTries is the number of times a created CDN Federation is read back before giving up.
+const federationConfirmTries = 5
+
+// federationConfirmBackoff is the wait before reading back a created CDN Federation again, doubled after each try.
+const federationConfirmBackoff = 200 * time.Millisecond
+
+// getCreatedCDNFederation reads back the CDN Federation with the given ID, which was just created in the CDN,
+// retrying with backoff if the read fails or is empty, because Traffic Ops may not return it immediately.
+func getCreatedCDNFederation(toSession *session, cdnName string, id int) (tc.CDNFederation, error) {
+	opts := client.NewRequestOptions()
+	opts.QueryParameters.Set("id", strconv.Itoa(id))
+	backoff := federationConfirmBackoff
+	var err error
+	for try := 1; ; try++ {
+		response, _, getErr := toSession.GetCDNFederationsByName(cdnName, opts)
+		if getErr != nil {
+			err = fmt.Errorf("getting CDN Federation with ID %d: %v - alerts: %+v", id, getErr, response.Alerts)
+		} else if len(response.Response) < 1 {
+			err = fmt.Errorf("unable to GET a CDN Federation ID %d in CDN %s", id, cdnName)
+		} else {
+			return response.Response[0], nil
 		}
+		if try >= federationConfirmTries {
+			return tc.CDNFederation{}, fmt.Errorf("giving up after %d tries: %v", try, err)
+		}
+		log.Infof("%v, retrying in %v\n", err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
 	}
-	return err
 }
 
 // createFederationResolversOfType creates Federation Resolvers of either RESOLVE4 type or RESOLVE6 type.
@@ -1089,10 +1943,9 @@ func createFederationResolversOfType(toSession *session, resolverTypeName tc.Fed
 	return resolverIDs, nil
 }
 
-// enrollServerServerCapability takes a json file and creates a ServerServerCapability object using the TO API
-// 「/shared/enroller/server_server_capabilities/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
-func enrollServerServerCapability(toSession *session, r io.Reader) error {
-
+// decodeServerServerCapability decodes the assignment of a Server Capability to a server from JSON,
+// which must have the server's hostName.
+func decodeServerServerCapability(r io.Reader) (tc.ServerServerCapability, error) {
 	// JSONデコード
 	dec := json.NewDecoder(r)
 
@@ -1102,13 +1955,23 @@ func enrollServerServerCapability(toSession *session, r io.Reader) error {
 	if err != nil {
 		err = fmt.Errorf("error decoding Server/Capability relationship: %s", err)
 		log.Infoln(err)
-		return err
+		return s, err
 	}
 
 	// s.Serverは「json:serverHostName」の値となります。この値がセットされていなければエラーになります。
 	if s.Server == nil {
-		err = errors.New("server/Capability relationship did not specify a server")
-		return err
+		return s, errors.New("server/Capability relationship did not specify a server")
+	}
+	return s, nil
+}
+
+// enrollServerServerCapability takes a json file and creates a ServerServerCapability object using the TO API
+// 「/shared/enroller/server_server_capabilities/」配下のファイルが生成された場合(またはそれに相当するHTTPエンドポイントにリクエストされた場合)
+func enrollServerServerCapability(toSession *session, r io.Reader) (interface{}, error) {
+
+	s, err := decodeServerServerCapability(r)
+	if err != nil {
+		return nil, err
 	}
 
 	// 「/api/4.0/servers?hostName=<s.Server> (GET)」
@@ -1117,21 +1980,21 @@ func enrollServerServerCapability(toSession *session, r io.Reader) error {
 	if err != nil {
 		err = fmt.Errorf("getting server '%s': %v - alerts: %+v", *s.Server, err, resp.Alerts)
 		log.Infoln(err)
-		return err
+		return nil, err
 	}
 
 	// Serverが何も取得できない場合にはエラー
 	if len(resp.Response) < 1 {
 		err = fmt.Errorf("could not find Server %s", *s.Server)
 		log.Infoln(err.Error())
-		return err
+		return nil, err
 	}
 
 	// /serversエンドポイントにhostNameクエリパラメータを指定したのに複数取れるのはおかしいのでエラー
 	if len(resp.Response) > 1 {
 		err = fmt.Errorf("found more than 1 Server with hostname %s", *s.Server)
 		log.Infoln(err.Error())
-		return err
+		return nil, err
 	}
 
 	// レスポンスからサーバを識別するIDを取得する。この値は次の「/api/4.0/server_server_capabilities」へのjson中に必要な値なので取得している
@@ -1146,9 +2009,16 @@ func enrollServerServerCapability(toSession *session, r io.Reader) error {
 	//
 	alerts, _, err := toSession.CreateServerServerCapability(s, client.RequestOptions{})
 	if err != nil {
+		// 既にサーバにcapabilityが割り当てられている場合は成功として扱う
+		for _, alert := range alerts.Alerts {
+			if alert.Level == tc.ErrorLevel.String() && strings.Contains(alert.Text, "already exists") {
+				log.Infof("Server '%s' already has the Server Capability", *s.Server)
+				return s, nil
+			}
+		}
 		err = fmt.Errorf("error creating Server Server Capability: %v - alerts: %+v", err, alerts.Alerts)
 		log.Infoln(err.Error())
-		return err
+		return nil, err
 	}
 
 	// 上記APIから取得したレスポンスである標準出力をそのままjsonに加工して、レスポンスとして応答する
@@ -1156,21 +2026,137 @@ func enrollServerServerCapability(toSession *session, r io.Reader) error {
 	enc.SetIndent("", "  ")  // indentはスペース2つ
 	err = enc.Encode(&alerts)
 
-	return err
+	return s, err
+}
+
+// suffixes of the files in the watched directories
+const (
+	processedSuffix = ".processed"
+	rejectedSuffix  = ".rejected"
+	retrySuffix     = ".retry"
+	resultSuffix    = ".result.json"
+)
+
+// defaultIgnorePatterns is the default glob patterns of the names of files which are ignored
+// in the watched directories: hidden files, and editor swap and backup files.
+const defaultIgnorePatterns = ".*,*~,*.swp,*.swx,*.tmp"
+
+// jsonExtension is the extension of the names of the files which are processed, unless all files are.
+const jsonExtension = ".json"
+
+// ignoreRules decides which files in the watched directories are ignored, rather than processed and rejected.
+type ignoreRules struct {
+	// patterns is the glob patterns of the names of files to ignore, e.g. editor swap files.
+	patterns []string
+	// allFiles is whether files whose names don't end in .json are processed too, rather than ignored.
+	allFiles bool
+}
+
+// maxEmptyTries is the number of times an empty file is read before it is rejected.
+const maxEmptyTries = 10
+
+// maxDependencyTries is the number of times a file which references objects that don't exist yet is
+// processed before it is rejected, waiting dependencyRetryDelay between tries.
+const maxDependencyTries = 10
+
+// dependencyRetryDelay is the time to wait before retrying a file which references objects that don't exist yet.
+const dependencyRetryDelay = 3 * time.Second
+
+var originalNameRegex = regexp.MustCompile(`(\.retry)*$`)
+
+// enrollKind is a kind of object the enroller creates, with the function which creates it from JSON.
+type enrollKind struct {
+	// name is the name of the watched directory and HTTP endpoint of the kind.
+	name   string
+	enroll func(*session, io.Reader) (interface{}, error)
+	// validate decodes an object of the kind without enrolling it, for --validate-only.
+	validate func(io.Reader) (validated, error)
+}
+
+// enrollKinds is every kind of object the enroller creates, in dependency order: existing files are
+// processed in this order, so objects are created before the objects which reference them.
+// A new kind must be inserted after every kind it references.
+var enrollKinds = []enrollKind{
+	{"types", enrollType, validateType},
+	{"cdns", enrollCDN, validateCDN},
+	{"divisions", enrollDivision, validateDivision},
+	{"regions", enrollRegion, validateRegion},
+	{"phys_locations", enrollPhysLocation, validatePhysLocation},
+	{"statuses", enrollStatus, validateStatus},
+	{"tenants", enrollTenant, validateTenant},
+	{"users", enrollUser, validateUser},
+	{"cachegroups", enrollCachegroup, validateCachegroup},
+	{"asns", enrollASN, validateASN},
+	{"profiles", enrollProfile, validateProfile},
+	{"parameters", enrollParameter, validateParameters},
+	{"server_capabilities", enrollServerCapability, validateServerCapability},
+	{"servers", enrollServer, validateServer},
+	{"server_server_capabilities", enrollServerServerCapability, validateServerServerCapability},
+	{"topologies", enrollTopology, validateTopology},
+	{"service_categories", enrollServiceCategory, validateServiceCategory},
+	{"deliveryservices", enrollDeliveryService, validateDeliveryService},
+	{"deliveryservices_required_capabilities", enrollDeliveryServicesRequiredCapability, validateDeliveryServicesRequiredCapability},
+	{"deliveryservice_servers", enrollDeliveryServiceServer, validateDeliveryServiceServers},
+	{"deliveryservice_regexes", enrollDeliveryServiceRegex, validateDeliveryServiceRegexes},
+	{"url_sig_keys", enrollURLSigKeys, validateURLSigKeys},
+	{"origins", enrollOrigin, validateOrigin},
+	{"federations", enrollFederation, validateFederation},
+}
+
+// newDispatcher returns a map of the names of the kinds to their enroll functions.
+func newDispatcher(kinds []enrollKind) map[string]func(*session, io.Reader) (interface{}, error) {
+	dispatcher := make(map[string]func(*session, io.Reader) (interface{}, error), len(kinds))
+	for _, kind := range kinds {
+		dispatcher[kind.name] = kind.enroll
+	}
+	return dispatcher
 }
 
 type dirWatcher struct {
 	*fsnotify.Watcher   // TODO: これにはなぜ型がないのか?
 	TOSession *session
-	watched   map[string]func(toSession *session, fn string) error
+	watched   map[string]func(toSession *session, fn string) (interface{}, error)
+	// writeResults is whether to write the objects created from each processed file to a results file.
+	writeResults bool
+	// ignore decides which files to ignore, e.g. editor swap files.
+	ignore ignoreRules
+	// order is the names of the watched directories, in the order existing files in them are processed.
+	order []string
+	// templater renders the files before they're decoded, if templating is enabled.
+	templater *templater
+
+	// mutex guards retries, inProgress, waiting, and rejected, since files are processed both by the watcher and the startup scan.
+	mutex sync.Mutex
+	// retries is the number of times each file has been retried, because it was empty or referenced
+	// objects which didn't exist yet, which is saved across restarts.
+	retries *retryState
+	// inProgress is the set of files currently being processed.
+	inProgress map[string]struct{}
+	// waiting is the set of files waiting to be retried, because they referenced objects which didn't exist yet.
+	waiting map[string]struct{}
+	// rejected is the number of files which have been rejected.
+	rejected int
 }
 
 // ファイルが追加された際にfsnotifyによる検知が行われます。
 // ディレクトリ配下毎に呼び出されるハンドラが異なります。
-func newDirWatcher(toSession *session) (*dirWatcher, error) {
+func newDirWatcher(toSession *session, writeResults bool, ignore ignoreRules, tmpl *templater, retries *retryState) (*dirWatcher, error) {
+
+	// the watcher's own copy of the session looks up the objects to write to results files; the HTTP
+	// server shares the Traffic Ops client, but discards what it enrolls, so it doesn't look them up
+	watchSession := *toSession
+	watchSession.writeResults = writeResults
 
 	var err error
-	var dw dirWatcher
+	dw := dirWatcher{
+		TOSession:    &watchSession,
+		writeResults: writeResults,
+		ignore:       ignore,
+		templater:    tmpl,
+		retries:      retries,
+		inProgress:   map[string]struct{}{},
+		waiting:      map[string]struct{}{},
+	}
 
 	// fsnotify.NewWatcherはファイル変更を検知する為の仕組みです。下記でwatcherを起動しています
 	// https://qiita.com/cotrpepe/items/3877a8d803f45c6f1171#events
@@ -1179,20 +2165,10 @@ func newDirWatcher(toSession *session) (*dirWatcher, error) {
 		return nil, err
 	}
 
-	dw.watched = make(map[string]func(toSession *session, fn string) error)
+	dw.watched = make(map[string]func(toSession *session, fn string) (interface{}, error))
 
 	// goroutineとして別スレッドにて起動されます。
 	go func() {
-		const (
-			processed = ".processed"
-			rejected  = ".rejected"
-			retry     = ".retry"
-		)
-		originalNameRegex := regexp.MustCompile(`(\.retry)*$`)
-
-		emptyCount := map[string]int{}
-		const maxEmptyTries = 10
-
 		// このgoroutineはチャネル受信処理の無限ループとなっています。
 		// 実際にここがenrollerのメイン処理となります
 		for {
@@ -1214,90 +2190,290 @@ func newDirWatcher(toSession *session) (*dirWatcher, error) {
 					continue
 				}
 
-				// skip already processed files
-				// ファイル生成を検知したファイル名(event.Name)のsuffixの値として「.processed」や「.rejected」であれば、処理をskipする
-				if strings.HasSuffix(event.Name, processed) || strings.HasSuffix(event.Name, rejected) {
-					continue
-				}
-
-				// ファイル生成を検知したファイル名のstatが取れないか、ディレクトリであれば処理をskipする
-				i, err := os.Stat(event.Name)
-				if err != nil || i.IsDir() {
-					log.Infoln("skipping " + event.Name)
-					continue
-				}
-				log.Infoln("new file :", event.Name)
+				// Sleep for 100 milliseconds so that the file content is probably there when the directory watcher
+				// sees the file
+				// 100msだけ待っても、見れるファイルを確認したいため。100msだけ待つ
+				dw.processFile(event.Name, 100*time.Millisecond)
 
-				// what directory is the file in?  Invoke the matching func
-				dir := filepath.Base(filepath.Dir(event.Name))
-				suffix := rejected
+			// 監視中にエラーが発生した場合にチャネル受信します
+			case err, ok := <-dw.Errors:
+				log.Infof("error from fsnotify: ok? %v;  error: %v\n", ok, err)
+				continue
+			}
+		}
+	}()
 
-				// (REF1)の箇所で定義された無名関数がfに入ります。
-				if f, ok := dw.watched[dir]; ok {
+	return &dw, err
+}
 
-					// ログ出力の為の処理
-					t := filepath.Base(dir)
-					log.Infoln("creating " + t + " from " + event.Name)
+// isUnprocessed returns whether fn is the name of a file which should be processed,
+// rather than one already marked processed or rejected, or a result file.
+func isUnprocessed(fn string) bool {
+	return !strings.HasSuffix(fn, processedSuffix) && !strings.HasSuffix(fn, rejectedSuffix) && !strings.HasSuffix(fn, resultSuffix)
+}
 
-					// Sleep for 100 milliseconds so that the file content is probably there when the directory watcher
-					// sees the file
-					// 100msだけ待っても、見れるファイルを確認したいため。100msだけ待つ
-					time.Sleep(100 * time.Millisecond)
+// isIgnored returns whether the name of the file fn matches any of the ignore patterns or, unless all
+// files are processed, doesn't end in .json, disregarding the suffixes of retries.
+func (dw *dirWatcher) isIgnored(fn string) bool {
+	name := filepath.Base(fn)
+	for _, pattern := range dw.ignore.patterns {
+		if match, _ := filepath.Match(pattern, name); match {
+			return true
+		}
+	}
+	if !dw.ignore.allFiles {
+		return !strings.EqualFold(filepath.Ext(originalNameRegex.ReplaceAllString(name, "")), jsonExtension)
+	}
+	return false
+}
 
-					// (REF1)の箇所で定義された無名関数がfに入ります。
-					// event.Nameには無名関数が入るようです
-					err := f(toSession, event.Name)
+// parseIgnorePatterns parses a comma-separated list of file name glob patterns.
+func parseIgnorePatterns(patterns string) ([]string, error) {
+	ignore := []string{}
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern '%s': %v", pattern, err)
+		}
+		ignore = append(ignore, pattern)
+	}
+	return ignore, nil
+}
 
-					// If a file is empty, try reading from it 10 times before giving up on that file
-					if err == io.EOF {
-						originalName := originalNameRegex.ReplaceAllString(event.Name, "")
-						if _, exists := emptyCount[originalName]; !exists {
-							emptyCount[originalName] = 0
-						}
+// processFile creates the objects in the file fn with the function of its directory,
+// after waiting wait for its content to be written, and marks it processed or rejected.
+func (dw *dirWatcher) processFile(fn string, wait time.Duration) {
+	// skip already processed files
+	// ファイル名のsuffixの値として「.processed」や「.rejected」であれば、処理をskipする
+	if !isUnprocessed(fn) {
+		return
+	}
+	if dw.isIgnored(fn) {
+		log.Infoln("ignoring " + fn)
+		return
+	}
+
+	// skip files already being processed, e.g. by the startup scan
+	dw.mutex.Lock()
+	if _, ok := dw.inProgress[fn]; ok {
+		dw.mutex.Unlock()
+		return
+	}
+	if _, ok := dw.waiting[fn]; ok {
+		dw.mutex.Unlock()
+		return
+	}
+	dw.inProgress[fn] = struct{}{}
+	dw.mutex.Unlock()
+	defer func() {
+		dw.mutex.Lock()
+		delete(dw.inProgress, fn)
+		dw.mutex.Unlock()
+	}()
 
-						emptyCount[originalName]++
-						log.Infof("empty json object %s: %s\ntried file %d out of %d times", originalName, err.Error(), emptyCount[originalName], maxEmptyTries)
-						if emptyCount[originalName] < maxEmptyTries {
-							newName := event.Name + retry
-							if err := os.Rename(event.Name, newName); err != nil {
-								log.Infof("error renaming %s to %s: %s", event.Name, newName, err)
-							}
-							continue
-						}
+	// ファイル名のstatが取れないか、ディレクトリであれば処理をskipする
+	i, err := os.Stat(fn)
+	if err != nil || i.IsDir() {
+		log.Infoln("skipping " + fn)
+		return
+	}
+	log.Infoln("new file :", fn)
+
+	// what directory is the file in?  Invoke the matching func
+	dir := filepath.Base(filepath.Dir(fn))
+	suffix := rejectedSuffix
+
+	// (REF1)の箇所で定義された無名関数がfに入ります。
+	if f, ok := dw.watched[dir]; ok {
+
+		// ログ出力の為の処理
+		t := filepath.Base(dir)
+		log.Infoln("creating " + t + " from " + fn)
+
+		time.Sleep(wait)
+
+		// (REF1)の箇所で定義された無名関数がfに入ります。
+		obj, err := f(dw.TOSession, fn)
+
+		// If a file is empty, try reading from it 10 times before giving up on that file
+		if err == io.EOF {
+			originalName := originalNameRegex.ReplaceAllString(fn, "")
+			dw.mutex.Lock()
+			tries := dw.retries.increment(originalName)
+			dw.mutex.Unlock()
+			log.Infof("empty json object %s: %s\ntried file %d out of %d times", originalName, err.Error(), tries, maxEmptyTries)
+			if tries < maxEmptyTries {
+				newName := fn + retrySuffix
+				if err := os.Rename(fn, newName); err != nil {
+					log.Infof("error renaming %s to %s: %s", fn, newName, err)
+				}
+				return
+			}
 
-					}
+		}
 
-					if err != nil {
-						log.Infof("error creating %s from %s: %s\n", dir, event.Name, err.Error())
-					} else {
-						suffix = processed
-					}
+		// 依存するオブジェクトがまだ存在しなければ、しばらく待ってからリトライする
+		if errors.Is(err, errMissingDependency) {
+			originalName := originalNameRegex.ReplaceAllString(fn, "")
+			dw.mutex.Lock()
+			tries := dw.retries.increment(originalName)
+			dw.mutex.Unlock()
+			log.Infof("%s: %s\ntried file %d out of %d times", originalName, err.Error(), tries, maxDependencyTries)
+			if tries < maxDependencyTries {
+				dw.retryLater(fn, dependencyRetryDelay)
+				return
+			}
+		}
 
-				} else {
-					// dw.watched[dir]から無名関数情報が取得できなかった場合
-					log.Infof("no method for creating %s\n", dir)
+		if err != nil {
+			log.Infof("error creating %s from %s: %s\n", dir, fn, err.Error())
+		} else {
+			suffix = processedSuffix
+			// write the result before renaming, so it's complete when the processed file appears
+			if dw.writeResults && obj != nil {
+				if err := writeResult(fn+resultSuffix, obj); err != nil {
+					log.Infof("error writing result of %s: %s\n", fn, err.Error())
 				}
+			}
+		}
 
-				// rename the file indicating if processed or rejected
-				// suffixに「.processed」か「.rejected」を付与する
-				err = os.Rename(event.Name, event.Name+suffix)
-				if err != nil {
-					log.Infof("error renaming %s to %s: %s\n", event.Name, event.Name+suffix, err.Error())
-				}
+	} else {
+		// dw.watched[dir]から無名関数情報が取得できなかった場合
+		log.Infof("no method for creating %s\n", dir)
+	}
 
-			// 監視中にエラーが発生した場合にチャネル受信します
-			case err, ok := <-dw.Errors:
-				log.Infof("error from fsnotify: ok? %v;  error: %v\n", ok, err)
+	if suffix == rejectedSuffix {
+		dw.mutex.Lock()
+		dw.rejected++
+		dw.mutex.Unlock()
+	}
+
+	// rename the file indicating if processed or rejected
+	// suffixに「.processed」か「.rejected」を付与する
+	err = os.Rename(fn, fn+suffix)
+	if err != nil {
+		log.Infof("error renaming %s to %s: %s\n", fn, fn+suffix, err.Error())
+	}
+
+	// 処理済みのファイルのリトライ回数は不要なので状態ファイルから削除する
+	dw.mutex.Lock()
+	dw.retries.clear(originalNameRegex.ReplaceAllString(fn, ""))
+	dw.mutex.Unlock()
+}
+
+// retryLater renames the file fn with the retry suffix after delay, so the watcher processes it again.
+// Until then, the file isn't processed by the startup scan.
+func (dw *dirWatcher) retryLater(fn string, delay time.Duration) {
+	dw.mutex.Lock()
+	dw.waiting[fn] = struct{}{}
+	dw.mutex.Unlock()
+	time.AfterFunc(delay, func() {
+		newName := fn + retrySuffix
+		if err := os.Rename(fn, newName); err != nil {
+			log.Infof("error renaming %s to %s: %s", fn, newName, err)
+		}
+		dw.mutex.Lock()
+		delete(dw.waiting, fn)
+		dw.mutex.Unlock()
+	})
+}
+
+// scanExisting processes the files which already exist in the watched directories of watchDir,
+// since the watcher only sees files created after it starts. Directories are processed one at a
+// time, in dependency order, so referenced objects are created first. Within a directory, files are
+// processed in name order, by at most concurrency files at once, starting at most one file per interval.
+func (dw *dirWatcher) scanExisting(watchDir string, concurrency int, interval time.Duration) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	for _, dir := range dw.order {
+		path := filepath.Join(watchDir, dir)
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			log.Infof("error scanning %s: %s\n", path, err.Error())
+			continue
+		}
+
+		sem := make(chan struct{}, concurrency)
+		wg := sync.WaitGroup{}
+		started := 0
+		for _, entry := range entries {
+			if entry.IsDir() || !isUnprocessed(entry.Name()) || dw.isIgnored(entry.Name()) {
 				continue
 			}
+			if started > 0 && interval > 0 {
+				time.Sleep(interval)
+			}
+			started++
+			fn := filepath.Join(path, entry.Name())
+			log.Infoln("found existing file " + fn)
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				dw.processFile(fn, 0)
+			}()
 		}
-	}()
+		wg.Wait()
+	}
+	log.Infoln("finished processing existing files in " + watchDir)
+}
 
-	return &dw, err
+// hasPending returns whether any files in the watched directories of watchDir are waiting to be processed or being processed.
+func (dw *dirWatcher) hasPending(watchDir string) bool {
+	dw.mutex.Lock()
+	inProgress := len(dw.inProgress)
+	dw.mutex.Unlock()
+	if inProgress > 0 {
+		return true
+	}
+	for _, dir := range dw.order {
+		entries, err := ioutil.ReadDir(filepath.Join(watchDir, dir))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isUnprocessed(entry.Name()) && !dw.isIgnored(entry.Name()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rejectedCount returns the number of files which have been rejected.
+func (dw *dirWatcher) rejectedCount() int {
+	dw.mutex.Lock()
+	defer dw.mutex.Unlock()
+	return dw.rejected
+}
+
+// runBatch processes the files which already exist in the watched directories of watchDir in dependency
+// order, and waits for any retries of empty files by the watcher to finish.
+// Returns the number of files which were rejected.
+func (dw *dirWatcher) runBatch(watchDir string, concurrency int, interval time.Duration) int {
+	dw.scanExisting(watchDir, concurrency, interval)
+	for dw.hasPending(watchDir) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	return dw.rejectedCount()
+}
+
+// writeResult writes the object created or updated from an enrolled file, including its Traffic Ops-assigned ID, as JSON.
+func writeResult(fn string, obj interface{}) error {
+	bts, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding result: %v", err)
+	}
+	return ioutil.WriteFile(fn, bts, 0644)
 }
 
 // watch starts f when a new file is created in dir
-func (dw *dirWatcher) watch(watchdir, t string, f func(*session, io.Reader) error) {
+func (dw *dirWatcher) watch(watchdir, t string, f func(*session, io.Reader) (interface{}, error)) {
 
 	// 「/shared/enroller/」+ t なので、tは/shared/enroller/配下のwatchしたいディレクトリとなります。
 	// tの値はtopologies, tenants, users, types, server_server_capabilities, etc... などの値になります
@@ -1318,38 +2494,103 @@ func (dw *dirWatcher) watch(watchdir, t string, f func(*session, io.Reader) erro
 	dw.Add(dir)
 
 	// ディレクトリが検知された際に実行したい処理 (REF1)
-	dw.watched[t] = func(toSession *session, fn string) error {
+	dw.watched[t] = func(toSession *session, fn string) (interface{}, error) {
 		fh, err := os.Open(fn)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		defer log.Close(fh, "could not close file")
-		return f(toSession, fh)
+		if dw.templater == nil {
+			return f(toSession, fh)
+		}
+		rendered, err := dw.templater.renderReader(fn, fh)
+		if err != nil {
+			return nil, err
+		}
+		return f(toSession, rendered)
 	}
 }
 
 // 指定されたディレクトリのwatcherを開始する
-func startWatching(watchDir string, toSession *session, dispatcher map[string]func(*session, io.Reader) error) (*dirWatcher, error) {
+func startWatching(watchDir string, toSession *session, kinds []enrollKind, writeResults bool, ignore ignoreRules, tmpl *templater, retryStateFile string) (*dirWatcher, error) {
+
+	// リトライ回数は再起動後も引き継ぐため、状態ファイルから読み込む
+	if retryStateFile != "" && !filepath.IsAbs(retryStateFile) {
+		retryStateFile = filepath.Join(watchDir, retryStateFile)
+	}
+	retries, err := loadRetryState(retryStateFile)
+	if err != nil {
+		log.Infof("%s, starting with no retries\n", err.Error())
+		retries = &retryState{path: retryStateFile, counts: map[string]int{}}
+	}
 
 	// watch for file creation in directories
 	// watcherの起動を行います。なお、fsnotifyのチャネル受信については下記でgoroutineが起動しています
-	dw, err := newDirWatcher(toSession)
+	dw, err := newDirWatcher(toSession, writeResults, ignore, tmpl, retries)
 
 	// watcher起動に成功したら
 	if err == nil {
 		// dispatchで定義されたそれぞれのエンドポイント「/shared/enroller/<name>/」にファイルが追加されたら、それぞれのハンドラを実行するように登録しています
-		for d, f := range dispatcher {
-			dw.watch(watchDir, d, f)
+		for _, kind := range kinds {
+			dw.watch(watchDir, kind.name, kind.enroll)
+			dw.order = append(dw.order, kind.name)
 		}
 	}
 
 	return dw, err
 }
 
+// httpServerConfig is the configuration of the enroller HTTP server.
+type httpServerConfig struct {
+	// MaxBodyBytes is the maximum size of a request body. Larger requests are rejected with a 413.
+	MaxBodyBytes int64
+	// ReadTimeout is the maximum time to read a request, including its body. Slower requests are rejected with a 408.
+	ReadTimeout time.Duration
+	// WriteTimeout is the maximum time to handle a request, including the Traffic Ops requests made for it.
+	WriteTimeout time.Duration
+}
+
+// errBodyTooLarge is the text of the error returned by http.MaxBytesReader when the limit is exceeded.
+const errBodyTooLarge = "http: request body too large"
+
+// bodyReader wraps a request body, recording the first error reading it other than io.EOF,
+// so the handler can tell whether an enroll function failed because of the request itself.
+type bodyReader struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// enrollHandler returns a handler which creates the object in the request body with f,
+// limiting the body to maxBodyBytes.
+func enrollHandler(toSession *session, f func(*session, io.Reader) (interface{}, error), maxBodyBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := &bodyReader{ReadCloser: http.MaxBytesReader(w, r.Body, maxBodyBytes)}
+		defer log.Close(body, "could not close reader")
+		// 「/api/4.0/deliveryservices_required_capabilities」の場合にはenrollDeliveryServicesRequiredCapabilityハンドラが実行される
+		if _, err := f(toSession, body); err != nil && body.err != nil {
+			if netErr, ok := body.err.(net.Error); ok && netErr.Timeout() {
+				log.Infof("timed out reading request to %s: %v\n", r.URL.Path, body.err)
+				w.WriteHeader(http.StatusRequestTimeout)
+			} else if body.err.Error() == errBodyTooLarge {
+				log.Infof("request to %s larger than %d bytes\n", r.URL.Path, maxBodyBytes)
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+			}
+		}
+	}
+}
+
 // enrollerとしてHTTPサーバによるエンドポイントを提供する。
 // watcherと同様の数の機能をHTTPエンドポイントとして提供する。
 // CDN-in-a-boxではデフォルトで--portオプションを指定していないので、その場合にはHTTPサーバは起動されない。
-func startServer(httpPort string, toSession *session, dispatcher map[string]func(*session, io.Reader) error) error {
+func startServer(httpPort string, toSession *session, dispatcher map[string]func(*session, io.Reader) (interface{}, error), cfg httpServerConfig) error {
 
 	// ベースとなるエンドポイント
 	baseEP := "/api/4.0/"
@@ -1357,19 +2598,18 @@ func startServer(httpPort string, toSession *session, dispatcher map[string]func
 	// dispatcherで定義された値を「/api/4.0/<追加>」としてエンドポイントが定義される
 	// たとえば「/api/4.0/deliveryservices_required_capabilities」
 	for d, f := range dispatcher {
-		http.HandleFunc(baseEP+d, func(w http.ResponseWriter, r *http.Request) {
-			defer log.Close(r.Body, "could not close reader")
-			// 「/api/4.0/deliveryservices_required_capabilities」の場合にはenrollDeliveryServicesRequiredCapabilityハンドラが実行される
-			f(toSession, r.Body)
-		})
+		http.HandleFunc(baseEP+d, enrollHandler(toSession, f, cfg.MaxBodyBytes))
 	}
 
 	// HTTPサーバを起動する
 	go func() {
 		server := &http.Server{
-			Addr:      httpPort,
-			TLSConfig: nil,
-			ErrorLog:  log.Error,
+			Addr:              httpPort,
+			TLSConfig:         nil,
+			ErrorLog:          log.Error,
+			ReadHeaderTimeout: cfg.ReadTimeout,
+			ReadTimeout:       cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
 		}
 		if err := server.ListenAndServe(); err != nil {
 			log.Errorf("stopping server: %v\n", err)
@@ -1410,11 +2650,47 @@ func (cfg logConfig) EventLog() log.LogLocation {
 //
 func main() {
 	var watchDir, httpPort string
+	var writeResults bool
+	var scanConcurrency int
+	var scanInterval time.Duration
+	var ignorePatterns string
+	var allFiles bool
+	var batch bool
+	var validateOnly bool
+	var templating bool
+	var templateValues string
+	var retryStateFile string
+	httpCfg := httpServerConfig{}
+
+	// Traffic Opsへの接続設定は環境変数で与えられ、同名のフラグで上書きできる
+	toTransport := transportConfig{}
+	if err := envconfig.Process("", &toTransport); err != nil {
+		fmt.Fprintln(os.Stderr, "error reading the Traffic Ops connection settings from the environment: "+err.Error())
+		os.Exit(1)
+	}
 
 	// オプションの取得処理
 	flag.StringVar(&startedFile, "started", startedFile, "file indicating service was started")
 	flag.StringVar(&watchDir, "dir", "", "base directory to watch")
 	flag.StringVar(&httpPort, "http", "", "act as http server for POST on this port (e.g. :7070)")
+	flag.BoolVar(&writeResults, "results", false, "write the objects created from each processed file, with their Traffic Ops IDs, to a .result.json file alongside it")
+	flag.IntVar(&scanConcurrency, "scan-concurrency", 4, "maximum number of files which already exist in a directory when starting to process at once")
+	flag.DurationVar(&scanInterval, "scan-interval", 0, "minimum time between starting to process each file which already exists when starting, e.g. 100ms")
+	flag.BoolVar(&batch, "batch", false, "with -dir, process the files which already exist in dependency order, then exit, with a non-zero status if any were rejected")
+	flag.BoolVar(&validateOnly, "validate-only", false, "with -dir, check that the files which already exist would be enrolled, looking up the objects they reference in Traffic Ops without creating or updating anything, print whether each passed or failed, then exit, with a non-zero status if any failed")
+	flag.BoolVar(&templating, "template", false, "render the files in the watched directories as templates before decoding them, expanding ${VAR} placeholders and Go template actions like {{.VAR}} from the environment and -template-values")
+	flag.StringVar(&templateValues, "template-values", "", "with -template, a JSON file of an object of the string values of template variables, which are overridden by the environment")
+	flag.StringVar(&retryStateFile, "retry-state", defaultRetryStateFile, "file, relative to -dir unless absolute, to which the number of times each empty file or file referencing a missing Delivery Service has been retried is saved, so the retries carry across restarts; empty to keep them only in memory")
+	flag.StringVar(&ignorePatterns, "ignore", defaultIgnorePatterns, "comma-separated glob patterns of the names of files in the watched directories to ignore")
+	flag.BoolVar(&allFiles, "all-files", false, "process the files in the watched directories whose names don't end in .json too, rather than ignoring them")
+	flag.Int64Var(&httpCfg.MaxBodyBytes, "http-max-body", 10*1024*1024, "maximum size in bytes of a request body to the http server")
+	flag.DurationVar(&httpCfg.ReadTimeout, "http-read-timeout", 30*time.Second, "maximum time to read a request to the http server, including its body")
+	flag.DurationVar(&httpCfg.WriteTimeout, "http-write-timeout", 5*time.Minute, "maximum time to handle a request to the http server, including the Traffic Ops requests made for it")
+	flag.DurationVar(&toTransport.RequestTimeout, "to-request-timeout", toTransport.RequestTimeout, "maximum time of each request to Traffic Ops (env TO_REQUEST_TIMEOUT)")
+	flag.IntVar(&toTransport.MaxIdleConns, "to-max-idle-conns", toTransport.MaxIdleConns, "maximum number of idle connections to Traffic Ops kept for reuse (env TO_MAX_IDLE_CONNS)")
+	flag.IntVar(&toTransport.MaxIdleConnsPerHost, "to-max-idle-conns-per-host", toTransport.MaxIdleConnsPerHost, "maximum number of idle connections to each Traffic Ops host kept for reuse (env TO_MAX_IDLE_CONNS_PER_HOST)")
+	flag.DurationVar(&toTransport.IdleConnTimeout, "to-idle-conn-timeout", toTransport.IdleConnTimeout, "how long an idle connection to Traffic Ops is kept before it's closed (env TO_IDLE_CONN_TIMEOUT)")
+	flag.DurationVar(&toTransport.KeepAlive, "to-keep-alive", toTransport.KeepAlive, "interval of TCP keep-alive probes of the connections to Traffic Ops, negative to disable (env TO_KEEP_ALIVE)")
 	flag.Parse()
 
 	err := log.InitCfg(logConfig{})
@@ -1422,6 +2698,29 @@ func main() {
 		panic(err.Error())
 	}
 
+	if err := toTransport.validate(); err != nil {
+		log.Errorln(err)
+		os.Exit(1)
+	}
+
+	ignore := ignoreRules{allFiles: allFiles}
+	ignore.patterns, err = parseIgnorePatterns(ignorePatterns)
+	if err != nil {
+		log.Errorln(err)
+		os.Exit(1)
+	}
+
+	// テンプレートは明示的に有効にされた場合だけ展開する
+	var tmpl *templater
+	if templating {
+		if tmpl, err = newTemplater(templateValues); err != nil {
+			log.Errorln(err)
+			os.Exit(1)
+		}
+	} else if templateValues != "" {
+		log.Warnln("-template-values is ignored without -template")
+	}
+
 	// --dirが指定されておらず、--httpも指定されていない場合には、カレンとディレクトをwatch対象にする
 	if watchDir == "" && httpPort == "" {
 		// if neither -dir nor -http provided, default to watching the current dir
@@ -1437,42 +2736,31 @@ func main() {
 
 	envconfig.Process("", &toCreds)
 
-	reqTimeout := time.Second * time.Duration(60)
-
 	// TrafficOpsのログインエンドポイントに接続してCookie情報を発行しておく。この情報はHTTPサーバ起動関数やwatcher起動関数への引数として渡される
 	log.Infoln("Starting TrafficOps session")
-	toSession, err := newSession(reqTimeout, toCreds.URL, toCreds.User, toCreds.Password)
+	toSession, err := newSession(toTransport, toCreds.URL, toCreds.User, toCreds.Password)
 	if err != nil {
 		log.Errorln("error starting TrafficOps session: " + err.Error())
 		os.Exit(1)
 	}
 	log.Infoln("TrafficOps session established")
 
+	// --validate-onlyの場合はTraffic Opsを変更せず、既存のファイルを検証して結果を出力し終了する
+	if validateOnly {
+		if watchDir == "" {
+			log.Errorln("-validate-only requires -dir")
+			os.Exit(1)
+		}
+		results := newValidator(&toSession, enrollKinds, ignore, tmpl).validateDir(watchDir)
+		if failed := writeValidationSummary(os.Stdout, results); failed > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// 以下に記載されるのはHTTPエンドポイント「/api/v4.0/<name>」の定義です。実行されるハンドラがenroll<Name>です。
 	// dispatcher maps an API endpoint name to a function to act on the JSON input Reader
-	dispatcher := map[string]func(*session, io.Reader) error{
-		"types":                                  enrollType,
-		"cdns":                                   enrollCDN,
-		"cachegroups":                            enrollCachegroup,
-		"topologies":                             enrollTopology,
-		"profiles":                               enrollProfile,
-		"parameters":                             enrollParameter,
-		"servers":                                enrollServer,
-		"server_capabilities":                    enrollServerCapability,
-		"server_server_capabilities":             enrollServerServerCapability,
-		"asns":                                   enrollASN,
-		"deliveryservices":                       enrollDeliveryService,
-		"deliveryservices_required_capabilities": enrollDeliveryServicesRequiredCapability,
-		"deliveryservice_servers":                enrollDeliveryServiceServer,
-		"divisions":                              enrollDivision,
-		"federations":                            enrollFederation,
-		"origins":                                enrollOrigin,
-		"phys_locations":                         enrollPhysLocation,
-		"regions":                                enrollRegion,
-		"statuses":                               enrollStatus,
-		"tenants":                                enrollTenant,
-		"users":                                  enrollUser,
-	}
+	dispatcher := newDispatcher(enrollKinds)
 
 	// --httpの値(httpポート)が指定されていれば、goroutineにてHTTPサーバを起動する
 	// CDN-in-a-Boxでは--httpがデフォルトで指定されないので、HTTPサーバは起動しない。
@@ -1480,7 +2768,7 @@ func main() {
 
 		log.Infoln("Starting http server on " + httpPort)
 		// HTTPサーバの起動を行う。startWatching関数と同様にdispatcherを渡しているので、同じ処理をHTTPエンドポイントとして提供する
-		err := startServer(httpPort, &toSession, dispatcher)
+		err := startServer(httpPort, &toSession, dispatcher, httpCfg)
 		if err != nil {
 			log.Errorln("http server on " + httpPort + " failed: " + err.Error())
 		}
@@ -1492,10 +2780,25 @@ func main() {
 		log.Infoln("Watching directory " + watchDir)
 
 		// 指定したディレクトリへのwatch処理を開始する。
-		dw, err := startWatching(watchDir, &toSession, dispatcher)
+		dw, err := startWatching(watchDir, &toSession, enrollKinds, writeResults, ignore, tmpl, retryStateFile)
 		defer log.Close(dw, "could not close dirwatcher")
 		if err != nil {
 			log.Errorf("dirwatcher on %s failed: %s", watchDir, err.Error())
+			if batch {
+				os.Exit(1)
+			}
+		} else if batch {
+			rejected := dw.runBatch(watchDir, scanConcurrency, scanInterval)
+			log.Close(dw, "could not close dirwatcher")
+			if rejected > 0 {
+				log.Errorf("%d files were rejected\n", rejected)
+				os.Exit(1)
+			}
+			log.Infoln("finished processing all files")
+			os.Exit(0)
+		} else {
+			// the watcher only sees new files, so process any files which were already there
+			go dw.scanExisting(watchDir, scanConcurrency, scanInterval)
 		}
 	}
 
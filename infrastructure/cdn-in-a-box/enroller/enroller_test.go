@@ -0,0 +1,539 @@
+package main
+
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tc "github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+	client "github.com/apache/trafficcontrol/traffic_ops/v4-client"
+)
+
+func TestDedupProfileParameters(t *testing.T) {
+	str := func(s string) *string { return &s }
+	parameters := []tc.ParameterNullable{
+		{Name: str("CONFIG proxy.config.proxy_name"), ConfigFile: str("records.config"), Value: str("STRING __HOSTNAME__")},
+		{Name: str("CONFIG proxy.config.config_dir"), ConfigFile: str("records.config"), Value: str("STRING /opt/trafficserver/etc/trafficserver")},
+		{Name: str("CONFIG proxy.config.proxy_name"), ConfigFile: str("records.config"), Value: str("STRING __HOSTNAME__")},
+		{Name: str("CONFIG proxy.config.proxy_name"), ConfigFile: str("records.config"), Value: str("STRING other")},
+		{Name: str("location"), ConfigFile: str("remap.config")},
+		{Name: str("location"), ConfigFile: str("remap.config")},
+	}
+
+	params, duplicates := dedupProfileParameters(parameters)
+	if len(params) != 4 {
+		t.Fatalf("expected 4 unique parameters, got %d: %+v", len(params), params)
+	}
+	if len(duplicates) != 2 {
+		t.Fatalf("expected 2 duplicate parameters, got %d: %+v", len(duplicates), duplicates)
+	}
+	if params[0].Name != "CONFIG proxy.config.proxy_name" || params[1].Name != "CONFIG proxy.config.config_dir" || params[2].Value != "STRING other" || params[3].Name != "location" {
+		t.Errorf("expected unique parameters in input order, got %+v", params)
+	}
+	if duplicates[0].Value != "STRING __HOSTNAME__" || duplicates[1].Name != "location" {
+		t.Errorf("expected the later duplicates, got %+v", duplicates)
+	}
+}
+
+// newTestServiceCategoryServer returns a session to a fake Traffic Ops serving the /service_categories
+// endpoint, which already has the given Service Categories.
+func newTestServiceCategoryServer(t *testing.T, existing ...string) *session {
+	categories := map[string]struct{}{}
+	for _, name := range existing {
+		categories[name] = struct{}{}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/service_categories") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodPost:
+			var sc tc.ServiceCategory
+			if err := json.NewDecoder(r.Body).Decode(&sc); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if _, ok := categories[sc.Name]; ok {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(tc.CreateAlerts(tc.ErrorLevel, "service_category name '"+sc.Name+"' already exists."))
+				return
+			}
+			categories[sc.Name] = struct{}{}
+			json.NewEncoder(w).Encode(tc.CreateAlerts(tc.SuccessLevel, "serviceCategory was created."))
+		case http.MethodGet:
+			resp := tc.ServiceCategoriesResponse{Response: []tc.ServiceCategory{}}
+			if _, ok := categories[r.URL.Query().Get("name")]; ok {
+				resp.Response = append(resp.Response, tc.ServiceCategory{Name: r.URL.Query().Get("name")})
+			}
+			json.NewEncoder(w).Encode(resp)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return &session{Session: client.NewNoAuthSession(srv.URL, true, "enroller-test", false, 5*time.Second)}
+}
+
+func TestEnrollServiceCategory(t *testing.T) {
+	toSession := newTestServiceCategoryServer(t, "Existing")
+	toSession.writeResults = true
+
+	obj, err := enrollServiceCategory(toSession, strings.NewReader(`{"name": "Video"}`))
+	if err != nil {
+		t.Fatalf("enrolling new Service Category: %v", err)
+	}
+	sc, ok := obj.(tc.ServiceCategory)
+	if !ok || sc.Name != "Video" {
+		t.Errorf("expected the created Service Category 'Video', got %+v", obj)
+	}
+
+	obj, err = enrollServiceCategory(toSession, strings.NewReader(`{"name": "Existing"}`))
+	if err != nil {
+		t.Fatalf("enrolling existing Service Category: expected no error, got %v", err)
+	}
+	if sc, ok := obj.(tc.ServiceCategory); !ok || sc.Name != "Existing" {
+		t.Errorf("enrolling existing Service Category: expected the existing Service Category 'Existing', got %+v", obj)
+	}
+
+	if _, err := enrollServiceCategory(toSession, strings.NewReader(`{`)); err == nil {
+		t.Error("enrolling invalid JSON: expected an error, got nil")
+	}
+
+	// without results, nothing is looked up
+	toSession.writeResults = false
+	for _, name := range []string{"Audio", "Existing"} {
+		obj, err = enrollServiceCategory(toSession, strings.NewReader(`{"name": "`+name+`"}`))
+		if err != nil {
+			t.Fatalf("enrolling Service Category '%s' without results: %v", name, err)
+		}
+		if obj != nil {
+			t.Errorf("enrolling Service Category '%s' without results: expected no result, got %+v", name, obj)
+		}
+	}
+}
+
+func TestEnrollDeliveryServiceMissingServiceCategory(t *testing.T) {
+	toSession := newTestServiceCategoryServer(t)
+
+	_, err := enrollDeliveryService(toSession, strings.NewReader(`{"xmlId": "demo1", "serviceCategory": "Missing"}`))
+	if err == nil || !strings.Contains(err.Error(), "Service Category 'Missing'") {
+		t.Errorf("expected an error for the missing Service Category, got %v", err)
+	}
+}
+
+// newTestDeliveryServiceServer returns a session to a fake Traffic Ops which has the Delivery Service demo1,
+// with a HOST_REGEXP Regex, and records the Regexes and signing keys created for it in created.
+func newTestDeliveryServiceServer(t *testing.T, created *[]string) *session {
+	var mutex sync.Mutex
+	urlSigKeys := tc.URLSigKeys{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/deliveryservices"):
+			resp := tc.DeliveryServicesResponseV4{Response: []tc.DeliveryServiceV4{}}
+			if xmlID := r.URL.Query().Get("xmlId"); xmlID == "demo1" {
+				ds := tc.DeliveryServiceV4{}
+				ds.ID = util.IntPtr(1)
+				ds.XMLID = util.StrPtr(xmlID)
+				resp.Response = append(resp.Response, ds)
+			}
+			json.NewEncoder(w).Encode(resp)
+		case strings.HasSuffix(r.URL.Path, "/types"):
+			json.NewEncoder(w).Encode(tc.TypesResponse{Response: []tc.Type{{ID: 5, Name: r.URL.Query().Get("name")}}})
+		case strings.HasSuffix(r.URL.Path, "/deliveryservices/1/regexes") && r.Method == http.MethodGet:
+			json.NewEncoder(w).Encode(tc.DeliveryServiceIDRegexResponse{Response: []tc.DeliveryServiceIDRegex{{ID: 1, Type: 5, TypeName: "HOST_REGEXP", Pattern: `.*\.demo1\..*`}}})
+		case strings.HasSuffix(r.URL.Path, "/deliveryservices/1/regexes"):
+			var regex tc.DeliveryServiceRegexPost
+			if err := json.NewDecoder(r.Body).Decode(&regex); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			*created = append(*created, "regex "+strconv.Itoa(regex.Type)+" "+regex.Pattern)
+			json.NewEncoder(w).Encode(tc.CreateAlerts(tc.SuccessLevel, "Delivery Service regex creation was successful."))
+		case strings.HasSuffix(r.URL.Path, "/xmlId/demo1/urlkeys/generate"):
+			urlSigKeys["key0"] = "secret"
+			*created = append(*created, "urlkeys")
+			json.NewEncoder(w).Encode(tc.CreateAlerts(tc.SuccessLevel, "Successfully generated and stored keys"))
+		case strings.HasSuffix(r.URL.Path, "/xmlId/demo1/urlkeys"):
+			json.NewEncoder(w).Encode(tc.URLSignatureKeysResponse{Response: urlSigKeys})
+		case strings.HasSuffix(r.URL.Path, "/demo1/urisignkeys"):
+			*created = append(*created, "urisignkeys")
+			json.NewEncoder(w).Encode(tc.CreateAlerts(tc.SuccessLevel, "URI signing keys were created."))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return &session{Session: client.NewNoAuthSession(srv.URL, true, "enroller-test", false, 5*time.Second)}
+}
+
+func TestEnrollDeliveryServiceRegex(t *testing.T) {
+	created := []string{}
+	toSession := newTestDeliveryServiceServer(t, &created)
+
+	obj, err := enrollDeliveryServiceRegex(toSession, strings.NewReader(`{"dsName": "demo1", "regexes": [
+		{"type": "HOST_REGEXP", "setNumber": 0, "pattern": ".*\\.demo1\\..*"},
+		{"type": "HOST_REGEXP", "setNumber": 1, "pattern": ".*\\.alias\\..*"}
+	]}`))
+	if err != nil {
+		t.Fatalf("enrolling Delivery Service Regexes: %v", err)
+	}
+	if expected := []string{`regex 5 .*\.alias\..*`}; strings.Join(created, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected only the new Regex to be created, %v, actual %v", expected, created)
+	}
+	if dsr, ok := obj.(tc.DeliveryServiceRegexes); !ok || len(dsr.Regexes) != 1 || dsr.Regexes[0].SetNumber != 1 {
+		t.Errorf("expected the created Regex as the result, actual %+v", obj)
+	}
+
+	_, err = enrollDeliveryServiceRegex(toSession, strings.NewReader(`{"dsName": "demo2", "regexes": [{"type": "HOST_REGEXP", "pattern": ".*"}]}`))
+	if !errors.Is(err, errMissingDependency) {
+		t.Errorf("expected a missing dependency error for a Delivery Service which doesn't exist yet, actual %v", err)
+	}
+	if _, err := enrollDeliveryServiceRegex(toSession, strings.NewReader(`{"dsName": "demo1", "regexes": [{"type": "HOST_REGEXP"}]}`)); err == nil {
+		t.Error("expected an error for a Regex with no pattern, actual nil")
+	}
+}
+
+func TestEnrollURLSigKeys(t *testing.T) {
+	created := []string{}
+	toSession := newTestDeliveryServiceServer(t, &created)
+
+	for i := 0; i < 2; i++ {
+		if _, err := enrollURLSigKeys(toSession, strings.NewReader(`{"xmlId": "demo1", "generateUrlSigKeys": true}`)); err != nil {
+			t.Fatalf("enrolling URL signing keys: %v", err)
+		}
+	}
+	if expected := []string{"urlkeys"}; strings.Join(created, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected URL signing keys to be generated once, actual %v", created)
+	}
+
+	created = created[:0]
+	obj, err := enrollURLSigKeys(toSession, strings.NewReader(`{"xmlId": "demo1", "uriSigningKeys": {"issuer": {"keys": [{"kty": "oct", "kid": "0", "k": "c2VjcmV0"}]}}}`))
+	if err != nil {
+		t.Fatalf("enrolling URI signing keys: %v", err)
+	}
+	if expected := []string{"urisignkeys"}; strings.Join(created, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected URI signing keys to be set, actual %v", created)
+	}
+	if bts, err := json.Marshal(obj); err != nil || strings.Contains(string(bts), "c2VjcmV0") || !strings.Contains(string(bts), "issuer") {
+		t.Errorf("expected the result to name the issuers without the keys, actual %s, %v", bts, err)
+	}
+
+	_, err = enrollURLSigKeys(toSession, strings.NewReader(`{"xmlId": "demo2", "generateUrlSigKeys": true}`))
+	if !errors.Is(err, errMissingDependency) {
+		t.Errorf("expected a missing dependency error for a Delivery Service which doesn't exist yet, actual %v", err)
+	}
+	if _, err := enrollURLSigKeys(toSession, strings.NewReader(`{"xmlId": "demo1"}`)); err == nil {
+		t.Error("expected an error for no keys, actual nil")
+	}
+}
+
+func TestEnrollHandlerMaxBody(t *testing.T) {
+	called := 0
+	f := func(toSession *session, r io.Reader) (interface{}, error) {
+		called++
+		var obj map[string]interface{}
+		return obj, json.NewDecoder(r).Decode(&obj)
+	}
+	handler := enrollHandler(nil, f, 32)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/api/4.0/types", strings.NewReader(`{"name": "`+strings.Repeat("x", 64)+`"}`)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d for a body over the limit, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/api/4.0/types", strings.NewReader(`{"name": "x"}`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d for a body under the limit, got %d", http.StatusOK, w.Code)
+	}
+	if called != 2 {
+		t.Errorf("expected the enroll function to be called twice, got %d", called)
+	}
+}
+
+func TestSessionRelogin(t *testing.T) {
+	var mutex sync.Mutex
+	logins := 0
+	validCookie := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/user/login") {
+			logins++
+			validCookie = "session-" + strconv.Itoa(logins)
+			http.SetCookie(w, &http.Cookie{Name: "mojolicious", Value: validCookie, Path: "/"})
+			json.NewEncoder(w).Encode(tc.CreateAlerts(tc.SuccessLevel, "Successfully logged in."))
+			return
+		}
+		if cookie, err := r.Cookie("mojolicious"); err != nil || cookie.Value != validCookie {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(tc.CreateAlerts(tc.ErrorLevel, "Unauthorized, please log in."))
+			return
+		}
+		json.NewEncoder(w).Encode(tc.TypesResponse{Response: []tc.Type{{Name: "EDGE"}}})
+	}))
+	defer srv.Close()
+
+	toSession, err := newSession(transportConfig{RequestTimeout: 5 * time.Second}, srv.URL, "admin", "password")
+	if err != nil {
+		t.Fatalf("creating session: %v", err)
+	}
+
+	// expire the session
+	mutex.Lock()
+	validCookie = ""
+	mutex.Unlock()
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			types, _, err := toSession.GetTypes(client.RequestOptions{})
+			if err == nil && (len(types.Response) != 1 || types.Response[0].Name != "EDGE") {
+				err = fmt.Errorf("expected type EDGE, got %+v", types.Response)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("getting types after the session expired: %v", err)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if logins != 2 {
+		t.Errorf("expected 1 login and 1 login again after the session expired, got %d logins", logins)
+	}
+}
+
+func TestSessionConnectionReuse(t *testing.T) {
+	var mutex sync.Mutex
+	conns := 0
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/user/login") {
+			http.SetCookie(w, &http.Cookie{Name: "mojolicious", Value: "session", Path: "/"})
+			json.NewEncoder(w).Encode(tc.CreateAlerts(tc.SuccessLevel, "Successfully logged in."))
+			return
+		}
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(tc.ServiceCategoriesResponse{Response: []tc.ServiceCategory{{Name: r.URL.Query().Get("name")}}})
+			return
+		}
+		json.NewEncoder(w).Encode(tc.CreateAlerts(tc.SuccessLevel, "serviceCategory was created."))
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mutex.Lock()
+			conns++
+			mutex.Unlock()
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	cfg := transportConfig{RequestTimeout: 5 * time.Second, MaxIdleConns: 10, MaxIdleConnsPerHost: 4, IdleConnTimeout: time.Minute, KeepAlive: 30 * time.Second}
+	toSession, err := newSession(cfg, srv.URL, "admin", "password")
+	if err != nil {
+		t.Fatalf("creating session: %v", err)
+	}
+	transport, ok := toSession.Client.Transport.(*reauthTransport).RoundTripper.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected the session to use an *http.Transport, got %T", toSession.Client.Transport)
+	}
+	if transport.MaxIdleConns != 10 || transport.MaxIdleConnsPerHost != 4 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("expected the transport settings to be applied, got MaxIdleConns %d, MaxIdleConnsPerHost %d, IdleConnTimeout %v", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+
+	for i := 0; i < 20; i++ {
+		if _, err := enrollServiceCategory(&toSession, strings.NewReader(`{"name": "Category`+strconv.Itoa(i)+`"}`)); err != nil {
+			t.Fatalf("enrolling Service Category %d: %v", i, err)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if conns != 1 {
+		t.Errorf("expected the login and every enroll call to reuse 1 connection, got %d connections", conns)
+	}
+}
+
+func TestTransportConfigValidate(t *testing.T) {
+	valid := transportConfig{RequestTimeout: time.Minute, MaxIdleConns: 100, MaxIdleConnsPerHost: 16, IdleConnTimeout: 90 * time.Second, KeepAlive: -1}
+	if err := valid.validate(); err != nil {
+		t.Errorf("expected a valid config, got %v", err)
+	}
+	for _, invalid := range []transportConfig{
+		{RequestTimeout: 0},
+		{RequestTimeout: time.Minute, MaxIdleConns: -1},
+		{RequestTimeout: time.Minute, MaxIdleConnsPerHost: -1},
+		{RequestTimeout: time.Minute, IdleConnTimeout: -time.Second},
+	} {
+		if err := invalid.validate(); err == nil {
+			t.Errorf("expected an error validating %+v", invalid)
+		}
+	}
+}
+
+func TestIgnorePatterns(t *testing.T) {
+	ignore, err := parseIgnorePatterns(defaultIgnorePatterns)
+	if err != nil {
+		t.Fatalf("parsing default ignore patterns: %v", err)
+	}
+	dw := dirWatcher{ignore: ignoreRules{patterns: ignore}}
+	for _, fn := range []string{"/shared/enroller/types/.010-BIND.json.swp", "/shared/enroller/types/010-BIND.json~", "/shared/enroller/types/4913.swp", "/shared/enroller/types/.hidden", "/shared/enroller/types/README", "/shared/enroller/types/010-BIND.yaml"} {
+		if !dw.isIgnored(fn) {
+			t.Errorf("expected %s to be ignored", fn)
+		}
+	}
+	for _, fn := range []string{"/shared/enroller/types/010-BIND.json", "/shared/enroller/types/010-BIND.json.retry", "/shared/enroller/types/010-BIND.JSON"} {
+		if dw.isIgnored(fn) {
+			t.Errorf("expected %s not to be ignored", fn)
+		}
+	}
+
+	// with all files, only the patterns are ignored
+	dw.ignore.allFiles = true
+	if dw.isIgnored("/shared/enroller/types/010-BIND") {
+		t.Error("expected a file not ending in .json not to be ignored with all files")
+	}
+	if !dw.isIgnored("/shared/enroller/types/010-BIND.json~") {
+		t.Error("expected a file matching a pattern to be ignored with all files")
+	}
+
+	if _, err := parseIgnorePatterns("*.swp,[bad"); err == nil {
+		t.Error("expected an error for an invalid pattern, got nil")
+	}
+}
+
+func TestEnrollKindsOrder(t *testing.T) {
+	index := map[string]int{}
+	for i, kind := range enrollKinds {
+		if _, ok := index[kind.name]; ok {
+			t.Errorf("duplicate kind %s", kind.name)
+		}
+		index[kind.name] = i
+	}
+	dependencies := map[string][]string{
+		"cachegroups":             {"types"},
+		"profiles":                {"cdns", "types"},
+		"servers":                 {"types", "cdns", "cachegroups", "phys_locations", "statuses", "profiles"},
+		"topologies":              {"cachegroups", "servers"},
+		"deliveryservices":        {"types", "cdns", "tenants", "topologies", "service_categories"},
+		"federations":             {"deliveryservices", "users"},
+		"deliveryservice_regexes": {"deliveryservices", "types"},
+		"url_sig_keys":            {"deliveryservices"},
+	}
+	for kind, deps := range dependencies {
+		for _, dep := range deps {
+			if index[dep] >= index[kind] {
+				t.Errorf("expected %s to be enrolled before %s", dep, kind)
+			}
+		}
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	watchDir := t.TempDir()
+	var mutex sync.Mutex
+	enrolled := []string{}
+	kinds := []enrollKind{}
+	for _, name := range []string{"types", "cdns", "servers"} {
+		name := name
+		kinds = append(kinds, enrollKind{name: name, enroll: func(toSession *session, r io.Reader) (interface{}, error) {
+			var obj map[string]interface{}
+			if err := json.NewDecoder(r).Decode(&obj); err != nil {
+				return nil, err
+			}
+			mutex.Lock()
+			enrolled = append(enrolled, name+"/"+obj["name"].(string))
+			mutex.Unlock()
+			return obj, nil
+		}})
+	}
+
+	dw := dirWatcher{retries: &retryState{counts: map[string]int{}}, inProgress: map[string]struct{}{}, watched: map[string]func(*session, string) (interface{}, error){}}
+	for _, kind := range kinds {
+		kind := kind
+		if err := os.Mkdir(filepath.Join(watchDir, kind.name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		dw.watched[kind.name] = func(toSession *session, fn string) (interface{}, error) {
+			fh, err := os.Open(fn)
+			if err != nil {
+				return nil, err
+			}
+			defer fh.Close()
+			return kind.enroll(toSession, fh)
+		}
+		dw.order = append(dw.order, kind.name)
+	}
+
+	files := map[string]string{
+		"servers/010-edge.json": `{"name": "edge"}`,
+		"cdns/010-ciab.json":    `{"name": "ciab"}`,
+		"types/010-EDGE.json":   `{"name": "EDGE"}`,
+		"types/020-bad.json":    `{`,
+	}
+	for fn, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(watchDir, fn), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if rejected := dw.runBatch(watchDir, 2, 0); rejected != 1 {
+		t.Errorf("expected 1 rejected file, got %d", rejected)
+	}
+	expected := []string{"types/EDGE", "cdns/ciab", "servers/edge"}
+	if strings.Join(enrolled, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected files enrolled in order %v, got %v", expected, enrolled)
+	}
+	for fn, suffix := range map[string]string{"servers/010-edge.json": processedSuffix, "types/020-bad.json": rejectedSuffix} {
+		if _, err := os.Stat(filepath.Join(watchDir, fn+suffix)); err != nil {
+			t.Errorf("expected %s to be renamed to %s: %v", fn, fn+suffix, err)
+		}
+	}
+}
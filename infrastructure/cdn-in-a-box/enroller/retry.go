@@ -0,0 +1,116 @@
+package main
+
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// defaultRetryStateFile is the default name of the file in the watched directory to which the retry counts are saved.
+const defaultRetryStateFile = "enroller-retries.json"
+
+// retryState is the number of times each file has been retried, keyed by its original name, without any
+// retry suffixes. It's saved to a file whenever it changes, so retry budgets carry across restarts, and
+// a file which keeps failing is eventually rejected even if the enroller keeps crashing.
+// It isn't safe for concurrent use; the dirWatcher guards it with its mutex.
+type retryState struct {
+	// path is the name of the file the counts are saved to. If it's empty, they're only kept in memory.
+	path   string
+	counts map[string]int
+}
+
+// loadRetryState returns the retry counts saved to the file path, or no counts if it doesn't exist yet.
+// If path is empty, the counts are only kept in memory.
+func loadRetryState(path string) (*retryState, error) {
+	rs := &retryState{path: path, counts: map[string]int{}}
+	if path == "" {
+		return rs, nil
+	}
+	bts, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return rs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading retry state: %v", err)
+	}
+	if err := json.Unmarshal(bts, &rs.counts); err != nil {
+		return nil, fmt.Errorf("decoding retry state file '%s': %v", path, err)
+	}
+	if rs.counts == nil {
+		rs.counts = map[string]int{}
+	}
+	return rs, nil
+}
+
+// key returns the key of the file fn, which is its name relative to the directory of the state file,
+// so the counts still apply if the watched directory is mounted elsewhere after a restart.
+func (rs *retryState) key(fn string) string {
+	if rs.path == "" {
+		return fn
+	}
+	rel, err := filepath.Rel(filepath.Dir(rs.path), fn)
+	if err != nil {
+		return fn
+	}
+	return rel
+}
+
+// increment adds a retry of the file fn, saves the counts, and returns its number of retries.
+func (rs *retryState) increment(fn string) int {
+	key := rs.key(fn)
+	rs.counts[key]++
+	rs.save()
+	return rs.counts[key]
+}
+
+// clear forgets the retries of the file fn, once it's been processed or rejected.
+func (rs *retryState) clear(fn string) {
+	key := rs.key(fn)
+	if _, ok := rs.counts[key]; !ok {
+		return
+	}
+	delete(rs.counts, key)
+	rs.save()
+}
+
+// save writes the counts to the state file, replacing it atomically so a crash can't leave it truncated.
+// Errors are logged rather than returned, since retrying continues in memory.
+func (rs *retryState) save() {
+	if rs.path == "" {
+		return
+	}
+	bts, err := json.MarshalIndent(rs.counts, "", "  ")
+	if err != nil {
+		log.Infof("error encoding retry state: %s\n", err.Error())
+		return
+	}
+	tmp := rs.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, bts, 0600); err != nil {
+		log.Infof("error writing retry state %s: %s\n", tmp, err.Error())
+		return
+	}
+	if err := os.Rename(tmp, rs.path); err != nil {
+		log.Infof("error renaming %s to %s: %s\n", tmp, rs.path, err.Error())
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRetryStateSurvivesRestart(t *testing.T) {
+	watchDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(watchDir, "cdns"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	stateFile := filepath.Join(watchDir, defaultRetryStateFile)
+
+	// newWatcher simulates starting the enroller, loading the retry counts saved by the last run
+	newWatcher := func() *dirWatcher {
+		retries, err := loadRetryState(stateFile)
+		if err != nil {
+			t.Fatalf("loading retry state: %v", err)
+		}
+		dw := &dirWatcher{retries: retries, inProgress: map[string]struct{}{}, watched: map[string]func(*session, string) (interface{}, error){}}
+		dw.watched["cdns"] = func(toSession *session, fn string) (interface{}, error) {
+			return nil, io.EOF
+		}
+		return dw
+	}
+
+	fn := filepath.Join(watchDir, "cdns", "010-ciab.json")
+	if err := ioutil.WriteFile(fn, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	const beforeRestart = 3
+	dw := newWatcher()
+	for i := 0; i < beforeRestart; i++ {
+		dw.processFile(fn, 0)
+		fn += retrySuffix
+	}
+	if _, err := os.Stat(fn); err != nil {
+		t.Fatalf("expected the empty file to be renamed to %s to retry: %v", fn, err)
+	}
+
+	bts, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("reading retry state: %v", err)
+	}
+	saved := map[string]int{}
+	if err := json.Unmarshal(bts, &saved); err != nil {
+		t.Fatalf("decoding retry state: %v", err)
+	}
+	if key := filepath.Join("cdns", "010-ciab.json"); saved[key] != beforeRestart {
+		t.Fatalf("expected %d retries of %s to be saved, actual %v", beforeRestart, key, saved)
+	}
+
+	// after restarting, the file is only retried for the rest of its budget
+	dw = newWatcher()
+	for i := beforeRestart; i < maxEmptyTries-1; i++ {
+		dw.processFile(fn, 0)
+		fn += retrySuffix
+	}
+	if _, err := os.Stat(fn); err != nil {
+		t.Fatalf("expected the empty file to be renamed to %s to retry: %v", fn, err)
+	}
+	dw.processFile(fn, 0)
+	if _, err := os.Stat(fn + rejectedSuffix); err != nil {
+		t.Fatalf("expected the empty file to be rejected after %d tries in all: %v", maxEmptyTries, err)
+	}
+	if rejected := dw.rejectedCount(); rejected != 1 {
+		t.Errorf("expected 1 rejected file, actual %d", rejected)
+	}
+
+	// the rejected file's retries are forgotten, so a new file of the same name gets a full budget
+	if retries, err := loadRetryState(stateFile); err != nil {
+		t.Errorf("loading retry state: %v", err)
+	} else if len(retries.counts) != 0 {
+		t.Errorf("expected no saved retries once the file was rejected, actual %v", retries.counts)
+	}
+}
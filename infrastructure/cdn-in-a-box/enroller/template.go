@@ -0,0 +1,205 @@
+package main
+
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	log "github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// templateVarRegex matches the ${VAR} placeholders in templated enrollment files.
+// The $VAR form isn't expanded, since regular expressions in enrollment files may contain it.
+var templateVarRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// redactedTemplateValue is logged in place of the values of secret template variables.
+const redactedTemplateValue = "*** REDACTED ***"
+
+// secretTemplateVarParts are the parts of the names of template variables whose values aren't logged.
+var secretTemplateVarParts = []string{"PASS", "SECRET", "TOKEN", "KEY", "CREDENTIAL", "PRIVATE"}
+
+// templater renders enrollment files as templates before they're decoded, so one file may be used
+// with different CDN in a Box variants. Both Go template actions, e.g. {{.CDN_NAME}}, and ${CDN_NAME}
+// placeholders are expanded, from the environment or the values file.
+type templater struct {
+	// values are the template variables, from the values file, overridden by the environment.
+	values map[string]string
+}
+
+// newTemplater returns a templater of the environment and the values in valuesFile, a JSON object of
+// string values, if it isn't empty. The environment takes precedence over the values file.
+func newTemplater(valuesFile string) (*templater, error) {
+	values := map[string]string{}
+	if valuesFile != "" {
+		bts, err := ioutil.ReadFile(valuesFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading template values file: %v", err)
+		}
+		if err := json.Unmarshal(bts, &values); err != nil {
+			return nil, fmt.Errorf("decoding template values file '%s', which must be a JSON object of strings: %v", valuesFile, err)
+		}
+	}
+	for _, env := range os.Environ() {
+		if i := strings.Index(env, "="); i > 0 {
+			values[env[:i]] = env[i+1:]
+		}
+	}
+	return &templater{values: values}, nil
+}
+
+// render returns the enrollment file name with the contents raw, with its placeholders expanded.
+// An empty file is returned as is, so it's retried like any other empty file.
+// Returns an error if any placeholder is undefined, or if the rendered file isn't valid JSON.
+func (tp *templater) render(name string, raw []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return raw, nil
+	}
+
+	// Go templates are executed first, so a value can't be parsed as a template action
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("parsing template %s: %v", name, err)
+	}
+	used := map[string]struct{}{}
+	templateFields(tmpl.Tree.Root, used)
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, tp.values); err != nil {
+		return nil, fmt.Errorf("rendering template %s: %v", name, err)
+	}
+
+	undefined := []string{}
+	rendered := templateVarRegex.ReplaceAllStringFunc(buf.String(), func(placeholder string) string {
+		varName := placeholder[2 : len(placeholder)-1]
+		value, ok := tp.values[varName]
+		if !ok {
+			undefined = append(undefined, varName)
+			return placeholder
+		}
+		used[varName] = struct{}{}
+		return value
+	})
+	if len(undefined) > 0 {
+		return nil, fmt.Errorf("rendering template %s: undefined variables %s", name, strings.Join(undefined, ", "))
+	}
+
+	var obj interface{}
+	if err := json.Unmarshal([]byte(rendered), &obj); err != nil {
+		return nil, fmt.Errorf("rendered template %s is not valid JSON, check the values of its variables: %v", name, err)
+	}
+
+	log.Infof("rendered template %s with %s\n", name, tp.describe(used))
+	return []byte(rendered), nil
+}
+
+// renderReader reads the enrollment file name from r, and returns a reader of it rendered.
+func (tp *templater) renderReader(name string, r io.Reader) (io.Reader, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := tp.render(name, raw)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(rendered), nil
+}
+
+// describe returns the given template variables and their values, for logging, with the values of secrets redacted.
+func (tp *templater) describe(used map[string]struct{}) string {
+	if len(used) == 0 {
+		return "no variables"
+	}
+	names := make([]string, 0, len(used))
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		value := tp.values[name]
+		if isSecretTemplateVar(name) {
+			value = redactedTemplateValue
+		}
+		pairs = append(pairs, name+"='"+value+"'")
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// isSecretTemplateVar returns whether the value of the template variable name is a secret, which must not be logged.
+func isSecretTemplateVar(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, part := range secretTemplateVarParts {
+		if strings.Contains(upper, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// templateFields adds the names of the top-level fields referenced by the template node, e.g. CDN_NAME of
+// {{.CDN_NAME}}, to fields.
+func templateFields(node parse.Node, fields map[string]struct{}) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			templateFields(child, fields)
+		}
+	case *parse.ActionNode:
+		templateFields(n.Pipe, fields)
+	case *parse.IfNode:
+		templateFields(&n.BranchNode, fields)
+	case *parse.RangeNode:
+		templateFields(&n.BranchNode, fields)
+	case *parse.WithNode:
+		templateFields(&n.BranchNode, fields)
+	case *parse.BranchNode:
+		templateFields(n.Pipe, fields)
+		templateFields(n.List, fields)
+		templateFields(n.ElseList, fields)
+	case *parse.TemplateNode:
+		templateFields(n.Pipe, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			templateFields(cmd, fields)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			templateFields(arg, fields)
+		}
+	case *parse.FieldNode:
+		if len(n.Ident) > 0 {
+			fields[n.Ident[0]] = struct{}{}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplaterRender(t *testing.T) {
+	valuesFile := filepath.Join(t.TempDir(), "values.json")
+	if err := ioutil.WriteFile(valuesFile, []byte(`{"CDN_NAME": "values-cdn", "DOMAIN": "values.test", "QUOTE": "a\"b"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOMAIN", "env.test")
+	t.Setenv("DB_PASSWORD", "hunter2")
+
+	tp, err := newTemplater(valuesFile)
+	if err != nil {
+		t.Fatalf("creating templater: %v", err)
+	}
+
+	rendered, err := tp.render("cdn.json", []byte(`{"name": "${CDN_NAME}", "domainName": "{{.DOMAIN}}", "pattern": "$1.example"}`))
+	if err != nil {
+		t.Fatalf("rendering: %v", err)
+	}
+	if expected := `{"name": "values-cdn", "domainName": "env.test", "pattern": "$1.example"}`; string(rendered) != expected {
+		t.Errorf("expected rendered file %s, actual %s", expected, rendered)
+	}
+
+	if _, err := tp.render("undefined.json", []byte(`{"name": "${NO_SUCH_VAR}"}`)); err == nil || !strings.Contains(err.Error(), "NO_SUCH_VAR") {
+		t.Errorf("expected an error naming the undefined variable, actual %v", err)
+	}
+	if _, err := tp.render("undefined.json", []byte(`{"name": "{{.NO_SUCH_VAR}}"}`)); err == nil {
+		t.Error("expected an error rendering an undefined template field, actual nil")
+	}
+	if _, err := tp.render("quote.json", []byte(`{"name": "${QUOTE}"}`)); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("expected an invalid JSON error, actual %v", err)
+	}
+	if rendered, err := tp.render("empty.json", []byte("\n")); err != nil || string(rendered) != "\n" {
+		t.Errorf("expected an empty file to be returned as is, actual %q, %v", rendered, err)
+	}
+
+	described := tp.describe(map[string]struct{}{"CDN_NAME": {}, "DB_PASSWORD": {}})
+	if strings.Contains(described, "hunter2") || !strings.Contains(described, "DB_PASSWORD='"+redactedTemplateValue+"'") {
+		t.Errorf("expected the secret to be redacted, actual %s", described)
+	}
+	if !strings.Contains(described, "CDN_NAME='values-cdn'") {
+		t.Errorf("expected the variable to be described, actual %s", described)
+	}
+}
@@ -0,0 +1,591 @@
+package main
+
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/apache/trafficcontrol/lib/go-log"
+	tc "github.com/apache/trafficcontrol/lib/go-tc"
+	client "github.com/apache/trafficcontrol/traffic_ops/v4-client"
+)
+
+// reference is a reference by name from an object being enrolled to another object, which Traffic Ops
+// resolves when the object is created, so it must already exist.
+type reference struct {
+	// kind is the name of the kind of the referenced object, or of another lookup in Traffic Ops, e.g. "roles".
+	kind string
+	name string
+}
+
+// validated is the result of validating a file without enrolling it.
+type validated struct {
+	// names are the names of the objects the file would create, by which other files may reference them.
+	names []string
+	// refs are the objects the file references, which must exist in Traffic Ops or be created by another file first.
+	refs []reference
+}
+
+// ref appends a reference to the object of the given kind with the given name, if the name is set.
+func (v *validated) ref(kind string, name *string) {
+	if name != nil && *name != "" {
+		v.refs = append(v.refs, reference{kind: kind, name: *name})
+	}
+}
+
+// lookup is how to find an object of a kind by name in Traffic Ops.
+type lookup struct {
+	// param is the query parameter of the name.
+	param string
+	// count returns the number of objects matching the query.
+	count func(toSession *session, opts client.RequestOptions) (int, error)
+}
+
+// lookups are the read-only requests to find the objects of each kind which may be referenced by name.
+var lookups = map[string]lookup{
+	"types": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetTypes(opts)
+		return len(resp.Response), err
+	}},
+	"cdns": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetCDNs(opts)
+		return len(resp.Response), err
+	}},
+	"divisions": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetDivisions(opts)
+		return len(resp.Response), err
+	}},
+	"regions": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetRegions(opts)
+		return len(resp.Response), err
+	}},
+	"phys_locations": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetPhysLocations(opts)
+		return len(resp.Response), err
+	}},
+	"statuses": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetStatuses(opts)
+		return len(resp.Response), err
+	}},
+	"tenants": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetTenants(opts)
+		return len(resp.Response), err
+	}},
+	"roles": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetRoles(opts)
+		return len(resp.Response), err
+	}},
+	"cachegroups": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetCacheGroups(opts)
+		return len(resp.Response), err
+	}},
+	"coordinates": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetCoordinates(opts)
+		return len(resp.Response), err
+	}},
+	"profiles": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetProfiles(opts)
+		return len(resp.Response), err
+	}},
+	"server_capabilities": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetServerCapabilities(opts)
+		return len(resp.Response), err
+	}},
+	"servers": {"hostName", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetServers(opts)
+		return len(resp.Response), err
+	}},
+	"topologies": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetTopologies(opts)
+		return len(resp.Response), err
+	}},
+	"service_categories": {"name", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetServiceCategories(opts)
+		return len(resp.Response), err
+	}},
+	"deliveryservices": {"xmlId", func(s *session, opts client.RequestOptions) (int, error) {
+		resp, _, err := s.GetDeliveryServices(opts)
+		return len(resp.Response), err
+	}},
+}
+
+// The validate functions of each kind decode a file as its enroll function does, and return the
+// objects it would create and reference, without making any requests to Traffic Ops.
+// A name is only referenced when its ID isn't given, as Traffic Ops is only asked to resolve those.
+
+func validateType(r io.Reader) (validated, error) {
+	s, err := decodeType(r)
+	return validated{names: []string{s.Name}}, err
+}
+
+func validateCDN(r io.Reader) (validated, error) {
+	s, err := decodeCDN(r)
+	return validated{names: []string{s.Name}}, err
+}
+
+func validateDivision(r io.Reader) (validated, error) {
+	s, err := decodeDivision(r)
+	return validated{names: []string{s.Name}}, err
+}
+
+func validateRegion(r io.Reader) (validated, error) {
+	s, err := decodeRegion(r)
+	v := validated{names: []string{s.Name}}
+	if s.Division == 0 {
+		v.ref("divisions", &s.DivisionName)
+	}
+	return v, err
+}
+
+func validatePhysLocation(r io.Reader) (validated, error) {
+	s, err := decodePhysLocation(r)
+	v := validated{names: []string{s.Name}}
+	if s.RegionID == 0 {
+		v.ref("regions", &s.RegionName)
+	}
+	return v, err
+}
+
+func validateStatus(r io.Reader) (validated, error) {
+	s, err := decodeStatus(r)
+	if err != nil {
+		return validated{}, err
+	}
+	if s.Name == nil || *s.Name == "" {
+		return validated{}, errors.New("missing name on Status")
+	}
+	return validated{names: []string{*s.Name}}, nil
+}
+
+func validateTenant(r io.Reader) (validated, error) {
+	s, err := decodeTenant(r)
+	v := validated{names: []string{s.Name}}
+	if s.ParentID == 0 {
+		v.ref("tenants", &s.ParentName)
+	}
+	return v, err
+}
+
+func validateUser(r io.Reader) (validated, error) {
+	s, err := decodeUser(r)
+	v := validated{}
+	v.ref("tenants", s.Tenant)
+	v.ref("roles", &s.Role)
+	return v, err
+}
+
+func validateCachegroup(r io.Reader) (validated, error) {
+	s, err := decodeCachegroup(r)
+	if err != nil {
+		return validated{}, err
+	}
+	if s.Name == nil || *s.Name == "" {
+		return validated{}, errors.New("missing name on Cache Group")
+	}
+	v := validated{names: []string{*s.Name}}
+	if s.TypeID == nil {
+		v.ref("types", s.Type)
+	}
+	if s.ParentCachegroupID == nil {
+		v.ref("cachegroups", s.ParentName)
+	}
+	if s.SecondaryParentCachegroupID == nil {
+		v.ref("cachegroups", s.SecondaryParentName)
+	}
+	return v, nil
+}
+
+func validateASN(r io.Reader) (validated, error) {
+	_, err := decodeASN(r)
+	return validated{}, err
+}
+
+func validateProfile(r io.Reader) (validated, error) {
+	profile, err := decodeProfile(r)
+	if err != nil {
+		return validated{}, err
+	}
+	if len(profile.Name) == 0 {
+		return validated{}, errors.New("missing name on profile")
+	}
+	v := validated{names: []string{profile.Name}}
+	if profile.CDNID == 0 {
+		v.ref("cdns", &profile.CDNName)
+	}
+	return v, nil
+}
+
+func validateParameters(r io.Reader) (validated, error) {
+	params, err := decodeParameters(r)
+	if err != nil {
+		return validated{}, err
+	}
+	v := validated{}
+	for _, p := range params {
+		if len(p.Profiles) == 0 {
+			continue
+		}
+		var profiles []string
+		if err := json.Unmarshal(p.Profiles, &profiles); err != nil {
+			return validated{}, fmt.Errorf("decoding the Profiles of Parameter '%s': %v", p.Name, err)
+		}
+		for i := range profiles {
+			v.ref("profiles", &profiles[i])
+		}
+	}
+	return v, nil
+}
+
+func validateServerCapability(r io.Reader) (validated, error) {
+	s, err := decodeServerCapability(r)
+	return validated{names: []string{s.Name}}, err
+}
+
+func validateServer(r io.Reader) (validated, error) {
+	s, err := decodeServer(r)
+	if err != nil {
+		return validated{}, err
+	}
+	v := validated{names: []string{*s.HostName}}
+	if s.CachegroupID == nil || *s.CachegroupID == 0 {
+		v.ref("cachegroups", s.Cachegroup)
+	}
+	if s.CDNID == nil || *s.CDNID == 0 {
+		v.ref("cdns", s.CDNName)
+	}
+	if s.PhysLocationID == nil || *s.PhysLocationID == 0 {
+		v.ref("phys_locations", s.PhysLocation)
+	}
+	if s.StatusID == nil || *s.StatusID == 0 {
+		v.ref("statuses", s.Status)
+	}
+	if s.TypeID == nil || *s.TypeID == 0 {
+		v.ref("types", &s.Type)
+	}
+	return v, nil
+}
+
+func validateServerServerCapability(r io.Reader) (validated, error) {
+	s, err := decodeServerServerCapability(r)
+	v := validated{}
+	v.ref("servers", s.Server)
+	v.ref("server_capabilities", s.ServerCapability)
+	return v, err
+}
+
+func validateTopology(r io.Reader) (validated, error) {
+	s, err := decodeTopology(r)
+	v := validated{names: []string{s.Name}}
+	for i := range s.Nodes {
+		v.ref("cachegroups", &s.Nodes[i].Cachegroup)
+	}
+	return v, err
+}
+
+func validateServiceCategory(r io.Reader) (validated, error) {
+	s, err := decodeServiceCategory(r)
+	return validated{names: []string{s.Name}}, err
+}
+
+func validateDeliveryService(r io.Reader) (validated, error) {
+	s, err := decodeDeliveryService(r)
+	if err != nil {
+		return validated{}, err
+	}
+	if s.XMLID == nil || *s.XMLID == "" {
+		return validated{}, errors.New("missing xmlId on Delivery Service")
+	}
+	v := validated{names: []string{*s.XMLID}}
+	if s.TypeID == nil && s.Type != nil {
+		typeName := s.Type.String()
+		v.ref("types", &typeName)
+	}
+	if s.CDNID == nil {
+		v.ref("cdns", s.CDNName)
+	}
+	if s.ProfileID == nil {
+		v.ref("profiles", s.ProfileName)
+	}
+	if s.TenantID == nil {
+		v.ref("tenants", s.Tenant)
+	}
+	v.ref("topologies", s.Topology)
+	v.ref("service_categories", s.ServiceCategory)
+	return v, nil
+}
+
+func validateDeliveryServicesRequiredCapability(r io.Reader) (validated, error) {
+	dsrc, err := decodeDeliveryServicesRequiredCapability(r)
+	v := validated{}
+	v.ref("deliveryservices", dsrc.XMLID)
+	v.ref("server_capabilities", dsrc.RequiredCapability)
+	return v, err
+}
+
+func validateDeliveryServiceServers(r io.Reader) (validated, error) {
+	dss, err := decodeDeliveryServiceServers(r)
+	v := validated{}
+	v.ref("deliveryservices", &dss.XmlId)
+	for i := range dss.ServerNames {
+		v.ref("servers", &dss.ServerNames[i])
+	}
+	return v, err
+}
+
+func validateDeliveryServiceRegexes(r io.Reader) (validated, error) {
+	dsr, err := decodeDeliveryServiceRegexes(r)
+	v := validated{}
+	v.ref("deliveryservices", &dsr.DSName)
+	for i := range dsr.Regexes {
+		v.ref("types", &dsr.Regexes[i].Type)
+	}
+	return v, err
+}
+
+func validateURLSigKeys(r io.Reader) (validated, error) {
+	keys, err := decodeURLSigKeys(r)
+	v := validated{}
+	v.ref("deliveryservices", &keys.XMLID)
+	return v, err
+}
+
+func validateOrigin(r io.Reader) (validated, error) {
+	s, err := decodeOrigin(r)
+	if err != nil {
+		return validated{}, err
+	}
+	v := validated{names: []string{*s.Name}}
+	if s.CachegroupID == nil {
+		v.ref("cachegroups", s.Cachegroup)
+	}
+	if s.DeliveryServiceID == nil {
+		v.ref("deliveryservices", s.DeliveryService)
+	}
+	if s.ProfileID == nil {
+		v.ref("profiles", s.Profile)
+	}
+	if s.CoordinateID == nil {
+		v.ref("coordinates", s.Coordinate)
+	}
+	if s.TenantID == nil {
+		v.ref("tenants", s.Tenant)
+	}
+	return v, nil
+}
+
+func validateFederation(r io.Reader) (validated, error) {
+	federation, err := decodeFederation(r)
+	if err != nil {
+		return validated{}, err
+	}
+	v := validated{}
+	xmlID := string(federation.DeliveryService)
+	if len(federation.Mappings) > 0 {
+		v.ref("deliveryservices", &xmlID)
+	}
+	resolve4, resolve6 := string(tc.FederationResolverType4), string(tc.FederationResolverType6)
+	for _, mapping := range federation.Mappings {
+		if len(mapping.Resolve4) > 0 {
+			v.ref("types", &resolve4)
+		}
+		if len(mapping.Resolve6) > 0 {
+			v.ref("types", &resolve6)
+		}
+	}
+	return v, nil
+}
+
+// validationResult is the result of validating a file.
+type validationResult struct {
+	File string `json:"file"`
+	Kind string `json:"kind"`
+	// Error is why the file would be rejected, or empty if it would be enrolled.
+	Error string `json:"error,omitempty"`
+}
+
+// validator validates the files in the watched directories against Traffic Ops without enrolling them.
+type validator struct {
+	toSession *session
+	kinds     []enrollKind
+	ignore    ignoreRules
+	// templater renders the files before they're decoded, if templating is enabled.
+	templater *templater
+	// declared is the names of the objects of each kind created by the files validated so far,
+	// which may be referenced by files of later kinds as if they existed in Traffic Ops.
+	declared map[string]map[string]struct{}
+	// found caches the references which were found in Traffic Ops, so each is only looked up once.
+	found map[reference]bool
+}
+
+func newValidator(toSession *session, kinds []enrollKind, ignore ignoreRules, tmpl *templater) *validator {
+	return &validator{
+		toSession: toSession,
+		kinds:     kinds,
+		ignore:    ignore,
+		templater: tmpl,
+		declared:  map[string]map[string]struct{}{},
+		found:     map[reference]bool{},
+	}
+}
+
+// validateDir validates the unprocessed files in the watched directories of watchDir, in the order
+// they would be enrolled, returning the result of each file.
+// The files of a kind may reference objects created by files of the same or an earlier kind, but
+// not a later one, since those wouldn't be created yet. No files are renamed.
+func (vr *validator) validateDir(watchDir string) []validationResult {
+	dw := dirWatcher{ignore: vr.ignore}
+	results := []validationResult{}
+	for _, kind := range vr.kinds {
+		path := filepath.Join(watchDir, kind.name)
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				results = append(results, validationResult{File: path, Kind: kind.name, Error: err.Error()})
+			}
+			continue
+		}
+
+		// decode every file of the kind first, so they may reference each other, e.g. parent Cache Groups
+		files := []string{}
+		kindResults := map[string]validated{}
+		kindErrs := map[string]error{}
+		for _, entry := range entries {
+			if entry.IsDir() || !isUnprocessed(entry.Name()) || dw.isIgnored(entry.Name()) {
+				continue
+			}
+			fn := filepath.Join(path, entry.Name())
+			files = append(files, fn)
+			v, err := vr.validateFile(kind, fn)
+			if err != nil {
+				kindErrs[fn] = err
+				continue
+			}
+			kindResults[fn] = v
+			for _, name := range v.names {
+				vr.declare(kind.name, name)
+			}
+		}
+
+		for _, fn := range files {
+			result := validationResult{File: fn, Kind: kind.name}
+			if err, ok := kindErrs[fn]; ok {
+				result.Error = err.Error()
+			} else if err := vr.checkRefs(kindResults[fn].refs); err != nil {
+				result.Error = err.Error()
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// validateFile decodes and validates the file fn of the given kind.
+func (vr *validator) validateFile(kind enrollKind, fn string) (validated, error) {
+	if kind.validate == nil {
+		return validated{}, errors.New("no method for validating " + kind.name)
+	}
+	fh, err := os.Open(fn)
+	if err != nil {
+		return validated{}, err
+	}
+	defer log.Close(fh, "could not close file")
+	var r io.Reader = fh
+	if vr.templater != nil {
+		if r, err = vr.templater.renderReader(fn, fh); err != nil {
+			return validated{}, err
+		}
+	}
+	v, err := kind.validate(r)
+	if err == io.EOF {
+		return v, errors.New("empty file")
+	}
+	return v, err
+}
+
+func (vr *validator) declare(kind string, name string) {
+	if name == "" {
+		return
+	}
+	if vr.declared[kind] == nil {
+		vr.declared[kind] = map[string]struct{}{}
+	}
+	vr.declared[kind][name] = struct{}{}
+}
+
+// checkRefs returns an error listing the references which are neither created by a validated file nor exist in Traffic Ops.
+func (vr *validator) checkRefs(refs []reference) error {
+	missing := []string{}
+	for _, ref := range refs {
+		if _, ok := vr.declared[ref.kind][ref.name]; ok {
+			continue
+		}
+		found, err := vr.exists(ref)
+		if err != nil {
+			return err
+		}
+		if !found {
+			missing = append(missing, ref.kind+" '"+ref.name+"'")
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("references missing " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// exists returns whether the referenced object exists in Traffic Ops.
+func (vr *validator) exists(ref reference) (bool, error) {
+	if found, ok := vr.found[ref]; ok {
+		return found, nil
+	}
+	l, ok := lookups[ref.kind]
+	if !ok {
+		return false, errors.New("no lookup for " + ref.kind)
+	}
+	opts := client.NewRequestOptions()
+	opts.QueryParameters.Set(l.param, ref.name)
+	count, err := l.count(vr.toSession, opts)
+	if err != nil {
+		return false, fmt.Errorf("looking up %s '%s': %v", ref.kind, ref.name, err)
+	}
+	vr.found[ref] = count > 0
+	return count > 0, nil
+}
+
+// writeValidationSummary writes a line for each validated file, whether it passed or failed, and the totals.
+// Returns the number of files which failed.
+func writeValidationSummary(w io.Writer, results []validationResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %s\n", result.File, result.Error)
+		} else {
+			fmt.Fprintf(w, "PASS %s\n", result.File)
+		}
+	}
+	fmt.Fprintf(w, "validated %d files: %d passed, %d failed\n", len(results), len(results)-failed, failed)
+	return failed
+}
@@ -0,0 +1,144 @@
+package main
+
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tc "github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+func TestValidateDir(t *testing.T) {
+	existing := map[string]map[string]bool{
+		"types":    {"EDGE": true, "MID_LOC": true, "EDGE_LOC": true},
+		"statuses": {"REPORTED": true},
+	}
+	var mutex sync.Mutex
+	mutations := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/user/login") {
+			http.SetCookie(w, &http.Cookie{Name: "mojolicious", Value: "session", Path: "/"})
+			json.NewEncoder(w).Encode(tc.CreateAlerts(tc.SuccessLevel, "Successfully logged in."))
+			return
+		}
+		if r.Method != http.MethodGet {
+			mutex.Lock()
+			mutations = append(mutations, r.Method+" "+r.URL.Path)
+			mutex.Unlock()
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		kind := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		name := r.URL.Query().Get("name")
+		if !existing[kind][name] {
+			w.Write([]byte(`{"response": []}`))
+			return
+		}
+		w.Write([]byte(`{"response": [{"name": "` + name + `"}]}`))
+	}))
+	defer srv.Close()
+
+	toSession, err := newSession(transportConfig{RequestTimeout: 5 * time.Second}, srv.URL, "admin", "password")
+	if err != nil {
+		t.Fatalf("creating session: %v", err)
+	}
+
+	watchDir := t.TempDir()
+	files := map[string]string{
+		"types/010-MID.json":               `{"name": "MID"}`,
+		"cdns/010-ciab.json":               `{"name": "ciab"}`,
+		"cachegroups/010-edge.json":        `{"name": "edge", "typeName": "EDGE_LOC", "parentCachegroupName": "mid"}`,
+		"cachegroups/020-mid.json":         `{"name": "mid", "typeName": "MID_LOC"}`,
+		"cachegroups/030-orphan.json":      `{"name": "orphan", "typeName": "NO_SUCH_TYPE"}`,
+		"servers/010-edge.json":            `{"hostName": "edge", "cachegroup": "edge", "cdnName": "ciab", "type": "EDGE", "status": "REPORTED"}`,
+		"servers/020-mid.json":             `{"hostName": "mid", "cachegroup": "mid", "cdnName": "ciab", "type": "MID", "physLocation": "Nowhere", "status": "REPORTED"}`,
+		"servers/030-bad.json":             `{`,
+		"servers/040-edge.json.processed":  `{`,
+		"servers/.050-edge.json.swp":       `{`,
+		"deliveryservice_servers/010.json": `{"xmlId": "demo1", "serverNames": ["edge"]}`,
+	}
+	for fn, contents := range files {
+		path := filepath.Join(watchDir, fn)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ignore, err := parseIgnorePatterns(defaultIgnorePatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := newValidator(&toSession, enrollKinds, ignoreRules{patterns: ignore}, nil).validateDir(watchDir)
+
+	expected := []struct {
+		file  string
+		error string
+	}{
+		{"types/010-MID.json", ""},
+		{"cdns/010-ciab.json", ""},
+		{"cachegroups/010-edge.json", ""},
+		{"cachegroups/020-mid.json", ""},
+		{"cachegroups/030-orphan.json", "references missing types 'NO_SUCH_TYPE'"},
+		{"servers/010-edge.json", ""},
+		{"servers/020-mid.json", "references missing phys_locations 'Nowhere'"},
+		{"servers/030-bad.json", "unexpected EOF"},
+		{"deliveryservice_servers/010.json", "references missing deliveryservices 'demo1'"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %d: %+v", len(expected), len(results), results)
+	}
+	for i, result := range results {
+		if result.File != filepath.Join(watchDir, expected[i].file) {
+			t.Errorf("expected result %d to be of %s, got %s", i, expected[i].file, result.File)
+		}
+		if result.Error != expected[i].error {
+			t.Errorf("expected %s to have error '%s', got '%s'", expected[i].file, expected[i].error, result.Error)
+		}
+	}
+
+	if len(mutations) != 0 {
+		t.Errorf("expected no changes to Traffic Ops, got %v", mutations)
+	}
+	for fn := range files {
+		if _, err := os.Stat(filepath.Join(watchDir, fn)); err != nil {
+			t.Errorf("expected %s not to be renamed: %v", fn, err)
+		}
+	}
+
+	buf := bytes.Buffer{}
+	if failed := writeValidationSummary(&buf, results); failed != 4 {
+		t.Errorf("expected 4 failed files, got %d", failed)
+	}
+	if !strings.HasSuffix(buf.String(), "validated 9 files: 5 passed, 4 failed\n") {
+		t.Errorf("expected the summary to end with the totals, got %s", buf.String())
+	}
+}
@@ -32,6 +32,7 @@ const (
 	LastModified      = "Last-Modified"     // RFC7232§2.2
 	ETagHeader        = "ETag"
 	IfMatch           = "If-Match"
+	IfNoneMatch       = "If-None-Match" // RFC7232§3.2
 	IfUnmodifiedSince = "If-Unmodified-Since"
 	Date              = "Date"
 	ETagVersion       = 1
@@ -76,6 +77,22 @@ func ParseETag(e string) (time.Time, error) {
 	return t, nil
 }
 
+// ETagMatches returns whether the entity tag etag, a complete ETag header value including quotes, matches the value of an
+// If-None-Match header, which is either "*" or a list of entity tags. Per RFC7232§3.2, tags are compared weakly, so a
+// weak tag (prefixed with W/) matches the strong tag with the same value.
+func ETagMatches(ifNoneMatch string, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
 // GetUnmodifiedTime gets the latest time out of the Etags (if present), or the If-Unmodified-Since (if present)
 func GetUnmodifiedTime(h http.Header) (time.Time, bool) {
 	if h == nil {
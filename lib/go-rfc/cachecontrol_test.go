@@ -42,3 +42,21 @@ func TestETag(t *testing.T) {
 		t.Errorf("Expected time %v, actual %v", "2020-08-06 18:11:22.278418 +0000 UTC", ans.UTC().String())
 	}
 }
+
+func TestETagMatches(t *testing.T) {
+	etag := `"abc"`
+	matches := []string{`"abc"`, `W/"abc"`, `"xyz", "abc"`, ` "xyz" , W/"abc"`, `*`}
+	for _, ifNoneMatch := range matches {
+		if !ETagMatches(ifNoneMatch, etag) {
+			t.Errorf("expected %s to match %s", ifNoneMatch, etag)
+		}
+	}
+	for _, ifNoneMatch := range []string{``, `abc`, `"ab"`, `"xyz", "abcd"`} {
+		if ETagMatches(ifNoneMatch, etag) {
+			t.Errorf("expected %s not to match %s", ifNoneMatch, etag)
+		}
+	}
+	if !ETagMatches(`"abc"`, `W/"abc"`) {
+		t.Errorf("expected a weak ETag to match its strong tag")
+	}
+}
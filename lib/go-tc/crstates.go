@@ -46,6 +46,32 @@ type IsAvailable struct {
 	LastPoll       time.Time `json:"lastPoll"`
 }
 
+// CRStatesDelta is the change of CRStates since a version of them, as served
+// by Traffic Monitor's /publish/CrStates?since=<version> endpoint, so clients
+// polling often don't need to fetch every state each time.
+type CRStatesDelta struct {
+	// Version is the version of the states after the delta is applied, to
+	// request the next delta since.
+	Version uint64 `json:"version"`
+	// Since is the version the delta is since. It's zero when Full.
+	Since uint64 `json:"since"`
+	// Full is whether Caches and DeliveryService are every state, rather than
+	// only those changed since the requested version, e.g. on first connect or
+	// when the requested version is too old. Clients must then replace their
+	// states, rather than apply the delta to them.
+	Full bool `json:"full"`
+	// Caches are the states of the caches added or changed since the version.
+	Caches map[CacheName]IsAvailable `json:"caches"`
+	// DeliveryService are the states of the Delivery Services added or changed
+	// since the version.
+	DeliveryService map[DeliveryServiceName]CRStatesDeliveryService `json:"deliveryServices"`
+	// RemovedCaches are the caches removed since the version.
+	RemovedCaches []CacheName `json:"removedCaches"`
+	// RemovedDeliveryServices are the Delivery Services removed since the
+	// version.
+	RemovedDeliveryServices []DeliveryServiceName `json:"removedDeliveryServices"`
+}
+
 // NewCRStates creates a new CR states object, initializing pointer members.
 func NewCRStates(cacheCap, dsCap int) CRStates {
 	return CRStates{
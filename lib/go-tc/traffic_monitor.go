@@ -500,8 +500,28 @@ type TMParameters struct {
 	HealthPollingURL        string `json:"health.polling.url"`
 	HealthPollingFormat     string `json:"health.polling.format"`
 	HealthPollingType       string `json:"health.polling.type"`
-	HistoryCount            int    `json:"history.count"`
-	MinFreeKbps             int64
+	// HealthPollingMaxResponseBytes is the largest response body, in bytes,
+	// that Traffic Monitor reads when polling cache servers using the
+	// Profile. Larger responses are poll failures. Zero means the default.
+	HealthPollingMaxResponseBytes int64 `json:"health.polling.max.response.bytes,omitempty"`
+	// HealthPollingMaxRedirects is the number of HTTP redirects Traffic
+	// Monitor follows when polling cache servers using the Profile. Zero
+	// follows none, so a redirect is a poll failure.
+	HealthPollingMaxRedirects int `json:"health.polling.max.redirects,omitempty"`
+	// HealthPollingRedirectHosts is a comma-separated list of the hosts,
+	// besides the polled host, which cache servers using the Profile may be
+	// redirected to.
+	HealthPollingRedirectHosts string `json:"health.polling.redirect.hosts,omitempty"`
+	// HeartbeatPollingInterval is the interval in milliseconds on which
+	// cache servers using the Profile are health polled, overriding the
+	// monitoring config's heartbeat.polling.interval. Zero means no override.
+	HeartbeatPollingInterval int `json:"heartbeat.polling.interval,omitempty"`
+	// StatPollingInterval is the interval in milliseconds on which cache
+	// servers using the Profile are stat polled, overriding the monitoring
+	// config's health.polling.interval. Zero means no override.
+	StatPollingInterval int `json:"stat.polling.interval,omitempty"`
+	HistoryCount        int `json:"history.count"`
+	MinFreeKbps         int64
 	// HealthThresholdJSONParameters contains the Parameters contained in the
 	// Thresholds field, formatted as individual string Parameters, rather than as
 	// a JSON object.
@@ -607,6 +627,46 @@ func (params *TMParameters) UnmarshalJSON(bytes []byte) (err error) {
 		}
 	}
 
+	if vi, ok := raw["health.polling.max.response.bytes"]; ok {
+		if v, ok := vi.(float64); !ok {
+			return fmt.Errorf("Unmarshalling TMParameters health.polling.max.response.bytes expected integer, got %v", vi)
+		} else {
+			params.HealthPollingMaxResponseBytes = int64(v)
+		}
+	}
+
+	if vi, ok := raw["health.polling.max.redirects"]; ok {
+		if v, ok := vi.(float64); !ok {
+			return fmt.Errorf("Unmarshalling TMParameters health.polling.max.redirects expected integer, got %v", vi)
+		} else {
+			params.HealthPollingMaxRedirects = int(v)
+		}
+	}
+
+	if vi, ok := raw["health.polling.redirect.hosts"]; ok {
+		if v, ok := vi.(string); !ok {
+			return fmt.Errorf("Unmarshalling TMParameters health.polling.redirect.hosts expected string, got %v", vi)
+		} else {
+			params.HealthPollingRedirectHosts = v
+		}
+	}
+
+	if vi, ok := raw["heartbeat.polling.interval"]; ok {
+		if v, ok := vi.(float64); !ok {
+			return fmt.Errorf("Unmarshalling TMParameters heartbeat.polling.interval expected integer, got %v", vi)
+		} else {
+			params.HeartbeatPollingInterval = int(v)
+		}
+	}
+
+	if vi, ok := raw["stat.polling.interval"]; ok {
+		if v, ok := vi.(float64); !ok {
+			return fmt.Errorf("Unmarshalling TMParameters stat.polling.interval expected integer, got %v", vi)
+		} else {
+			params.StatPollingInterval = int(v)
+		}
+	}
+
 	if vi, ok := raw["history.count"]; ok {
 		if v, ok := vi.(float64); !ok {
 			return fmt.Errorf("Unmarshalling TMParameters history.count expected integer, got %v", vi)
@@ -193,6 +193,11 @@ func ExampleTMParameters_UnmarshalJSON() {
 		"health.connection.timeout": 5,
 		"health.polling.url": "https://example.com/",
 		"health.polling.format": "stats_over_http",
+		"health.polling.max.response.bytes": 1048576,
+		"health.polling.max.redirects": 2,
+		"health.polling.redirect.hosts": "stats.example.com",
+		"heartbeat.polling.interval": 1000,
+		"stat.polling.interval": 6000,
 		"history.count": 1,
 		"health.threshold.bandwidth": ">50",
 		"health.threshold.foo": "<=500"
@@ -206,12 +211,20 @@ func ExampleTMParameters_UnmarshalJSON() {
 	fmt.Printf("timeout: %d\n", params.HealthConnectionTimeout)
 	fmt.Printf("url: %s\n", params.HealthPollingURL)
 	fmt.Printf("format: %s\n", params.HealthPollingFormat)
+	fmt.Printf("max response bytes: %d\n", params.HealthPollingMaxResponseBytes)
+	fmt.Printf("max redirects: %d - hosts: %s\n", params.HealthPollingMaxRedirects, params.HealthPollingRedirectHosts)
+	fmt.Printf("heartbeat interval: %d\n", params.HeartbeatPollingInterval)
+	fmt.Printf("stat interval: %d\n", params.StatPollingInterval)
 	fmt.Printf("history: %d\n", params.HistoryCount)
 	fmt.Printf("# of Thresholds: %d - foo: %s, bandwidth: %s\n", len(params.Thresholds), params.Thresholds["foo"], params.Thresholds["bandwidth"])
 
 	// Output: timeout: 5
 	// url: https://example.com/
 	// format: stats_over_http
+	// max response bytes: 1048576
+	// max redirects: 2 - hosts: stats.example.com
+	// heartbeat interval: 1000
+	// stat interval: 6000
 	// history: 1
 	// # of Thresholds: 2 - foo: <=500.000000, bandwidth: >50.000000
 }
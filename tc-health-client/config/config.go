@@ -54,6 +54,7 @@ const (
 	DefaultTOLoginDispersionFactor  = 90
 	DefaultTrafficServerConfigDir   = "/opt/trafficserver/etc/trafficserver"
 	DefaultTrafficServerBinDir      = "/opt/trafficserver/bin"
+	DefaultTrafficServerRPCSocket   = "var/trafficserver/jsonrpc20.sock"
 	DefaultUnavailablePollThreshold = 2
 	DefaultMarkupPollThreshold      = 1
 )
@@ -74,12 +75,22 @@ type Cfg struct {
 	MarkUpPollThreshold      int             `json:"markup-poll-threshold"`
 	TrafficServerConfigDir   string          `json:"trafficserver-config-dir"`
 	TrafficServerBinDir      string          `json:"trafficserver-bin-dir"`
+	TrafficServerRPCSocket   string          `json:"trafficserver-rpc-socket"`
 	PollStateJSONLog         string          `json:"poll-state-json-log"`
 	EnablePollStateLog       bool            `json:"enable-poll-state-log"`
+	ParentMaxAge             string          `json:"parent-max-age"`
+	MarkCooldown             string          `json:"mark-cooldown"`
 	TrafficMonitors          map[string]bool `json:"trafficmonitors,omitempty"`
 	HealthClientConfigFile   util.ConfigFile
 	CredentialFile           util.ConfigFile
 	ParsedProxyURL           *url.URL
+	// ParsedParentMaxAge is the parsed ParentMaxAge. Zero disables evicting stale parents.
+	ParsedParentMaxAge time.Duration
+	// ParsedMarkCooldown is the parsed MarkCooldown. Zero disables the cooldown.
+	ParsedMarkCooldown time.Duration
+	// DiagnosticsAddress is the address the diagnostics endpoint listens on,
+	// set by the --diagnostics-address option. Empty disables the endpoint.
+	DiagnosticsAddress string `json:"-"`
 }
 
 type LogCfg struct {
@@ -160,6 +171,7 @@ func GetConfig() (Cfg, error, bool) {
 	configFilePtr := getopt.StringLong("config-file", 'f', DefaultConfigFile, "full path to the json config file")
 	logdirPtr := getopt.StringLong("logging-dir", 'l', DefaultLogDirectory, "directory location for log files")
 	helpPtr := getopt.BoolLong("help", 'h', "Print usage information and exit")
+	diagnosticsPtr := getopt.StringLong("diagnostics-address", 'd', "", "address to serve the diagnostics dump on, e.g. localhost:8090. Disabled by default")
 	verbosePtr := getopt.CounterLong("verbose", 'v', `Log verbosity. Logging is output to stderr. By default, errors are logged. To log warnings, pass '-v'. To log info, pass '-vv', debug pass '-vvv'`)
 
 	getopt.Parse()
@@ -219,6 +231,7 @@ func GetConfig() (Cfg, error, bool) {
 	cfg := Cfg{
 		HealthClientConfigFile: cf,
 		CredentialFile:         util.ConfigFile{},
+		DiagnosticsAddress:     *diagnosticsPtr,
 	}
 
 	if _, err = LoadConfig(&cfg); err != nil {
@@ -375,6 +388,11 @@ func LoadConfig(cfg *Cfg) (bool, error) {
 			cfg.TrafficServerBinDir = DefaultTrafficServerBinDir
 		}
 
+		// the ATS JSON-RPC socket is in the runtime dir, relative to the bin dir by default.
+		if cfg.TrafficServerRPCSocket == "" {
+			cfg.TrafficServerRPCSocket = filepath.Join(filepath.Dir(cfg.TrafficServerBinDir), DefaultTrafficServerRPCSocket)
+		}
+
 		if cfg.UnavailablePollThreshold == 0 {
 			cfg.UnavailablePollThreshold = DefaultUnavailablePollThreshold
 		}
@@ -383,6 +401,28 @@ func LoadConfig(cfg *Cfg) (bool, error) {
 			cfg.PollStateJSONLog = DefaultPollStateJSONLog
 		}
 
+		cfg.ParsedParentMaxAge = 0
+		if cfg.ParentMaxAge != "" {
+			cfg.ParsedParentMaxAge, err = time.ParseDuration(cfg.ParentMaxAge)
+			if err != nil {
+				return updated, errors.New("parsing ParentMaxAge: " + err.Error())
+			}
+			if cfg.ParsedParentMaxAge < 0 {
+				return updated, errors.New("invalid parent-max-age: " + cfg.ParentMaxAge + ", must not be negative")
+			}
+		}
+
+		cfg.ParsedMarkCooldown = 0
+		if cfg.MarkCooldown != "" {
+			cfg.ParsedMarkCooldown, err = time.ParseDuration(cfg.MarkCooldown)
+			if err != nil {
+				return updated, errors.New("parsing MarkCooldown: " + err.Error())
+			}
+			if cfg.ParsedMarkCooldown < 0 {
+				return updated, errors.New("invalid mark-cooldown: " + cfg.MarkCooldown + ", must not be negative")
+			}
+		}
+
 		cfg.HealthClientConfigFile.LastModifyTime = modTime
 
 		// 設定ファイル中のto-credential-fileの値が空でない場合
@@ -434,10 +474,15 @@ func UpdateConfig(cfg *Cfg, newCfg *Cfg) {
 	cfg.UnavailablePollThreshold = newCfg.UnavailablePollThreshold
 	cfg.TrafficServerConfigDir = newCfg.TrafficServerConfigDir
 	cfg.TrafficServerBinDir = newCfg.TrafficServerBinDir
+	cfg.TrafficServerRPCSocket = newCfg.TrafficServerRPCSocket
 	cfg.TrafficMonitors = newCfg.TrafficMonitors
 	cfg.HealthClientConfigFile = newCfg.HealthClientConfigFile
 	cfg.PollStateJSONLog = newCfg.PollStateJSONLog
 	cfg.EnablePollStateLog = newCfg.EnablePollStateLog
+	cfg.ParentMaxAge = newCfg.ParentMaxAge
+	cfg.ParsedParentMaxAge = newCfg.ParsedParentMaxAge
+	cfg.MarkCooldown = newCfg.MarkCooldown
+	cfg.ParsedMarkCooldown = newCfg.ParsedMarkCooldown
 }
 
 func Usage() {
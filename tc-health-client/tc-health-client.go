@@ -76,6 +76,14 @@ func main() {
 		os.Exit(RunTimeError)  // 167
 	}
 
+	// --diagnostics-address(-d)が指定されていれば診断情報のエンドポイントを起動する
+	if cfg.DiagnosticsAddress != "" {
+		if err := tmInfo.StartDiagnosticsServer(cfg.DiagnosticsAddress); err != nil {
+			log.Errorf("startup could not start the diagnostics server: %s\n", err.Error())
+			os.Exit(RunTimeError)  // 167
+		}
+	}
+
 	// プロセスのPIDの取得
 	pid := os.Getpid()
 
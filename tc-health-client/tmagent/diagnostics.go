@@ -0,0 +1,133 @@
+package tmagent
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/tc-health-client/config"
+)
+
+const (
+	// DiagnosticsPath is the path the diagnostics dump is served on.
+	DiagnosticsPath = "/diagnostics"
+	// the value replacing secrets in the diagnostics dump.
+	redacted = "*****"
+)
+
+// Diagnostics is the state served by the diagnostics endpoint. It is the
+// poll state written to the 'poll-state-json-log' plus the last poll result
+// and the known Traffic Monitors, taken at the end of each polling cycle.
+type Diagnostics struct {
+	LastPollTime    time.Time               `json:"last-poll-time"`
+	LastPollError   string                  `json:"last-poll-error,omitempty"`
+	TrafficMonitors map[string]bool         `json:"trafficmonitors"`
+	Parents         map[string]ParentStatus `json:"parents"`
+	PollCycles      PollCycleStats          `json:"poll-cycles"`
+	Config          config.Cfg              `json:"config"`
+}
+
+// the latest diagnostics snapshot, marshaled by the polling loop and
+// served as is, so requests never read the parents map while it changes.
+type diagnosticsState struct {
+	m    sync.RWMutex
+	data []byte
+}
+
+func (d *diagnosticsState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	d.m.RLock()
+	data := d.data
+	d.m.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// StartDiagnosticsServer starts serving the diagnostics dump on addr at
+// DiagnosticsPath. It must be called before PollAndUpdateCacheStatus.
+func (c *ParentInfo) StartDiagnosticsServer(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening for diagnostics on %s: %w", addr, err)
+	}
+	c.diagnostics = &diagnosticsState{}
+	c.updateDiagnostics(time.Time{}, nil)
+
+	mux := http.NewServeMux()
+	mux.Handle(DiagnosticsPath, c.diagnostics)
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			log.Errorf("diagnostics server on %s stopped: %s\n", addr, err.Error())
+		}
+	}()
+	log.Infof("serving diagnostics on %s%s\n", ln.Addr().String(), DiagnosticsPath)
+	return nil
+}
+
+// updateDiagnostics takes a new diagnostics snapshot if the diagnostics
+// endpoint is enabled.
+func (c *ParentInfo) updateDiagnostics(pollTime time.Time, pollErr error) {
+	if c.diagnostics == nil {
+		return
+	}
+	diag := Diagnostics{
+		LastPollTime:    pollTime,
+		TrafficMonitors: c.Cfg.TrafficMonitors,
+		Parents:         c.Parents,
+		PollCycles:      c.PollCycles,
+		Config:          redactConfig(c.Cfg),
+	}
+	if pollErr != nil {
+		diag.LastPollError = pollErr.Error()
+	}
+	data, err := json.MarshalIndent(diag, "", "\t")
+	if err != nil {
+		log.Errorf("marshaling diagnostics: %s\n", err.Error())
+		return
+	}
+	c.diagnostics.m.Lock()
+	c.diagnostics.data = data
+	c.diagnostics.m.Unlock()
+}
+
+// returns a copy of cfg safe to show in the diagnostics dump. The Traffic
+// Monitors are left out, they are listed on their own.
+func redactConfig(cfg config.Cfg) config.Cfg {
+	if cfg.TOPass != "" {
+		cfg.TOPass = redacted
+	}
+	if u, err := url.Parse(cfg.TmProxyURL); err == nil && u.User != nil {
+		cfg.TmProxyURL = u.Redacted()
+	}
+	cfg.ParsedProxyURL = nil
+	cfg.TrafficMonitors = nil
+	return cfg
+}
@@ -0,0 +1,172 @@
+package tmagent
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// the timeout for a single request to the trafficserver JSON-RPC socket.
+const rpcTimeout = 5 * time.Second
+
+// the prefix of the trafficserver HostStatus records.
+const hostStatusRecordPrefix = "proxy.process.host_status."
+
+// the trafficserver record types of metrics: process, node, and plugin.
+var metricRecordTypes = []string{"2", "4", "32"}
+
+var rpcRequestID uint64
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+	ID      string      `json:"id"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"data,omitempty"`
+}
+
+func (e rpcError) Error() string {
+	msg := fmt.Sprintf("code %d: %s", e.Code, e.Message)
+	for _, d := range e.Data {
+		msg += fmt.Sprintf("; code %d: %s", d.Code, d.Message)
+	}
+	return msg
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+	ID     string          `json:"id"`
+}
+
+// the trafficserver 'admin_lookup_records' result.
+type rpcRecordLookupResult struct {
+	RecordList []struct {
+		Record struct {
+			RecordName   string `json:"record_name"`
+			CurrentValue string `json:"current_value"`
+		} `json:"record"`
+	} `json:"recordList"`
+	ErrorList []struct {
+		RecordName string `json:"record_name"`
+		Code       string `json:"code"`
+	} `json:"errorList"`
+}
+
+// returns the trafficserver JSON-RPC socket path if the socket is present,
+// otherwise an empty string, in which case traffic_ctl should be used.
+func (c *ParentInfo) rpcSocket() string {
+	sock := c.Cfg.TrafficServerRPCSocket
+	if sock == "" {
+		return ""
+	}
+	if fi, err := os.Stat(sock); err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return ""
+	}
+	return sock
+}
+
+// makes a single JSON-RPC 2.0 call to the trafficserver JSON-RPC socket,
+// decoding the result into result if it's not nil.
+func rpcCall(sock string, method string, params interface{}, result interface{}) error {
+	conn, err := net.DialTimeout("unix", sock, rpcTimeout)
+	if err != nil {
+		return errors.New("connecting to " + sock + ": " + err.Error())
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(rpcTimeout)); err != nil {
+		return errors.New("setting deadline: " + err.Error())
+	}
+
+	req := rpcRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      strconv.FormatUint(atomic.AddUint64(&rpcRequestID, 1), 10),
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return errors.New("sending " + method + " request: " + err.Error())
+	}
+
+	resp := rpcResponse{}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return errors.New("reading " + method + " response: " + err.Error())
+	}
+	if resp.Error != nil {
+		return errors.New(method + " error: " + resp.Error.Error())
+	}
+	if result != nil {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return errors.New("decoding " + method + " result: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// reads the HostStatus records over the trafficserver JSON-RPC socket,
+// returning them in the same format as the ATS version 9 'traffic_ctl metric
+// match host_status' output, one 'record value' per line.
+func rpcReadHostStatus(sock string) ([]byte, error) {
+	params := []map[string]interface{}{
+		{
+			"record_name_regex": hostStatusRecordPrefix,
+			"rec_types":         metricRecordTypes,
+		},
+	}
+	result := rpcRecordLookupResult{}
+	if err := rpcCall(sock, "admin_lookup_records", params, &result); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	for _, rec := range result.RecordList {
+		out.WriteString(rec.Record.RecordName + " " + rec.Record.CurrentValue + "\n")
+	}
+	return out.Bytes(), nil
+}
+
+// marks a parent up or down in the trafficserver HostStatus subsystem over
+// the trafficserver JSON-RPC socket.
+func rpcSetHostStatus(sock string, fqdn string, status string, reason string) error {
+	params := map[string]interface{}{
+		"operation": status,
+		"host":      []string{fqdn},
+		"reason":    reason,
+		"time":      "0",
+	}
+	return rpcCall(sock, "admin_host_set_status", params, nil)
+}
@@ -0,0 +1,130 @@
+package tmagent
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/trafficcontrol/tc-health-client/config"
+)
+
+// serves trafficserver JSON-RPC requests on a unix socket, answering with the
+// given result for each method, and sending the received requests on reqs.
+func startTestRPCServer(t *testing.T, results map[string]string, reqs chan<- map[string]interface{}) string {
+	sock := filepath.Join(t.TempDir(), "jsonrpc20.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listening on %s: %s\n", sock, err.Error())
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			req := map[string]interface{}{}
+			if err := json.NewDecoder(conn).Decode(&req); err != nil {
+				conn.Close()
+				continue
+			}
+			if reqs != nil {
+				reqs <- req
+			}
+			method, _ := req["method"].(string)
+			conn.Write([]byte(`{"jsonrpc":"2.0","result":` + results[method] + `,"id":"` + req["id"].(string) + `"}`))
+			conn.Close()
+		}
+	}()
+	return sock
+}
+
+func TestReadHostStatusRPC(t *testing.T) {
+	sock := startTestRPCServer(t, map[string]string{
+		"admin_lookup_records": `{"recordList":[` +
+			`{"record":{"record_name":"proxy.process.host_status.cdn-cache-01.foo.com","current_value":"HOST_STATUS_DOWN,ACTIVE:DOWN:0:0,LOCAL:UP:0:0,MANUAL:UP:0:0,SELF_DETECT:UP:0"}},` +
+			`{"record":{"record_name":"proxy.process.host_status.cdn-cache-02.foo.com","current_value":"HOST_STATUS_UP,ACTIVE:UP:0:0,LOCAL:UP:0:0,MANUAL:UP:0:0,SELF_DETECT:UP:0"}}` +
+			`],"errorList":[]}`,
+	}, nil)
+
+	pi := ParentInfo{
+		TrafficServerBinDir: "/nonexistent",
+		Cfg: config.Cfg{
+			ReasonCode:             "active",
+			TrafficServerRPCSocket: sock,
+		},
+	}
+
+	parentStatus := make(map[string]ParentStatus)
+	if err := pi.readHostStatus(parentStatus); err != nil {
+		t.Fatalf("failed readHostStatus(): %s\n", err.Error())
+	}
+	if len(parentStatus) != 2 {
+		t.Fatalf("failed readHostStatus(): expected 2 parents got %d\n", len(parentStatus))
+	}
+	if pstat := parentStatus["cdn-cache-01"]; pstat.Fqdn != "cdn-cache-01.foo.com" || pstat.Status() != "DOWN" {
+		t.Fatalf("expected cdn-cache-01.foo.com DOWN, got %s %s\n", pstat.Fqdn, pstat.Status())
+	}
+	if pstat := parentStatus["cdn-cache-02"]; pstat.Fqdn != "cdn-cache-02.foo.com" || pstat.Status() != "UP" {
+		t.Fatalf("expected cdn-cache-02.foo.com UP, got %s %s\n", pstat.Fqdn, pstat.Status())
+	}
+}
+
+func TestExecTrafficCtlRPC(t *testing.T) {
+	reqs := make(chan map[string]interface{}, 1)
+	sock := startTestRPCServer(t, map[string]string{"admin_host_set_status": `{}`}, reqs)
+
+	pi := ParentInfo{
+		TrafficServerBinDir: "/nonexistent",
+		Cfg: config.Cfg{
+			ReasonCode:             "active",
+			TrafficServerRPCSocket: sock,
+		},
+	}
+
+	if err := pi.execTrafficCtl("cdn-cache-01.foo.com", false); err != nil {
+		t.Fatalf("failed execTrafficCtl(): %s\n", err.Error())
+	}
+
+	req := <-reqs
+	if req["method"] != "admin_host_set_status" {
+		t.Fatalf("expected method 'admin_host_set_status' got %v\n", req["method"])
+	}
+	params, _ := req["params"].(map[string]interface{})
+	if params["operation"] != "down" || params["reason"] != "active" {
+		t.Fatalf("expected operation 'down' and reason 'active' got %v\n", params)
+	}
+	if hosts, _ := params["host"].([]interface{}); len(hosts) != 1 || hosts[0] != "cdn-cache-01.foo.com" {
+		t.Fatalf("expected host ['cdn-cache-01.foo.com'] got %v\n", params["host"])
+	}
+}
+
+func TestRPCSocketFallback(t *testing.T) {
+	pi := ParentInfo{
+		Cfg: config.Cfg{TrafficServerRPCSocket: filepath.Join(t.TempDir(), "missing.sock")},
+	}
+	if sock := pi.rpcSocket(); sock != "" {
+		t.Fatalf("expected no socket when the socket is missing, got %s\n", sock)
+	}
+}
@@ -47,6 +47,11 @@ const (
 	TrafficCtl     = "traffic_ctl"
 	ParentsFile    = "parent.config"
 	StrategiesFile = "strategies.yaml"
+	// the number of consecutive polling cycles longer than the polling
+	// interval before warning that polling can't keep up.
+	SlowPollCycleWarnThreshold = 3
+	// the minimum time between slow polling cycle warnings.
+	SlowPollCycleWarnInterval = 10 * time.Minute
 )
 
 // this global is used to auto select the
@@ -71,6 +76,25 @@ type ParentInfo struct {
 	TrafficServerConfigDir string
 	Parents                map[string]ParentStatus
 	Cfg                    config.Cfg
+	// the host names of the parents currently in 'parent.config' and
+	// 'strategies.yaml', used to decide whether a stale parent may be evicted.
+	parentConfigHosts map[string]struct{}
+	strategiesHosts   map[string]struct{}
+	// the diagnostics endpoint state, nil when the endpoint is disabled.
+	diagnostics *diagnosticsState
+	// how long polling cycles take compared to the polling interval.
+	PollCycles PollCycleStats
+}
+
+// PollCycleStats tracks how long polling cycles take. A cycle is slow when it
+// takes longer than the polling interval, the client then can't keep up with
+// its polling cadence and markdowns may be delayed.
+type PollCycleStats struct {
+	LastCycleSeconds      float64
+	ConsecutiveSlowCycles int
+	SlowCycles            uint64
+	// the last time a slow cycle warning was logged.
+	lastSlowWarning time.Time
 }
 
 // when reading the 'strategies.yaml', these fields are used to help
@@ -94,6 +118,8 @@ type ParentStatus struct {
 	LastTmPoll           int64
 	UnavailablePollCount int
 	MarkUpPollCount      int
+	// the unix time the parent was last marked up or down, zero if never.
+	LastMarkTime int64
 }
 
 // used to get the overall parent availablity from the
@@ -299,6 +325,7 @@ func (c *ParentInfo) PollAndUpdateCacheStatus() {
 	for {
 
 		pollingInterval := config.GetTMPollingInterval()
+		cycleStart := time.Now()
 
 		// check for config file updates
 		newCfg := config.Cfg{
@@ -328,6 +355,11 @@ func (c *ParentInfo) PollAndUpdateCacheStatus() {
 					// 既存の設定情報の更新を行う
 					config.UpdateConfig(&c.Cfg, &newCfg)
 					log.Infoln("the configuration has been successfully updated")
+
+					// trafficserver-config-dirが変更された場合には新しいディレクトリのparent.configとstrategies.yamlを読み直す
+					if err := c.updateTrafficServerDirs(); err != nil {
+						log.Errorf("could not load ATS parent info from the new trafficserver config dir: %s\n", err.Error())
+					}
 				}
 
 			}
@@ -373,6 +405,7 @@ func (c *ParentInfo) PollAndUpdateCacheStatus() {
 			// キャッシュサーバの取得ができなかった場合
 
 			log.Errorf("error in TrafficMonitor polling: %s\n", err.Error())
+			pollErr := err
 
 			// TrafficMonitorの情報を取得する
 			if err = config.GetTrafficMonitors(&c.Cfg); err != nil {
@@ -388,6 +421,8 @@ func (c *ParentInfo) PollAndUpdateCacheStatus() {
 					log.Errorf("could not write the poll state log: %s\n", err.Error())
 				}
 			}
+			c.recordPollCycle(time.Since(cycleStart), pollingInterval)
+			c.updateDiagnostics(time.Unix(now, 0), pollErr)
 
 			time.Sleep(pollingInterval)
 			continue
@@ -431,6 +466,9 @@ func (c *ParentInfo) PollAndUpdateCacheStatus() {
 			}
 		}
 
+		// remove parents that are no longer in TM results or the ATS configs.
+		c.evictStaleParents(now)
+
 		// periodically update the TrafficMonitor list and statuses
 		// 定期的にTrafficMonitorのリストやステータスを更新する。
 		if toLoginDispersion <= 0 {
@@ -453,6 +491,8 @@ func (c *ParentInfo) PollAndUpdateCacheStatus() {
 			toLoginDispersion -= pollingInterval
 		}
 
+		c.recordPollCycle(time.Since(cycleStart), pollingInterval)
+
 		// log the poll state data if enabled
 		// 設定ファイル中の「enable-poll-state-log」がtrueならば、実行される
 		if c.Cfg.EnablePollStateLog {
@@ -461,6 +501,7 @@ func (c *ParentInfo) PollAndUpdateCacheStatus() {
 				log.Errorf("could not write the poll state log: %s\n", err.Error())
 			}
 		}
+		c.updateDiagnostics(time.Unix(now, 0), nil)
 
 		// 無限ループで実行されている次の処理まで、ここで指定された時間だけsleepする
 		time.Sleep(pollingInterval)
@@ -517,6 +558,79 @@ func (c *ParentInfo) UpdateParentInfo() error {
 	return nil
 }
 
+// Used after a config reload to switch to changed trafficserver config
+// and bin directories.  When the config directory changed, the
+// 'parent.config' and 'strategies.yaml' in the new directory are read
+// right away, parents only listed in the old files are left to be
+// evicted as stale, and subsequent polls watch the new files.
+func (c *ParentInfo) updateTrafficServerDirs() error {
+	if c.TrafficServerBinDir != c.Cfg.TrafficServerBinDir {
+		log.Infof("trafficserver bin dir changed from %s to %s\n", c.TrafficServerBinDir, c.Cfg.TrafficServerBinDir)
+		c.TrafficServerBinDir = c.Cfg.TrafficServerBinDir
+	}
+
+	if c.TrafficServerConfigDir == c.Cfg.TrafficServerConfigDir {
+		return nil
+	}
+
+	log.Infof("trafficserver config dir changed from %s to %s\n", c.TrafficServerConfigDir, c.Cfg.TrafficServerConfigDir)
+	c.TrafficServerConfigDir = c.Cfg.TrafficServerConfigDir
+
+	// a zero LastModifyTime makes UpdateParentInfo read the files again
+	// if reading them here fails.
+	c.ParentDotConfig = util.ConfigFile{
+		Filename: filepath.Join(c.TrafficServerConfigDir, ParentsFile),
+	}
+	c.StrategiesDotYaml = util.ConfigFile{
+		Filename: filepath.Join(c.TrafficServerConfigDir, StrategiesFile),
+	}
+
+	if c.Parents == nil {
+		c.Parents = make(map[string]ParentStatus)
+	}
+	if err := c.readParentConfig(c.Parents); err != nil {
+		c.ParentDotConfig.LastModifyTime = 0
+		return errors.New("loading " + ParentsFile + " file: " + err.Error())
+	}
+	if err := c.readStrategies(c.Parents); err != nil {
+		c.StrategiesDotYaml.LastModifyTime = 0
+		return errors.New("loading parent " + StrategiesFile + " file: " + err.Error())
+	}
+
+	log.Infof("loaded parents from %s, total parents: %d\n", c.TrafficServerConfigDir, len(c.Parents))
+	return nil
+}
+
+// removes parents whose last Traffic Monitor poll is older than the
+// configured parent-max-age, and which are no longer listed in
+// 'parent.config' or 'strategies.yaml'.  Parents that have never been
+// seen in Traffic Monitor results are not evicted.
+func (c *ParentInfo) evictStaleParents(now int64) {
+	maxAge := c.Cfg.ParsedParentMaxAge
+	if maxAge <= 0 {
+		return
+	}
+
+	for hostName, pstat := range c.Parents {
+		if pstat.LastTmPoll == 0 {
+			continue
+		}
+		age := time.Duration(now-pstat.LastTmPoll) * time.Second
+		if age <= maxAge {
+			continue
+		}
+		if _, ok := c.parentConfigHosts[hostName]; ok {
+			continue
+		}
+		if _, ok := c.strategiesHosts[hostName]; ok {
+			continue
+		}
+		delete(c.Parents, hostName)
+		log.Infof("evicted parent '%s', last seen in Traffic Monitor results %v ago and no longer in %s or %s\n",
+			hostName, age, ParentsFile, StrategiesFile)
+	}
+}
+
 // 「/var/log/trafficcontrol/poll-state.json」にログ情報を書き込みます
 func (c *ParentInfo) WritePollState() error {
 	data, err := json.MarshalIndent(c, "", "\t")
@@ -532,6 +646,29 @@ func (c *ParentInfo) WritePollState() error {
 	return nil
 }
 
+// records the time a polling cycle took, logging a throttled warning while
+// cycles consistently take longer than the polling interval.
+func (c *ParentInfo) recordPollCycle(elapsed time.Duration, pollingInterval time.Duration) {
+	pc := &c.PollCycles
+	pc.LastCycleSeconds = elapsed.Seconds()
+
+	if elapsed <= pollingInterval {
+		if pc.ConsecutiveSlowCycles >= SlowPollCycleWarnThreshold {
+			log.Infof("polling has caught up, the last cycle took %v, within the %v polling interval\n", elapsed, pollingInterval)
+		}
+		pc.ConsecutiveSlowCycles = 0
+		return
+	}
+
+	pc.ConsecutiveSlowCycles++
+	pc.SlowCycles++
+	if pc.ConsecutiveSlowCycles >= SlowPollCycleWarnThreshold && time.Since(pc.lastSlowWarning) >= SlowPollCycleWarnInterval {
+		log.Warnf("the last %d polling cycles took longer than the %v polling interval, the last took %v, parent markdowns may be delayed\n",
+			pc.ConsecutiveSlowCycles, pollingInterval, elapsed)
+		pc.lastSlowWarning = time.Now()
+	}
+}
+
 // choose an available trafficmonitor, returns an error if
 // there are none.
 // 複数台のTrafficMonitorから1台のTrafficMonitorを決定する
@@ -602,6 +739,15 @@ func (c *ParentInfo) execTrafficCtl(fqdn string, available bool) error {
 		status = "down"
 	}
 
+	// use the trafficserver JSON-RPC socket if present, falling back to traffic_ctl.
+	if sock := c.rpcSocket(); sock != "" {
+		err := rpcSetHostStatus(sock, fqdn, status, reason)
+		if err == nil {
+			return nil
+		}
+		log.Warnf("marking %s %s over %s failed, falling back to %s: %s\n", fqdn, status, sock, TrafficCtl, err.Error())
+	}
+
 	cmd := exec.Command(tc, "host", status, "--reason", reason, fqdn)
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
@@ -631,6 +777,7 @@ func (c *ParentInfo) markParent(fqdn string, cacheStatus string, available bool)
 		localReason := pv.LocalReason
 		unavailablePollCount := pv.UnavailablePollCount
 		markUpPollCount := pv.MarkUpPollCount
+		lastMarkTime := pv.LastMarkTime
 
 		log.Debugf("hostName: %s, UnavailablePollCount: %d, available: %v", hostName, unavailablePollCount, available)
 
@@ -642,6 +789,9 @@ func (c *ParentInfo) markParent(fqdn string, cacheStatus string, available bool)
 			if unavailablePollCount < c.Cfg.UnavailablePollThreshold {
 				log.Infof("TM indicates %s is unavailable but the UnavailablePollThreshold has not been reached", hostName)
 				hostAvailable = true
+			} else if c.inMarkCooldown(pv) {
+				log.Infof("TM indicates %s is unavailable but it was marked UP less than the mark-cooldown of %v ago, not marking it DOWN\n", hostName, c.Cfg.ParsedMarkCooldown)
+				hostAvailable = true
 			} else {
 				// marking the host down
 				// 「例 traffic_ctl host down cdn-cache-01.foo.com --reason manual」 ここでは必ずdownが実行される
@@ -653,10 +803,16 @@ func (c *ParentInfo) markParent(fqdn string, cacheStatus string, available bool)
 					// reset the poll counts
 					markUpPollCount = 0
 					unavailablePollCount = 0
+					lastMarkTime = time.Now().Unix()
 					log.Infof("marked parent %s DOWN, cache status was: %s\n", hostName, cacheStatus)
 				}
 			}
 
+		} else if !pv.ManualReason && c.Cfg.ReasonCode != "manual" { // available, manually marked down
+			// do not undo a manual markdown, e.g. for maintenance, set outside of the health client.
+			log.Infof("TM indicates %s is available but a manual markdown is in effect, not marking it UP\n", hostName)
+			hostAvailable = false
+			markUpPollCount = 0
 		} else { // available
 			// marking the host up
 			markUpPollCount += 1
@@ -665,6 +821,9 @@ func (c *ParentInfo) markParent(fqdn string, cacheStatus string, available bool)
 			if markUpPollCount < c.Cfg.MarkUpPollThreshold {
 				log.Infof("TM indicates %s is available but the MarkUpPollThreshold has not been reached", hostName)
 				hostAvailable = false
+			} else if c.inMarkCooldown(pv) {
+				log.Infof("TM indicates %s is available but it was marked DOWN less than the mark-cooldown of %v ago, not marking it UP\n", hostName, c.Cfg.ParsedMarkCooldown)
+				hostAvailable = false
 			} else {
 				// 「例 traffic_ctl host up cdn-cache-01.foo.com --reason manual」 ここでは必ずupが実行される
 				err = c.execTrafficCtl(fqdn, available)
@@ -675,6 +834,7 @@ func (c *ParentInfo) markParent(fqdn string, cacheStatus string, available bool)
 					// reset the poll counts
 					unavailablePollCount = 0
 					markUpPollCount = 0
+					lastMarkTime = time.Now().Unix()
 					log.Infof("marked parent %s UP, cache status was: %s\n", hostName, cacheStatus)
 				}
 			}
@@ -694,6 +854,7 @@ func (c *ParentInfo) markParent(fqdn string, cacheStatus string, available bool)
 			pv.LocalReason = localReason
 			pv.UnavailablePollCount = unavailablePollCount
 			pv.MarkUpPollCount = markUpPollCount
+			pv.LastMarkTime = lastMarkTime
 			c.Parents[hostName] = pv
 			log.Debugf("Updated parent status: %v", pv)
 		}
@@ -701,6 +862,15 @@ func (c *ParentInfo) markParent(fqdn string, cacheStatus string, available bool)
 	return err
 }
 
+// reports whether marking the parent up or down is suppressed because it was
+// last marked less than the configured mark-cooldown ago.
+func (c *ParentInfo) inMarkCooldown(pv ParentStatus) bool {
+	if c.Cfg.ParsedMarkCooldown <= 0 || pv.LastMarkTime == 0 {
+		return false
+	}
+	return time.Since(time.Unix(pv.LastMarkTime, 0)) < c.Cfg.ParsedMarkCooldown
+}
+
 // reads the current parent statuses from the trafficserver HostStatus
 // subsystem.
 func (c *ParentInfo) readHostStatus(parentStatus map[string]ParentStatus) error {
@@ -710,8 +880,19 @@ func (c *ParentInfo) readHostStatus(parentStatus map[string]ParentStatus) error
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 
+	// use the trafficserver JSON-RPC socket if present, falling back to traffic_ctl.
+	readOverRPC := false
+	if sock := c.rpcSocket(); sock != "" {
+		if out, err := rpcReadHostStatus(sock); err != nil {
+			log.Warnf("reading host status over %s failed, falling back to %s: %s\n", sock, TrafficCtl, err.Error())
+		} else {
+			stdout.Write(out)
+			readOverRPC = true
+		}
+	}
+
 	// auto select traffic_ctl command for ATS version 9 or 10 and later
-	for i := traffic_ctl_index; i <= 1; i++ {
+	for i := traffic_ctl_index; i <= 1 && !readOverRPC; i++ {
 
 		var err error
 		switch i {
@@ -843,6 +1024,7 @@ func (c *ParentInfo) readHostStatus(parentStatus map[string]ParentStatus) error
 						pstat.LastTmPoll = pv.LastTmPoll
 						pstat.UnavailablePollCount = pv.UnavailablePollCount
 						pstat.MarkUpPollCount = pv.MarkUpPollCount
+						pstat.LastMarkTime = pv.LastMarkTime
 						parentStatus[hostName] = pstat
 					}
 				}
@@ -861,6 +1043,7 @@ func (c *ParentInfo) readHostStatus(parentStatus map[string]ParentStatus) error
 // load parents list from the Trafficserver 'parent.config' file.
 func (c *ParentInfo) readParentConfig(parentStatus map[string]ParentStatus) error {
 	fn := c.ParentDotConfig.Filename
+	c.parentConfigHosts = map[string]struct{}{}
 
 	_, err := os.Stat(fn)
 	if err != nil {
@@ -911,6 +1094,7 @@ func (c *ParentInfo) readParentConfig(parentStatus map[string]ParentStatus) erro
 					if len(parent) == 2 {
 						fqdn := parent[0]
 						hostName := parseFqdn(fqdn)
+						c.parentConfigHosts[hostName] = struct{}{}
 						_, ok := parentStatus[hostName]
 						// create the ParentStatus struct and add it to the
 						// Parents map only if an entry in the map does not
@@ -940,6 +1124,7 @@ func (c *ParentInfo) readParentConfig(parentStatus map[string]ParentStatus) erro
 func (c *ParentInfo) readStrategies(parentStatus map[string]ParentStatus) error {
 	var includes []string
 	fn := c.StrategiesDotYaml.Filename
+	c.strategiesHosts = map[string]struct{}{}
 
 	_, err := os.Stat(fn)
 	if err != nil {
@@ -1002,6 +1187,7 @@ func (c *ParentInfo) readStrategies(parentStatus map[string]ParentStatus) error
 	for _, host := range strategies.Hosts {
 		fqdn := host.HostName
 		hostName := parseFqdn(fqdn)
+		c.strategiesHosts[hostName] = struct{}{}
 		// create the ParentStatus struct and add it to the
 		// Parents map only if an entry in the map does not
 		// already exist.
@@ -23,7 +23,10 @@ import (
 	"fmt"
 	"github.com/apache/trafficcontrol/tc-health-client/config"
 	"github.com/apache/trafficcontrol/tc-health-client/util"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 const (
@@ -137,6 +140,101 @@ func TestReadHostStatus(t *testing.T) {
 	}
 }
 
+func TestEvictStaleParents(t *testing.T) {
+	now := time.Now().Unix()
+	maxAge := time.Hour
+
+	pi := ParentInfo{
+		Parents: map[string]ParentStatus{
+			"removed":       {Fqdn: "removed.foo.com", LastTmPoll: now - int64((maxAge+time.Minute)/time.Second)},
+			"recent":        {Fqdn: "recent.foo.com", LastTmPoll: now - int64((maxAge-time.Minute)/time.Second)},
+			"in-parents":    {Fqdn: "in-parents.foo.com", LastTmPoll: now - int64((maxAge+time.Minute)/time.Second)},
+			"in-strategies": {Fqdn: "in-strategies.foo.com", LastTmPoll: now - int64((maxAge+time.Minute)/time.Second)},
+			"never-polled":  {Fqdn: "never-polled.foo.com", LastTmPoll: 0},
+		},
+		Cfg:               config.Cfg{},
+		parentConfigHosts: map[string]struct{}{"in-parents": {}},
+		strategiesHosts:   map[string]struct{}{"in-strategies": {}},
+	}
+
+	pi.evictStaleParents(now)
+	if len(pi.Parents) != 5 {
+		t.Fatalf("expected no parents to be evicted when parent-max-age is disabled, got %d parents\n", len(pi.Parents))
+	}
+
+	pi.Cfg.ParsedParentMaxAge = maxAge
+	pi.evictStaleParents(now)
+	if _, ok := pi.Parents["removed"]; ok {
+		t.Fatalf("expected parent 'removed' to be evicted after aging out\n")
+	}
+	for _, hostName := range []string{"recent", "in-parents", "in-strategies", "never-polled"} {
+		if _, ok := pi.Parents[hostName]; !ok {
+			t.Fatalf("expected parent '%s' to not be evicted\n", hostName)
+		}
+	}
+}
+
+func TestUpdateTrafficServerDirs(t *testing.T) {
+	oldDir := t.TempDir()
+	oldParents := filepath.Join(oldDir, ParentsFile)
+	if err := ioutil.WriteFile(oldParents, []byte("dest_domain=. parent=\"old-parent-1.foo.com:80;old-parent-2.foo.com:80\"\n"), 0644); err != nil {
+		t.Fatalf("writing %s: %s\n", oldParents, err.Error())
+	}
+
+	pi := ParentInfo{
+		ParentDotConfig:        util.ConfigFile{Filename: oldParents},
+		StrategiesDotYaml:      util.ConfigFile{Filename: filepath.Join(oldDir, StrategiesFile)},
+		TrafficServerConfigDir: oldDir,
+		Parents:                make(map[string]ParentStatus),
+		Cfg:                    config.Cfg{TrafficServerConfigDir: oldDir},
+	}
+	if err := pi.readParentConfig(pi.Parents); err != nil {
+		t.Fatalf("failed readParentConfig(): %s\n", err.Error())
+	}
+	if len(pi.Parents) != 2 {
+		t.Fatalf("expected 2 parents from the old config dir got %d\n", len(pi.Parents))
+	}
+
+	// an unchanged config dir doesn't reread anything.
+	lastModifyTime := pi.ParentDotConfig.LastModifyTime
+	if err := pi.updateTrafficServerDirs(); err != nil {
+		t.Fatalf("failed updateTrafficServerDirs(): %s\n", err.Error())
+	}
+	if pi.ParentDotConfig.Filename != oldParents || pi.ParentDotConfig.LastModifyTime != lastModifyTime {
+		t.Fatalf("expected %s to still be used unchanged, got %+v\n", oldParents, pi.ParentDotConfig)
+	}
+
+	newDir := "test_files/etc"
+	pi.Cfg.TrafficServerConfigDir = newDir
+	pi.Cfg.TrafficServerBinDir = "test_files/bin"
+	if err := pi.updateTrafficServerDirs(); err != nil {
+		t.Fatalf("failed updateTrafficServerDirs(): %s\n", err.Error())
+	}
+
+	if pi.TrafficServerConfigDir != newDir || pi.TrafficServerBinDir != "test_files/bin" {
+		t.Fatalf("expected config dir %s and bin dir test_files/bin got %s and %s\n", newDir, pi.TrafficServerConfigDir, pi.TrafficServerBinDir)
+	}
+	if expected := filepath.Join(newDir, ParentsFile); pi.ParentDotConfig.Filename != expected || pi.ParentDotConfig.LastModifyTime == 0 {
+		t.Fatalf("expected %s to have been read got %+v\n", expected, pi.ParentDotConfig)
+	}
+	if expected := filepath.Join(newDir, StrategiesFile); pi.StrategiesDotYaml.Filename != expected || pi.StrategiesDotYaml.LastModifyTime == 0 {
+		t.Fatalf("expected %s to have been read got %+v\n", expected, pi.StrategiesDotYaml)
+	}
+	if len(pi.parentConfigHosts) != 8 {
+		t.Fatalf("expected 8 parents from the new %s got %d\n", ParentsFile, len(pi.parentConfigHosts))
+	}
+	if _, ok := pi.parentConfigHosts["old-parent-1"]; ok {
+		t.Fatalf("expected 'old-parent-1' to no longer be listed in %s\n", ParentsFile)
+	}
+	if len(pi.strategiesHosts) != 6 {
+		t.Fatalf("expected 6 parents from the new %s got %d\n", StrategiesFile, len(pi.strategiesHosts))
+	}
+	// parents only in the old files are kept until they're evicted as stale.
+	if _, ok := pi.Parents["old-parent-1"]; !ok {
+		t.Fatalf("expected 'old-parent-1' to be kept until it's evicted\n")
+	}
+}
+
 func TestFindATrafficMonitor(t *testing.T) {
 	cf := util.ConfigFile{
 		Filename:       test_config_file,
@@ -252,3 +350,133 @@ func TestStatusReason(t *testing.T) {
 		t.Fatalf("expected reason 'UNDEFINED' got %s\n", reason.String())
 	}
 }
+
+func TestMarkParentCooldown(t *testing.T) {
+	reqs := make(chan map[string]interface{}, 10)
+	sock := startTestRPCServer(t, map[string]string{"admin_host_set_status": `{}`}, reqs)
+
+	pi := ParentInfo{
+		TrafficServerBinDir: "/nonexistent",
+		Parents: map[string]ParentStatus{
+			"cdn-cache-01": {Fqdn: "cdn-cache-01.foo.com", ActiveReason: true, LocalReason: true, ManualReason: true},
+		},
+		Cfg: config.Cfg{
+			ReasonCode:               "active",
+			TrafficServerRPCSocket:   sock,
+			UnavailablePollThreshold: 1,
+			MarkUpPollThreshold:      1,
+			ParsedMarkCooldown:       time.Hour,
+		},
+	}
+
+	// the first transition is not damped.
+	if err := pi.markParent("cdn-cache-01.foo.com", "REPORTED", false); err != nil {
+		t.Fatalf("failed markParent(): %s\n", err.Error())
+	}
+	if len(reqs) != 1 || pi.Parents["cdn-cache-01"].available("active") {
+		t.Fatalf("expected cdn-cache-01 to be marked DOWN\n")
+	}
+	<-reqs
+
+	// TM data flapping back within the cooldown does not mark the parent up.
+	for i := 0; i < 3; i++ {
+		if err := pi.markParent("cdn-cache-01.foo.com", "REPORTED", true); err != nil {
+			t.Fatalf("failed markParent(): %s\n", err.Error())
+		}
+	}
+	if len(reqs) != 0 || pi.Parents["cdn-cache-01"].available("active") {
+		t.Fatalf("expected cdn-cache-01 to stay DOWN during the mark cooldown, %d traffic_ctl calls\n", len(reqs))
+	}
+
+	// once the cooldown has elapsed the parent is marked up.
+	pstat := pi.Parents["cdn-cache-01"]
+	pstat.LastMarkTime = time.Now().Add(-2 * time.Hour).Unix()
+	pi.Parents["cdn-cache-01"] = pstat
+	if err := pi.markParent("cdn-cache-01.foo.com", "REPORTED", true); err != nil {
+		t.Fatalf("failed markParent(): %s\n", err.Error())
+	}
+	if len(reqs) != 1 || !pi.Parents["cdn-cache-01"].available("active") {
+		t.Fatalf("expected cdn-cache-01 to be marked UP after the mark cooldown\n")
+	}
+	if pi.Parents["cdn-cache-01"].LastMarkTime < time.Now().Add(-time.Minute).Unix() {
+		t.Fatalf("expected the last mark time of cdn-cache-01 to be updated\n")
+	}
+}
+
+func TestRecordPollCycle(t *testing.T) {
+	pi := ParentInfo{}
+	interval := 10 * time.Second
+
+	for i := 0; i < SlowPollCycleWarnThreshold; i++ {
+		pi.recordPollCycle(15*time.Second, interval)
+	}
+	if pi.PollCycles.ConsecutiveSlowCycles != SlowPollCycleWarnThreshold || pi.PollCycles.SlowCycles != SlowPollCycleWarnThreshold {
+		t.Fatalf("expected %d slow cycles, got %+v\n", SlowPollCycleWarnThreshold, pi.PollCycles)
+	}
+	if pi.PollCycles.LastCycleSeconds != 15 {
+		t.Fatalf("expected the last cycle to take 15 seconds, got %v\n", pi.PollCycles.LastCycleSeconds)
+	}
+	if pi.PollCycles.lastSlowWarning.IsZero() {
+		t.Fatalf("expected a slow polling cycle warning after %d slow cycles\n", SlowPollCycleWarnThreshold)
+	}
+
+	// warnings are throttled.
+	lastWarning := pi.PollCycles.lastSlowWarning
+	pi.recordPollCycle(15*time.Second, interval)
+	if pi.PollCycles.lastSlowWarning != lastWarning {
+		t.Fatalf("expected the slow polling cycle warning to be throttled\n")
+	}
+
+	pi.recordPollCycle(5*time.Second, interval)
+	if pi.PollCycles.ConsecutiveSlowCycles != 0 || pi.PollCycles.SlowCycles != SlowPollCycleWarnThreshold+1 {
+		t.Fatalf("expected a cycle within the interval to reset the consecutive slow cycles, got %+v\n", pi.PollCycles)
+	}
+}
+
+func TestMarkParentManualDown(t *testing.T) {
+	reqs := make(chan map[string]interface{}, 10)
+	sock := startTestRPCServer(t, map[string]string{"admin_host_set_status": `{}`}, reqs)
+
+	pi := ParentInfo{
+		TrafficServerBinDir: "/nonexistent",
+		Parents: map[string]ParentStatus{
+			"cdn-cache-01": {Fqdn: "cdn-cache-01.foo.com", ActiveReason: false, LocalReason: true, ManualReason: false},
+		},
+		Cfg: config.Cfg{
+			ReasonCode:               "active",
+			TrafficServerRPCSocket:   sock,
+			UnavailablePollThreshold: 1,
+			MarkUpPollThreshold:      1,
+		},
+	}
+
+	if err := pi.markParent("cdn-cache-01.foo.com", "REPORTED", true); err != nil {
+		t.Fatalf("failed markParent(): %s\n", err.Error())
+	}
+	if len(reqs) != 0 || pi.Parents["cdn-cache-01"].available("active") {
+		t.Fatalf("expected manually marked down cdn-cache-01 to stay DOWN, %d traffic_ctl calls\n", len(reqs))
+	}
+
+	// a manually marked down parent may still be marked down.
+	pstat := pi.Parents["cdn-cache-01"]
+	pstat.ActiveReason = true
+	pi.Parents["cdn-cache-01"] = pstat
+	if err := pi.markParent("cdn-cache-01.foo.com", "REPORTED", false); err != nil {
+		t.Fatalf("failed markParent(): %s\n", err.Error())
+	}
+	if len(reqs) != 1 || pi.Parents["cdn-cache-01"].available("active") {
+		t.Fatalf("expected cdn-cache-01 to be marked DOWN\n")
+	}
+	<-reqs
+
+	// once the manual markdown is cleared the parent is marked up.
+	pstat = pi.Parents["cdn-cache-01"]
+	pstat.ManualReason = true
+	pi.Parents["cdn-cache-01"] = pstat
+	if err := pi.markParent("cdn-cache-01.foo.com", "REPORTED", true); err != nil {
+		t.Fatalf("failed markParent(): %s\n", err.Error())
+	}
+	if len(reqs) != 1 || !pi.Parents["cdn-cache-01"].available("active") {
+		t.Fatalf("expected cdn-cache-01 to be marked UP\n")
+	}
+}
@@ -53,6 +53,17 @@ func (handler Handler) Precompute() bool {
 	return handler.ToData != nil
 }
 
+// send counts the poll of the given result, and passes it along for further
+// processing.
+func (handler Handler) send(result Result) {
+	poller := PollerHealth
+	if handler.Precompute() {
+		poller = PollerStat
+	}
+	countPoll(poller, result.ID, result.Error)
+	handler.resultChan <- result
+}
+
 // PrecomputedData represents data parsed and pre-computed from the Result.
 type PrecomputedData struct {
 	DeliveryServiceStats map[string]*DSStat
@@ -282,7 +293,7 @@ func (handler Handler) Handle(id string, rdr io.Reader, format string, reqTime t
 	if reqErr != nil {
 		log.Warnf("%s handler given error: %s", id, reqErr.Error()) // error here, in case the thing that called Handle didn't error
 		result.Error = reqErr
-		handler.resultChan <- result
+		handler.send(result)
 		return
 	}
 
@@ -290,7 +301,7 @@ func (handler Handler) Handle(id string, rdr io.Reader, format string, reqTime t
 	if err != nil {
 		log.Errorln(err.Error())
 		result.Error = err
-		handler.resultChan <- result
+		handler.send(result)
 		return
 	}
 
@@ -298,7 +309,7 @@ func (handler Handler) Handle(id string, rdr io.Reader, format string, reqTime t
 	if err != nil {
 		log.Warnf("%s decode error '%v'", id, err)
 		result.Error = err
-		handler.resultChan <- result
+		handler.send(result)
 		return
 	}
 
@@ -313,5 +324,5 @@ func (handler Handler) Handle(id string, rdr io.Reader, format string, reqTime t
 	result.PrecomputedData.Reporting = true
 	result.PrecomputedData.Time = result.Time
 
-	handler.resultChan <- result
+	handler.send(result)
 }
@@ -0,0 +1,85 @@
+package cache
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// The names of the pollers whose results are counted.
+const (
+	PollerHealth = "health"
+	PollerStat   = "stat"
+)
+
+// PollCount is the number of successful and failed polls of a cache.
+type PollCount struct {
+	Success uint64
+	Error   uint64
+}
+
+type pollCountKey struct {
+	poller string
+	id     string
+}
+
+type pollCounter struct {
+	success uint64
+	errors  uint64
+}
+
+// pollCounts is the pollCounter of each poller and cache. A sync.Map is used
+// so that counting polls never waits for the counts being read.
+var pollCounts sync.Map
+
+// countPoll counts a poll of the given cache by the given poller, which failed
+// if err isn't nil.
+func countPoll(poller string, id string, err error) {
+	key := pollCountKey{poller: poller, id: id}
+	counter, ok := pollCounts.Load(key)
+	if !ok {
+		counter, _ = pollCounts.LoadOrStore(key, &pollCounter{})
+	}
+	if err != nil {
+		atomic.AddUint64(&counter.(*pollCounter).errors, 1)
+	} else {
+		atomic.AddUint64(&counter.(*pollCounter).success, 1)
+	}
+}
+
+// PollCounts returns the number of successful and failed polls of each cache
+// since Traffic Monitor started, by poller name and then cache name.
+func PollCounts() map[string]map[string]PollCount {
+	counts := map[string]map[string]PollCount{}
+	pollCounts.Range(func(k, v interface{}) bool {
+		key := k.(pollCountKey)
+		counter := v.(*pollCounter)
+		if counts[key.poller] == nil {
+			counts[key.poller] = map[string]PollCount{}
+		}
+		counts[key.poller][key.id] = PollCount{
+			Success: atomic.LoadUint64(&counter.success),
+			Error:   atomic.LoadUint64(&counter.errors),
+		}
+		return true
+	})
+	return counts
+}
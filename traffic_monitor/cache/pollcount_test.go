@@ -0,0 +1,59 @@
+package cache
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandlerCountsPolls(t *testing.T) {
+	handler := NewHandler()
+	before := PollCounts()[PollerHealth]["pollcount-test"]
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%5 == 0 {
+				err = errors.New("connection refused")
+			}
+			handler.Handle("pollcount-test", strings.NewReader(""), "noop", time.Millisecond, time.Now(), err, uint64(i), true, nil, nil)
+		}(i)
+		<-handler.ResultChan()
+	}
+	wg.Wait()
+
+	count := PollCounts()[PollerHealth]["pollcount-test"]
+	if count.Error != before.Error+2 {
+		t.Errorf("expected %d failed polls, actual: %d", before.Error+2, count.Error)
+	}
+	if count.Success != before.Success+8 {
+		t.Errorf("expected %d successful polls, actual: %d", before.Success+8, count.Success)
+	}
+	if _, ok := PollCounts()[PollerStat]["pollcount-test"]; ok {
+		t.Error("expected health polls not to be counted as stat polls")
+	}
+}
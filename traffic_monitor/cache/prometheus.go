@@ -0,0 +1,279 @@
+package cache
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// prometheus is a Stats format for caches which expose their statistics as
+// Prometheus metrics in the text exposition format, typically via an exporter
+// running alongside the cache. The metrics read are configurable by the
+// traffic_monitor.cfg "prometheus_metric_names" option.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+// PrometheusConnectionsStat is the name of the stat to which the Prometheus
+// connections metric is mapped, so that it may be used by the same thresholds
+// as the Apache Traffic Server stat of the same name.
+const PrometheusConnectionsStat = "proxy.process.http.current_client_connections"
+
+func init() {
+	registerDecoder("prometheus", prometheusParse, prometheusPrecompute)
+}
+
+var prometheusMetricNames = config.DefaultPrometheusMetricNames
+var prometheusMetricNamesM sync.RWMutex
+
+// SetPrometheusMetricNames sets the names of the metrics read by the
+// "prometheus" stats type.
+func SetPrometheusMetricNames(names config.PrometheusMetricNames) {
+	prometheusMetricNamesM.Lock()
+	defer prometheusMetricNamesM.Unlock()
+	prometheusMetricNames = names
+}
+
+func getPrometheusMetricNames() config.PrometheusMetricNames {
+	prometheusMetricNamesM.RLock()
+	defer prometheusMetricNamesM.RUnlock()
+	return prometheusMetricNames
+}
+
+// prometheusSample is a single sample of a Prometheus text exposition.
+type prometheusSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// key returns the name of the stat of the sample: its metric name, followed
+// by its labels sorted by name, if it has any.
+func (s prometheusSample) key() string {
+	if len(s.Labels) == 0 {
+		return s.Name
+	}
+	names := make([]string, 0, len(s.Labels))
+	for name := range s.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	labels := make([]string, 0, len(names))
+	for _, name := range names {
+		labels = append(labels, name+`="`+s.Labels[name]+`"`)
+	}
+	return s.Name + "{" + strings.Join(labels, ",") + "}"
+}
+
+func prometheusParse(cacheName string, data io.Reader, _ interface{}) (Statistics, map[string]interface{}, error) {
+	var stats Statistics
+	if data == nil {
+		log.Warnf("Cannot read stats data for cache '%s' - nil data reader", cacheName)
+		return stats, nil, errors.New("handler got nil reader")
+	}
+
+	samples, err := prometheusParseText(data)
+	if err != nil {
+		return stats, nil, fmt.Errorf("parsing Prometheus metrics for cache '%s': %v", cacheName, err)
+	}
+
+	names := getPrometheusMetricNames()
+	miscStats := make(map[string]interface{}, len(samples))
+	foundLoadavg := false
+	stats.Interfaces = map[string]Interface{}
+	for _, sample := range samples {
+		switch sample.Name {
+		case names.LoadavgOne:
+			stats.Loadavg.One = sample.Value
+			foundLoadavg = true
+		case names.LoadavgFive:
+			stats.Loadavg.Five = sample.Value
+		case names.LoadavgFifteen:
+			stats.Loadavg.Fifteen = sample.Value
+		case names.Connections:
+			miscStats[PrometheusConnectionsStat] = sample.Value
+		case names.InterfaceBytesIn, names.InterfaceBytesOut, names.InterfaceSpeed:
+			ifaceName, ok := sample.Labels[names.InterfaceLabel]
+			if !ok {
+				log.Warnf("cache '%s' metric '%s' has no '%s' label, ignoring", cacheName, sample.Name, names.InterfaceLabel)
+				continue
+			}
+			if sample.Value < 0 || sample.Value > math.MaxUint64 || math.IsNaN(sample.Value) {
+				log.Warnf("cache '%s' metric '%s' for interface '%s' out of range: %v", cacheName, sample.Name, ifaceName, sample.Value)
+				continue
+			}
+			iface := stats.Interfaces[ifaceName]
+			switch sample.Name {
+			case names.InterfaceBytesIn:
+				iface.BytesIn = uint64(sample.Value)
+			case names.InterfaceBytesOut:
+				iface.BytesOut = uint64(sample.Value)
+			case names.InterfaceSpeed:
+				// Prometheus metrics are in base units, bytes per second; interface speeds are in megabits per second.
+				iface.Speed = int64(sample.Value * 8 / 1000000)
+			}
+			stats.Interfaces[ifaceName] = iface
+		default:
+			miscStats[sample.key()] = sample.Value
+		}
+	}
+
+	if !foundLoadavg {
+		return stats, nil, fmt.Errorf("Prometheus metrics for cache '%s' were missing '%s'", cacheName, names.LoadavgOne)
+	}
+	if len(stats.Interfaces) < 1 {
+		return stats, nil, fmt.Errorf("cache '%s' had no interfaces", cacheName)
+	}
+
+	return stats, miscStats, nil
+}
+
+// prometheusParseText parses the samples of a Prometheus text exposition.
+// Comments, including HELP and TYPE lines, are ignored, as are timestamps.
+func prometheusParseText(data io.Reader) ([]prometheusSample, error) {
+	samples := []prometheusSample{}
+	scanner := bufio.NewScanner(data)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample, err := prometheusParseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(samples) < 1 {
+		return nil, errors.New("no samples found")
+	}
+	return samples, nil
+}
+
+// prometheusParseLine parses a single sample line of the form
+// `name{label="value",...} value [timestamp]`.
+func prometheusParseLine(line string) (prometheusSample, error) {
+	sample := prometheusSample{}
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd < 1 {
+		return sample, errors.New("missing metric name or value")
+	}
+	sample.Name = line[:nameEnd]
+	rest := line[nameEnd:]
+
+	if rest[0] == '{' {
+		labels, labelsLen, err := prometheusParseLabels(rest)
+		if err != nil {
+			return sample, fmt.Errorf("metric '%s': %v", sample.Name, err)
+		}
+		sample.Labels = labels
+		rest = rest[labelsLen:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) != 1 && len(fields) != 2 {
+		return sample, fmt.Errorf("metric '%s': expected a value and an optional timestamp, got '%s'", sample.Name, rest)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("metric '%s': malformed value: %v", sample.Name, err)
+	}
+	sample.Value = value
+	return sample, nil
+}
+
+// prometheusParseLabels parses the label set at the start of the given text,
+// returning the labels and the length of the label set including its braces.
+func prometheusParseLabels(text string) (map[string]string, int, error) {
+	labels := map[string]string{}
+	i := 1 // skip the opening brace
+	for {
+		for i < len(text) && (text[i] == ' ' || text[i] == ',') {
+			i++
+		}
+		if i >= len(text) {
+			return nil, 0, errors.New("unterminated label set")
+		}
+		if text[i] == '}' {
+			return labels, i + 1, nil
+		}
+
+		eq := strings.IndexByte(text[i:], '=')
+		if eq < 1 {
+			return nil, 0, errors.New("malformed label")
+		}
+		name := strings.TrimSpace(text[i : i+eq])
+		i += eq + 1
+		if i >= len(text) || text[i] != '"' {
+			return nil, 0, fmt.Errorf("label '%s' value is not quoted", name)
+		}
+		i++
+
+		value := strings.Builder{}
+		for ; i < len(text) && text[i] != '"'; i++ {
+			if text[i] != '\\' || i+1 >= len(text) {
+				value.WriteByte(text[i])
+				continue
+			}
+			i++
+			switch text[i] {
+			case 'n':
+				value.WriteByte('\n')
+			default:
+				value.WriteByte(text[i])
+			}
+		}
+		if i >= len(text) {
+			return nil, 0, fmt.Errorf("label '%s' value is unterminated", name)
+		}
+		i++ // skip the closing quote
+		labels[name] = value.String()
+	}
+}
+
+func prometheusPrecompute(cacheName string, data todata.TOData, stats Statistics, miscStats map[string]interface{}) PrecomputedData {
+	var precomputed PrecomputedData
+	// Prometheus exporters don't report per-Delivery Service stats.
+	precomputed.DeliveryServiceStats = make(map[string]*DSStat)
+
+	precomputed.OutBytes = 0
+	precomputed.MaxKbps = 0
+	for _, iface := range stats.Interfaces {
+		precomputed.OutBytes += iface.BytesOut
+		if iface.Speed > precomputed.MaxKbps {
+			precomputed.MaxKbps = iface.Speed
+		}
+	}
+	precomputed.MaxKbps *= 1000
+	return precomputed
+}
@@ -0,0 +1,114 @@
+package cache
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+const examplePrometheusStats = `# HELP node_load1 1m load average.
+# TYPE node_load1 gauge
+node_load1 0.21
+node_load5 0.34
+node_load15 0.55
+# HELP node_network_receive_bytes_total Network device statistic receive_bytes.
+# TYPE node_network_receive_bytes_total counter
+node_network_receive_bytes_total{device="bond0"} 1.23456789e+09
+node_network_receive_bytes_total{device="lo"} 4096
+node_network_transmit_bytes_total{device="bond0"} 9.87654321e+09 1633024800000
+node_network_transmit_bytes_total{device="lo"} 4096
+node_network_speed_bytes{device="bond0"} 1.25e+09
+proxy_process_http_current_client_connections 42
+node_filesystem_avail_bytes{mountpoint="/",device="/dev/sda1",help="a \"quoted\", {braced} value"} 1024
+`
+
+func TestPrometheusParse(t *testing.T) {
+	stats, misc, err := prometheusParse("test", strings.NewReader(examplePrometheusStats), nil)
+	if err != nil {
+		t.Fatalf("expected no error, actual: %v", err)
+	}
+	if stats.Loadavg.One != 0.21 || stats.Loadavg.Five != 0.34 || stats.Loadavg.Fifteen != 0.55 {
+		t.Errorf("expected loadavg 0.21 0.34 0.55, actual: %+v", stats.Loadavg)
+	}
+	if len(stats.Interfaces) != 2 {
+		t.Fatalf("expected 2 interfaces, actual: %+v", stats.Interfaces)
+	}
+	bond0 := stats.Interfaces["bond0"]
+	if bond0.BytesIn != 1234567890 || bond0.BytesOut != 9876543210 || bond0.Speed != 10000 {
+		t.Errorf("expected bond0 bytes in 1234567890, bytes out 9876543210, speed 10000, actual: %+v", bond0)
+	}
+	if conns := misc[PrometheusConnectionsStat]; conns != float64(42) {
+		t.Errorf("expected stat '%s' 42, actual: %v", PrometheusConnectionsStat, conns)
+	}
+	const fsKey = `node_filesystem_avail_bytes{device="/dev/sda1",help="a "quoted", {braced} value",mountpoint="/"}`
+	if avail := misc[fsKey]; avail != float64(1024) {
+		t.Errorf("expected stat '%s' 1024, actual: %v (stats: %+v)", fsKey, avail, misc)
+	}
+	if _, ok := misc["node_load1"]; ok {
+		t.Error("expected mapped metrics to not be in the miscellaneous stats")
+	}
+
+	precomputed := prometheusPrecompute("test", *todata.New(), stats, misc)
+	if precomputed.OutBytes != 9876543210+4096 {
+		t.Errorf("expected precomputed OutBytes %d, actual: %d", 9876543210+4096, precomputed.OutBytes)
+	}
+	if precomputed.MaxKbps != 10000000 {
+		t.Errorf("expected precomputed MaxKbps 10000000, actual: %d", precomputed.MaxKbps)
+	}
+}
+
+func TestPrometheusParseMetricNames(t *testing.T) {
+	names := config.DefaultPrometheusMetricNames
+	names.LoadavgOne = "system_load_one"
+	names.InterfaceBytesOut = "iface_tx_bytes"
+	names.InterfaceLabel = "iface"
+	SetPrometheusMetricNames(names)
+	defer SetPrometheusMetricNames(config.DefaultPrometheusMetricNames)
+
+	stats, _, err := prometheusParse("test", strings.NewReader("system_load_one 1.5\niface_tx_bytes{iface=\"eth0\"} 100\n"), nil)
+	if err != nil {
+		t.Fatalf("expected no error, actual: %v", err)
+	}
+	if stats.Loadavg.One != 1.5 {
+		t.Errorf("expected loadavg one 1.5, actual: %v", stats.Loadavg.One)
+	}
+	if stats.Interfaces["eth0"].BytesOut != 100 {
+		t.Errorf("expected eth0 bytes out 100, actual: %+v", stats.Interfaces)
+	}
+}
+
+func TestPrometheusParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing loadavg":    "node_network_transmit_bytes_total{device=\"bond0\"} 100\n",
+		"missing interfaces": "node_load1 0.5\n",
+		"malformed value":    "node_load1 high\n",
+		"unterminated label": "node_network_transmit_bytes_total{device=\"bond0 100\n",
+		"empty":              "# HELP node_load1 1m load average.\n",
+	}
+	for name, text := range tests {
+		if _, _, err := prometheusParse("test", strings.NewReader(text), nil); err == nil {
+			t.Errorf("%s: expected error, actual: nil", name)
+		}
+	}
+}
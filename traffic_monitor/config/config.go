@@ -97,17 +97,71 @@ func (t *PollingProtocol) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// PrometheusMetricNames maps the cache statistics used by Traffic Monitor to
+// the names of the metrics from which the "prometheus" stats type reads them.
+type PrometheusMetricNames struct {
+	// The metric of the number of client connections currently open. It is
+	// reported as the "proxy.process.http.current_client_connections" stat.
+	Connections string `json:"connections"`
+	// The metric of the total bytes received by each network interface.
+	InterfaceBytesIn string `json:"interface_bytes_in"`
+	// The metric of the total bytes transmitted by each network interface.
+	InterfaceBytesOut string `json:"interface_bytes_out"`
+	// The label of the interface metrics which holds the interface name.
+	InterfaceLabel string `json:"interface_label"`
+	// The metric of the speed of each network interface, in bytes per second.
+	InterfaceSpeed string `json:"interface_speed"`
+	// The metric of the one-minute load average.
+	LoadavgOne string `json:"loadavg_one"`
+	// The metric of the five-minute load average.
+	LoadavgFive string `json:"loadavg_five"`
+	// The metric of the fifteen-minute load average.
+	LoadavgFifteen string `json:"loadavg_fifteen"`
+}
+
+// DefaultPrometheusMetricNames are the default names of the metrics read by
+// the "prometheus" stats type, which are those exported by the Prometheus node
+// exporter, and by Apache Traffic Server's Prometheus stats.
+var DefaultPrometheusMetricNames = PrometheusMetricNames{
+	Connections:       "proxy_process_http_current_client_connections",
+	InterfaceBytesIn:  "node_network_receive_bytes_total",
+	InterfaceBytesOut: "node_network_transmit_bytes_total",
+	InterfaceLabel:    "device",
+	InterfaceSpeed:    "node_network_speed_bytes",
+	LoadavgOne:        "node_load1",
+	LoadavgFive:       "node_load5",
+	LoadavgFifteen:    "node_load15",
+}
+
 // Config is the configuration for the application. It includes myriad data,
 // such as polling intervals and log locations.
 type Config struct {
 	// Sets the Internet Protocol version used for polling cache servers.
 	CachePollingProtocol PollingProtocol `json:"cache_polling_protocol"`
+	// The number of consecutive polls made over IPv4 before switching to IPv6,
+	// when CachePollingProtocol is "both".
+	CachePollingIPv4Weight uint64 `json:"cache_polling_ipv4_weight"`
+	// The number of consecutive polls made over IPv6 before switching to IPv4,
+	// when CachePollingProtocol is "both".
+	CachePollingIPv6Weight uint64 `json:"cache_polling_ipv6_weight"`
+	// The length of time after a cache's poll is added during which
+	// unavailable results for it are treated as available, until it is first
+	// seen to be available. Zero disables the grace period.
+	CacheStartupGracePeriod time.Duration `json:"-"`
 	// A path to a file where CDN Snapshot backups are written.
 	CRConfigBackupFile string `json:"crconfig_backup_file"`
 	// The number of historical CDN Snapshots to store.
 	CRConfigHistoryCount uint64 `json:"crconfig_history_count"`
 	// Controls whether Distributed Polling is enabled.
 	DistributedPolling bool `json:"distributed_polling"`
+	// A file to which every event is appended as it occurs, so events evicted
+	// from the MaxEvents in memory are kept. An empty string disables the file.
+	EventLogFile string `json:"event_log_file"`
+	// The size in bytes at which the EventLogFile is rotated. Zero never
+	// rotates it.
+	EventLogFileMaxBytes uint64 `json:"event_log_file_max_bytes"`
+	// The number of rotated EventLogFiles to keep.
+	EventLogFileMaxBackups int `json:"event_log_file_max_backups"`
 	// Defines an interval on which Traffic Monitor will flush its collected
 	// health data such that it is made available through the API.
 	HealthFlushInterval time.Duration `json:"-"`
@@ -139,12 +193,35 @@ type Config struct {
 	// Specifies the minimum number of peers that must be available in order to
 	// participate in the optimistic health protocol.
 	PeerOptimisticQuorumMin int `json:"peer_optimistic_quorum_min"`
+	// Overrides PeerOptimisticQuorumMin for specific CDNs, keyed by CDN name.
+	// The override for this TM's CDN is applied once the CDN is determined.
+	PeerOptimisticQuorumMinCDNs map[string]int `json:"peer_optimistic_quorum_min_cdns"`
+	// The maximum age of a peer's last state, after which it is stale and
+	// excluded from the optimistic health protocol. Zero disables the maximum
+	// age.
+	PeerStateMaxAge time.Duration `json:"-"`
+	// The maximum random delay before the first poll of a newly added cache or
+	// peer poll, which spreads the load of polls added together. Zero limits
+	// the delay only by the polling interval.
+	PollStartJitterMax time.Duration `json:"-"`
+	// The names of the metrics read by the "prometheus" stats type. Names not
+	// given in the config file keep their defaults.
+	PrometheusMetricNames PrometheusMetricNames `json:"prometheus_metric_names"`
 	// The timeout for the API server for reading requests.
 	ServeReadTimeout time.Duration `json:"-"`
 	// The timeout for the API server for writing responses.
 	ServeWriteTimeout time.Duration `json:"-"`
 	// ShortHostnameOverride is for explicitly setting a hostname rather than using the output of `hostname -s`.
 	ShortHostnameOverride string `json:"short_hostname_override"`
+	// A file location to which the local and peer availability states are
+	// periodically written, and from which they are restored on startup. An
+	// empty string disables state backups.
+	StateBackupFile string `json:"state_backup_file"`
+	// The interval on which the availability states are written to the
+	// StateBackupFile.
+	StateBackupInterval time.Duration `json:"-"`
+	// The maximum age of a StateBackupFile which will be restored on startup.
+	StateBackupMaxAge time.Duration `json:"-"`
 	// The interval for which to buffer stats data before processing it.
 	StatBufferInterval time.Duration `json:"-"`
 	// The interval on which Traffic Monitor will flush its collected stats data
@@ -175,6 +252,16 @@ func (c Config) DebugLog() log.LogLocation   { return log.LogLocation(c.LogLocat
 func (c Config) EventLog() log.LogLocation   { return log.LogLocation(c.LogLocationEvent) }
 func (c Config) AccessLog() log.LogLocation  { return log.LogLocation(c.LogLocationAccess) }
 
+// PeerOptimisticQuorumMinForCDN returns the minimum number of available peers
+// required for optimistic quorum on the given CDN: the CDN's entry in
+// PeerOptimisticQuorumMinCDNs if one exists, otherwise PeerOptimisticQuorumMin.
+func (c Config) PeerOptimisticQuorumMinForCDN(cdn string) int {
+	if quorumMin, ok := c.PeerOptimisticQuorumMinCDNs[cdn]; ok {
+		return quorumMin
+	}
+	return c.PeerOptimisticQuorumMin
+}
+
 func GetAccessLogWriter(cfg Config) (io.WriteCloser, error) {
 	accessLoc := cfg.AccessLog()
 
@@ -188,8 +275,13 @@ func GetAccessLogWriter(cfg Config) (io.WriteCloser, error) {
 // DefaultConfig is the default configuration for the application, if no configuration file is given, or if a given config setting doesn't exist in the config file.
 var DefaultConfig = Config{
 	CachePollingProtocol:         Both,
+	CachePollingIPv4Weight:       1,
+	CachePollingIPv6Weight:       1,
 	CRConfigBackupFile:           CRConfigBackupFile,
 	CRConfigHistoryCount:         100,
+	EventLogFile:                 "",
+	EventLogFileMaxBytes:         10 * 1024 * 1024,
+	EventLogFileMaxBackups:       5,
 	HealthFlushInterval:          200 * time.Millisecond,
 	HTTPPollingFormat:            HTTPPollingFormat,
 	HTTPTimeout:                  2 * time.Second,
@@ -202,9 +294,12 @@ var DefaultConfig = Config{
 	MaxEvents:                    200,
 	MonitorConfigPollingInterval: 5 * time.Second,
 	PeerOptimisticQuorumMin:      0,
+	PrometheusMetricNames:        DefaultPrometheusMetricNames,
 	ServeReadTimeout:             10 * time.Second,
 	ServeWriteTimeout:            10 * time.Second,
 	ShortHostnameOverride:        "",
+	StateBackupInterval:          10 * time.Second,
+	StateBackupMaxAge:            5 * time.Minute,
 	StatBufferInterval:           0,
 	StatFlushInterval:            200 * time.Millisecond,
 	StaticFileDir:                StaticFileDir,
@@ -227,6 +322,11 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 		StatBufferIntervalMs           uint64 `json:"stat_buffer_interval_ms"`
 		ServeReadTimeoutMs             uint64 `json:"serve_read_timeout_ms"`
 		ServeWriteTimeoutMs            uint64 `json:"serve_write_timeout_ms"`
+		CacheStartupGracePeriodMs      uint64 `json:"cache_startup_grace_period_ms"`
+		StateBackupIntervalMs          uint64 `json:"state_backup_interval_ms"`
+		StateBackupMaxAgeMs            uint64 `json:"state_backup_max_age_ms"`
+		PeerStateMaxAgeMs              uint64 `json:"peer_state_max_age_ms"`
+		PollStartJitterMaxMs           uint64 `json:"poll_start_jitter_max_ms"`
 		*Alias
 	}{
 		MonitorConfigPollingIntervalMs: uint64(c.MonitorConfigPollingInterval / time.Millisecond),
@@ -234,6 +334,11 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 		HealthFlushIntervalMs:          uint64(c.HealthFlushInterval / time.Millisecond),
 		StatFlushIntervalMs:            uint64(c.StatFlushInterval / time.Millisecond),
 		StatBufferIntervalMs:           uint64(c.StatBufferInterval / time.Millisecond),
+		CacheStartupGracePeriodMs:      uint64(c.CacheStartupGracePeriod / time.Millisecond),
+		StateBackupIntervalMs:          uint64(c.StateBackupInterval / time.Millisecond),
+		StateBackupMaxAgeMs:            uint64(c.StateBackupMaxAge / time.Millisecond),
+		PeerStateMaxAgeMs:              uint64(c.PeerStateMaxAge / time.Millisecond),
+		PollStartJitterMaxMs:           uint64(c.PollStartJitterMax / time.Millisecond),
 		Alias:                          (*Alias)(c),
 	})
 }
@@ -251,6 +356,11 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		ServeWriteTimeoutMs            *uint64 `json:"serve_write_timeout_ms"`
 		TrafficOpsMinRetryIntervalMs   *uint64 `json:"traffic_ops_min_retry_interval_ms"`
 		TrafficOpsMaxRetryIntervalMs   *uint64 `json:"traffic_ops_max_retry_interval_ms"`
+		CacheStartupGracePeriodMs      *uint64 `json:"cache_startup_grace_period_ms"`
+		StateBackupIntervalMs          *uint64 `json:"state_backup_interval_ms"`
+		StateBackupMaxAgeMs            *uint64 `json:"state_backup_max_age_ms"`
+		PeerStateMaxAgeMs              *uint64 `json:"peer_state_max_age_ms"`
+		PollStartJitterMaxMs           *uint64 `json:"poll_start_jitter_max_ms"`
 		*Alias
 	}{
 		Alias: (*Alias)(c),
@@ -287,9 +397,41 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	if aux.TrafficOpsMaxRetryIntervalMs != nil {
 		c.TrafficOpsMaxRetryInterval = time.Duration(*aux.TrafficOpsMaxRetryIntervalMs) * time.Millisecond
 	}
+	if aux.CacheStartupGracePeriodMs != nil {
+		c.CacheStartupGracePeriod = time.Duration(*aux.CacheStartupGracePeriodMs) * time.Millisecond
+	}
+	if aux.StateBackupIntervalMs != nil {
+		c.StateBackupInterval = time.Duration(*aux.StateBackupIntervalMs) * time.Millisecond
+	}
+	if aux.StateBackupMaxAgeMs != nil {
+		c.StateBackupMaxAge = time.Duration(*aux.StateBackupMaxAgeMs) * time.Millisecond
+	}
+	if aux.PeerStateMaxAgeMs != nil {
+		c.PeerStateMaxAge = time.Duration(*aux.PeerStateMaxAgeMs) * time.Millisecond
+	}
+	if aux.PollStartJitterMaxMs != nil {
+		c.PollStartJitterMax = time.Duration(*aux.PollStartJitterMaxMs) * time.Millisecond
+	}
 	if c.StatPolling && c.DistributedPolling {
 		return errors.New("invalid configuration: stat_polling cannot be enabled if distributed_polling is also enabled")
 	}
+	if c.CachePollingIPv4Weight == 0 || c.CachePollingIPv6Weight == 0 {
+		return errors.New("invalid configuration: cache_polling_ipv4_weight and cache_polling_ipv6_weight must be greater than zero")
+	}
+	if c.StateBackupFile != "" && c.StateBackupInterval <= 0 {
+		return errors.New("invalid configuration: state_backup_interval_ms must be greater than zero if state_backup_file is set")
+	}
+	if c.EventLogFileMaxBackups < 0 {
+		return errors.New("invalid configuration: event_log_file_max_backups cannot be negative")
+	}
+	if c.PrometheusMetricNames.LoadavgOne == "" || c.PrometheusMetricNames.InterfaceBytesOut == "" || c.PrometheusMetricNames.InterfaceLabel == "" {
+		return errors.New("invalid configuration: prometheus_metric_names loadavg_one, interface_bytes_out, and interface_label cannot be empty")
+	}
+	for cdn, quorumMin := range c.PeerOptimisticQuorumMinCDNs {
+		if quorumMin < 0 {
+			return fmt.Errorf("invalid configuration: peer_optimistic_quorum_min_cdns value for CDN '%s' cannot be negative", cdn)
+		}
+	}
 	return nil
 }
 
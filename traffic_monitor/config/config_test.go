@@ -21,6 +21,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 const exampleTMConfig = `
@@ -47,7 +48,13 @@ const exampleTMConfig = `
 	"crconfig_backup_file": "crconfig.asdf",
 	"tmconfig_backup_file": "tmconfig.asdf",
 	"http_polling_format": "thisformatdoesnotexist",
-	"static_file_dir": "static/"
+	"static_file_dir": "static/",
+	"cache_polling_ipv4_weight": 3,
+	"peer_optimistic_quorum_min_cdns": {"small-cdn": 1},
+	"cache_startup_grace_period_ms": 15000,
+	"state_backup_file": "state.asdf",
+	"state_backup_interval_ms": 30000,
+	"prometheus_metric_names": {"loadavg_one": "system_load1", "interface_label": "interface"}
 }
 `
 
@@ -111,6 +118,12 @@ func TestConfigLoad(t *testing.T) {
 	if c.PeerOptimisticQuorumMin != 3 {
 		t.Errorf("PeerOmptimisticQuorumMin - expected: 3, actual: %d", c.PeerOptimisticQuorumMin)
 	}
+	if quorumMin := c.PeerOptimisticQuorumMinForCDN("small-cdn"); quorumMin != 1 {
+		t.Errorf("PeerOptimisticQuorumMinForCDN(small-cdn) - expected: 1, actual: %d", quorumMin)
+	}
+	if quorumMin := c.PeerOptimisticQuorumMinForCDN("other-cdn"); quorumMin != 3 {
+		t.Errorf("PeerOptimisticQuorumMinForCDN(other-cdn) - expected: 3, actual: %d", quorumMin)
+	}
 	if c.TrafficOpsDiskRetryMax != 35 {
 		t.Errorf("TrafficOpsDiskRetryMax - expected: 35, actual: %d", c.TrafficOpsDiskRetryMax)
 	}
@@ -123,6 +136,33 @@ func TestConfigLoad(t *testing.T) {
 	if c.HTTPPollingFormat != "thisformatdoesnotexist" {
 		t.Errorf("HTTPPollingFormat - expected: thisformatdoesnotexist, actual: %s", c.HTTPPollingFormat)
 	}
+	if c.CachePollingIPv4Weight != 3 {
+		t.Errorf("CachePollingIPv4Weight - expected: 3, actual: %d", c.CachePollingIPv4Weight)
+	}
+	if c.CachePollingIPv6Weight != 1 {
+		t.Errorf("CachePollingIPv6Weight - expected: 1, actual: %d", c.CachePollingIPv6Weight)
+	}
+	if c.CacheStartupGracePeriod != 15*time.Second {
+		t.Errorf("CacheStartupGracePeriod - expected: 15s, actual: %v", c.CacheStartupGracePeriod)
+	}
+	if c.StateBackupFile != "state.asdf" {
+		t.Errorf("StateBackupFile - expected: state.asdf, actual: %s", c.StateBackupFile)
+	}
+	if c.StateBackupInterval != 30*time.Second {
+		t.Errorf("StateBackupInterval - expected: 30s, actual: %v", c.StateBackupInterval)
+	}
+	if c.StateBackupMaxAge != DefaultConfig.StateBackupMaxAge {
+		t.Errorf("StateBackupMaxAge - expected: %v, actual: %v", DefaultConfig.StateBackupMaxAge, c.StateBackupMaxAge)
+	}
+	if c.PrometheusMetricNames.LoadavgOne != "system_load1" {
+		t.Errorf("PrometheusMetricNames.LoadavgOne - expected: system_load1, actual: %s", c.PrometheusMetricNames.LoadavgOne)
+	}
+	if c.PrometheusMetricNames.InterfaceLabel != "interface" {
+		t.Errorf("PrometheusMetricNames.InterfaceLabel - expected: interface, actual: %s", c.PrometheusMetricNames.InterfaceLabel)
+	}
+	if c.PrometheusMetricNames.InterfaceBytesOut != DefaultConfig.PrometheusMetricNames.InterfaceBytesOut {
+		t.Errorf("PrometheusMetricNames.InterfaceBytesOut - expected: %s, actual: %s", DefaultConfig.PrometheusMetricNames.InterfaceBytesOut, c.PrometheusMetricNames.InterfaceBytesOut)
+	}
 }
 
 func TestBadConfigLoad(t *testing.T) {
@@ -132,6 +172,34 @@ func TestBadConfigLoad(t *testing.T) {
 	}
 }
 
+func TestBadPollingWeightConfigLoad(t *testing.T) {
+	_, err := LoadBytes([]byte(`{"cache_polling_ipv6_weight": 0}`))
+	if err == nil {
+		t.Errorf("loading bad config file (cache_polling_ipv6_weight zero) -- expected: error, actual: nil")
+	}
+}
+
+func TestBadPeerOptimisticQuorumMinCDNsConfigLoad(t *testing.T) {
+	_, err := LoadBytes([]byte(`{"peer_optimistic_quorum_min_cdns": {"cdn": -1}}`))
+	if err == nil {
+		t.Errorf("loading bad config file (negative peer_optimistic_quorum_min_cdns value) -- expected: error, actual: nil")
+	}
+}
+
+func TestBadStateBackupIntervalConfigLoad(t *testing.T) {
+	_, err := LoadBytes([]byte(`{"state_backup_file": "state.backup", "state_backup_interval_ms": 0}`))
+	if err == nil {
+		t.Errorf("loading bad config file (state_backup_file set with zero state_backup_interval_ms) -- expected: error, actual: nil")
+	}
+}
+
+func TestBadPrometheusMetricNamesConfigLoad(t *testing.T) {
+	_, err := LoadBytes([]byte(`{"prometheus_metric_names": {"loadavg_one": ""}}`))
+	if err == nil {
+		t.Errorf("loading bad config file (empty prometheus_metric_names loadavg_one) -- expected: error, actual: nil")
+	}
+}
+
 func TestConfigLoadDefaults(t *testing.T) {
 	c, err := LoadBytes([]byte(`{}`))
 	if err != nil {
@@ -0,0 +1,162 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package datareq
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// CacheStatusExplanation consolidates why a single cache is, or isn't, available: its latest poll, the availability
+// this Traffic Monitor calculated from it and why, the states of the cache reported by the peers, the combined state,
+// and the latest event of the cache.
+type CacheStatusExplanation struct {
+	Name       tc.CacheName `json:"name"`
+	Type       string       `json:"type"`
+	CacheGroup string       `json:"cacheGroup"`
+	// Status is the status of the cache in Traffic Ops.
+	Status string `json:"status"`
+	// Reason is the reason the cache has its local availability, e.g. the threshold which was exceeded.
+	Reason string `json:"reason"`
+	// UnavailableStat is the stat whose threshold made the cache unavailable, if any.
+	UnavailableStat string `json:"unavailableStat"`
+	// Poller is the poller whose result set the local availability.
+	Poller        string                                   `json:"poller"`
+	LastPoll      *CacheStatusPoll                         `json:"lastPoll"`
+	LocalState    *tc.IsAvailable                          `json:"localState"`
+	PeerStates    map[tc.TrafficMonitorName]PeerCacheState `json:"peerStates"`
+	CombinedState *tc.IsAvailable                          `json:"combinedState"`
+	LastEvent     *health.Event                            `json:"lastEvent"`
+}
+
+// CacheStatusPoll is the result of the latest health poll of a cache.
+type CacheStatusPoll struct {
+	Time          time.Time `json:"time"`
+	RequestTimeMs int64     `json:"requestTimeMs"`
+	Available     bool      `json:"available"`
+	Error         string    `json:"error"`
+}
+
+// PeerCacheState is the state of a cache reported by a peer Traffic Monitor, and whether the peer's states are being
+// combined.
+type PeerCacheState struct {
+	tc.IsAvailable
+	PeerAvailable bool `json:"peerAvailable"`
+}
+
+func srvCacheStatusExplanation(
+	errorCount threadsafe.Uint,
+	path string,
+	monitorConfig threadsafe.TrafficMonitorConfigMap,
+	localCacheStatus threadsafe.CacheAvailableStatus,
+	healthHistory threadsafe.ResultHistory,
+	localStates peer.CRStatesThreadsafe,
+	peerStates peer.CRStatesPeersThreadsafe,
+	combinedStates peer.CRStatesThreadsafe,
+	events health.ThreadsafeEvents,
+) ([]byte, int) {
+	cacheName := getPathArgument(path)
+	if cacheName == "" {
+		HandleErr(errorCount, path, errors.New("missing cache name"))
+		return []byte("missing cache name"), http.StatusBadRequest
+	}
+	server, ok := monitorConfig.Get().TrafficServer[cacheName]
+	if !ok {
+		return []byte("cache not found"), http.StatusNotFound
+	}
+
+	name := tc.CacheName(cacheName)
+	explanation := createCacheStatusExplanation(
+		server,
+		localCacheStatus.Get()[cacheName],
+		healthHistory.Get()[name],
+		localStates,
+		peerStates.GetCRStatesPeersInfo(),
+		combinedStates,
+		events.Get(),
+	)
+	json := jsoniter.ConfigFastest
+	bytes, err := json.Marshal(explanation)
+	return WrapErrCode(errorCount, path, bytes, err)
+}
+
+// createCacheStatusExplanation returns the explanation of the status of the given server. The events must be ordered
+// newest first, as they are stored.
+func createCacheStatusExplanation(
+	server tc.TrafficServer,
+	availableStatus cache.AvailableStatus,
+	healthHistory []cache.Result,
+	localStates peer.CRStatesThreadsafe,
+	peerCrStatesInfo peer.CRStatesPeersInfo,
+	combinedStates peer.CRStatesThreadsafe,
+	events []health.Event,
+) CacheStatusExplanation {
+	name := tc.CacheName(server.HostName)
+	explanation := CacheStatusExplanation{
+		Name:            name,
+		Type:            server.Type,
+		CacheGroup:      server.CacheGroup,
+		Status:          server.ServerStatus,
+		Reason:          availableStatus.Why,
+		UnavailableStat: availableStatus.UnavailableStat,
+		Poller:          availableStatus.Poller,
+		PeerStates:      map[tc.TrafficMonitorName]PeerCacheState{},
+	}
+
+	if len(healthHistory) > 0 {
+		result := healthHistory[0]
+		explanation.LastPoll = &CacheStatusPoll{
+			Time:          result.Time,
+			RequestTimeMs: result.RequestTime.Milliseconds(),
+			Available:     result.Available,
+		}
+		if result.Error != nil {
+			explanation.LastPoll.Error = result.Error.Error()
+		}
+	}
+	if state, ok := localStates.GetCache(name); ok {
+		explanation.LocalState = &state
+	}
+	for peerName, peerCrStates := range peerCrStatesInfo.GetCrStates() {
+		if state, ok := peerCrStates.Caches[name]; ok {
+			explanation.PeerStates[peerName] = PeerCacheState{IsAvailable: state, PeerAvailable: peerCrStatesInfo.GetPeerAvailability(peerName)}
+		}
+	}
+	if state, ok := combinedStates.GetCache(name); ok {
+		explanation.CombinedState = &state
+	}
+	for _, event := range events {
+		if event.Hostname == server.HostName {
+			event := event
+			explanation.LastEvent = &event
+			break
+		}
+	}
+	return explanation
+}
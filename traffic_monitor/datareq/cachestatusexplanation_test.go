@@ -0,0 +1,92 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+)
+
+func TestCreateCacheStatusExplanation(t *testing.T) {
+	server := tc.TrafficServer{HostName: "edge", Type: "EDGE", CacheGroup: "cg", ServerStatus: "REPORTED"}
+	availableStatus := cache.AvailableStatus{
+		Why:             "loadavg too high (11.00 > 10.00)",
+		UnavailableStat: "loadavg",
+		Poller:          "health",
+	}
+	pollTime := time.Now()
+	healthHistory := []cache.Result{
+		{Time: pollTime, RequestTime: 20 * time.Millisecond, Error: errors.New("timeout")},
+		{Time: pollTime.Add(-time.Second), Available: true},
+	}
+
+	localStates := peer.NewCRStatesThreadsafe()
+	localStates.AddCache("edge", tc.IsAvailable{IsAvailable: false, Status: "REPORTED - unavailable"})
+	combinedStates := peer.NewCRStatesThreadsafe()
+	combinedStates.AddCache("edge", tc.IsAvailable{IsAvailable: true})
+
+	peerStates := peer.NewCRStatesPeersThreadsafe(0)
+	peerStates.Set(peer.Result{
+		ID:         "tm2",
+		Available:  true,
+		PeerStates: tc.CRStates{Caches: map[tc.CacheName]tc.IsAvailable{"edge": {IsAvailable: true}}},
+		Time:       time.Now(),
+	})
+	peerStates.SetPeers(map[tc.TrafficMonitorName]struct{}{"tm2": {}})
+
+	events := []health.Event{
+		{Hostname: "mid", Description: "mid event"},
+		{Hostname: "edge", Description: "newest edge event"},
+		{Hostname: "edge", Description: "older edge event"},
+	}
+
+	explanation := createCacheStatusExplanation(server, availableStatus, healthHistory, localStates, peerStates.GetCRStatesPeersInfo(), combinedStates, events)
+
+	if explanation.Reason != availableStatus.Why || explanation.UnavailableStat != "loadavg" || explanation.Poller != "health" {
+		t.Errorf("expected the local availability reason, stat, and poller, actual: %+v", explanation)
+	}
+	if explanation.LastPoll == nil || !explanation.LastPoll.Time.Equal(pollTime) || explanation.LastPoll.Error != "timeout" || explanation.LastPoll.RequestTimeMs != 20 {
+		t.Errorf("expected the latest poll with its error, actual: %+v", explanation.LastPoll)
+	}
+	if explanation.LocalState == nil || explanation.LocalState.IsAvailable {
+		t.Errorf("expected the local state to be unavailable, actual: %+v", explanation.LocalState)
+	}
+	if explanation.CombinedState == nil || !explanation.CombinedState.IsAvailable {
+		t.Errorf("expected the combined state to be available, actual: %+v", explanation.CombinedState)
+	}
+	if state, ok := explanation.PeerStates["tm2"]; !ok || !state.IsAvailable.IsAvailable || !state.PeerAvailable {
+		t.Errorf("expected the available peer's state of the cache, actual: %+v", explanation.PeerStates)
+	}
+	if explanation.LastEvent == nil || explanation.LastEvent.Description != "newest edge event" {
+		t.Errorf("expected the newest event of the cache, actual: %+v", explanation.LastEvent)
+	}
+
+	// a cache which hasn't been polled and has no events has no last poll or event.
+	explanation = createCacheStatusExplanation(tc.TrafficServer{HostName: "new"}, cache.AvailableStatus{}, nil, localStates, peerStates.GetCRStatesPeersInfo(), combinedStates, events)
+	if explanation.LastPoll != nil || explanation.LastEvent != nil || explanation.LocalState != nil || len(explanation.PeerStates) != 0 {
+		t.Errorf("expected an unpolled cache to have no poll, event, or states, actual: %+v", explanation)
+	}
+}
@@ -20,9 +20,11 @@
 package datareq
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/lib/go-tc"
@@ -38,7 +40,20 @@ func srvTRState(
 ) ([]byte, int, error) {
 	_, raw := params["raw"]     // peer polling case
 	_, local := params["local"] // distributed peer polling case
+
+	sinceStr, delta := params["since"] // delta case, for clients polling often
+	since := uint64(0)
+	if delta {
+		var err error
+		if since, err = strconv.ParseUint(sinceStr[0], 10, 64); err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid since '%s', must be a state version", sinceStr[0])
+		}
+	}
 	if raw {
+		if delta {
+			data, err := srvTRStateDelta(localStates, since, distributedPollingEnabled)
+			return data, http.StatusOK, err
+		}
 		data, err := srvTRStateSelf(localStates, distributedPollingEnabled)
 		return data, http.StatusOK, err
 	}
@@ -58,6 +73,10 @@ func srvTRState(
 		}
 	}
 
+	if delta {
+		data, err := srvTRStateDelta(combinedStates, since, local && distributedPollingEnabled)
+		return data, http.StatusOK, err
+	}
 	data, err := srvTRStateDerived(combinedStates, local && distributedPollingEnabled)
 
 	return data, http.StatusOK, err
@@ -91,3 +110,12 @@ func srvTRStateSelf(localStates peer.CRStatesThreadsafe, directlyPolledOnly bool
 	unfiltered := localStates.Get()
 	return tc.CRStatesMarshall(filterDirectlyPolledCaches(unfiltered))
 }
+
+// srvTRStateDelta serves the changes to the given states since the given version, or every state if the changes since it aren't known.
+func srvTRStateDelta(states peer.CRStatesThreadsafe, since uint64, directlyPolledOnly bool) ([]byte, error) {
+	delta := states.GetDelta(since)
+	if directlyPolledOnly {
+		delta.Caches = filterDirectlyPolledCaches(tc.CRStates{Caches: delta.Caches}).Caches
+	}
+	return json.Marshal(delta)
+}
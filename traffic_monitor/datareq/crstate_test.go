@@ -0,0 +1,75 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+)
+
+func TestSrvTRStateSince(t *testing.T) {
+	states := peer.NewCRStatesThreadsafe()
+	states.AddCache("edge1", tc.IsAvailable{IsAvailable: true})
+	states.AddCache("edge2", tc.IsAvailable{IsAvailable: true})
+	peerStates := peer.NewCRStatesPeersThreadsafe(0)
+
+	for _, since := range []string{"abc", "-1", "1.5", ""} {
+		if _, code, err := srvTRState(url.Values{"since": {since}}, states, states, peerStates, false); err == nil || code != http.StatusBadRequest {
+			t.Errorf("expected since '%s' to be rejected with %d, actual: %d %v", since, http.StatusBadRequest, code, err)
+		}
+	}
+
+	version := states.Version()
+	states.SetCache("edge1", tc.IsAvailable{IsAvailable: false})
+	for _, params := range []url.Values{
+		{"since": {strconv.FormatUint(version, 10)}},
+		{"since": {strconv.FormatUint(version, 10)}, "raw": {""}},
+	} {
+		bts, code, err := srvTRState(params, states, states, peerStates, false)
+		if err != nil || code != http.StatusOK {
+			t.Fatalf("%v: expected %d, actual: %d %v", params, http.StatusOK, code, err)
+		}
+		delta := tc.CRStatesDelta{}
+		if err := json.Unmarshal(bts, &delta); err != nil {
+			t.Fatalf("%v: expected a delta, actual: %s", params, bts)
+		}
+		if delta.Full || delta.Since != version || len(delta.Caches) != 1 || delta.Caches["edge1"].IsAvailable {
+			t.Errorf("%v: expected a delta with only edge1 changed, actual: %+v", params, delta)
+		}
+	}
+
+	bts, code, err := srvTRState(url.Values{"since": {"0"}}, states, states, peerStates, false)
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("expected %d, actual: %d %v", http.StatusOK, code, err)
+	}
+	delta := tc.CRStatesDelta{}
+	if err := json.Unmarshal(bts, &delta); err != nil {
+		t.Fatalf("expected a delta, actual: %s", bts)
+	}
+	if !delta.Full || len(delta.Caches) != 2 {
+		t.Errorf("expected a full delta since 0, actual: %+v", delta)
+	}
+}
@@ -60,11 +60,16 @@ func MakeDispatchMap(
 	fetchCount threadsafe.Uint,
 	healthIteration threadsafe.Uint,
 	errorCount threadsafe.Uint,
+	combineCount threadsafe.Uint,
+	combineCoalescedCount threadsafe.Uint,
 	toData todata.TODataThreadsafe,
 	localCacheStatus threadsafe.CacheAvailableStatus,
 	lastStats threadsafe.LastStats,
 	statUnpolledCaches threadsafe.UnpolledCaches,
 	healthUnpolledCaches threadsafe.UnpolledCaches,
+	cacheGracePeriods threadsafe.CacheGracePeriods,
+	pollingAssignment threadsafe.PollingAssignment,
+	restoredStateTime threadsafe.Time,
 	monitorConfig threadsafe.TrafficMonitorConfigMap,
 	statPollingEnabled bool,
 	distributedPollingEnabled bool,
@@ -74,9 +79,9 @@ func MakeDispatchMap(
 	wrap := func(f http.HandlerFunc) http.HandlerFunc {
 
 		if statPollingEnabled {
-			return wrapUnpolledCheck(statUnpolledCaches, errorCount, f)
+			return wrapUnpolledCheck(statUnpolledCaches, restoredStateTime, errorCount, f)
 		} else {
-			return wrapUnpolledCheck(healthUnpolledCaches, errorCount, f)
+			return wrapUnpolledCheck(healthUnpolledCaches, restoredStateTime, errorCount, f)
 		}
 	}
 
@@ -95,6 +100,10 @@ func MakeDispatchMap(
 		"/publish/CacheStats": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
 			return srvLegacyCacheStats(params, errorCount, path, toData, statResultHistory, statInfoHistory, monitorConfig, combinedStates, statMaxKbpses)
 		}, rfc.ApplicationJSON)),
+		// not wrapped, so why a cache is unavailable can be seen while serving is blocked on unpolled caches.
+		"/publish/CacheStatus/": WrapParams(func(params url.Values, path string) ([]byte, int) {
+			return srvCacheStatusExplanation(errorCount, path, monitorConfig, localCacheStatus, healthHistory, localStates, peerStates, combinedStates, events)
+		}, rfc.ApplicationJSON),
 		"/publish/DsStats": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
 			return srvDSStats(params, errorCount, path, toData, dsStats)
 		}, rfc.ApplicationJSON)),
@@ -108,11 +117,18 @@ func MakeDispatchMap(
 			return srvPeerStates(params, errorCount, path, toData, distributedPeerStates)
 		}, rfc.ApplicationJSON)),
 		"/publish/Stats": wrap(WrapErr(errorCount, func() ([]byte, error) {
-			return srvStats(staticAppData, healthPollInterval, lastHealthDurations, fetchCount, healthIteration, errorCount, peerStates)
+			return srvStats(staticAppData, healthPollInterval, lastHealthDurations, fetchCount, healthIteration, errorCount, combineCount, combineCoalescedCount, peerStates, events)
 		}, rfc.ApplicationJSON)),
 		"/publish/ConfigDoc": wrap(WrapErr(errorCount, func() ([]byte, error) {
 			return srvConfigDoc(opsConfig)
 		}, rfc.ApplicationJSON)),
+		// not wrapped, so the caches which haven't been polled can be seen while serving is blocked on them.
+		"/publish/UnpolledCaches": WrapErr(errorCount, func() ([]byte, error) {
+			return srvUnpolledCaches(statUnpolledCaches, healthUnpolledCaches, cacheGracePeriods)
+		}, rfc.ApplicationJSON),
+		"/publish/PollingAssignment": wrap(WrapErr(errorCount, func() ([]byte, error) {
+			return srvPollingAssignment(pollingAssignment, distributedPeerStates, distributedPollingEnabled)
+		}, rfc.ApplicationJSON)),
 		"/publish/StatSummary": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
 			return srvStatSummary(params, errorCount, path, toData, statResultHistory)
 		}, rfc.ApplicationJSON)),
@@ -146,6 +162,9 @@ func MakeDispatchMap(
 		"/api/crconfig-history": wrap(WrapErr(errorCount, func() ([]byte, error) {
 			return srvAPICRConfigHist(toSession)
 		}, rfc.ApplicationJSON)),
+		"/metrics": wrap(WrapBytes(func() []byte {
+			return srvMetrics(opsConfig, monitorConfig, combinedStates, healthHistory, statMaxKbpses, fetchCount, healthIteration, errorCount, combineCount, combineCoalescedCount)
+		}, ContentTypeOpenMetrics)),
 	}
 
 	return addTrailingSlashEndpoints(dispatchMap)
@@ -317,8 +336,13 @@ func accessLogStr(
 		userAgent)
 }
 
+// RestoredStateTimeHeader is the response header containing the time at which the states being served were backed up,
+// while states restored from a state backup on startup are being served because not all caches have been polled yet.
+const RestoredStateTimeHeader = "Restored-State-Time"
+
 // WrapUnpolledCheck wraps an http.HandlerFunc, returning ServiceUnavailable if all caches have't been polled; else, calling the wrapped func. Once all caches have been polled, we never return a 503 again, even if the CRConfig has been changed and new, unpolled caches exist. This is because, before those new caches existed in the CRConfig, they weren't being routed to, so it doesn't break anything to continue not routing to them until they're polled, while still serving polled caches as available. Whereas, on startup, if we were to return data with some caches unpolled, we would be telling clients that existing, potentially-available caches are unavailable, simply because we hadn't polled them yet.
-func wrapUnpolledCheck(unpolledCaches threadsafe.UnpolledCaches, errorCount threadsafe.Uint, f http.HandlerFunc) http.HandlerFunc {
+// If states were restored from a state backup on startup, the wrapped func is called even while caches are unpolled, with the time the restored states were backed up in the RestoredStateTimeHeader, so clients know the age of the data.
+func wrapUnpolledCheck(unpolledCaches threadsafe.UnpolledCaches, restoredStateTime threadsafe.Time, errorCount threadsafe.Uint, f http.HandlerFunc) http.HandlerFunc {
 
 	polledAll := false
 	polledLocal := false
@@ -335,10 +359,14 @@ func wrapUnpolledCheck(unpolledCaches threadsafe.UnpolledCaches, errorCount thre
 			polledLocal = !unpolledCaches.AnyDirectlyPolled()
 			rawOrLocal := r.URL.Query().Has("raw") || r.URL.Query().Has("local")
 			if (!rawOrLocal && !polledAll) || (rawOrLocal && !polledLocal) {
-				HandleErr(errorCount, r.URL.EscapedPath(), fmt.Errorf("service still starting, some caches unpolled: %v", unpolledCaches.UnpolledCaches()))
-				iw.WriteHeader(http.StatusServiceUnavailable)
-				log.Write(iw, []byte("Service Unavailable"), r.URL.EscapedPath())
-				return
+				restored := restoredStateTime.Get()
+				if restored.IsZero() {
+					HandleErr(errorCount, r.URL.EscapedPath(), fmt.Errorf("service still starting, some caches unpolled: %v", unpolledCaches.UnpolledCaches()))
+					iw.WriteHeader(http.StatusServiceUnavailable)
+					log.Write(iw, []byte("Service Unavailable"), r.URL.EscapedPath())
+					return
+				}
+				iw.Header().Set(RestoredStateTimeHeader, restored.UTC().Format(http.TimeFormat))
 			}
 		}
 		iw.Header().Set(rfc.PermissionsPolicy, "interest-cohort=()")
@@ -28,6 +28,7 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/lib/go-util"
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/test"
 
@@ -195,9 +196,13 @@ func TestGetStats(t *testing.T) {
 	fetchCount := uint64(test.RandInt())
 	healthIteration := uint64(test.RandInt())
 	errCount := uint64(test.RandInt())
+	combineCount := uint64(test.RandInt())
+	combineCoalescedCount := uint64(test.RandInt())
 	crStatesPeers := getMockCRStatesPeers(1, 10, Random)
+	webhookStats := health.EventWebhookStats{Delivered: uint64(test.RandInt()), Failed: uint64(test.RandInt()), Dropped: uint64(test.RandInt())}
+	eventsDropped := uint64(test.RandInt())
 
-	statsBts, err := getStats(appData, pollingInterval, lastHealthTimes, fetchCount, healthIteration, errCount, crStatesPeers)
+	statsBts, err := getStats(appData, pollingInterval, lastHealthTimes, fetchCount, healthIteration, errCount, combineCount, combineCoalescedCount, crStatesPeers, webhookStats, eventsDropped)
 	if err != nil {
 		t.Fatalf("expected getStats error: nil, actual: %+v\n", err)
 	}
@@ -215,6 +220,27 @@ func TestGetStats(t *testing.T) {
 	if st.ErrorCount != errCount {
 		t.Fatalf("expected getStats ErrorCount '%+v', actual: '%+v'\n", errCount, st.ErrorCount)
 	}
+	if st.StateCombineCount != combineCount {
+		t.Fatalf("expected getStats StateCombineCount '%+v', actual: '%+v'\n", combineCount, st.StateCombineCount)
+	}
+	if st.StateCombineCoalescedCount != combineCoalescedCount {
+		t.Fatalf("expected getStats StateCombineCoalescedCount '%+v', actual: '%+v'\n", combineCoalescedCount, st.StateCombineCoalescedCount)
+	}
+	if st.PeerOptimisticQuorumMin != crStatesPeers.GetQuorumMin() {
+		t.Fatalf("expected getStats PeerOptimisticQuorumMin '%+v', actual: '%+v'\n", crStatesPeers.GetQuorumMin(), st.PeerOptimisticQuorumMin)
+	}
+	if st.EventWebhookDeliveredCount != webhookStats.Delivered {
+		t.Fatalf("expected getStats EventWebhookDeliveredCount '%+v', actual: '%+v'\n", webhookStats.Delivered, st.EventWebhookDeliveredCount)
+	}
+	if st.EventWebhookFailedCount != webhookStats.Failed {
+		t.Fatalf("expected getStats EventWebhookFailedCount '%+v', actual: '%+v'\n", webhookStats.Failed, st.EventWebhookFailedCount)
+	}
+	if st.EventWebhookDroppedCount != webhookStats.Dropped {
+		t.Fatalf("expected getStats EventWebhookDroppedCount '%+v', actual: '%+v'\n", webhookStats.Dropped, st.EventWebhookDroppedCount)
+	}
+	if st.EventsDroppedCount != eventsDropped {
+		t.Fatalf("expected getStats EventsDroppedCount '%+v', actual: '%+v'\n", eventsDropped, st.EventsDroppedCount)
+	}
 	if st.Uptime < uint64(time.Since(appData.StartTime)/time.Second) {
 		t.Fatalf("expected getStats Uptime > '%+v', actual: '%+v'\n", appData.StartTime, st.Uptime)
 	}
@@ -28,9 +28,11 @@ import (
 // JSONEvents represents the structure we wish to serialize to JSON, for Events.
 type JSONEvents struct {
 	Events []health.Event `json:"events"`
+	// DroppedCount is the number of events evicted because the maximum number of events was exceeded.
+	DroppedCount uint64 `json:"droppedCount"`
 }
 
 func srvEventLog(events health.ThreadsafeEvents) ([]byte, error) {
 	json := jsoniter.ConfigFastest
-	return json.Marshal(JSONEvents{Events: events.Get()})
+	return json.Marshal(JSONEvents{Events: events.Get(), DroppedCount: events.Dropped()})
 }
@@ -0,0 +1,197 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package datareq
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+// ContentTypeOpenMetrics is the Content-Type of the metrics endpoint.
+const ContentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// MetricsPrefix is the prefix of the names of the metrics Traffic Monitor exposes.
+const MetricsPrefix = "traffic_monitor_"
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsWriter writes metrics in the OpenMetrics text format.
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+// family writes the metadata of a metric family.
+func (w *metricsWriter) family(name string, metricType string, help string) {
+	fmt.Fprintf(&w.buf, "# TYPE %s%s %s\n# HELP %s%s %s\n", MetricsPrefix, name, metricType, MetricsPrefix, name, help)
+}
+
+// sample writes a sample of a metric. labels are pairs of label names and values.
+func (w *metricsWriter) sample(name string, value string, labels ...string) {
+	w.buf.WriteString(MetricsPrefix + name)
+	if len(labels) > 0 {
+		w.buf.WriteString("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteString(",")
+			}
+			w.buf.WriteString(labels[i] + `="` + labelValueEscaper.Replace(labels[i+1]) + `"`)
+		}
+		w.buf.WriteString("}")
+	}
+	w.buf.WriteString(" " + value + "\n")
+}
+
+func formatUint(u uint64) string {
+	return strconv.FormatUint(u, 10)
+}
+
+func srvMetrics(
+	opsConfig threadsafe.OpsConfig,
+	monitorConfig threadsafe.TrafficMonitorConfigMap,
+	combinedStates peer.CRStatesThreadsafe,
+	healthHistory threadsafe.ResultHistory,
+	statMaxKbpses threadsafe.CacheKbpses,
+	fetchCount threadsafe.Uint,
+	healthIteration threadsafe.Uint,
+	errorCount threadsafe.Uint,
+	combineCount threadsafe.Uint,
+	combineCoalescedCount threadsafe.Uint,
+) []byte {
+	// each of these gets its own copy under its own lock, so polling is never blocked for longer than a copy.
+	return createMetrics(
+		opsConfig.Get().CdnName,
+		monitorConfig.Get().TrafficServer,
+		combinedStates.GetCaches(),
+		healthHistory.Get(),
+		statMaxKbpses.Get(),
+		cache.PollCounts(),
+		map[string]uint64{
+			"health_fetches":           fetchCount.Get(),
+			"health_iterations":        healthIteration.Get(),
+			"request_errors":           errorCount.Get(),
+			"state_combines":           combineCount.Get(),
+			"state_combines_coalesced": combineCoalescedCount.Get(),
+		},
+	)
+}
+
+// metricsCounterHelp is the help of each of the process-wide counters.
+var metricsCounterHelp = map[string]string{
+	"health_fetches":           "The number of health polls of individual caches.",
+	"health_iterations":        "The number of times all caches were health polled.",
+	"request_errors":           "The number of errors serving Traffic Monitor's own endpoints.",
+	"state_combines":           "The number of times the local and peer cache states were combined.",
+	"state_combines_coalesced": "The number of requests to combine cache states which were collapsed into a pending combine.",
+}
+
+// createMetrics returns the OpenMetrics text of the given state. Every cache
+// metric is labelled with the CDN, cache group, cache name and type.
+func createMetrics(
+	cdn string,
+	servers map[string]tc.TrafficServer,
+	states map[tc.CacheName]tc.IsAvailable,
+	healthHistory map[tc.CacheName][]cache.Result,
+	maxKbpses map[string]uint64,
+	pollCounts map[string]map[string]cache.PollCount,
+	counters map[string]uint64,
+) []byte {
+	cacheNames := make([]string, 0, len(servers))
+	for name := range servers {
+		cacheNames = append(cacheNames, name)
+	}
+	sort.Strings(cacheNames)
+	labels := func(name string, extra ...string) []string {
+		server := servers[name]
+		return append([]string{"cdn", cdn, "cachegroup", server.CacheGroup, "cache", name, "type", server.Type}, extra...)
+	}
+
+	w := &metricsWriter{}
+
+	w.family("cache_available", "gauge", "Whether the cache is available, 1 if it is and 0 if not, as combined with the peer Traffic Monitors.")
+	for _, name := range cacheNames {
+		state, ok := states[tc.CacheName(name)]
+		if !ok {
+			continue
+		}
+		available := "0"
+		if state.IsAvailable {
+			available = "1"
+		}
+		w.sample("cache_available", available, labels(name)...)
+	}
+
+	w.family("cache_bandwidth_kbps", "gauge", "The outgoing bandwidth of the cache in the latest health poll, in kilobits per second.")
+	for _, name := range cacheNames {
+		history := healthHistory[tc.CacheName(name)]
+		if len(history) == 0 || history[0].Error != nil {
+			continue
+		}
+		kbps := int64(0)
+		for _, vitals := range history[0].InterfaceVitals {
+			kbps += vitals.KbpsOut
+		}
+		w.sample("cache_bandwidth_kbps", strconv.FormatInt(kbps, 10), labels(name)...)
+	}
+
+	w.family("cache_bandwidth_capacity_kbps", "gauge", "The maximum outgoing bandwidth of the cache, in kilobits per second.")
+	for _, name := range cacheNames {
+		if kbps, ok := maxKbpses[name]; ok {
+			w.sample("cache_bandwidth_capacity_kbps", formatUint(kbps), labels(name)...)
+		}
+	}
+
+	w.family("cache_polls", "counter", "The number of polls of the cache, by poller and result.")
+	pollers := make([]string, 0, len(pollCounts))
+	for poller := range pollCounts {
+		pollers = append(pollers, poller)
+	}
+	sort.Strings(pollers)
+	for _, poller := range pollers {
+		for _, name := range cacheNames {
+			count, ok := pollCounts[poller][name]
+			if !ok {
+				continue
+			}
+			w.sample("cache_polls_total", formatUint(count.Success), labels(name, "poller", poller, "result", "success")...)
+			w.sample("cache_polls_total", formatUint(count.Error), labels(name, "poller", poller, "result", "error")...)
+		}
+	}
+
+	counterNames := make([]string, 0, len(counters))
+	for name := range counters {
+		counterNames = append(counterNames, name)
+	}
+	sort.Strings(counterNames)
+	for _, name := range counterNames {
+		w.family(name, "counter", metricsCounterHelp[name])
+		w.sample(name+"_total", formatUint(counters[name]), "cdn", cdn)
+	}
+
+	w.buf.WriteString("# EOF\n")
+	return w.buf.Bytes()
+}
@@ -0,0 +1,75 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+)
+
+func TestCreateMetrics(t *testing.T) {
+	servers := map[string]tc.TrafficServer{
+		"edge1": {CacheGroup: "cg1", Type: "EDGE"},
+		"edge2": {CacheGroup: `c"g2`, Type: "EDGE"},
+	}
+	states := map[tc.CacheName]tc.IsAvailable{
+		"edge1": {IsAvailable: true},
+		"edge2": {IsAvailable: false},
+	}
+	healthHistory := map[tc.CacheName][]cache.Result{
+		"edge1": {{InterfaceVitals: map[string]cache.Vitals{"eth0": {KbpsOut: 100}, "eth1": {KbpsOut: 50}}}},
+		"edge2": {{Error: errors.New("connection refused")}},
+	}
+	maxKbpses := map[string]uint64{"edge1": 1000}
+	pollCounts := map[string]map[string]cache.PollCount{
+		cache.PollerHealth: {"edge1": {Success: 10, Error: 1}},
+	}
+	counters := map[string]uint64{"state_combines": 5}
+
+	metrics := string(createMetrics("cdn1", servers, states, healthHistory, maxKbpses, pollCounts, counters))
+
+	expected := []string{
+		"# TYPE traffic_monitor_cache_available gauge\n",
+		`traffic_monitor_cache_available{cdn="cdn1",cachegroup="cg1",cache="edge1",type="EDGE"} 1` + "\n",
+		`traffic_monitor_cache_available{cdn="cdn1",cachegroup="c\"g2",cache="edge2",type="EDGE"} 0` + "\n",
+		`traffic_monitor_cache_bandwidth_kbps{cdn="cdn1",cachegroup="cg1",cache="edge1",type="EDGE"} 150` + "\n",
+		`traffic_monitor_cache_bandwidth_capacity_kbps{cdn="cdn1",cachegroup="cg1",cache="edge1",type="EDGE"} 1000` + "\n",
+		"# TYPE traffic_monitor_cache_polls counter\n",
+		`traffic_monitor_cache_polls_total{cdn="cdn1",cachegroup="cg1",cache="edge1",type="EDGE",poller="health",result="success"} 10` + "\n",
+		`traffic_monitor_cache_polls_total{cdn="cdn1",cachegroup="cg1",cache="edge1",type="EDGE",poller="health",result="error"} 1` + "\n",
+		"# TYPE traffic_monitor_state_combines counter\n",
+		`traffic_monitor_state_combines_total{cdn="cdn1"} 5` + "\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("expected metrics to contain %q, actual:\n%s", line, metrics)
+		}
+	}
+	if strings.Contains(metrics, `traffic_monitor_cache_bandwidth_kbps{cdn="cdn1",cachegroup="c\"g2"`) {
+		t.Error("expected no bandwidth for a cache whose latest health poll failed")
+	}
+	if !strings.HasSuffix(metrics, "# EOF\n") {
+		t.Error("expected metrics to end with '# EOF'")
+	}
+}
@@ -32,10 +32,17 @@ import (
 	jsoniter "github.com/json-iterator/go"
 )
 
-// APIPeerStates contains the data to be returned for an API call to get the peer states of a Traffic Monitor. This contains common API data returned by most endpoints, and a map of peers, to caches' states.
+// APIPeerStates contains the data to be returned for an API call to get the peer states of a Traffic Monitor. This contains common API data returned by most endpoints, a map of peers, to caches' states, and the peers whose states are stale.
 type APIPeerStates struct {
 	tc.CommonAPIData
-	Peers map[tc.TrafficMonitorName]map[tc.CacheName][]CacheState `json:"peers"`
+	Peers      map[tc.TrafficMonitorName]map[tc.CacheName][]CacheState `json:"peers"`
+	StalePeers map[tc.TrafficMonitorName]StalePeer                     `json:"stalePeers"`
+}
+
+// StalePeer is a peer whose last state is older than the maximum age, and so is excluded from the combined states.
+type StalePeer struct {
+	LastStateTime time.Time `json:"lastStateTime"`
+	AgeMs         int64     `json:"ageMs"`
 }
 
 // CacheState represents the available state of a cache.
@@ -52,14 +59,16 @@ func srvPeerStates(params url.Values, errorCount threadsafe.Uint, path string, t
 		return []byte(err.Error()), http.StatusBadRequest
 	}
 	json := jsoniter.ConfigFastest
-	bytes, err := json.Marshal(createAPIPeerStates(peerStates.GetCrstates(), peerStates.GetPeersOnline(), filter, params))
+	bytes, err := json.Marshal(createAPIPeerStates(peerStates.GetCrstates(), peerStates.GetPeersOnline(), peerStates.GetStalePeers(), filter, params))
 	return WrapErrCode(errorCount, path, bytes, err)
 }
 
-func createAPIPeerStates(peerStates map[tc.TrafficMonitorName]tc.CRStates, peersOnline map[tc.TrafficMonitorName]bool, filter *PeerStateFilter, params url.Values) APIPeerStates {
+func createAPIPeerStates(peerStates map[tc.TrafficMonitorName]tc.CRStates, peersOnline map[tc.TrafficMonitorName]bool, stalePeers map[tc.TrafficMonitorName]time.Time, filter *PeerStateFilter, params url.Values) APIPeerStates {
+	now := time.Now()
 	apiPeerStates := APIPeerStates{
-		CommonAPIData: srvhttp.GetCommonAPIData(params, time.Now()),
+		CommonAPIData: srvhttp.GetCommonAPIData(params, now),
 		Peers:         map[tc.TrafficMonitorName]map[tc.CacheName][]CacheState{},
+		StalePeers:    map[tc.TrafficMonitorName]StalePeer{},
 	}
 
 	for peer, state := range peerStates {
@@ -69,6 +78,9 @@ func createAPIPeerStates(peerStates map[tc.TrafficMonitorName]tc.CRStates, peers
 		if !filter.UsePeer(peer) {
 			continue
 		}
+		if stateTime, ok := stalePeers[peer]; ok {
+			apiPeerStates.StalePeers[peer] = StalePeer{LastStateTime: stateTime, AgeMs: now.Sub(stateTime).Milliseconds()}
+		}
 		if _, ok := apiPeerStates.Peers[peer]; !ok {
 			apiPeerStates.Peers[peer] = map[tc.CacheName][]CacheState{}
 		}
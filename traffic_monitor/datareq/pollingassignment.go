@@ -0,0 +1,93 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package datareq
+
+import (
+	"sort"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// PollingAssignmentGroup is the cache groups assigned to a Traffic Monitor group, and whether the group is polling
+// them.
+type PollingAssignmentGroup struct {
+	CacheGroups []string `json:"cacheGroups"`
+	Live        bool     `json:"live"`
+}
+
+// PollingAssignmentResponse is the response of the /publish/PollingAssignment endpoint.
+type PollingAssignmentResponse struct {
+	DistributedPolling bool                              `json:"distributedPolling"`
+	TMGroup            string                            `json:"tmGroup"`
+	PolledCaches       []tc.CacheName                    `json:"polledCaches"`
+	ExpectedCaches     []tc.CacheName                    `json:"expectedCaches"`
+	Groups             map[string]PollingAssignmentGroup `json:"groups"`
+	CoverageGaps       []tc.CacheName                    `json:"coverageGaps"`
+}
+
+func srvPollingAssignment(pollingAssignment threadsafe.PollingAssignment, distributedPeerStates peer.CRStatesPeersThreadsafe, distributedPollingEnabled bool) ([]byte, error) {
+	json := jsoniter.ConfigFastest
+	return json.Marshal(createPollingAssignment(pollingAssignment.Get(), distributedPollingEnabled, distributedPeerStates.GetPeerAvailability))
+}
+
+// createPollingAssignment returns the caches this Traffic Monitor polls, the caches expected to be polled by all the
+// Traffic Monitor groups, and the caches which no live group is polling. This Traffic Monitor's own group is always
+// live; the others are live if their distributed peer is available.
+func createPollingAssignment(assignment threadsafe.PollingAssignmentData, distributedPollingEnabled bool, peerAvailable func(tc.TrafficMonitorName) bool) PollingAssignmentResponse {
+	resp := PollingAssignmentResponse{
+		DistributedPolling: distributedPollingEnabled,
+		TMGroup:            assignment.TMGroup,
+		PolledCaches:       []tc.CacheName{},
+		ExpectedCaches:     []tc.CacheName{},
+		Groups:             make(map[string]PollingAssignmentGroup, len(assignment.CacheGroups)),
+		CoverageGaps:       []tc.CacheName{},
+	}
+
+	polledBy := map[string]string{}
+	liveCacheGroups := map[string]struct{}{}
+	for tmGroup, cacheGroups := range assignment.CacheGroups {
+		live := tmGroup == assignment.TMGroup || (distributedPollingEnabled && peerAvailable(tc.TrafficMonitorName(tmGroup)))
+		resp.Groups[tmGroup] = PollingAssignmentGroup{CacheGroups: cacheGroups, Live: live}
+		for _, cacheGroup := range cacheGroups {
+			polledBy[cacheGroup] = tmGroup
+			if live {
+				liveCacheGroups[cacheGroup] = struct{}{}
+			}
+		}
+	}
+
+	for cacheName, cacheGroup := range assignment.Caches {
+		resp.ExpectedCaches = append(resp.ExpectedCaches, cacheName)
+		if polledBy[cacheGroup] == assignment.TMGroup {
+			resp.PolledCaches = append(resp.PolledCaches, cacheName)
+		}
+		if _, ok := liveCacheGroups[cacheGroup]; !ok {
+			resp.CoverageGaps = append(resp.CoverageGaps, cacheName)
+		}
+	}
+	for _, caches := range [][]tc.CacheName{resp.PolledCaches, resp.ExpectedCaches, resp.CoverageGaps} {
+		sort.Slice(caches, func(i, j int) bool { return caches[i] < caches[j] })
+	}
+	return resp
+}
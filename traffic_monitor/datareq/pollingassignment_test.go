@@ -0,0 +1,78 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+func TestCreatePollingAssignment(t *testing.T) {
+	assignment := threadsafe.PollingAssignmentData{
+		TMGroup: "tm-group-1",
+		CacheGroups: map[string][]string{
+			"tm-group-1": {"cache-group-1"},
+			"tm-group-2": {"cache-group-2"},
+			"tm-group-3": {"cache-group-3"},
+		},
+		Caches: map[tc.CacheName]string{
+			"cache1": "cache-group-1",
+			"cache2": "cache-group-2",
+			"cache3": "cache-group-3",
+			"cache4": "cache-group-3",
+			"cache5": "cache-group-4",
+		},
+	}
+	peerAvailable := func(peer tc.TrafficMonitorName) bool { return peer == "tm-group-2" }
+
+	resp := createPollingAssignment(assignment, true, peerAvailable)
+	if expected := []tc.CacheName{"cache1"}; !reflect.DeepEqual(expected, resp.PolledCaches) {
+		t.Errorf("expected polled caches %v, actual: %v", expected, resp.PolledCaches)
+	}
+	if expected := []tc.CacheName{"cache1", "cache2", "cache3", "cache4", "cache5"}; !reflect.DeepEqual(expected, resp.ExpectedCaches) {
+		t.Errorf("expected caches %v, actual: %v", expected, resp.ExpectedCaches)
+	}
+	// tm-group-3 isn't available, and cache-group-4 isn't assigned to any group.
+	if expected := []tc.CacheName{"cache3", "cache4", "cache5"}; !reflect.DeepEqual(expected, resp.CoverageGaps) {
+		t.Errorf("expected coverage gaps %v, actual: %v", expected, resp.CoverageGaps)
+	}
+	for group, live := range map[string]bool{"tm-group-1": true, "tm-group-2": true, "tm-group-3": false} {
+		if resp.Groups[group].Live != live {
+			t.Errorf("expected group %s live to be %t, actual: %t", group, live, resp.Groups[group].Live)
+		}
+	}
+
+	// without distributed polling, this Traffic Monitor polls every cache.
+	assignment = threadsafe.PollingAssignmentData{
+		TMGroup:     "tm-group-1",
+		CacheGroups: map[string][]string{"tm-group-1": {"cache-group-1", "cache-group-2"}},
+		Caches:      map[tc.CacheName]string{"cache1": "cache-group-1", "cache2": "cache-group-2"},
+	}
+	resp = createPollingAssignment(assignment, false, peerAvailable)
+	if expected := []tc.CacheName{"cache1", "cache2"}; !reflect.DeepEqual(expected, resp.PolledCaches) {
+		t.Errorf("expected polled caches %v without distributed polling, actual: %v", expected, resp.PolledCaches)
+	}
+	if len(resp.CoverageGaps) != 0 {
+		t.Errorf("expected no coverage gaps without distributed polling, actual: %v", resp.CoverageGaps)
+	}
+}
@@ -28,7 +28,9 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/lib/go-util"
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 
 	"github.com/json-iterator/go"
@@ -66,13 +68,21 @@ type Stats struct {
 	OldestPolledPeerMs          int64   `json:"Oldest Polled Peer Time (ms)"`
 	QueryInterval95thPercentile int64   `json:"Query Interval 95th Percentile (ms)"`
 	GCCPUFraction               float64 `json:"gc-cpu-fraction"`
+	StateCombineCount           uint64  `json:"State Combine Count,string"`
+	StateCombineCoalescedCount  uint64  `json:"State Combine Coalesced Count,string"`
+	PeerOptimisticQuorumMin     int     `json:"Peer Optimistic Quorum Min,string"`
+	EventWebhookDeliveredCount  uint64  `json:"Event Webhook Delivered Count,string"`
+	EventWebhookFailedCount     uint64  `json:"Event Webhook Failed Count,string"`
+	EventWebhookDroppedCount    uint64  `json:"Event Webhook Dropped Count,string"`
+	EventsDroppedCount          uint64  `json:"Events Dropped Count,string"`
+	PollResponseTooLargeCount   uint64  `json:"Poll Response Too Large Count,string"`
 }
 
-func srvStats(staticAppData config.StaticAppData, healthPollInterval time.Duration, lastHealthDurations threadsafe.DurationMap, fetchCount threadsafe.Uint, healthIteration threadsafe.Uint, errorCount threadsafe.Uint, peerStates peer.CRStatesPeersThreadsafe) ([]byte, error) {
-	return getStats(staticAppData, healthPollInterval, lastHealthDurations.Get(), fetchCount.Get(), healthIteration.Get(), errorCount.Get(), peerStates)
+func srvStats(staticAppData config.StaticAppData, healthPollInterval time.Duration, lastHealthDurations threadsafe.DurationMap, fetchCount threadsafe.Uint, healthIteration threadsafe.Uint, errorCount threadsafe.Uint, combineCount threadsafe.Uint, combineCoalescedCount threadsafe.Uint, peerStates peer.CRStatesPeersThreadsafe, events health.ThreadsafeEvents) ([]byte, error) {
+	return getStats(staticAppData, healthPollInterval, lastHealthDurations.Get(), fetchCount.Get(), healthIteration.Get(), errorCount.Get(), combineCount.Get(), combineCoalescedCount.Get(), peerStates, events.Webhook().Stats(), events.Dropped())
 }
 
-func getStats(staticAppData config.StaticAppData, pollingInterval time.Duration, lastHealthTimes map[tc.CacheName]time.Duration, fetchCount uint64, healthIteration uint64, errorCount uint64, peerStates peer.CRStatesPeersThreadsafe) ([]byte, error) {
+func getStats(staticAppData config.StaticAppData, pollingInterval time.Duration, lastHealthTimes map[tc.CacheName]time.Duration, fetchCount uint64, healthIteration uint64, errorCount uint64, combineCount uint64, combineCoalescedCount uint64, peerStates peer.CRStatesPeersThreadsafe, webhookStats health.EventWebhookStats, eventsDropped uint64) ([]byte, error) {
 	longestPollCache, longestPollTime := getLongestPoll(lastHealthTimes)
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
@@ -101,6 +111,14 @@ func getStats(staticAppData config.StaticAppData, pollingInterval time.Duration,
 	s.MemTotalBytes = memStats.TotalAlloc
 	s.MemSysBytes = memStats.Sys
 	s.GCCPUFraction = memStats.GCCPUFraction
+	s.StateCombineCount = combineCount
+	s.StateCombineCoalescedCount = combineCoalescedCount
+	s.PeerOptimisticQuorumMin = peerStates.GetQuorumMin()
+	s.EventWebhookDeliveredCount = webhookStats.Delivered
+	s.PollResponseTooLargeCount = poller.ResponseTooLargeCount()
+	s.EventWebhookFailedCount = webhookStats.Failed
+	s.EventWebhookDroppedCount = webhookStats.Dropped
+	s.EventsDroppedCount = eventsDropped
 
 	oldestPolledPeer, oldestPolledPeerTime := oldestPeerPollTime(peerStates.GetQueryTimes(), peerStates.GetPeersOnline())
 	s.OldestPolledPeer = string(oldestPolledPeer)
@@ -0,0 +1,61 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package datareq
+
+import (
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// UnpolledCache is the polling state of a single cache which has not yet been polled, or which is in its startup grace
+// period.
+type UnpolledCache struct {
+	StatUnpolled           bool  `json:"statUnpolled"`
+	HealthUnpolled         bool  `json:"healthUnpolled"`
+	GracePeriodRemainingMs int64 `json:"gracePeriodRemainingMs"`
+}
+
+// UnpolledCachesResponse is the response of the /publish/UnpolledCaches endpoint.
+type UnpolledCachesResponse struct {
+	Caches map[tc.CacheName]UnpolledCache `json:"caches"`
+}
+
+func srvUnpolledCaches(statUnpolledCaches threadsafe.UnpolledCaches, healthUnpolledCaches threadsafe.UnpolledCaches, gracePeriods threadsafe.CacheGracePeriods) ([]byte, error) {
+	resp := UnpolledCachesResponse{Caches: map[tc.CacheName]UnpolledCache{}}
+	for cacheName := range statUnpolledCaches.UnpolledCaches() {
+		c := resp.Caches[cacheName]
+		c.StatUnpolled = true
+		resp.Caches[cacheName] = c
+	}
+	for cacheName := range healthUnpolledCaches.UnpolledCaches() {
+		c := resp.Caches[cacheName]
+		c.HealthUnpolled = true
+		resp.Caches[cacheName] = c
+	}
+	for cacheName, remaining := range gracePeriods.Remaining() {
+		c := resp.Caches[cacheName]
+		c.GracePeriodRemainingMs = remaining.Milliseconds()
+		resp.Caches[cacheName] = c
+	}
+	json := jsoniter.ConfigFastest
+	return json.Marshal(resp)
+}
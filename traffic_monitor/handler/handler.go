@@ -38,18 +38,33 @@ type OpsConfig struct {
 	// The path to an SSL certificate to use with KeyFile to provide HTTP
 	// encryption for the TM API and web UI.
 	CertFile string `json:"certFile"`
+	// The names of Cache Groups whose cache servers are not polled, e.g.
+	// while they're being drained. Their cache servers are reported as not
+	// monitored instead of unavailable.
+	DisabledCacheGroups []string `json:"disabledCacheGroups"`
 	// The address on which to listen for HTTP requests.
 	HttpListener string `json:"httpListener"`
 	// The address on which to listen for HTTPS requests. If not set, TM serves
 	// its API and UI over HTTP. If this is set, the HTTP server is only used to
 	// redirect traffic to HTTPS.
 	HttpsListener string `json:"httpsListener"`
+	// The URL to which Traffic Monitor events (availability changes) are
+	// POSTed as they occur. If not set, events are not exported.
+	EventWebhookURL string `json:"eventWebhookUrl"`
+	// The maximum number of undelivered events to buffer while the
+	// EventWebhookURL can't be reached. If not set, a default is used.
+	EventWebhookBufferSize int `json:"eventWebhookBufferSize"`
 	// Controls whether to validate the HTTPS certificate prevented by the
 	// Traffic Ops server.
 	Insecure bool `json:"insecure"`
 	// The path to an SSL key to use with CertFile to provide HTTP encryption
 	// for the TM API and web UI.
 	KeyFile string `json:"keyFile"`
+	// The path to a directory containing a CDN Snapshot (crconfig.json) and
+	// monitoring config (monitoring.json) from which to run offline, instead
+	// of requesting them from Traffic Ops. Overridden by the -offlineSnapshot
+	// command line flag.
+	OfflineSnapshotDir string `json:"offlineSnapshotDir"`
 	// The password of the user identified by Username.
 	Password string `json:"password"`
 	// The URL at which Traffic Ops may be reached.
@@ -59,6 +74,9 @@ type OpsConfig struct {
 	// Only used in the TM UI to indicate if TM started up with on-disk backup
 	// Snapshots.
 	UsingDummyTO bool `json:"usingDummyTO"`
+	// Set at runtime when TM is running offline from OfflineSnapshotDir, and
+	// never talks to Traffic Ops.
+	UsingOfflineSnapshot bool `json:"usingOfflineSnapshot"`
 }
 
 type Handler interface {
@@ -278,6 +278,7 @@ func CalcAvailability(
 	localStates peer.CRStatesThreadsafe,
 	events ThreadsafeEvents,
 	protocol config.PollingProtocol,
+	gracePeriods threadsafe.CacheGracePeriods,
 ) {
 	localCacheStatuses := localCacheStatusThreadsafe.Get().Copy()
 	var statResultsVal *threadsafe.CacheStatHistory
@@ -300,8 +301,12 @@ func CalcAvailability(
 			Status:             serverInfo.ServerStatus,
 		}
 
+		// A cache in its startup grace period is evaluated as though it were
+		// available before this result, rather than down because it has no
+		// previous result.
+		inGracePeriod := gracePeriods.InGracePeriod(tc.CacheName(result.ID))
 		lastStatus, ok := localCacheStatuses[result.ID]
-		if ok {
+		if ok || inGracePeriod {
 			if result.UsingIPv4 {
 				availStatus.Available.IPv4 = true
 				availStatus.Available.IPv6 = serverInfo.IPv6() != "" && lastStatus.Available.IPv6
@@ -356,6 +361,20 @@ func CalcAvailability(
 			availStatus.UnavailableStat = aggUnavailableStat
 		}
 
+		if availStatus.ProcessedAvailable {
+			gracePeriods.Available(tc.CacheName(result.ID))
+		} else if inGracePeriod && result.Error != nil {
+			// the cache may not be ready to be polled yet; optimistically
+			// treat it as available until the grace period ends.
+			if result.UsingIPv4 {
+				availStatus.Available.IPv4 = true
+			} else {
+				availStatus.Available.IPv6 = true
+			}
+			availStatus.ProcessedAvailable = true
+			availStatus.Why = "in startup grace period: " + availStatus.Why
+		}
+
 		localStates.SetCache(tc.CacheName(result.ID), tc.IsAvailable{
 			IsAvailable:    availStatus.ProcessedAvailable,
 			Ipv4Available:  availStatus.Available.IPv4,
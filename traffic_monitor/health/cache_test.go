@@ -428,10 +428,10 @@ func TestCalcAvailabilityThresholds(t *testing.T) {
 	original := results[0].Statistics.Interfaces
 	statResultHistory := (*threadsafe.ResultStatHistory)(nil)
 	results[0].Statistics.Interfaces = make(map[string]cache.Interface)
-	CalcAvailability(results, pollerName, statResultHistory, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both)
+	CalcAvailability(results, pollerName, statResultHistory, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both, threadsafe.NewCacheGracePeriods(0))
 	results[0].Statistics.Interfaces = original
 
-	CalcAvailability(results, pollerName, statResultHistory, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both)
+	CalcAvailability(results, pollerName, statResultHistory, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both, threadsafe.NewCacheGracePeriods(0))
 
 	// ensure that the DisabledLocations is an empty, non-nil slice
 	for _, ds := range localStates.GetDeliveryServices() {
@@ -478,7 +478,7 @@ func TestCalcAvailabilityThresholds(t *testing.T) {
 	GetVitals(&healthResult, &result, nil)
 	healthPollerName := "health"
 	healthResults := []cache.Result{healthResult}
-	CalcAvailability(healthResults, healthPollerName, nil, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both)
+	CalcAvailability(healthResults, healthPollerName, nil, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both, threadsafe.NewCacheGracePeriods(0))
 
 	localCacheStatuses = localCacheStatusThreadsafe.Get()
 	if _, ok := localCacheStatuses[result.ID]; !ok {
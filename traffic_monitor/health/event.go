@@ -67,6 +67,9 @@ type ThreadsafeEvents struct {
 	m         *sync.RWMutex
 	nextIndex *uint64
 	max       uint64
+	webhook   EventWebhook
+	file      EventFile
+	dropped   *uint64 // number of events evicted from events because max was exceeded
 }
 
 func copyEvents(a []Event) []Event {
@@ -82,7 +85,8 @@ func NewThreadsafeEvents(maxEvents uint64) ThreadsafeEvents {
 	i := uint64(0)
 
 	// nextIndexにはiのメモリアドレスが設定されることになります。
-	return ThreadsafeEvents{m: &sync.RWMutex{}, events: &[]Event{}, nextIndex: &i, max: maxEvents}
+	dropped := uint64(0)
+	return ThreadsafeEvents{m: &sync.RWMutex{}, events: &[]Event{}, nextIndex: &i, max: maxEvents, webhook: NewEventWebhook(), file: NewEventFile(), dropped: &dropped}
 
 }
 
@@ -110,6 +114,7 @@ func (o *ThreadsafeEvents) Add(e Event) {
 	// 指定した最大イベント数を超過している場合には
 	if len(events) > int(o.max) {
 		// 以下の行はスライスの末尾から切り捨てられます。以下の例ではo.max(o.max -1 + 1)番目以降の要素は切り捨てられます。
+		*o.dropped += uint64(len(events)) - (o.max - 1)
 		events = (events)[:o.max-1]
 	}
 
@@ -121,4 +126,25 @@ func (o *ThreadsafeEvents) Add(e Event) {
 	*o.nextIndex++
 
 	o.m.Unlock()
+
+	o.webhook.Export(e)
+	o.file.Write(e)
+}
+
+// Dropped returns the number of events which were evicted because the maximum number of events was exceeded. Evicted
+// events are no longer returned by Get, but are still written to the File, if one is configured.
+func (o *ThreadsafeEvents) Dropped() uint64 {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	return *o.dropped
+}
+
+// File returns the file to which added events are appended.
+func (o *ThreadsafeEvents) File() EventFile {
+	return o.file
+}
+
+// Webhook returns the webhook to which added events are exported.
+func (o *ThreadsafeEvents) Webhook() EventWebhook {
+	return o.webhook
 }
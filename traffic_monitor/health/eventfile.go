@@ -0,0 +1,164 @@
+package health
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// EventFile appends events to a file as they're added, one JSON object per line, so they're kept after they're
+// evicted from the in-memory events. Once the file reaches its maximum size, it's rotated: it's renamed with the
+// suffix ".1", existing backups are renamed with the next suffix, and backups beyond the maximum are removed.
+// It is disabled until a path is set, and is safe for multiple goroutines.
+type EventFile struct {
+	path       *string
+	maxBytes   *uint64
+	maxBackups *int
+	file       **os.File
+	size       *uint64
+	m          *sync.Mutex
+}
+
+// NewEventFile returns a new, disabled EventFile.
+func NewEventFile() EventFile {
+	path := ""
+	maxBytes := uint64(0)
+	maxBackups := 0
+	size := uint64(0)
+	var file *os.File
+	return EventFile{
+		path:       &path,
+		maxBytes:   &maxBytes,
+		maxBackups: &maxBackups,
+		file:       &file,
+		size:       &size,
+		m:          &sync.Mutex{},
+	}
+}
+
+// Configure sets the path events are appended to, the size in bytes at which the file is rotated, and the number of
+// rotated files to keep. An empty path disables the file. A maxBytes of 0 never rotates the file.
+func (f EventFile) Configure(path string, maxBytes uint64, maxBackups int) error {
+	if maxBackups < 0 {
+		return errors.New("maximum backups must not be negative")
+	}
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.closeLocked()
+	*f.path = path
+	*f.maxBytes = maxBytes
+	*f.maxBackups = maxBackups
+	if path == "" {
+		return nil
+	}
+	return f.openLocked()
+}
+
+// openLocked opens the file for appending. Callers must hold the lock.
+func (f EventFile) openLocked() error {
+	file, err := os.OpenFile(*f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.New("opening event file '" + *f.path + "': " + err.Error())
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.New("getting size of event file '" + *f.path + "': " + err.Error())
+	}
+	*f.file = file
+	*f.size = uint64(fi.Size())
+	return nil
+}
+
+// closeLocked closes the file, if it's open. Callers must hold the lock.
+func (f EventFile) closeLocked() {
+	if *f.file == nil {
+		return
+	}
+	if err := (*f.file).Close(); err != nil {
+		log.Errorf("closing event file '%s': %v\n", *f.path, err)
+	}
+	*f.file = nil
+}
+
+// rotateLocked rotates the file, and opens a new, empty one. Callers must hold the lock.
+func (f EventFile) rotateLocked() error {
+	f.closeLocked()
+	backupPath := func(i int) string { return *f.path + "." + strconv.Itoa(i) }
+	if *f.maxBackups == 0 {
+		if err := os.Remove(*f.path); err != nil && !os.IsNotExist(err) {
+			return errors.New("removing event file '" + *f.path + "': " + err.Error())
+		}
+	} else {
+		if err := os.Remove(backupPath(*f.maxBackups)); err != nil && !os.IsNotExist(err) {
+			return errors.New("removing event file backup '" + backupPath(*f.maxBackups) + "': " + err.Error())
+		}
+		for i := *f.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(backupPath(i), backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+				return errors.New("renaming event file backup '" + backupPath(i) + "': " + err.Error())
+			}
+		}
+		if err := os.Rename(*f.path, backupPath(1)); err != nil {
+			return errors.New("renaming event file '" + *f.path + "': " + err.Error())
+		}
+	}
+	return f.openLocked()
+}
+
+// Write appends the given event to the file, rotating it first if it would exceed its maximum size. It does nothing
+// if no path is set. Errors are logged, rather than returned, so a failing file never blocks events.
+func (f EventFile) Write(e Event) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if *f.path == "" {
+		return
+	}
+	line, err := jsoniter.ConfigFastest.Marshal(e)
+	if err != nil {
+		log.Errorf("marshalling event for event file '%s': %v\n", *f.path, err)
+		return
+	}
+	line = append(line, '\n')
+
+	if *f.file != nil && *f.maxBytes > 0 && *f.size > 0 && *f.size+uint64(len(line)) > *f.maxBytes {
+		if err := f.rotateLocked(); err != nil {
+			log.Errorf("rotating event file: %v\n", err)
+		}
+	}
+	if *f.file == nil {
+		// a previous open failed, e.g. because the directory didn't exist yet; retry, so events aren't lost for good
+		if err := f.openLocked(); err != nil {
+			log.Errorf("writing event: %v\n", err)
+			return
+		}
+	}
+	n, err := (*f.file).Write(line)
+	*f.size += uint64(n)
+	if err != nil {
+		log.Errorf("writing event to event file '%s': %v\n", *f.path, err)
+	}
+}
@@ -0,0 +1,113 @@
+package health
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/json-iterator/go"
+)
+
+// readEventFile returns the names of the events in the given event file.
+func readEventFile(t *testing.T, path string) []string {
+	t.Helper()
+	fl, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening event file '%s': %v", path, err)
+	}
+	defer fl.Close()
+	names := []string{}
+	scanner := bufio.NewScanner(fl)
+	for scanner.Scan() {
+		e := Event{}
+		if err := jsoniter.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("decoding event '%s': %v", scanner.Text(), err)
+		}
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestThreadsafeEventsDropped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	events := NewThreadsafeEvents(5)
+	if err := events.File().Configure(path, 0, 0); err != nil {
+		t.Fatalf("configuring event file: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		events.Add(Event{Name: strconv.Itoa(i)})
+	}
+	kept := uint64(len(events.Get()))
+	if dropped := events.Dropped(); dropped != 20-kept {
+		t.Errorf("expected %d dropped events, actual: %d", 20-kept, dropped)
+	}
+	if names := readEventFile(t, path); len(names) != 20 || names[0] != "0" || names[19] != "19" {
+		t.Errorf("expected every event to be written to the event file, actual: %v", names)
+	}
+}
+
+func TestEventFileRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	line, err := jsoniter.ConfigFastest.Marshal(Event{Name: "0"})
+	if err != nil {
+		t.Fatalf("marshalling event: %v", err)
+	}
+
+	f := NewEventFile()
+	if err := f.Configure(path, uint64(len(line)+1)*2, 2); err != nil { // two events per file
+		t.Fatalf("configuring event file: %v", err)
+	}
+	for i := 0; i < 8; i++ {
+		f.Write(Event{Name: strconv.Itoa(i)})
+	}
+
+	expected := map[string][]string{
+		path:        {"6", "7"},
+		path + ".1": {"4", "5"},
+		path + ".2": {"2", "3"},
+	}
+	for name, expectedNames := range expected {
+		names := readEventFile(t, name)
+		if len(names) != len(expectedNames) || names[0] != expectedNames[0] || names[1] != expectedNames[1] {
+			t.Errorf("expected '%s' to have events %v, actual: %v", name, expectedNames, names)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no more than 2 backups, actual: %v", err)
+	}
+
+	// reconfiguring appends to the existing file.
+	if err := f.Configure(path, 0, 2); err != nil {
+		t.Fatalf("reconfiguring event file: %v", err)
+	}
+	f.Write(Event{Name: "8"})
+	if names := readEventFile(t, path); len(names) != 3 || names[2] != "8" {
+		t.Errorf("expected the event to be appended, actual: %v", names)
+	}
+
+	if err := f.Configure(path, 0, -1); err == nil {
+		t.Error("expected an error configuring negative backups")
+	}
+}
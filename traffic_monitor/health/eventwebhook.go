@@ -0,0 +1,250 @@
+package health
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// DefaultEventWebhookBufferSize is the maximum number of undelivered events buffered by an EventWebhook, if no buffer
+// size is configured.
+const DefaultEventWebhookBufferSize = 1000
+
+const (
+	eventWebhookTimeout       = 10 * time.Second
+	eventWebhookMinRetryDelay = time.Second
+	eventWebhookMaxRetryDelay = time.Minute
+)
+
+// EventWebhookPayload is the JSON body POSTed to the event webhook URL for each event.
+type EventWebhookPayload struct {
+	Name          string    `json:"name"`
+	Type          string    `json:"type"`
+	OldStatus     string    `json:"oldStatus"`
+	NewStatus     string    `json:"newStatus"`
+	Reason        string    `json:"reason"`
+	Timestamp     time.Time `json:"timestamp"`
+	IPv4Available bool      `json:"ipv4Available"`
+	IPv6Available bool      `json:"ipv6Available"`
+}
+
+func availabilityStatus(available bool) string {
+	if available {
+		return "available"
+	}
+	return "unavailable"
+}
+
+// NewEventWebhookPayload returns the webhook payload of the given event. Events are only created when availability
+// changes, so the old status is always the opposite of the new one.
+func NewEventWebhookPayload(e Event) EventWebhookPayload {
+	return EventWebhookPayload{
+		Name:          e.Name,
+		Type:          e.Type,
+		OldStatus:     availabilityStatus(!e.Available),
+		NewStatus:     availabilityStatus(e.Available),
+		Reason:        e.Description,
+		Timestamp:     time.Time(e.Time),
+		IPv4Available: e.IPv4Available,
+		IPv6Available: e.IPv6Available,
+	}
+}
+
+// EventWebhookStats are the delivery counts of an EventWebhook.
+type EventWebhookStats struct {
+	// Delivered is the number of events successfully delivered.
+	Delivered uint64
+	// Failed is the number of failed delivery attempts. Failed deliveries are retried, so this may be larger than the
+	// number of events.
+	Failed uint64
+	// Dropped is the number of events dropped without being delivered, because the buffer was full.
+	Dropped uint64
+}
+
+// EventWebhook POSTs events to a configured URL as they're added, retrying with exponential backoff while the URL
+// can't be reached. Undelivered events are buffered; once the buffer is full, the oldest events are dropped.
+// It is disabled until a URL is set, and is safe for multiple goroutines.
+type EventWebhook struct {
+	url        *string
+	bufferSize *int
+	buffer     *[]Event
+	m          *sync.Mutex
+	added      chan struct{}
+	start      *sync.Once
+	client     *http.Client
+	delivered  *uint64
+	failed     *uint64
+	dropped    *uint64
+}
+
+// NewEventWebhook returns a new, disabled EventWebhook.
+func NewEventWebhook() EventWebhook {
+	url := ""
+	bufferSize := DefaultEventWebhookBufferSize
+	delivered, failed, dropped := uint64(0), uint64(0), uint64(0)
+	return EventWebhook{
+		url:        &url,
+		bufferSize: &bufferSize,
+		buffer:     &[]Event{},
+		m:          &sync.Mutex{},
+		added:      make(chan struct{}, 1),
+		start:      &sync.Once{},
+		client:     &http.Client{Timeout: eventWebhookTimeout},
+		delivered:  &delivered,
+		failed:     &failed,
+		dropped:    &dropped,
+	}
+}
+
+// Configure sets the URL events are POSTed to, and the maximum number of undelivered events to buffer. An empty URL
+// disables the webhook, discarding any buffered events; a bufferSize less than 1 uses DefaultEventWebhookBufferSize.
+func (w EventWebhook) Configure(url string, bufferSize int) {
+	if bufferSize < 1 {
+		bufferSize = DefaultEventWebhookBufferSize
+	}
+	w.m.Lock()
+	if *w.url != url {
+		log.Infof("event webhook URL changed from '%s' to '%s'\n", *w.url, url)
+	}
+	*w.url = url
+	*w.bufferSize = bufferSize
+	if url == "" {
+		*w.buffer = []Event{}
+	} else if len(*w.buffer) > bufferSize {
+		w.dropLocked(len(*w.buffer) - bufferSize)
+	}
+	w.m.Unlock()
+	if url != "" {
+		w.start.Do(func() { go w.deliver() })
+	}
+}
+
+// dropLocked drops the oldest n buffered events. Callers must hold the lock.
+func (w EventWebhook) dropLocked(n int) {
+	*w.buffer = (*w.buffer)[n:]
+	atomic.AddUint64(w.dropped, uint64(n))
+	log.Warnf("event webhook buffer full, dropped %d undelivered events\n", n)
+}
+
+// Export buffers the given event to be delivered. It never blocks on delivery, and does nothing if no URL is set.
+func (w EventWebhook) Export(e Event) {
+	w.m.Lock()
+	if *w.url == "" {
+		w.m.Unlock()
+		return
+	}
+	*w.buffer = append(*w.buffer, e)
+	if len(*w.buffer) > *w.bufferSize {
+		w.dropLocked(len(*w.buffer) - *w.bufferSize)
+	}
+	w.m.Unlock()
+
+	select {
+	case w.added <- struct{}{}:
+	default:
+	}
+}
+
+// Stats returns the delivery counts of the webhook.
+func (w EventWebhook) Stats() EventWebhookStats {
+	return EventWebhookStats{
+		Delivered: atomic.LoadUint64(w.delivered),
+		Failed:    atomic.LoadUint64(w.failed),
+		Dropped:   atomic.LoadUint64(w.dropped),
+	}
+}
+
+// next returns the oldest buffered event and the URL to deliver it to, or false if there's nothing to deliver.
+func (w EventWebhook) next() (Event, string, bool) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if *w.url == "" || len(*w.buffer) == 0 {
+		return Event{}, "", false
+	}
+	return (*w.buffer)[0], *w.url, true
+}
+
+// setDelivered counts the given event as delivered, and removes it from the buffer, unless it was already dropped while being delivered.
+func (w EventWebhook) setDelivered(e Event) {
+	atomic.AddUint64(w.delivered, 1)
+	w.m.Lock()
+	defer w.m.Unlock()
+	if len(*w.buffer) != 0 && (*w.buffer)[0].Index == e.Index {
+		*w.buffer = (*w.buffer)[1:]
+	}
+}
+
+// deliver delivers buffered events in order, forever.
+func (w EventWebhook) deliver() {
+	backoff, err := util.NewBackoff(eventWebhookMinRetryDelay, eventWebhookMaxRetryDelay, util.DefaultFactor)
+	if err != nil {
+		log.Errorf("creating event webhook backoff, using constant backoff: %v\n", err)
+		backoff = util.NewConstantBackoff(eventWebhookMinRetryDelay)
+	}
+	for range w.added {
+		for {
+			e, url, ok := w.next()
+			if !ok {
+				break
+			}
+			if err := w.post(url, e); err != nil {
+				atomic.AddUint64(w.failed, 1)
+				retry := backoff.BackoffDuration()
+				log.Errorf("delivering event for '%s' to webhook '%s', retrying in %v: %v\n", e.Name, url, retry, err)
+				time.Sleep(retry)
+				continue
+			}
+			backoff.Reset()
+			w.setDelivered(e)
+		}
+	}
+}
+
+// post POSTs the given event to the given URL, returning an error if it wasn't accepted.
+func (w EventWebhook) post(url string, e Event) error {
+	json := jsoniter.ConfigFastest
+	body, err := json.Marshal(NewEventWebhookPayload(e))
+	if err != nil {
+		return fmt.Errorf("marshalling event: %v", err)
+	}
+	resp, err := w.client.Post(url, rfc.ApplicationJSON, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body) // drain the body, so the connection can be reused
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
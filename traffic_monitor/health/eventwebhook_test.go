@@ -0,0 +1,134 @@
+package health
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/json-iterator/go"
+)
+
+// waitForWebhookStats waits for the webhook's stats to satisfy the given condition, failing the test if they don't
+// within a reasonable time.
+func waitForWebhookStats(t *testing.T, w EventWebhook, cond func(EventWebhookStats) bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond(w.Stats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for event webhook stats, actual: %+v", w.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEventWebhookDelivers(t *testing.T) {
+	payloads := make(chan EventWebhookPayload, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := EventWebhookPayload{}
+		if err := jsoniter.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decoding webhook payload: %v", err)
+		}
+		payloads <- payload
+	}))
+	defer srv.Close()
+
+	events := NewThreadsafeEvents(10)
+	events.Add(Event{Name: "not-exported", Available: true})
+
+	events.Webhook().Configure(srv.URL, 0)
+	now := time.Now().Truncate(time.Second)
+	events.Add(Event{Time: Time(now), Name: "cache0", Type: "EDGE", Available: false, Description: "REPORTED - timed out", IPv4Available: false, IPv6Available: true})
+	events.Add(Event{Time: Time(now), Name: "cache1", Type: "MID", Available: true, Description: "REPORTED - available", IPv4Available: true, IPv6Available: true})
+
+	waitForWebhookStats(t, events.Webhook(), func(s EventWebhookStats) bool { return s.Delivered == 2 })
+
+	first := <-payloads
+	if first.Name != "cache0" || first.Type != "EDGE" || first.OldStatus != "available" || first.NewStatus != "unavailable" || first.Reason != "REPORTED - timed out" || !first.Timestamp.Equal(now) || first.IPv4Available || !first.IPv6Available {
+		t.Errorf("expected first payload for cache0 becoming unavailable, actual: %+v", first)
+	}
+	second := <-payloads
+	if second.Name != "cache1" || second.OldStatus != "unavailable" || second.NewStatus != "available" {
+		t.Errorf("expected second payload for cache1 becoming available, actual: %+v", second)
+	}
+	if len(payloads) != 0 {
+		t.Errorf("expected only events added after configuring to be exported, actual: %d extra", len(payloads))
+	}
+	if stats := events.Webhook().Stats(); stats.Failed != 0 || stats.Dropped != 0 {
+		t.Errorf("expected no failed or dropped events, actual: %+v", stats)
+	}
+}
+
+func TestEventWebhookRetries(t *testing.T) {
+	requests := 0
+	m := sync.Mutex{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	webhook := NewEventWebhook()
+	webhook.Configure(srv.URL, 0)
+	webhook.Export(Event{Index: 0, Name: "cache0"})
+
+	waitForWebhookStats(t, webhook, func(s EventWebhookStats) bool { return s.Delivered == 1 })
+	if stats := webhook.Stats(); stats.Failed != 1 || stats.Dropped != 0 {
+		t.Errorf("expected 1 failed attempt and no dropped events, actual: %+v", stats)
+	}
+}
+
+func TestEventWebhookBufferFull(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	webhook := NewEventWebhook()
+	webhook.Configure(srv.URL, 2)
+	for i := 0; i < 5; i++ {
+		webhook.Export(Event{Index: uint64(i), Name: "cache0"})
+	}
+	if dropped := webhook.Stats().Dropped; dropped != 3 {
+		t.Errorf("expected 3 dropped events with a buffer of 2, actual: %d", dropped)
+	}
+	close(release)
+
+	waitForWebhookStats(t, webhook, func(EventWebhookStats) bool {
+		_, _, ok := webhook.next()
+		return !ok
+	})
+}
+
+func TestEventWebhookDisabled(t *testing.T) {
+	webhook := NewEventWebhook()
+	webhook.Export(Event{Name: "cache0"})
+	if _, _, ok := webhook.next(); ok {
+		t.Error("expected no events to be buffered with no webhook URL")
+	}
+}
@@ -46,6 +46,7 @@ func StartHealthResultManager(
 	cfg config.Config,
 	events health.ThreadsafeEvents,
 	localCacheStatus threadsafe.CacheAvailableStatus,
+	gracePeriods threadsafe.CacheGracePeriods,
 	cachesChanged <-chan struct{},
 	combineStates func(),
 ) (threadsafe.DurationMap, threadsafe.ResultHistory, threadsafe.UnpolledCaches) {
@@ -66,6 +67,7 @@ func StartHealthResultManager(
 		fetchCount,
 		events,
 		localCacheStatus,
+		gracePeriods,
 		cfg,
 		healthUnpolledCaches,
 		cachesChanged,
@@ -85,6 +87,7 @@ func healthResultManagerListen(
 	fetchCount threadsafe.Uint,
 	events health.ThreadsafeEvents,
 	localCacheStatus threadsafe.CacheAvailableStatus,
+	gracePeriods threadsafe.CacheGracePeriods,
 	cfg config.Config,
 	healthUnpolledCaches threadsafe.UnpolledCaches,
 	cachesChanged <-chan struct{},
@@ -121,6 +124,7 @@ func healthResultManagerListen(
 			fetchCount,
 			events,
 			localCacheStatus,
+			gracePeriods,
 			lastHealthEndTimes,
 			healthHistory,
 			results,
@@ -174,6 +178,7 @@ func processHealthResult(
 	fetchCount threadsafe.Uint,
 	events health.ThreadsafeEvents,
 	localCacheStatusThreadsafe threadsafe.CacheAvailableStatus,
+	gracePeriods threadsafe.CacheGracePeriods,
 	lastHealthEndTimes map[tc.CacheName]time.Time,
 	healthHistory threadsafe.ResultHistory,
 	results []cache.Result,
@@ -231,7 +236,7 @@ func processHealthResult(
 
 	pollerName := "health"
 	statResultHistoryNil := (*threadsafe.ResultStatHistory)(nil) // health poller doesn't have stats
-	health.CalcAvailability(results, pollerName, statResultHistoryNil, monitorConfigCopy, toDataCopy, localCacheStatusThreadsafe, localStates, events, cfg.CachePollingProtocol)
+	health.CalcAvailability(results, pollerName, statResultHistoryNil, monitorConfigCopy, toDataCopy, localCacheStatusThreadsafe, localStates, events, cfg.CachePollingProtocol, gracePeriods)
 	combineStates()
 
 	healthHistory.Set(healthHistoryCopy)
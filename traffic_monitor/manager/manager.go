@@ -43,14 +43,17 @@ import (
 //
 // Start starts the poller and handler goroutines
 //
-func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData, trafficMonitorConfigFileName string) error {
+func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData, trafficMonitorConfigFileName string, offlineSnapshotDir string) error {
 
 	toSession := towrap.NewTrafficOpsSessionThreadsafe(nil, nil, cfg.CRConfigHistoryCount, cfg)
+	cache.SetPrometheusMetricNames(cfg.PrometheusMetricNames)
 
 	localStates := peer.NewCRStatesThreadsafe() // this is the local state as discoverer by this traffic_monitor
 	fetchCount := threadsafe.NewUint()          // note this is the number of individual caches fetched from, not the number of times all the caches were polled.
 	healthIteration := threadsafe.NewUint()
 	errorCount := threadsafe.NewUint()
+	combineCount := threadsafe.NewUint()
+	combineCoalescedCount := threadsafe.NewUint()
 
 	toData := todata.NewThreadsafe()
 
@@ -65,6 +68,13 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 	distributedPeerHandler := peer.NewHandler()
 	distributedPeerPoller := poller.NewPeer(distributedPeerHandler, cfg, appData)
 
+	// newly-added caches are optimistically available until their first
+	// successful poll, or until the startup grace period expires.
+	cacheGracePeriods := threadsafe.NewCacheGracePeriods(cfg.CacheStartupGracePeriod)
+	cacheHealthPoller.PollAdded = cacheGracePeriods.PollAdded
+	cacheStatPoller.PollAdded = cacheGracePeriods.PollAdded
+	pollingAssignment := threadsafe.NewPollingAssignment()
+
 	// poller/monitorconfig.goのPoll()が呼ばれる
 	go monitorConfigPoller.Poll()
 
@@ -88,6 +98,9 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 
 	// 設定値`max_events`の値を指定する
 	events := health.NewThreadsafeEvents(cfg.MaxEvents)
+	if err := events.File().Configure(cfg.EventLogFile, cfg.EventLogFileMaxBytes, cfg.EventLogFileMaxBackups); err != nil {
+		log.Errorf("configuring event log file: %v\n", err)
+	}
 
 	// 「chan struct{}」は空のチャネルの定義です
 	var cachesChangedForStatMgr chan struct{}
@@ -106,8 +119,13 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 	}
 
 	peerStates := peer.NewCRStatesPeersThreadsafe(cfg.PeerOptimisticQuorumMin) // each peer's last state is saved in this map
+	peerStates.SetMaxAge(cfg.PeerStateMaxAge)
 	distributedPeerStates := peer.NewCRStatesPeersThreadsafe(0)
 
+	// restore the last known states, if configured, so a quick restart resumes from them while the caches are re-polled
+	restoredStateTime := threadsafe.NewTime()
+	restoredStateTime.Set(RestoreStateBackup(cfg, localStates, peerStates))
+
 	monitorConfig := StartMonitorConfigManager(
 		monitorConfigPoller.ConfigChannel,
 		localStates,
@@ -119,6 +137,8 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		distributedPeerPoller.ConfigChannel,
 		monitorConfigPoller.IntervalChan,
 		cachesChanged,
+		cacheGracePeriods,
+		pollingAssignment,
 		cfg,
 		appData,
 		toSession,
@@ -127,7 +147,12 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 
 	// 複数台のTrafficMonitorの統合を行なう関数です。
 	// 特定のチャネルを受信したら、起動したgoroutineの中でステータスのマージ処理が行われるようになっています。
-	combinedStates, combineStateFunc := StartStateCombiner(events, peerStates, localStates, toData)
+	combinedStates, combineStateFunc := StartStateCombiner(events, peerStates, localStates, toData, combineCount, combineCoalescedCount)
+
+	if !restoredStateTime.Get().IsZero() {
+		combineStateFunc()
+	}
+	StartStateBackupManager(cfg, localStates, peerStates)
 
 	StartPeerManager(
 		peerHandler.ResultChannel,
@@ -145,6 +170,7 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		cfg,
 		monitorConfig,
 		events,
+		cacheGracePeriods,
 		combineStateFunc,
 	)
 
@@ -157,6 +183,7 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		cfg,
 		events,
 		localCacheStatus,
+		cacheGracePeriods,
 		cachesChangedForHealthMgr,
 		combineStateFunc,
 	)
@@ -173,10 +200,11 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 	// [] は、Go言語におけるスライス（slice）型を表します。したがって、[]chan<- testChannel は、testChannel型の値を送信することができるチャネル型のスライスを表します。
 	if _, err := StartOpsConfigManager(
 		opsConfigFile,
+		offlineSnapshotDir,
 		toSession,
 		toData,
-		[]chan<- handler.OpsConfig{monitorConfigPoller.OpsConfigChannel},                // handler.OpsConfig型のmonitorConfigPoller.OpsConfigChannelチャネルの受信を表す
-		[]chan<- towrap.TrafficOpsSessionThreadsafe{monitorConfigPoller.SessionChannel}, // towrap.TrafficOpsSessionThreadsafe型のmonitorConfigPoller.SessionChannelチャネルの受信を表す
+		[]chan handler.OpsConfig{monitorConfigPoller.OpsConfigChannel},                // handler.OpsConfig型のmonitorConfigPoller.OpsConfigChannelチャネルの受信を表す
+		[]chan towrap.TrafficOpsSessionThreadsafe{monitorConfigPoller.SessionChannel}, // towrap.TrafficOpsSessionThreadsafe型のmonitorConfigPoller.SessionChannelチャネルの受信を表す
 		localStates,
 		peerStates,
 		distributedPeerStates,
@@ -194,9 +222,14 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		fetchCount,
 		healthIteration,
 		errorCount,
+		combineCount,
+		combineCoalescedCount,
 		localCacheStatus,
 		statUnpolledCaches,
 		healthUnpolledCaches,
+		cacheGracePeriods,
+		pollingAssignment,
+		restoredStateTime,
 		monitorConfig,
 		cfg,
 	); err != nil {
@@ -244,6 +277,7 @@ func startMonitorConfigFilePoller(filename string) error {
 			log.Errorf("monitor config file poll, getting log writers '%v': %v", filename, err)
 			return
 		}
+		cache.SetPrometheusMetricNames(cfg.PrometheusMetricNames)
 	}
 
 	// 指定されたファイルの内容をbytesに保存する
@@ -121,6 +121,43 @@ func getIntervals(monitorConfig tc.TrafficMonitorConfigMap, cfg config.Config, l
 	return intervals, nil
 }
 
+// getServerIntervals returns the health and stat poll intervals of the given server which override the intervals of
+// the health and stat pollers, or zero for either which isn't overridden. The heartbeat.polling.interval and
+// stat.polling.interval Parameters of the server's Profile take precedence over the heartbeat.polling.interval.<cachegroup>
+// and stat.polling.interval.<cachegroup> monitoring config Parameters of the server's Cache Group.
+func getServerIntervals(monitorConfig tc.TrafficMonitorConfigMap, srv tc.TrafficServer) (time.Duration, time.Duration) {
+	getCacheGroupInterval := func(param string) int {
+		param += "." + srv.CacheGroup
+		intervalI, intervalExists := monitorConfig.Config[param]
+		if !intervalExists {
+			return 0
+		}
+		interval, intervalIsInt := intervalI.(float64)
+		if !intervalIsInt {
+			log.Warnf("Traffic Ops Monitor config '%s' value '%v' type %T is not an integer, ignoring\n", param, intervalI, intervalI)
+			return 0
+		}
+		return int(interval)
+	}
+	toDuration := func(ms int) time.Duration {
+		if ms <= 0 {
+			return 0
+		}
+		return time.Duration(float64(time.Duration(ms)*time.Millisecond) * PollIntervalRatio)
+	}
+
+	params := monitorConfig.Profile[srv.Profile].Parameters
+	health := params.HeartbeatPollingInterval
+	if health <= 0 {
+		health = getCacheGroupInterval("heartbeat.polling.interval")
+	}
+	stat := params.StatPollingInterval
+	if stat <= 0 {
+		stat = getCacheGroupInterval("stat.polling.interval")
+	}
+	return toDuration(health), toDuration(stat)
+}
+
 // StartMonitorConfigManager runs the monitor config manager goroutine, and returns the threadsafe data which it sets.
 func StartMonitorConfigManager(
 	monitorConfigPollChan <-chan poller.MonitorCfg,  // monitorConfigPoller.ConfigChannelが渡ってきてる
@@ -133,6 +170,8 @@ func StartMonitorConfigManager(
 	distributedPeerURLSubscriber chan<- poller.PeerPollerConfig,
 	toIntervalSubscriber chan<- time.Duration,
 	cachesChangeSubscriber chan<- struct{},
+	gracePeriods threadsafe.CacheGracePeriods,
+	pollingAssignment threadsafe.PollingAssignment,
 	cfg config.Config,
 	staticAppData config.StaticAppData,
 	toSession towrap.TrafficOpsSessionThreadsafe,
@@ -153,6 +192,8 @@ func StartMonitorConfigManager(
 		distributedPeerURLSubscriber,
 		toIntervalSubscriber,
 		cachesChangeSubscriber,
+		gracePeriods,
+		pollingAssignment,
 		cfg,
 		staticAppData,
 		toSession,
@@ -193,6 +234,10 @@ func trafficOpsTOPollIntervalToDuration(t int) time.Duration {
 	return time.Duration(t) * time.Millisecond
 }
 
+// DisabledCacheGroupStatus is the status of caches in a disabled Cache Group,
+// which are not polled, and are reported available because they're not monitored.
+const DisabledCacheGroupStatus = "not monitored; cachegroup polling disabled"
+
 // PollIntervalRatio is the ratio of the configuration interval to poll. The configured intervals are 'target' times, so we actually poll at some small fraction less, in attempt to make the actual poll marginally less than the target.
 const PollIntervalRatio = float64(0.97) // TODO make config?
 
@@ -210,6 +255,8 @@ func monitorConfigListen(
 	distributedPeerURLSubscriber chan<- poller.PeerPollerConfig,
 	toIntervalSubscriber chan<- time.Duration,
 	cachesChangeSubscriber chan<- struct{},
+	gracePeriods threadsafe.CacheGracePeriods,
+	pollingAssignment threadsafe.PollingAssignment,
 	cfg config.Config,
 	staticAppData config.StaticAppData,
 	toSession towrap.TrafficOpsSessionThreadsafe,
@@ -230,6 +277,7 @@ func monitorConfigListen(
 
 		monitorConfig := pollerMonitorCfg.Cfg
 		cdn := pollerMonitorCfg.CDN
+		disabledCacheGroups := pollerMonitorCfg.DisabledCacheGroups
 		monitorConfigTS.Set(monitorConfig)
 
 		// todata/todata.go: Update()から呼ばれる
@@ -249,11 +297,11 @@ func monitorConfigListen(
 			continue
 		}
 
-		thisTMGroup, thisTMStatus, cacheGroupsToPoll, err := getCacheGroupsToPoll(
+		thisTMGroup, thisTMStatus, cacheGroupAssignments, err := getCacheGroupAssignments(
 			cfg.DistributedPolling,
 			staticAppData.Hostname,
 			monitorConfig.TrafficMonitor,
-			monitorConfig.TrafficServer,
+			withoutCacheGroups(monitorConfig.TrafficServer, disabledCacheGroups),
 			monitorConfig.CacheGroup,
 		)
 
@@ -261,8 +309,13 @@ func monitorConfigListen(
 			log.Errorf("getting cachegroups to poll: %s", err.Error())
 			continue
 		}
+		cacheGroupsToPoll := cacheGroupAssignments[thisTMGroup]
+		expectedCaches := map[tc.CacheName]string{}
 
 		log.Debugf("this TM's cachegroup: %s, cachegroups to poll: %v", thisTMGroup, cacheGroupsToPoll)
+		if len(disabledCacheGroups) > 0 {
+			log.Infof("not polling disabled cachegroups: %v", disabledCacheGroups)
+		}
 
 		// TrafficServerでイテレーション
 		for _, srv := range monitorConfig.TrafficServer {
@@ -281,11 +334,21 @@ func monitorConfigListen(
 				continue
 			}
 
+			// ポーリングが無効化されたキャッシュグループのキャッシュはポーリングせず、ダウンではなく監視対象外として扱う
+			if _, disabled := disabledCacheGroups[srv.CacheGroup]; disabled {
+				available := srvStatus != tc.CacheStatusAdminDown
+				localStates.AddCache(cacheName, tc.IsAvailable{IsAvailable: available, Ipv6Available: available && srv.IPv6() != "", Ipv4Available: available && srv.IPv4() != "", DirectlyPolled: false, Status: DisabledCacheGroupStatus})
+				continue
+			}
+
+			expectedCaches[cacheName] = srv.CacheGroup
+
 			// 対応する値が存在すればisDirectlyPolled=true、対応する値が存在しなければisDirectlyPolled=falseとなる
 			_, isDirectlyPolled := cacheGroupsToPoll[srv.CacheGroup]
 
 			// seed states with available = false until our polling cycle picks up a result
-			if _, exists := localStates.GetCache(cacheName); !exists {
+			// (including caches whose cachegroup was just re-enabled)
+			if state, exists := localStates.GetCache(cacheName); !exists || state.Status == DisabledCacheGroupStatus {
 				localStates.AddCache(cacheName, tc.IsAvailable{IsAvailable: false, DirectlyPolled: isDirectlyPolled})
 			}
 
@@ -324,15 +387,30 @@ func monitorConfigListen(
 				log.Warnln("profile " + srv.Profile + " health.connection.timeout Parameter is missing or zero, using default " + DefaultHealthConnectionTimeout.String())
 			}
 
+			socketPath := ""
+			if pollType == poller.PollerTypeUnix {
+				socketPath, _, err = poller.ParseUnixPollURL(pollURLStr)
+				if err != nil {
+					log.Errorf("monitor config server %v profile %v has an invalid unix polling URL '%v'; can't poll: %v", srv.HostName, srv.Profile, pollURLStr, err)
+					continue
+				}
+			}
+
+			healthInterval, statInterval := getServerIntervals(monitorConfig, srv)
+
 			// ホスト毎のヘルスチェックURLがセットされる。この関数の最後に別チャネルに送信する
-			healthURLs[srv.HostName] = poller.PollConfig{URL: pollURL4Str, URLv6: pollURL6Str, Host: srv.FQDN, Timeout: connTimeout, Format: format, PollType: pollType}
+			maxResponseBytes := monitorConfig.Profile[srv.Profile].Parameters.HealthPollingMaxResponseBytes
+			maxRedirects := monitorConfig.Profile[srv.Profile].Parameters.HealthPollingMaxRedirects
+			redirectHosts := monitorConfig.Profile[srv.Profile].Parameters.HealthPollingRedirectHosts
+
+			healthURLs[srv.HostName] = poller.PollConfig{URL: pollURL4Str, URLv6: pollURL6Str, Host: srv.FQDN, Timeout: connTimeout, Format: format, PollType: pollType, SocketPath: socketPath, Interval: healthInterval, MaxResponseBytes: maxResponseBytes, MaxRedirects: maxRedirects, RedirectHosts: redirectHosts}
 
 			// TrafficServerへの統計情報取得用のURL(IPv4, IPv6)を生成する
 			statURL4 := createServerStatPollURL(pollURL4Str)
 			statURL6 := createServerStatPollURL(pollURL6Str)
 
 			// ホスト毎の統計情報取得URLがセットされる。この関数の最後に別チャネルに送信する
-			statURLs[srv.HostName] = poller.PollConfig{URL: statURL4, URLv6: statURL6, Host: srv.FQDN, Timeout: connTimeout, Format: format, PollType: pollType}
+			statURLs[srv.HostName] = poller.PollConfig{URL: statURL4, URLv6: statURL6, Host: srv.FQDN, Timeout: connTimeout, Format: format, PollType: pollType, SocketPath: socketPath, Interval: statInterval, MaxResponseBytes: maxResponseBytes, MaxRedirects: maxRedirects, RedirectHosts: redirectHosts}
 		}
 
 		peerSet := map[tc.TrafficMonitorName]struct{}{}
@@ -385,11 +463,19 @@ func monitorConfigListen(
 
 		// 統計情報をPollingするために必要な情報をチャネルに送信している (補足) diffConfigしているのはこの情報
 		if cfg.StatPolling {
-			statURLSubscriber <- poller.CachePollerConfig{Urls: statURLs, PollingProtocol: cfg.CachePollingProtocol, Interval: intervals.Stat, NoKeepAlive: intervals.StatNoKeepAlive}
+			statURLSubscriber <- poller.CachePollerConfig{Urls: statURLs, PollingProtocol: cfg.CachePollingProtocol, IPv4Weight: cfg.CachePollingIPv4Weight, IPv6Weight: cfg.CachePollingIPv6Weight, Interval: intervals.Stat, NoKeepAlive: intervals.StatNoKeepAlive}
+		}
+
+		// stop tracking startup grace periods for caches which are no longer polled
+		polledCaches := make(map[tc.CacheName]struct{}, len(healthURLs))
+		for cacheName := range healthURLs {
+			polledCaches[tc.CacheName(cacheName)] = struct{}{}
 		}
+		gracePeriods.SetCaches(polledCaches)
+		pollingAssignment.Set(newPollingAssignmentData(thisTMGroup, cacheGroupAssignments, expectedCaches))
 
 		// Pollingに必要な情報をhealthURLSubscriberチャネルやpeerURLSubscriberチャネルに送付している。 (補足)diffConfigしているのはこの情報
-		healthURLSubscriber <- poller.CachePollerConfig{Urls: healthURLs, PollingProtocol: cfg.CachePollingProtocol, Interval: intervals.Health, NoKeepAlive: intervals.HealthNoKeepAlive}
+		healthURLSubscriber <- poller.CachePollerConfig{Urls: healthURLs, PollingProtocol: cfg.CachePollingProtocol, IPv4Weight: cfg.CachePollingIPv4Weight, IPv6Weight: cfg.CachePollingIPv6Weight, Interval: intervals.Health, NoKeepAlive: intervals.HealthNoKeepAlive}
 		peerURLSubscriber <- poller.PeerPollerConfig{Urls: peerURLs, Interval: intervals.Peer, NoKeepAlive: intervals.PeerNoKeepAlive}
 
 		// 設定 `distributed_polling=true`の場合には
@@ -437,10 +523,57 @@ func monitorConfigListen(
 
 }
 
+// withoutCacheGroups returns the caches which aren't in any of the given cache
+// groups.
+func withoutCacheGroups(caches map[string]tc.TrafficServer, cacheGroups map[string]struct{}) map[string]tc.TrafficServer {
+	if len(cacheGroups) == 0 {
+		return caches
+	}
+	filtered := make(map[string]tc.TrafficServer, len(caches))
+	for name, c := range caches {
+		if _, ok := cacheGroups[c.CacheGroup]; !ok {
+			filtered[name] = c
+		}
+	}
+	return filtered
+}
+
+// newPollingAssignmentData returns the PollingAssignmentData of the given
+// cache group assignments, with each group's cache groups sorted.
+func newPollingAssignmentData(thisTMGroup string, cacheGroupAssignments map[string]map[string]tc.TMCacheGroup, expectedCaches map[tc.CacheName]string) threadsafe.PollingAssignmentData {
+	assignment := threadsafe.PollingAssignmentData{
+		TMGroup:     thisTMGroup,
+		CacheGroups: make(map[string][]string, len(cacheGroupAssignments)),
+		Caches:      expectedCaches,
+	}
+	for tmGroup, cacheGroups := range cacheGroupAssignments {
+		names := make([]string, 0, len(cacheGroups))
+		for cacheGroup := range cacheGroups {
+			names = append(names, cacheGroup)
+		}
+		sort.Strings(names)
+		assignment.CacheGroups[tmGroup] = names
+	}
+	return assignment
+}
+
 // getCacheGroupsToPoll returns the name of this Traffic Monitor's cache group,
 // the status of this Traffic Monitor, and the set of cache groups it needs to poll.
 func getCacheGroupsToPoll(distributedPolling bool, hostname string, monitors map[string]tc.TrafficMonitor,
 	caches map[string]tc.TrafficServer, allCacheGroups map[string]tc.TMCacheGroup) (string, string, map[string]tc.TMCacheGroup, error) {
+	thisTMGroup, thisTMStatus, assignments, err := getCacheGroupAssignments(distributedPolling, hostname, monitors, caches, allCacheGroups)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return thisTMGroup, thisTMStatus, assignments[thisTMGroup], nil
+}
+
+// getCacheGroupAssignments returns the name of this Traffic Monitor's cache
+// group, the status of this Traffic Monitor, and the set of cache groups each
+// Traffic Monitor group with the same status needs to poll. Without distributed
+// polling, only this Traffic Monitor's group is returned, with all cache groups.
+func getCacheGroupAssignments(distributedPolling bool, hostname string, monitors map[string]tc.TrafficMonitor,
+	caches map[string]tc.TrafficServer, allCacheGroups map[string]tc.TMCacheGroup) (string, string, map[string]map[string]tc.TMCacheGroup, error) {
 	tmGroupSet := make(map[string]tc.TMCacheGroup)
 	cacheGroupSet := make(map[string]tc.TMCacheGroup)
 	tmGroupToPolledCacheGroups := make(map[string]map[string]tc.TMCacheGroup)
@@ -480,7 +613,7 @@ func getCacheGroupsToPoll(distributedPolling bool, hostname string, monitors map
 	}
 
 	if !distributedPolling {
-		return thisTMGroup, thisTMStatus, cacheGroupSet, nil
+		return thisTMGroup, thisTMStatus, map[string]map[string]tc.TMCacheGroup{thisTMGroup: cacheGroupSet}, nil
 	}
 
 	tmGroups := make([]string, 0, len(tmGroupSet))
@@ -503,7 +636,7 @@ func getCacheGroupsToPoll(distributedPolling bool, hostname string, monitors map
 		tmGroupToPolledCacheGroups[tmGroup][closest] = allCacheGroups[closest]
 	}
 
-	return thisTMGroup, thisTMStatus, tmGroupToPolledCacheGroups[thisTMGroup], nil
+	return thisTMGroup, thisTMStatus, tmGroupToPolledCacheGroups, nil
 }
 
 func findAndRemoveClosestCachegroup(remainingCacheGroups []string, target tc.TMCacheGroup, allCacheGroups map[string]tc.TMCacheGroup) (string, []string) {
@@ -567,7 +700,7 @@ func createServerHealthPollURLs(pollingURLStr string, srv tc.TrafficServer) (str
 		infName = *lid.InterfaceName
 	}
 
-	IPv4の場合のポーリングURL生成
+	// IPv4の場合のポーリングURL生成
 	var pollingURL4Str string
 	if lid.IPAddress != nil && *lid.IPAddress != "" {
 
@@ -582,7 +715,7 @@ func createServerHealthPollURLs(pollingURLStr string, srv tc.TrafficServer) (str
 		pollingURL4Str = insertPorts(pollingURL4Str, srv)
 	}
 
-	IPv6の場合のポーリングURL生成
+	// IPv6の場合のポーリングURL生成
 	var pollingURL6Str string
 	if lid.IP6Address != nil && *lid.IP6Address != "" {
 		r := strings.NewReplacer(
@@ -599,6 +732,9 @@ func createServerHealthPollURLs(pollingURLStr string, srv tc.TrafficServer) (str
 }
 
 func insertPorts(pollingURLStr string, srv tc.TrafficServer) string {
+	if strings.HasPrefix(strings.ToLower(pollingURLStr), poller.UnixURLScheme) {
+		return pollingURLStr // Unix domain socket URLs have no port
+	}
 	if strings.HasPrefix(strings.ToLower(pollingURLStr), "https") {
 		if srv.HTTPSPort != 0 {
 			pollURL, err := url.Parse(pollingURLStr)
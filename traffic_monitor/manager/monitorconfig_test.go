@@ -22,6 +22,7 @@ package manager
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-tc"
 )
@@ -407,3 +408,58 @@ func TestGetCacheGroupsToPoll(t *testing.T) {
 		}
 	}
 }
+
+func TestWithoutCacheGroups(t *testing.T) {
+	caches := map[string]tc.TrafficServer{
+		"cache1": {CacheGroup: "cache-group-1", ServerStatus: "REPORTED"},
+		"cache2": {CacheGroup: "cache-group-2", ServerStatus: "REPORTED"},
+		"cache3": {CacheGroup: "cache-group-2", ServerStatus: "ADMIN_DOWN"},
+	}
+
+	if filtered := withoutCacheGroups(caches, nil); !reflect.DeepEqual(caches, filtered) {
+		t.Errorf("expected no disabled cachegroups to keep all caches, actual: %+v", filtered)
+	}
+
+	filtered := withoutCacheGroups(caches, map[string]struct{}{"cache-group-2": {}, "cache-group-4": {}})
+	expected := map[string]tc.TrafficServer{"cache1": caches["cache1"]}
+	if !reflect.DeepEqual(expected, filtered) {
+		t.Errorf("filtering disabled cachegroups -- expected: %+v, actual: %+v", expected, filtered)
+	}
+	if len(caches) != 3 {
+		t.Errorf("expected filtering to not modify the given caches, actual: %+v", caches)
+	}
+}
+
+func TestGetServerIntervals(t *testing.T) {
+	monitorConfig := tc.TrafficMonitorConfigMap{
+		Config: map[string]interface{}{
+			"heartbeat.polling.interval.cg0": float64(2000),
+			"stat.polling.interval.cg0":      float64(20000),
+			"stat.polling.interval.cg1":      "not a number",
+		},
+		Profile: map[string]tc.TMProfile{
+			"overridden": {Parameters: tc.TMParameters{StatPollingInterval: 60000}},
+		},
+	}
+	ratio := func(d time.Duration) time.Duration {
+		return time.Duration(float64(d) * PollIntervalRatio)
+	}
+
+	type testCase struct {
+		srv            tc.TrafficServer
+		expectedHealth time.Duration
+		expectedStat   time.Duration
+	}
+	testCases := []testCase{
+		{tc.TrafficServer{CacheGroup: "cg0"}, ratio(2 * time.Second), ratio(20 * time.Second)},
+		{tc.TrafficServer{CacheGroup: "cg0", Profile: "overridden"}, ratio(2 * time.Second), ratio(60 * time.Second)},
+		{tc.TrafficServer{CacheGroup: "cg1"}, 0, 0},
+		{tc.TrafficServer{CacheGroup: "cg2", Profile: "overridden"}, 0, ratio(60 * time.Second)},
+	}
+	for _, testCase := range testCases {
+		health, stat := getServerIntervals(monitorConfig, testCase.srv)
+		if health != testCase.expectedHealth || stat != testCase.expectedStat {
+			t.Errorf("getting server intervals for %+v -- expected: %v, %v, actual: %v, %v", testCase.srv, testCase.expectedHealth, testCase.expectedStat, health, stat)
+		}
+	}
+}
@@ -46,10 +46,11 @@ import (
 // Note the OpsConfigManager is in charge of the httpServer, because ops config changes trigger server changes. If other things needed to trigger server restarts, the server could be put in its own goroutine with signal channels
 func StartOpsConfigManager(
 	opsConfigFile string,
+	offlineSnapshotDir string,
 	toSession towrap.TrafficOpsSessionThreadsafe,
 	toData todata.TODataThreadsafe,
-	opsConfigChangeSubscribers []chan<- handler.OpsConfig,
-	toChangeSubscribers []chan<- towrap.TrafficOpsSessionThreadsafe,
+	opsConfigChangeSubscribers []chan handler.OpsConfig,
+	toChangeSubscribers []chan towrap.TrafficOpsSessionThreadsafe,
 	localStates peer.CRStatesThreadsafe,
 	peerStates peer.CRStatesPeersThreadsafe,
 	distributedPeerStates peer.CRStatesPeersThreadsafe,
@@ -67,9 +68,14 @@ func StartOpsConfigManager(
 	fetchCount threadsafe.Uint,
 	healthIteration threadsafe.Uint,
 	errorCount threadsafe.Uint,
+	combineCount threadsafe.Uint,
+	combineCoalescedCount threadsafe.Uint,
 	localCacheStatus threadsafe.CacheAvailableStatus,
 	statUnpolledCaches threadsafe.UnpolledCaches,
 	healthUnpolledCaches threadsafe.UnpolledCaches,
+	cacheGracePeriods threadsafe.CacheGracePeriods,
+	pollingAssignment threadsafe.PollingAssignment,
+	restoredStateTime threadsafe.Time,
 	monitorConfig threadsafe.TrafficMonitorConfigMap,
 	cfg config.Config,
 ) (threadsafe.OpsConfig, error) {
@@ -100,6 +106,7 @@ func StartOpsConfigManager(
 		}
 
 		opsConfig.Set(newOpsConfig)
+		events.Webhook().Configure(newOpsConfig.EventWebhookURL, newOpsConfig.EventWebhookBufferSize)
 
 		listenAddress := ":80" // default
 
@@ -127,11 +134,16 @@ func StartOpsConfigManager(
 			fetchCount,
 			healthIteration,
 			errorCount,
+			combineCount,
+			combineCoalescedCount,
 			toData,
 			localCacheStatus,
 			lastStats,
 			statUnpolledCaches,
 			healthUnpolledCaches,
+			cacheGracePeriods,
+			pollingAssignment,
+			restoredStateTime,
 			monitorConfig,
 			cfg.StatPolling,
 			cfg.DistributedPolling,
@@ -164,6 +176,19 @@ func StartOpsConfigManager(
 			}
 		}
 
+		// --offlineSnapshotの指定がtraffic_ops.cfgのofflineSnapshotDirより優先される
+		if offlineSnapshotDir != "" {
+			newOpsConfig.OfflineSnapshotDir = offlineSnapshotDir
+		}
+		toSession.SetOfflineSnapshotDir(newOpsConfig.OfflineSnapshotDir)
+
+		// オフラインスナップショットを再生する場合にはTraffic Opsにはログインしない
+		newOpsConfig.UsingOfflineSnapshot = newOpsConfig.OfflineSnapshotDir != ""
+		if newOpsConfig.UsingOfflineSnapshot {
+			log.Warnf("running offline from the snapshot in '%s', Traffic Ops will not be used\n", newOpsConfig.OfflineSnapshotDir)
+			newOpsConfig.UsingDummyTO = true
+		}
+
 		// TODO config? parameter?
 		useCache := false
 		trafficOpsRequestTimeout := time.Second * time.Duration(10)
@@ -178,7 +203,7 @@ func StartOpsConfigManager(
 			// use a fallback constant duration.
 			backoff = util.NewConstantBackoff(util.ConstantBackoffDuration)
 		}
-		for {
+		for !newOpsConfig.UsingOfflineSnapshot {
 			err = toSession.Update(newOpsConfig.Url, newOpsConfig.Username, newOpsConfig.Password, newOpsConfig.Insecure, staticAppData.UserAgent, useCache, trafficOpsRequestTimeout)
 			if err != nil {
 				handleErr(fmt.Errorf("MonitorConfigPoller: error instantiating Session with traffic_ops (%v): %s\n", toAddr, err))
@@ -216,8 +241,13 @@ func StartOpsConfigManager(
 			newOpsConfig.CdnName = cdn
 		}
 
-		// These must be in a goroutine, because the monitorConfigPoller tick sends to a channel this select listens for. Thus, if we block on sends to the monitorConfigPoller, we have a livelock race condition.
-		// More generically, we're using goroutines as an infinite chan buffer, to avoid potential livelocks
+		if quorumMin := cfg.PeerOptimisticQuorumMinForCDN(newOpsConfig.CdnName); quorumMin != peerStates.GetQuorumMin() {
+			log.Infof("using peer optimistic quorum minimum %d for CDN '%s'\n", quorumMin, newOpsConfig.CdnName)
+			peerStates.SetQuorumMin(quorumMin)
+		}
+
+		// These must not block, because the monitorConfigPoller tick sends to a channel this select listens for. Thus, if we block on sends to the monitorConfigPoller, we have a livelock race condition.
+		// Rather than a goroutine per change as an infinite chan buffer, each subscriber chan is buffered size 1 and keeps only the latest change, since subscribers only ever want the latest.
 
 		// TODO: 以下の2つのfor文ではチャネルが破棄されるまで待機し続けるので、片方しか実行されない様にみえる。しかも、チャネルを受信したとしても再度同じチャネルに送信しているように見える。
 
@@ -225,11 +255,11 @@ func StartOpsConfigManager(
 			// 以下のgoroutineは無名関数を即時実行しています。 
 			//  cf: https://qiita.com/hir1524/items/a270b00c420ed96f02f0#%E5%8D%B3%E6%99%82%E9%96%A2%E6%95%B0
 			// 即時実行なので最後の(subscriber)というのはその手前の無名関数の引数に指定される値です。
-			go func(s chan<- handler.OpsConfig) { s <- newOpsConfig }(subscriber)
+			writeOpsConfig(subscriber, newOpsConfig)
 		}
 
 		for _, subscriber := range toChangeSubscribers {         // このfor文はtoChangeSubscribersチャネルがクローズされるまで実行される
-			go func(s chan<- towrap.TrafficOpsSessionThreadsafe) { s <- toSession }(subscriber)
+			writeTOSession(subscriber, toSession)
 		}
 
 	}
@@ -249,3 +279,29 @@ func StartOpsConfigManager(
 
 	return opsConfig, nil
 }
+
+// writeOpsConfig writes the given ops config to the subscriber chan s. This is nonblocking, and immediately returns.
+// Because subscribers only ever want the latest ops config, if nobody has read the previous write, it's removed, so s must be buffered size 1.
+func writeOpsConfig(s chan handler.OpsConfig, opsConfig handler.OpsConfig) {
+	for {
+		select {
+		case s <- opsConfig:
+			return // return after successfully writing.
+		case <-s:
+			// if the channel buffer was full, read, then loop and try to write again
+		}
+	}
+}
+
+// writeTOSession writes the given Traffic Ops session to the subscriber chan s. This is nonblocking, and immediately returns.
+// Because subscribers only ever want the latest session, if nobody has read the previous write, it's removed, so s must be buffered size 1.
+func writeTOSession(s chan towrap.TrafficOpsSessionThreadsafe, session towrap.TrafficOpsSessionThreadsafe) {
+	for {
+		select {
+		case s <- session:
+			return // return after successfully writing.
+		case <-s:
+			// if the channel buffer was full, read, then loop and try to write again
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"testing"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/handler"
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+)
+
+func TestWriteOpsConfigKeepsLatest(t *testing.T) {
+	monitorConfigPoller := poller.NewMonitorConfig(0)
+
+	// with nobody reading, every write returns at once, and only the latest is pending.
+	for _, cdn := range []string{"cdn1", "cdn2", "cdn3"} {
+		writeOpsConfig(monitorConfigPoller.OpsConfigChannel, handler.OpsConfig{CdnName: cdn})
+	}
+	if pending := len(monitorConfigPoller.OpsConfigChannel); pending != 1 {
+		t.Fatalf("expected 1 pending ops config, actual: %d", pending)
+	}
+	if opsConfig := <-monitorConfigPoller.OpsConfigChannel; opsConfig.CdnName != "cdn3" {
+		t.Errorf("expected the latest ops config 'cdn3', actual: '%s'", opsConfig.CdnName)
+	}
+}
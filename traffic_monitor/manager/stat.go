@@ -50,6 +50,10 @@ func getNewCaches(localStates peer.CRStatesThreadsafe, monitorConfigTS threadsaf
 		if ts, ok := monitorConfig.TrafficServer[string(cacheName)]; !ok || ts.ServerStatus == string(tc.CacheStatusOnline) || ts.ServerStatus == string(tc.CacheStatusOffline) {
 			continue
 		}
+		// Caches in disabled cachegroups are not polled either.
+		if a.Status == DisabledCacheGroupStatus {
+			continue
+		}
 		caches[cacheName] = a.DirectlyPolled
 	}
 	return caches
@@ -67,6 +71,7 @@ func StartStatHistoryManager(
 	cfg config.Config,
 	monitorConfig threadsafe.TrafficMonitorConfigMap,
 	events health.ThreadsafeEvents,
+	gracePeriods threadsafe.CacheGracePeriods,
 	combineState func(),
 ) (threadsafe.ResultInfoHistory, threadsafe.ResultStatHistory, threadsafe.CacheKbpses, threadsafe.DurationMap, threadsafe.LastStats, threadsafe.DSStatsReader, threadsafe.UnpolledCaches, threadsafe.CacheAvailableStatus) {
 
@@ -97,7 +102,7 @@ func StartStatHistoryManager(
 		if haveCachesChanged() {
 			statUnpolledCaches.SetNewCaches(getNewCaches(localStates, monitorConfig))
 		}
-		processStatResults(results, statInfoHistory, statResultHistory, statMaxKbpses, combinedStates, lastStats, toData.Get(), dsStats, lastStatEndTimes, lastStatDurations, statUnpolledCaches, monitorConfig.Get(), precomputedData, lastResults, localStates, events, localCacheStatus, combineState, cfg.CachePollingProtocol)
+		processStatResults(results, statInfoHistory, statResultHistory, statMaxKbpses, combinedStates, lastStats, toData.Get(), dsStats, lastStatEndTimes, lastStatDurations, statUnpolledCaches, monitorConfig.Get(), precomputedData, lastResults, localStates, events, localCacheStatus, gracePeriods, combineState, cfg.CachePollingProtocol)
 	}
 
 	go func() {
@@ -251,6 +256,7 @@ func processStatResults(
 	localStates peer.CRStatesThreadsafe,
 	events health.ThreadsafeEvents,
 	localCacheStatusThreadsafe threadsafe.CacheAvailableStatus,
+	gracePeriods threadsafe.CacheGracePeriods,
 	combineState func(),
 	pollingProtocol config.PollingProtocol,
 ) {
@@ -312,7 +318,7 @@ func processStatResults(
 	lastStats.Set(*lastStatsCopy)
 
 	pollerName := "stat"
-	health.CalcAvailability(results, pollerName, &statResultHistoryThreadsafe, mc, toData, localCacheStatusThreadsafe, localStates, events, pollingProtocol)
+	health.CalcAvailability(results, pollerName, &statResultHistoryThreadsafe, mc, toData, localCacheStatusThreadsafe, localStates, events, pollingProtocol, gracePeriods)
 
 	// StartStateCombinerの2番目の戻り値で返された無名関数を実行する
 	// やっていることはStartStateCombiner()に定義されたcombineStateChanチャネルに送信して、同一関数のgoroutineとして定義された「for range combineStateChan」を開始させる役割を持つ
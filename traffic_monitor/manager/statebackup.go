@@ -0,0 +1,157 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// StateBackup is the availability state of this Traffic Monitor and its peers, as written to the state backup file.
+type StateBackup struct {
+	// Time is when the backup was taken. Restored states are at least this old.
+	Time        time.Time                                 `json:"time"`
+	LocalStates tc.CRStates                               `json:"localStates"`
+	Peers       map[tc.TrafficMonitorName]StateBackupPeer `json:"peers"`
+}
+
+// StateBackupPeer is the last state received from a single peer, as written to the state backup file.
+type StateBackupPeer struct {
+	Available bool        `json:"available"`
+	Time      time.Time   `json:"time"`
+	States    tc.CRStates `json:"states"`
+}
+
+// getStateBackup returns a StateBackup of the given local and peer states, taken now.
+func getStateBackup(localStates peer.CRStatesThreadsafe, peerStates peer.CRStatesPeersThreadsafe) StateBackup {
+	backup := StateBackup{
+		Time:        time.Now(),
+		LocalStates: localStates.Get(),
+		Peers:       map[tc.TrafficMonitorName]StateBackupPeer{},
+	}
+	peerTimes := peerStates.GetQueryTimes()
+	for peerName, states := range peerStates.GetCrstates() {
+		backup.Peers[peerName] = StateBackupPeer{
+			Available: peerStates.GetPeerAvailability(peerName),
+			Time:      peerTimes[peerName],
+			States:    states,
+		}
+	}
+	return backup
+}
+
+// writeStateBackup writes the given backup to the given file. The backup is written to a temporary file which then
+// replaces the given file, so a Traffic Monitor which stops mid-write never leaves a partial backup behind.
+func writeStateBackup(fileName string, backup StateBackup) error {
+	json := jsoniter.ConfigFastest
+	bts, err := json.Marshal(backup)
+	if err != nil {
+		return errors.New("marshalling state backup: " + err.Error())
+	}
+	tmpFileName := fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpFileName, bts, 0644); err != nil {
+		return errors.New("writing state backup: " + err.Error())
+	}
+	if err := os.Rename(tmpFileName, fileName); err != nil {
+		return errors.New("replacing state backup: " + err.Error())
+	}
+	return nil
+}
+
+// readStateBackup reads the backup in the given file.
+func readStateBackup(fileName string) (StateBackup, error) {
+	backup := StateBackup{}
+	bts, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return backup, errors.New("reading state backup: " + err.Error())
+	}
+	json := jsoniter.ConfigFastest
+	if err := json.Unmarshal(bts, &backup); err != nil {
+		return backup, errors.New("unmarshalling state backup: " + err.Error())
+	}
+	return backup, nil
+}
+
+// RestoreStateBackup restores the local and peer states from the configured state backup file, if state backups are
+// enabled and the backup is no older than the configured maximum age. It returns the time the restored backup was
+// taken, or the zero time if nothing was restored.
+//
+// This must be called before anything else writes to the local or peer states.
+func RestoreStateBackup(cfg config.Config, localStates peer.CRStatesThreadsafe, peerStates peer.CRStatesPeersThreadsafe) time.Time {
+	if cfg.StateBackupFile == "" {
+		return time.Time{}
+	}
+	if _, err := os.Stat(cfg.StateBackupFile); os.IsNotExist(err) {
+		log.Infof("state backup file '%s' does not exist, not restoring state\n", cfg.StateBackupFile)
+		return time.Time{}
+	}
+	backup, err := readStateBackup(cfg.StateBackupFile)
+	if err != nil {
+		log.Errorf("restoring state from '%s': %v\n", cfg.StateBackupFile, err)
+		return time.Time{}
+	}
+	if age := time.Since(backup.Time); age > cfg.StateBackupMaxAge {
+		log.Infof("state backup in '%s' is %v old, older than the maximum %v, not restoring state\n", cfg.StateBackupFile, age, cfg.StateBackupMaxAge)
+		return time.Time{}
+	}
+
+	for cacheName, available := range backup.LocalStates.Caches {
+		localStates.AddCache(cacheName, available)
+	}
+	for dsName, ds := range backup.LocalStates.DeliveryService {
+		localStates.SetDeliveryService(dsName, ds)
+	}
+	for peerName, peerBackup := range backup.Peers {
+		peerStates.Set(peer.Result{
+			ID:         peerName,
+			Available:  peerBackup.Available,
+			PeerStates: peerBackup.States,
+			Time:       peerBackup.Time,
+		})
+	}
+	log.Infof("restored state of %d caches and %d peers from '%s', taken at %v\n", len(backup.LocalStates.Caches), len(backup.Peers), cfg.StateBackupFile, backup.Time)
+	return backup.Time
+}
+
+// StartStateBackupManager starts the goroutine which periodically writes the local and peer states to the configured
+// state backup file. It does nothing if state backups are disabled.
+func StartStateBackupManager(cfg config.Config, localStates peer.CRStatesThreadsafe, peerStates peer.CRStatesPeersThreadsafe) {
+	if cfg.StateBackupFile == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.StateBackupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := writeStateBackup(cfg.StateBackupFile, getStateBackup(localStates, peerStates)); err != nil {
+				log.Errorf("backing up state to '%s': %v\n", cfg.StateBackupFile, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,107 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+)
+
+func TestStateBackupRestore(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.StateBackupFile = filepath.Join(t.TempDir(), "state.backup")
+
+	localStates := peer.NewCRStatesThreadsafe()
+	localStates.AddCache("cache0", tc.IsAvailable{IsAvailable: true, Ipv4Available: true, DirectlyPolled: true})
+	localStates.AddCache("cache1", tc.IsAvailable{IsAvailable: false, DirectlyPolled: true})
+	localStates.SetDeliveryService("ds0", tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{}})
+
+	peerStates := peer.NewCRStatesPeersThreadsafe(0)
+	peerCRStates := tc.NewCRStates(1, 0)
+	peerCRStates.Caches["cache2"] = tc.IsAvailable{IsAvailable: true}
+	peerStates.Set(peer.Result{ID: "tm0", Available: true, PeerStates: peerCRStates, Time: time.Now()})
+
+	if err := writeStateBackup(cfg.StateBackupFile, getStateBackup(localStates, peerStates)); err != nil {
+		t.Fatalf("writing state backup - expected: no error, actual: %v", err)
+	}
+
+	restoredLocalStates := peer.NewCRStatesThreadsafe()
+	restoredPeerStates := peer.NewCRStatesPeersThreadsafe(0)
+	restoredTime := RestoreStateBackup(cfg, restoredLocalStates, restoredPeerStates)
+	if restoredTime.IsZero() {
+		t.Fatal("restoring state backup - expected: non-zero restored time, actual: zero")
+	}
+	if age := time.Since(restoredTime); age < 0 || age > time.Minute {
+		t.Errorf("restored state backup time - expected: within the last minute, actual: %v", restoredTime)
+	}
+
+	caches := restoredLocalStates.GetCaches()
+	if len(caches) != 2 {
+		t.Errorf("restored caches - expected: 2, actual: %d", len(caches))
+	}
+	if !caches["cache0"].IsAvailable || !caches["cache0"].Ipv4Available {
+		t.Errorf("restored cache0 - expected: available, actual: %+v", caches["cache0"])
+	}
+	if caches["cache1"].IsAvailable {
+		t.Errorf("restored cache1 - expected: unavailable, actual: %+v", caches["cache1"])
+	}
+	if _, ok := restoredLocalStates.GetDeliveryService("ds0"); !ok {
+		t.Error("restored delivery service ds0 - expected: present, actual: missing")
+	}
+	peerCRStatesRestored, ok := restoredPeerStates.GetCrstates()["tm0"]
+	if !ok {
+		t.Fatal("restored peer tm0 - expected: present, actual: missing")
+	}
+	if !peerCRStatesRestored.Caches["cache2"].IsAvailable {
+		t.Errorf("restored peer tm0 cache2 - expected: available, actual: %+v", peerCRStatesRestored.Caches["cache2"])
+	}
+}
+
+func TestStateBackupRestoreTooOld(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.StateBackupFile = filepath.Join(t.TempDir(), "state.backup")
+
+	localStates := peer.NewCRStatesThreadsafe()
+	localStates.AddCache("cache0", tc.IsAvailable{IsAvailable: true})
+	backup := getStateBackup(localStates, peer.NewCRStatesPeersThreadsafe(0))
+	backup.Time = time.Now().Add(-2 * cfg.StateBackupMaxAge)
+	if err := writeStateBackup(cfg.StateBackupFile, backup); err != nil {
+		t.Fatalf("writing state backup - expected: no error, actual: %v", err)
+	}
+
+	restoredLocalStates := peer.NewCRStatesThreadsafe()
+	if restoredTime := RestoreStateBackup(cfg, restoredLocalStates, peer.NewCRStatesPeersThreadsafe(0)); !restoredTime.IsZero() {
+		t.Errorf("restoring too-old state backup - expected: zero restored time, actual: %v", restoredTime)
+	}
+	if caches := restoredLocalStates.GetCaches(); len(caches) != 0 {
+		t.Errorf("restoring too-old state backup - expected: no caches, actual: %d", len(caches))
+	}
+}
+
+func TestStateBackupRestoreDisabled(t *testing.T) {
+	if restoredTime := RestoreStateBackup(config.DefaultConfig, peer.NewCRStatesThreadsafe(), peer.NewCRStatesPeersThreadsafe(0)); !restoredTime.IsZero() {
+		t.Errorf("restoring with state backups disabled - expected: zero restored time, actual: %v", restoredTime)
+	}
+}
@@ -28,16 +28,26 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 )
 
 // StartStateCombiner starts the State Combiner goroutine, and returns the threadsafe CombinedStates, and a func to signal to combine states.
+//
+// The returned func never blocks. Because a combine always recomputes from the current local and peer states,
+// any number of signals received while a combine is already pending are coalesced into that single pending combine,
+// rather than queueing a goroutine or combine per signal. The combineCount is incremented for every combine performed,
+// and the combineCoalescedCount for every signal collapsed into a pending combine.
+//
+// Peers whose last state is older than the peerStates' maximum age are excluded from the combine. Because a peer which
+// stops being polled sends no results to signal a combine, while a maximum age is set, combines are also signalled
+// periodically so that such a peer is excluded soon after it ages out.
 // TrafficMonitorの状態の統合を行う関数です
-func StartStateCombiner(events health.ThreadsafeEvents, peerStates peer.CRStatesPeersThreadsafe, localStates peer.CRStatesThreadsafe, toData todata.TODataThreadsafe) (peer.CRStatesThreadsafe, func()) {
+func StartStateCombiner(events health.ThreadsafeEvents, peerStates peer.CRStatesPeersThreadsafe, localStates peer.CRStatesThreadsafe, toData todata.TODataThreadsafe, combineCount threadsafe.Uint, combineCoalescedCount threadsafe.Uint) (peer.CRStatesThreadsafe, func()) {
 
 	combinedStates := peer.NewCRStatesThreadsafe()
 
-	// the chan buffer just reduces the number of goroutines on our infinite buffer hack in combineState(), no real writer will block, since combineState() writes in a goroutine.
+	// The chan buffer of 1 is the single pending combine. Writers never block: if a combine is already pending, the signal is dropped.
 	combineStateChan := make(chan struct{}, 1)
 
 	// 以下の無名関数は下記の処理を行います。
@@ -49,24 +59,61 @@ func StartStateCombiner(events health.ThreadsafeEvents, peerStates peer.CRStates
 		select {
 		case combineStateChan <- struct{}{}:
 		default:
+			combineCoalescedCount.Inc()
 		}
 	}
 
 	go func() {
 		overrideMap := map[tc.CacheName]bool{}
+		stalePeers := map[tc.TrafficMonitorName]bool{}
 
 		// combineStateに格納されている無名関数中でcombineStateChanに値が追加されると、このfor range中のcombineCrStatesが実行されます。
 		// それまではまるで無限ループのように待機します。
 		// なおcombineStateChanチャネルがcloseされた場合には、for rangeのループ処理が閉じられることになります。
 		for range combineStateChan {
-			combineCrStates(events, true, peerStates.GetCRStatesPeersInfo(), localStates.Get(), combinedStates, overrideMap, toData.Get())
+			combineCount.Inc()
+			peerCrStatesInfo := peerStates.GetCRStatesPeersInfo()
+			logStalePeers(peerCrStatesInfo, stalePeers)
+			combineCrStates(events, true, peerCrStatesInfo, localStates.Get(), combinedStates, overrideMap, toData.Get())
 		}
 
 	}()
 
+	if maxAge := peerStates.GetMaxAge(); maxAge > 0 {
+		go func() {
+			for range time.Tick(maxAge / 2) {
+				combineState()
+			}
+		}()
+	}
+
 	return combinedStates, combineState
 }
 
+// logStalePeers logs each peer whose last state has become stale, or is no longer stale, since the last combine.
+// stalePeers is the set of peers which were stale, and is updated.
+func logStalePeers(peerCrStatesInfo peer.CRStatesPeersInfo, stalePeers map[tc.TrafficMonitorName]bool) {
+	peers := peerCrStatesInfo.GetCrStates()
+	for peerName := range peers {
+		stale := peerCrStatesInfo.IsStale(peerName)
+		if stale == stalePeers[peerName] {
+			continue
+		}
+		if stale {
+			log.Warnf("peer %s state is older than the maximum age, excluding it from the combined states\n", peerName)
+			stalePeers[peerName] = true
+		} else {
+			log.Infof("peer %s state is no longer stale, including it in the combined states\n", peerName)
+			delete(stalePeers, peerName)
+		}
+	}
+	for peerName := range stalePeers {
+		if _, ok := peers[peerName]; !ok {
+			delete(stalePeers, peerName)
+		}
+	}
+}
+
 func combineCacheState(
 	cacheName tc.CacheName,
 	localCacheState tc.IsAvailable,
@@ -161,6 +208,9 @@ func combineDSState(
 	}
 
 	for peerName, iPeerStates := range peerCrStatesInfo.GetCrStates() {
+		if peerCrStatesInfo.IsStale(peerName) {
+			continue
+		}
 		peerDeliveryService, ok := iPeerStates.DeliveryService[deliveryServiceName]
 		if !ok {
 			log.Infof("local delivery service %s not found in peer %s\n", deliveryServiceName, peerName)
@@ -27,6 +27,7 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 )
 
@@ -155,3 +156,88 @@ func TestCombineCacheStateCacheDown(t *testing.T) {
 		t.Fatalf("cache IPv6 is unavailable and should be available")
 	}
 }
+
+func TestStateCombinerCoalesces(t *testing.T) {
+	combineCount := threadsafe.NewUint()
+	combineCoalescedCount := threadsafe.NewUint()
+	_, combineState := StartStateCombiner(health.NewThreadsafeEvents(1), peer.NewCRStatesPeersThreadsafe(0), peer.NewCRStatesThreadsafe(), todata.NewThreadsafe(), combineCount, combineCoalescedCount)
+
+	const signals = 1000
+	for i := 0; i < signals; i++ {
+		combineState()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for combineCount.Get()+combineCoalescedCount.Get() != signals {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected combines + coalesced to equal %d signals, actual combines %d coalesced %d", signals, combineCount.Get(), combineCoalescedCount.Get())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if combineCount.Get() == 0 {
+		t.Error("expected at least one combine, actual: 0")
+	}
+}
+
+func TestCombineCrStatesStalePeer(t *testing.T) {
+	cacheName := tc.CacheName("testCache")
+	dsName := tc.DeliveryServiceName("testDS")
+	localStates := tc.CRStates{
+		Caches:          map[tc.CacheName]tc.IsAvailable{cacheName: {}},
+		DeliveryService: map[tc.DeliveryServiceName]tc.CRStatesDeliveryService{dsName: {}},
+	}
+	peerStates := peer.NewCRStatesPeersThreadsafe(1)
+	peerStates.SetMaxAge(time.Minute)
+	for name, age := range map[tc.TrafficMonitorName]time.Duration{"fresh": 0, "stale": 2 * time.Minute} {
+		peerStates.Set(peer.Result{
+			ID:        name,
+			Available: true,
+			PeerStates: tc.CRStates{
+				Caches:          map[tc.CacheName]tc.IsAvailable{cacheName: {IsAvailable: true, Ipv4Available: true, Ipv6Available: true}},
+				DeliveryService: map[tc.DeliveryServiceName]tc.CRStatesDeliveryService{dsName: {IsAvailable: true}},
+			},
+			Time: time.Now().Add(-age),
+		})
+	}
+	peerStates.SetPeers(map[tc.TrafficMonitorName]struct{}{"fresh": {}, "stale": {}})
+
+	if stale := peerStates.GetStalePeers(); len(stale) != 1 {
+		t.Errorf("expected only the aged out peer to be stale, actual: %v", stale)
+	} else if _, ok := stale["stale"]; !ok {
+		t.Errorf("expected peer 'stale' to be stale, actual: %v", stale)
+	}
+	if peerStates.GetPeerAvailability("stale") {
+		t.Error("expected the aged out peer to be unavailable")
+	}
+	if quorum, available, _, _ := peerStates.HasOptimisticQuorum(); !quorum || available != 1 {
+		t.Errorf("expected optimistic quorum with only the fresh peer available, actual: quorum %v, available %d", quorum, available)
+	}
+
+	// combine with the fresh peer's state made unavailable, so only the stale peer still claims the cache and delivery service are available.
+	peerStates.Set(peer.Result{
+		ID:        "fresh",
+		Available: true,
+		PeerStates: tc.CRStates{
+			Caches:          map[tc.CacheName]tc.IsAvailable{cacheName: {}},
+			DeliveryService: map[tc.DeliveryServiceName]tc.CRStatesDeliveryService{dsName: {}},
+		},
+		Time: time.Now(),
+	})
+	combinedStates := peer.NewCRStatesThreadsafe()
+	toData := todata.TOData{ServerTypes: map[tc.CacheName]tc.CacheType{cacheName: tc.CacheTypeEdge}}
+	combineCrStates(health.NewThreadsafeEvents(1), true, peerStates.GetCRStatesPeersInfo(), localStates, combinedStates, map[tc.CacheName]bool{}, toData)
+
+	if combinedStates.Get().Caches[cacheName].IsAvailable {
+		t.Error("expected the stale peer's cache state to be excluded from the combined states")
+	}
+	if combinedStates.Get().DeliveryService[dsName].IsAvailable {
+		t.Error("expected the stale peer's delivery service state to be excluded from the combined states")
+	}
+
+	// without a maximum age, the same peer state is combined.
+	peerStates.SetMaxAge(0)
+	combineCrStates(health.NewThreadsafeEvents(1), true, peerStates.GetCRStatesPeersInfo(), localStates, combinedStates, map[tc.CacheName]bool{}, toData)
+	if !combinedStates.Get().Caches[cacheName].IsAvailable {
+		t.Error("expected the peer's cache state to be combined without a maximum age")
+	}
+}
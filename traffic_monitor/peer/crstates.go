@@ -20,6 +20,7 @@ package peer
  */
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -28,18 +29,47 @@ import (
 
 const defaultMapCapacity = 8
 
+// maxRemovedStates is the maximum number of removed caches and delivery services remembered for CRStatesThreadsafe.GetDelta. When more are removed, they're forgotten, and deltas since before then are full.
+const maxRemovedStates = 10000
+
 // CRStatesThreadsafe provides safe access for multiple goroutines to read a single Crstates object, with a single goroutine writer.
 // This could be made lock-free, if the performance was necessary
 // TODO add separate locks for Caches and DeliveryService maps?
+//
+// Every change to the states increments a monotonically increasing version, and the version each cache and delivery service last changed at is kept, so the changes since a version can be served by GetDelta.
+// The version starts at the time the states were created, in microseconds, rather than 0, so a version from before Traffic Monitor restarted is older than any this instance knows the changes since.
 type CRStatesThreadsafe struct {
 	crStates *tc.CRStates
 	m        *sync.RWMutex
+
+	version         *uint64                           // incremented on every change
+	minDeltaVersion *uint64                           // the oldest version GetDelta can return the changes since
+	cacheVersions   map[tc.CacheName]uint64           // version each cache last changed at
+	dsVersions      map[tc.DeliveryServiceName]uint64 // version each delivery service last changed at
+	removedCaches   map[tc.CacheName]uint64           // version each removed cache was removed at
+	removedDSes     map[tc.DeliveryServiceName]uint64 // version each removed delivery service was removed at
 }
 
 // NewCRStatesThreadsafe creates a new CRStatesThreadsafe object safe for multiple goroutine readers and a single writer.
 func NewCRStatesThreadsafe() CRStatesThreadsafe {
 	crs := tc.NewCRStates(defaultMapCapacity, defaultMapCapacity)
-	return CRStatesThreadsafe{m: &sync.RWMutex{}, crStates: &crs}
+	version := initialVersion(time.Now())
+	minDeltaVersion := version
+	return CRStatesThreadsafe{
+		m:               &sync.RWMutex{},
+		crStates:        &crs,
+		version:         &version,
+		minDeltaVersion: &minDeltaVersion,
+		cacheVersions:   make(map[tc.CacheName]uint64, defaultMapCapacity),
+		dsVersions:      make(map[tc.DeliveryServiceName]uint64, defaultMapCapacity),
+		removedCaches:   map[tc.CacheName]uint64{},
+		removedDSes:     map[tc.DeliveryServiceName]uint64{},
+	}
+}
+
+// initialVersion returns the version of states created at the given time: the time in microseconds, which is well within the integers JSON clients can represent exactly.
+func initialVersion(start time.Time) uint64 {
+	return uint64(start.UnixNano() / int64(time.Microsecond))
 }
 
 // Get returns the internal Crstates object for reading.
@@ -49,6 +79,105 @@ func (t *CRStatesThreadsafe) Get() tc.CRStates {
 	return t.crStates.Copy()
 }
 
+// Version returns the version of the states, which increases every time they change.
+func (t *CRStatesThreadsafe) Version() uint64 {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return *t.version
+}
+
+// GetDelta returns the caches and delivery services which changed or were removed since the given version.
+//
+// The delta is Full, with every state, if since is 0, e.g. on a client's first connect, or if the changes since it are no longer known, including since a version from before Traffic Monitor restarted, or if since is newer than the current version.
+func (t *CRStatesThreadsafe) GetDelta(since uint64) tc.CRStatesDelta {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	delta := tc.CRStatesDelta{
+		Version:                 *t.version,
+		Since:                   since,
+		RemovedCaches:           []tc.CacheName{},
+		RemovedDeliveryServices: []tc.DeliveryServiceName{},
+	}
+	if since == 0 || since < *t.minDeltaVersion || since > *t.version {
+		full := t.crStates.Copy()
+		delta.Since = 0
+		delta.Full = true
+		delta.Caches = full.Caches
+		delta.DeliveryService = full.DeliveryService
+		return delta
+	}
+
+	delta.Caches = map[tc.CacheName]tc.IsAvailable{}
+	delta.DeliveryService = map[tc.DeliveryServiceName]tc.CRStatesDeliveryService{}
+	for name, version := range t.cacheVersions {
+		if version > since {
+			delta.Caches[name] = t.crStates.Caches[name]
+		}
+	}
+	for name, version := range t.dsVersions {
+		if version > since {
+			delta.DeliveryService[name] = t.crStates.DeliveryService[name]
+		}
+	}
+	for name, version := range t.removedCaches {
+		if version > since {
+			delta.RemovedCaches = append(delta.RemovedCaches, name)
+		}
+	}
+	for name, version := range t.removedDSes {
+		if version > since {
+			delta.RemovedDeliveryServices = append(delta.RemovedDeliveryServices, name)
+		}
+	}
+	sort.Slice(delta.RemovedCaches, func(i, j int) bool { return delta.RemovedCaches[i] < delta.RemovedCaches[j] })
+	sort.Slice(delta.RemovedDeliveryServices, func(i, j int) bool {
+		return delta.RemovedDeliveryServices[i] < delta.RemovedDeliveryServices[j]
+	})
+	return delta
+}
+
+// cacheStateChanged returns whether a cache's availability changed. The time it was last polled isn't considered a change, since it changes on every poll; it's only current in a delta as of the cache's last change.
+func cacheStateChanged(old tc.IsAvailable, new tc.IsAvailable) bool {
+	old.LastPoll = new.LastPoll
+	return old != new
+}
+
+// dsStateChanged returns whether a delivery service's availability changed.
+func dsStateChanged(old tc.CRStatesDeliveryService, new tc.CRStatesDeliveryService) bool {
+	if old.IsAvailable != new.IsAvailable || len(old.DisabledLocations) != len(new.DisabledLocations) {
+		return true
+	}
+	for i, location := range old.DisabledLocations {
+		if new.DisabledLocations[i] != location {
+			return true
+		}
+	}
+	return false
+}
+
+// setCache sets the cache's availability, incrementing the version if it changed. The write lock must be held.
+func (t *CRStatesThreadsafe) setCache(name tc.CacheName, available tc.IsAvailable) {
+	old, ok := t.crStates.Caches[name]
+	t.crStates.Caches[name] = available
+	if ok && !cacheStateChanged(old, available) {
+		return
+	}
+	*t.version++
+	t.cacheVersions[name] = *t.version
+	delete(t.removedCaches, name)
+}
+
+// pruneRemoved forgets the removed caches and delivery services, if there are too many, so deltas since before now are full. The write lock must be held.
+func (t *CRStatesThreadsafe) pruneRemoved() {
+	if len(t.removedCaches)+len(t.removedDSes) <= maxRemovedStates {
+		return
+	}
+	t.removedCaches = map[tc.CacheName]uint64{}
+	t.removedDSes = map[tc.DeliveryServiceName]uint64{}
+	*t.minDeltaVersion = *t.version
+}
+
 // GetDeliveryServices returns the internal Crstates delivery services map for reading.
 func (t *CRStatesThreadsafe) GetDeliveryServices() map[tc.DeliveryServiceName]tc.CRStatesDeliveryService {
 	t.m.RLock()
@@ -83,7 +212,7 @@ func (t *CRStatesThreadsafe) GetDeliveryService(name tc.DeliveryServiceName) (ds
 func (t *CRStatesThreadsafe) SetCache(cacheName tc.CacheName, available tc.IsAvailable) {
 	t.m.Lock()
 	if _, ok := t.crStates.Caches[cacheName]; ok {
-		t.crStates.Caches[cacheName] = available
+		t.setCache(cacheName, available)
 	}
 	t.m.Unlock()
 }
@@ -91,28 +220,46 @@ func (t *CRStatesThreadsafe) SetCache(cacheName tc.CacheName, available tc.IsAva
 // AddCache adds the internal availability data for a particular cache.
 func (t *CRStatesThreadsafe) AddCache(cacheName tc.CacheName, available tc.IsAvailable) {
 	t.m.Lock()
-	t.crStates.Caches[cacheName] = available
+	t.setCache(cacheName, available)
 	t.m.Unlock()
 }
 
 // DeleteCache deletes the given cache from the internal data.
 func (t *CRStatesThreadsafe) DeleteCache(name tc.CacheName) {
 	t.m.Lock()
-	delete(t.crStates.Caches, name)
+	if _, ok := t.crStates.Caches[name]; ok {
+		delete(t.crStates.Caches, name)
+		delete(t.cacheVersions, name)
+		*t.version++
+		t.removedCaches[name] = *t.version
+		t.pruneRemoved()
+	}
 	t.m.Unlock()
 }
 
 // SetDeliveryService sets the availability data for the given delivery service.
 func (t *CRStatesThreadsafe) SetDeliveryService(name tc.DeliveryServiceName, ds tc.CRStatesDeliveryService) {
 	t.m.Lock()
+	old, ok := t.crStates.DeliveryService[name]
 	t.crStates.DeliveryService[name] = ds
+	if !ok || dsStateChanged(old, ds) {
+		*t.version++
+		t.dsVersions[name] = *t.version
+		delete(t.removedDSes, name)
+	}
 	t.m.Unlock()
 }
 
 // DeleteDeliveryService deletes the given delivery service from the internal data. This MUST NOT be called by multiple goroutines.
 func (t *CRStatesThreadsafe) DeleteDeliveryService(name tc.DeliveryServiceName) {
 	t.m.Lock()
-	delete(t.crStates.DeliveryService, name)
+	if _, ok := t.crStates.DeliveryService[name]; ok {
+		delete(t.crStates.DeliveryService, name)
+		delete(t.dsVersions, name)
+		*t.version++
+		t.removedDSes[name] = *t.version
+		t.pruneRemoved()
+	}
 	t.m.Unlock()
 }
 
@@ -126,6 +273,7 @@ type CRStatesPeersThreadsafe struct {
 	peerCount  *int
 	quorumMin  *int
 	timeout    *time.Duration
+	maxAge     *time.Duration
 	m          *sync.RWMutex
 }
 
@@ -133,9 +281,11 @@ type CRStatesPeersThreadsafe struct {
 func NewCRStatesPeersThreadsafe(quorumMin int) CRStatesPeersThreadsafe {
 	count := 0
 	timeout := time.Hour // default to a large timeout
+	maxAge := time.Duration(0)
 	return CRStatesPeersThreadsafe{
 		m:          &sync.RWMutex{},
 		timeout:    &timeout,
+		maxAge:     &maxAge,
 		peerOnline: map[tc.TrafficMonitorName]bool{},
 		crStates:   map[tc.TrafficMonitorName]tc.CRStates{},
 		peerStates: map[tc.TrafficMonitorName]bool{},
@@ -151,6 +301,40 @@ func (t *CRStatesPeersThreadsafe) SetTimeout(timeout time.Duration) {
 	*t.timeout = timeout
 }
 
+// SetMaxAge sets the maximum age of a peer's last state before it is stale,
+// and excluded from the combined states. Zero disables the maximum age.
+func (t *CRStatesPeersThreadsafe) SetMaxAge(maxAge time.Duration) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	*t.maxAge = maxAge
+}
+
+// GetMaxAge returns the maximum age of a peer's last state before it is stale.
+func (t *CRStatesPeersThreadsafe) GetMaxAge() time.Duration {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return *t.maxAge
+}
+
+// isStale returns whether a peer state received at the given time is older than maxAge. A zero maxAge never makes a state stale.
+func isStale(peerTime time.Time, maxAge time.Duration) bool {
+	return maxAge > 0 && time.Since(peerTime) >= maxAge
+}
+
+// SetQuorumMin sets the minimum number of available peers required for optimistic quorum.
+func (t *CRStatesPeersThreadsafe) SetQuorumMin(quorumMin int) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	*t.quorumMin = quorumMin
+}
+
+// GetQuorumMin returns the minimum number of available peers currently required for optimistic quorum.
+func (t *CRStatesPeersThreadsafe) GetQuorumMin() int {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return *t.quorumMin
+}
+
 func (t *CRStatesPeersThreadsafe) SetPeers(newPeers map[tc.TrafficMonitorName]struct{}) {
 	t.m.Lock()
 	defer t.m.Unlock()
@@ -199,17 +383,31 @@ func copyPeerAvailable(a map[tc.TrafficMonitorName]bool) map[tc.TrafficMonitorNa
 // GetPeerAvailability returns the state of the given peer
 func (t *CRStatesPeersThreadsafe) GetPeerAvailability(peer tc.TrafficMonitorName) bool {
 	t.m.RLock()
-	availability := t.peerStates[peer] && t.peerOnline[peer] && time.Since(t.peerTimes[peer]) < *t.timeout
+	availability := t.peerStates[peer] && t.peerOnline[peer] && time.Since(t.peerTimes[peer]) < *t.timeout && !isStale(t.peerTimes[peer], *t.maxAge)
 	t.m.RUnlock()
 	return availability
 }
 
+// GetStalePeers returns the peers whose last state is older than the maximum age, and the time each was received.
+func (t *CRStatesPeersThreadsafe) GetStalePeers() map[tc.TrafficMonitorName]time.Time {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	stale := map[tc.TrafficMonitorName]time.Time{}
+	for peer := range t.crStates {
+		if isStale(t.peerTimes[peer], *t.maxAge) {
+			stale[peer] = t.peerTimes[peer]
+		}
+	}
+	return stale
+}
+
 type CRStatesPeersInfo struct {
 	peerStates map[tc.TrafficMonitorName]bool
 	peerOnline map[tc.TrafficMonitorName]bool
 	peerTimes  map[tc.TrafficMonitorName]time.Time
 	crStates   map[tc.TrafficMonitorName]tc.CRStates
 	timeout    time.Duration
+	maxAge     time.Duration
 }
 
 func (i *CRStatesPeersInfo) GetCrStates() map[tc.TrafficMonitorName]tc.CRStates {
@@ -217,12 +415,17 @@ func (i *CRStatesPeersInfo) GetCrStates() map[tc.TrafficMonitorName]tc.CRStates
 }
 
 func (i *CRStatesPeersInfo) GetPeerAvailability(peer tc.TrafficMonitorName) bool {
-	return i.peerStates[peer] && i.peerOnline[peer] && time.Since(i.peerTimes[peer]) < i.timeout
+	return i.peerStates[peer] && i.peerOnline[peer] && time.Since(i.peerTimes[peer]) < i.timeout && !i.IsStale(peer)
+}
+
+// IsStale returns whether the last state of the given peer is older than the maximum age, and so must not be combined.
+func (i *CRStatesPeersInfo) IsStale(peer tc.TrafficMonitorName) bool {
+	return isStale(i.peerTimes[peer], i.maxAge)
 }
 
 func (i *CRStatesPeersInfo) HasAvailablePeers() bool {
-	for _, available := range i.peerStates {
-		if available {
+	for peer, available := range i.peerStates {
+		if available && !i.IsStale(peer) {
 			return true
 		}
 	}
@@ -243,6 +446,7 @@ func (t *CRStatesPeersThreadsafe) GetCRStatesPeersInfo() CRStatesPeersInfo {
 		peerTimes:  copyPeerTimes(t.peerTimes),
 		crStates:   make(map[tc.TrafficMonitorName]tc.CRStates, len(t.crStates)),
 		timeout:    *t.timeout,
+		maxAge:     *t.maxAge,
 	}
 	for k, v := range t.crStates {
 		info.crStates[k] = v.Copy()
@@ -264,12 +468,13 @@ func (t *CRStatesPeersThreadsafe) GetQueryTimes() map[tc.TrafficMonitorName]time
 	return copyPeerTimes(t.peerTimes)
 }
 
-// numAvailablePeers is a private function to determine how many peers are currently available; callers must lock t
+// numAvailablePeers is a private function to determine how many peers are currently available; callers must lock t.
+// Peers whose last state is stale are not counted.
 func (t *CRStatesPeersThreadsafe) numAvailablePeers() int {
 	count := 0
 
-	for _, available := range t.peerStates {
-		if available {
+	for peer, available := range t.peerStates {
+		if available && !isStale(t.peerTimes[peer], *t.maxAge) {
 			count++
 		}
 	}
@@ -22,7 +22,9 @@ package peer
 import (
 	"fmt"
 	"io/ioutil"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-tc"
 )
@@ -49,3 +51,80 @@ func TestCrStates(t *testing.T) {
 	}
 
 }
+
+func TestCRStatesDelta(t *testing.T) {
+	states := NewCRStatesThreadsafe()
+	states.AddCache("edge1", tc.IsAvailable{IsAvailable: true, Status: "REPORTED - available"})
+	states.AddCache("edge2", tc.IsAvailable{IsAvailable: true, Status: "REPORTED - available"})
+	states.SetDeliveryService("ds1", tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{}})
+
+	full := states.GetDelta(0)
+	if !full.Full || len(full.Caches) != 2 || len(full.DeliveryService) != 1 {
+		t.Fatalf("expected a full delta on first connect, actual: %+v", full)
+	}
+	version := full.Version
+	if version != states.Version() || version == 0 {
+		t.Fatalf("expected the delta version to be the current version %d, actual: %d", states.Version(), version)
+	}
+
+	// a poll which changes nothing but the poll time isn't a change.
+	states.SetCache("edge1", tc.IsAvailable{IsAvailable: true, Status: "REPORTED - available", LastPoll: time.Now()})
+	if states.Version() != version {
+		t.Errorf("expected the version to not change when only the poll time changes, actual: %d", states.Version())
+	}
+	if delta := states.GetDelta(version); delta.Full || len(delta.Caches) != 0 || len(delta.RemovedCaches) != 0 {
+		t.Errorf("expected an empty delta, actual: %+v", delta)
+	}
+
+	states.SetCache("edge2", tc.IsAvailable{IsAvailable: false, Status: "REPORTED - unavailable"})
+	states.DeleteCache("edge1")
+	states.DeleteDeliveryService("ds1")
+	states.SetCache("removed", tc.IsAvailable{IsAvailable: true}) // doesn't exist, so not set
+
+	delta := states.GetDelta(version)
+	if delta.Full || delta.Since != version || delta.Version != version+3 {
+		t.Errorf("expected a delta since %d to %d, actual: %+v", version, version+3, delta)
+	}
+	if len(delta.Caches) != 1 || delta.Caches["edge2"].IsAvailable {
+		t.Errorf("expected only edge2 to change to unavailable, actual: %+v", delta.Caches)
+	}
+	if !reflect.DeepEqual(delta.RemovedCaches, []tc.CacheName{"edge1"}) {
+		t.Errorf("expected edge1 to be removed, actual: %v", delta.RemovedCaches)
+	}
+	if !reflect.DeepEqual(delta.RemovedDeliveryServices, []tc.DeliveryServiceName{"ds1"}) {
+		t.Errorf("expected ds1 to be removed, actual: %v", delta.RemovedDeliveryServices)
+	}
+
+	// a re-added cache is no longer removed.
+	states.AddCache("edge1", tc.IsAvailable{IsAvailable: true})
+	delta = states.GetDelta(version)
+	if _, ok := delta.Caches["edge1"]; !ok || len(delta.RemovedCaches) != 0 {
+		t.Errorf("expected re-added edge1 to be changed and not removed, actual: %+v", delta)
+	}
+
+	// a version from the future gets every state.
+	if delta := states.GetDelta(states.Version() + 1); !delta.Full || len(delta.Caches) != 2 {
+		t.Errorf("expected a full delta since a future version, actual: %+v", delta)
+	}
+}
+
+// TestCRStatesDeltaRestart simulates a client which got a version from a Traffic Monitor, which then restarted.
+func TestCRStatesDeltaRestart(t *testing.T) {
+	before := NewCRStatesThreadsafe()
+	before.AddCache("edge1", tc.IsAvailable{IsAvailable: true})
+	before.AddCache("edge2", tc.IsAvailable{IsAvailable: true})
+	since := before.Version()
+
+	time.Sleep(time.Millisecond)
+	restarted := NewCRStatesThreadsafe()
+	if restarted.Version() <= since {
+		t.Fatalf("expected the version after a restart %d to be newer than the version before it %d", restarted.Version(), since)
+	}
+	restarted.AddCache("edge1", tc.IsAvailable{IsAvailable: false})
+	restarted.AddCache("edge2", tc.IsAvailable{IsAvailable: true})
+	restarted.AddCache("edge3", tc.IsAvailable{IsAvailable: true})
+
+	if delta := restarted.GetDelta(since); !delta.Full || len(delta.Caches) != 3 {
+		t.Errorf("expected a full delta since a version from before the restart, actual: %+v", delta)
+	}
+}
@@ -38,15 +38,25 @@ type CachePoller struct {
 	TickChan       chan uint64
 	GlobalContexts map[string]interface{}
 	Handler        handler.Handler
+	PollAdded      func(id string) // if not nil, called with the ID of each cache whose poll is added
+	StartJitterMax time.Duration   // the maximum random delay of a cache's first poll; if zero, its polling interval
 }
 
 type PollConfig struct {
-	URL      string
-	URLv6    string
-	Host     string
-	Timeout  time.Duration
-	Format   string
-	PollType string
+	URL        string
+	URLv6      string
+	Host       string
+	Timeout    time.Duration
+	Format     string
+	PollType   string
+	SocketPath string        // the Unix domain socket to poll, for the unix poll type
+	Interval   time.Duration // if not zero, overrides the CachePollerConfig Interval for this cache
+	// MaxResponseBytes is the largest response body read from the cache; if zero, DefaultMaxResponseBytes is used
+	MaxResponseBytes int64
+	// MaxRedirects is the number of HTTP redirects followed when polling the cache; if zero, none are
+	MaxRedirects int
+	// RedirectHosts is a comma-separated list of the hosts, besides the polled host, redirects may be followed to
+	RedirectHosts string
 }
 
 type CachePollerConfig struct {
@@ -54,6 +64,8 @@ type CachePollerConfig struct {
 	Interval        time.Duration
 	NoKeepAlive     bool
 	PollingProtocol config.PollingProtocol
+	IPv4Weight      uint64
+	IPv6Weight      uint64
 }
 
 // NewCache creates and returns a new CachePoller.
@@ -78,19 +90,37 @@ func NewCache(
 		ConfigChannel: make(chan CachePollerConfig),
 		Config: CachePollerConfig{
 			PollingProtocol: cfg.CachePollingProtocol,
+			IPv4Weight:      cfg.CachePollingIPv4Weight,
+			IPv6Weight:      cfg.CachePollingIPv6Weight,
 		},
 		GlobalContexts: GetGlobalContexts(cfg, appData),
 		Handler:        handler,
+		StartJitterMax: cfg.PollStartJitterMax,
 	}
 }
 
 var pollNum uint64
 
+// pollStartJitter returns a random delay before the first poll of a newly added poll, to spread the load of polls added
+// together. The delay is less than the polling interval, and less than jitterMax if it is greater than zero.
+func pollStartJitter(interval time.Duration, jitterMax time.Duration) time.Duration {
+	limit := interval
+	if jitterMax > 0 && jitterMax < limit {
+		limit = jitterMax
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
 type CachePollInfo struct {
 	NoKeepAlive     bool
 	Interval        time.Duration
 	ID              string
 	PollingProtocol config.PollingProtocol
+	IPv4Weight      uint64
+	IPv6Weight      uint64
 	PollConfig
 }
 
@@ -121,6 +151,10 @@ func (p CachePoller) Poll() {
 			kill := make(chan struct{})
 			killChans[info.ID] = kill
 
+			if p.PollAdded != nil {
+				p.PollAdded(info.ID)
+			}
+
 			// pollersはこのファイルでどこでも宣言されていません。pollers自体はpoller_types.goのソースコードで宣言されています。
 			// これはなぜ参照できるかというと同一パッケージ内であれば(先頭に宣言された「package poller」)、異なるファイルでも非公開関数や変数を参照できるらしい。
 			// see: https://ryochack.hatenadiary.org/entry/20120115/1326567659
@@ -137,9 +171,13 @@ func (p CachePoller) Poll() {
 			pollerObj := pollers[info.PollType]
 
 			pollerCfg := PollerConfig{
-				Timeout:     info.Timeout,
-				NoKeepAlive: info.NoKeepAlive,
-				PollerID:    info.ID,
+				Timeout:          info.Timeout,
+				NoKeepAlive:      info.NoKeepAlive,
+				PollerID:         info.ID,
+				SocketPath:       info.SocketPath,
+				MaxResponseBytes: info.MaxResponseBytes,
+				MaxRedirects:     info.MaxRedirects,
+				RedirectHosts:    info.RedirectHosts,
 			}
 
 			pollerCtx := interface{}(nil)
@@ -150,8 +188,11 @@ func (p CachePoller) Poll() {
 				pollerCtx = pollerObj.Init(pollerCfg, p.GlobalContexts[info.PollType])
 			}
 
+			// the start jitter is chosen for every added poll, so a poll re-added after a config change gets a new one.
+			startDelay := pollStartJitter(info.Interval, p.StartJitterMax)
+
 			// ここにp.Handlerで実行するハンドラが渡されている。peer/peer.goのHandle()などはここで引き渡される
-			go poller(info.Interval, info.ID, info.PollingProtocol, info.URL, info.URLv6, info.Host, info.Format, p.Handler /* ハンドラ */, pollerObj.Poll, pollerCtx, kill /* dieチャネル */)
+			go poller(info.Interval, startDelay, info.ID, newProtocolOscillator(info.PollingProtocol, info.IPv4Weight, info.IPv6Weight), info.URL, info.URLv6, info.Host, info.Format, p.Handler /* ハンドラ */, pollerObj.Poll, pollerObj.Close, pollerCtx, kill /* dieチャネル */)
 
 		}
 
@@ -163,29 +204,28 @@ func (p CachePoller) Poll() {
 // この関数は poller/cache.go: Poll()からのみ呼ばれる
 func poller(
 	interval time.Duration,
+	startDelay time.Duration,
 	id string,
-	pollingProtocol config.PollingProtocol,
+	protocols *protocolOscillator,
 	url string,
 	url6 string,
 	host string,
 	format string,
 	handler handler.Handler,
 	pollFunc PollerFunc,
+	closeFunc PollerCloseFunc,
 	pollCtx interface{},
 	die <-chan struct{},
 ) {
 
-	pollSpread := time.Duration(rand.Float64()*float64(interval/time.Nanosecond)) * time.Nanosecond
-	time.Sleep(pollSpread)
+	if !waitPollStart(startDelay, die) {
+		if closeFunc != nil {
+			closeFunc(pollCtx)
+		}
+		return
+	}
 	tick := time.NewTicker(interval)
 	lastTime := time.Now()
-	oscillateProtocols := false
-
-	if pollingProtocol == config.Both {
-		oscillateProtocols = true
-	}
-
-	usingIPv4 := pollingProtocol != config.IPv6Only
 
 	for {
 		select {
@@ -194,8 +234,8 @@ func poller(
 		case <-tick.C:
 
 			// /_atstatエンドポイントへのリクエストが行われる。
-			if (usingIPv4 && url == "") || (!usingIPv4 && url6 == "") {
-				usingIPv4 = !usingIPv4
+			if (protocols.usingIPv4 && url == "") || (!protocols.usingIPv4 && url6 == "") {
+				protocols.flip()
 				continue
 			}
 
@@ -215,6 +255,7 @@ func poller(
 			log.Debugf("poll %v %v start\n", pollID, time.Now())
 
 			// ポーリングURLをセットする。usingIPv4=falseならIPv6用のURLをpollUrlとしてセットする
+			usingIPv4 := protocols.usingIPv4
 			pollUrl := url
 			if !usingIPv4 {
 				pollUrl = url6
@@ -234,9 +275,7 @@ func poller(
 			// Handleはここで実行される(Handle関数自体はtraffic_monitor/cache/cache.goやtraffic_monitor/peer/peer.goで定義されている)。定義位置と実行位置が乖離しているのでわかりにくいので注意すること
 			go handler.Handle(id, rdr, format, reqTime, reqEnd, err, pollID, usingIPv4, pollCtx, pollFinishedChan)
 
-			if oscillateProtocols {
-				usingIPv4 = !usingIPv4
-			}
+			protocols.polled()
 
 			<-pollFinishedChan  // 有効コードで4行上にあるgo handler.Handleの最後の引数に指定したchannelで処理が終わると、チャネルが送信されるので、ここの受信のwaitが解除される。(タイマー起動による同一処理の重複実行させないための対策だと思われる)
 
@@ -244,67 +283,135 @@ func poller(
 		// Pollingが不要になったら送付されてきます。これはこのファイル(cache.go)のPoll()内でdeletionsがあれば「go func() { killChan <- struct{}{} }()」で実行されることで送信されます。これにより不要なポーリングを破棄させる役割があります
 		case <-die:
 			tick.Stop()  // Poll()の「go func() { killChan <- struct{}{} }()」はここを実行させるためのもの
+			if closeFunc != nil {
+				closeFunc(pollCtx)
+			}
 			return
 		}
 	}
 
 }
 
+// waitPollStart waits for the given delay before a poller starts, and returns false if the poller is killed first, so
+// that a poll removed during its start delay doesn't keep running alongside the poll which replaces it.
+func waitPollStart(delay time.Duration, die <-chan struct{}) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-die:
+		return false
+	}
+}
+
+// protocolOscillator chooses the IP family of each poll of a single cache.
+// When polling both IPv4 and IPv6, it polls ipv4Weight times over IPv4, then ipv6Weight times over IPv6, and so on,
+// so both families are always polled within ipv4Weight+ipv6Weight polls.
+type protocolOscillator struct {
+	oscillate  bool
+	usingIPv4  bool
+	ipv4Weight uint64
+	ipv6Weight uint64
+	polls      uint64 // the number of consecutive polls made with the current family
+}
+
+func newProtocolOscillator(pollingProtocol config.PollingProtocol, ipv4Weight uint64, ipv6Weight uint64) *protocolOscillator {
+	if ipv4Weight == 0 {
+		ipv4Weight = 1
+	}
+	if ipv6Weight == 0 {
+		ipv6Weight = 1
+	}
+	return &protocolOscillator{
+		oscillate:  pollingProtocol == config.Both,
+		usingIPv4:  pollingProtocol != config.IPv6Only,
+		ipv4Weight: ipv4Weight,
+		ipv6Weight: ipv6Weight,
+	}
+}
+
+// polled records a poll with the current family, switching families if its weight has been reached.
+func (o *protocolOscillator) polled() {
+	if !o.oscillate {
+		return
+	}
+	o.polls++
+	weight := o.ipv4Weight
+	if !o.usingIPv4 {
+		weight = o.ipv6Weight
+	}
+	if o.polls >= weight {
+		o.flip()
+	}
+}
+
+// flip switches to the other family immediately, e.g. because the cache has no address for the current one.
+func (o *protocolOscillator) flip() {
+	o.usingIPv4 = !o.usingIPv4
+	o.polls = 0
+}
+
 // 新・旧の設定オブジェクトを比較して、新に旧のURLがなければdeletionsにappendする。逆に旧に新のURLがなければadditionsにappendする。
 // diffConfigs takes the old and new configs, and returns a list of deleted IDs, and a list of new polls to do
 func diffConfigs(old CachePollerConfig, new CachePollerConfig) ([]string, []CachePollInfo) {
 	deletions := []string{}
 	additions := []CachePollInfo{}
 
-	if old.Interval != new.Interval || old.NoKeepAlive != new.NoKeepAlive {
+	newPollInfo := func(id string, pollCfg PollConfig) CachePollInfo {
+		return CachePollInfo{
+			Interval:        new.pollInterval(pollCfg),
+			NoKeepAlive:     new.NoKeepAlive,
+			ID:              id,
+			PollingProtocol: new.PollingProtocol,
+			IPv4Weight:      new.IPv4Weight,
+			IPv6Weight:      new.IPv6Weight,
+			PollConfig:      pollCfg,
+		}
+	}
+
+	if old.NoKeepAlive != new.NoKeepAlive {
 		for id, _ := range old.Urls {
 			deletions = append(deletions, id)
 		}
 		for id, pollCfg := range new.Urls {
-			additions = append(additions, CachePollInfo{
-				Interval:        new.Interval,
-				NoKeepAlive:     new.NoKeepAlive,
-				ID:              id,
-				PollingProtocol: new.PollingProtocol,
-				PollConfig:      pollCfg,
-			})
+			additions = append(additions, newPollInfo(id, pollCfg))
 		}
 		return deletions, additions
 	}
 
 	// old.Urlsには"edge", "mid-02", "mid-01"のそれぞれのオブジェクトでイテレーションされる
+	// A cache is only re-polled if its own poll config or effective interval changed, so changing the interval of some
+	// caches doesn't disturb the polling of the others.
 	for id, oldPollCfg := range old.Urls {
 		newPollCfg, newIdExists := new.Urls[id]
 		if !newIdExists {
 			deletions = append(deletions, id)
-		} else if newPollCfg != oldPollCfg {
+		} else if newPollCfg != oldPollCfg || new.pollInterval(newPollCfg) != old.pollInterval(oldPollCfg) {
 			deletions = append(deletions, id)
-			additions = append(additions, CachePollInfo{
-				Interval:        new.Interval,
-				NoKeepAlive:     new.NoKeepAlive,
-				ID:              id,
-				PollingProtocol: new.PollingProtocol,
-				PollConfig:      newPollCfg,
-			})
+			additions = append(additions, newPollInfo(id, newPollCfg))
 		}
 	}
 
 	for id, newPollCfg := range new.Urls {
 		_, oldIdExists := old.Urls[id]
 		if !oldIdExists {
-			additions = append(additions, CachePollInfo{
-				Interval:        new.Interval,
-				NoKeepAlive:     new.NoKeepAlive,
-				ID:              id,
-				PollingProtocol: new.PollingProtocol,
-				PollConfig:      newPollCfg,
-			})
+			additions = append(additions, newPollInfo(id, newPollCfg))
 		}
 	}
 
 	return deletions, additions
 }
 
+// pollInterval returns the interval on which the cache with the given PollConfig is polled: its own Interval, if it
+// has one, else the Interval of the CachePollerConfig.
+func (c CachePollerConfig) pollInterval(pollCfg PollConfig) time.Duration {
+	if pollCfg.Interval != 0 {
+		return pollCfg.Interval
+	}
+	return c.Interval
+}
+
 func stacktrace() []byte {
 	initialBufSize := 1024
 	buf := make([]byte, initialBufSize)
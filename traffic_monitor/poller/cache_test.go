@@ -0,0 +1,202 @@
+package poller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+)
+
+func TestProtocolOscillator(t *testing.T) {
+	type testCase struct {
+		protocol   config.PollingProtocol
+		ipv4Weight uint64
+		ipv6Weight uint64
+		expected   string
+	}
+	testCases := []testCase{
+		{config.Both, 1, 1, "464646"},
+		{config.Both, 3, 1, "44464446"},
+		{config.Both, 1, 2, "466466"},
+		{config.Both, 0, 0, "4646"},
+		{config.IPv4Only, 3, 1, "4444"},
+		{config.IPv6Only, 3, 1, "6666"},
+	}
+	for _, tc := range testCases {
+		o := newProtocolOscillator(tc.protocol, tc.ipv4Weight, tc.ipv6Weight)
+		actual := ""
+		for range tc.expected {
+			if o.usingIPv4 {
+				actual += "4"
+			} else {
+				actual += "6"
+			}
+			o.polled()
+		}
+		if actual != tc.expected {
+			t.Errorf("protocol %s weights %d:%d expected polls '%s', actual '%s'", tc.protocol, tc.ipv4Weight, tc.ipv6Weight, tc.expected, actual)
+		}
+	}
+}
+
+func TestProtocolOscillatorFlip(t *testing.T) {
+	o := newProtocolOscillator(config.Both, 3, 1)
+	o.polled()
+	o.flip()
+	if o.usingIPv4 {
+		t.Fatal("expected flip to switch to IPv6")
+	}
+	o.polled()
+	if !o.usingIPv4 {
+		t.Error("expected IPv6 weight of 1 to switch back to IPv4 after one poll")
+	}
+}
+
+func TestDiffConfigsSocketPath(t *testing.T) {
+	old := CachePollerConfig{Urls: map[string]PollConfig{
+		"edge": {URL: "unix:///a.sock:/_astats", PollType: PollerTypeUnix, SocketPath: "/a.sock"},
+	}}
+	new := CachePollerConfig{Urls: map[string]PollConfig{
+		"edge": {URL: "unix:///a.sock:/_astats", PollType: PollerTypeUnix, SocketPath: "/b.sock"},
+	}}
+
+	deletions, additions := diffConfigs(old, new)
+	if len(deletions) != 1 || deletions[0] != "edge" {
+		t.Errorf("expected a changed socket path to delete the old poller, actual deletions: %v", deletions)
+	}
+	if len(additions) != 1 || additions[0].SocketPath != "/b.sock" {
+		t.Errorf("expected a changed socket path to add a poller for the new socket, actual additions: %+v", additions)
+	}
+
+	deletions, additions = diffConfigs(new, new)
+	if len(deletions) != 0 || len(additions) != 0 {
+		t.Errorf("expected an unchanged config to have no deletions or additions, actual: %v, %+v", deletions, additions)
+	}
+}
+
+func TestDiffConfigsRedirects(t *testing.T) {
+	old := CachePollerConfig{Urls: map[string]PollConfig{
+		"edge": {URL: "http://192.0.2.1/_astats"},
+		"mid":  {URL: "http://192.0.2.2/_astats", MaxRedirects: 1},
+	}}
+	new := CachePollerConfig{Urls: map[string]PollConfig{
+		"edge": {URL: "http://192.0.2.1/_astats", MaxRedirects: 2},
+		"mid":  {URL: "http://192.0.2.2/_astats", MaxRedirects: 1, RedirectHosts: "stats.example.com"},
+	}}
+
+	deletions, additions := diffConfigs(old, new)
+	if len(deletions) != 2 || len(additions) != 2 {
+		t.Errorf("expected changed redirect settings to re-add both pollers, actual: %v, %+v", deletions, additions)
+	}
+	for _, addition := range additions {
+		if addition.PollConfig != new.Urls[addition.ID] {
+			t.Errorf("expected poller '%s' to be added with its new redirect settings, actual: %+v", addition.ID, addition.PollConfig)
+		}
+	}
+}
+
+func TestDiffConfigsInterval(t *testing.T) {
+	old := CachePollerConfig{Interval: time.Second, Urls: map[string]PollConfig{
+		"edge":   {URL: "http://edge/_astats"},
+		"mid":    {URL: "http://mid/_astats", Interval: 5 * time.Second},
+		"origin": {URL: "http://origin/_astats"},
+	}}
+
+	// changing one cache's interval only re-polls that cache
+	new := CachePollerConfig{Interval: time.Second, Urls: map[string]PollConfig{
+		"edge":   {URL: "http://edge/_astats", Interval: 10 * time.Second},
+		"mid":    {URL: "http://mid/_astats", Interval: 5 * time.Second},
+		"origin": {URL: "http://origin/_astats"},
+	}}
+	deletions, additions := diffConfigs(old, new)
+	if len(deletions) != 1 || deletions[0] != "edge" {
+		t.Errorf("expected a changed cache interval to delete only that cache's poller, actual deletions: %v", deletions)
+	}
+	if len(additions) != 1 || additions[0].ID != "edge" || additions[0].Interval != 10*time.Second {
+		t.Errorf("expected a changed cache interval to add only that cache's poller with the new interval, actual additions: %+v", additions)
+	}
+
+	// changing the poller interval re-polls every cache without its own interval
+	new = CachePollerConfig{Interval: 2 * time.Second, Urls: old.Urls}
+	deletions, additions = diffConfigs(old, new)
+	sort.Strings(deletions)
+	if len(deletions) != 2 || deletions[0] != "edge" || deletions[1] != "origin" {
+		t.Errorf("expected a changed poller interval to delete only pollers without their own interval, actual deletions: %v", deletions)
+	}
+	for _, addition := range additions {
+		if addition.ID == "mid" {
+			t.Errorf("expected a changed poller interval not to re-add a poller with its own interval, actual additions: %+v", additions)
+		} else if addition.Interval != 2*time.Second {
+			t.Errorf("expected re-added poller %s to have the new poller interval 2s, actual: %v", addition.ID, addition.Interval)
+		}
+	}
+	if len(additions) != 2 {
+		t.Errorf("expected 2 additions, actual: %+v", additions)
+	}
+}
+
+func TestPollStartJitter(t *testing.T) {
+	type testCase struct {
+		interval  time.Duration
+		jitterMax time.Duration
+		limit     time.Duration
+	}
+	testCases := []testCase{
+		{time.Minute, time.Second, time.Second},
+		{time.Second, time.Minute, time.Second},
+		{time.Minute, 0, time.Minute},
+		{0, time.Second, 0},
+	}
+	for _, tc := range testCases {
+		var max time.Duration
+		for i := 0; i < 1000; i++ {
+			jitter := pollStartJitter(tc.interval, tc.jitterMax)
+			if jitter < 0 || (jitter >= tc.limit && tc.limit > 0) || (tc.limit == 0 && jitter != 0) {
+				t.Fatalf("interval %v jitter max %v: expected a jitter in [0, %v), actual: %v", tc.interval, tc.jitterMax, tc.limit, jitter)
+			}
+			if jitter > max {
+				max = jitter
+			}
+		}
+		// the jitter is spread over the whole range, not only its start.
+		if max < tc.limit/2 {
+			t.Errorf("interval %v jitter max %v: expected jitters spread up to %v, actual max: %v", tc.interval, tc.jitterMax, tc.limit, max)
+		}
+	}
+}
+
+func TestWaitPollStart(t *testing.T) {
+	if !waitPollStart(time.Millisecond, make(chan struct{})) {
+		t.Error("expected the poller to start after its start delay")
+	}
+
+	die := make(chan struct{})
+	close(die)
+	start := time.Now()
+	if waitPollStart(time.Hour, die) {
+		t.Error("expected a poller killed during its start delay not to start")
+	}
+	if time.Since(start) > time.Second {
+		t.Error("expected a poller killed during its start delay to stop without waiting for the delay")
+	}
+}
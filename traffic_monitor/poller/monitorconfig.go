@@ -32,6 +32,8 @@ import (
 type MonitorCfg struct {
 	CDN string
 	Cfg tc.TrafficMonitorConfigMap
+	// DisabledCacheGroups is the set of Cache Groups whose caches must not be polled.
+	DisabledCacheGroups map[string]struct{}
 }
 
 type MonitorConfigPoller struct {
@@ -47,12 +49,13 @@ type MonitorConfigPoller struct {
 // NewMonitorConfig Creates and returns a new MonitorConfigPoller.
 func NewMonitorConfig(interval time.Duration) MonitorConfigPoller {
 	return MonitorConfigPoller{
-		Interval:       interval,
-		SessionChannel: make(chan towrap.TrafficOpsSessionThreadsafe),
+		Interval: interval,
+		// SessionChannel and OpsConfigChannel MUST have a buffer size 1, to make the ops config manager's nonblocking writes work
+		SessionChannel: make(chan towrap.TrafficOpsSessionThreadsafe, 1),
 		// ConfigChannel MUST have a buffer size 1, to make the nonblocking writeConfig work
 		// ConfigChannelはチャネル数が1
 		ConfigChannel:    make(chan MonitorCfg, 1),
-		OpsConfigChannel: make(chan handler.OpsConfig),
+		OpsConfigChannel: make(chan handler.OpsConfig, 1),
 		IntervalChan:     make(chan time.Duration),
 	}
 }
@@ -139,7 +142,11 @@ func (p MonitorConfigPoller) Poll() {
 			}
 
 			// 書き込みチャネルにこの引数の情報(MonitorCfg)を引き渡す
-			p.writeConfig(MonitorCfg{CDN: p.OpsConfig.CdnName, Cfg: *monitorConfig})
+			disabledCacheGroups := make(map[string]struct{}, len(p.OpsConfig.DisabledCacheGroups))
+			for _, cg := range p.OpsConfig.DisabledCacheGroups {
+				disabledCacheGroups[cg] = struct{}{}
+			}
+			p.writeConfig(MonitorCfg{CDN: p.OpsConfig.CdnName, Cfg: *monitorConfig, DisabledCacheGroups: disabledCacheGroups})
 		}
 	}
 }
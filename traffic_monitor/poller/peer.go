@@ -37,6 +37,7 @@ type PeerPoller struct {
 	ConfigChannel  chan PeerPollerConfig
 	GlobalContexts map[string]interface{}
 	Handler        handler.Handler
+	StartJitterMax time.Duration // the maximum random delay of a peer's first poll; if zero, its polling interval
 }
 
 type PeerPollConfig struct {
@@ -76,6 +77,7 @@ func NewPeer(
 		ConfigChannel:  make(chan PeerPollerConfig),      // チャネル
 		GlobalContexts: GetGlobalContexts(cfg, appData),
 		Handler:        handler,
+		StartJitterMax: cfg.PollStartJitterMax,
 	}
 
 }
@@ -139,7 +141,7 @@ func (p PeerPoller) Poll() {
 			}
 
 			// HTTPポーリング処理や結果の解析処理は下記で行います。必要な数だけここのgoroutine(Polling関数)が呼ばれます。これはkill(killChans)チャネルに送信することで停止できます。
-			go peerPoller(info.Interval, info.ID, info.URLs, info.Format, p.Handler, pollerObj.Poll, pollerCtx, kill)
+			go peerPoller(info.Interval, pollStartJitter(info.Interval, p.StartJitterMax), info.ID, info.URLs, info.Format, p.Handler, pollerObj.Poll, pollerCtx, kill)
 		}
 
 		// 設定オブジェクトを差し替える
@@ -149,6 +151,7 @@ func (p PeerPoller) Poll() {
 
 func peerPoller(
 	interval time.Duration,
+	startDelay time.Duration,
 	id string,
 	urls []string,
 	format string,
@@ -157,8 +160,9 @@ func peerPoller(
 	pollCtx interface{},
 	die <-chan struct{},
 ) {
-	pollSpread := time.Duration(rand.Float64()*float64(interval/time.Nanosecond)) * time.Nanosecond
-	time.Sleep(pollSpread)
+	if !waitPollStart(startDelay, die) {
+		return
+	}
 	tick := time.NewTicker(interval)
 	lastTime := time.Now()
 	urlI := rand.Intn(len(urls)) // start at a random URL index in order to help spread load
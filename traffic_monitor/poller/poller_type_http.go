@@ -22,8 +22,12 @@ package poller
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
@@ -32,6 +36,65 @@ import (
 
 const PollerTypeHTTP = "http"
 
+// DefaultMaxResponseBytes is the largest response body read from a cache, if its Profile doesn't set one.
+const DefaultMaxResponseBytes = 64 * 1024 * 1024
+
+// ErrResponseTooLarge is the error of polls whose response body was larger than the poller's maximum.
+var ErrResponseTooLarge = errors.New("response body too large")
+
+var responseTooLargeCount uint64
+
+// ResponseTooLargeCount returns the number of polls which failed because the response body was too large.
+func ResponseTooLargeCount() uint64 {
+	return atomic.LoadUint64(&responseTooLargeCount)
+}
+
+// maxResponseBytes returns the largest response body the poller with the given config may read.
+func maxResponseBytes(cfg PollerConfig) int64 {
+	if cfg.MaxResponseBytes > 0 {
+		return cfg.MaxResponseBytes
+	}
+	return DefaultMaxResponseBytes
+}
+
+// redirectPolicy returns the http.Client CheckRedirect func of a poller which follows at most maxRedirects redirects,
+// only to the host of the polled URL or its Host header, or one of the comma-separated allowedHosts, so a cache can't
+// redirect Traffic Monitor to an arbitrary host. If maxRedirects is zero, the redirect response itself is returned,
+// which is a poll failure.
+func redirectPolicy(maxRedirects int, allowedHosts string) func(req *http.Request, via []*http.Request) error {
+	allowed := map[string]struct{}{}
+	for _, host := range strings.Split(allowedHosts, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			allowed[host] = struct{}{}
+		}
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if maxRedirects <= 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		host := strings.ToLower(req.URL.Hostname())
+		polled := via[0]
+		if host == strings.ToLower(polled.URL.Hostname()) {
+			return nil
+		}
+		if polledHost := polled.Host; polledHost != "" {
+			if h, _, err := net.SplitHostPort(polledHost); err == nil {
+				polledHost = h
+			}
+			if host == strings.ToLower(polledHost) {
+				return nil
+			}
+		}
+		if _, ok := allowed[host]; ok {
+			return nil
+		}
+		return fmt.Errorf("redirect to host '%s' is not allowed", host)
+	}
+}
+
 // golangではinit関数はパッケージインポート時に明示的に実行を指定しなくても実行されます。つまり、下記のinitは読み込み時に実行されます。
 // 注意点として、同じパッケージ内に複数のinit()関数がある場合、実行の順序が保証されません。また、同じパッケージを複数回インポートしても、init()関数は1回しか実行されません。
 func init() {
@@ -79,12 +142,17 @@ func httpInit(cfg PollerConfig, globalCtxI interface{}) interface{} {
 
 	}
 
+	// every poller gets its own client, since which redirects it follows depends on its cache's Profile.
+	client := *gctx.Client
+	client.CheckRedirect = redirectPolicy(cfg.MaxRedirects, cfg.RedirectHosts)
+
 	return &HTTPPollCtx{
-		Client:       gctx.Client,
-		UserAgent:    gctx.UserAgent,
-		NoKeepAlive:  cfg.NoKeepAlive,
-		PollerID:     cfg.PollerID,
-		FormatAccept: gctx.FormatAccept,
+		Client:           &client,
+		UserAgent:        gctx.UserAgent,
+		NoKeepAlive:      cfg.NoKeepAlive,
+		PollerID:         cfg.PollerID,
+		FormatAccept:     gctx.FormatAccept,
+		MaxResponseBytes: maxResponseBytes(cfg),
 	}
 }
 
@@ -95,12 +163,13 @@ type HTTPPollGlobalCtx struct {
 }
 
 type HTTPPollCtx struct {
-	Client       *http.Client
-	UserAgent    string
-	NoKeepAlive  bool
-	PollerID     string
-	HTTPHeader   http.Header
-	FormatAccept string
+	Client           *http.Client
+	UserAgent        string
+	NoKeepAlive      bool
+	PollerID         string
+	HTTPHeader       http.Header
+	FormatAccept     string
+	MaxResponseBytes int64
 }
 
 // memo: http://<IP>:80/_atstats?application=system&inf.name=eth0 へのアクセスはここを経由する。
@@ -148,13 +217,24 @@ func httpPoll(ctxI interface{}, url string, host string, pollID uint64) ([]byte,
 		return nil, reqEnd, reqTime, fmt.Errorf("id %v url %v fetch error: bad HTTP status: %v", ctx.PollerID, url, resp.StatusCode)
 	}
 
-	// レスポンスを読み込む
-	bts, err := ioutil.ReadAll(resp.Body)
+	maxBytes := ctx.MaxResponseBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxResponseBytes
+	}
+
+	// レスポンスを読み込む (上限を1バイト超えて読めた場合は上限超過とみなす)
+	bts, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
 	if err != nil {
 		reqEnd := time.Now()
 		reqTime := reqEnd.Sub(startReq) // note this is the time to transfer the entire body, not just the roundtrip
 		return nil, reqEnd, reqTime, fmt.Errorf("id %v url %v fetch error: reading body: %v", ctx.PollerID, url, err)
 	}
+	if int64(len(bts)) > maxBytes {
+		atomic.AddUint64(&responseTooLargeCount, 1)
+		reqEnd := time.Now()
+		reqTime := reqEnd.Sub(startReq) // note this is the time to transfer the entire body, not just the roundtrip
+		return nil, reqEnd, reqTime, fmt.Errorf("id %v url %v fetch error: %w: more than %d bytes", ctx.PollerID, url, ErrResponseTooLarge, maxBytes)
+	}
 
 	// 終了処理
 	reqEnd := time.Now()
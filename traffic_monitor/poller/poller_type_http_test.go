@@ -0,0 +1,125 @@
+package poller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+)
+
+func TestHTTPPollMaxResponseBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 100)))
+	}))
+	defer server.Close()
+
+	gctx := httpGlobalInit(config.DefaultConfig, config.StaticAppData{UserAgent: "test"})
+
+	ctx := httpInit(PollerConfig{Timeout: time.Second, PollerID: "edge"}, gctx)
+	if maxBytes := ctx.(*HTTPPollCtx).MaxResponseBytes; maxBytes != DefaultMaxResponseBytes {
+		t.Errorf("expected default max response bytes %d, actual: %d", DefaultMaxResponseBytes, maxBytes)
+	}
+
+	ctx = httpInit(PollerConfig{Timeout: time.Second, PollerID: "edge", MaxResponseBytes: 100}, gctx)
+	bts, _, _, err := httpPoll(ctx, server.URL, "edge.test", 1)
+	if err != nil {
+		t.Fatalf("polling with a response at the limit - expected: no error, actual: %v", err)
+	}
+	if len(bts) != 100 {
+		t.Errorf("polling with a response at the limit - expected 100 bytes, actual: %d", len(bts))
+	}
+
+	before := ResponseTooLargeCount()
+	ctx = httpInit(PollerConfig{Timeout: time.Second, PollerID: "edge", MaxResponseBytes: 99}, gctx)
+	bts, _, _, err = httpPoll(ctx, server.URL, "edge.test", 2)
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("polling with a response over the limit - expected: %v, actual: %v", ErrResponseTooLarge, err)
+	}
+	if bts != nil {
+		t.Errorf("polling with a response over the limit - expected no bytes, actual: %d", len(bts))
+	}
+	if count := ResponseTooLargeCount(); count != before+1 {
+		t.Errorf("expected the too large count to be %d, actual: %d", before+1, count)
+	}
+}
+
+func TestHTTPPollRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stats"))
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_astats":
+			http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+		case "/moved":
+			http.Redirect(w, r, "/moved/again", http.StatusFound)
+		case "/moved/again":
+			w.Write([]byte("stats"))
+		case "/elsewhere":
+			// the target server is also on 127.0.0.1, so redirect to it by another name.
+			http.Redirect(w, r, strings.Replace(target.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	gctx := httpGlobalInit(config.DefaultConfig, config.StaticAppData{UserAgent: "test"})
+
+	tests := []struct {
+		name      string
+		cfg       PollerConfig
+		path      string
+		expectErr bool
+	}{
+		{"not followed by default", PollerConfig{}, "/_astats", true},
+		{"too many", PollerConfig{MaxRedirects: 1}, "/_astats", true},
+		{"followed", PollerConfig{MaxRedirects: 2}, "/_astats", false},
+		{"host not allowed", PollerConfig{MaxRedirects: 2}, "/elsewhere", true},
+		{"host allowed", PollerConfig{MaxRedirects: 2, RedirectHosts: "example.com, LOCALHOST"}, "/elsewhere", false},
+	}
+	for _, test := range tests {
+		test.cfg.Timeout = time.Second
+		test.cfg.PollerID = "edge"
+		ctx := httpInit(test.cfg, gctx)
+		bts, _, _, err := httpPoll(ctx, server.URL+test.path, "edge.test", 1)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, actual: '%s'", test.name, bts)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected no error, actual: %v", test.name, err)
+		} else if string(bts) != "stats" {
+			t.Errorf("%s: expected the redirect target's response, actual: '%s'", test.name, bts)
+		}
+	}
+
+	// the global client isn't changed by a poller's redirect policy.
+	if gctx.(*HTTPPollGlobalCtx).Client.CheckRedirect != nil {
+		t.Error("expected the global client to have no redirect policy")
+	}
+}
@@ -0,0 +1,112 @@
+package poller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// PollerTypeUnix polls caches over HTTP through a Unix domain socket, for caches co-located with the Traffic Monitor.
+// Its polling URLs have the form unix://<socket path>:<HTTP path>, for example unix:///var/run/trafficserver/stats.sock:/_astats?application=system.
+const PollerTypeUnix = "unix"
+
+// UnixURLScheme is the scheme of Unix domain socket polling URLs.
+const UnixURLScheme = "unix://"
+
+func init() {
+	AddPollerType(PollerTypeUnix, httpGlobalInit, unixInit, unixPoll)
+	SetPollerTypeClose(PollerTypeUnix, unixClose)
+}
+
+// ParseUnixPollURL splits a Unix domain socket polling URL into the path of the socket, and the HTTP path (including any query string) to request over it.
+func ParseUnixPollURL(pollURL string) (string, string, error) {
+	if !strings.HasPrefix(strings.ToLower(pollURL), UnixURLScheme) {
+		return "", "", errors.New("unix polling URL must start with '" + UnixURLScheme + "'")
+	}
+	rest := pollURL[len(UnixURLScheme):]
+	sep := strings.Index(rest, ":")
+	if sep < 0 {
+		return "", "", errors.New("unix polling URL must have the form " + UnixURLScheme + "<socket path>:<HTTP path>")
+	}
+	socketPath := rest[:sep]
+	httpPath := rest[sep+1:]
+	if socketPath == "" {
+		return "", "", errors.New("unix polling URL has no socket path")
+	}
+	if !strings.HasPrefix(httpPath, "/") {
+		return "", "", errors.New("unix polling URL HTTP path must start with '/'")
+	}
+	return socketPath, httpPath, nil
+}
+
+// unixInit creates an HTTP poll context whose client dials the poller's socket, rather than the host in the URL.
+// The context is an HTTPPollCtx, so the stat parsers can use the response headers just as for HTTP polling.
+func unixInit(cfg PollerConfig, globalCtxI interface{}) interface{} {
+	gctx := (globalCtxI).(*HTTPPollGlobalCtx)
+
+	socketPath := cfg.SocketPath
+	dialer := net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+		DisableKeepAlives: cfg.NoKeepAlive,
+	}
+
+	timeout := gctx.Client.Timeout
+	if cfg.Timeout != 0 {
+		timeout = cfg.Timeout
+	}
+
+	return &HTTPPollCtx{
+		Client:           &http.Client{Transport: transport, Timeout: timeout},
+		UserAgent:        gctx.UserAgent,
+		NoKeepAlive:      cfg.NoKeepAlive,
+		PollerID:         cfg.PollerID,
+		FormatAccept:     gctx.FormatAccept,
+		MaxResponseBytes: maxResponseBytes(cfg),
+	}
+}
+
+func unixPoll(ctxI interface{}, url string, host string, pollID uint64) ([]byte, time.Time, time.Duration, error) {
+	_, httpPath, err := ParseUnixPollURL(url)
+	if err != nil {
+		return nil, time.Now(), 0, errors.New("parsing unix polling URL '" + url + "': " + err.Error())
+	}
+	// The host in the request URL is never dialed, the transport always dials the socket.
+	return httpPoll(ctxI, "http://localhost"+httpPath, host, pollID)
+}
+
+// unixClose closes the idle connections to the poller's socket, when the poller is stopped.
+func unixClose(ctxI interface{}) {
+	ctx, ok := ctxI.(*HTTPPollCtx)
+	if !ok {
+		log.Errorf("closing unix poller: expected context type *HTTPPollCtx, actual %T\n", ctxI)
+		return
+	}
+	ctx.Client.CloseIdleConnections()
+}
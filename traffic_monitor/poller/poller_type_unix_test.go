@@ -0,0 +1,102 @@
+package poller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+)
+
+func TestParseUnixPollURL(t *testing.T) {
+	type testCase struct {
+		url        string
+		socketPath string
+		httpPath   string
+		expectErr  bool
+	}
+	testCases := []testCase{
+		{"unix:///var/run/ts.sock:/_astats?application=system", "/var/run/ts.sock", "/_astats?application=system", false},
+		{"UNIX:///ts.sock:/_stats", "/ts.sock", "/_stats", false},
+		{"http://localhost/_astats", "", "", true},
+		{"unix:///var/run/ts.sock", "", "", true},
+		{"unix://:/_astats", "", "", true},
+		{"unix:///ts.sock:_astats", "", "", true},
+	}
+	for _, tc := range testCases {
+		socketPath, httpPath, err := ParseUnixPollURL(tc.url)
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("parsing '%s' - expected: error, actual: nil", tc.url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsing '%s' - expected: no error, actual: %v", tc.url, err)
+			continue
+		}
+		if socketPath != tc.socketPath || httpPath != tc.httpPath {
+			t.Errorf("parsing '%s' - expected: '%s' '%s', actual: '%s' '%s'", tc.url, tc.socketPath, tc.httpPath, socketPath, httpPath)
+		}
+	}
+}
+
+func TestUnixPoll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tm-unix-poll")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "stats.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listening on unix socket: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(r.Host + " " + r.URL.RequestURI()))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	cfg := config.DefaultConfig
+	gctx := httpGlobalInit(cfg, config.StaticAppData{UserAgent: "test"})
+	ctx := unixInit(PollerConfig{Timeout: time.Second, PollerID: "edge", SocketPath: socketPath}, gctx)
+
+	bts, _, _, err := unixPoll(ctx, "unix://"+socketPath+":/_astats?application=system", "edge.test", 1)
+	if err != nil {
+		t.Fatalf("polling unix socket - expected: no error, actual: %v", err)
+	}
+	if expected := "edge.test /_astats?application=system"; string(bts) != expected {
+		t.Errorf("polling unix socket - expected response '%s', actual: '%s'", expected, string(bts))
+	}
+	if contentType := ctx.(*HTTPPollCtx).HTTPHeader.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("polling unix socket - expected Content-Type header 'application/json', actual: '%s'", contentType)
+	}
+
+	unixClose(ctx)
+}
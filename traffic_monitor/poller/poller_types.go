@@ -32,13 +32,18 @@ type PollerType struct {
 	GlobalInit PollerGlobalInitFunc
 	Init       PollerInitFunc
 	Poll       PollerFunc
+	Close      PollerCloseFunc
 }
 
 // PollerConfig is the data given to cache pollers when they're initialized.
 type PollerConfig struct {
-	Timeout     time.Duration
-	NoKeepAlive bool
-	PollerID    string
+	Timeout          time.Duration
+	NoKeepAlive      bool
+	PollerID         string
+	SocketPath       string
+	MaxResponseBytes int64  // if not zero, overrides DefaultMaxResponseBytes
+	MaxRedirects     int    // the number of HTTP redirects followed; if zero, none are
+	RedirectHosts    string // comma-separated hosts, besides the polled host, redirects may be followed to
 }
 
 // PollerGlobalInit performs global initialization, and returns a global context object.
@@ -67,6 +72,16 @@ func AddPollerType(name string, globalInit PollerGlobalInitFunc, init PollerInit
 	pollers[name] = PollerType{GlobalInit: globalInit, Init: init, Poll: poller}
 }
 
+// PollerCloseFunc releases any resources held by the poller-specific context created by the poller's Init, when the poller is stopped.
+type PollerCloseFunc func(ctx interface{})
+
+// SetPollerTypeClose sets the func to call with a poller's context when the poller of the given type is stopped. This MUST only be called on startup, after AddPollerType.
+func SetPollerTypeClose(name string, closer PollerCloseFunc) {
+	pollerType := pollers[name]
+	pollerType.Close = closer
+	pollers[name] = pollerType
+}
+
 // GetGlobalContexts returns the global contexts corresponding to the registered pollers
 func GetGlobalContexts(cfg config.Config, appData config.StaticAppData) map[string]interface{} {
 
@@ -110,9 +110,15 @@ function getTrafficOpsUri() {
 function getTrafficOpsCdn() {
 	const cdnName = document.getElementById("cdn-name");
 	const discIconContainer = document.getElementById("icon-disc-holder");
+	const discIconTooltip = document.getElementById("icon-disc-tooltip");
 	ajax("/publish/ConfigDoc", function(r) {
 		let opsConfig = JSON.parse(r);
 		cdnName.textContent = opsConfig.cdnName || "unknown";
+		if (opsConfig.usingOfflineSnapshot === true) {
+			discIconTooltip.textContent = "Traffic Monitor is running offline from the snapshot in " + opsConfig.offlineSnapshotDir;
+		} else {
+			discIconTooltip.textContent = "Traffic Monitor is using a disk backup of Traffic Ops";
+		}
 		if (opsConfig.usingDummyTO === false) {
 		    discIconContainer.hidden = true;
 		} else {
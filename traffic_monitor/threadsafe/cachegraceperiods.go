@@ -0,0 +1,112 @@
+package threadsafe
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// CacheGracePeriods tracks the startup grace period of each cache, which starts when the cache's poll is added and ends
+// when the cache is first seen to be available, or when the grace period elapses. While a cache is in its grace period,
+// it isn't marked down for lacking a previous result, nor for failing to be polled, so newly-added caches aren't briefly
+// marked down before their first successful poll. It is threadsafe for multiple readers and writers.
+type CacheGracePeriods struct {
+	period time.Duration
+	known  map[tc.CacheName]struct{}
+	starts map[tc.CacheName]time.Time
+	m      *sync.RWMutex
+}
+
+// NewCacheGracePeriods returns a new CacheGracePeriods with the given grace period. If the period is zero, no cache is
+// ever in its grace period.
+func NewCacheGracePeriods(period time.Duration) CacheGracePeriods {
+	return CacheGracePeriods{
+		period: period,
+		known:  map[tc.CacheName]struct{}{},
+		starts: map[tc.CacheName]time.Time{},
+		m:      &sync.RWMutex{},
+	}
+}
+
+// PollAdded starts the grace period of the given cache, if its poll has not been added before. Polls re-added for an
+// existing cache, e.g. because the polling interval changed, do not restart its grace period.
+func (t CacheGracePeriods) PollAdded(id string) {
+	if t.period <= 0 {
+		return
+	}
+	cache := tc.CacheName(id)
+	t.m.Lock()
+	defer t.m.Unlock()
+	if _, ok := t.known[cache]; ok {
+		return
+	}
+	t.known[cache] = struct{}{}
+	t.starts[cache] = time.Now()
+}
+
+// SetCaches removes all caches not in the given set, so that a cache which is removed and later re-added gets a new
+// grace period.
+func (t CacheGracePeriods) SetCaches(caches map[tc.CacheName]struct{}) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	for cache := range t.known {
+		if _, ok := caches[cache]; !ok {
+			delete(t.known, cache)
+			delete(t.starts, cache)
+		}
+	}
+}
+
+// Available ends the grace period of the given cache, because it has been seen to be available.
+func (t CacheGracePeriods) Available(cache tc.CacheName) {
+	t.m.RLock()
+	_, ok := t.starts[cache]
+	t.m.RUnlock()
+	if !ok {
+		return
+	}
+	t.m.Lock()
+	delete(t.starts, cache)
+	t.m.Unlock()
+}
+
+// InGracePeriod returns whether the given cache is in its startup grace period.
+func (t CacheGracePeriods) InGracePeriod(cache tc.CacheName) bool {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	start, ok := t.starts[cache]
+	return ok && time.Since(start) < t.period
+}
+
+// Remaining returns the remaining grace period of every cache in its grace period.
+func (t CacheGracePeriods) Remaining() map[tc.CacheName]time.Duration {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	remaining := map[tc.CacheName]time.Duration{}
+	for cache, start := range t.starts {
+		if left := t.period - time.Since(start); left > 0 {
+			remaining[cache] = left
+		}
+	}
+	return remaining
+}
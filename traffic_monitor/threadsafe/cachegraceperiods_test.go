@@ -0,0 +1,75 @@
+package threadsafe
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+func TestCacheGracePeriods(t *testing.T) {
+	gracePeriods := NewCacheGracePeriods(time.Hour)
+	cache := tc.CacheName("cache0")
+
+	if gracePeriods.InGracePeriod(cache) {
+		t.Error("expected a cache whose poll was never added to not be in its grace period")
+	}
+
+	gracePeriods.PollAdded(string(cache))
+	if !gracePeriods.InGracePeriod(cache) {
+		t.Error("expected a newly-added cache to be in its grace period")
+	}
+	if remaining, ok := gracePeriods.Remaining()[cache]; !ok || remaining <= 0 || remaining > time.Hour {
+		t.Errorf("expected remaining grace period in (0, 1h], actual: %v (present: %t)", remaining, ok)
+	}
+
+	gracePeriods.Available(cache)
+	if gracePeriods.InGracePeriod(cache) {
+		t.Error("expected an available cache to no longer be in its grace period")
+	}
+	if _, ok := gracePeriods.Remaining()[cache]; ok {
+		t.Error("expected an available cache to have no remaining grace period")
+	}
+
+	gracePeriods.PollAdded(string(cache))
+	if gracePeriods.InGracePeriod(cache) {
+		t.Error("expected re-adding an existing cache's poll to not restart its grace period")
+	}
+
+	gracePeriods.SetCaches(map[tc.CacheName]struct{}{})
+	gracePeriods.PollAdded(string(cache))
+	if !gracePeriods.InGracePeriod(cache) {
+		t.Error("expected a removed and re-added cache to get a new grace period")
+	}
+}
+
+func TestCacheGracePeriodsDisabled(t *testing.T) {
+	gracePeriods := NewCacheGracePeriods(0)
+	cache := tc.CacheName("cache0")
+	gracePeriods.PollAdded(string(cache))
+	if gracePeriods.InGracePeriod(cache) {
+		t.Error("expected no grace period when the grace period is zero")
+	}
+	if len(gracePeriods.Remaining()) != 0 {
+		t.Errorf("expected no remaining grace periods when the grace period is zero, actual: %v", gracePeriods.Remaining())
+	}
+}
@@ -0,0 +1,66 @@
+package threadsafe
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"sync"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// PollingAssignmentData is the assignment of the cache groups to be polled to the Traffic Monitor groups, as computed
+// from a monitoring config.
+type PollingAssignmentData struct {
+	// TMGroup is the group of this Traffic Monitor.
+	TMGroup string
+	// CacheGroups is the cache groups assigned to each Traffic Monitor group. Without distributed polling, all cache
+	// groups are assigned to this Traffic Monitor's group.
+	CacheGroups map[string][]string
+	// Caches is the cache group of each cache which is expected to be polled by some Traffic Monitor.
+	Caches map[tc.CacheName]string
+}
+
+// PollingAssignment is the latest PollingAssignmentData, which is threadsafe for multiple readers and one writer.
+type PollingAssignment struct {
+	assignment *PollingAssignmentData
+	m          *sync.RWMutex
+}
+
+// NewPollingAssignment returns a new, empty PollingAssignment.
+func NewPollingAssignment() PollingAssignment {
+	return PollingAssignment{
+		assignment: &PollingAssignmentData{CacheGroups: map[string][]string{}, Caches: map[tc.CacheName]string{}},
+		m:          &sync.RWMutex{},
+	}
+}
+
+// Get returns the latest assignment. The returned maps MUST NOT be modified.
+func (t PollingAssignment) Get() PollingAssignmentData {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return *t.assignment
+}
+
+// Set sets the latest assignment. The given maps MUST NOT be modified after Set is called.
+func (t PollingAssignment) Set(assignment PollingAssignmentData) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	*t.assignment = assignment
+}
@@ -0,0 +1,54 @@
+package threadsafe
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Time provides safe access for multiple goroutines readers and a single writer to a stored time.
+type Time struct {
+	val *int64
+}
+
+// NewTime returns a new single-writer-multiple-reader threadsafe time, initially the zero time.
+func NewTime() Time {
+	v := int64(0)
+	return Time{val: &v}
+}
+
+// Get gets the internal time. If the time has never been set, the zero time is returned.
+func (t *Time) Get() time.Time {
+	v := atomic.LoadInt64(t.val)
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, v)
+}
+
+// Set sets the internal time. This MUST NOT be called by multiple goroutines.
+func (t *Time) Set(v time.Time) {
+	if v.IsZero() {
+		atomic.StoreInt64(t.val, 0)
+		return
+	}
+	atomic.StoreInt64(t.val, v.UnixNano())
+}
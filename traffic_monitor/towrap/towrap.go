@@ -30,6 +30,7 @@ import (
 	"net/http/cookiejar"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"time"
@@ -46,6 +47,13 @@ import (
 
 const localHostIP = "127.0.0.1"
 
+// OfflineCRConfigFileName and OfflineTMConfigFileName are the names of the
+// CDN Snapshot and monitoring config files in an offline snapshot directory.
+const (
+	OfflineCRConfigFileName = "crconfig.json"
+	OfflineTMConfigFileName = "monitoring.json"
+)
+
 // ErrNilSession is the error returned by operations performed on a nil session.
 var ErrNilSession = errors.New("nil session")
 
@@ -200,6 +208,7 @@ type TrafficOpsSessionThreadsafe struct {
 	m                  *sync.Mutex
 	lastCRConfig       ByteMapCache
 	crConfigHist       CRConfigHistoryThreadsafe
+	offlineDir         *string
 	CRConfigBackupFile string
 	TMConfigBackupFile string
 }
@@ -213,6 +222,7 @@ func NewTrafficOpsSessionThreadsafe(s *client.Session, ls *legacyClient.Session,
 		crConfigHist:       NewCRConfigHistoryThreadsafe(histLimit),
 		lastCRConfig:       NewByteMapCache(),
 		m:                  &sync.Mutex{},
+		offlineDir:         new(string),
 		session:            &s,
 		legacySession:      &ls,
 		TMConfigBackupFile: cfg.TMConfigBackupFile,
@@ -223,6 +233,9 @@ func NewTrafficOpsSessionThreadsafe(s *client.Session, ls *legacyClient.Session,
 // Initialized tells whether or not the TrafficOpsSessionThreadsafe has been
 // properly initialized with non-nil sessions.
 func (s TrafficOpsSessionThreadsafe) Initialized() bool {
+	if s.OfflineSnapshotDir() != "" {
+		return true
+	}
 	return s.session != nil && *s.session != nil && s.legacySession != nil && *s.legacySession != nil
 }
 
@@ -308,6 +321,27 @@ func (s *TrafficOpsSessionThreadsafe) setLegacySession(url, username, password s
 	return nil
 }
 
+// SetOfflineSnapshotDir makes the session read the CDN Snapshot and monitoring
+// config from the OfflineCRConfigFileName and OfflineTMConfigFileName files in
+// dir, instead of requesting them from Traffic Ops. An empty dir goes back to
+// using Traffic Ops.
+func (s TrafficOpsSessionThreadsafe) SetOfflineSnapshotDir(dir string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	*s.offlineDir = dir
+}
+
+// OfflineSnapshotDir returns the offline snapshot directory set by
+// SetOfflineSnapshotDir, or the empty string if Traffic Ops is being used.
+func (s TrafficOpsSessionThreadsafe) OfflineSnapshotDir() string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.offlineDir == nil {
+		return ""
+	}
+	return *s.offlineDir
+}
+
 // getThreadsafeSession is used internally to get a copy of the session pointer,
 // or nil if it doesn't exist. This should not be used outside
 // TrafficOpsSessionThreadsafe, and never stored, because part of the purpose of
@@ -395,6 +429,15 @@ func (s TrafficOpsSessionThreadsafe) CRConfigRaw(cdn string) ([]byte, error) {
 	var configBytes []byte
 	json := jsoniter.ConfigFastest
 
+	// オフラインスナップショットが指定されている場合にはTraffic Opsにアクセスせず、バックアップも上書きしない
+	if dir := s.OfflineSnapshotDir(); dir != "" {
+		configBytes, err = ioutil.ReadFile(filepath.Join(dir, OfflineCRConfigFileName))
+		if err != nil {
+			return nil, fmt.Errorf("reading offline CRConfig snapshot: %v", err)
+		}
+		return s.setCRConfig(cdn, configBytes, nil, localHostIP)
+	}
+
 	ss := s.get()
 	if ss == nil {
 		return nil, ErrNilSession
@@ -453,8 +496,17 @@ func (s TrafficOpsSessionThreadsafe) CRConfigRaw(cdn string) ([]byte, error) {
 		}
 	}
 
+	return s.setCRConfig(cdn, configBytes, crConfig, remoteAddr)
+}
+
+// setCRConfig validates the given CRConfig bytes, which are unmarshalled if
+// crConfig is nil, records them in the CRConfig history, and stores them as the
+// last CRConfig of the CDN if they're valid.
+func (s TrafficOpsSessionThreadsafe) setCRConfig(cdn string, configBytes []byte, crConfig *tc.CRConfig, remoteAddr string) ([]byte, error) {
+	var err error
+	json := jsoniter.ConfigFastest
+
 	hist := &CRConfigStat{
-		Err:     err,
 		ReqAddr: remoteAddr,
 		ReqTime: time.Now(),
 		Stats:   tc.CRConfigStats{},
@@ -462,6 +514,7 @@ func (s TrafficOpsSessionThreadsafe) CRConfigRaw(cdn string) ([]byte, error) {
 	defer s.crConfigHist.Add(hist)
 
 	if crConfig == nil {
+		crConfig = &tc.CRConfig{}
 		if err = json.Unmarshal(configBytes, crConfig); err != nil {
 			err = errors.New("invalid JSON: " + err.Error())
 			hist.Err = err
@@ -535,6 +588,14 @@ func (s TrafficOpsSessionThreadsafe) trafficMonitorConfigMapRaw(cdn string) (*tc
 	var configMap *tc.TrafficMonitorConfigMap
 	var err error
 
+	if dir := s.OfflineSnapshotDir(); dir != "" {
+		configMap, err = readTMConfigFile(filepath.Join(dir, OfflineTMConfigFileName))
+		if err != nil {
+			return nil, errors.New("reading offline monitoring config snapshot: " + err.Error())
+		}
+		return configMap, nil
+	}
+
 	// 「/cdns/<cdn>/configs/monitoring」(GET)から取得する
 	config, err = s.fetchTMConfig(cdn)
 	if err != nil {
@@ -567,19 +628,13 @@ func (s TrafficOpsSessionThreadsafe) trafficMonitorConfigMapRaw(cdn string) (*tc
 
 		log.Errorln("using backup file for monitoring config snapshot due to invalid monitoring config snapshot from Traffic Ops: " + err.Error())
 
-		b, err := ioutil.ReadFile(s.TMConfigBackupFile) // 設定ファイル中の`tmconfig_backup_file`に指定されている値
+		// TrafficOpsAPIからではなく、バックアップで保存しておいたファイルからオブジェクトにマッピングさせる
+		// 設定ファイル中の`tmconfig_backup_file`に指定されている値
+		configMap, err = readTMConfigFile(s.TMConfigBackupFile)
 		if err != nil {
 			return nil, errors.New("reading TMConfigBackupFile: " + err.Error())
 		}
-
-		json := jsoniter.ConfigFastest
-		var tmConfig tc.TrafficMonitorConfig
-		if err := json.Unmarshal(b, &tmConfig); err != nil {
-			return nil, errors.New("unmarshalling backup file monitoring.json: " + err.Error())
-		}
-
-		// TrafficOpsAPIからではなく、バックアップで保存しておいたファイルからオブジェクトにマッピングさせる
-		return tc.TrafficMonitorTransformToMap(&tmConfig)
+		return configMap, nil
 	}
 
 	// jsoniter.ConfigFastestを利用すると、6桁の精度（非可逆）でfloatをマーシャリングするので、大幅に高速化されます。
@@ -596,6 +651,22 @@ func (s TrafficOpsSessionThreadsafe) trafficMonitorConfigMapRaw(cdn string) (*tc
 	return configMap, err
 }
 
+// readTMConfigFile reads a monitoring config, as returned by Traffic Ops, from
+// the given file.
+func readTMConfigFile(path string) (*tc.TrafficMonitorConfigMap, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	json := jsoniter.ConfigFastest
+	var tmConfig tc.TrafficMonitorConfig
+	if err := json.Unmarshal(b, &tmConfig); err != nil {
+		return nil, errors.New("unmarshalling " + path + ": " + err.Error())
+	}
+	return tc.TrafficMonitorTransformToMap(&tmConfig)
+}
+
 // TrafficMonitorConfigMap returns the Traffic Monitor config map from the
 // Traffic Ops. This is safe for multiple goroutines.
 func (s TrafficOpsSessionThreadsafe) TrafficMonitorConfigMap(cdn string) (*tc.TrafficMonitorConfigMap, error) {
@@ -707,6 +778,11 @@ func (s TrafficOpsSessionThreadsafe) MonitorCDN(hostName string) (string, error)
 	var server tc.ServerV40
 	var err error
 
+	// オフラインスナップショットの場合にはCRConfigのCDN名を利用する
+	if dir := s.OfflineSnapshotDir(); dir != "" {
+		return offlineSnapshotCDN(dir)
+	}
+
 	server, err = s.fetchServerByHostname(hostName)
 	if err != nil {
 		log.Warnln("getting server by hostname '" + hostName + "' using up-to-date client: " + err.Error() + ". Retrying with legacy client")
@@ -721,3 +797,22 @@ func (s TrafficOpsSessionThreadsafe) MonitorCDN(hostName string) (string, error)
 	// return an error in that case
 	return *server.CDNName, nil
 }
+
+// offlineSnapshotCDN returns the name of the CDN of the CDN Snapshot in the
+// offline snapshot directory dir.
+func offlineSnapshotCDN(dir string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, OfflineCRConfigFileName))
+	if err != nil {
+		return "", fmt.Errorf("reading offline CRConfig snapshot: %v", err)
+	}
+
+	json := jsoniter.ConfigFastest
+	crConfig := tc.CRConfig{}
+	if err := json.Unmarshal(b, &crConfig); err != nil {
+		return "", fmt.Errorf("unmarshalling offline CRConfig snapshot: %v", err)
+	}
+	if crConfig.Stats.CDNName == nil || *crConfig.Stats.CDNName == "" {
+		return "", errors.New("offline CRConfig snapshot has no CDN name")
+	}
+	return *crConfig.Stats.CDNName, nil
+}
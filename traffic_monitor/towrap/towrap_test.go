@@ -20,6 +20,9 @@ package towrap
  */
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -35,3 +38,68 @@ func TestTrafficOpsSessionThreadsafeUpdateSetsNonNilSessions(t *testing.T) {
 		t.Errorf("expected non-nil sessions after getting error from Update()")
 	}
 }
+
+func TestTrafficOpsSessionThreadsafeOfflineSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	crConfig := `{"stats":{"CDN_name":"cdn1","date":1600000000},"contentServers":{"edge1":{"cacheGroup":"cg1","status":"REPORTED"}}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, OfflineCRConfigFileName), []byte(crConfig), 0644); err != nil {
+		t.Fatalf("writing CRConfig snapshot: %v", err)
+	}
+	tmConfig := `{
+		"trafficServers": [{"hostName": "edge1", "cachegroup": "cg1", "profile": "EDGE", "status": "REPORTED"}],
+		"cacheGroups": [{"name": "cg1"}],
+		"config": {"peers.polling.interval": 1000, "health.polling.interval": 6000},
+		"trafficMonitors": [{"hostName": "tm1", "cachegroup": "cg1", "status": "ONLINE"}],
+		"deliveryServices": [{"xmlId": "ds1", "status": "REPORTED"}],
+		"profiles": [{"name": "EDGE", "type": "EDGE"}]
+	}`
+	if err := ioutil.WriteFile(filepath.Join(dir, OfflineTMConfigFileName), []byte(tmConfig), 0644); err != nil {
+		t.Fatalf("writing monitoring config snapshot: %v", err)
+	}
+
+	backupDir := t.TempDir()
+	s := NewTrafficOpsSessionThreadsafe(nil, nil, 5, config.Config{
+		CRConfigBackupFile: filepath.Join(backupDir, "crconfig.backup"),
+		TMConfigBackupFile: filepath.Join(backupDir, "tmconfig.backup"),
+	})
+	if s.Initialized() {
+		t.Fatal("expected a session without Traffic Ops sessions or an offline snapshot to not be initialized")
+	}
+
+	s.SetOfflineSnapshotDir(dir)
+	if !s.Initialized() {
+		t.Error("expected a session with an offline snapshot to be initialized")
+	}
+
+	cdn, err := s.MonitorCDN("tm1")
+	if err != nil {
+		t.Fatalf("unexpected error getting monitor CDN: %v", err)
+	}
+	if cdn != "cdn1" {
+		t.Errorf("expected monitor CDN 'cdn1', got '%s'", cdn)
+	}
+
+	if _, err := s.CRConfigRaw(cdn); err != nil {
+		t.Errorf("unexpected error getting CRConfig: %v", err)
+	}
+	if b, _, err := s.LastCRConfig(cdn); err != nil {
+		t.Errorf("unexpected error getting last CRConfig: %v", err)
+	} else if string(b) != crConfig {
+		t.Errorf("expected last CRConfig to be the snapshot, got %s", string(b))
+	}
+
+	mc, err := s.TrafficMonitorConfigMap(cdn)
+	if err != nil {
+		t.Fatalf("unexpected error getting monitoring config: %v", err)
+	}
+	if _, ok := mc.TrafficServer["edge1"]; !ok {
+		t.Errorf("expected monitoring config to contain cache server 'edge1', got %+v", mc.TrafficServer)
+	}
+
+	if s.BackupFileExists() {
+		t.Error("expected no backup files to be written from an offline snapshot")
+	}
+	if _, err := os.Stat(s.CRConfigBackupFile); !os.IsNotExist(err) {
+		t.Errorf("expected no CRConfig backup file, got: %v", err)
+	}
+}
@@ -80,6 +80,7 @@ func main() {
 	//
 	opsConfigFile := flag.String("opsCfg", "", "The traffic ops config file")            // --opsCfgオプション
 	configFileName := flag.String("config", "", "The Traffic Monitor config file path")  // --configオプション
+	offlineSnapshotDir := flag.String("offlineSnapshot", "", "A directory containing a CDN Snapshot (crconfig.json) and monitoring config (monitoring.json) to run offline from, instead of Traffic Ops")  // --offlineSnapshotオプション
 	flag.Parse()
 
 	// --opsCfgが指定されていなければエラー
@@ -119,7 +120,7 @@ func main() {
 	log.Infof("Starting with config %+v\n", cfg)
 
 	// traffic_monitorのメイン処理
-	err = manager.Start(*opsConfigFile, cfg, staticData, *configFileName)
+	err = manager.Start(*opsConfigFile, cfg, staticData, *configFileName, *offlineSnapshotDir)
 	if err != nil {
 		fmt.Printf("Error starting service: failed to start managers: %v\n", err)
 		os.Exit(1)
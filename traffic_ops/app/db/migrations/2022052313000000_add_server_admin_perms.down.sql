@@ -0,0 +1,30 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with this
+ * work for additional information regarding copyright ownership.  The ASF
+ * licenses this file to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+DELETE FROM public.role_capability
+WHERE cap_name IN (
+	VALUES
+		('BACKEND-ROUTE:READ'),
+		('MAINTENANCE:READ'),
+		('MAINTENANCE:UPDATE'),
+		('READ_ONLY:READ'),
+		('READ_ONLY:UPDATE'),
+		('API-ROUTE:READ'),
+		('PROFILING:CREATE'),
+		('PROFILING:READ'),
+		('PROFILING:UPDATE')
+);
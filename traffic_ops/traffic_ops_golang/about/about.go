@@ -35,6 +35,9 @@ type about struct {
 	Name       string `json:"name,omitempty"`
 	RPMVersion string `json:"RPMVersion,omitempty"`
 	Version    string `json:"Version,omitempty"`
+	// ConfigFingerprint is the hash of the redacted effective config, to
+	// confirm every instance is running the same config.
+	ConfigFingerprint string `json:"configFingerprint,omitempty"`
 }
 
 // About contains version info to be exposed by `api/.../about.json` endpoint
@@ -74,6 +77,12 @@ func SetAbout(s string) {
 	}
 }
 
+// SetConfigFingerprint is called by main.main to store the fingerprint of the
+// config Traffic Ops was started with, for the .../about endpoint.
+func SetConfigFingerprint(fingerprint string) {
+	About.ConfigFingerprint = fingerprint
+}
+
 // Handler returns info about running Traffic Ops
 func Handler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
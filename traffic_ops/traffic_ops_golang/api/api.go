@@ -528,6 +528,8 @@ type APIInfo struct {
 //
 // Close() must be called to free resources, and should be called in a defer immediately after NewInfo(), to finish the transaction.
 //
+// The transaction is bound to the request's context, so its queries are canceled, and the transaction rolled back, when the client disconnects or the request times out, as well as after the configured db_query_timeout_seconds. If the request is already canceled or timed out, NewInfo returns a 503 Service Unavailable.
+//
 // Example:
 //  func handler(w http.ResponseWriter, r *http.Request) {
 //    inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
@@ -579,7 +581,12 @@ func NewInfo(r *http.Request, requiredParams []string, intParamNames []string) (
 	dbCtx, cancelTx := context.WithTimeout(r.Context(), time.Duration(cfg.DBQueryTimeoutSeconds)*time.Second) //only place we could call cancel here is in APIInfo.Close(), which already will rollback the transaction (which is all cancel will do.)
 	tx, err := db.BeginTxx(dbCtx, nil)                                                                        // must be last, MUST not return an error if this succeeds, without closing the tx
 	if err != nil {
-		return &APIInfo{Tx: &sqlx.Tx{}, CancelTx: cancelTx}, userErr, errors.New("could not begin transaction: " + err.Error()), http.StatusInternalServerError
+		errCode := http.StatusInternalServerError
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			// the client disconnected or the request timed out before the transaction began
+			errCode = http.StatusServiceUnavailable
+		}
+		return &APIInfo{Tx: &sqlx.Tx{}, CancelTx: cancelTx}, userErr, fmt.Errorf("could not begin transaction: %w", err), errCode
 	}
 	return &APIInfo{
 		Config:    cfg,
@@ -1104,29 +1111,15 @@ func GetUserFromReq(w http.ResponseWriter, r *http.Request, secret string) (auth
 	if username == "" {
 		return auth.CurrentUser{}, errors.New("unauthorized, please log in."), nil, http.StatusUnauthorized
 	}
-	db := (*sqlx.DB)(nil)
-	val := r.Context().Value(DBContextKey)
-	if val == nil {
-		return auth.CurrentUser{}, nil, errors.New("request context db missing"), http.StatusInternalServerError
-	}
-	switch v := val.(type) {
-	case *sqlx.DB:
-		db = v
-	default:
-		return auth.CurrentUser{}, nil, fmt.Errorf("request context db unknown type %T", val), http.StatusInternalServerError
+	user, userErr, sysErr, code := GetUserByName(r, username)
+	if userErr != nil || sysErr != nil {
+		return auth.CurrentUser{}, userErr, sysErr, code
 	}
-
 	cfg, err := GetConfig(r.Context())
 	if err != nil {
 		return auth.CurrentUser{}, nil, errors.New("request context config missing"), http.StatusInternalServerError
 	}
 
-	// PostgreSQL中のDBから対象のユーザーが権限を保持してるかを確認する
-	user, userErr, sysErr, code := auth.GetCurrentUserFromDB(db, username, time.Duration(cfg.DBQueryTimeoutSeconds)*time.Second)
-	if userErr != nil || sysErr != nil {
-		return auth.CurrentUser{}, userErr, sysErr, code
-	}
-
 	duration := tocookie.DefaultDuration
 	newCookie := tocookie.GetCookie(oldCookie.AuthData, duration, secret)
 	http.SetCookie(w, newCookie)
@@ -1155,6 +1148,32 @@ func GetUserFromReq(w http.ResponseWriter, r *http.Request, secret string) (auth
 	return user, nil, nil, http.StatusOK
 }
 
+// GetUserByName returns the user with the given username from the database of
+// the request context, for requests which were authenticated by other means
+// than a cookie or token, along with any user error, any system error, and an
+// error code to be returned if either error was not nil.
+func GetUserByName(r *http.Request, username string) (auth.CurrentUser, error, error, int) {
+	db := (*sqlx.DB)(nil)
+	val := r.Context().Value(DBContextKey)
+	if val == nil {
+		return auth.CurrentUser{}, nil, errors.New("request context db missing"), http.StatusInternalServerError
+	}
+	switch v := val.(type) {
+	case *sqlx.DB:
+		db = v
+	default:
+		return auth.CurrentUser{}, nil, fmt.Errorf("request context db unknown type %T", val), http.StatusInternalServerError
+	}
+
+	cfg, err := GetConfig(r.Context())
+	if err != nil {
+		return auth.CurrentUser{}, nil, errors.New("request context config missing"), http.StatusInternalServerError
+	}
+
+	// PostgreSQL中のDBから対象のユーザーが権限を保持してるかを確認する
+	return auth.GetCurrentUserFromDB(r.Context(), db, username, time.Duration(cfg.DBQueryTimeoutSeconds)*time.Second)
+}
+
 func getCookieFromAccessToken(bearerToken string, secret string) (*http.Cookie, jwt.Token, error) {
 
 	var cookie *http.Cookie
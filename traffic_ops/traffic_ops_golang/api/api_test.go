@@ -21,16 +21,24 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
 	"github.com/lib/pq"
 
 	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/trafficvault"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/trafficvault/backends/disabled"
+
+	"github.com/jmoiron/sqlx"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
 )
 
 func TestCamelCase(t *testing.T) {
@@ -250,3 +258,44 @@ func TestParseRestrictFKConstraint(t *testing.T) {
 		})
 	}
 }
+
+// TestNewInfoCanceledRequest tests that the transaction of a request that was
+// canceled, e.g. by the client disconnecting, is not begun.
+func TestNewInfoCanceledRequest(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDB.Close()
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = context.WithValue(ctx, auth.CurrentUserKey, auth.CurrentUser{UserName: "username", ID: 1, PrivLevel: auth.PrivLevelAdmin})
+	ctx = context.WithValue(ctx, DBContextKey, db)
+	ctx = context.WithValue(ctx, ConfigContextKey, &cfg)
+	ctx = context.WithValue(ctx, ReqIDContextKey, uint64(0))
+	ctx = context.WithValue(ctx, PathParamsKey, map[string]string{})
+	var tv trafficvault.TrafficVault = &disabled.Disabled{}
+	ctx = context.WithValue(ctx, TrafficVaultContextKey, tv)
+	r := httptest.NewRequest(http.MethodGet, "/api/4.0/servers", nil).WithContext(ctx)
+
+	mock.ExpectBegin()
+	cancel()
+
+	inf, userErr, sysErr, errCode := NewInfo(r, nil, nil)
+	if userErr != nil {
+		t.Errorf("expected no user error, actual: %v", userErr)
+	}
+	if !errors.Is(sysErr, context.Canceled) {
+		t.Errorf("expected a context canceled system error, actual: %v", sysErr)
+	}
+	if errCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, actual: %d", http.StatusServiceUnavailable, errCode)
+	}
+	if inf.Tx == nil || inf.Tx.Tx != nil {
+		t.Error("expected a non-nil APIInfo.Tx with a nil Tx.Tx")
+	}
+	inf.CancelTx()
+}
@@ -0,0 +1,108 @@
+package api
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// ContentETag returns a strong ETag of the given content, as the complete
+// header value including quotes. The ETag only changes when the content does,
+// so it may be used for generated content which has no last modified time.
+func ContentETag(content ...[]byte) string {
+	h := sha256.New()
+	for _, c := range content {
+		h.Write(c)
+		// separates the parts, so moving bytes between them changes the ETag
+		h.Write([]byte{0})
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// WriteNotModified sets the ETag header of the response to etag and, if it
+// matches the request's If-None-Match header, writes a 304 Not Modified
+// response and returns true, in which case the caller must not write the body.
+//
+// The ETag must be computed before the body is serialized, so unchanged
+// content isn't serialized at all. The 304 response is counted in the
+// not-modified metrics of the named config, along with size, the number of
+// bytes of the body which wasn't sent.
+func WriteNotModified(w http.ResponseWriter, r *http.Request, etag string, config string, size int) bool {
+	w.Header().Set(rfc.ETagHeader, etag)
+	ifNoneMatch := r.Header.Get(rfc.IfNoneMatch)
+	if ifNoneMatch == "" || !rfc.ETagMatches(ifNoneMatch, etag) {
+		return false
+	}
+	setRespWritten(r)
+	w.WriteHeader(http.StatusNotModified)
+
+	counter := getNotModifiedCounter(config)
+	atomic.AddUint64(&counter.Responses, 1)
+	atomic.AddUint64(&counter.Bytes, uint64(size))
+	return true
+}
+
+// NotModifiedCount is the number of 304 Not Modified responses served for a
+// config, and the number of bytes of the bodies they didn't send.
+type NotModifiedCount struct {
+	Config    string
+	Responses uint64
+	Bytes     uint64
+}
+
+var notModifiedCounters = struct {
+	sync.Mutex
+	m map[string]*NotModifiedCount
+}{m: map[string]*NotModifiedCount{}}
+
+func getNotModifiedCounter(config string) *NotModifiedCount {
+	notModifiedCounters.Lock()
+	defer notModifiedCounters.Unlock()
+	counter, ok := notModifiedCounters.m[config]
+	if !ok {
+		counter = &NotModifiedCount{Config: config}
+		notModifiedCounters.m[config] = counter
+	}
+	return counter
+}
+
+// NotModifiedCounts returns the number of 304 Not Modified responses served
+// by WriteNotModified for each config, sorted by config.
+func NotModifiedCounts() []NotModifiedCount {
+	notModifiedCounters.Lock()
+	counts := make([]NotModifiedCount, 0, len(notModifiedCounters.m))
+	for _, counter := range notModifiedCounters.m {
+		counts = append(counts, NotModifiedCount{
+			Config:    counter.Config,
+			Responses: atomic.LoadUint64(&counter.Responses),
+			Bytes:     atomic.LoadUint64(&counter.Bytes),
+		})
+	}
+	notModifiedCounters.Unlock()
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Config < counts[j].Config })
+	return counts
+}
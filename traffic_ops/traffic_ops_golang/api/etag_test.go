@@ -0,0 +1,89 @@
+package api
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+func TestContentETag(t *testing.T) {
+	etag := ContentETag([]byte(`{"a":1}`))
+	if etag != ContentETag([]byte(`{"a":1}`)) {
+		t.Errorf("expected the ETag of the same content to be the same")
+	}
+	if etag == ContentETag([]byte(`{"a":2}`)) {
+		t.Errorf("expected the ETag of different content to differ")
+	}
+	if ContentETag([]byte("ab"), []byte("c")) == ContentETag([]byte("a"), []byte("bc")) {
+		t.Errorf("expected the ETags of differently split content to differ")
+	}
+	if len(etag) != 34 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		t.Errorf("expected a quoted ETag, actual: %s", etag)
+	}
+}
+
+func TestWriteNotModified(t *testing.T) {
+	etag := ContentETag([]byte("config"))
+	before := notModifiedCount("test-config")
+
+	r := httptest.NewRequest(http.MethodGet, "/api/4.0/config", nil)
+	w := httptest.NewRecorder()
+	if WriteNotModified(w, r, etag, "test-config", 100) {
+		t.Fatalf("expected a request without If-None-Match not to be answered with 304")
+	}
+	if w.Header().Get(rfc.ETagHeader) != etag {
+		t.Errorf("expected the ETag header %s, actual: %s", etag, w.Header().Get(rfc.ETagHeader))
+	}
+
+	r.Header.Set(rfc.IfNoneMatch, `"stale"`)
+	if WriteNotModified(httptest.NewRecorder(), r, etag, "test-config", 100) {
+		t.Errorf("expected a request with a stale ETag not to be answered with 304")
+	}
+
+	r.Header.Set(rfc.IfNoneMatch, `"stale", `+etag)
+	w = httptest.NewRecorder()
+	if !WriteNotModified(w, r, etag, "test-config", 100) {
+		t.Fatalf("expected a request with the current ETag to be answered with 304")
+	}
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected an empty 304 response, actual: %d %q", w.Code, w.Body.String())
+	}
+	if !respWritten(r) {
+		t.Errorf("expected the response to be marked as written")
+	}
+
+	after := notModifiedCount("test-config")
+	if after.Responses != before.Responses+1 || after.Bytes != before.Bytes+100 {
+		t.Errorf("expected 1 more 304 response of 100 bytes, actual: %+v before, %+v after", before, after)
+	}
+}
+
+func notModifiedCount(config string) NotModifiedCount {
+	for _, count := range NotModifiedCounts() {
+		if count.Config == config {
+			return count
+		}
+	}
+	return NotModifiedCount{Config: config}
+}
@@ -113,7 +113,8 @@ type key int
 const CurrentUserKey key = iota
 
 // GetCurrentUserFromDB  - returns the id and privilege level of the given user along with the username, or -1 as the id, - as the userName and PrivLevelInvalid if the user doesn't exist, along with a user facing error, a system error to log, and an error code to return
-func GetCurrentUserFromDB(DB *sqlx.DB, user string, timeout time.Duration) (CurrentUser, error, error, int) {
+// The query is canceled when ctx is done, e.g. when the request is canceled, or after timeout.
+func GetCurrentUserFromDB(ctx context.Context, DB *sqlx.DB, user string, timeout time.Duration) (CurrentUser, error, error, int) {
 
 	invalidUser := CurrentUser{"-", -1, PrivLevelInvalid, TenantIDInvalid, -1, "", []string{}, "", nil}
 	if usersCacheIsEnabled() {
@@ -145,7 +146,7 @@ WHERE
 	if DB == nil {
 		return CurrentUser{"-", -1, PrivLevelInvalid, TenantIDInvalid, -1, "", []string{}, "", nil}, nil, errors.New("no db provided to GetCurrentUserFromDB"), http.StatusInternalServerError
 	}
-	dbCtx, dbClose := context.WithTimeout(context.Background(), timeout)
+	dbCtx, dbClose := context.WithTimeout(ctx, timeout)
 	defer dbClose()
 
 	err := DB.GetContext(dbCtx, &currentUserInfo, qry, user)
@@ -260,17 +261,17 @@ func CheckLocalUserPassword(form PasswordForm, db *sqlx.DB, ctx context.Context)
 }
 
 // CheckLocalUserToken checks the passed token against the records in the db for a match, up to a
-// maximum duration of timeout.
-func CheckLocalUserToken(token string, db *sqlx.DB, timeout time.Duration) (bool, string, error) {
+// maximum duration of timeout, or until ctx is done. Expired tokens never match.
+func CheckLocalUserToken(ctx context.Context, token string, db *sqlx.DB, timeout time.Duration) (bool, string, error) {
 	if usersCacheIsEnabled() {
 		username, matched := getUserNameFromCacheByToken(token)
 		return matched, username, nil
 	}
-	dbCtx, dbClose := context.WithTimeout(context.Background(), timeout)
+	dbCtx, dbClose := context.WithTimeout(ctx, timeout)
 	defer dbClose()
 
 	var username string
-	err := db.GetContext(dbCtx, &username, `SELECT username FROM tm_user WHERE token=$1 AND role!=(SELECT role.id FROM role WHERE role.name=$2)`, token, disallowed)
+	err := db.GetContext(dbCtx, &username, `SELECT username FROM tm_user WHERE token=$1 AND (token_expiration IS NULL OR token_expiration > now()) AND role!=(SELECT role.id FROM role WHERE role.name=$2)`, token, disallowed)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return false, "", nil
@@ -39,6 +39,7 @@ const (
 			u.role,
 			u.tenant_id,
 			u.token,
+			u.token_expiration,
 			u.ucdn,
 			u.username
 		FROM
@@ -56,8 +57,19 @@ const (
 
 type user struct {
 	CurrentUser
-	LocalPasswd *string
-	Token       *string
+	LocalPasswd     *string
+	Token           *string
+	TokenExpiration *time.Time
+}
+
+// tokenUser is the user a cached token belongs to, and when the token expires.
+type tokenUser struct {
+	username   string
+	expiration *time.Time
+}
+
+func (t tokenUser) expired(now time.Time) bool {
+	return t.expiration != nil && !now.Before(*t.expiration)
 }
 
 type role struct {
@@ -69,7 +81,7 @@ type role struct {
 
 type users struct {
 	userMap          map[string]user
-	usernamesByToken map[string]string
+	usernamesByToken map[string]tokenUser
 	*sync.RWMutex
 	initialized bool
 	enabled     bool // note: enabled is only written to once at startup, before serving requests, so it doesn't need synchronized access
@@ -98,11 +110,24 @@ func getUserFromCache(username string) (user, bool) {
 }
 
 // getUserNameFromCacheByToken returns the username with the given token and a boolean indicating whether a matching token was found.
+// An expired token is never matched, and is evicted from the cache, even before the next refresh.
 func getUserNameFromCacheByToken(token string) (string, bool) {
 	usersCache.RLock()
-	defer usersCache.RUnlock()
 	t, exists := usersCache.usernamesByToken[token]
-	return t, exists
+	usersCache.RUnlock()
+	if !exists {
+		return "", false
+	}
+	if t.expired(time.Now()) {
+		usersCache.Lock()
+		// the cache may have been refreshed since it was read
+		if t, exists := usersCache.usernamesByToken[token]; exists && t.expired(time.Now()) {
+			delete(usersCache.usernamesByToken, token)
+		}
+		usersCache.Unlock()
+		return "", false
+	}
+	return t.username, true
 }
 
 var once = sync.Once{}
@@ -125,8 +150,8 @@ func startUsersCacheRefresher(interval time.Duration, db *sql.DB, timeout time.D
 
 	go func() {
 		for {
-			// 一定時間waitする
-			time.Sleep(interval)
+			// 一定時間waitする。DBへのアクセスが連続して失敗している場合には間隔を延ばす
+			time.Sleep(usersCacheBreaker.nextDelay(interval))
 
 			// PostgreSQLにアクセスして権限情報とユーザー情報を取得してメモリ上に保存しておきます
 			refreshUsersCache(db, timeout)
@@ -139,9 +164,11 @@ func refreshUsersCache(db *sql.DB, timeout time.Duration) {
 	// PostgreSQLにアクセスして権限情報とユーザー情報を取得する
 	newUsers, err := getUsers(db, timeout)
 	if err != nil {
+		usersCacheBreaker.failure(err)
 		log.Errorf("refreshing users cache: %s", err.Error())
 		return
 	}
+	usersCacheBreaker.success()
 
 	usersCache.Lock()
 	defer usersCache.Unlock()
@@ -151,13 +178,128 @@ func refreshUsersCache(db *sql.DB, timeout time.Duration) {
 	log.Infof("refreshed users cache (len = %d)", len(usersCache.userMap))
 }
 
-func createTokenToUsernameMap(users map[string]user) map[string]string {
-	tokenToUserName := make(map[string]string)
+// The states of the users cache refresh circuit breaker.
+const (
+	// BreakerClosed is the state of a breaker refreshing at its normal interval.
+	BreakerClosed = "closed"
+	// BreakerOpen is the state of a breaker backing off after consecutive failures.
+	BreakerOpen = "open"
+	// BreakerHalfOpen is the state of a breaker trying a refresh after backing off.
+	BreakerHalfOpen = "half-open"
+)
+
+// UsersCacheBreakerThreshold is the number of consecutive failed users cache
+// refreshes after which the refresh interval is backed off.
+const UsersCacheBreakerThreshold = 3
+
+// MaxUsersCacheRefreshBackoff is the longest the users cache refresh interval
+// is backed off to, unless the configured interval is longer.
+const MaxUsersCacheRefreshBackoff = 5 * time.Minute
+
+// UsersCacheStatus is the state of the users cache and its refresh circuit
+// breaker, for monitoring.
+type UsersCacheStatus struct {
+	Enabled             bool       `json:"enabled"`
+	Initialized         bool       `json:"initialized"`
+	BreakerState        string     `json:"breakerState"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+}
+
+// breaker backs off the users cache refresh interval while the DB is
+// unavailable, so an outage isn't made worse by a query every interval.
+type breaker struct {
+	m                   sync.Mutex
+	state               string
+	consecutiveFailures int
+	lastError           string
+	lastSuccess         time.Time
+}
+
+var usersCacheBreaker = &breaker{state: BreakerClosed}
+
+func (b *breaker) success() {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.state != BreakerClosed {
+		log.Infof("users cache refresh succeeded after %d consecutive failures, resuming the normal refresh interval", b.consecutiveFailures)
+	}
+	b.state = BreakerClosed
+	b.consecutiveFailures = 0
+	b.lastError = ""
+	b.lastSuccess = time.Now()
+}
+
+func (b *breaker) failure(err error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.consecutiveFailures++
+	b.lastError = err.Error()
+	if b.state == BreakerClosed && b.consecutiveFailures < UsersCacheBreakerThreshold {
+		return
+	}
+	if b.state == BreakerClosed {
+		log.Warnf("users cache refresh failed %d consecutive times, backing off the refresh interval", b.consecutiveFailures)
+	}
+	b.state = BreakerOpen
+}
+
+// nextDelay returns how long to wait before the next refresh, given the
+// normal refresh interval. While the breaker is open the interval is doubled
+// for every failure past the threshold, up to MaxUsersCacheRefreshBackoff,
+// and the breaker becomes half-open, allowing the next refresh to close it.
+func (b *breaker) nextDelay(interval time.Duration) time.Duration {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.state == BreakerClosed {
+		return interval
+	}
+	b.state = BreakerHalfOpen
+
+	max := MaxUsersCacheRefreshBackoff
+	if interval > max {
+		max = interval
+	}
+	delay := interval
+	for i := UsersCacheBreakerThreshold; i <= b.consecutiveFailures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// GetUsersCacheStatus returns the state of the users cache and its refresh
+// circuit breaker.
+func GetUsersCacheStatus() UsersCacheStatus {
+	status := UsersCacheStatus{Enabled: usersCache.enabled}
+	usersCache.RLock()
+	status.Initialized = usersCache.initialized
+	usersCache.RUnlock()
+
+	usersCacheBreaker.m.Lock()
+	defer usersCacheBreaker.m.Unlock()
+	status.BreakerState = usersCacheBreaker.state
+	status.ConsecutiveFailures = usersCacheBreaker.consecutiveFailures
+	status.LastError = usersCacheBreaker.lastError
+	if !usersCacheBreaker.lastSuccess.IsZero() {
+		lastSuccess := usersCacheBreaker.lastSuccess
+		status.LastSuccess = &lastSuccess
+	}
+	return status
+}
+
+func createTokenToUsernameMap(users map[string]user) map[string]tokenUser {
+	now := time.Now()
+	tokenToUserName := make(map[string]tokenUser)
 	for username, u := range users {
-		if u.Token == nil || u.RoleName == disallowed {
+		t := tokenUser{username: username, expiration: u.TokenExpiration}
+		if u.Token == nil || u.RoleName == disallowed || t.expired(now) {
 			continue
 		}
-		tokenToUserName[*u.Token] = username
+		tokenToUserName[*u.Token] = t
 	}
 	return tokenToUserName
 }
@@ -211,7 +353,7 @@ func getUsers(db *sql.DB, timeout time.Duration) (map[string]user, error) {
 	// レコード毎に処理してユーザー情報を配列に保存しておく
 	for rows.Next() {
 		u := user{}
-		if err := rows.Scan(&u.ID, &u.LocalPasswd, &u.Role, &u.TenantID, &u.Token, &u.UCDN, &u.UserName); err != nil {
+		if err := rows.Scan(&u.ID, &u.LocalPasswd, &u.Role, &u.TenantID, &u.Token, &u.TokenExpiration, &u.UCDN, &u.UserName); err != nil {
 			return nil, errors.New("scanning users: " + err.Error())
 		}
 		r := roles[u.Role]
@@ -20,6 +20,7 @@ package auth
  */
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -65,13 +66,13 @@ func TestGetUsers(t *testing.T) {
 		},
 	}
 	roleRows := sqlmock.NewRows([]string{"capabilities", "role", "role_name", "priv_level"})
-	userRows := sqlmock.NewRows([]string{"id", "local_passwd", "role", "tenant_id", "token", "ucdn", "username"})
+	userRows := sqlmock.NewRows([]string{"id", "local_passwd", "role", "tenant_id", "token", "token_expiration", "ucdn", "username"})
 
 	for _, r := range expectedRoles {
 		roleRows.AddRow("{"+strings.Join(r.Capabilities, ",")+"}", r.ID, r.Name, r.PrivLevel)
 	}
 	for _, u := range expectedUsers {
-		userRows.AddRow(u.ID, u.LocalPasswd, u.Role, u.TenantID, u.Token, u.UCDN, u.UserName)
+		userRows.AddRow(u.ID, u.LocalPasswd, u.Role, u.TenantID, u.Token, u.TokenExpiration, u.UCDN, u.UserName)
 	}
 	mock.ExpectBegin()
 	mock.ExpectQuery("SELECT.+").WillReturnRows(roleRows)
@@ -85,3 +86,134 @@ func TestGetUsers(t *testing.T) {
 		t.Errorf("getUsers expected: %v, actual: %v", expectedUsers, actualUsers)
 	}
 }
+
+func TestBreakerBackoff(t *testing.T) {
+	b := breaker{state: BreakerClosed}
+	interval := 30 * time.Second
+
+	for i := 1; i < UsersCacheBreakerThreshold; i++ {
+		b.failure(errors.New("connection refused"))
+		if b.state != BreakerClosed {
+			t.Errorf("expected the breaker to stay closed after %d failures, actual: %s", i, b.state)
+		}
+		if delay := b.nextDelay(interval); delay != interval {
+			t.Errorf("expected the normal interval %v below the failure threshold, actual: %v", interval, delay)
+		}
+	}
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, MaxUsersCacheRefreshBackoff, MaxUsersCacheRefreshBackoff}
+	for _, e := range expected {
+		b.failure(errors.New("connection refused"))
+		if b.state != BreakerOpen {
+			t.Errorf("expected the breaker to be open after %d failures, actual: %s", b.consecutiveFailures, b.state)
+		}
+		if delay := b.nextDelay(interval); delay != e {
+			t.Errorf("expected a backed off interval of %v after %d failures, actual: %v", e, b.consecutiveFailures, delay)
+		}
+		if b.state != BreakerHalfOpen {
+			t.Errorf("expected the breaker to be half-open when retrying, actual: %s", b.state)
+		}
+	}
+
+	b.success()
+	if b.state != BreakerClosed || b.consecutiveFailures != 0 || b.lastError != "" {
+		t.Errorf("expected a success to close the breaker, actual state: %s, failures: %d, last error: '%s'", b.state, b.consecutiveFailures, b.lastError)
+	}
+	if delay := b.nextDelay(interval); delay != interval {
+		t.Errorf("expected the normal interval %v after a success, actual: %v", interval, delay)
+	}
+
+	if delay := (&breaker{state: BreakerOpen, consecutiveFailures: 10}).nextDelay(10 * time.Minute); delay != 10*time.Minute {
+		t.Errorf("expected an interval longer than the max backoff not to be shortened, actual: %v", delay)
+	}
+}
+
+func TestRefreshUsersCacheRecovery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating new sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	oldBreaker := usersCacheBreaker
+	usersCacheBreaker = &breaker{state: BreakerClosed}
+	defer func() { usersCacheBreaker = oldBreaker }()
+	usersCache.Lock()
+	usersCache.userMap, usersCache.usernamesByToken, usersCache.initialized = nil, nil, false
+	usersCache.Unlock()
+
+	for i := 0; i < UsersCacheBreakerThreshold; i++ {
+		mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+		refreshUsersCache(db, 10*time.Second)
+	}
+	status := GetUsersCacheStatus()
+	if status.BreakerState != BreakerOpen || status.ConsecutiveFailures != UsersCacheBreakerThreshold {
+		t.Errorf("expected an open breaker with %d failures, actual: %+v", UsersCacheBreakerThreshold, status)
+	}
+	if status.Initialized {
+		t.Error("expected the users cache not to be initialized while the DB is down")
+	}
+
+	usersCacheBreaker.nextDelay(time.Second)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT.+").WillReturnRows(sqlmock.NewRows([]string{"capabilities", "role", "role_name", "priv_level"}).AddRow("{foo}", 1, "foo_role", 42))
+	mock.ExpectQuery("SELECT.+").WillReturnRows(sqlmock.NewRows([]string{"id", "local_passwd", "role", "tenant_id", "token", "token_expiration", "ucdn", "username"}).AddRow(1, "foo", 1, 1, "bar", nil, "", "user1"))
+	mock.ExpectCommit()
+	refreshUsersCache(db, 10*time.Second)
+
+	status = GetUsersCacheStatus()
+	if status.BreakerState != BreakerClosed || status.ConsecutiveFailures != 0 || status.LastSuccess == nil {
+		t.Errorf("expected a closed breaker after a successful refresh, actual: %+v", status)
+	}
+	if !status.Initialized {
+		t.Error("expected the first successful refresh to initialize the users cache")
+	}
+	if _, ok := getUserFromCache("user1"); !ok {
+		t.Error("expected the first successful refresh to populate the users cache")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected all queries to be made: %v", err)
+	}
+}
+
+func TestGetUserNameFromCacheByTokenExpired(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	unexpired := time.Now().Add(time.Hour)
+
+	usersCache.Lock()
+	oldTokens := usersCache.usernamesByToken
+	usersCache.usernamesByToken = createTokenToUsernameMap(map[string]user{
+		"never":     {CurrentUser: CurrentUser{UserName: "never"}, Token: util.StrPtr("never-token")},
+		"unexpired": {CurrentUser: CurrentUser{UserName: "unexpired"}, Token: util.StrPtr("unexpired-token"), TokenExpiration: &unexpired},
+		"expired":   {CurrentUser: CurrentUser{UserName: "expired"}, Token: util.StrPtr("expired-token"), TokenExpiration: &expired},
+	})
+	usersCache.Unlock()
+	defer func() {
+		usersCache.Lock()
+		usersCache.usernamesByToken = oldTokens
+		usersCache.Unlock()
+	}()
+
+	if _, ok := getUserNameFromCacheByToken("expired-token"); ok {
+		t.Error("expected a token which expired before the cache was refreshed not to be cached")
+	}
+	for _, name := range []string{"never", "unexpired"} {
+		if username, ok := getUserNameFromCacheByToken(name + "-token"); !ok || username != name {
+			t.Errorf("expected token '%s-token' to match user '%s', actual: '%s' (matched: %t)", name, name, username, ok)
+		}
+	}
+
+	// a token which expires after the cache was refreshed, but before the next refresh.
+	usersCache.Lock()
+	usersCache.usernamesByToken["stale-token"] = tokenUser{username: "stale", expiration: &expired}
+	usersCache.Unlock()
+	if username, ok := getUserNameFromCacheByToken("stale-token"); ok {
+		t.Errorf("expected an expired but still cached token not to match, actual user: '%s'", username)
+	}
+	usersCache.RLock()
+	_, cached := usersCache.usernamesByToken["stale-token"]
+	usersCache.RUnlock()
+	if cached {
+		t.Error("expected an expired token to be evicted from the cache")
+	}
+}
@@ -20,7 +20,9 @@ package config
  */
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -28,8 +30,10 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/lib/go-rfc"
@@ -48,16 +52,88 @@ type Host struct {
 	Port     int    `json:"port"`
 }
 
+// BackendHeaders controls which request headers are forwarded to the hosts of a backend route.
+// Hop-by-hop headers are never forwarded.
+type BackendHeaders struct {
+	// Allow lists headers which are otherwise not forwarded by default, e.g. Cookie or Authorization.
+	Allow []string `json:"allow"`
+	// Deny lists additional headers which are not forwarded.
+	Deny []string `json:"deny"`
+}
+
+// DefaultBackendResponseHeaderTimeoutSeconds is how long, in seconds, Traffic
+// Ops waits for the response headers of a backend route's host, if not
+// configured.
+const DefaultBackendResponseHeaderTimeoutSeconds = 30
+
+// DefaultBackendRequestTimeoutSeconds is how long, in seconds, a request
+// proxied to a backend route's host may take in all, if not configured.
+const DefaultBackendRequestTimeoutSeconds = 60
+
+// BackendTimeouts limits how long Traffic Ops waits for the hosts of a backend route, so a slow host can't hold
+// on to the requests proxied to it indefinitely.
+type BackendTimeouts struct {
+	// ResponseHeaderSeconds is how long to wait for a host's response headers after sending it the request.
+	ResponseHeaderSeconds int `json:"responseHeaderSeconds"`
+	// RequestSeconds is how long a proxied request may take in all, including reading the host's response body.
+	RequestSeconds int `json:"requestSeconds"`
+}
+
+// ResponseHeaderTimeout returns how long to wait for a host's response headers.
+func (t BackendTimeouts) ResponseHeaderTimeout() time.Duration {
+	if t.ResponseHeaderSeconds <= 0 {
+		return DefaultBackendResponseHeaderTimeoutSeconds * time.Second
+	}
+	return time.Duration(t.ResponseHeaderSeconds) * time.Second
+}
+
+// RequestTimeout returns how long a proxied request may take in all.
+func (t BackendTimeouts) RequestTimeout() time.Duration {
+	if t.RequestSeconds <= 0 {
+		return DefaultBackendRequestTimeoutSeconds * time.Second
+	}
+	return time.Duration(t.RequestSeconds) * time.Second
+}
+
 // BackendRoute holds all the information about a configured route, for which Traffic Ops serves as a reverse proxy.
 type BackendRoute struct {
-	Path        string   `json:"path"`
-	Method      string   `json:"method"`
-	Hosts       []Host   `json:"hosts"`
-	Opts        Options  `json:"opts"`
-	ID          int      `json:"routeId"`
-	Insecure    bool     `json:"insecure"`
-	Permissions []string `json:"permissions"`
+	Path        string          `json:"path"`
+	Method      string          `json:"method"`
+	Hosts       []Host          `json:"hosts"`
+	Opts        Options         `json:"opts"`
+	ID          int             `json:"routeId"`
+	Insecure    bool            `json:"insecure"`
+	Permissions []string        `json:"permissions"`
+	Headers     BackendHeaders  `json:"headers"`
+	Timeouts    BackendTimeouts `json:"timeouts"`
 	Index       int
+	// Regex is the compiled Path, set by Compile.
+	Regex *regexp.Regexp `json:"-"`
+	// Params are the names of the "{param}"s in Path, in the order of Regex's submatches.
+	Params []string `json:"-"`
+}
+
+// Compile compiles the route's Path into its Regex and Params, so requests
+// only need to be matched against it. Each "{param}" in Path matches a single
+// path segment.
+func (r *BackendRoute) Compile() error {
+	path := r.Path
+	params := []string{}
+	for open := strings.Index(path, "{"); open > 0; open = strings.Index(path, "{") {
+		close := strings.Index(path, "}")
+		if close < open {
+			return fmt.Errorf("malformed path '%s': '{' without a matching '}'", r.Path)
+		}
+		params = append(params, path[open+1:close])
+		path = path[:open] + `([^/]+)` + path[close+1:]
+	}
+	regex, err := regexp.Compile(path)
+	if err != nil {
+		return fmt.Errorf("compiling path '%s': %w", r.Path, err)
+	}
+	r.Regex = regex
+	r.Params = params
+	return nil
 }
 
 // BackendConfig is a structure that holds the configuration supplied to Traffic Ops, which makes it act as a reverse proxy to the specified routes.
@@ -83,6 +159,7 @@ type Config struct {
 	TrafficVaultEnabled                       bool
 	ConfigLDAP                                *ConfigLDAP
 	UserCacheRefreshIntervalSec               int `json:"user_cache_refresh_interval_sec"`
+	UserTokenExpirationSec                    int `json:"user_token_expiration_sec"`
 	ServerUpdateStatusCacheRefreshIntervalSec int `json:"server_update_status_cache_refresh_interval_sec"`
 	LDAPEnabled                               bool
 	LDAPConfPath                              string `json:"ldap_conf_location"`
@@ -115,6 +192,7 @@ type ConfigTrafficOpsGolang struct {
 	ProxyReadHeaderTimeout   int                        `json:"proxy_read_header_timeout"`
 	ReadTimeout              int                        `json:"read_timeout"`
 	RequestTimeout           int                        `json:"request_timeout"`
+	RequestTimeoutMethods    map[string]int             `json:"request_timeout_methods"`
 	ReadHeaderTimeout        int                        `json:"read_header_timeout"`
 	WriteTimeout             int                        `json:"write_timeout"`
 	IdleTimeout              int                        `json:"idle_timeout"`
@@ -130,6 +208,7 @@ type ConfigTrafficOpsGolang struct {
 	Plugins                  []string                   `json:"plugins"`
 	PluginConfig             map[string]json.RawMessage `json:"plugin_config"`
 	PluginSharedConfig       map[string]interface{}     `json:"plugin_shared_config"`
+	PluginShutdownTimeoutSec int                        `json:"plugin_shutdown_timeout_seconds"`
 	ProfilingEnabled         bool                       `json:"profiling_enabled"`
 	ProfilingLocation        string                     `json:"profiling_location"`
 	// Deprecated: use 'port' in traffic_vault_config instead.
@@ -150,6 +229,270 @@ type ConfigTrafficOpsGolang struct {
 	// CRConfigEmulateOldPath is whether to emulate the legacy CRConfig request path when generating a new CRConfig. This primarily exists in the event a tool relies on the legacy path '/tools/write_crconfig'.
 	// Deprecated: will be removed in the next major version.
 	CRConfigEmulateOldPath bool `json:"crconfig_emulate_old_path"`
+
+	// PathNormalization controls how request paths are normalized before they are matched against API and backend routes.
+	PathNormalization PathNormalization `json:"path_normalization"`
+
+	// Maintenance controls whether Traffic Ops starts in maintenance mode, and how clients are told to retry while it is.
+	Maintenance ConfigMaintenance `json:"maintenance"`
+
+	// ReadOnly controls read-only mode, in which mutating API requests are refused, e.g. while the database has failed over to a read-only replica.
+	ReadOnly ConfigReadOnly `json:"read_only"`
+
+	// RequestLogSampling controls sampling of the lines logged when each request is handled, to cut their volume on busy servers.
+	RequestLogSampling ConfigRequestLogSampling `json:"request_log_sampling"`
+
+	// RequestLimit limits the number of requests Traffic Ops handles at once, shedding load before the database connections are exhausted.
+	RequestLimit ConfigRequestLimit `json:"request_limit"`
+
+	// SNICertificates maps the server names clients may request with SNI to the certificate and key served for them. Names of the form "*.example.com" match any single label in place of the "*". Clients requesting any other name, or none, are served the default certificate and key.
+	SNICertificates map[string]SNICertificate `json:"sni_certificates"`
+
+	// StartupWait controls how long Traffic Ops waits at startup for the database and Traffic Vault to become reachable.
+	StartupWait ConfigStartupWait `json:"startup_wait"`
+
+	// ClientCertAuth controls verification of TLS client certificates, and which routes clients may authenticate to with one in place of a password or token.
+	ClientCertAuth ConfigClientCertAuth `json:"client_cert_auth"`
+
+	// InternalHTTPListen is the address, e.g. ":8080", of an optional plain HTTP listener serving only the health endpoints, for internal probes without TLS. The API is never served on it. Empty disables the listener.
+	InternalHTTPListen string `json:"internal_http_listen"`
+
+	// RouteMetrics controls the per-route request latency histograms served in the OpenMetrics format.
+	RouteMetrics ConfigRouteMetrics `json:"route_metrics"`
+
+	// MaxRouteParams is the maximum number of path parameters, e.g. {id}, of an API route. Traffic Ops fails to start if a route has more. Zero uses DefaultMaxRouteParams.
+	MaxRouteParams int `json:"max_route_params"`
+}
+
+// DefaultMaxRouteParams is the maximum number of path parameters of an API
+// route, if not configured.
+const DefaultMaxRouteParams = 8
+
+// RouteParamsLimit returns the maximum number of path parameters of an API
+// route.
+func (c ConfigTrafficOpsGolang) RouteParamsLimit() int {
+	if c.MaxRouteParams <= 0 {
+		return DefaultMaxRouteParams
+	}
+	return c.MaxRouteParams
+}
+
+// DefaultMaintenanceRetryAfterSeconds is the Retry-After, in seconds, given to
+// clients while in maintenance mode, if not configured.
+const DefaultMaintenanceRetryAfterSeconds = 300
+
+// ConfigMaintenance contains the maintenance mode configuration.
+type ConfigMaintenance struct {
+	// Enabled is whether Traffic Ops starts in maintenance mode, serving a 503 for all API routes.
+	Enabled bool `json:"enabled"`
+	// RetryAfterSeconds is the value of the Retry-After header returned to clients while in maintenance mode.
+	RetryAfterSeconds int `json:"retry_after_seconds"`
+}
+
+// RetryAfter returns the duration clients should wait before retrying a request while in maintenance mode.
+func (c ConfigMaintenance) RetryAfter() time.Duration {
+	if c.RetryAfterSeconds <= 0 {
+		return DefaultMaintenanceRetryAfterSeconds * time.Second
+	}
+	return time.Duration(c.RetryAfterSeconds) * time.Second
+}
+
+// DefaultReadOnlyRetryAfterSeconds is the Retry-After, in seconds, given to
+// clients refused by read-only mode, if not configured.
+const DefaultReadOnlyRetryAfterSeconds = 30
+
+// ConfigReadOnly contains the read-only mode configuration.
+type ConfigReadOnly struct {
+	// Enabled is whether Traffic Ops starts in read-only mode, serving a 503 for all mutating API requests.
+	Enabled bool `json:"enabled"`
+	// RecoveryCheckIntervalSec is how often to check whether the database is in recovery, i.e. a read-only replica, entering read-only mode while it is. Zero or less disables the check.
+	RecoveryCheckIntervalSec int `json:"recovery_check_interval_seconds"`
+	// RetryAfterSeconds is the value of the Retry-After header returned to clients refused by read-only mode.
+	RetryAfterSeconds int `json:"retry_after_seconds"`
+}
+
+// RetryAfter returns the duration clients should wait before retrying a request refused by read-only mode.
+func (c ConfigReadOnly) RetryAfter() time.Duration {
+	if c.RetryAfterSeconds <= 0 {
+		return DefaultReadOnlyRetryAfterSeconds * time.Second
+	}
+	return time.Duration(c.RetryAfterSeconds) * time.Second
+}
+
+// DefaultRequestLimitRetryAfterSeconds is the Retry-After, in seconds, given to
+// clients refused by the in-flight request limit, if not configured.
+const DefaultRequestLimitRetryAfterSeconds = 5
+
+// ConfigRequestLimit contains the in-flight request limit configuration.
+type ConfigRequestLimit struct {
+	// MaxInFlight is the maximum number of requests handled at once. Requests beyond it are refused with a 503. Zero or less disables the limit.
+	MaxInFlight int `json:"max_in_flight"`
+	// RetryAfterSeconds is the value of the Retry-After header returned to clients refused by the limit.
+	RetryAfterSeconds int `json:"retry_after_seconds"`
+}
+
+// RetryAfter returns the duration clients should wait before retrying a request refused by the in-flight request limit.
+func (c ConfigRequestLimit) RetryAfter() time.Duration {
+	if c.RetryAfterSeconds <= 0 {
+		return DefaultRequestLimitRetryAfterSeconds * time.Second
+	}
+	return time.Duration(c.RetryAfterSeconds) * time.Second
+}
+
+// SNICertificate is the certificate and key files served to clients requesting
+// a server name with SNI.
+type SNICertificate struct {
+	CertPath string `json:"cert"`
+	KeyPath  string `json:"key"`
+}
+
+// DefaultRequestLogSlowThresholdMS is the duration, in milliseconds, from
+// which a request is slow and always logged, if not configured.
+const DefaultRequestLogSlowThresholdMS = 1000
+
+// ConfigRequestLogSampling contains the request log sampling configuration.
+type ConfigRequestLogSampling struct {
+	// Rate is N to log only 1 in N requests, unless they fail or are slow. One or less logs every request.
+	Rate uint64 `json:"rate"`
+	// SlowThresholdMS is the duration, in milliseconds, from which a request is logged whether or not it's sampled.
+	SlowThresholdMS int `json:"slow_threshold_ms"`
+}
+
+// Sampled returns whether the request with the given ID is sampled. The same
+// request is always sampled, or not, so both of its lines are logged, or neither.
+func (c ConfigRequestLogSampling) Sampled(reqID uint64) bool {
+	return c.Rate <= 1 || reqID%c.Rate == 0
+}
+
+// SlowThreshold returns the duration from which a request is logged whether or not it's sampled.
+func (c ConfigRequestLogSampling) SlowThreshold() time.Duration {
+	if c.SlowThresholdMS <= 0 {
+		return DefaultRequestLogSlowThresholdMS * time.Millisecond
+	}
+	return time.Duration(c.SlowThresholdMS) * time.Millisecond
+}
+
+// DefaultRouteLatencyBucketsMS are the upper bounds, in milliseconds, of the
+// buckets of the per-route request latency histograms, if not configured.
+var DefaultRouteLatencyBucketsMS = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// ConfigRouteMetrics contains the per-route request metrics configuration.
+type ConfigRouteMetrics struct {
+	// LatencyBucketsMS are the upper bounds, in milliseconds, of the buckets of the request latency histograms, in increasing order. A final bucket for every request is always added.
+	LatencyBucketsMS []float64 `json:"latency_buckets_ms"`
+}
+
+// LatencyBuckets returns the upper bounds, in seconds, of the buckets of the
+// request latency histograms.
+func (c ConfigRouteMetrics) LatencyBuckets() []float64 {
+	bucketsMS := c.LatencyBucketsMS
+	if len(bucketsMS) == 0 {
+		bucketsMS = DefaultRouteLatencyBucketsMS
+	}
+	buckets := make([]float64, 0, len(bucketsMS))
+	for _, ms := range bucketsMS {
+		buckets = append(buckets, ms/1000)
+	}
+	return buckets
+}
+
+// ValidateRouteMetrics returns an error if the route metrics configuration is invalid.
+func ValidateRouteMetrics(c ConfigRouteMetrics) error {
+	for i, ms := range c.LatencyBucketsMS {
+		if ms <= 0 {
+			return fmt.Errorf("route_metrics.latency_buckets_ms must be positive, not %v", ms)
+		}
+		if i > 0 && ms <= c.LatencyBucketsMS[i-1] {
+			return errors.New("route_metrics.latency_buckets_ms must be in increasing order")
+		}
+	}
+	return nil
+}
+
+// DefaultStartupWaitIntervalSeconds is the interval, in seconds, between
+// checks of the startup dependencies while waiting for them, if not configured.
+const DefaultStartupWaitIntervalSeconds = 5
+
+// ConfigStartupWait contains the configuration of waiting for the database and
+// Traffic Vault to become reachable at startup.
+type ConfigStartupWait struct {
+	// MaxSeconds is the longest to wait for the database and Traffic Vault to become reachable. Zero or less disables waiting, and Traffic Ops exits if the database can't be reached on the first try.
+	MaxSeconds int `json:"max_seconds"`
+	// IntervalSeconds is the time between checks while waiting.
+	IntervalSeconds int `json:"interval_seconds"`
+}
+
+// MaxWait returns the longest to wait for the startup dependencies.
+func (c ConfigStartupWait) MaxWait() time.Duration {
+	if c.MaxSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(c.MaxSeconds) * time.Second
+}
+
+// Interval returns the time between checks of the startup dependencies.
+func (c ConfigStartupWait) Interval() time.Duration {
+	if c.IntervalSeconds <= 0 {
+		return DefaultStartupWaitIntervalSeconds * time.Second
+	}
+	return time.Duration(c.IntervalSeconds) * time.Second
+}
+
+// The policies of verifying TLS client certificates.
+const (
+	// ClientCertPolicyRequest verifies a client certificate if one is given, but doesn't require one.
+	ClientCertPolicyRequest = "request"
+	// ClientCertPolicyRequire refuses connections without a verified client certificate.
+	ClientCertPolicyRequire = "require"
+)
+
+// ConfigClientCertAuth contains the TLS client certificate authentication
+// configuration. Client certificates aren't requested unless CAFile is set.
+type ConfigClientCertAuth struct {
+	// CAFile is the path of the PEM file of the certificate authorities client certificates are verified against.
+	CAFile string `json:"ca_file"`
+	// Policy is ClientCertPolicyRequest or ClientCertPolicyRequire. It defaults to ClientCertPolicyRequest.
+	Policy string `json:"policy"`
+	// Subjects maps the distinguished names of client certificate subjects, e.g. "CN=t3c,O=Example", to the usernames of the Traffic Ops users they authenticate as.
+	Subjects map[string]string `json:"subjects"`
+	// RouteIDs are the IDs of the routes clients may authenticate to with a client certificate in place of a password or token.
+	RouteIDs []int `json:"route_ids"`
+}
+
+// Enabled returns whether client certificates are verified.
+func (c ConfigClientCertAuth) Enabled() bool {
+	return c.CAFile != ""
+}
+
+// ClientAuth returns the tls.ClientAuthType of the configured policy.
+func (c ConfigClientCertAuth) ClientAuth() tls.ClientAuthType {
+	if !c.Enabled() {
+		return tls.NoClientCert
+	}
+	if c.Policy == ClientCertPolicyRequire {
+		return tls.RequireAndVerifyClientCert
+	}
+	return tls.VerifyClientCertIfGiven
+}
+
+// ValidateClientCertAuth returns an error if the client certificate authentication configuration is invalid.
+func ValidateClientCertAuth(c ConfigClientCertAuth) error {
+	if c.Policy != "" && c.Policy != ClientCertPolicyRequest && c.Policy != ClientCertPolicyRequire {
+		return fmt.Errorf("client_cert_auth.policy must be '%s' or '%s', not '%s'", ClientCertPolicyRequest, ClientCertPolicyRequire, c.Policy)
+	}
+	if !c.Enabled() && (len(c.Subjects) > 0 || len(c.RouteIDs) > 0) {
+		return errors.New("client_cert_auth.subjects and client_cert_auth.route_ids require client_cert_auth.ca_file")
+	}
+	return nil
+}
+
+// PathNormalization contains the normalizations to apply to request paths
+// before routing. All of them are disabled by default.
+type PathNormalization struct {
+	// CollapseSlashes replaces each run of consecutive slashes in the request path with a single slash.
+	CollapseSlashes bool `json:"collapse_slashes"`
+	// TrimTrailingSlash removes a trailing slash from the request path, so that a route matches regardless of whether one was given.
+	TrimTrailingSlash bool `json:"trim_trailing_slash"`
 }
 
 // RoutingBlacklist contains a list of route IDs that are disabled,
@@ -331,12 +674,23 @@ func LoadBackendConfig(backendConfigPath string) (BackendConfig, error) {
 	}
 
 	// $.routes、$.routes.hosts.でのイテレーション処理が行われている。backends.confを参照のこと
-	for _, r := range cfg.Routes {
+	for i := range cfg.Routes {
+		r := &cfg.Routes[i]
 		// $.routes.opts.algorithmは空か「roundrobin」のいずれかでなければならない
 		if r.Opts.Algorithm != "" && r.Opts.Algorithm != "roundrobin" {
 			return cfg, errors.New("algorithm can only be roundrobin or blank")
 		}
 
+		// $.routes.timeoutsは省略時には既定値になるが、負の値は設定ミスとして扱う
+		if r.Timeouts.ResponseHeaderSeconds < 0 || r.Timeouts.RequestSeconds < 0 {
+			return cfg, fmt.Errorf("route %d: timeouts must not be negative", r.ID)
+		}
+
+		// $.routes.pathは起動時・リロード時に一度だけ正規表現にコンパイルする
+		if err := r.Compile(); err != nil {
+			return cfg, fmt.Errorf("route %d: %w", r.ID, err)
+		}
+
 		for _, h := range r.Hosts {
 			// 例「https://localhost:8444」
 			rawURL := h.Protocol + "://" + h.Hostname + ":" + strconv.Itoa(h.Port)
@@ -472,6 +826,93 @@ func (c Config) GetKeyPath() string {
 	return ""
 }
 
+// UserTokenExpiration returns the expiration of a user token issued now, or
+// nil if user tokens don't expire.
+func (c Config) UserTokenExpiration() *time.Time {
+	if c.UserTokenExpirationSec <= 0 {
+		return nil
+	}
+	expiration := time.Now().Add(time.Duration(c.UserTokenExpirationSec) * time.Second)
+	return &expiration
+}
+
+// RedactedValue replaces the values of credentials in RedactedJSON.
+const RedactedValue = "*** REDACTED ***"
+
+// redactedKeyParts are parts of the names of settings which hold credentials,
+// whose values are redacted by RedactedJSON, unless they're numbers or
+// booleans, like user_token_expiration_sec.
+var redactedKeyParts = []string{"pass", "secret", "private", "token", "key", "hmac"}
+
+// isRedactedKey returns whether the setting with the given name holds a
+// credential.
+func isRedactedKey(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range redactedKeyParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue redacts the credentials in the given value decoded from JSON,
+// in place, returning the redacted value.
+func redactValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for name, child := range v {
+			switch child.(type) {
+			case json.Number, bool, nil:
+				continue
+			case map[string]interface{}:
+				v[name] = redactValue(child)
+			default:
+				if isRedactedKey(name) {
+					v[name] = RedactedValue
+				} else {
+					v[name] = redactValue(child)
+				}
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue(child)
+		}
+	}
+	return val
+}
+
+// RedactedJSON returns the effective config as JSON with the values of
+// credentials - passwords, secrets, keys, and tokens, including those in
+// plugin and Traffic Vault configs - redacted. Object keys are sorted, so
+// equal configs always have equal JSON.
+func (c Config) RedactedJSON() ([]byte, error) {
+	bts, err := json.Marshal(c)
+	if err != nil {
+		return nil, errors.New("marshalling config: " + err.Error())
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(bts)))
+	decoder.UseNumber()
+	var val interface{}
+	if err := decoder.Decode(&val); err != nil {
+		return nil, errors.New("decoding marshalled config: " + err.Error())
+	}
+	return json.Marshal(redactValue(val))
+}
+
+// Fingerprint returns the hex-encoded SHA-256 hash of the RedactedJSON of the
+// config. It's the same for the same effective config, so which config is
+// running can be confirmed across a fleet, without exposing credentials.
+func (c Config) Fingerprint() (string, error) {
+	bts, err := c.RedactedJSON()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(bts)
+	return hex.EncodeToString(hash[:]), nil
+}
+
 const (
 	DBMaxIdleConnectionsDefault     = 10 // if this is higher than MaxDBConnections it will be automatically adjusted below it by the db/sql library
 	DBConnMaxLifetimeSecondsDefault = 60
@@ -513,6 +954,9 @@ func ParseConfig(cfg Config) (Config, error) {
 	if cfg.UserCacheRefreshIntervalSec < 0 {
 		cfg.UserCacheRefreshIntervalSec = 0
 	}
+	if cfg.UserTokenExpirationSec < 0 {
+		cfg.UserTokenExpirationSec = 0
+	}
 	if cfg.ServerUpdateStatusCacheRefreshIntervalSec < 0 {
 		cfg.ServerUpdateStatusCacheRefreshIntervalSec = 0
 	}
@@ -564,6 +1008,18 @@ func ParseConfig(cfg Config) (Config, error) {
 		return Config{}, err
 	}
 
+	if err := ValidateClientCertAuth(cfg.ClientCertAuth); err != nil {
+		return Config{}, err
+	}
+
+	if err := ValidateRouteMetrics(cfg.RouteMetrics); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.MaxRouteParams < 0 {
+		return Config{}, fmt.Errorf("max_route_params must not be negative, not %d", cfg.MaxRouteParams)
+	}
+
 	return cfg, nil
 }
 
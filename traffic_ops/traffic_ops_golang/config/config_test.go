@@ -20,6 +20,7 @@ package config
  */
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -27,6 +28,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -318,3 +320,169 @@ func TestValidateRoutingBlacklist(t *testing.T) {
 		}
 	}
 }
+
+func TestBackendRouteCompile(t *testing.T) {
+	r := BackendRoute{Path: "^/api/4.0/foo/{id}/bar/{name}$"}
+	if err := r.Compile(); err != nil {
+		t.Fatalf("Expected: no error compiling '%s', actual: %v", r.Path, err)
+	}
+	if r.Path != "^/api/4.0/foo/{id}/bar/{name}$" {
+		t.Errorf("Expected: Path to be unchanged, actual: %s", r.Path)
+	}
+	if len(r.Params) != 2 || r.Params[0] != "id" || r.Params[1] != "name" {
+		t.Errorf("Expected: params [id name], actual: %v", r.Params)
+	}
+	match := r.Regex.FindStringSubmatch("/api/4.0/foo/12/bar/baz")
+	if len(match) != 3 || match[1] != "12" || match[2] != "baz" {
+		t.Errorf("Expected: submatches [12 baz], actual: %v", match)
+	}
+	if r.Regex.MatchString("/api/4.0/foo/12/34/bar/baz") {
+		t.Error("Expected: a param to match a single path segment")
+	}
+
+	for _, path := range []string{"^/api/4.0/foo/{id$", "^/api/4.0/foo/}{id$", "^/api/4.0/foo/(bar$"} {
+		r := BackendRoute{Path: path}
+		if err := r.Compile(); err == nil {
+			t.Errorf("Expected: an error compiling '%s', actual: nil", path)
+		}
+	}
+}
+
+func TestLoadBackendConfigCompilesRoutes(t *testing.T) {
+	f, err := ioutil.TempFile("", "backends.conf")
+	if err != nil {
+		t.Fatalf("creating temp backend config: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"routes": [{"path": "^/api/4.0/foo/{id}$", "method": "GET", "routeId": 1, "hosts": [{"protocol": "https", "hostname": "localhost", "port": 8444}]}]}`)
+	f.Close()
+
+	cfg, err := LoadBackendConfig(f.Name())
+	if err != nil {
+		t.Fatalf("Expected: no error loading backend config, actual: %v", err)
+	}
+	if cfg.Routes[0].Regex == nil || !cfg.Routes[0].Regex.MatchString("/api/4.0/foo/1") {
+		t.Errorf("Expected: the route path to be compiled, actual regex: %v", cfg.Routes[0].Regex)
+	}
+}
+
+func TestBackendTimeouts(t *testing.T) {
+	timeouts := BackendTimeouts{}
+	if timeouts.ResponseHeaderTimeout() != DefaultBackendResponseHeaderTimeoutSeconds*time.Second || timeouts.RequestTimeout() != DefaultBackendRequestTimeoutSeconds*time.Second {
+		t.Errorf("Expected: the default timeouts, actual: %v and %v", timeouts.ResponseHeaderTimeout(), timeouts.RequestTimeout())
+	}
+	timeouts = BackendTimeouts{ResponseHeaderSeconds: 5, RequestSeconds: 120}
+	if timeouts.ResponseHeaderTimeout() != 5*time.Second || timeouts.RequestTimeout() != 120*time.Second {
+		t.Errorf("Expected: timeouts of 5s and 2m0s, actual: %v and %v", timeouts.ResponseHeaderTimeout(), timeouts.RequestTimeout())
+	}
+
+	f, err := ioutil.TempFile("", "backends.conf")
+	if err != nil {
+		t.Fatalf("creating temp backend config: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"routes": [{"path": "^/api/4.0/foo$", "method": "GET", "routeId": 1, "timeouts": {"requestSeconds": -1}}]}`)
+	f.Close()
+	if _, err := LoadBackendConfig(f.Name()); err == nil {
+		t.Error("Expected: an error loading a backend config with a negative timeout, actual: nil")
+	}
+}
+
+func TestClientCertAuth(t *testing.T) {
+	c := ConfigClientCertAuth{}
+	if c.Enabled() || c.ClientAuth() != tls.NoClientCert {
+		t.Errorf("Expected: client certificates not to be requested without a CA file, actual: %v", c.ClientAuth())
+	}
+	if err := ValidateClientCertAuth(ConfigClientCertAuth{RouteIDs: []int{1}}); err == nil {
+		t.Error("Expected: an error for route IDs without a CA file, actual: nil")
+	}
+
+	c.CAFile = "/etc/pki/tls/certs/clients-ca.crt"
+	if c.ClientAuth() != tls.VerifyClientCertIfGiven {
+		t.Errorf("Expected: client certificates to be verified if given by default, actual: %v", c.ClientAuth())
+	}
+	c.Policy = ClientCertPolicyRequire
+	if c.ClientAuth() != tls.RequireAndVerifyClientCert {
+		t.Errorf("Expected: client certificates to be required, actual: %v", c.ClientAuth())
+	}
+	if err := ValidateClientCertAuth(c); err != nil {
+		t.Errorf("Expected: no error validating a valid configuration, actual: %v", err)
+	}
+	c.Policy = "sometimes"
+	if err := ValidateClientCertAuth(c); err == nil {
+		t.Error("Expected: an error for an unknown policy, actual: nil")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	goodCfg, err := tempFileWith([]byte(goodConfig))
+	if err != nil {
+		t.Fatalf("cannot create temp file: %v", err)
+	}
+	defer os.Remove(goodCfg)
+	goodDbCfg, err := tempFileWith([]byte(goodDbConfig))
+	if err != nil {
+		t.Fatalf("cannot create temp file: %v", err)
+	}
+	defer os.Remove(goodDbCfg)
+
+	loaded, errs, _ := LoadConfig(goodCfg, goodDbCfg, "Test Version")
+	if len(errs) != 0 {
+		t.Fatalf("loading config: %v", errs)
+	}
+	loaded.DB.Password = "dbpassword"
+	loaded.Secrets = []string{"cookiesecret"}
+	loaded.PluginConfig = map[string]json.RawMessage{"plugin": json.RawMessage(`{"api_key": "pluginkey", "name": "plugin"}`)}
+
+	redacted, err := loaded.RedactedJSON()
+	if err != nil {
+		t.Fatalf("redacting config: %v", err)
+	}
+	for _, credential := range []string{"dbpassword", "cookiesecret", "pluginkey"} {
+		if strings.Contains(string(redacted), credential) {
+			t.Errorf("expected credential '%s' to be redacted, actual: %s", credential, redacted)
+		}
+	}
+	if !strings.Contains(string(redacted), `"name":"plugin"`) || !strings.Contains(string(redacted), `"user_token_expiration_sec":`) {
+		t.Errorf("expected settings which aren't credentials to be kept, actual: %s", redacted)
+	}
+
+	fingerprint, err := loaded.Fingerprint()
+	if err != nil {
+		t.Fatalf("fingerprinting config: %v", err)
+	}
+	if len(fingerprint) != 64 {
+		t.Errorf("expected a hex SHA-256 fingerprint, actual: '%s'", fingerprint)
+	}
+	if again, err := loaded.Fingerprint(); err != nil || again != fingerprint {
+		t.Errorf("expected the same config to have the same fingerprint '%s', actual: '%s' %v", fingerprint, again, err)
+	}
+
+	changed := loaded
+	changed.DB.Password = "otherpassword"
+	if other, err := changed.Fingerprint(); err != nil || other != fingerprint {
+		t.Errorf("expected a changed credential to not change the fingerprint '%s', actual: '%s' %v", fingerprint, other, err)
+	}
+	changed.MaxDBConnections++
+	if other, err := changed.Fingerprint(); err != nil || other == fingerprint {
+		t.Errorf("expected a changed setting to change the fingerprint, actual: '%s' %v", other, err)
+	}
+}
+
+func TestRouteMetrics(t *testing.T) {
+	if buckets := (ConfigRouteMetrics{}).LatencyBuckets(); len(buckets) != len(DefaultRouteLatencyBucketsMS) || buckets[0] != DefaultRouteLatencyBucketsMS[0]/1000 {
+		t.Errorf("expected the default latency buckets in seconds, actual: %v", buckets)
+	}
+	c := ConfigRouteMetrics{LatencyBucketsMS: []float64{1.5, 20, 300}}
+	if err := ValidateRouteMetrics(c); err != nil {
+		t.Errorf("expected increasing positive latency buckets to be valid, actual: %v", err)
+	}
+	if buckets := c.LatencyBuckets(); len(buckets) != 3 || buckets[0] != 0.0015 || buckets[2] != 0.3 {
+		t.Errorf("expected the configured latency buckets in seconds, actual: %v", buckets)
+	}
+	for _, invalid := range [][]float64{{0, 10}, {-5}, {10, 10}, {20, 10}} {
+		if err := ValidateRouteMetrics(ConfigRouteMetrics{LatencyBucketsMS: invalid}); err == nil {
+			t.Errorf("expected latency buckets %v to be invalid", invalid)
+		}
+	}
+}
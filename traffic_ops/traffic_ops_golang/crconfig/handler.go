@@ -76,13 +76,20 @@ func SnapshotGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the snapshot only changes when a CDN is snapshotted, so caches polling it are answered with 304 until then
+	emulate := inf.Version.Major < 4 || (inf.Config != nil && inf.Config.CRConfigEmulateOldPath)
+	etag := api.ContentETag([]byte(snapshot), []byte(strconv.FormatBool(emulate)))
+	if api.WriteNotModified(w, r, etag, "snapshot", len(snapshot)) {
+		return
+	}
+
 	var decoded tc.CRConfig
 	if err = json.Unmarshal([]byte(snapshot), &decoded); err != nil {
 		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("failed to unmarshal stored snapshot for cdn '%s': %v", inf.Params["cdn"], err))
 		return
 	}
 
-	if inf.Version.Major < 4 || (inf.Config != nil && inf.Config.CRConfigEmulateOldPath) {
+	if emulate {
 		decoded.Stats.TMPath = new(string)
 		*decoded.Stats.TMPath = fmt.Sprintf("/api/4.0/cdns/%s/snapshot", inf.Params["cdn"])
 	}
@@ -110,8 +117,12 @@ func SnapshotGetMonitoringHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	resp := []byte(`{"response":` + snapshot + `}`)
+	if api.WriteNotModified(w, r, api.ContentETag(resp), "monitoring", len(resp)) {
+		return
+	}
 	w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
-	api.WriteAndLogErr(w, r, []byte(`{"response":`+snapshot+`}`))
+	api.WriteAndLogErr(w, r, resp)
 }
 
 // SnapshotHandler creates the CRConfig JSON and writes it to the snapshot table in the database.
@@ -63,11 +63,35 @@ WHERE name='tm.instance_name' AND
       config_file=$1
 `
 const userQueryByEmail = `SELECT EXISTS(SELECT * FROM tm_user WHERE email=$1)`
-const setTokenQuery = `UPDATE tm_user SET token=$1 WHERE email=$2`
+const setTokenQuery = `UPDATE tm_user SET token=$1, token_expiration=$3 WHERE email=$2`
 
 // UpdateLoginTimeQuery is meant to only update the last_authenticated field once per minute in order to avoid row-locking when the same user logs in frequently.
 const UpdateLoginTimeQuery = `UPDATE tm_user SET last_authenticated = NOW() WHERE username=$1 AND (last_authenticated IS NULL OR last_authenticated < NOW() - INTERVAL '1 MINUTE')`
 
+// inReadOnlyMode returns whether Traffic Ops is in read-only mode, as set by
+// SetReadOnlyModeFunc.
+var inReadOnlyMode = func() bool { return false }
+
+// SetReadOnlyModeFunc sets the func used to check whether Traffic Ops is in
+// read-only mode, in which logging in doesn't update the user's last
+// authentication time, because the database may not accept writes.
+func SetReadOnlyModeFunc(f func() bool) {
+	inReadOnlyMode = f
+}
+
+// updateLoginTime updates the last authentication time of the user, unless
+// Traffic Ops is in read-only mode.
+func updateLoginTime(ex interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, username string) error {
+	if inReadOnlyMode() {
+		log.Infof("in read-only mode, not updating the authentication time of user '%s'\n", username)
+		return nil
+	}
+	_, err := ex.Exec(UpdateLoginTimeQuery, username)
+	return err
+}
+
 const defaultCookieDuration = 6 * time.Hour
 
 var resetPasswordEmailTemplate = template.Must(template.New("Password Reset Email").Parse("From: {{.From.Address.Address}}\r" + `
@@ -205,7 +229,7 @@ func LoginHandler(db *sqlx.DB, cfg config.Config) http.HandlerFunc {
 						log.Errorln("committing transaction: " + err.Error())
 					}
 				}()
-				_, dbErr := tx.Exec(UpdateLoginTimeQuery, form.Username)
+				dbErr := updateLoginTime(tx, form.Username)
 				if dbErr != nil {
 					log.Errorf("unable to update authentication time for a given user: %s\n", dbErr.Error())
 					resp = struct {
@@ -249,7 +273,7 @@ func TokenLoginHandler(db *sqlx.DB, cfg config.Config) http.HandlerFunc {
 			return
 		}
 
-		tokenMatches, username, err := auth.CheckLocalUserToken(t.Token, db, time.Duration(cfg.DBQueryTimeoutSeconds)*time.Second)
+		tokenMatches, username, err := auth.CheckLocalUserToken(r.Context(), t.Token, db, time.Duration(cfg.DBQueryTimeoutSeconds)*time.Second)
 		if err != nil {
 			sysErr := fmt.Errorf("Checking token: %v", err)
 			errCode := http.StatusInternalServerError
@@ -272,7 +296,7 @@ func TokenLoginHandler(db *sqlx.DB, cfg config.Config) http.HandlerFunc {
 			return
 		}
 
-		_, dbErr := db.Exec(UpdateLoginTimeQuery, username)
+		dbErr := updateLoginTime(db, username)
 		if dbErr != nil {
 			dbErr = fmt.Errorf("unable to update authentication time for user '%s': %w", username, dbErr)
 			api.HandleErr(w, r, nil, http.StatusInternalServerError, nil, dbErr)
@@ -455,7 +479,7 @@ func OauthLoginHandler(db *sqlx.DB, cfg config.Config) http.HandlerFunc {
 		}
 
 		if userAllowed {
-			_, dbErr := db.Exec(UpdateLoginTimeQuery, form.Username)
+			dbErr := updateLoginTime(db, form.Username)
 			if dbErr != nil {
 				dbErr = fmt.Errorf("unable to update authentication time for user '%s': %w", form.Username, dbErr)
 				api.HandleErr(w, r, nil, http.StatusInternalServerError, nil, dbErr)
@@ -522,13 +546,13 @@ func generateToken() (string, error) {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", t[0:4], t[4:6], t[6:8], t[8:10], t[10:]), nil
 }
 
-func setToken(addr rfc.EmailAddress, tx *sql.Tx) (string, error) {
+func setToken(addr rfc.EmailAddress, expiration *time.Time, tx *sql.Tx) (string, error) {
 	token, err := generateToken()
 	if err != nil {
 		return "", err
 	}
 
-	if _, err = tx.Exec(setTokenQuery, token, addr.Address.Address); err != nil {
+	if _, err = tx.Exec(setTokenQuery, token, addr.Address.Address, expiration); err != nil {
 		return "", err
 	}
 	return token, nil
@@ -593,7 +617,7 @@ func ResetPassword(db *sqlx.DB, cfg config.Config) http.HandlerFunc {
 			return
 		}
 
-		token, err := setToken(req.Email, tx)
+		token, err := setToken(req.Email, cfg.UserTokenExpiration(), tx)
 		if err != nil {
 			sysErr = fmt.Errorf("Failed to generate and insert UUID: %v", err)
 			errCode = http.StatusInternalServerError
@@ -30,6 +30,8 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-rfc"
 
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
 )
 
 func TestLoginWithEmptyCredentials(t *testing.T) {
@@ -116,3 +118,29 @@ func TestTemplateRender(t *testing.T) {
 	}
 	t.Logf("%s", tmpl.String())
 }
+
+func TestUpdateLoginTime(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDB.Close()
+	defer SetReadOnlyModeFunc(func() bool { return false })
+
+	readOnly := false
+	SetReadOnlyModeFunc(func() bool { return readOnly })
+
+	mock.ExpectExec("UPDATE tm_user SET last_authenticated").WithArgs("admin").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := updateLoginTime(mockDB, "admin"); err != nil {
+		t.Errorf("expected no error updating the login time, actual: %v", err)
+	}
+
+	// the database of a Traffic Ops in read-only mode may not accept writes.
+	readOnly = true
+	if err := updateLoginTime(mockDB, "admin"); err != nil {
+		t.Errorf("expected no error in read-only mode, actual: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected the login time to be updated only outside of read-only mode: %v", err)
+	}
+}
@@ -28,6 +28,7 @@ import "errors"
 import "fmt"
 import "html/template"
 import "net/http"
+import "time"
 
 import "github.com/apache/trafficcontrol/lib/go-log"
 import "github.com/apache/trafficcontrol/lib/go-rfc"
@@ -52,6 +53,7 @@ INSERT INTO tm_user (email,
                      role,
                      tenant_id,
                      token,
+                     token_expiration,
                      username)
 VALUES ($1,
         TRUE,
@@ -59,6 +61,7 @@ VALUES ($1,
         $2,
         $3,
         $4,
+        $5,
         'registration_' || (SELECT md5(random()::text)))
 RETURNING (
 	SELECT role.name
@@ -77,7 +80,8 @@ UPDATE tm_user
 SET registration_sent = now(),
     role = $1,
     tenant_id = $2,
-    token = $3
+    token = $3,
+    token_expiration = $5
 WHERE email = $4
 RETURNING (
 	SELECT role.name
@@ -261,9 +265,9 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		role, tenant, err = renewRegistration(tx, req, t, user)
+		role, tenant, err = renewRegistration(tx, req, t, inf.Config.UserTokenExpiration(), user)
 	} else {
-		role, tenant, err = newRegistration(tx, req, t)
+		role, tenant, err = newRegistration(tx, req, t, inf.Config.UserTokenExpiration())
 	}
 
 	if err != nil {
@@ -297,11 +301,11 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 	api.CreateChangeLogRawTx(api.ApiChange, changeLog, inf.User, tx)
 }
 
-func renewRegistration(tx *sql.Tx, req tc.UserRegistrationRequest, t string, u tc.User) (string, string, error) {
+func renewRegistration(tx *sql.Tx, req tc.UserRegistrationRequest, t string, expiration *time.Time, u tc.User) (string, string, error) {
 	var role string
 	var tenant string
 
-	var row = tx.QueryRow(renewRegistrationQuery, req.Role, req.TenantID, t, *u.Email)
+	var row = tx.QueryRow(renewRegistrationQuery, req.Role, req.TenantID, t, *u.Email, expiration)
 	if err := row.Scan(&role, &tenant); err != nil {
 		return "", "", err
 	}
@@ -309,11 +313,11 @@ func renewRegistration(tx *sql.Tx, req tc.UserRegistrationRequest, t string, u t
 	return role, tenant, nil
 }
 
-func newRegistration(tx *sql.Tx, req tc.UserRegistrationRequest, t string) (string, string, error) {
+func newRegistration(tx *sql.Tx, req tc.UserRegistrationRequest, t string, expiration *time.Time) (string, string, error) {
 	var role string
 	var tenant string
 
-	var row = tx.QueryRow(registerUserQuery, req.Email.Address.Address, req.Role, req.TenantID, t)
+	var row = tx.QueryRow(registerUserQuery, req.Email.Address.Address, req.Role, req.TenantID, t, expiration)
 	if err := row.Scan(&role, &tenant); err != nil {
 		return "", "", err
 	}
@@ -0,0 +1,141 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/about"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// about_info is a reference plugin using every hook: load reads its config,
+// startup sets up the context shared with onRequest, and onRequest serves an
+// endpoint with the Traffic Ops build info, the enabled plugins, and the
+// plugin's own config.
+func init() {
+	AddPlugin(10000, Funcs{load: aboutInfoLoad, onStartup: aboutInfoStartup, onRequest: aboutInfoOnRequest}, "reference plugin serving build, version and plugin info", "1.0.0")
+}
+
+// AboutInfoDefaultPath is the path the about_info plugin serves, unless
+// configured otherwise.
+const AboutInfoDefaultPath = "/_about"
+
+// AboutInfoConfig is the config of the about_info plugin, e.g.
+// {"plugin_config": {"about_info": {"path": "/_about", "unauthenticated": false}}}
+type AboutInfoConfig struct {
+	// Path is the request path served. Default is AboutInfoDefaultPath.
+	Path string `json:"path"`
+	// Unauthenticated serves the path without requiring the client to be
+	// logged in. Default is false.
+	Unauthenticated bool `json:"unauthenticated"`
+}
+
+// AboutInfo is the response of the about_info plugin.
+type AboutInfo struct {
+	About     interface{}     `json:"about"`
+	Plugins   []AboutInfoItem `json:"plugins"`
+	Config    AboutInfoConfig `json:"config"`
+	StartTime time.Time       `json:"startTime"`
+	Requests  uint64          `json:"requests"`
+}
+
+// AboutInfoItem is the Info of an enabled plugin.
+type AboutInfoItem struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+// aboutInfoContext is the context of the about_info plugin, set up at startup.
+type aboutInfoContext struct {
+	cfg       AboutInfoConfig
+	plugins   []AboutInfoItem
+	startTime time.Time
+	requests  uint64
+}
+
+func aboutInfoLoad(b json.RawMessage) interface{} {
+	cfg := AboutInfoConfig{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return fmt.Errorf("config should look like {\"path\": \"%s\", \"unauthenticated\": false}: %w", AboutInfoDefaultPath, err)
+	}
+	if cfg.Path == "" {
+		cfg.Path = AboutInfoDefaultPath
+	}
+	return &cfg
+}
+
+func aboutInfoStartup(d StartupData) {
+	// without a plugin_config entry, load isn't called.
+	cfg := AboutInfoConfig{Path: AboutInfoDefaultPath}
+	if loaded, ok := d.Cfg.(*AboutInfoConfig); ok {
+		cfg = *loaded
+	}
+
+	ctx := &aboutInfoContext{cfg: cfg, startTime: time.Now()}
+	for _, info := range d.Plugins {
+		ctx.plugins = append(ctx.plugins, AboutInfoItem{Name: info.Name, Description: info.Description, Version: info.Version})
+	}
+	*d.Ctx = ctx
+	log.Infof("about_info plugin: serving %s\n", cfg.Path)
+}
+
+func aboutInfoOnRequest(d OnRequestData) IsRequestHandled {
+	ctx, ok := (*d.Ctx).(*aboutInfoContext)
+	if !ok || d.R.URL.Path != ctx.cfg.Path {
+		return RequestUnhandled
+	}
+	if d.R.Method != http.MethodGet {
+		aboutInfoErr(d, http.StatusMethodNotAllowed, nil, nil)
+		return RequestHandled
+	}
+	if !ctx.cfg.Unauthenticated {
+		if _, userErr, sysErr, errCode := api.GetUserFromReq(d.W, d.R, d.AppCfg.Secrets[0]); userErr != nil || sysErr != nil {
+			aboutInfoErr(d, errCode, userErr, sysErr)
+			return RequestHandled
+		}
+	}
+
+	resp := AboutInfo{
+		About:     about.About,
+		Plugins:   ctx.plugins,
+		Config:    ctx.cfg,
+		StartTime: ctx.startTime,
+		Requests:  atomic.AddUint64(&ctx.requests, 1),
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		aboutInfoErr(d, http.StatusInternalServerError, nil, err)
+		return RequestHandled
+	}
+	d.W.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+	api.WriteAndLogErr(d.W, d.R, b)
+	return RequestHandled
+}
+
+// aboutInfoErr writes an error response. Plugins handle requests before any
+// of the middleware which would otherwise write the status code.
+func aboutInfoErr(d OnRequestData, code int, userErr error, sysErr error) {
+	d.W.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+	d.W.WriteHeader(code)
+	api.HandleErr(d.W, d.R, nil, code, userErr, sysErr)
+}
@@ -0,0 +1,108 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+)
+
+// startPlugins goes through the plugin lifecycle the way Traffic Ops does:
+// loading the enabled plugins and their config, then calling their startup
+// hooks.
+func startPlugins(cfg config.Config) Plugins {
+	ps := Get(cfg)
+	ps.OnStartup(StartupData{Data: Data{SharedCfg: cfg.PluginSharedConfig, AppCfg: cfg}})
+	return ps
+}
+
+func aboutInfoRequest(ps Plugins, cfg config.Config, path string) (*httptest.ResponseRecorder, bool) {
+	w := httptest.NewRecorder()
+	handled := ps.OnRequest(OnRequestData{Data: Data{AppCfg: cfg}, W: w, R: httptest.NewRequest(http.MethodGet, path, nil)})
+	return w, handled
+}
+
+func TestAboutInfoPlugin(t *testing.T) {
+	cfg := config.Config{Secrets: []string{"secret"}}
+	cfg.Plugins = []string{"about_info", "hello_world"}
+	cfg.PluginConfig = map[string]json.RawMessage{"about_info": json.RawMessage(`{"path": "/_info", "unauthenticated": true}`)}
+	ps := startPlugins(cfg)
+
+	for i := uint64(1); i <= 2; i++ {
+		w, handled := aboutInfoRequest(ps, cfg, "/_info")
+		if !handled {
+			t.Fatalf("expected the configured path to be handled by the about_info plugin")
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected response code %d, actual: %d", http.StatusOK, w.Code)
+		}
+		info := AboutInfo{}
+		if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+			t.Fatalf("decoding about_info response: %v", err)
+		}
+		if info.Config.Path != "/_info" || !info.Config.Unauthenticated {
+			t.Errorf("expected the loaded config to be returned, actual: %+v", info.Config)
+		}
+		names := map[string]bool{}
+		for _, p := range info.Plugins {
+			names[p.Name] = true
+		}
+		if len(info.Plugins) != 2 || !names["about_info"] || !names["hello_world"] {
+			t.Errorf("expected the enabled plugins [about_info hello_world], actual: %+v", info.Plugins)
+		}
+		if info.Requests != i {
+			t.Errorf("expected %d requests counted in the plugin context, actual: %d", i, info.Requests)
+		}
+		if info.StartTime.IsZero() {
+			t.Error("expected the start time set at startup")
+		}
+	}
+
+	if _, handled := aboutInfoRequest(ps, cfg, AboutInfoDefaultPath); handled {
+		t.Errorf("expected the default path not to be handled when another path is configured")
+	}
+	if w, handled := aboutInfoRequest(ps, cfg, HelloPath); !handled || w.Body.String() != "Hello, World!" {
+		t.Errorf("expected other plugins to still handle their requests, actual handled: %t, body: '%s'", handled, w.Body.String())
+	}
+}
+
+func TestAboutInfoPluginDefaults(t *testing.T) {
+	cfg := config.Config{Secrets: []string{"secret"}}
+	cfg.Plugins = []string{"about_info"}
+	ps := startPlugins(cfg)
+
+	w, handled := aboutInfoRequest(ps, cfg, AboutInfoDefaultPath)
+	if !handled {
+		t.Fatalf("expected the default path to be handled without a plugin config")
+	}
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected response code %d without a login, actual: %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestAboutInfoPluginDisabled(t *testing.T) {
+	cfg := config.Config{Secrets: []string{"secret"}}
+	cfg.Plugins = []string{"hello_world"}
+	cfg.PluginConfig = map[string]json.RawMessage{"about_info": json.RawMessage(`{"unauthenticated": true}`)}
+	ps := startPlugins(cfg)
+
+	if _, handled := aboutInfoRequest(ps, cfg, AboutInfoDefaultPath); handled {
+		t.Errorf("expected the about_info plugin not to handle requests unless enabled")
+	}
+}
@@ -19,7 +19,7 @@ import (
 )
 
 func init() {
-	AddPlugin(10000, Funcs{onStartup: helloCtxStart, onRequest: helloCtxOnReq}, "example plugin for passing context data between hook functions", "1.0.0")
+	AddPlugin(10000, Funcs{onStartup: helloCtxStart, onRequest: helloCtxOnReq, onShutdown: helloCtxShutdown}, "example plugin for passing context data between hook functions", "1.0.0")
 }
 
 func helloCtxStart(d StartupData) {
@@ -32,3 +32,8 @@ func helloCtxOnReq(d OnRequestData) IsRequestHandled {
 	log.Debugf("Hello! This is a context plugin! On Request got context: %+v %+v\n", ok, ctx)
 	return RequestUnhandled
 }
+
+func helloCtxShutdown(d ShutdownData) {
+	ctx, ok := (*d.Ctx).(int)
+	log.Debugf("Hello! This is a context plugin! Shutdown got context: %+v %+v\n", ok, ctx)
+}
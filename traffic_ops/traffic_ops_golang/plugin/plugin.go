@@ -49,7 +49,9 @@ func Get(appCfg config.Config) Plugins {
 	
 	// cdn.confに指定された「plugin_config」の設定が入る
 	// 設定例: {"plugin_config": {"hello_config":{"hello": "anything can go here"}}}
-	pluginCfg := loadConfig(pluginSlice, appCfg.PluginConfig)
+	// 設定の読み込みに失敗したプラグインは無効にする
+	pluginCfg, failed := loadConfig(pluginSlice, appCfg.PluginConfig)
+	pluginSlice = withoutPlugins(pluginSlice, failed)
 
 	ctx := map[string]*interface{}{}
 	return plugins{slice: pluginSlice, cfg: pluginCfg, ctx: ctx}
@@ -86,15 +88,54 @@ func getEnabled(enabled []string) pluginsSlice {
 	return enabledPlugins
 }
 
-func loadConfig(ps pluginsSlice, configJSON map[string]json.RawMessage) map[string]interface{} {
+// loadConfig loads the config of each plugin with a LoadFunc, returning the
+// loaded configs and the names of the plugins whose config failed to load.
+func loadConfig(ps pluginsSlice, configJSON map[string]json.RawMessage) (map[string]interface{}, map[string]struct{}) {
 	pluginConfigLoaders := loadFuncs(ps)
 	cfg := make(map[string]interface{}, len(configJSON))
+	failed := map[string]struct{}{}
 	for name, b := range configJSON {
-		if loadF := pluginConfigLoaders[name]; loadF != nil {
-			cfg[name] = loadF(b)
+		loadF := pluginConfigLoaders[name]
+		if loadF == nil {
+			continue
+		}
+		loaded, err := safeLoad(loadF, b)
+		if err != nil {
+			log.Errorf("plugin '%s' disabled: loading config: %v\n", name, err)
+			failed[name] = struct{}{}
+			continue
+		}
+		cfg[name] = loaded
+	}
+	return cfg, failed
+}
+
+// safeLoad calls the given LoadFunc, returning an error if it panics, or if
+// the config it returns is an error.
+func safeLoad(loadF LoadFunc, b json.RawMessage) (cfg interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			cfg, err = nil, fmt.Errorf("panic: %v", r)
 		}
+	}()
+	cfg = loadF(b)
+	if loadErr, ok := cfg.(error); ok {
+		return nil, loadErr
 	}
-	return cfg
+	return cfg, nil
+}
+
+func withoutPlugins(ps pluginsSlice, names map[string]struct{}) pluginsSlice {
+	if len(names) == 0 {
+		return ps
+	}
+	without := pluginsSlice{}
+	for _, p := range ps {
+		if _, ok := names[p.info.Name]; !ok {
+			without = append(without, p)
+		}
+	}
+	return without
 }
 
 func loadFuncs(ps pluginsSlice) map[string]LoadFunc {
@@ -111,6 +152,7 @@ func loadFuncs(ps pluginsSlice) map[string]LoadFunc {
 type Plugins interface {
 	OnStartup(d StartupData)
 	OnRequest(d OnRequestData) bool
+	OnShutdown(d ShutdownData, timeout time.Duration)
 	GetInfo() []Info
 }
 
@@ -133,9 +175,10 @@ func AddPlugin(priority uint64, funcs Funcs, description, version string) {
 }
 
 type Funcs struct {
-	load      LoadFunc
-	onStartup StartupFunc
-	onRequest OnRequestFunc
+	load       LoadFunc
+	onStartup  StartupFunc
+	onRequest  OnRequestFunc
+	onShutdown ShutdownFunc
 }
 
 // Data is the common plugin data, given to most plugin hooks. This is designed to be embedded in the data structs for specific hooks.
@@ -149,6 +192,8 @@ type Data struct {
 
 type StartupData struct {
 	Data
+	// Plugins is the Info of every enabled plugin.
+	Plugins []Info
 }
 
 type OnRequestData struct {
@@ -157,6 +202,10 @@ type OnRequestData struct {
 	R *http.Request
 }
 
+type ShutdownData struct {
+	Data
+}
+
 type IsRequestHandled bool
 
 const (
@@ -164,9 +213,12 @@ const (
 	RequestUnhandled = IsRequestHandled(false)
 )
 
+// LoadFunc loads a plugin's config from its JSON. If it returns an error, or
+// panics, the plugin is disabled.
 type LoadFunc func(json.RawMessage) interface{}
 type StartupFunc func(d StartupData)
 type OnRequestFunc func(d OnRequestData) IsRequestHandled
+type ShutdownFunc func(d ShutdownData)
 
 type pluginObj struct {
 	funcs    Funcs
@@ -196,6 +248,7 @@ func (p pluginsSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 var initPlugins = pluginsSlice{}
 
 func (ps plugins) OnStartup(d StartupData) {
+	d.Plugins = ps.GetInfo()
 
 	// プラグイン毎にイテレーションする
 	// ps.sliceはmainでの「plugins := plugin.Get(cfg)」の結果で渡されてきたプラグインのスライスを表します。
@@ -236,6 +289,52 @@ func (ps plugins) OnRequest(d OnRequestData) bool {
 	return false
 }
 
+// DefaultShutdownTimeout is how long OnShutdown waits for each plugin's
+// shutdown hook, unless configured otherwise.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// OnShutdown calls the shutdown hook of every plugin, in the reverse of the
+// order their startup hooks were called, so a plugin can release resources
+// which other plugins started after it may depend on. Each hook is given the
+// same Ctx as its other hooks. A hook which doesn't return within the timeout
+// is abandoned, and a hook which panics is logged; neither stops the shutdown
+// hooks of the remaining plugins from being called.
+func (ps plugins) OnShutdown(d ShutdownData, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	for i := len(ps.slice) - 1; i >= 0; i-- {
+		p := ps.slice[i]
+		if p.funcs.onShutdown == nil {
+			continue
+		}
+		d.Ctx = ps.ctx[p.info.Name]
+		if d.Ctx == nil {
+			// OnStartup was never called.
+			ictx := interface{}(nil)
+			d.Ctx = &ictx
+		}
+		d.Cfg = ps.cfg[p.info.Name]
+
+		done := make(chan struct{})
+		go func(d ShutdownData) {
+			defer close(done)
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("plugin '%s' shutdown panicked: %v\n", p.info.Name, r)
+				}
+			}()
+			p.funcs.onShutdown(d)
+		}(d)
+
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			log.Errorf("plugin '%s' shutdown did not finish within %v, continuing\n", p.info.Name, timeout)
+		}
+	}
+}
+
 func (ps plugins) GetInfo() []Info {
 	pluginsInfo := []Info{}
 	for _, p := range ps.slice {
@@ -0,0 +1,111 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+)
+
+func TestLoadConfigFailures(t *testing.T) {
+	ps := pluginsSlice{
+		{info: Info{Name: "ok"}, funcs: Funcs{load: func(b json.RawMessage) interface{} { return string(b) }}},
+		{info: Info{Name: "panics"}, funcs: Funcs{load: func(b json.RawMessage) interface{} { panic("malformed") }}},
+		{info: Info{Name: "errors"}, funcs: Funcs{load: func(b json.RawMessage) interface{} { return errors.New("malformed") }}},
+	}
+	cfg, failed := loadConfig(ps, map[string]json.RawMessage{
+		"ok":     json.RawMessage(`{}`),
+		"panics": json.RawMessage(`{`),
+		"errors": json.RawMessage(`{`),
+	})
+	if cfg["ok"] != "{}" {
+		t.Errorf("expected the config of plugin 'ok' to be loaded, actual: %v", cfg["ok"])
+	}
+	for _, name := range []string{"panics", "errors"} {
+		if _, ok := failed[name]; !ok {
+			t.Errorf("expected plugin '%s' to fail to load its config", name)
+		}
+		if _, ok := cfg[name]; ok {
+			t.Errorf("expected no config for plugin '%s', actual: %v", name, cfg[name])
+		}
+	}
+	if _, ok := failed["ok"]; ok {
+		t.Error("expected plugin 'ok' not to fail to load its config")
+	}
+
+	remaining := withoutPlugins(ps, failed)
+	if len(remaining) != 1 || remaining[0].info.Name != "ok" {
+		t.Errorf("expected only plugin 'ok' to remain enabled, actual: %+v", remaining)
+	}
+}
+
+func TestGetDisablesPluginWithMalformedConfig(t *testing.T) {
+	cfg := config.Config{Secrets: []string{"secret"}}
+	cfg.Plugins = []string{"about_info", "hello_world"}
+	cfg.PluginConfig = map[string]json.RawMessage{"about_info": json.RawMessage(`{"path": 42}`)}
+	ps := startPlugins(cfg)
+
+	infos := ps.GetInfo()
+	if len(infos) != 1 || infos[0].Name != "hello_world" {
+		t.Errorf("expected a plugin with a malformed config to be disabled, actual enabled plugins: %+v", infos)
+	}
+	if _, handled := aboutInfoRequest(ps, cfg, AboutInfoDefaultPath); handled {
+		t.Error("expected a plugin with a malformed config not to handle requests")
+	}
+	if w, handled := aboutInfoRequest(ps, cfg, HelloPath); !handled || w.Body.String() != "Hello, World!" {
+		t.Errorf("expected other plugins to still handle their requests, actual handled: %t, body: '%s'", handled, w.Body.String())
+	}
+}
+
+func TestOnShutdown(t *testing.T) {
+	calls := make(chan string, 10)
+	shutdown := func(name string) ShutdownFunc {
+		return func(d ShutdownData) {
+			calls <- name + ":" + (*d.Ctx).(string)
+		}
+	}
+	startup := func(d StartupData) {
+		*d.Ctx = "ctx"
+	}
+	release := make(chan struct{})
+	defer close(release)
+
+	ps := plugins{
+		slice: pluginsSlice{
+			{info: Info{Name: "first"}, priority: 1, funcs: Funcs{onStartup: startup, onShutdown: shutdown("first")}},
+			{info: Info{Name: "panics"}, priority: 2, funcs: Funcs{onStartup: startup, onShutdown: func(d ShutdownData) { panic("closing") }}},
+			{info: Info{Name: "none"}, priority: 3, funcs: Funcs{onStartup: startup}},
+			{info: Info{Name: "hangs"}, priority: 4, funcs: Funcs{onStartup: startup, onShutdown: func(d ShutdownData) { <-release }}},
+			{info: Info{Name: "last"}, priority: 5, funcs: Funcs{onStartup: startup, onShutdown: shutdown("last")}},
+		},
+		cfg: map[string]interface{}{},
+		ctx: map[string]*interface{}{},
+	}
+	ps.OnStartup(StartupData{})
+	ps.OnShutdown(ShutdownData{}, 10*time.Millisecond)
+	close(calls)
+
+	actual := []string{}
+	for call := range calls {
+		actual = append(actual, call)
+	}
+	if len(actual) != 2 || actual[0] != "last:ctx" || actual[1] != "first:ctx" {
+		t.Errorf("expected shutdown hooks [last:ctx first:ctx] in reverse priority order, past a hanging and a panicking hook, actual: %v", actual)
+	}
+}
@@ -0,0 +1,212 @@
+package profiler
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
+)
+
+// continuousDuration is the duration of each CPU profile written by
+// continuous profiling.
+var continuousDuration = time.Minute
+
+// continuous is the continuous profiling state. Continuous profiling writes a
+// CPU profile to the profiling location every continuousDuration while it's
+// enabled.
+var continuous = struct {
+	m       sync.Mutex
+	enabled *bool
+	version string
+	// running is whether the continuous profiling goroutine is running.
+	running  bool
+	files    uint64
+	lastFile string
+}{enabled: new(bool)}
+
+// ContinuousStatus is the state of continuous profiling, as returned by the
+// continuous profiling endpoint.
+type ContinuousStatus struct {
+	Enabled  bool   `json:"enabled"`
+	Running  bool   `json:"running"`
+	Location string `json:"location"`
+	// Files is the number of profile files written since Traffic Ops started.
+	Files    uint64 `json:"files"`
+	LastFile string `json:"lastFile,omitempty"`
+}
+
+// ContinuousRequest is the request to the continuous profiling endpoint to
+// enable or disable it.
+type ContinuousRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// InitContinuous sets the flag which controls continuous profiling, and the
+// version written in profile file names, starting continuous profiling if
+// the flag is set. The flag must only be changed with SetContinuous after.
+func InitContinuous(enabled *bool, version string) {
+	continuous.m.Lock()
+	defer continuous.m.Unlock()
+	continuous.enabled = enabled
+	continuous.version = version
+	startContinuous()
+}
+
+// SetContinuous enables or disables continuous profiling. Calls are
+// serialized, and a disabled profiler stops once the profile it's taking is
+// written.
+func SetContinuous(enabled bool) {
+	continuous.m.Lock()
+	defer continuous.m.Unlock()
+	if *continuous.enabled != enabled {
+		log.Infof("profiling enabled set to %t\n", enabled)
+	}
+	*continuous.enabled = enabled
+	startContinuous()
+}
+
+// GetContinuousStatus returns the current state of continuous profiling.
+func GetContinuousStatus() ContinuousStatus {
+	continuous.m.Lock()
+	defer continuous.m.Unlock()
+	return ContinuousStatus{
+		Enabled:  *continuous.enabled,
+		Running:  continuous.running,
+		Location: getDirectory(),
+		Files:    continuous.files,
+		LastFile: continuous.lastFile,
+	}
+}
+
+// startContinuous starts the continuous profiling goroutine, if it's enabled
+// and not already running. The caller must hold continuous.m.
+func startContinuous() {
+	if continuous.running || !*continuous.enabled || getDirectory() == "" {
+		return
+	}
+	continuous.running = true
+	go runContinuous(continuous.version)
+}
+
+// continueContinuous returns whether continuous profiling should take another
+// profile, and marks it stopped if not.
+func continueContinuous() bool {
+	continuous.m.Lock()
+	defer continuous.m.Unlock()
+	if !*continuous.enabled || getDirectory() == "" {
+		continuous.running = false
+		return false
+	}
+	return true
+}
+
+func stopContinuous() {
+	continuous.m.Lock()
+	defer continuous.m.Unlock()
+	continuous.running = false
+}
+
+func runContinuous(version string) {
+	for continueContinuous() {
+		// APIから要求されたCPUプロファイルの計測中であれば、この間の計測はスキップする
+		if !TryStartCPU() {
+			log.Infoln("another CPU profile is being taken, skipping a minute of continuous profiling")
+			time.Sleep(continuousDuration)
+			continue
+		}
+
+		// プロファイル用のファイル名を「tocpu-<version>-<time>.pprof」として生成する
+		now := time.Now().UTC()
+		filename := filepath.Join(getDirectory(), fmt.Sprintf("tocpu-%s-%s.pprof", version, now.Format(time.RFC3339)))
+		f, err := os.Create(filename)
+		if err != nil {
+			StopCPU()
+			log.Errorf("creating profile: %v\n", err)
+			log.Infof("Exiting profiling")
+			stopContinuous()
+			return
+		}
+
+		// プロファイリングを計測する。 see: https://pkg.go.dev/runtime/pprof
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Errorf("starting CPU profile: %v\n", err)
+		} else {
+			time.Sleep(continuousDuration)
+			pprof.StopCPUProfile()
+		}
+		StopCPU()
+		f.Close()
+
+		continuous.m.Lock()
+		continuous.files++
+		continuous.lastFile = filename
+		continuous.m.Unlock()
+	}
+}
+
+// ContinuousHandler is the handler for GET requests to the continuous
+// profiling endpoint, which returns its state.
+func ContinuousHandler(w http.ResponseWriter, r *http.Request) {
+	api.WriteResp(w, r, GetContinuousStatus())
+}
+
+// PutContinuousHandler is the handler for PUT requests to the continuous
+// profiling endpoint, which enables or disables it without reloading the
+// configuration.
+func PutContinuousHandler(w http.ResponseWriter, r *http.Request) {
+	var req ContinuousRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.HandleErr(w, r, nil, http.StatusBadRequest, errors.New("malformed JSON: "+err.Error()), nil)
+		return
+	}
+	if req.Enabled == nil {
+		api.HandleErr(w, r, nil, http.StatusBadRequest, errors.New("'enabled' is required"), nil)
+		return
+	}
+	if *req.Enabled && getDirectory() == "" {
+		api.HandleErr(w, r, nil, http.StatusBadRequest, errors.New("no profiling location is configured"), nil)
+		return
+	}
+
+	userName := "-"
+	if user, err := auth.GetCurrentUser(r.Context()); err == nil {
+		userName = user.UserName
+	}
+	log.Infof("user '%s' set continuous profiling enabled to %t", userName, *req.Enabled)
+	SetContinuous(*req.Enabled)
+
+	msg := "Continuous profiling disabled"
+	if *req.Enabled {
+		msg = "Continuous profiling enabled"
+	}
+	api.WriteRespAlertObj(w, r, tc.SuccessLevel, msg, GetContinuousStatus())
+}
@@ -0,0 +1,109 @@
+package profiler
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// waitFor waits up to a few seconds for cond to be true.
+func waitFor(t *testing.T, msg string, cond func(ContinuousStatus) bool) ContinuousStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := GetContinuousStatus()
+		if cond(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s, status: %+v", msg, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestContinuous(t *testing.T) {
+	defer func(d time.Duration) { continuousDuration = d }(continuousDuration)
+	continuousDuration = 20 * time.Millisecond
+	dir := t.TempDir()
+	SetDirectory(dir)
+	defer SetDirectory("")
+
+	enabled := false
+	InitContinuous(&enabled, "test")
+	before := GetContinuousStatus()
+	if before.Enabled || before.Running {
+		t.Fatalf("expected continuous profiling not to run while disabled, status: %+v", before)
+	}
+
+	// concurrent toggles are serialized, and only one profiler runs.
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			SetContinuous(true)
+		}()
+	}
+	wg.Wait()
+	status := waitFor(t, "a profile to be written", func(s ContinuousStatus) bool {
+		return s.Files > before.Files && strings.HasPrefix(s.LastFile, dir)
+	})
+	if !status.Enabled || !status.Running {
+		t.Errorf("expected continuous profiling to be enabled and running, status: %+v", status)
+	}
+	if status.Location != dir {
+		t.Errorf("expected the profiling location %s, status: %+v", dir, status)
+	}
+	if _, err := os.Stat(status.LastFile); err != nil {
+		t.Errorf("expected the last profile file to exist: %v", err)
+	}
+
+	SetContinuous(false)
+	waitFor(t, "continuous profiling to stop", func(s ContinuousStatus) bool { return !s.Running })
+	if enabled {
+		t.Error("expected the profiling flag to be updated")
+	}
+}
+
+func TestPutContinuousHandler(t *testing.T) {
+	SetDirectory("")
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/api/4.0/system/profile/continuous", strings.NewReader(`{"enabled":true}`))
+	PutContinuousHandler(w, r)
+	if code, _ := r.Context().Value(tc.StatusKey).(int); code != http.StatusBadRequest {
+		t.Errorf("expected response code %d without a profiling location, actual: %d", http.StatusBadRequest, code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPut, "/api/4.0/system/profile/continuous", strings.NewReader(`{}`))
+	PutContinuousHandler(w, r)
+	if code, _ := r.Context().Value(tc.StatusKey).(int); code != http.StatusBadRequest {
+		t.Errorf("expected response code %d without 'enabled', actual: %d", http.StatusBadRequest, code)
+	}
+}
@@ -0,0 +1,219 @@
+// Package profiler takes one-shot CPU, heap and goroutine profiles of Traffic
+// Ops on demand, independently of its optional continuous CPU profiling.
+package profiler
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/about"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// The types of profile which can be taken.
+const (
+	CPU       = "cpu"
+	Heap      = "heap"
+	Goroutine = "goroutine"
+)
+
+// DefaultSeconds is the duration of a CPU profile, unless requested otherwise.
+const DefaultSeconds = 30
+
+// MaxSeconds is the longest CPU profile which may be requested.
+const MaxSeconds = 300
+
+// The ways a profile can be returned.
+const (
+	// OutputStream returns the pprof data as the response body.
+	OutputStream = "stream"
+	// OutputFile writes the pprof data to a file in the profiling location,
+	// and returns its path.
+	OutputFile = "file"
+)
+
+// ErrInProgress is returned when a profile is requested while another is being taken.
+var ErrInProgress = errors.New("another profile is already being taken")
+
+// ErrCPUInProgress is returned when a CPU profile is requested while
+// continuous profiling is taking one.
+var ErrCPUInProgress = errors.New("a CPU profile is already being taken by continuous profiling")
+
+// session is 1 while an on-demand profile is being taken.
+var session int32
+
+// cpu is 1 while a CPU profile is being taken.
+var cpu int32
+
+// TryStartCPU claims the CPU profiler, returning false if a CPU profile is
+// already being taken. Only one CPU profile can be taken at a time, so both
+// continuous and on-demand CPU profiles must claim it. Every successful call
+// must be followed by a call to StopCPU.
+func TryStartCPU() bool {
+	return atomic.CompareAndSwapInt32(&cpu, 0, 1)
+}
+
+// StopCPU releases the CPU profiler.
+func StopCPU() {
+	atomic.StoreInt32(&cpu, 0)
+}
+
+var directory = struct {
+	sync.RWMutex
+	path string
+}{}
+
+// SetDirectory sets the directory profiles written to files are written to.
+func SetDirectory(path string) {
+	directory.Lock()
+	defer directory.Unlock()
+	directory.path = path
+}
+
+func getDirectory() string {
+	directory.RLock()
+	defer directory.RUnlock()
+	return directory.path
+}
+
+// Result is the response of a profile written to a file.
+type Result struct {
+	Type    string `json:"type"`
+	Seconds int    `json:"seconds,omitempty"`
+	Path    string `json:"path"`
+}
+
+// Take takes a profile of the given type, writing it to buf. A CPU profile
+// lasts for the given duration, or until ctx is done; heap and goroutine
+// profiles are taken immediately. Only one profile is taken on demand at a
+// time, it returns ErrInProgress if another is being taken, or
+// ErrCPUInProgress if a CPU profile is requested while continuous profiling
+// is taking one.
+func Take(ctx context.Context, profileType string, duration time.Duration, buf *bytes.Buffer) error {
+	if profileType != CPU && profileType != Heap && profileType != Goroutine {
+		return fmt.Errorf("unknown profile type '%s'", profileType)
+	}
+	if !atomic.CompareAndSwapInt32(&session, 0, 1) {
+		return ErrInProgress
+	}
+	defer atomic.StoreInt32(&session, 0)
+
+	if profileType != CPU {
+		return pprof.Lookup(profileType).WriteTo(buf, 0)
+	}
+
+	if !TryStartCPU() {
+		return ErrCPUInProgress
+	}
+	defer StopCPU()
+	if err := pprof.StartCPUProfile(buf); err != nil {
+		return err
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	pprof.StopCPUProfile()
+	return nil
+}
+
+// parseSeconds returns the requested CPU profile duration in seconds.
+func parseSeconds(r *http.Request) (int, error) {
+	param := r.URL.Query().Get("seconds")
+	if param == "" {
+		return DefaultSeconds, nil
+	}
+	seconds, err := strconv.Atoi(param)
+	if err != nil || seconds < 1 || seconds > MaxSeconds {
+		return 0, fmt.Errorf("seconds must be an integer from 1 to %d", MaxSeconds)
+	}
+	return seconds, nil
+}
+
+// Handler is the handler for GET requests to the profile endpoint, which takes
+// a one-shot profile and either streams it back or writes it to a file.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	profileType := r.URL.Query().Get("type")
+	if profileType == "" {
+		profileType = CPU
+	}
+	output := r.URL.Query().Get("output")
+	if output == "" {
+		output = OutputStream
+	}
+	if output != OutputStream && output != OutputFile {
+		api.HandleErr(w, r, nil, http.StatusBadRequest, fmt.Errorf("output must be '%s' or '%s'", OutputStream, OutputFile), nil)
+		return
+	}
+	seconds, err := parseSeconds(r)
+	if err != nil {
+		api.HandleErr(w, r, nil, http.StatusBadRequest, err, nil)
+		return
+	}
+	dir := getDirectory()
+	if output == OutputFile && dir == "" {
+		api.HandleErr(w, r, nil, http.StatusBadRequest, errors.New("no profiling location is configured, profiles can only be streamed"), nil)
+		return
+	}
+
+	buf := bytes.Buffer{}
+	if err := Take(r.Context(), profileType, time.Duration(seconds)*time.Second, &buf); err != nil {
+		if err == ErrInProgress || err == ErrCPUInProgress {
+			api.HandleErr(w, r, nil, http.StatusConflict, err, nil)
+			return
+		}
+		api.HandleErr(w, r, nil, http.StatusBadRequest, err, nil)
+		return
+	}
+	if profileType != CPU {
+		seconds = 0
+	}
+
+	filename := fmt.Sprintf("to%s-%s-%s.pprof", profileType, about.About.Version, time.Now().UTC().Format(time.RFC3339))
+	if output == OutputStream {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		api.WriteAndLogErr(w, r, buf.Bytes())
+		return
+	}
+
+	path := filepath.Join(dir, filename)
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		api.HandleErr(w, r, nil, http.StatusInternalServerError, nil, fmt.Errorf("writing profile: %w", err))
+		return
+	}
+	log.Infof("wrote %s profile to %s\n", profileType, path)
+	api.WriteResp(w, r, Result{Type: profileType, Seconds: seconds, Path: path})
+}
@@ -0,0 +1,137 @@
+package profiler
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// profile requests a profile from Handler, returning the response and the
+// status code it set.
+func profile(query string) (*httptest.ResponseRecorder, int) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/4.0/system/profile?"+query, nil)
+	Handler(w, r)
+	if code, ok := r.Context().Value(tc.StatusKey).(int); ok {
+		return w, code
+	}
+	return w, http.StatusOK
+}
+
+func TestHandlerStream(t *testing.T) {
+	for _, query := range []string{"type=heap", "type=goroutine", "type=cpu&seconds=1"} {
+		w, code := profile(query)
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected response code %d, actual: %d (%s)", query, http.StatusOK, code, w.Body.String())
+		}
+		if w.Body.Len() == 0 {
+			t.Errorf("%s: expected the pprof data to be streamed", query)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/octet-stream" {
+			t.Errorf("%s: expected Content-Type application/octet-stream, actual: %s", query, ct)
+		}
+	}
+}
+
+func TestHandlerFile(t *testing.T) {
+	dir := t.TempDir()
+	SetDirectory("")
+	if _, code := profile("type=heap&output=file"); code != http.StatusBadRequest {
+		t.Errorf("expected response code %d without a profiling location, actual: %d", http.StatusBadRequest, code)
+	}
+
+	SetDirectory(dir)
+	defer SetDirectory("")
+	w, code := profile("type=heap&output=file")
+	if code != http.StatusOK {
+		t.Fatalf("expected response code %d, actual: %d (%s)", http.StatusOK, code, w.Body.String())
+	}
+	resp := struct {
+		Response Result `json:"response"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if filepath.Dir(resp.Response.Path) != dir || resp.Response.Type != Heap {
+		t.Errorf("expected a heap profile written to %s, actual: %+v", dir, resp.Response)
+	}
+	if info, err := os.Stat(resp.Response.Path); err != nil || info.Size() == 0 {
+		t.Errorf("expected a non-empty profile at %s: %v", resp.Response.Path, err)
+	}
+}
+
+func TestHandlerBadRequests(t *testing.T) {
+	for _, query := range []string{"type=block", "seconds=0", "seconds=301", "seconds=abc", "output=email"} {
+		if _, code := profile(query); code != http.StatusBadRequest {
+			t.Errorf("%s: expected response code %d, actual: %d", query, http.StatusBadRequest, code)
+		}
+	}
+}
+
+func TestTakeOneAtATime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Take(ctx, CPU, time.Minute, &bytes.Buffer{})
+	}()
+	// wait for the CPU profile to start.
+	for i := 0; i < 100 && !cpuActive(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := Take(context.Background(), Heap, 0, &bytes.Buffer{}); err != ErrInProgress {
+		t.Errorf("expected %v while another profile is being taken, actual: %v", ErrInProgress, err)
+	}
+	if _, code := profile("type=cpu&seconds=1"); code != http.StatusConflict {
+		t.Errorf("expected response code %d while another profile is being taken, actual: %d", http.StatusConflict, code)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected no error from a canceled CPU profile, actual: %v", err)
+	}
+
+	// continuous profiling holds the CPU profiler, but not other profiles.
+	if !TryStartCPU() {
+		t.Fatal("expected the CPU profiler to be released")
+	}
+	defer StopCPU()
+	if err := Take(context.Background(), CPU, time.Second, &bytes.Buffer{}); err != ErrCPUInProgress {
+		t.Errorf("expected %v during continuous profiling, actual: %v", ErrCPUInProgress, err)
+	}
+	if err := Take(context.Background(), Goroutine, 0, &bytes.Buffer{}); err != nil {
+		t.Errorf("expected a goroutine profile during continuous profiling, actual error: %v", err)
+	}
+}
+
+func cpuActive() bool {
+	return atomic.LoadInt32(&cpu) == 1
+}
@@ -0,0 +1,85 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+)
+
+// DefaultDeniedBackendHeaders are the request headers which are not forwarded
+// to the hosts of a backend route unless the route explicitly allows them,
+// because they carry the client's Traffic Ops credentials.
+var DefaultDeniedBackendHeaders = []string{"Cookie", rfc.Authorization}
+
+// hopByHopHeaders are the headers which only apply to a single connection, and
+// are never forwarded to the hosts of a backend route.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// filterBackendHeaders removes the headers which must not be forwarded to the
+// hosts of a backend route from the given request headers.
+func filterBackendHeaders(h http.Header, headers config.BackendHeaders) {
+	// headers named by Connection are hop-by-hop too.
+	for _, connHeaders := range h.Values("Connection") {
+		for _, name := range strings.Split(connHeaders, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+
+	allowed := make(map[string]struct{}, len(headers.Allow))
+	for _, name := range headers.Allow {
+		allowed[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+	for _, name := range DefaultDeniedBackendHeaders {
+		if _, ok := allowed[http.CanonicalHeaderKey(name)]; !ok {
+			h.Del(name)
+		}
+	}
+	for _, name := range headers.Deny {
+		h.Del(name)
+	}
+}
+
+// backendDirector wraps the Director of a backend route's reverse proxy so
+// that only the headers the route allows are forwarded.
+func backendDirector(director func(*http.Request), headers config.BackendHeaders) func(*http.Request) {
+	return func(r *http.Request) {
+		director(r)
+		filterBackendHeaders(r.Header, headers)
+	}
+}
@@ -0,0 +1,99 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+)
+
+// proxyToUpstream sends a request with the given headers through a backend
+// route reverse proxy with the given header config, returning the headers the
+// upstream received.
+func proxyToUpstream(t *testing.T, headers config.BackendHeaders, reqHeaders http.Header) http.Header {
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	u, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatalf("parsing upstream URL: %v", err)
+	}
+	rp := httputil.NewSingleHostReverseProxy(u)
+	rp.Director = backendDirector(rp.Director, headers)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/4.0/foo", nil)
+	for name, values := range reqHeaders {
+		r.Header[name] = values
+	}
+	rp.ServeHTTP(httptest.NewRecorder(), r)
+	if received == nil {
+		t.Fatal("expected the request to reach the upstream")
+	}
+	return received
+}
+
+func TestBackendDirectorDefaultHeaders(t *testing.T) {
+	received := proxyToUpstream(t, config.BackendHeaders{}, http.Header{
+		"Cookie":              {"mojolicious=secret"},
+		"Authorization":       {"Bearer secret"},
+		"Connection":          {"X-Conn-Only"},
+		"X-Conn-Only":         {"1"},
+		"Proxy-Authorization": {"Basic secret"},
+		"X-Custom":            {"kept"},
+	})
+	for _, name := range []string{"Cookie", "Authorization", "X-Conn-Only", "Proxy-Authorization"} {
+		if value := received.Get(name); value != "" {
+			t.Errorf("expected header '%s' not to reach the upstream, actual: '%s'", name, value)
+		}
+	}
+	if value := received.Get("X-Custom"); value != "kept" {
+		t.Errorf("expected header 'X-Custom' to reach the upstream, actual: '%s'", value)
+	}
+}
+
+func TestBackendDirectorAllowDeny(t *testing.T) {
+	headers := config.BackendHeaders{Allow: []string{"authorization"}, Deny: []string{"X-Secret"}}
+	received := proxyToUpstream(t, headers, http.Header{
+		"Cookie":        {"mojolicious=secret"},
+		"Authorization": {"Bearer token"},
+		"X-Secret":      {"secret"},
+		"X-Custom":      {"kept"},
+	})
+	if value := received.Get("Authorization"); value != "Bearer token" {
+		t.Errorf("expected an allowed 'Authorization' header to reach the upstream, actual: '%s'", value)
+	}
+	if value := received.Get("Cookie"); value != "" {
+		t.Errorf("expected header 'Cookie' not to reach the upstream, actual: '%s'", value)
+	}
+	if value := received.Get("X-Secret"); value != "" {
+		t.Errorf("expected a denied header not to reach the upstream, actual: '%s'", value)
+	}
+	if value := received.Get("X-Custom"); value != "kept" {
+		t.Errorf("expected header 'X-Custom' to reach the upstream, actual: '%s'", value)
+	}
+}
@@ -0,0 +1,78 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/routing/middleware"
+)
+
+// newBackendProxy returns the reverse proxy of a backend route to one of its
+// hosts. The proxy waits for the host's response headers for no longer than
+// the route's response header timeout, and answers with a 504 if they don't
+// arrive in time, or if the request outlives its deadline (see
+// withBackendDeadline).
+func newBackendProxy(route config.BackendRoute, host config.Host) *httputil.ReverseProxy {
+	rp := httputil.NewSingleHostReverseProxy(&url.URL{
+		Host:   host.Hostname + ":" + strconv.Itoa(host.Port),
+		Scheme: host.Protocol,
+	})
+	rp.Director = backendDirector(rp.Director, route.Headers)
+
+	rp.Transport = &http.Transport{
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: route.Insecure},
+		ResponseHeaderTimeout: route.Timeouts.ResponseHeaderTimeout(),
+	}
+
+	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// the client went away, so there's no one to answer
+		if errors.Is(err, context.Canceled) && r.Context().Err() == context.Canceled {
+			log.Warnf("backend route %d: client canceled the request to %s: %v", route.ID, host.Hostname, err)
+			return
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			middleware.BackendErrorHandler(http.StatusGatewayTimeout, nil, fmt.Errorf("backend route %d: host %s timed out: %w", route.ID, host.Hostname, err)).ServeHTTP(w, r)
+			return
+		}
+		middleware.BackendErrorHandler(http.StatusInternalServerError, nil, fmt.Errorf("backend route %d: host %s: %w", route.ID, host.Hostname, err)).ServeHTTP(w, r)
+	}
+	return rp
+}
+
+// withBackendDeadline returns the request with the backend route's request
+// timeout as its deadline, so the proxied request is aborted once it passes,
+// as it is if the client disconnects. The returned CancelFunc must be called
+// once the request has been proxied.
+func withBackendDeadline(r *http.Request, route config.BackendRoute) (*http.Request, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(r.Context(), route.Timeouts.RequestTimeout())
+	return r.WithContext(ctx), cancel
+}
@@ -0,0 +1,135 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+)
+
+// stallingUpstream starts an upstream which, after writeHeader if it's set,
+// stalls until the request to it is canceled or the test ends, returning its
+// host and a channel closed once it sees the request canceled.
+func stallingUpstream(t *testing.T, writeHeader bool) (config.Host, <-chan struct{}) {
+	canceled := make(chan struct{})
+	done := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if writeHeader {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			close(canceled)
+		case <-done:
+		}
+	}))
+	t.Cleanup(func() {
+		close(done)
+		upstream.Close()
+	})
+
+	u, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatalf("parsing upstream URL: %v", err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatalf("parsing upstream port: %v", err)
+	}
+	return config.Host{Protocol: u.Scheme, Hostname: u.Hostname(), Port: port}, canceled
+}
+
+// proxyWithDeadline proxies r through the backend route to host, as Handler does.
+func proxyWithDeadline(route config.BackendRoute, host config.Host, w http.ResponseWriter, r *http.Request) {
+	r, cancel := withBackendDeadline(r, route)
+	defer cancel()
+	newBackendProxy(route, host).ServeHTTP(w, r)
+}
+
+func TestBackendProxyResponseHeaderTimeout(t *testing.T) {
+	host, canceled := stallingUpstream(t, false)
+	route := config.BackendRoute{ID: 1, Timeouts: config.BackendTimeouts{ResponseHeaderSeconds: 1, RequestSeconds: 10}}
+
+	w := httptest.NewRecorder()
+	start := time.Now()
+	proxyWithDeadline(route, host, w, httptest.NewRequest(http.MethodGet, "/api/4.0/foo", nil))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the proxy to give up after the 1s response header timeout, actual: %v", elapsed)
+	}
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected a %d for a host which doesn't respond, actual: %d", http.StatusGatewayTimeout, w.Code)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the upstream request to be aborted")
+	}
+}
+
+func TestBackendProxyRequestTimeout(t *testing.T) {
+	host, canceled := stallingUpstream(t, true)
+	route := config.BackendRoute{ID: 1, Timeouts: config.BackendTimeouts{ResponseHeaderSeconds: 10, RequestSeconds: 1}}
+
+	start := time.Now()
+	proxyWithDeadline(route, host, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/4.0/foo", nil))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the proxy to give up on a stalled body after the 1s request timeout, actual: %v", elapsed)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the upstream request to be aborted")
+	}
+}
+
+func TestBackendProxyClientCancellation(t *testing.T) {
+	host, canceled := stallingUpstream(t, false)
+	route := config.BackendRoute{ID: 1, Timeouts: config.BackendTimeouts{ResponseHeaderSeconds: 60, RequestSeconds: 60}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/api/4.0/foo", nil).WithContext(ctx)
+	proxied := make(chan struct{})
+	go func() {
+		proxyWithDeadline(route, host, httptest.NewRecorder(), r)
+		close(proxied)
+	}()
+
+	// the client disconnects while the upstream is stalling
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the client's cancellation to abort the upstream request")
+	}
+	select {
+	case <-proxied:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the proxy to return once the client canceled")
+	}
+}
@@ -0,0 +1,55 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"sync/atomic"
+)
+
+// ConfigSelfTest is the outcome of the startup self-test of the cache config
+// generation path, as reported by /readyz.
+type ConfigSelfTest struct {
+	Passed bool `json:"passed"`
+	// Profile is the profile of the server config was generated for.
+	Profile string `json:"profile"`
+	// Error is why config couldn't be generated, if it couldn't.
+	Error string `json:"error,omitempty"`
+}
+
+// configSelfTest stores the *ConfigSelfTest of the startup self-test. It's
+// never set unless the self-test is enabled.
+var configSelfTest atomic.Value
+
+// SetConfigSelfTest sets the outcome of the startup self-test of the cache
+// config generation path. Traffic Ops isn't ready while it has failed.
+func SetConfigSelfTest(profile string, err error) {
+	result := &ConfigSelfTest{Passed: err == nil, Profile: profile}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	configSelfTest.Store(result)
+}
+
+// getConfigSelfTest returns the outcome of the startup self-test, or nil if it
+// didn't run.
+func getConfigSelfTest() *ConfigSelfTest {
+	result, _ := configSelfTest.Load().(*ConfigSelfTest)
+	return result
+}
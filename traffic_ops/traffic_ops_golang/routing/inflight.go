@@ -0,0 +1,86 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// inFlightRequests is the number of requests currently being handled.
+var inFlightRequests int64
+
+// rejectedRequests is the number of requests refused because the in-flight
+// request limit was reached.
+var rejectedRequests uint64
+
+// InFlightStats is the state of the in-flight request limit, as returned by
+// the request stats endpoint.
+type InFlightStats struct {
+	InFlight    int64  `json:"inFlight"`
+	MaxInFlight int    `json:"maxInFlight"`
+	Rejected    uint64 `json:"rejected"`
+}
+
+// acquireInFlight counts a new in-flight request, returning false, and not
+// counting it, if max requests are already in flight. A max of zero or less
+// is no limit. Every successful call must be followed by a releaseInFlight.
+func acquireInFlight(max int) bool {
+	inFlight := atomic.AddInt64(&inFlightRequests, 1)
+	if max > 0 && inFlight > int64(max) {
+		atomic.AddInt64(&inFlightRequests, -1)
+		atomic.AddUint64(&rejectedRequests, 1)
+		return false
+	}
+	return true
+}
+
+// releaseInFlight counts the end of an in-flight request.
+func releaseInFlight() {
+	atomic.AddInt64(&inFlightRequests, -1)
+}
+
+// GetInFlightStats returns the current in-flight and rejected request counts.
+func GetInFlightStats(maxInFlight int) InFlightStats {
+	return InFlightStats{
+		InFlight:    atomic.LoadInt64(&inFlightRequests),
+		MaxInFlight: maxInFlight,
+		Rejected:    atomic.LoadUint64(&rejectedRequests),
+	}
+}
+
+// RequestStatsHandler returns a handler which reports the current in-flight
+// and rejected request counts.
+func RequestStatsHandler(maxInFlight int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bytes, err := json.Marshal(GetInFlightStats(maxInFlight))
+		if err != nil {
+			api.HandleErr(w, r, nil, http.StatusInternalServerError, nil, fmt.Errorf("unable to marshal request stats: %w", err))
+			return
+		}
+		w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+		api.WriteAndLogErr(w, r, bytes)
+	}
+}
@@ -0,0 +1,115 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/plugin"
+)
+
+func TestHandlerInFlightLimit(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	routes := map[string][]CompiledRoute{
+		http.MethodGet: {{
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				started <- struct{}{}
+				<-release
+			},
+			Regex: regexp.MustCompile(`^api/4.0/servers/?$`),
+			ID:    1,
+		}},
+	}
+	catchall := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	cfg := config.Config{Secrets: []string{"n0SeCr3t$"}}
+	cfg.RequestLimit.MaxInFlight = 1
+	cfg.RequestLimit.RetryAfterSeconds = 10
+	versions := map[api.Version]struct{}{{Major: 4, Minor: 0}: {}}
+	handle := func(w http.ResponseWriter) {
+		Handler(routes, versions, catchall, nil, &cfg, func() uint64 { return 0 }, plugin.Get(cfg), nil, w, httptest.NewRequest(http.MethodGet, "/api/4.0/servers", nil))
+	}
+
+	before := GetInFlightStats(cfg.RequestLimit.MaxInFlight)
+
+	done := make(chan struct{})
+	go func() {
+		handle(httptest.NewRecorder())
+		close(done)
+	}()
+	<-started
+
+	if stats := GetInFlightStats(cfg.RequestLimit.MaxInFlight); stats.InFlight != before.InFlight+1 {
+		t.Errorf("expected %d requests in flight, actual: %d", before.InFlight+1, stats.InFlight)
+	}
+
+	w := httptest.NewRecorder()
+	handle(w)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected response code %d beyond the in-flight limit, actual: %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "10" {
+		t.Errorf("expected Retry-After '10', actual: '%s'", retryAfter)
+	}
+
+	close(release)
+	<-done
+
+	stats := GetInFlightStats(cfg.RequestLimit.MaxInFlight)
+	if stats.InFlight != before.InFlight {
+		t.Errorf("expected %d requests in flight after the request finished, actual: %d", before.InFlight, stats.InFlight)
+	}
+	if stats.Rejected != before.Rejected+1 {
+		t.Errorf("expected %d rejected requests, actual: %d", before.Rejected+1, stats.Rejected)
+	}
+
+	// once the in-flight request finished, requests are handled again.
+	release = make(chan struct{})
+	close(release)
+	go func() { <-started }()
+	w = httptest.NewRecorder()
+	handle(w)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected response code %d within the in-flight limit, actual: %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestRequestStatsHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	RequestStatsHandler(50)(w, httptest.NewRequest(http.MethodGet, "/request-stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected response code %d, actual: %d", http.StatusOK, w.Code)
+	}
+	stats := InFlightStats{}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decoding request stats: %v", err)
+	}
+	if stats.MaxInFlight != 50 {
+		t.Errorf("expected maxInFlight 50, actual: %d", stats.MaxInFlight)
+	}
+}
@@ -0,0 +1,164 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
+)
+
+// maintenanceEnabled is non-zero while Traffic Ops is in maintenance mode.
+var maintenanceEnabled int32
+
+// maintenanceExemptPathRe matches the request paths which are served even in
+// maintenance mode: the maintenance toggle endpoint itself, and logging in, so
+// that an admin without a session can still turn maintenance mode off.
+var maintenanceExemptPathRe = regexp.MustCompile(`^/api/[^/]+/(maintenance|user/login(/.*)?)/?$`)
+
+// MaintenanceMode is the representation of the maintenance mode state in the
+// maintenance endpoint's requests and responses.
+type MaintenanceMode struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// SetMaintenanceMode enables or disables maintenance mode. While enabled, all
+// API requests except those to the maintenance and login endpoints receive a
+// 503.
+func SetMaintenanceMode(enabled bool) {
+	var val int32
+	if enabled {
+		val = 1
+	}
+	if old := atomic.SwapInt32(&maintenanceEnabled, val); old == val {
+		return
+	}
+	if enabled {
+		log.Warnln("maintenance mode is active: serving 503 for all API requests")
+	} else {
+		log.Infoln("maintenance mode is no longer active")
+	}
+}
+
+// InMaintenanceMode returns whether Traffic Ops is currently in maintenance mode.
+func InMaintenanceMode() bool {
+	return atomic.LoadInt32(&maintenanceEnabled) != 0
+}
+
+// isMaintenanceBlocked returns whether a request for the given path must be
+// refused because of maintenance mode.
+func isMaintenanceBlocked(path string) bool {
+	if !InMaintenanceMode() {
+		return false
+	}
+	if !strings.HasPrefix(path, "/api/") {
+		return false
+	}
+	return !maintenanceExemptPathRe.MatchString(path)
+}
+
+// GetMaintenance is the handler for GET requests to the maintenance endpoint.
+func GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	enabled := InMaintenanceMode()
+	api.WriteResp(w, r, MaintenanceMode{Enabled: &enabled})
+}
+
+// PutMaintenance is the handler for PUT requests to the maintenance endpoint,
+// which enables or disables maintenance mode.
+func PutMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req MaintenanceMode
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.HandleErr(w, r, nil, http.StatusBadRequest, errors.New("malformed JSON: "+err.Error()), nil)
+		return
+	}
+	if req.Enabled == nil {
+		api.HandleErr(w, r, nil, http.StatusBadRequest, errors.New("'enabled' is required"), nil)
+		return
+	}
+
+	userName := "-"
+	if user, err := auth.GetCurrentUser(r.Context()); err == nil {
+		userName = user.UserName
+	}
+	log.Infof("user '%s' set maintenance mode enabled to %t", userName, *req.Enabled)
+	SetMaintenanceMode(*req.Enabled)
+
+	msg := "Maintenance mode disabled"
+	if *req.Enabled {
+		msg = "Maintenance mode enabled"
+	}
+	api.WriteRespAlertObj(w, r, tc.SuccessLevel, msg, req)
+}
+
+// HealthzHandler returns a handler which reports that the Traffic Ops server is
+// running. It is served regardless of maintenance mode.
+func HealthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+		api.WriteAndLogErr(w, r, []byte(`{"status":"ok"}`+"\n"))
+	}
+}
+
+// InternalHandler returns a handler which serves only the health endpoints and
+// the route metrics, for the internal plain HTTP listener. The API is never
+// served by it.
+func InternalHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", HealthzHandler())
+	mux.Handle("/readyz", ReadyzHandler())
+	mux.Handle("/metrics", RouteMetricsHandler())
+	return mux
+}
+
+// ReadyzHandler returns a handler which reports whether Traffic Ops is ready to
+// serve API requests. It responds with a 503 while in maintenance mode, or if
+// the startup self-test of the cache config generation path failed. Read-only
+// mode is reported, but Traffic Ops is still ready to serve GET requests in it.
+func ReadyzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		maintenance := InMaintenanceMode()
+		selfTest := getConfigSelfTest()
+		ready := !maintenance && (selfTest == nil || selfTest.Passed)
+		bytes, err := json.Marshal(struct {
+			Ready          bool            `json:"ready"`
+			Maintenance    bool            `json:"maintenance"`
+			ReadOnly       bool            `json:"readOnly"`
+			ConfigSelfTest *ConfigSelfTest `json:"configSelfTest,omitempty"`
+		}{Ready: ready, Maintenance: maintenance, ReadOnly: InReadOnlyMode(), ConfigSelfTest: selfTest})
+		if err != nil {
+			api.HandleErr(w, r, nil, http.StatusInternalServerError, nil, errors.New("marshalling readiness: "+err.Error()))
+			return
+		}
+		w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		api.WriteAndLogErr(w, r, bytes)
+	}
+}
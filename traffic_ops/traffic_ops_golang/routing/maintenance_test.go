@@ -0,0 +1,180 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/plugin"
+)
+
+func TestIsMaintenanceBlocked(t *testing.T) {
+	defer SetMaintenanceMode(false)
+
+	SetMaintenanceMode(false)
+	if isMaintenanceBlocked("/api/4.0/servers") {
+		t.Error("expected no requests to be blocked outside of maintenance mode")
+	}
+
+	SetMaintenanceMode(true)
+	tests := map[string]bool{
+		"/api/4.0/servers":          true,
+		"/api/3.1/cdns":             true,
+		"/api/4.0/maintenance":      false,
+		"/api/4.0/user/login":       false,
+		"/api/4.0/user/login/token": false,
+		"/api/4.0/user/logout":      true,
+		"/healthz":                  false,
+		"/readyz":                   false,
+	}
+	for path, expected := range tests {
+		if actual := isMaintenanceBlocked(path); actual != expected {
+			t.Errorf("isMaintenanceBlocked(%s) - expected: %t, actual: %t", path, expected, actual)
+		}
+	}
+}
+
+func TestHandlerMaintenanceMode(t *testing.T) {
+	defer SetMaintenanceMode(false)
+
+	var called bool
+	routes := map[string][]CompiledRoute{
+		http.MethodGet: {{
+			Handler: func(w http.ResponseWriter, r *http.Request) { called = true },
+			Regex:   regexp.MustCompile(`^api/4.0/servers/?$`),
+			ID:      1,
+		}},
+	}
+	catchall := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	cfg := config.Config{Secrets: []string{"n0SeCr3t$"}}
+	cfg.Maintenance.RetryAfterSeconds = 60
+	versions := map[api.Version]struct{}{{Major: 4, Minor: 0}: {}}
+
+	SetMaintenanceMode(true)
+	w := httptest.NewRecorder()
+	Handler(routes, versions, catchall, nil, &cfg, func() uint64 { return 0 }, plugin.Get(cfg), nil, w, httptest.NewRequest(http.MethodGet, "/api/4.0/servers", nil))
+	if called {
+		t.Error("expected route handler not to be called in maintenance mode")
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected response code %d in maintenance mode, actual: %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "60" {
+		t.Errorf("expected Retry-After '60', actual: '%s'", retryAfter)
+	}
+
+	SetMaintenanceMode(false)
+	w = httptest.NewRecorder()
+	Handler(routes, versions, catchall, nil, &cfg, func() uint64 { return 0 }, plugin.Get(cfg), nil, w, httptest.NewRequest(http.MethodGet, "/api/4.0/servers", nil))
+	if !called {
+		t.Error("expected route handler to be called outside of maintenance mode")
+	}
+}
+
+func TestHandlerMaintenanceModeLogin(t *testing.T) {
+	defer SetMaintenanceMode(false)
+
+	var loggedIn bool
+	routes := map[string][]CompiledRoute{
+		http.MethodPost: {{
+			Handler: func(w http.ResponseWriter, r *http.Request) { loggedIn = true },
+			Regex:   regexp.MustCompile(`^api/4.0/user/login/?$`),
+			ID:      1,
+		}},
+	}
+	catchall := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	cfg := config.Config{Secrets: []string{"n0SeCr3t$"}}
+	versions := map[api.Version]struct{}{{Major: 4, Minor: 0}: {}}
+
+	SetMaintenanceMode(true)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/4.0/user/login", strings.NewReader(`{"u":"admin","p":"twelve"}`))
+	Handler(routes, versions, catchall, nil, &cfg, func() uint64 { return 0 }, plugin.Get(cfg), nil, w, req)
+	if !loggedIn {
+		t.Error("expected login handler to be called in maintenance mode")
+	}
+	if w.Code == http.StatusServiceUnavailable {
+		t.Errorf("expected login not to be refused in maintenance mode, actual response code: %d", w.Code)
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	defer SetMaintenanceMode(false)
+
+	SetMaintenanceMode(false)
+	w := httptest.NewRecorder()
+	ReadyzHandler()(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected /readyz response code %d, actual: %d", http.StatusOK, w.Code)
+	}
+
+	SetMaintenanceMode(true)
+	w = httptest.NewRecorder()
+	ReadyzHandler()(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected /readyz response code %d in maintenance mode, actual: %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestReadyzHandlerConfigSelfTest(t *testing.T) {
+	defer configSelfTest.Store((*ConfigSelfTest)(nil))
+
+	SetConfigSelfTest("EDGE_TEST", nil)
+	w := httptest.NewRecorder()
+	ReadyzHandler()(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"configSelfTest":{"passed":true,"profile":"EDGE_TEST"}`) {
+		t.Errorf("expected /readyz to be ready with a passed self-test, actual: %d %s", w.Code, w.Body.String())
+	}
+
+	SetConfigSelfTest("EDGE_TEST", errors.New("generating records.config: server missing profiles"))
+	w = httptest.NewRecorder()
+	ReadyzHandler()(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"ready":false`) || !strings.Contains(w.Body.String(), "server missing profiles") {
+		t.Errorf("expected /readyz not to be ready with a failed self-test, actual: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestInternalHandler(t *testing.T) {
+	h := InternalHandler()
+	for path, expected := range map[string]int{
+		"/healthz":         http.StatusOK,
+		"/readyz":          http.StatusOK,
+		"/metrics":         http.StatusOK,
+		"/api/4.0/servers": http.StatusNotFound,
+		"/":                http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != expected {
+			t.Errorf("expected %s response code %d on the internal listener, actual: %d", path, expected, w.Code)
+		}
+	}
+}
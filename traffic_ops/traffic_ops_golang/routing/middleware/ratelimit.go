@@ -0,0 +1,203 @@
+package middleware
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
+)
+
+// MaxRateLimitKeys is the maximum number of users or client IPs a single
+// RateLimiter keeps state for. Idle keys are evicted first, then the least
+// recently seen.
+const MaxRateLimitKeys = 10000
+
+// RateLimit is a token bucket rate limit of a Route.
+type RateLimit struct {
+	// Requests is the number of requests allowed per Interval.
+	Requests int
+	// Interval is the interval over which Requests are allowed.
+	Interval time.Duration
+	// Burst is the number of requests allowed at once. If less than one,
+	// Requests is used.
+	Burst int
+	// ByUser keys the limit by the authenticated user's name rather than the
+	// client IP. Unauthenticated requests are still keyed by the client IP.
+	ByUser bool
+}
+
+// the token bucket of a single user or client IP.
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// RateLimiter is the state of a RateLimit, shared by every request it limits.
+// It is safe for use by multiple goroutines.
+type RateLimiter struct {
+	limit   RateLimit
+	rate    float64 // tokens per second
+	burst   float64
+	maxKeys int
+	now     func() time.Time
+
+	m         sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter returns a RateLimiter for the given RateLimit.
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	burst := limit.Burst
+	if burst < 1 {
+		burst = limit.Requests
+	}
+	rate := 0.0
+	if limit.Interval > 0 {
+		rate = float64(limit.Requests) / limit.Interval.Seconds()
+	}
+	return &RateLimiter{
+		limit:   limit,
+		rate:    rate,
+		burst:   float64(burst),
+		maxKeys: MaxRateLimitKeys,
+		now:     time.Now,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// Allow takes a token for the given key, returning whether the request is
+// allowed and, if not, how long until it would be.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= l.idleTime() {
+		l.evictIdle(now)
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.maxKeys {
+			l.evictIdle(now)
+			if len(l.buckets) >= l.maxKeys {
+				l.evictLeastRecentlySeen()
+			}
+		}
+		bucket = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*l.rate)
+	bucket.lastSeen = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, l.limit.Interval
+	}
+	return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+// the time after which an unused bucket is full again, and may be evicted.
+func (l *RateLimiter) idleTime() time.Duration {
+	if l.rate <= 0 {
+		return l.limit.Interval
+	}
+	return time.Duration(l.burst / l.rate * float64(time.Second))
+}
+
+// evicts the buckets which have refilled since they were last seen, their
+// state is the same as a new bucket's.
+func (l *RateLimiter) evictIdle(now time.Time) {
+	idle := l.idleTime()
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) >= idle {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *RateLimiter) evictLeastRecentlySeen() {
+	oldestKey := ""
+	var oldest *tokenBucket
+	for key, bucket := range l.buckets {
+		if oldest == nil || bucket.lastSeen.Before(oldest.lastSeen) {
+			oldestKey, oldest = key, bucket
+		}
+	}
+	delete(l.buckets, oldestKey)
+}
+
+// key returns the key a request is limited by.
+func (l *RateLimiter) key(r *http.Request) string {
+	if l.limit.ByUser {
+		if user, ok := r.Context().Value(auth.CurrentUserKey).(auth.CurrentUser); ok && user.UserName != "" {
+			return "user:" + user.UserName
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// RateLimitMiddleware returns a Middleware which limits requests with the
+// given RateLimit, returning a 429 Too Many Requests with a Retry-After header
+// when it is exceeded. Every handler the returned Middleware wraps shares the
+// same limit. To limit by user, it must be used after AuthBase.GetWrapper.
+func RateLimitMiddleware(limit RateLimit) Middleware {
+	limiter := NewRateLimiter(limit)
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if ok, retryAfter := limiter.Allow(limiter.key(r)); !ok {
+				TooManyRequestsHandler(retryAfter).ServeHTTP(w, r)
+				return
+			}
+			h(w, r)
+		}
+	}
+}
+
+// TooManyRequestsHandler returns a http.Handler which returns a HTTP 429 to the client, with a Retry-After header of the given duration, rounded up to whole seconds.
+func TooManyRequestsHandler(retryAfter time.Duration) http.Handler {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		w.WriteHeader(http.StatusTooManyRequests)
+		api.WriteAndLogErr(w, r, []byte(`{"alerts":[{"level":"error","text":"Too many requests, please try again later."}]}`+"\n"))
+	})
+}
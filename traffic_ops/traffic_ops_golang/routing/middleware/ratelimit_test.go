@@ -0,0 +1,165 @@
+package middleware
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(1650000000, 0)
+	l := NewRateLimiter(RateLimit{Requests: 1, Interval: 10 * time.Second, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("expected request %d within the burst to be allowed", i+1)
+		}
+	}
+	ok, retryAfter := l.Allow("a")
+	if ok {
+		t.Fatal("expected a request over the burst to be denied")
+	}
+	if retryAfter != 10*time.Second {
+		t.Errorf("expected retry after 10s, actual: %v", retryAfter)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("expected a request with a different key to be allowed")
+	}
+
+	now = now.Add(10 * time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("expected a request to be allowed after a token was added")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("expected a second request to be denied before another token was added")
+	}
+}
+
+func TestRateLimiterEviction(t *testing.T) {
+	now := time.Unix(1650000000, 0)
+	l := NewRateLimiter(RateLimit{Requests: 1, Interval: time.Second})
+	l.now = func() time.Time { return now }
+	l.maxKeys = 3
+
+	for i := 0; i < 10; i++ {
+		l.Allow(strconv.Itoa(i))
+		now = now.Add(100 * time.Millisecond)
+	}
+	if len(l.buckets) > l.maxKeys {
+		t.Errorf("expected at most %d keys, actual: %d", l.maxKeys, len(l.buckets))
+	}
+
+	now = now.Add(time.Minute)
+	l.Allow("new")
+	if len(l.buckets) != 1 {
+		t.Errorf("expected idle keys to be evicted, actual keys: %d", len(l.buckets))
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handled := 0
+	f := RateLimitMiddleware(RateLimit{Requests: 2, Interval: time.Hour})(func(w http.ResponseWriter, r *http.Request) {
+		handled++
+	})
+
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/4.0/user/login", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		f(w, r)
+		codes = append(codes, w.Code)
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1800" {
+			t.Errorf("expected Retry-After 1800, actual: '%s'", w.Header().Get("Retry-After"))
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("expected statuses [200 200 429], actual: %v", codes)
+	}
+	if handled != 2 {
+		t.Errorf("expected 2 requests to be handled, actual: %d", handled)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/4.0/user/login", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	f(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected a request from another client to be allowed, actual status: %d", w.Code)
+	}
+}
+
+func TestRateLimitMiddlewareByUser(t *testing.T) {
+	f := RateLimitMiddleware(RateLimit{Requests: 1, Interval: time.Hour, ByUser: true})(func(w http.ResponseWriter, r *http.Request) {})
+
+	request := func(userName string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/4.0/servers", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r = r.WithContext(context.WithValue(r.Context(), auth.CurrentUserKey, auth.CurrentUser{UserName: userName}))
+		f(w, r)
+		return w.Code
+	}
+
+	if code := request("alice"); code != http.StatusOK {
+		t.Errorf("expected the first request of a user to be allowed, actual status: %d", code)
+	}
+	if code := request("bob"); code != http.StatusOK {
+		t.Errorf("expected a request of another user from the same IP to be allowed, actual status: %d", code)
+	}
+	if code := request("alice"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the second request of a user to be denied, actual status: %d", code)
+	}
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	l := NewRateLimiter(RateLimit{Requests: 50, Interval: time.Hour})
+	allowed := make(chan bool, 100)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _ := l.Allow("a")
+			allowed <- ok
+		}()
+	}
+	wg.Wait()
+	close(allowed)
+
+	count := 0
+	for ok := range allowed {
+		if ok {
+			count++
+		}
+	}
+	if count != 50 {
+		t.Errorf("expected 50 requests to be allowed, actual: %d", count)
+	}
+}
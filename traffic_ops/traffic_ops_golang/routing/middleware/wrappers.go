@@ -28,6 +28,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -86,6 +87,10 @@ func Use(h http.HandlerFunc, middlewares []Middleware) http.HandlerFunc {
 type AuthBase struct {
 	Secret   string
 	Override Middleware
+	// ClientCertSubjects maps the distinguished names of verified TLS client certificate subjects to the usernames they authenticate as, for GetClientCertWrapper.
+	ClientCertSubjects map[string]string
+	// ClientCertRouteIDs are the IDs of the routes authenticated with GetClientCertWrapper, rather than GetWrapper.
+	ClientCertRouteIDs map[int]struct{}
 }
 
 // GetWrapper returns a Middleware which performs authentication of the current user at the given privilege level.
@@ -105,31 +110,49 @@ func (a AuthBase) GetWrapper(privLevelRequired int) Middleware {
 				return
 			}
 
-			ctx := r.Context()
-			cfg, err := api.GetConfig(ctx)
-			if err != nil {
-				api.HandleErr(w, r, nil, http.StatusInternalServerError, nil, fmt.Errorf("getting configuration from request context: %w", err))
+			if !authorizePrivLevel(w, r, user, privLevelRequired) {
 				return
 			}
 
-			v := api.GetRequestedAPIVersion(r.URL.Path)
-			if v == nil {
-				api.HandleErr(w, r, nil, http.StatusBadRequest, errors.New("couldn't get a valid version from the requested path"), nil)
+			api.AddUserToReq(r, user)
+			handlerFunc(w, r)
+		}
+	}
+}
+
+// GetClientCertWrapper returns a Middleware like GetWrapper, except that a
+// request with a verified TLS client certificate whose subject is in
+// ClientCertSubjects is authenticated as the mapped user, without a password
+// or token. Requests without such a certificate are authenticated as by
+// GetWrapper.
+func (a AuthBase) GetClientCertWrapper(privLevelRequired int) Middleware {
+
+	if a.Override != nil {
+		return a.Override
+	}
+
+	passwordWrapper := a.GetWrapper(privLevelRequired)
+	return func(handlerFunc http.HandlerFunc) http.HandlerFunc {
+		passwordHandler := passwordWrapper(handlerFunc)
+		return func(w http.ResponseWriter, r *http.Request) {
+
+			username, ok := a.clientCertUser(r)
+			if !ok {
+				passwordHandler(w, r)
 				return
 			}
 
-			if v.Major < 4 {
-				// APIのメジャーバージョンが4未満の場合
-				if user.PrivLevel < privLevelRequired {
-					api.HandleErr(w, r, nil, http.StatusForbidden, errors.New("Forbidden."), nil)
-					return
-				}
-			} else {
-				// APIのメジャーバージョンが4以上の場合。この場合には`role_based_permissions=false` かつ 権限レベルを満たしていない場合にはForbiddenとなる。
-				if !cfg.RoleBasedPermissions && user.PrivLevel < privLevelRequired {
-					api.HandleErr(w, r, nil, http.StatusForbidden, errors.New("Forbidden."), nil)
-					return
+			user, userErr, sysErr, errCode := api.GetUserByName(r, username)
+			if userErr != nil || sysErr != nil {
+				if sysErr == nil {
+					sysErr = fmt.Errorf("client certificate user '%s': %v", username, userErr)
 				}
+				api.HandleErr(w, r, nil, errCode, userErr, sysErr)
+				return
+			}
+
+			if !authorizePrivLevel(w, r, user, privLevelRequired) {
+				return
 			}
 
 			api.AddUserToReq(r, user)
@@ -138,6 +161,48 @@ func (a AuthBase) GetWrapper(privLevelRequired int) Middleware {
 	}
 }
 
+// clientCertUser returns the username mapped to the subject of the verified
+// client certificate of the request, and whether there is one.
+func (a AuthBase) clientCertUser(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	username, ok := a.ClientCertSubjects[r.TLS.VerifiedChains[0][0].Subject.String()]
+	return username, ok && username != ""
+}
+
+// authorizePrivLevel returns whether the user has the privilege level required
+// by the requested API version, writing an error response if not.
+func authorizePrivLevel(w http.ResponseWriter, r *http.Request, user auth.CurrentUser, privLevelRequired int) bool {
+	ctx := r.Context()
+	cfg, err := api.GetConfig(ctx)
+	if err != nil {
+		api.HandleErr(w, r, nil, http.StatusInternalServerError, nil, fmt.Errorf("getting configuration from request context: %w", err))
+		return false
+	}
+
+	v := api.GetRequestedAPIVersion(r.URL.Path)
+	if v == nil {
+		api.HandleErr(w, r, nil, http.StatusBadRequest, errors.New("couldn't get a valid version from the requested path"), nil)
+		return false
+	}
+
+	if v.Major < 4 {
+		// APIのメジャーバージョンが4未満の場合
+		if user.PrivLevel < privLevelRequired {
+			api.HandleErr(w, r, nil, http.StatusForbidden, errors.New("Forbidden."), nil)
+			return false
+		}
+	} else {
+		// APIのメジャーバージョンが4以上の場合。この場合には`role_based_permissions=false` かつ 権限レベルを満たしていない場合にはForbiddenとなる。
+		if !cfg.RoleBasedPermissions && user.PrivLevel < privLevelRequired {
+			api.HandleErr(w, r, nil, http.StatusForbidden, errors.New("Forbidden."), nil)
+			return false
+		}
+	}
+	return true
+}
+
 // TimeOutWrapper is a Middleware which adds the given timeout to the request.
 // This causes the request to abort and return an error to the user if the handler takes longer than the timeout to execute.
 func TimeOutWrapper(timeout time.Duration) Middleware {
@@ -304,6 +369,39 @@ func DisabledRouteHandler() http.Handler {
 	})
 }
 
+// MaintenanceHandler returns a http.Handler which returns a HTTP 503 to the client, with a Retry-After header of the given duration and an error message indicating Traffic Ops is in maintenance mode.
+// This is used for all API routes while maintenance mode is enabled. See routing.SetMaintenanceMode.
+func MaintenanceHandler(retryAfter time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		api.WriteAndLogErr(w, r, []byte(`{"alerts":[{"level":"error","text":"Traffic Ops is currently in maintenance mode."}]}`+"\n"))
+	})
+}
+
+// ReadOnlyHandler returns a http.Handler which returns a HTTP 503 to the client, with a Retry-After header of the given duration and an error message indicating Traffic Ops is in read-only mode.
+// This is used for mutating API requests while read-only mode is enabled. See routing.SetReadOnlyMode.
+func ReadOnlyHandler(retryAfter time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		api.WriteAndLogErr(w, r, []byte(`{"alerts":[{"level":"error","text":"Traffic Ops is currently in read-only mode, only GET requests are served."}]}`+"\n"))
+	})
+}
+
+// OverloadedHandler returns a http.Handler which returns a HTTP 503 to the client, with a Retry-After header of the given duration and an error message indicating Traffic Ops is handling too many requests.
+// This is used for requests beyond the in-flight request limit. See config.ConfigTrafficOpsGolang.RequestLimit.
+func OverloadedHandler(retryAfter time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		api.WriteAndLogErr(w, r, []byte(`{"alerts":[{"level":"error","text":"Traffic Ops is handling too many requests, please try again later."}]}`+"\n"))
+	})
+}
+
 // RequiredPermissionsMiddleware produces a Middleware that checks that the
 // authenticated user has all of the passed Permissions. If they are missing one
 // or more Permissions, an error is returned to the client and handling is
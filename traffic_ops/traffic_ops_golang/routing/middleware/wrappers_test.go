@@ -23,6 +23,9 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -186,7 +189,7 @@ func TestWrapAuth(t *testing.T) {
 	rows.AddRow(30, "user1", 1, 1)
 	mock.ExpectQuery("SELECT").WithArgs(userName).WillReturnRows(rows)
 
-	authBase := AuthBase{secret, nil}
+	authBase := AuthBase{Secret: secret}
 
 	cookie := tocookie.GetCookie(userName, time.Minute, secret)
 
@@ -245,6 +248,76 @@ func TestWrapAuth(t *testing.T) {
 	}
 }
 
+func TestWrapClientCertAuth(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDB.Close()
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	defer db.Close()
+
+	secret := "secret"
+	expectUser := func(userName string, privLevel int) {
+		rows := sqlmock.NewRows([]string{"priv_level", "username", "id", "tenant_id"})
+		rows.AddRow(privLevel, userName, 1, 1)
+		mock.ExpectQuery("SELECT").WithArgs(userName).WillReturnRows(rows)
+	}
+
+	authBase := AuthBase{Secret: secret, ClientCertSubjects: map[string]string{"CN=t3c,O=Example": "t3c"}}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		user, err := auth.GetCurrentUser(r.Context())
+		if err != nil {
+			t.Fatalf("unable to get the current user: %v", err)
+		}
+		fmt.Fprint(w, user.UserName)
+	}
+	f := WrapHeaders(authBase.GetClientCertWrapper(15)(handler))
+
+	ctx := context.WithValue(context.Background(), api.DBContextKey, db)
+	ctx = context.WithValue(ctx, api.ConfigContextKey, &config.Config{ConfigTrafficOpsGolang: config.ConfigTrafficOpsGolang{DBQueryTimeoutSeconds: 20}})
+	withCert := func(r *http.Request, subject pkix.Name) *http.Request {
+		r = r.WithContext(ctx)
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: subject}}}}
+		return r
+	}
+
+	// a verified certificate of a mapped subject authenticates as its user, without a cookie.
+	expectUser("t3c", 30)
+	w, r := newRWPair(t, nil)
+	f(w, withCert(r, pkix.Name{CommonName: "t3c", Organization: []string{"Example"}}))
+	if w.Code != http.StatusOK || w.Body.String() != "t3c" {
+		t.Errorf("expected the mapped user to be authenticated by its certificate, actual: %d %s", w.Code, w.Body.String())
+	}
+
+	// the mapped user must still have the required privilege level.
+	expectUser("t3c", 10)
+	w, r = newRWPair(t, nil)
+	f(w, withCert(r, pkix.Name{CommonName: "t3c", Organization: []string{"Example"}}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected a %d response for a mapped user without the required privilege level, actual: %d", http.StatusForbidden, w.Code)
+	}
+
+	// a certificate of an unmapped subject falls back to a cookie or token.
+	w, r = newRWPair(t, nil)
+	f(w, withCert(r, pkix.Name{CommonName: "someone-else"}))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a %d response for an unmapped certificate without a cookie, actual: %d", http.StatusUnauthorized, w.Code)
+	}
+
+	expectUser("user1", 30)
+	w, r = newRWPair(t, tocookie.GetCookie("user1", time.Minute, secret))
+	f(w, withCert(r, pkix.Name{CommonName: "someone-else"}))
+	if w.Code != http.StatusOK || w.Body.String() != "user1" {
+		t.Errorf("expected an unmapped certificate with a cookie to authenticate as the cookie's user, actual: %d %s", w.Code, w.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected every user to be queried: %v", err)
+	}
+}
+
 func TestRequiredPermissionsMiddleware(t *testing.T) {
 	mockDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -262,7 +335,7 @@ func TestRequiredPermissionsMiddleware(t *testing.T) {
 	rows.AddRow(30, userName, 1, 1, "{foo}")
 	mock.ExpectQuery("SELECT").WithArgs(userName).WillReturnRows(rows)
 
-	authBase := AuthBase{secret, nil}
+	authBase := AuthBase{Secret: secret}
 
 	cookie := tocookie.GetCookie(userName, time.Minute, secret)
 
@@ -351,7 +424,7 @@ func TestConfigRoleBasedPermissionsHandling(t *testing.T) {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("successs\n"))
 	}
-	f := WrapHeaders(AuthBase{secret, nil}.GetWrapper(5)(RequiredPermissionsMiddleware([]string{"foo"})(handler)))
+	f := WrapHeaders(AuthBase{Secret: secret}.GetWrapper(5)(RequiredPermissionsMiddleware([]string{"foo"})(handler)))
 
 	w, r := newRWPair(t, cookie)
 	r = r.WithContext(ctx)
@@ -0,0 +1,177 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openAPIVersion is the version of the OpenAPI Specification of the skeleton
+// generated by OpenAPISkeleton.
+const openAPIVersion = "3.0.3"
+
+// openAPISecurityScheme is the name of the security scheme of authenticated
+// routes, which is the session cookie returned by /user/login.
+const openAPISecurityScheme = "cookieAuth"
+
+// routePathParamRegex matches the parameters of route path templates, e.g.
+// {id}.
+var routePathParamRegex = regexp.MustCompile(`{([^}]+)}`)
+
+type openAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       openAPIInfo                            `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components openAPIComponents                      `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type openAPIComponents struct {
+	SecuritySchemes map[string]openAPISecuritySchemeObject `json:"securitySchemes"`
+}
+
+type openAPISecuritySchemeObject struct {
+	Type string `json:"type"`
+	In   string `json:"in"`
+	Name string `json:"name"`
+}
+
+type openAPIOperation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Parameters  []openAPIParameter    `json:"parameters,omitempty"`
+	Responses   map[string]openAPIRef `json:"responses"`
+	// Security is never omitted, because an empty list marks the operation
+	// as unauthenticated.
+	Security []map[string][]string `json:"security"`
+	// Permissions are the Permissions a user must have to use the operation,
+	// which OpenAPI 3.0 can't express in the security requirements of an
+	// API key scheme.
+	Permissions []string `json:"x-required-permissions,omitempty"`
+	PrivLevel   int      `json:"x-required-priv-level,omitempty"`
+	RouteID     int      `json:"x-route-id"`
+	Disabled    bool     `json:"x-disabled,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name     string            `json:"name"`
+	In       string            `json:"in"`
+	Required bool              `json:"required"`
+	Schema   map[string]string `json:"schema"`
+}
+
+type openAPIRef struct {
+	Description string `json:"description"`
+}
+
+// openAPIPath returns the OpenAPI path of a route path template served on the
+// given API version, e.g. /api/4.0/servers/{id} of `servers/{id}/?$`. Route
+// paths are regular expressions, so the end anchor and an optional trailing
+// slash are removed, and other optional characters are kept.
+func openAPIPath(vstr string, path string) string {
+	path = strings.TrimSuffix(path, "$")
+	if strings.HasSuffix(path, "/?") {
+		path = strings.TrimSuffix(path, "/?")
+	} else {
+		path = strings.TrimSuffix(path, "?")
+	}
+	return "/" + strings.TrimPrefix(RoutePrefix, "^") + "/" + vstr + "/" + path
+}
+
+// OpenAPISkeleton returns an OpenAPI 3.0 document of the given routes, as
+// JSON. It has no schemas, but describes the path, method, path parameters,
+// and required Permissions of each route, on every API version it's served
+// on, as CreateRouteMap serves them. The routes with the given IDs are marked
+// disabled.
+func OpenAPISkeleton(rs []Route, disabledRouteIDs []int, version string) ([]byte, error) {
+	doc := openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: openAPIInfo{
+			Title:       "Traffic Ops API",
+			Version:     version,
+			Description: "A skeleton of the Traffic Ops API generated from its routes, without request or response schemas.",
+		},
+		Paths: map[string]map[string]openAPIOperation{},
+		Components: openAPIComponents{SecuritySchemes: map[string]openAPISecuritySchemeObject{
+			openAPISecurityScheme: {Type: "apiKey", In: "cookie", Name: "mojolicious"},
+		}},
+	}
+
+	versions := getSortedRouteVersions(rs)
+	disabledRoutes := GetRouteIDMap(disabledRouteIDs)
+	// servedBy is the route each operation was made from. A route of a later
+	// minor version replaces the route of an earlier one with the same method
+	// and path, otherwise the first route is kept, like the first matching
+	// route is served.
+	servedBy := map[string]Route{}
+	for _, r := range rs {
+		versionI := indexOfApiVersion(versions, r.Version)
+		for _, v := range versions[versionI:] {
+			if v.Major > r.Version.Major {
+				break
+			}
+			vstr := strconv.FormatUint(v.Major, 10) + "." + strconv.FormatUint(v.Minor, 10)
+			path := openAPIPath(vstr, r.Path)
+			method := strings.ToLower(r.Method)
+			key := method + " " + path
+			if prev, ok := servedBy[key]; ok && (prev.Version.Major > r.Version.Major || prev.Version.Major == r.Version.Major && prev.Version.Minor >= r.Version.Minor) {
+				continue
+			}
+			servedBy[key] = r
+
+			op := openAPIOperation{
+				OperationID: method + "-" + strconv.Itoa(r.ID) + "-" + vstr,
+				Summary:     r.Method + " " + path,
+				Responses:   map[string]openAPIRef{strconv.Itoa(http.StatusOK): {Description: "Success"}},
+				Security:    []map[string][]string{},
+				RouteID:     r.ID,
+			}
+			for _, match := range routePathParamRegex.FindAllStringSubmatch(r.Path, -1) {
+				op.Parameters = append(op.Parameters, openAPIParameter{Name: match[1], In: "path", Required: true, Schema: map[string]string{"type": "string"}})
+			}
+			if r.Authenticated {
+				op.Security = append(op.Security, map[string][]string{openAPISecurityScheme: {}})
+				op.Permissions = append([]string{}, r.RequiredPermissions...)
+				sort.Strings(op.Permissions)
+				op.PrivLevel = r.RequiredPrivLevel
+			}
+			if _, ok := disabledRoutes[r.ID]; ok {
+				op.Disabled = true
+			}
+
+			if _, ok := doc.Paths[path]; !ok {
+				doc.Paths[path] = map[string]openAPIOperation{}
+			}
+			doc.Paths[path][method] = op
+		}
+	}
+
+	return json.MarshalIndent(doc, "", "\t")
+}
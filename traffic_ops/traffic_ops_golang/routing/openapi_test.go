@@ -0,0 +1,93 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+func TestOpenAPISkeleton(t *testing.T) {
+	routes := []Route{
+		{Version: api.Version{Major: 4, Minor: 1}, Method: http.MethodGet, Path: `servers/?$`, RequiredPermissions: []string{"SERVER:READ", "CDN:READ"}, Authenticated: true, ID: 3},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `servers/?$`, RequiredPermissions: []string{"SERVER:READ"}, Authenticated: true, ID: 1},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodDelete, Path: `servers/{id}$`, RequiredPermissions: []string{"SERVER:DELETE"}, Authenticated: true, ID: 2},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodPost, Path: `user/login/?$`, ID: 4},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `cdns/name/{name}/dnsseckeys?$`, Authenticated: true, ID: 5},
+	}
+
+	bts, err := OpenAPISkeleton(routes, []int{2}, "7.0.0")
+	if err != nil {
+		t.Fatalf("generating OpenAPI skeleton: %v", err)
+	}
+	doc := openAPIDocument{}
+	if err := json.Unmarshal(bts, &doc); err != nil {
+		t.Fatalf("decoding OpenAPI skeleton: %v", err)
+	}
+	if doc.OpenAPI != openAPIVersion || doc.Info.Version != "7.0.0" {
+		t.Errorf("expected OpenAPI %s of version 7.0.0, actual %s of %s", openAPIVersion, doc.OpenAPI, doc.Info.Version)
+	}
+
+	expectedPaths := map[string][]string{
+		"/api/4.0/servers":                     {"get"},
+		"/api/4.1/servers":                     {"get"},
+		"/api/4.0/servers/{id}":                {"delete"},
+		"/api/4.1/servers/{id}":                {"delete"},
+		"/api/4.0/user/login":                  {"post"},
+		"/api/4.1/user/login":                  {"post"},
+		"/api/4.0/cdns/name/{name}/dnsseckeys": {"get"},
+		"/api/4.1/cdns/name/{name}/dnsseckeys": {"get"},
+	}
+	if len(doc.Paths) != len(expectedPaths) {
+		t.Errorf("expected %d paths, actual %d: %v", len(expectedPaths), len(doc.Paths), doc.Paths)
+	}
+	for path, methods := range expectedPaths {
+		for _, method := range methods {
+			if _, ok := doc.Paths[path][method]; !ok {
+				t.Errorf("expected %s %s", method, path)
+			}
+		}
+	}
+
+	if op := doc.Paths["/api/4.1/servers"]["get"]; op.RouteID != 3 || len(op.Permissions) != 2 || op.Permissions[0] != "CDN:READ" {
+		t.Errorf("expected the 4.1 route to replace the 4.0 route on 4.1 with its sorted Permissions, actual %+v", op)
+	}
+	if op := doc.Paths["/api/4.0/servers"]["get"]; op.RouteID != 1 {
+		t.Errorf("expected the 4.0 route on 4.0, actual %+v", op)
+	}
+
+	del := doc.Paths["/api/4.0/servers/{id}"]["delete"]
+	if !del.Disabled {
+		t.Error("expected the disabled route to be marked disabled")
+	}
+	if len(del.Parameters) != 1 || del.Parameters[0].Name != "id" || del.Parameters[0].In != "path" || !del.Parameters[0].Required {
+		t.Errorf("expected a required path parameter 'id', actual %+v", del.Parameters)
+	}
+	if len(del.Security) != 1 || del.Security[0][openAPISecurityScheme] == nil {
+		t.Errorf("expected the authenticated route to require %s, actual %+v", openAPISecurityScheme, del.Security)
+	}
+
+	if login := doc.Paths["/api/4.0/user/login"]["post"]; len(login.Security) != 0 || len(login.Permissions) != 0 {
+		t.Errorf("expected the unauthenticated route to have no security requirements, actual %+v", login)
+	}
+}
@@ -0,0 +1,183 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/login"
+)
+
+// readOnly is the read-only mode state. Traffic Ops is in read-only mode while
+// it's enabled by an admin, or the database is in recovery.
+var readOnly = struct {
+	m          sync.RWMutex
+	enabled    bool
+	dbRecovery bool
+}{}
+
+// readOnlyExemptPathRe matches the request paths which are served even in
+// read-only mode: the read-only toggle endpoint itself, and logging in, which
+// skips its only write, of the user's last authentication time, in read-only
+// mode.
+var readOnlyExemptPathRe = regexp.MustCompile(`^/api/[^/]+/(read_only|user/login(/.*)?)/?$`)
+
+func init() {
+	// logging in is served in read-only mode, so it needs to know not to write.
+	login.SetReadOnlyModeFunc(InReadOnlyMode)
+}
+
+// ReadOnlyMode is the representation of the read-only mode state in the
+// read-only endpoint's requests and responses.
+type ReadOnlyMode struct {
+	Enabled *bool `json:"enabled"`
+	// DBRecovery is whether the database was last seen in recovery. It's ignored in requests.
+	DBRecovery bool `json:"dbRecovery"`
+}
+
+// SetReadOnlyMode enables or disables read-only mode. While enabled, or while
+// the database is in recovery, all mutating API requests except those to the
+// read-only endpoint receive a 503.
+func SetReadOnlyMode(enabled bool) {
+	setReadOnly(func() { readOnly.enabled = enabled })
+}
+
+// setDBRecovery sets whether the database is in recovery.
+func setDBRecovery(recovery bool) {
+	setReadOnly(func() { readOnly.dbRecovery = recovery })
+}
+
+// setReadOnly changes the read-only mode state with the given func, logging
+// if Traffic Ops entered or left read-only mode.
+func setReadOnly(set func()) {
+	readOnly.m.Lock()
+	defer readOnly.m.Unlock()
+	was := readOnly.enabled || readOnly.dbRecovery
+	set()
+	is := readOnly.enabled || readOnly.dbRecovery
+	if was == is {
+		return
+	}
+	if is {
+		log.Warnf("read-only mode is active (enabled: %t, database in recovery: %t): serving 503 for all mutating API requests\n", readOnly.enabled, readOnly.dbRecovery)
+	} else {
+		log.Infoln("read-only mode is no longer active")
+	}
+}
+
+// InReadOnlyMode returns whether Traffic Ops is currently in read-only mode.
+func InReadOnlyMode() bool {
+	readOnly.m.RLock()
+	defer readOnly.m.RUnlock()
+	return readOnly.enabled || readOnly.dbRecovery
+}
+
+// isReadOnlyBlocked returns whether a request with the given method and path
+// must be refused because of read-only mode.
+func isReadOnlyBlocked(method string, path string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if !InReadOnlyMode() {
+		return false
+	}
+	if !strings.HasPrefix(path, "/api/") {
+		return false
+	}
+	return !readOnlyExemptPathRe.MatchString(path)
+}
+
+// StartDBRecoveryCheck starts checking whether the database is in recovery
+// every interval, entering read-only mode while it is. If the check fails, the
+// last known state is kept.
+func StartDBRecoveryCheck(db *sql.DB, interval time.Duration, timeout time.Duration) {
+	checkDBRecovery(db, timeout)
+	go func() {
+		for range time.Tick(interval) {
+			checkDBRecovery(db, timeout)
+		}
+	}()
+}
+
+func checkDBRecovery(db *sql.DB, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	recovery := false
+	if err := db.QueryRowContext(ctx, `SELECT pg_is_in_recovery()`).Scan(&recovery); err != nil {
+		log.Errorf("checking whether the database is in recovery: %v\n", err)
+		return
+	}
+	setDBRecovery(recovery)
+}
+
+// GetReadOnly is the handler for GET requests to the read-only endpoint.
+func GetReadOnly(w http.ResponseWriter, r *http.Request) {
+	readOnly.m.RLock()
+	enabled, recovery := readOnly.enabled, readOnly.dbRecovery
+	readOnly.m.RUnlock()
+	api.WriteResp(w, r, ReadOnlyMode{Enabled: &enabled, DBRecovery: recovery})
+}
+
+// PutReadOnly is the handler for PUT requests to the read-only endpoint,
+// which enables or disables read-only mode. Read-only mode stays active while
+// the database is in recovery, even if it's disabled.
+func PutReadOnly(w http.ResponseWriter, r *http.Request) {
+	var req ReadOnlyMode
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.HandleErr(w, r, nil, http.StatusBadRequest, errors.New("malformed JSON: "+err.Error()), nil)
+		return
+	}
+	if req.Enabled == nil {
+		api.HandleErr(w, r, nil, http.StatusBadRequest, errors.New("'enabled' is required"), nil)
+		return
+	}
+
+	userName := "-"
+	if user, err := auth.GetCurrentUser(r.Context()); err == nil {
+		userName = user.UserName
+	}
+	log.Infof("user '%s' set read-only mode enabled to %t", userName, *req.Enabled)
+	SetReadOnlyMode(*req.Enabled)
+
+	readOnly.m.RLock()
+	req.DBRecovery = readOnly.dbRecovery
+	readOnly.m.RUnlock()
+
+	msg := "Read-only mode disabled"
+	if *req.Enabled {
+		msg = "Read-only mode enabled"
+	} else if req.DBRecovery {
+		msg = "Read-only mode disabled, but remains active while the database is in recovery"
+	}
+	api.WriteRespAlertObj(w, r, tc.SuccessLevel, msg, req)
+}
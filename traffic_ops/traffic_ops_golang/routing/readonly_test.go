@@ -0,0 +1,160 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/plugin"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func resetReadOnly() {
+	SetReadOnlyMode(false)
+	setDBRecovery(false)
+}
+
+func TestIsReadOnlyBlocked(t *testing.T) {
+	defer resetReadOnly()
+
+	resetReadOnly()
+	if isReadOnlyBlocked(http.MethodPost, "/api/4.0/servers") {
+		t.Error("expected no requests to be blocked outside of read-only mode")
+	}
+
+	SetReadOnlyMode(true)
+	tests := []struct {
+		method   string
+		path     string
+		expected bool
+	}{
+		{http.MethodGet, "/api/4.0/servers", false},
+		{http.MethodHead, "/api/4.0/servers", false},
+		{http.MethodPost, "/api/4.0/servers", true},
+		{http.MethodPut, "/api/4.0/servers/1", true},
+		{http.MethodPatch, "/api/4.0/servers/1", true},
+		{http.MethodDelete, "/api/3.1/cdns/1", true},
+		{http.MethodPut, "/api/4.0/read_only", false},
+		{http.MethodPost, "/api/4.0/user/login", false},
+		{http.MethodPost, "/api/4.0/user/login/token", false},
+		{http.MethodPost, "/api/4.0/user/logout", true},
+		{http.MethodPost, "/other", false},
+	}
+	for _, test := range tests {
+		if actual := isReadOnlyBlocked(test.method, test.path); actual != test.expected {
+			t.Errorf("isReadOnlyBlocked(%s, %s) - expected: %t, actual: %t", test.method, test.path, test.expected, actual)
+		}
+	}
+
+	// read-only mode stays active while the database is in recovery.
+	SetReadOnlyMode(false)
+	setDBRecovery(true)
+	if !isReadOnlyBlocked(http.MethodPost, "/api/4.0/servers") {
+		t.Error("expected mutating requests to be blocked while the database is in recovery")
+	}
+}
+
+func TestHandlerReadOnlyMode(t *testing.T) {
+	defer resetReadOnly()
+
+	var called bool
+	handler := func(w http.ResponseWriter, r *http.Request) { called = true }
+	routes := map[string][]CompiledRoute{
+		http.MethodGet:  {{Handler: handler, Regex: regexp.MustCompile(`^api/4.0/servers/?$`), ID: 1}},
+		http.MethodPost: {{Handler: handler, Regex: regexp.MustCompile(`^api/4.0/servers/?$`), ID: 2}},
+	}
+	catchall := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	cfg := config.Config{Secrets: []string{"n0SeCr3t$"}}
+	cfg.ReadOnly.RetryAfterSeconds = 60
+	versions := map[api.Version]struct{}{{Major: 4, Minor: 0}: {}}
+	handle := func(method string) *httptest.ResponseRecorder {
+		called = false
+		w := httptest.NewRecorder()
+		Handler(routes, versions, catchall, nil, &cfg, func() uint64 { return 0 }, plugin.Get(cfg), nil, w, httptest.NewRequest(method, "/api/4.0/servers", nil))
+		return w
+	}
+
+	SetReadOnlyMode(true)
+	w := handle(http.MethodPost)
+	if called {
+		t.Error("expected route handler not to be called for a POST in read-only mode")
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected response code %d for a POST in read-only mode, actual: %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "60" {
+		t.Errorf("expected Retry-After '60', actual: '%s'", retryAfter)
+	}
+
+	handle(http.MethodGet)
+	if !called {
+		t.Error("expected route handler to be called for a GET in read-only mode")
+	}
+
+	SetReadOnlyMode(false)
+	handle(http.MethodPost)
+	if !called {
+		t.Error("expected route handler to be called for a POST outside of read-only mode")
+	}
+}
+
+func TestCheckDBRecovery(t *testing.T) {
+	defer resetReadOnly()
+	resetReadOnly()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT pg_is_in_recovery").WillReturnRows(sqlmock.NewRows([]string{"pg_is_in_recovery"}).AddRow(true))
+	checkDBRecovery(db, time.Second)
+	if !InReadOnlyMode() {
+		t.Error("expected read-only mode while the database is in recovery")
+	}
+
+	// a failed check keeps the last known state.
+	mock.ExpectQuery("SELECT pg_is_in_recovery").WillReturnError(errors.New("connection refused"))
+	checkDBRecovery(db, time.Second)
+	if !InReadOnlyMode() {
+		t.Error("expected read-only mode to be kept after a failed check")
+	}
+
+	mock.ExpectQuery("SELECT pg_is_in_recovery").WillReturnRows(sqlmock.NewRows([]string{"pg_is_in_recovery"}).AddRow(false))
+	checkDBRecovery(db, time.Second)
+	if InReadOnlyMode() {
+		t.Error("expected read-only mode to end once the database is out of recovery")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectations were not met: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+)
+
+// statusRecorder is a http.ResponseWriter which records the response code,
+// so that a request which isn't sampled can still be logged if it failed.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush flushes the underlying http.ResponseWriter, if it can be, for the
+// backend route reverse proxy.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for http.ResponseController.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// requestLog logs the lines of a request being handled, sampled by the given
+// configuration. Sampled requests are logged when they start and finish, the
+// others only when they finish, and only if they failed or were slow, in
+// which case both lines are logged then.
+type requestLog struct {
+	r        *http.Request
+	reqID    string
+	sampled  bool
+	start    time.Time
+	recorder *statusRecorder
+	slow     time.Duration
+}
+
+// startRequestLog logs the start of a sampled request, and returns the
+// http.ResponseWriter the request must be handled with.
+func startRequestLog(w http.ResponseWriter, r *http.Request, reqID uint64, sampling config.ConfigRequestLogSampling) (*requestLog, http.ResponseWriter) {
+	l := &requestLog{
+		r:       r,
+		reqID:   strconv.FormatUint(reqID, 10),
+		sampled: sampling.Sampled(reqID),
+		start:   time.Now(),
+		slow:    sampling.SlowThreshold(),
+	}
+	if l.sampled {
+		l.logHandling()
+		return l, w
+	}
+	l.recorder = &statusRecorder{ResponseWriter: w}
+	return l, l.recorder
+}
+
+func (l *requestLog) logHandling() {
+	log.Infoln(l.r.Method + " " + l.r.URL.Path + "?" + l.r.URL.RawQuery + " handling (reqid " + l.reqID + ")")
+}
+
+// finish logs the end of the request.
+func (l *requestLog) finish() {
+	elapsed := time.Since(l.start)
+	if !l.sampled {
+		if l.recorder.code < http.StatusBadRequest && elapsed < l.slow {
+			return
+		}
+		l.logHandling()
+	}
+	log.Infoln(l.r.Method + " " + l.r.URL.Path + "?" + l.r.URL.RawQuery + " handled (reqid " + l.reqID + ") in " + elapsed.String())
+}
@@ -0,0 +1,102 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/plugin"
+)
+
+func TestHandlerRequestLogSampling(t *testing.T) {
+	infoLog := log.Info
+	defer func() { log.Info = infoLog }()
+	buf := &bytes.Buffer{}
+	log.Info = stdlog.New(buf, "", 0)
+
+	var code int
+	var delay time.Duration
+	routes := map[string][]CompiledRoute{
+		http.MethodGet: {{
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(delay)
+				w.WriteHeader(code)
+			},
+			Regex: regexp.MustCompile(`^api/4.0/servers/?$`),
+			ID:    1,
+		}},
+	}
+	catchall := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	cfg := config.Config{Secrets: []string{"n0SeCr3t$"}}
+	cfg.RequestLogSampling.Rate = 10
+	cfg.RequestLogSampling.SlowThresholdMS = 50
+	versions := map[api.Version]struct{}{{Major: 4, Minor: 0}: {}}
+
+	// handle returns the request log lines of the request with the given ID.
+	handle := func(reqID uint64) string {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		Handler(routes, versions, catchall, nil, &cfg, func() uint64 { return reqID }, plugin.Get(cfg), nil, w, httptest.NewRequest(http.MethodGet, "/api/4.0/servers", nil))
+		return buf.String()
+	}
+	countLines := func(logs string) (int, int) {
+		return strings.Count(logs, " handling (reqid "), strings.Count(logs, " handled (reqid ")
+	}
+
+	tests := []struct {
+		name     string
+		reqID    uint64
+		code     int
+		delay    time.Duration
+		expected int
+	}{
+		{"sampled", 20, http.StatusOK, 0, 1},
+		{"not sampled", 21, http.StatusOK, 0, 0},
+		{"not sampled error", 22, http.StatusInternalServerError, 0, 1},
+		{"not sampled client error", 23, http.StatusNotFound, 0, 1},
+		{"not sampled slow", 24, http.StatusOK, 60 * time.Millisecond, 1},
+	}
+	for _, test := range tests {
+		code, delay = test.code, test.delay
+		handling, handled := countLines(handle(test.reqID))
+		if handling != test.expected || handled != test.expected {
+			t.Errorf("%s: expected %d handling and handled lines, actual: %d handling, %d handled", test.name, test.expected, handling, handled)
+		}
+	}
+
+	// without sampling, every request is logged.
+	cfg.RequestLogSampling.Rate = 0
+	code, delay = http.StatusOK, 0
+	if handling, handled := countLines(handle(21)); handling != 1 || handled != 1 {
+		t.Errorf("expected every request to be logged without sampling, actual: %d handling, %d handled", handling, handled)
+	}
+}
@@ -0,0 +1,206 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// routeIndex buckets the compiled routes of a method by the first path
+// segment after their API version, e.g. "servers" of "^api/4.0/servers/?$",
+// so a request is only matched against the regexes of the routes which could
+// match it, rather than every route of its method.
+//
+// Routes whose first segment isn't fixed by their regex, e.g. because it has
+// a parameter, or because the regex isn't anchored after it, can't be
+// bucketed, and are matched against every request. Candidates are matched in
+// the order of the routes, so the first route to match wins, as it does when
+// matching every route in turn.
+type routeIndex struct {
+	// routes are the indexed routes, which are only matched through the index
+	// if they're the same routes the request is matched against.
+	routes []CompiledRoute
+	// prefixLens are the distinct lengths of the "api/<version>/" prefixes of
+	// the bucketed routes, after which their first segment starts.
+	prefixLens []int
+	// buckets are the indexes of the bucketed routes, in order, by the length
+	// of their prefix and their first segment.
+	buckets map[int]map[string][]int
+	// unbucketed are the indexes of the routes which can't be bucketed, in order.
+	unbucketed []int
+}
+
+// isRouteSegmentChar returns whether c is matched literally in a route regex,
+// and may be part of a path segment.
+func isRouteSegmentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// routeSegment returns the length of the "api/<version>/" prefix of the given
+// compiled route, and its first segment after the prefix, if every path the
+// route matches has exactly that segment there. Otherwise, ok is false.
+func routeSegment(route CompiledRoute) (prefixLen int, segment string, ok bool) {
+	if route.Regex == nil {
+		return 0, "", false
+	}
+	expr := route.Regex.String()
+	// alternation could match paths without the prefix
+	if strings.Contains(expr, "|") {
+		return 0, "", false
+	}
+	prefix := RoutePrefix + "/" + strconv.FormatUint(route.Version.Major, 10) + "." + strconv.FormatUint(route.Version.Minor, 10) + "/"
+	if !strings.HasPrefix(expr, prefix) {
+		return 0, "", false
+	}
+	// every character of the prefix but the anchor matches exactly one character
+	prefixLen = len(strings.TrimPrefix(prefix, "^"))
+	rest := expr[len(prefix):]
+
+	i := 0
+	for i < len(rest) && isRouteSegmentChar(rest[i]) {
+		i++
+	}
+	segment, tail := rest[:i], rest[i:]
+	if segment == "" {
+		return 0, "", false
+	}
+	switch {
+	case tail == "$" || tail == "/?$":
+		// the segment ends the path, with or without a trailing slash
+	case strings.HasPrefix(tail, "/") && (len(tail) == 1 || !strings.ContainsAny(tail[1:2], "?*+{")):
+		// the segment is followed by a slash which isn't optional
+	default:
+		return 0, "", false
+	}
+	return prefixLen, segment, true
+}
+
+// newRouteIndex indexes the given compiled routes of a method.
+func newRouteIndex(routes []CompiledRoute) *routeIndex {
+	idx := &routeIndex{routes: routes, buckets: map[int]map[string][]int{}}
+	for i, route := range routes {
+		prefixLen, segment, ok := routeSegment(route)
+		if !ok {
+			idx.unbucketed = append(idx.unbucketed, i)
+			continue
+		}
+		if _, ok := idx.buckets[prefixLen]; !ok {
+			idx.buckets[prefixLen] = map[string][]int{}
+			idx.prefixLens = append(idx.prefixLens, prefixLen)
+		}
+		idx.buckets[prefixLen][segment] = append(idx.buckets[prefixLen][segment], i)
+	}
+	return idx
+}
+
+// indexes reports whether idx indexes the given routes.
+func (idx *routeIndex) indexes(routes []CompiledRoute) bool {
+	return idx != nil && len(idx.routes) == len(routes) && (len(routes) == 0 || &idx.routes[0] == &routes[0])
+}
+
+// candidates returns the indexes of the routes which could match the
+// requested path, without its leading slash, in order.
+func (idx *routeIndex) candidates(requested string) []int {
+	lists := make([][]int, 0, len(idx.prefixLens)+1)
+	if len(idx.unbucketed) > 0 {
+		lists = append(lists, idx.unbucketed)
+	}
+	for _, prefixLen := range idx.prefixLens {
+		if len(requested) <= prefixLen {
+			continue
+		}
+		segment := requested[prefixLen:]
+		if slash := strings.IndexByte(segment, '/'); slash >= 0 {
+			segment = segment[:slash]
+		}
+		if bucket := idx.buckets[prefixLen][segment]; len(bucket) > 0 {
+			lists = append(lists, bucket)
+		}
+	}
+	switch len(lists) {
+	case 0:
+		return nil
+	case 1:
+		return lists[0]
+	}
+
+	// merge the lists, which are each in order
+	merged := []int{}
+	for {
+		next := -1
+		for i, list := range lists {
+			if len(list) > 0 && (next < 0 || list[0] < lists[next][0]) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return merged
+		}
+		merged = append(merged, lists[next][0])
+		lists[next] = lists[next][1:]
+	}
+}
+
+// matchRoute returns the first of the given compiled routes of a method which
+// matches the requested path, without its leading slash, and the submatches of
+// its regex. If the routes are indexed, only the routes which could match are
+// tried.
+func matchRoute(method string, routes []CompiledRoute, requested string) (*CompiledRoute, []string) {
+	if idx := getRouteIndexes()[method]; idx.indexes(routes) {
+		for _, i := range idx.candidates(requested) {
+			if match := routes[i].Regex.FindStringSubmatch(requested); len(match) > 0 {
+				return &routes[i], match
+			}
+		}
+		return nil, nil
+	}
+	return matchRouteLinear(routes, requested)
+}
+
+// matchRouteLinear returns the first of the given compiled routes which
+// matches the requested path, trying each in turn, and the submatches of its
+// regex.
+func matchRouteLinear(routes []CompiledRoute, requested string) (*CompiledRoute, []string) {
+	for i := range routes {
+		if match := routes[i].Regex.FindStringSubmatch(requested); len(match) > 0 {
+			return &routes[i], match
+		}
+	}
+	return nil, nil
+}
+
+// routeIndexes stores the map[string]*routeIndex of the routes compiled at
+// startup, by method. Until they're set, every route is tried in turn.
+var routeIndexes atomic.Value
+
+func setRouteIndexes(compiledRoutes map[string][]CompiledRoute) {
+	indexes := make(map[string]*routeIndex, len(compiledRoutes))
+	for method, routes := range compiledRoutes {
+		indexes[method] = newRouteIndex(routes)
+	}
+	routeIndexes.Store(indexes)
+}
+
+func getRouteIndexes() map[string]*routeIndex {
+	indexes, _ := routeIndexes.Load().(map[string]*routeIndex)
+	return indexes
+}
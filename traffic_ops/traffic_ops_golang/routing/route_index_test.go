@@ -0,0 +1,156 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/routing/middleware"
+)
+
+// realCompiledRoutes returns the compiled routes of Traffic Ops.
+func realCompiledRoutes(t testing.TB) map[string][]CompiledRoute {
+	d := ServerData{Config: config.NewFakeConfig()}
+	routeSlice, _, err := Routes(d)
+	if err != nil {
+		t.Fatalf("getting routes: %v", err)
+	}
+	authBase := middleware.AuthBase{Secret: d.Secrets[0], Override: nil}
+	routes, _ := CreateRouteMap(routeSlice, nil, nil, authBase, 1, nil)
+	return CompileRoutes(routes)
+}
+
+// sampleRoutePaths returns requested paths, without their leading slash, which match or nearly match the
+// given compiled routes.
+func sampleRoutePaths(routes []CompiledRoute) []string {
+	paths := []string{"", "api", "api/", "api/4.0", "api/4.0/", "api/4.0/nope", "api/9.9/servers", "servers"}
+	for _, route := range routes {
+		path := strings.TrimPrefix(route.Regex.String(), "^")
+		path = strings.TrimSuffix(strings.TrimSuffix(path, "$"), "/?")
+		path = strings.Replace(path, `([^/]+)`, "1", -1)
+		paths = append(paths, path, path+"/", path+"/1", path+"x", strings.Replace(path, "/1", "/1/x", 1))
+	}
+	return paths
+}
+
+func TestRouteIndexMatchesLinearScan(t *testing.T) {
+	defer setRouteIndexes(nil)
+
+	compiledRoutes := realCompiledRoutes(t)
+	setRouteIndexes(compiledRoutes)
+	for method, routes := range compiledRoutes {
+		idx := getRouteIndexes()[method]
+		if len(idx.unbucketed) > len(routes)/10 {
+			t.Errorf("expected at most a tenth of the %s routes to be unbucketed, actual: %d of %d", method, len(idx.unbucketed), len(routes))
+		}
+		for _, path := range sampleRoutePaths(routes) {
+			expected, expectedMatch := matchRouteLinear(routes, path)
+			actual, actualMatch := matchRoute(method, routes, path)
+			if expected != actual {
+				t.Errorf("%s %s: expected route %v, actual: %v", method, path, routeID(expected), routeID(actual))
+			} else if strings.Join(expectedMatch, ",") != strings.Join(actualMatch, ",") {
+				t.Errorf("%s %s: expected submatches %v, actual: %v", method, path, expectedMatch, actualMatch)
+			}
+		}
+	}
+}
+
+func routeID(route *CompiledRoute) interface{} {
+	if route == nil {
+		return nil
+	}
+	return route.ID
+}
+
+func TestRouteIndexFirstRouteWins(t *testing.T) {
+	defer setRouteIndexes(nil)
+
+	v4 := api.Version{Major: 4, Minor: 0}
+	compile := func(id int, path string) CompiledRoute {
+		return CompiledRoute{ID: id, Regex: regexp.MustCompile(path), Version: v4}
+	}
+	routes := map[string][]CompiledRoute{http.MethodGet: {
+		compile(1, `^api/4.0/servers/details/?$`),
+		compile(2, `^api/4.0/([^/]+)/details/?$`),
+		compile(3, `^api/4.0/servers/([^/]+)$`),
+		compile(4, `^api/4.0/servers/?(\.json)?$`),
+		compile(5, `^api/4.0/servers/?$`),
+		compile(6, `^api/4.0/servers/([^/]+)/?$`),
+	}}
+
+	expected := map[string]interface{}{
+		"api/4.0/servers/details":  1,
+		"api/4.0/profiles/details": 2,
+		"api/4.0/servers/1":        3,
+		"api/4.0/servers":          4,
+		"api/4.0/servers.json":     4,
+		"api/4.0/servers/1/":       6,
+		"api/4.0/serversx":         nil,
+		"api/4.0/profiles":         nil,
+	}
+
+	idx := newRouteIndex(routes[http.MethodGet])
+	if len(idx.unbucketed) != 2 || idx.unbucketed[0] != 1 || idx.unbucketed[1] != 3 {
+		t.Errorf("expected the routes at 1 and 3 to be unbucketed, actual: %v", idx.unbucketed)
+	}
+
+	for _, indexed := range []bool{false, true} {
+		if indexed {
+			setRouteIndexes(routes)
+		}
+		for path, id := range expected {
+			route, _ := matchRoute(http.MethodGet, routes[http.MethodGet], path)
+			if routeID(route) != id {
+				t.Errorf("indexed %t, %s: expected route %v, actual: %v", indexed, path, id, routeID(route))
+			}
+		}
+	}
+
+	// routes which aren't the indexed routes are matched in turn
+	other := []CompiledRoute{compile(7, `^api/4.0/servers/?$`)}
+	if route, _ := matchRoute(http.MethodGet, other, "api/4.0/servers"); routeID(route) != 7 {
+		t.Errorf("expected unindexed routes to be matched, actual: %v", routeID(route))
+	}
+}
+
+func BenchmarkRouteMatch(b *testing.B) {
+	defer setRouteIndexes(nil)
+
+	compiledRoutes := realCompiledRoutes(b)
+	routes := compiledRoutes[http.MethodGet]
+	paths := sampleRoutePaths(routes)
+	setRouteIndexes(compiledRoutes)
+
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			matchRouteLinear(routes, paths[i%len(paths)])
+		}
+	})
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			matchRoute(http.MethodGet, routes, paths[i%len(paths)])
+		}
+	})
+}
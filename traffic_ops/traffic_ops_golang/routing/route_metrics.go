@@ -0,0 +1,227 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/routing/middleware"
+)
+
+// RouteLatencyMetricName is the name of the per-route request latency
+// histograms.
+const RouteLatencyMetricName = "traffic_ops_route_request_duration_seconds"
+
+// ConfigNotModifiedMetricName is the name of the counters of the 304 Not
+// Modified responses served for config endpoints whose ETag matched, and of the
+// bytes those responses didn't send.
+const ConfigNotModifiedMetricName = "traffic_ops_config_not_modified"
+
+const (
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// routeLatencyKey identifies a compiled route, which is served for a single
+// method and API version.
+type routeLatencyKey struct {
+	method  string
+	version api.Version
+	id      int
+}
+
+// routeLatencyHistogram counts the requests handled by a route in each
+// latency bucket. The counts aren't cumulative; the last one is of the
+// requests slower than every bucket.
+type routeLatencyHistogram struct {
+	counts   []uint64
+	sumNanos uint64
+}
+
+// routeLatencyMetrics are the request latency histograms of every compiled
+// route. The histograms are all created along with the routes, and never
+// added to, so their memory is bounded by the route set and they may be read
+// and updated without locking.
+type routeLatencyMetrics struct {
+	buckets    []float64
+	histograms map[routeLatencyKey]*routeLatencyHistogram
+}
+
+// newRouteLatencyMetrics creates the latency histograms of the given compiled
+// routes, with the given bucket upper bounds in seconds.
+func newRouteLatencyMetrics(routes map[string][]CompiledRoute, buckets []float64) *routeLatencyMetrics {
+	m := &routeLatencyMetrics{buckets: buckets, histograms: map[routeLatencyKey]*routeLatencyHistogram{}}
+	for method, mRoutes := range routes {
+		for _, route := range mRoutes {
+			key := routeLatencyKey{method: method, version: route.Version, id: route.ID}
+			if _, ok := m.histograms[key]; !ok {
+				m.histograms[key] = &routeLatencyHistogram{counts: make([]uint64, len(buckets)+1)}
+			}
+		}
+	}
+	return m
+}
+
+// observe records a request handled by the route with the given key in the
+// given time. Requests of unknown routes are ignored.
+func (m *routeLatencyMetrics) observe(key routeLatencyKey, elapsed time.Duration) {
+	h, ok := m.histograms[key]
+	if !ok {
+		return
+	}
+	i := sort.SearchFloat64s(m.buckets, elapsed.Seconds())
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.sumNanos, uint64(elapsed))
+}
+
+// write writes the histograms in the OpenMetrics text format, which, but for
+// its final "# EOF" line, which is left to the caller, is also the Prometheus
+// text format.
+func (m *routeLatencyMetrics) write(buf *bytes.Buffer) {
+	keys := make([]routeLatencyKey, 0, len(m.histograms))
+	for key := range m.histograms {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].id != keys[j].id {
+			return keys[i].id < keys[j].id
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		if keys[i].version.Major != keys[j].version.Major {
+			return keys[i].version.Major < keys[j].version.Major
+		}
+		return keys[i].version.Minor < keys[j].version.Minor
+	})
+
+	buf.WriteString("# TYPE " + RouteLatencyMetricName + " histogram\n")
+	buf.WriteString("# HELP " + RouteLatencyMetricName + " The time taken to handle requests to each API route.\n")
+	for _, key := range keys {
+		h := m.histograms[key]
+		labels := `method="` + key.method + `",version="` + strconv.FormatUint(key.version.Major, 10) + "." + strconv.FormatUint(key.version.Minor, 10) + `",route="` + strconv.Itoa(key.id) + `"`
+		count := uint64(0)
+		for i := range h.counts {
+			count += atomic.LoadUint64(&h.counts[i])
+			le := "+Inf"
+			if i < len(m.buckets) {
+				le = strconv.FormatFloat(m.buckets[i], 'g', -1, 64)
+			}
+			buf.WriteString(RouteLatencyMetricName + "_bucket{" + labels + `,le="` + le + `"} ` + strconv.FormatUint(count, 10) + "\n")
+		}
+		sum := time.Duration(atomic.LoadUint64(&h.sumNanos)).Seconds()
+		buf.WriteString(RouteLatencyMetricName + "_sum{" + labels + "} " + strconv.FormatFloat(sum, 'g', -1, 64) + "\n")
+		buf.WriteString(RouteLatencyMetricName + "_count{" + labels + "} " + strconv.FormatUint(count, 10) + "\n")
+	}
+}
+
+// writeNotModifiedMetrics writes the counters of the 304 Not Modified
+// responses of each config, which, unlike the route latency histograms, only
+// appear once a config has been answered with one.
+func writeNotModifiedMetrics(buf *bytes.Buffer, openMetrics bool) {
+	counts := api.NotModifiedCounts()
+	if len(counts) == 0 {
+		return
+	}
+	counters := []struct {
+		name  string
+		help  string
+		value func(api.NotModifiedCount) uint64
+	}{
+		{ConfigNotModifiedMetricName + "_responses", "The 304 Not Modified responses served for each config whose ETag matched.", func(c api.NotModifiedCount) uint64 { return c.Responses }},
+		{ConfigNotModifiedMetricName + "_bytes", "The bytes of config which weren't sent because their ETag matched.", func(c api.NotModifiedCount) uint64 { return c.Bytes }},
+	}
+	for _, counter := range counters {
+		// the OpenMetrics metric family of a counter is named without its _total suffix, but the Prometheus one isn't
+		family := counter.name
+		if !openMetrics {
+			family += "_total"
+		}
+		buf.WriteString("# TYPE " + family + " counter\n")
+		buf.WriteString("# HELP " + family + " " + counter.help + "\n")
+		for _, count := range counts {
+			buf.WriteString(counter.name + `_total{config="` + count.Config + `"} ` + strconv.FormatUint(counter.value(count), 10) + "\n")
+		}
+	}
+}
+
+// routeLatency stores the *routeLatencyMetrics of the routes compiled at
+// startup. Until they're set, no latencies are recorded.
+var routeLatency atomic.Value
+
+func setRouteLatencyMetrics(m *routeLatencyMetrics) {
+	routeLatency.Store(m)
+}
+
+func getRouteLatencyMetrics() *routeLatencyMetrics {
+	m, _ := routeLatency.Load().(*routeLatencyMetrics)
+	return m
+}
+
+// routeLatencyMiddleware records the time taken by next to handle each request
+// in the latency histogram of the route whose ID is in the request context,
+// served for the request method and the given API version.
+func routeLatencyMiddleware(version api.Version, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := getRouteLatencyMetrics()
+		if m == nil {
+			next(w, r)
+			return
+		}
+		start := time.Now()
+		next(w, r)
+		routeID, ok := r.Context().Value(middleware.RouteID).(int)
+		if !ok {
+			return
+		}
+		m.observe(routeLatencyKey{method: r.Method, version: version, id: routeID}, time.Since(start))
+	}
+}
+
+// RouteMetricsHandler returns a handler which serves the per-route request
+// latency histograms, in the OpenMetrics text format if the client accepts it,
+// and otherwise the Prometheus text format.
+func RouteMetricsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		buf := bytes.Buffer{}
+		if m := getRouteLatencyMetrics(); m != nil {
+			m.write(&buf)
+		}
+		writeNotModifiedMetrics(&buf, openMetrics)
+		if openMetrics {
+			buf.WriteString("# EOF\n")
+		}
+		if openMetrics {
+			w.Header().Set(rfc.ContentType, openMetricsContentType)
+		} else {
+			w.Header().Set(rfc.ContentType, prometheusContentType)
+		}
+		api.WriteAndLogErr(w, r, buf.Bytes())
+	}
+}
@@ -0,0 +1,141 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/plugin"
+)
+
+func TestHandlerRouteLatencyMetrics(t *testing.T) {
+	defer setRouteLatencyMetrics(nil)
+
+	handler := func(delay time.Duration) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+	routes := map[string][]CompiledRoute{
+		http.MethodGet: {
+			{Handler: handler(0), Regex: regexp.MustCompile(`^api/4.1/servers/?$`), ID: 1, Version: api.Version{Major: 4, Minor: 1}},
+			{Handler: handler(0), Regex: regexp.MustCompile(`^api/4.0/servers/?$`), ID: 1, Version: api.Version{Major: 4, Minor: 0}},
+			{Handler: handler(30 * time.Millisecond), Regex: regexp.MustCompile(`^api/4.0/slow/?$`), ID: 2, Version: api.Version{Major: 4, Minor: 0}},
+		},
+		http.MethodPost: {
+			{Handler: handler(0), Regex: regexp.MustCompile(`^api/4.0/servers/?$`), ID: 3, Version: api.Version{Major: 4, Minor: 0}},
+		},
+	}
+	catchall := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	cfg := config.Config{Secrets: []string{"n0SeCr3t$"}}
+	cfg.RouteMetrics.LatencyBucketsMS = []float64{10, 1000}
+	versions := map[api.Version]struct{}{{Major: 4, Minor: 0}: {}, {Major: 4, Minor: 1}: {}}
+	setRouteLatencyMetrics(newRouteLatencyMetrics(routes, cfg.RouteMetrics.LatencyBuckets()))
+
+	handle := func(method, path string) {
+		Handler(routes, versions, catchall, nil, &cfg, func() uint64 { return 0 }, plugin.Get(cfg), nil, httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+	}
+	handle(http.MethodGet, "/api/4.0/servers")
+	handle(http.MethodGet, "/api/4.0/servers")
+	handle(http.MethodGet, "/api/4.1/servers")
+	handle(http.MethodGet, "/api/4.0/slow")
+	handle(http.MethodGet, "/api/4.0/unknown")
+
+	w := httptest.NewRecorder()
+	RouteMetricsHandler()(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	metrics := w.Body.String()
+	if contentType := w.Header().Get(rfc.ContentType); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("expected the Prometheus text format by default, actual content type: %s", contentType)
+	}
+	for _, expected := range []string{
+		"# TYPE " + RouteLatencyMetricName + " histogram\n",
+		RouteLatencyMetricName + `_bucket{method="GET",version="4.0",route="1",le="0.01"} 2` + "\n",
+		RouteLatencyMetricName + `_count{method="GET",version="4.0",route="1"} 2` + "\n",
+		RouteLatencyMetricName + `_count{method="GET",version="4.1",route="1"} 1` + "\n",
+		RouteLatencyMetricName + `_bucket{method="GET",version="4.0",route="2",le="0.01"} 0` + "\n",
+		RouteLatencyMetricName + `_bucket{method="GET",version="4.0",route="2",le="1"} 1` + "\n",
+		RouteLatencyMetricName + `_bucket{method="GET",version="4.0",route="2",le="+Inf"} 1` + "\n",
+		RouteLatencyMetricName + `_count{method="POST",version="4.0",route="3"} 0` + "\n",
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Errorf("expected metrics to contain '%s', actual:\n%s", strings.TrimSpace(expected), metrics)
+		}
+	}
+	if strings.Contains(metrics, "# EOF") {
+		t.Error("expected no OpenMetrics EOF marker in the Prometheus text format")
+	}
+	if lines := strings.Count(metrics, "\n"); lines != 2+4*5 {
+		t.Errorf("expected only the histograms of the compiled routes, actual %d lines:\n%s", lines, metrics)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	RouteMetricsHandler()(w, r)
+	if contentType := w.Header().Get(rfc.ContentType); !strings.HasPrefix(contentType, "application/openmetrics-text") {
+		t.Errorf("expected the OpenMetrics text format when accepted, actual content type: %s", contentType)
+	}
+	if !strings.HasSuffix(w.Body.String(), "\n# EOF\n") {
+		t.Errorf("expected the OpenMetrics text format to end with an EOF marker, actual:\n%s", w.Body.String())
+	}
+}
+
+func TestRouteMetricsHandlerNotModified(t *testing.T) {
+	etag := api.ContentETag([]byte("snapshot"))
+	r := httptest.NewRequest(http.MethodGet, "/api/4.0/cdns/ciab/snapshot", nil)
+	r.Header.Set(rfc.IfNoneMatch, etag)
+	if !api.WriteNotModified(httptest.NewRecorder(), r, etag, "metrics-test", 42) {
+		t.Fatal("expected a 304 response for a matching ETag")
+	}
+
+	w := httptest.NewRecorder()
+	RouteMetricsHandler()(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, expected := range []string{
+		"# TYPE " + ConfigNotModifiedMetricName + "_responses_total counter\n",
+		ConfigNotModifiedMetricName + `_responses_total{config="metrics-test"} 1` + "\n",
+		ConfigNotModifiedMetricName + `_bytes_total{config="metrics-test"} 42` + "\n",
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expected metrics to contain '%s', actual:\n%s", strings.TrimSpace(expected), w.Body.String())
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	RouteMetricsHandler()(w, r)
+	if !strings.Contains(w.Body.String(), "# TYPE "+ConfigNotModifiedMetricName+"_responses counter\n") {
+		t.Errorf("expected the OpenMetrics counter family to be named without _total, actual:\n%s", w.Body.String())
+	}
+	if !strings.HasSuffix(w.Body.String(), "\n# EOF\n") {
+		t.Errorf("expected the OpenMetrics text format to end with an EOF marker, actual:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,128 @@
+package routing
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// CompiledRoutesReport summarizes the API routes compiled at startup, as
+// logged at startup and returned by the routes admin endpoint.
+type CompiledRoutesReport struct {
+	// Methods is the number of compiled routes of each HTTP method.
+	Methods map[string]int `json:"methods"`
+	// Total is the number of compiled routes of all methods, one for each
+	// version a route is served on.
+	Total int `json:"total"`
+	// RegexCount is the number of compiled regular expressions.
+	RegexCount int `json:"regexCount"`
+	// UniquePatterns is the number of distinct regular expressions, routes
+	// of different methods often share a path.
+	UniquePatterns int `json:"uniquePatterns"`
+	// ApproximateBytes is the memory allocated while compiling the routes.
+	// Other goroutines allocating at startup may inflate it.
+	ApproximateBytes uint64 `json:"approximateBytes"`
+	// CompileTime is how long compiling the routes took.
+	CompileTime string `json:"compileTime"`
+}
+
+func (r CompiledRoutesReport) String() string {
+	methods := make([]string, 0, len(r.Methods))
+	for method, count := range r.Methods {
+		methods = append(methods, method+"="+strconv.Itoa(count))
+	}
+	sort.Strings(methods)
+	return "compiled " + strconv.Itoa(r.Total) + " routes (" + strings.Join(methods, " ") + ") with " +
+		strconv.Itoa(r.RegexCount) + " regexes (" + strconv.Itoa(r.UniquePatterns) + " unique) in " + r.CompileTime +
+		", allocating approximately " + strconv.FormatUint(r.ApproximateBytes, 10) + " bytes"
+}
+
+type compiledRoutesReportSynced struct {
+	report CompiledRoutesReport
+	*sync.RWMutex
+}
+
+// compiledRoutesReport stores the report of the routes compiled at startup.
+var compiledRoutesReport = compiledRoutesReportSynced{RWMutex: &sync.RWMutex{}}
+
+// GetCompiledRoutesReport returns the report of the routes compiled at startup.
+func GetCompiledRoutesReport() CompiledRoutesReport {
+	compiledRoutesReport.RLock()
+	defer compiledRoutesReport.RUnlock()
+	return compiledRoutesReport.report
+}
+
+func setCompiledRoutesReport(report CompiledRoutesReport) {
+	compiledRoutesReport.Lock()
+	defer compiledRoutesReport.Unlock()
+	compiledRoutesReport.report = report
+}
+
+// compileRoutesWithReport compiles the given routes with CompileRoutes, and
+// reports the compiled routes along with the time and memory compiling took.
+func compileRoutesWithReport(routes map[string][]PathHandler) (map[string][]CompiledRoute, CompiledRoutesReport) {
+	before := runtime.MemStats{}
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	compiledRoutes := CompileRoutes(routes)
+
+	compileTime := time.Since(start)
+	after := runtime.MemStats{}
+	runtime.ReadMemStats(&after)
+
+	report := newCompiledRoutesReport(compiledRoutes)
+	report.ApproximateBytes = after.TotalAlloc - before.TotalAlloc
+	report.CompileTime = compileTime.String()
+	return compiledRoutes, report
+}
+
+// newCompiledRoutesReport counts the given compiled routes and their regexes.
+func newCompiledRoutesReport(compiledRoutes map[string][]CompiledRoute) CompiledRoutesReport {
+	report := CompiledRoutesReport{Methods: make(map[string]int, len(compiledRoutes))}
+	patterns := map[string]struct{}{}
+	for method, routes := range compiledRoutes {
+		report.Methods[method] = len(routes)
+		report.Total += len(routes)
+		for _, route := range routes {
+			if route.Regex == nil {
+				continue
+			}
+			report.RegexCount++
+			patterns[route.Regex.String()] = struct{}{}
+		}
+	}
+	report.UniquePatterns = len(patterns)
+	return report
+}
+
+// GetRoutes is the handler for GET requests to the routes endpoint, which
+// reports the API routes compiled at startup.
+func GetRoutes(w http.ResponseWriter, r *http.Request) {
+	api.WriteResp(w, r, GetCompiledRoutesReport())
+}
@@ -27,6 +27,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/lib/go-tc"
@@ -70,6 +71,7 @@ import (
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/ping"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/plugins"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/profile"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/profiler"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/profileparameter"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/region"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/role"
@@ -353,6 +355,19 @@ func Routes(d ServerData) ([]Route, http.Handler, error) {
 
 		//System
 		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `system/info/?$`, Handler: systeminfo.Get, RequiredPrivLevel: auth.PrivLevelReadOnly, RequiredPermissions: nil, Authenticated: Authenticated, Middlewares: nil, ID: 4210474753},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `system/backend_routes/?$`, Handler: GetBackendRoutes, RequiredPrivLevel: auth.PrivLevelAdmin, RequiredPermissions: []string{"BACKEND-ROUTE:READ"}, Authenticated: Authenticated, Middlewares: nil, ID: 4210474754},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `system/routes/?$`, Handler: GetRoutes, RequiredPrivLevel: auth.PrivLevelAdmin, RequiredPermissions: []string{"API-ROUTE:READ"}, Authenticated: Authenticated, Middlewares: nil, ID: 4210474755},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `system/profile/?$`, Handler: profiler.Handler, RequiredPrivLevel: auth.PrivLevelAdmin, RequiredPermissions: []string{"PROFILING:CREATE"}, Authenticated: Authenticated, Middlewares: nil, ID: 4210474756, RequestTimeout: (profiler.MaxSeconds + 60) * time.Second},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `system/profile/continuous/?$`, Handler: profiler.ContinuousHandler, RequiredPrivLevel: auth.PrivLevelAdmin, RequiredPermissions: []string{"PROFILING:READ"}, Authenticated: Authenticated, Middlewares: nil, ID: 4210474757},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodPut, Path: `system/profile/continuous/?$`, Handler: profiler.PutContinuousHandler, RequiredPrivLevel: auth.PrivLevelAdmin, RequiredPermissions: []string{"PROFILING:UPDATE", "PROFILING:READ"}, Authenticated: Authenticated, Middlewares: nil, ID: 4210474758},
+
+		//Maintenance mode
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `maintenance/?$`, Handler: GetMaintenance, RequiredPrivLevel: auth.PrivLevelAdmin, RequiredPermissions: []string{"MAINTENANCE:READ"}, Authenticated: Authenticated, Middlewares: nil, ID: 4623188301},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodPut, Path: `maintenance/?$`, Handler: PutMaintenance, RequiredPrivLevel: auth.PrivLevelAdmin, RequiredPermissions: []string{"MAINTENANCE:UPDATE", "MAINTENANCE:READ"}, Authenticated: Authenticated, Middlewares: nil, ID: 4623188302},
+
+		//Read-only mode
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `read_only/?$`, Handler: GetReadOnly, RequiredPrivLevel: auth.PrivLevelAdmin, RequiredPermissions: []string{"READ_ONLY:READ"}, Authenticated: Authenticated, Middlewares: nil, ID: 4623188311},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodPut, Path: `read_only/?$`, Handler: PutReadOnly, RequiredPrivLevel: auth.PrivLevelAdmin, RequiredPermissions: []string{"READ_ONLY:UPDATE", "READ_ONLY:READ"}, Authenticated: Authenticated, Middlewares: nil, ID: 4623188312},
 
 		//Type: CRUD
 		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `types/?$`, Handler: api.ReadHandler(&types.TOType{}), RequiredPrivLevel: auth.PrivLevelReadOnly, RequiredPermissions: []string{"TYPE:READ"}, Authenticated: Authenticated, Middlewares: nil, ID: 42267018233},
@@ -936,6 +951,14 @@ func Routes(d ServerData) ([]Route, http.Handler, error) {
 		}
 	}
 
+	// パスパラメータは名前をキーとしたマップに格納されるため、名前の重複や空の名前、多すぎるパラメータを起動時に検出する
+	maxRouteParams := d.RouteParamsLimit()
+	for _, r := range routes {
+		if err := validateRouteParams(r, maxRouteParams); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// check for unknown route IDs in cdn.conf
 	disabledRoutes := GetRouteIDMap(d.DisabledRoutes)  // disabled_routes設定が格納される。
 	unknownRouteIDs := []string{}
@@ -948,6 +971,17 @@ func Routes(d ServerData) ([]Route, http.Handler, error) {
 		}
 	}
 
+	// client_cert_auth.route_idsに存在しないIDが含まれている場合は、証明書で認証できるはずのルートがないのでエラーとする
+	unknownClientCertRouteIDs := []string{}
+	for _, routeID := range d.ClientCertAuth.RouteIDs {
+		if _, known := knownRouteIDs[routeID]; !known {
+			unknownClientCertRouteIDs = append(unknownClientCertRouteIDs, fmt.Sprintf("%d", routeID))
+		}
+	}
+	if len(unknownClientCertRouteIDs) > 0 {
+		return nil, nil, errors.New("unknown route IDs in client_cert_auth.route_ids: " + strings.Join(unknownClientCertRouteIDs, ", "))
+	}
+
 	// disabled_routesに存在する場合にはメッセージを表示しておく
 	if len(unknownRouteIDs) > 0 {
 		msg := "unknown route IDs in routing_blacklist: " + strings.Join(unknownRouteIDs, ", ")
@@ -992,6 +1026,20 @@ func DBStatsHandler(db *sqlx.DB) http.HandlerFunc {
 	}
 }
 
+// UsersCacheStatsHandler returns a handler which reports the state of the
+// users cache and its refresh circuit breaker.
+func UsersCacheStatsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bytes, err := json.Marshal(auth.GetUsersCacheStatus())
+		if err != nil {
+			api.HandleErr(w, r, nil, http.StatusInternalServerError, nil, fmt.Errorf("unable to marshal stats: %w", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		api.WriteAndLogErr(w, r, bytes)
+	}
+}
+
 type root struct {
 	Handler http.Handler
 }
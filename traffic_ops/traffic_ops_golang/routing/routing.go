@@ -23,12 +23,9 @@ package routing
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"regexp"
 	"sort"
 	"strconv"
@@ -53,9 +50,44 @@ const RoutePrefix = "^api" // TODO config?
 
 type backendConfigSynced struct {
 	cfg config.BackendConfig
+	// indexes are the round-robin indexes of cfg's routes, keyed by route ID.
+	indexes map[int]*backendRouteIndex
 	*sync.RWMutex
 }
 
+// backendRouteIndex is the round-robin index of a single backend route. The
+// index itself is only ever accessed atomically, so it may be advanced while
+// backendCfg is only read locked.
+type backendRouteIndex struct {
+	index uint64
+	// hosts are the hosts the index was counting over, so it is only reset
+	// when a config reload changes them.
+	hosts []config.Host
+}
+
+// next returns the index of the next host to send a request to, and advances
+// it.
+func (i *backendRouteIndex) next() uint64 {
+	return atomic.AddUint64(&i.index, 1) - 1
+}
+
+// current returns the index of the next host to send a request to.
+func (i *backendRouteIndex) current() uint64 {
+	return atomic.LoadUint64(&i.index)
+}
+
+func sameHosts(a, b []config.Host) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // backendCfg stores the current backend config supplied to traffic ops.
 var backendCfg = backendConfigSynced{RWMutex: &sync.RWMutex{}}
 
@@ -66,11 +98,106 @@ func GetBackendConfig() config.BackendConfig {
 	return backendCfg.cfg
 }
 
-// SetBackendConfig sets the BackendConfig to the value supplied.
+// SetBackendConfig sets the BackendConfig to the value supplied, compiling the
+// paths of any of its routes which were not already compiled. Routes whose
+// paths fail to compile are logged, and never match a request.
 func SetBackendConfig(backendConfig config.BackendConfig) {
+	routes := make([]config.BackendRoute, len(backendConfig.Routes))
+	copy(routes, backendConfig.Routes)
+	for i := range routes {
+		if routes[i].Regex != nil {
+			continue
+		}
+		if err := routes[i].Compile(); err != nil {
+			log.Errorf("backend route %d will not be served: %v", routes[i].ID, err)
+		}
+	}
+	backendConfig.Routes = routes
+
 	backendCfg.Lock()
 	defer backendCfg.Unlock()
 	backendCfg.cfg = backendConfig
+
+	// Routes keep their round-robin index across reloads, unless their hosts
+	// changed, in which case they start over from their configured Index.
+	indexes := make(map[int]*backendRouteIndex, len(routes))
+	for _, route := range routes {
+		if index, ok := backendCfg.indexes[route.ID]; ok && sameHosts(index.hosts, route.Hosts) {
+			indexes[route.ID] = index
+			continue
+		}
+		indexes[route.ID] = &backendRouteIndex{index: uint64(route.Index), hosts: route.Hosts}
+	}
+	backendCfg.indexes = indexes
+}
+
+// nextBackendHost returns the host the next request to the given backend
+// route should be sent to, by round-robin. It returns false if the route has
+// no hosts.
+func nextBackendHost(route config.BackendRoute) (config.Host, bool) {
+	if len(route.Hosts) == 0 {
+		return config.Host{}, false
+	}
+	backendCfg.RLock()
+	index, ok := backendCfg.indexes[route.ID]
+	backendCfg.RUnlock()
+	if !ok || !sameHosts(index.hosts, route.Hosts) {
+		// the config was reloaded since the route was read; its index is
+		// gone, or counts over other hosts.
+		return route.Hosts[route.Index%len(route.Hosts)], true
+	}
+	return route.Hosts[index.next()%uint64(len(route.Hosts))], true
+}
+
+// BackendRouteInfo is the runtime state of a single backend route, as
+// returned by the backend routes admin endpoint.
+type BackendRouteInfo struct {
+	ID        int           `json:"routeId"`
+	Path      string        `json:"path"`
+	Method    string        `json:"method"`
+	Algorithm string        `json:"algorithm"`
+	Hosts     []config.Host `json:"hosts"`
+	Index     int           `json:"index"`
+	NextHost  *config.Host  `json:"nextHost"`
+}
+
+// getBackendRouteInfos returns the runtime state of every configured backend
+// route, read under the backend config lock.
+func getBackendRouteInfos() []BackendRouteInfo {
+	backendCfg.RLock()
+	defer backendCfg.RUnlock()
+
+	infos := make([]BackendRouteInfo, 0, len(backendCfg.cfg.Routes))
+	for _, route := range backendCfg.cfg.Routes {
+		index := uint64(route.Index)
+		if routeIndex, ok := backendCfg.indexes[route.ID]; ok {
+			index = routeIndex.current()
+		}
+		info := BackendRouteInfo{
+			ID:        route.ID,
+			Path:      route.Path,
+			Method:    route.Method,
+			Algorithm: route.Opts.Algorithm,
+			Hosts:     append([]config.Host{}, route.Hosts...),
+			Index:     int(index),
+		}
+		if info.Algorithm == "" {
+			info.Algorithm = "roundrobin"
+		}
+		if len(route.Hosts) > 0 {
+			host := route.Hosts[index%uint64(len(route.Hosts))]
+			info.NextHost = &host
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// GetBackendRoutes is the handler for GET requests to the backend routes
+// endpoint, which reports the routes of the current backend config along with
+// their round-robin state.
+func GetBackendRoutes(w http.ResponseWriter, r *http.Request) {
+	api.WriteResp(w, r, getBackendRouteInfos())
 }
 
 // A Route defines an association with a client request and a handler for that
@@ -85,7 +212,9 @@ type Route struct {
 	RequiredPermissions []string
 	Authenticated       bool
 	Middlewares         []middleware.Middleware
-	ID                  int // unique ID for referencing this Route
+	ID                  int                   // unique ID for referencing this Route
+	RequestTimeout      time.Duration         // overrides the configured request timeout for this Route, if non-zero
+	RateLimit           *middleware.RateLimit // limits the rate of requests to this Route across all its versions, if non-nil
 }
 
 func (r Route) String() string {
@@ -103,11 +232,20 @@ func (r *Route) SetMiddleware(authBase middleware.AuthBase, requestTimeout time.
 	// 認証済み
 	if r.Authenticated { // a privLevel of zero is an unauthenticated endpoint.
 		authWrapper := authBase.GetWrapper(r.RequiredPrivLevel)
+		// client_cert_auth.route_idsに含まれる場合には、クライアント証明書による認証も許可する
+		if _, ok := authBase.ClientCertRouteIDs[r.ID]; ok {
+			authWrapper = authBase.GetClientCertWrapper(r.RequiredPrivLevel)
+		}
 		r.Middlewares = append(r.Middlewares, authWrapper)
 	}
 
 	// 認証が必要な場合
 	r.Middlewares = append(r.Middlewares, middleware.RequiredPermissionsMiddleware(r.RequiredPermissions))
+
+	// レート制限が設定されている場合。ユーザー毎に制限できるように認証の後に適用する
+	if r.RateLimit != nil {
+		r.Middlewares = append(r.Middlewares, middleware.RateLimitMiddleware(*r.RateLimit))
+	}
 }
 
 // ServerData ...
@@ -126,6 +264,7 @@ type CompiledRoute struct {
 	Regex   *regexp.Regexp
 	Params  []string
 	ID      int
+	Version api.Version
 }
 
 // エンドポイント一覧からAPIのメジャーバージョンとマイナーバージョンを調布君子で取得して、
@@ -211,18 +350,35 @@ func indexOfApiVersion(versions []api.Version, desiredVersion api.Version) int {
 	return len(versions) - 1
 }
 
+// getRouteRequestTimeout returns the request timeout to use for the given Route: the Route's own RequestTimeout if set,
+// otherwise the timeout configured for the Route's method, otherwise the given default.
+func getRouteRequestTimeout(r Route, defaultTimeout time.Duration, methodTimeOutSeconds map[string]int) time.Duration {
+	if r.RequestTimeout > 0 {
+		return r.RequestTimeout
+	}
+	for method, seconds := range methodTimeOutSeconds {
+		if seconds > 0 && strings.EqualFold(method, r.Method) {
+			return time.Second * time.Duration(seconds)
+		}
+	}
+	return defaultTimeout
+}
+
 // PathHandler ...
 type PathHandler struct {
 	Path    string
 	Handler http.HandlerFunc
 	ID      int
+	Version api.Version
 }
 
 // CreateRouteMap returns a map of methods to a slice of paths and handlers; wrapping the handlers in the appropriate middleware. Uses Semantic Versioning: routes are added to every subsequent minor version, but not subsequent major versions. For example, a 1.2 route is added to 1.3 but not 2.1. Also truncates '2.0' to '2', creating succinct major versions.
 // Returns the map of routes, and a map of API versions served.
 //
+// Each route's request timeout is methodReqTimeOutSeconds for its method if present, else reqTimeOutSeconds, unless the route sets its own RequestTimeout.
+//
 // 第３引数のperlHandlerは特に使われてなさそう
-func CreateRouteMap(rs []Route, disabledRouteIDs []int, perlHandler http.HandlerFunc, authBase middleware.AuthBase, reqTimeOutSeconds int) (map[string][]PathHandler, map[api.Version]struct{}) {
+func CreateRouteMap(rs []Route, disabledRouteIDs []int, perlHandler http.HandlerFunc, authBase middleware.AuthBase, reqTimeOutSeconds int, methodReqTimeOutSeconds map[string]int) (map[string][]PathHandler, map[api.Version]struct{}) {
 
 	// TODO strong types for method, path
 	versions := getSortedRouteVersions(rs)
@@ -242,7 +398,7 @@ func CreateRouteMap(rs []Route, disabledRouteIDs []int, perlHandler http.Handler
 		versionI := indexOfApiVersion(versions, r.Version)
 		nextMajorVer := r.Version.Major + 1
 		_, isDisabledRoute := disabledRoutes[r.ID]
-		r.SetMiddleware(authBase, requestTimeout)
+		r.SetMiddleware(authBase, getRouteRequestTimeout(r, requestTimeout, methodReqTimeOutSeconds))
 
 		// バージョン毎のrange
 		for _, version := range versions[versionI:] {
@@ -258,9 +414,9 @@ func CreateRouteMap(rs []Route, disabledRouteIDs []int, perlHandler http.Handler
 
 			if isDisabledRoute {
 				// disabled_routesされている場合には、DisabledRouteHandler()というリクエストを禁止するメッセージのエンドポイントを設定する
-				m[r.Method] = append(m[r.Method], PathHandler{Path: path, Handler: middleware.WrapAccessLog(authBase.Secret, middleware.DisabledRouteHandler()), ID: r.ID})
+				m[r.Method] = append(m[r.Method], PathHandler{Path: path, Handler: middleware.WrapAccessLog(authBase.Secret, middleware.DisabledRouteHandler()), ID: r.ID, Version: version})
 			} else {
-				m[r.Method] = append(m[r.Method], PathHandler{Path: path, Handler: middleware.Use(r.Handler, r.Middlewares), ID: r.ID})
+				m[r.Method] = append(m[r.Method], PathHandler{Path: path, Handler: middleware.Use(r.Handler, r.Middlewares), ID: r.ID, Version: version})
 			}
 			log.Infof("adding route %v %v\n", r.Method, path)
 		}
@@ -277,49 +433,103 @@ func CreateRouteMap(rs []Route, disabledRouteIDs []int, perlHandler http.Handler
 
 // CompileRoutes - takes a map of methods to paths and handlers, and returns a map of methods to CompiledRoutes
 // この関数は、与えられたルート情報(例: 「OC/CI/configuration/request/{id}/{approved}」)を正規表現を使ってコンパイルされたルートに変換するために必要な事前準備としてのオブジェクトを生成しています。
+// The routes of each method are compiled in parallel, to reduce startup time with large route tables.
 func CompileRoutes(routes map[string][]PathHandler) map[string][]CompiledRoute {
 
-	compiledRoutes := map[string][]CompiledRoute{}
+	compiledRoutes := make(map[string][]CompiledRoute, len(routes))
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
 
-	// APIエンドポイント毎にループ処理を行う
+	// APIエンドポイントのメソッド毎に並列でコンパイルする
 	// routesはindexにメソッド名(GET等)、keyにpathHandler構造体が含まれる
 	for method, mRoutes := range routes {
-		for _, pathHandler := range mRoutes {
+		wg.Add(1)
+		go func(method string, mRoutes []PathHandler) {
+			defer wg.Done()
+			compiled := compileMethodRoutes(mRoutes)
+			mutex.Lock()
+			compiledRoutes[method] = compiled
+			mutex.Unlock()
+		}(method, mRoutes)
+	}
+	wg.Wait()
+
+	return compiledRoutes
+}
 
-			// 「OC/CI/configuration/request/{id}/{approved}」のようなパス情報が含まれます。
-			route := pathHandler.Path
-			handler := pathHandler.Handler
-			var params []string
+// routeParamNameRegex matches the valid names of route path parameters.
+var routeParamNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// validateRouteParams returns an error naming the route if its path has more
+// than maxParams path parameters, or a parameter whose name is empty, not a
+// valid identifier, or the same as another's, since the parameters are
+// extracted into a map by name.
+func validateRouteParams(r Route, maxParams int) error {
+	names := map[string]struct{}{}
+	path := r.Path
+	for open := strings.Index(path, "{"); open >= 0; open = strings.Index(path, "{") {
+		close := strings.Index(path[open:], "}")
+		if close < 0 {
+			return fmt.Errorf("route ID %d (%s %s): unclosed path parameter", r.ID, r.Method, r.Path)
+		}
+		name := path[open+1 : open+close]
+		if name == "" {
+			return fmt.Errorf("route ID %d (%s %s): empty path parameter name", r.ID, r.Method, r.Path)
+		}
+		if !routeParamNameRegex.MatchString(name) {
+			return fmt.Errorf("route ID %d (%s %s): invalid path parameter name '%s'", r.ID, r.Method, r.Path, name)
+		}
+		if _, ok := names[name]; ok {
+			return fmt.Errorf("route ID %d (%s %s): duplicate path parameter '%s'", r.ID, r.Method, r.Path, name)
+		}
+		names[name] = struct{}{}
+		path = path[open+close+1:]
+	}
+	if len(names) > maxParams {
+		return fmt.Errorf("route ID %d (%s %s): %d path parameters, more than the maximum of %d", r.ID, r.Method, r.Path, len(names), maxParams)
+	}
+	return nil
+}
 
-			// "{"が見つかった１のindexから順番に処理をしていく
-			// 「OC/CI/configuration/request/{id}/{approved}」のようなAPIエンドポイントを表すstringsに対して処理をしていくことになります。
-			for open := strings.Index(route, "{"); open > 0; open = strings.Index(route, "{") {
+// compileMethodRoutes compiles the paths and handlers of a single method, in order.
+func compileMethodRoutes(mRoutes []PathHandler) []CompiledRoute {
 
-				// 閉じかっこ"}"が見つかったらcloseとする
-				close := strings.Index(route, "}")
+	compiledRoutes := make([]CompiledRoute, 0, len(mRoutes))
+	for _, pathHandler := range mRoutes {
 
-				// "}"が存在しなかったらcloseには-1が入ります。APIエンドポイントのrouteには必ず"{"が含まれる場合には"}"も対として含まれますが、このケースでは"}"がないので不正なルート設定としています。
-				if close < 0 {
-					panic("malformed route")
-				}
+		// 「OC/CI/configuration/request/{id}/{approved}」のようなパス情報が含まれます。
+		route := pathHandler.Path
+		handler := pathHandler.Handler
+		var params []string
 
-				// "{"から"}"までを取得してparamに格納する。この時"{"と"}"は含まれない範囲指定となっている。
-				param := route[open+1 : close]
+		// "{"が見つかった１のindexから順番に処理をしていく
+		// 「OC/CI/configuration/request/{id}/{approved}」のようなAPIエンドポイントを表すstringsに対して処理をしていくことになります。
+		for open := strings.Index(route, "{"); open > 0; open = strings.Index(route, "{") {
 
-				// "{"から"}"が複数あれば、
-				params = append(params, param)
+			// 閉じかっこ"}"が見つかったらcloseとする
+			close := strings.Index(route, "}")
 
-				// "{"から"}"で指定された箇所が後で置換できるように正規表現にしておきます。
-				route = route[:open] + `([^/]+)` + route[close+1:]
+			// "}"が存在しなかったらcloseには-1が入ります。APIエンドポイントのrouteには必ず"{"が含まれる場合には"}"も対として含まれますが、このケースでは"}"がないので不正なルート設定としています。
+			if close < 0 {
+				panic("malformed route")
 			}
 
-			// Routeの正規表現を有効にする (手前のロジックで必ず"([^/]+)"を付与しているので正規表現となる。
-			regex := regexp.MustCompile(route)
-			id := pathHandler.ID
+			// "{"から"}"までを取得してparamに格納する。この時"{"と"}"は含まれない範囲指定となっている。
+			param := route[open+1 : close]
+
+			// "{"から"}"が複数あれば、
+			params = append(params, param)
 
-			// compiledRoutesスライスに詰めます
-			compiledRoutes[method] = append(compiledRoutes[method], CompiledRoute{Handler: handler, Regex: regex, Params: params, ID: id})
+			// "{"から"}"で指定された箇所が後で置換できるように正規表現にしておきます。
+			route = route[:open] + `([^/]+)` + route[close+1:]
 		}
+
+		// Routeの正規表現を有効にする (手前のロジックで必ず"([^/]+)"を付与しているので正規表現となる。
+		regex := regexp.MustCompile(route)
+		id := pathHandler.ID
+
+		// compiledRoutesスライスに詰めます
+		compiledRoutes = append(compiledRoutes, CompiledRoute{Handler: handler, Regex: regex, Params: params, ID: id, Version: pathHandler.Version})
 	}
 
 	return compiledRoutes
@@ -342,12 +552,17 @@ func Handler(
 
 	reqID := getReqID()
 
-	reqIDStr := strconv.FormatUint(reqID, 10)
-	log.Infoln(r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + " handling (reqid " + reqIDStr + ")")
-	start := time.Now()
-	defer func() {
-		log.Infoln(r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + " handled (reqid " + reqIDStr + ") in " + time.Since(start).String())
-	}()
+	// request_log_samplingが設定されていれば、N件に1件のリクエストだけhandling/handledのログを出力する。エラーや遅いリクエストは常に出力する
+	reqLog, w := startRequestLog(w, r, reqID, cfg.RequestLogSampling)
+	defer reqLog.finish()
+
+	// 同時に処理中のリクエスト数が上限に達している場合には、DBのコネクションを使い切る前に503を返す
+	if !acquireInFlight(cfg.RequestLimit.MaxInFlight) {
+		h := middleware.WrapAccessLog(cfg.Secrets[0], middleware.OverloadedHandler(cfg.RequestLimit.RetryAfter()))
+		h.ServeHTTP(w, r)
+		return
+	}
+	defer releaseInFlight()
 
 	ctx := r.Context()
 	ctx = context.WithValue(ctx, api.DBContextKey, db)           // "db"
@@ -364,6 +579,24 @@ func Handler(
 		return
 	}
 
+	if path := NormalizePath(r.URL.Path, cfg.PathNormalization); path != r.URL.Path {
+		r.URL.Path = path
+		r.URL.RawPath = ""
+	}
+
+	if isMaintenanceBlocked(r.URL.Path) {
+		h := middleware.WrapAccessLog(cfg.Secrets[0], middleware.MaintenanceHandler(cfg.Maintenance.RetryAfter()))
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	// 読み取り専用モード中は、GET以外のAPIリクエストに503を返す
+	if isReadOnlyBlocked(r.Method, r.URL.Path) {
+		h := middleware.WrapAccessLog(cfg.Secrets[0], middleware.ReadOnlyHandler(cfg.ReadOnly.RetryAfter()))
+		h.ServeHTTP(w, r)
+		return
+	}
+
 	requested := r.URL.Path[1:]
 	mRoutes, ok := routes[r.Method]
 	if !ok {
@@ -371,13 +604,8 @@ func Handler(
 		return
 	}
 
-	for _, compiledRoute := range mRoutes {
-
-		match := compiledRoute.Regex.FindStringSubmatch(requested)
-		if len(match) == 0 {
-			continue
-		}
-
+	// 起動時に登録されたルートは最初のパスセグメントで索引付けされており、一致し得るルートの正規表現だけを試す
+	if compiledRoute, match := matchRoute(r.Method, mRoutes, requested); compiledRoute != nil {
 		params := map[string]string{}
 		for i, v := range compiledRoute.Params {
 			params[v] = match[i+1]
@@ -386,7 +614,8 @@ func Handler(
 		routeCtx := context.WithValue(ctx, api.PathParamsKey, params)
 		routeCtx = context.WithValue(routeCtx, middleware.RouteID, compiledRoute.ID)
 		r = r.WithContext(routeCtx)
-		compiledRoute.Handler(w, r)
+		// ルート毎のレイテンシをヒストグラムに記録する
+		routeLatencyMiddleware(compiledRoute.Version, compiledRoute.Handler)(w, r)
 		return
 	}
 
@@ -400,50 +629,31 @@ func Handler(
 	var backendRouteHandled bool
 	backendConfig := GetBackendConfig()
 	// 下記のロジックは-backendcfgにより設定が追加された場合の処理 (レポジトリ内部に配置されているサンプルはbackends.confでサンプルとして配置されている)
-	for i, backendRoute := range backendConfig.Routes {
+	for _, backendRoute := range backendConfig.Routes {
 
-		var params []string
 		routeParams := map[string]string{}
-		if backendRoute.Method == r.Method {
-			for open := strings.Index(backendRoute.Path, "{"); open > 0; open = strings.Index(backendRoute.Path, "{") {
-				close := strings.Index(backendRoute.Path, "}")
-				if close < 0 {
-					panic("malformed route")
-				}
-				param := backendRoute.Path[open+1 : close]
-				params = append(params, param)
-				backendRoute.Path = backendRoute.Path[:open] + `([^/]+)` + backendRoute.Path[close+1:]
-			}
-			regex := regexp.MustCompile(backendRoute.Path)
-			match := regex.FindStringSubmatch(r.URL.Path)
+		if backendRoute.Method == r.Method && backendRoute.Regex != nil {
+			// パスの正規表現はSetBackendConfigでコンパイル済み
+			match := backendRoute.Regex.FindStringSubmatch(r.URL.Path)
 			if len(match) == 0 {
 				continue
 			}
-			for i, v := range params {
+			for i, v := range backendRoute.Params {
 				routeParams[v] = match[i+1]
 			}
 
 			// 
 			if backendRoute.Opts.Algorithm == "" || backendRoute.Opts.Algorithm == "roundrobin" {
 
-				index := backendRoute.Index % len(backendRoute.Hosts)
-				host := backendRoute.Hosts[index]
-				backendRoute.Index++
-				backendConfig.Routes[i] = backendRoute
-				backendRouteHandled = true
-				rp := httputil.NewSingleHostReverseProxy(&url.URL{
-					Host:   host.Hostname + ":" + strconv.Itoa(host.Port),
-					Scheme: host.Protocol,
-				})
-
-				rp.Transport = &http.Transport{
-					TLSClientConfig: &tls.Config{InsecureSkipVerify: backendRoute.Insecure},
-				}
-
-				rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-					api.HandleErr(w, r, nil, http.StatusInternalServerError, nil, err)
+				host, ok := nextBackendHost(backendRoute)
+				if !ok {
+					h2 := middleware.WrapAccessLog(cfg.Secrets[0], middleware.BackendErrorHandler(http.StatusBadGateway, nil, fmt.Errorf("backend route %d has no hosts", backendRoute.ID)))
+					h2.ServeHTTP(w, r)
 					return
 				}
+				backendRouteHandled = true
+				// バックエンドのタイムアウト時には504を返す
+				rp := newBackendProxy(backendRoute, host)
 
 				routeCtx := context.WithValue(ctx, api.DBContextKey, db)
 				routeCtx = context.WithValue(routeCtx, api.PathParamsKey, routeParams)
@@ -455,6 +665,9 @@ func Handler(
 					h2.ServeHTTP(w, r)
 					return
 				}
+				// クライアントの切断か、ルートのrequestSecondsの経過でバックエンドへのリクエストは中断される
+				r, cancel := withBackendDeadline(r, backendRoute)
+				defer cancel()
 				backendHandler := middleware.WrapAccessLog(cfg.Secrets[0], rp)
 				backendHandler.ServeHTTP(w, r)
 				return
@@ -471,6 +684,23 @@ func Handler(
 	}
 }
 
+// NormalizePath returns the given request path with the given normalizations
+// applied. The root path "/" is never changed.
+func NormalizePath(path string, normalization config.PathNormalization) string {
+	if normalization.CollapseSlashes {
+		for strings.Contains(path, "//") {
+			path = strings.Replace(path, "//", "/", -1)
+		}
+	}
+	if normalization.TrimTrailingSlash && len(path) > 1 {
+		path = strings.TrimRight(path, "/")
+		if path == "" {
+			path = "/"
+		}
+	}
+	return path
+}
+
 // HandleBackendRoute does all the pre processing for the backend routes.
 func HandleBackendRoute(cfg *config.Config, route config.BackendRoute, w http.ResponseWriter, r *http.Request) (error, error, int) {
 
@@ -582,14 +812,25 @@ func RegisterRoutes(d ServerData) error {
 	}
 
 	authBase := middleware.AuthBase{Secret: d.Config.Secrets[0], Override: nil} //we know d.Config.Secrets is a slice of at least one or start up would fail.
+	if d.Config.ClientCertAuth.Enabled() {
+		authBase.ClientCertSubjects = d.Config.ClientCertAuth.Subjects
+		authBase.ClientCertRouteIDs = GetRouteIDMap(d.Config.ClientCertAuth.RouteIDs)
+	}
 
 	// エンドポイント毎にオブジェクトを作成する
 	// この際にdisableなエンドポイントかやどうかや、認証失敗時のハンドラ、リクエストタイムアウト時の時刻などをそれぞれ設定したオブジェクトを変換する
-	routes, versions := CreateRouteMap(routeSlice, d.DisabledRoutes, handlerToFunc(catchall), authBase, d.RequestTimeout)
+	routes, versions := CreateRouteMap(routeSlice, d.DisabledRoutes, handlerToFunc(catchall), authBase, d.RequestTimeout, d.RequestTimeoutMethods)
 
-	compiledRoutes := CompileRoutes(routes)
+	compiledRoutes, report := compileRoutesWithReport(routes)
+	setCompiledRoutesReport(report)
+	log.Infoln(report.String())
+	setRouteLatencyMetrics(newRouteLatencyMetrics(compiledRoutes, d.Config.RouteMetrics.LatencyBuckets()))
+	setRouteIndexes(compiledRoutes)
 	getReqID := nextReqIDGetter()
 
+	d.Mux.Handle("/healthz", HealthzHandler())
+	d.Mux.Handle("/readyz", ReadyzHandler())
+
 	// HTTPサーバにAPIエンドポイントの登録を行う
 	d.Mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// 同ファイルのHandlerを呼び出す
@@ -27,12 +27,16 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/plugin"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/routing/middleware"
 )
 
@@ -148,7 +152,7 @@ func TestCompileRoutes(t *testing.T) {
 	}
 
 	authBase := middleware.AuthBase{Secret: d.Secrets[0], Override: nil}
-	routes, versions := CreateRouteMap(routeSlice, nil, nil, authBase, 1)
+	routes, versions := CreateRouteMap(routeSlice, nil, nil, authBase, 1, nil)
 	if len(routes) == 0 {
 		t.Error("no routes handler defined")
 	}
@@ -201,6 +205,42 @@ func TestRoutes(t *testing.T) {
 	}
 }
 
+func TestValidateRouteParams(t *testing.T) {
+	valid := []string{`servers/?$`, `servers/{id}$`, `OC/CI/configuration/request/{id}/{approved}$`, `profiles/{id-or-name}/{host_name}$`}
+	for _, path := range valid {
+		if err := validateRouteParams(Route{Method: http.MethodGet, Path: path, ID: 1}, 2); err != nil {
+			t.Errorf("expected no error for %s, actual: %v", path, err)
+		}
+	}
+
+	invalid := map[string]string{
+		`x/{id}/{id}$`:   "duplicate path parameter 'id'",
+		`x/{}/?$`:        "empty path parameter name",
+		`x/{id}/{}$`:     "empty path parameter name",
+		`x/{1id}$`:       "invalid path parameter name '1id'",
+		`x/{id$`:         "unclosed path parameter",
+		`x/{a}/{b}/{c}$`: "3 path parameters, more than the maximum of 2",
+	}
+	for path, expected := range invalid {
+		err := validateRouteParams(Route{Method: http.MethodGet, Path: path, ID: 42}, 2)
+		if err == nil {
+			t.Errorf("expected an error for %s, actual: nil", path)
+			continue
+		}
+		if !strings.Contains(err.Error(), "route ID 42") || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected an error naming route ID 42 with '%s' for %s, actual: %v", expected, path, err)
+		}
+	}
+}
+
+func TestRoutesMaxRouteParams(t *testing.T) {
+	fake := ServerData{Config: config.NewFakeConfig()}
+	fake.MaxRouteParams = 1
+	if _, _, err := Routes(fake); err == nil || !strings.Contains(err.Error(), "more than the maximum of 1") {
+		t.Errorf("expected an error for routes with more than 1 path parameter, actual: %v", err)
+	}
+}
+
 func TestCreateRouteMap(t *testing.T) {
 	authBase := middleware.AuthBase{Secret: "secret", Override: func(handlerFunc http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
@@ -239,16 +279,16 @@ func TestCreateRouteMap(t *testing.T) {
 	}
 
 	routes := []Route{
-		{api.Version{Major: 1, Minor: 2}, http.MethodGet, `path1`, PathOneHandler, auth.PrivLevelReadOnly, nil, true, nil, 0},
-		{api.Version{Major: 1, Minor: 2}, http.MethodGet, `path2`, PathTwoHandler, 0, nil, false, nil, 1},
-		{api.Version{Major: 1, Minor: 2}, http.MethodGet, `path3`, PathThreeHandler, 0, nil, false, []middleware.Middleware{}, 2},
-		{api.Version{Major: 1, Minor: 2}, http.MethodGet, `path4`, PathFourHandler, 0, nil, false, []middleware.Middleware{}, 3},
-		{api.Version{Major: 1, Minor: 2}, http.MethodGet, `path5`, PathFiveHandler, 0, nil, false, []middleware.Middleware{}, 4},
+		{api.Version{Major: 1, Minor: 2}, http.MethodGet, `path1`, PathOneHandler, auth.PrivLevelReadOnly, nil, true, nil, 0, 0, nil},
+		{api.Version{Major: 1, Minor: 2}, http.MethodGet, `path2`, PathTwoHandler, 0, nil, false, nil, 1, 0, nil},
+		{api.Version{Major: 1, Minor: 2}, http.MethodGet, `path3`, PathThreeHandler, 0, nil, false, []middleware.Middleware{}, 2, 0, nil},
+		{api.Version{Major: 1, Minor: 2}, http.MethodGet, `path4`, PathFourHandler, 0, nil, false, []middleware.Middleware{}, 3, 0, nil},
+		{api.Version{Major: 1, Minor: 2}, http.MethodGet, `path5`, PathFiveHandler, 0, nil, false, []middleware.Middleware{}, 4, 0, nil},
 	}
 
 	disabledRoutesIDs := []int{4}
 
-	routeMap, _ := CreateRouteMap(routes, disabledRoutesIDs, CatchallHandler, authBase, 60)
+	routeMap, _ := CreateRouteMap(routes, disabledRoutesIDs, CatchallHandler, authBase, 60, nil)
 
 	route1Handler := routeMap["GET"][0].Handler
 
@@ -329,3 +369,370 @@ func TestRoute_SetMiddlewares(t *testing.T) {
 		t.Errorf("Authenticated routes that start with %d middlewares should wind up with %d after setting up defaults, actual amount: %d", preLen, preLen+2, len(r.Middlewares))
 	}
 }
+
+func TestGetBackendRouteInfos(t *testing.T) {
+	oldCfg := GetBackendConfig()
+	defer SetBackendConfig(oldCfg)
+
+	hosts := []config.Host{
+		{Protocol: "https", Hostname: "one.test", Port: 8443},
+		{Protocol: "https", Hostname: "two.test", Port: 8443},
+	}
+	SetBackendConfig(config.BackendConfig{Routes: []config.BackendRoute{
+		{Path: "^/api/4.0/foo$", Method: http.MethodGet, Hosts: hosts, ID: 1, Index: 3},
+		{Path: "^/api/4.0/bar$", Method: http.MethodPost, Opts: config.Options{Algorithm: "roundrobin"}, ID: 2},
+	}})
+
+	infos := getBackendRouteInfos()
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 backend routes, actual: %d", len(infos))
+	}
+	if infos[0].Algorithm != "roundrobin" {
+		t.Errorf("expected blank algorithm to be reported as roundrobin, actual: %s", infos[0].Algorithm)
+	}
+	if infos[0].Index != 3 {
+		t.Errorf("expected index 3, actual: %d", infos[0].Index)
+	}
+	if infos[0].NextHost == nil || *infos[0].NextHost != hosts[1] {
+		t.Errorf("expected next host %+v, actual: %+v", hosts[1], infos[0].NextHost)
+	}
+	if len(infos[0].Hosts) != len(hosts) {
+		t.Errorf("expected %d hosts, actual: %d", len(hosts), len(infos[0].Hosts))
+	}
+	if infos[1].NextHost != nil {
+		t.Errorf("expected no next host for a route without hosts, actual: %+v", infos[1].NextHost)
+	}
+}
+
+func TestSetBackendConfigCompilesRoutes(t *testing.T) {
+	oldCfg := GetBackendConfig()
+	defer SetBackendConfig(oldCfg)
+
+	SetBackendConfig(config.BackendConfig{Routes: []config.BackendRoute{
+		{Path: "^/api/4.0/foo/{id}$", Method: http.MethodGet, ID: 1},
+		{Path: "^/api/4.0/bar/{id$", Method: http.MethodGet, ID: 2},
+	}})
+
+	routes := GetBackendConfig().Routes
+	if routes[0].Regex == nil {
+		t.Fatal("expected the backend route path to be compiled")
+	}
+	if routes[0].Path != "^/api/4.0/foo/{id}$" {
+		t.Errorf("expected the backend route path to be unchanged, actual: %s", routes[0].Path)
+	}
+	if len(routes[0].Params) != 1 || routes[0].Params[0] != "id" {
+		t.Errorf("expected params [id], actual: %v", routes[0].Params)
+	}
+	if routes[1].Regex != nil {
+		t.Errorf("expected a malformed backend route path not to be compiled, actual: %v", routes[1].Regex)
+	}
+}
+
+func TestBackendRouteRoundRobinConcurrent(t *testing.T) {
+	oldCfg := GetBackendConfig()
+	defer SetBackendConfig(oldCfg)
+
+	hosts := []config.Host{
+		{Protocol: "https", Hostname: "one.test", Port: 8443},
+		{Protocol: "https", Hostname: "two.test", Port: 8443},
+		{Protocol: "https", Hostname: "three.test", Port: 8443},
+	}
+	SetBackendConfig(config.BackendConfig{Routes: []config.BackendRoute{
+		{Path: "^/api/4.0/foo$", Method: http.MethodGet, Hosts: hosts, ID: 1},
+	}})
+
+	cfg := config.Config{Secrets: []string{"n0SeCr3t$"}}
+	versions := map[api.Version]struct{}{{Major: 4, Minor: 0}: {}}
+	catchall := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected the request to be handled by the backend route, not the catchall")
+	})
+
+	const requests = 30
+	counts := map[config.Host]int{}
+	countsM := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// without a login cookie, the request is rejected after the host is chosen.
+			Handler(map[string][]CompiledRoute{http.MethodGet: nil}, versions, catchall, nil, &cfg, func() uint64 { return 0 }, plugin.Get(cfg), nil, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/4.0/foo", nil))
+		}()
+	}
+	wg.Wait()
+	if infos := getBackendRouteInfos(); infos[0].Index != requests {
+		t.Errorf("expected round-robin index %d, actual: %d", requests, infos[0].Index)
+	}
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			host, ok := nextBackendHost(GetBackendConfig().Routes[0])
+			if !ok {
+				t.Errorf("expected a host for a route with hosts")
+				return
+			}
+			countsM.Lock()
+			counts[host]++
+			countsM.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, host := range hosts {
+		if counts[host] != requests/len(hosts) {
+			t.Errorf("expected host %s to be chosen %d times, actual: %d", host.Hostname, requests/len(hosts), counts[host])
+		}
+	}
+}
+
+func TestBackendRouteRoundRobinReload(t *testing.T) {
+	oldCfg := GetBackendConfig()
+	defer SetBackendConfig(oldCfg)
+
+	hosts := []config.Host{
+		{Protocol: "https", Hostname: "one.test", Port: 8443},
+		{Protocol: "https", Hostname: "two.test", Port: 8443},
+	}
+	route := config.BackendRoute{Path: "^/api/4.0/foo$", Method: http.MethodGet, Hosts: hosts, ID: 1}
+	SetBackendConfig(config.BackendConfig{Routes: []config.BackendRoute{route}})
+	nextBackendHost(route)
+
+	SetBackendConfig(config.BackendConfig{Routes: []config.BackendRoute{route}})
+	if host, _ := nextBackendHost(route); host != hosts[1] {
+		t.Errorf("expected the round-robin index to survive a reload with the same hosts, actual host: %+v", host)
+	}
+
+	route.Hosts = append([]config.Host{{Protocol: "https", Hostname: "zero.test", Port: 8443}}, hosts...)
+	SetBackendConfig(config.BackendConfig{Routes: []config.BackendRoute{route}})
+	if host, _ := nextBackendHost(route); host != route.Hosts[0] {
+		t.Errorf("expected the round-robin index to be reset when the hosts change, actual host: %+v", host)
+	}
+
+	if _, ok := nextBackendHost(config.BackendRoute{ID: 2}); ok {
+		t.Error("expected no host for a route without hosts")
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	both := config.PathNormalization{CollapseSlashes: true, TrimTrailingSlash: true}
+	tests := []struct {
+		path          string
+		normalization config.PathNormalization
+		expected      string
+	}{
+		{"/api/4.0//servers", config.PathNormalization{}, "/api/4.0//servers"},
+		{"/api/4.0//servers", config.PathNormalization{CollapseSlashes: true}, "/api/4.0/servers"},
+		{"//api///4.0/servers", config.PathNormalization{CollapseSlashes: true}, "/api/4.0/servers"},
+		{"/api/4.0/servers/", config.PathNormalization{CollapseSlashes: true}, "/api/4.0/servers/"},
+		{"/api/4.0/servers/", config.PathNormalization{TrimTrailingSlash: true}, "/api/4.0/servers"},
+		{"/api/4.0/servers//", both, "/api/4.0/servers"},
+		{"/", both, "/"},
+		{"//", both, "/"},
+	}
+	for _, test := range tests {
+		if actual := NormalizePath(test.path, test.normalization); actual != test.expected {
+			t.Errorf("normalizing '%s' with %+v - expected: '%s', actual: '%s'", test.path, test.normalization, test.expected, actual)
+		}
+	}
+}
+
+func TestHandlerNormalizesPath(t *testing.T) {
+	var params map[string]string
+	var matched bool
+	routes := map[string][]CompiledRoute{
+		http.MethodGet: {{
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				matched = true
+				params = r.Context().Value(api.PathParamsKey).(map[string]string)
+			},
+			Regex:  regexp.MustCompile(`^api/4.0/servers/([^/]+)$`),
+			Params: []string{"id"},
+			ID:     1,
+		}},
+	}
+	catchall := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	cfg := config.Config{Secrets: []string{"n0SeCr3t$"}}
+	cfg.PathNormalization = config.PathNormalization{CollapseSlashes: true, TrimTrailingSlash: true}
+	plugins := plugin.Get(cfg)
+	getReqID := func() uint64 { return 0 }
+
+	for _, path := range []string{"/api/4.0/servers/42", "/api/4.0//servers/42", "//api/4.0/servers//42", "/api/4.0/servers/42/"} {
+		matched = false
+		params = nil
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		Handler(routes, map[api.Version]struct{}{{Major: 4, Minor: 0}: {}}, catchall, nil, &cfg, getReqID, plugins, nil, w, r)
+		if !matched {
+			t.Errorf("expected GET %s to match a route, actual: response code %d", path, w.Code)
+			continue
+		}
+		if params["id"] != "42" {
+			t.Errorf("expected GET %s to have param id '42', actual: '%s'", path, params["id"])
+		}
+	}
+
+	cfg.PathNormalization = config.PathNormalization{}
+	w := httptest.NewRecorder()
+	matched = false
+	Handler(routes, map[api.Version]struct{}{{Major: 4, Minor: 0}: {}}, catchall, nil, &cfg, getReqID, plugins, nil, w, httptest.NewRequest(http.MethodGet, "/api/4.0//servers/42", nil))
+	if matched {
+		t.Error("expected GET /api/4.0//servers/42 not to match a route without path normalization")
+	}
+}
+
+func TestGetRouteRequestTimeout(t *testing.T) {
+	methodTimeouts := map[string]int{http.MethodPost: 300, "put": 120, http.MethodDelete: 0}
+	defaultTimeout := 60 * time.Second
+
+	tests := []struct {
+		route    Route
+		expected time.Duration
+	}{
+		{Route{Method: http.MethodPost}, 300 * time.Second},
+		{Route{Method: http.MethodPut}, 120 * time.Second},
+		{Route{Method: http.MethodGet}, defaultTimeout},
+		{Route{Method: http.MethodDelete}, defaultTimeout},
+		{Route{Method: http.MethodPost, RequestTimeout: 10 * time.Second}, 10 * time.Second},
+	}
+	for _, test := range tests {
+		if actual := getRouteRequestTimeout(test.route, defaultTimeout, methodTimeouts); actual != test.expected {
+			t.Errorf("timeout for %s route with RequestTimeout %v - expected: %v, actual: %v", test.route.Method, test.route.RequestTimeout, test.expected, actual)
+		}
+	}
+	if actual := getRouteRequestTimeout(Route{Method: http.MethodPost}, defaultTimeout, nil); actual != defaultTimeout {
+		t.Errorf("timeout for POST route without method timeouts - expected: %v, actual: %v", defaultTimeout, actual)
+	}
+}
+
+func TestCreateRouteMapRequestTimeout(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}
+	routes := []Route{
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `slow/?$`, Handler: slow, ID: 1},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodPost, Path: `slow/?$`, Handler: slow, ID: 2, RequestTimeout: 10 * time.Millisecond},
+	}
+	authBase := middleware.AuthBase{Secret: "secret", Override: nil}
+	routeMap, _ := CreateRouteMap(routes, nil, nil, authBase, 60, map[string]int{http.MethodPost: 60})
+
+	w := httptest.NewRecorder()
+	routeMap[http.MethodPost][0].Handler(w, httptest.NewRequest(http.MethodPost, "/api/4.0/slow", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected POST exceeding its route timeout to return %d, actual: %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	routeMap[http.MethodGet][0].Handler(w, httptest.NewRequest(http.MethodGet, "/api/4.0/slow", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected GET within the default timeout to return %d, actual: %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestCompiledRoutesReport(t *testing.T) {
+	d := ServerData{Config: config.NewFakeConfig()}
+	routeSlice, _, err := Routes(d)
+	if err != nil {
+		t.Fatalf("error fetching routes: %v", err)
+	}
+
+	authBase := middleware.AuthBase{Secret: d.Secrets[0], Override: nil}
+	routes, versions := CreateRouteMap(routeSlice, nil, nil, authBase, 1, nil)
+	compiledRoutes, report := compileRoutesWithReport(routes)
+
+	// every route is served on its own version and each later minor version of the same major version.
+	expected := map[string]int{}
+	expectedTotal := 0
+	for _, r := range routeSlice {
+		for version := range versions {
+			if version.Major == r.Version.Major && version.Minor >= r.Version.Minor {
+				expected[r.Method]++
+				expectedTotal++
+			}
+		}
+	}
+
+	if report.Total != expectedTotal {
+		t.Errorf("expected %d compiled routes, actual: %d", expectedTotal, report.Total)
+	}
+	if report.RegexCount != expectedTotal {
+		t.Errorf("expected %d compiled regexes, actual: %d", expectedTotal, report.RegexCount)
+	}
+	if !reflect.DeepEqual(report.Methods, expected) {
+		t.Errorf("expected compiled routes per method %v, actual: %v", expected, report.Methods)
+	}
+	for method, count := range expected {
+		if len(compiledRoutes[method]) != count {
+			t.Errorf("expected %d compiled %s routes, actual: %d", count, method, len(compiledRoutes[method]))
+		}
+	}
+	if report.UniquePatterns == 0 || report.UniquePatterns > report.RegexCount {
+		t.Errorf("expected between 1 and %d unique patterns, actual: %d", report.RegexCount, report.UniquePatterns)
+	}
+}
+
+func TestCreateRouteMapRateLimit(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	routes := []Route{
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodPost, Path: `user/login/?$`, Handler: handler, ID: 1, RateLimit: &middleware.RateLimit{Requests: 1, Interval: time.Hour}},
+		{Version: api.Version{Major: 4, Minor: 1}, Method: http.MethodGet, Path: `servers/?$`, Handler: handler, ID: 2},
+	}
+	authBase := middleware.AuthBase{Secret: "secret", Override: nil}
+	routeMap, _ := CreateRouteMap(routes, nil, nil, authBase, 60, nil)
+	if len(routeMap[http.MethodPost]) != 2 {
+		t.Fatalf("expected the rate limited route on 2 versions, actual: %d", len(routeMap[http.MethodPost]))
+	}
+
+	// the limit is shared by every version of the route.
+	codes := []int{}
+	for _, pathHandler := range routeMap[http.MethodPost] {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/4.0/user/login", nil)
+		pathHandler.Handler(w, r)
+		codes = append(codes, w.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("expected statuses [200 429], actual: %v", codes)
+	}
+
+	w := httptest.NewRecorder()
+	routeMap[http.MethodGet][0].Handler(w, httptest.NewRequest(http.MethodGet, "/api/4.1/servers", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected a route without a rate limit to be allowed, actual status: %d", w.Code)
+	}
+}
+
+func TestCreateRouteMapMethodRequestTimeout(t *testing.T) {
+	remaining := map[string]time.Duration{}
+	recordDeadline := func(w http.ResponseWriter, r *http.Request) {
+		if deadline, ok := r.Context().Deadline(); ok {
+			remaining[r.Method] = time.Until(deadline)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	routes := []Route{
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodGet, Path: `snapshot/?$`, Handler: recordDeadline, ID: 1},
+		{Version: api.Version{Major: 4, Minor: 0}, Method: http.MethodPost, Path: `snapshot/?$`, Handler: recordDeadline, ID: 2},
+	}
+	authBase := middleware.AuthBase{Secret: "secret", Override: nil}
+	routeMap, _ := CreateRouteMap(routes, nil, nil, authBase, 60, map[string]int{http.MethodPost: 300})
+
+	for method, expected := range map[string]time.Duration{http.MethodPost: 300 * time.Second, http.MethodGet: 60 * time.Second} {
+		w := httptest.NewRecorder()
+		routeMap[method][0].Handler(w, httptest.NewRequest(method, "/api/4.0/snapshot", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %s to return %d, actual: %d", method, http.StatusOK, w.Code)
+		}
+		actual, ok := remaining[method]
+		if !ok {
+			t.Fatalf("expected %s to have a request timeout, actual: none", method)
+		}
+		if actual > expected || actual < expected-5*time.Second {
+			t.Errorf("expected %s to get a request timeout of %v, actual: %v remaining", method, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package selftest validates the cache config generation path at startup, so
+// a deploy which breaks it is caught before caches request their config.
+package selftest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
+)
+
+// SyntheticProfileName is the profile of the synthetic server config is
+// generated for, when no profile is designated.
+const SyntheticProfileName = "CONFIG_SELF_TEST_EDGE"
+
+// syntheticParams are the parameters of the synthetic profile, a
+// representative few of the parameters of an edge cache's profile.
+var syntheticParams = []tc.Parameter{
+	{ConfigFile: atscfg.RecordsFileName, Name: "location", Value: "/opt/trafficserver/etc/trafficserver"},
+	{ConfigFile: atscfg.RecordsFileName, Name: "CONFIG proxy.config.http.server_ports", Value: "STRING 80 80:ipv6"},
+	{ConfigFile: atscfg.RecordsFileName, Name: "CONFIG proxy.config.cache.ram_cache.size", Value: "INT 16777216"},
+	{ConfigFile: atscfg.StorageFileName, Name: "Drive_Prefix", Value: "/dev/ram"},
+	{ConfigFile: atscfg.StorageFileName, Name: "Drive_Letters", Value: "0,1"},
+	{ConfigFile: atscfg.VolumeFileName, Name: "Drive_Prefix", Value: "/dev/ram"},
+	{ConfigFile: atscfg.IPAllowConfigFileName, Name: atscfg.ParamPurgeAllowIP, Value: "192.0.2.1"},
+}
+
+// Result is the outcome of a config generation self-test.
+type Result struct {
+	// Profile is the profile of the server config was generated for.
+	Profile string
+	// Files are the config files which were generated.
+	Files []string
+	// Warnings are the warnings of the config generation, prefixed by their config file.
+	Warnings []string
+}
+
+// Run generates a representative few cache config files for a single
+// synthetic edge cache server, with the parameters of the given profile, or of
+// the synthetic profile if it's empty. Returns an error if the profile doesn't
+// exist, or any config file can't be generated.
+//
+// This is deliberately lightweight: config is only generated for the one
+// server, which needn't exist, rather than for every server.
+func Run(tx *sql.Tx, profileName string) (Result, error) {
+	params := syntheticParams
+	if profileName == "" {
+		profileName = SyntheticProfileName
+	} else {
+		var err error
+		if params, err = getProfileParams(tx, profileName); err != nil {
+			return Result{Profile: profileName}, err
+		}
+	}
+	return generate(profileName, syntheticServer(profileName), params)
+}
+
+// generate generates the config files of the given server, with the given
+// profile and parameters.
+func generate(profileName string, server atscfg.Server, params []tc.Parameter) (Result, error) {
+	servers := []atscfg.Server{server}
+	cacheGroups := []tc.CacheGroupNullable{{
+		ID:   util.IntPtr(1),
+		Name: server.Cachegroup,
+		Type: util.StrPtr(tc.CacheGroupEdgeTypeName),
+	}}
+	hdr := "config self-test"
+
+	generators := []struct {
+		file string
+		make func() (atscfg.Cfg, error)
+	}{
+		{atscfg.RecordsFileName, func() (atscfg.Cfg, error) {
+			return atscfg.MakeRecordsDotConfig(&server, params, &atscfg.RecordsConfigOpts{HdrComment: hdr})
+		}},
+		{atscfg.StorageFileName, func() (atscfg.Cfg, error) {
+			return atscfg.MakeStorageDotConfig(&server, params, &atscfg.StorageDotConfigOpts{HdrComment: hdr})
+		}},
+		{atscfg.VolumeFileName, func() (atscfg.Cfg, error) {
+			return atscfg.MakeVolumeDotConfig(&server, params, &atscfg.VolumeDotConfigOpts{HdrComment: hdr})
+		}},
+		{atscfg.IPAllowConfigFileName, func() (atscfg.Cfg, error) {
+			return atscfg.MakeIPAllowDotConfig(params, &server, servers, cacheGroups, nil, &atscfg.IPAllowDotConfigOpts{HdrComment: hdr})
+		}},
+	}
+
+	result := Result{Profile: profileName}
+	for _, generator := range generators {
+		cfg, err := generator.make()
+		if err != nil {
+			return result, fmt.Errorf("generating %s for profile '%s': %w", generator.file, profileName, err)
+		}
+		if strings.TrimSpace(cfg.Text) == "" {
+			return result, fmt.Errorf("generating %s for profile '%s': empty config", generator.file, profileName)
+		}
+		for _, warning := range cfg.Warnings {
+			result.Warnings = append(result.Warnings, generator.file+": "+warning)
+		}
+		result.Files = append(result.Files, generator.file)
+	}
+	return result, nil
+}
+
+// syntheticServer returns the edge cache server config is generated for. Its
+// IP addresses are reserved for documentation, so they can't clash with a real
+// server's.
+func syntheticServer(profileName string) atscfg.Server {
+	return atscfg.Server{
+		Cachegroup:   util.StrPtr("config-self-test"),
+		CachegroupID: util.IntPtr(1),
+		CDNID:        util.IntPtr(1),
+		CDNName:      util.StrPtr("config-self-test"),
+		DomainName:   util.StrPtr("config-self-test.invalid"),
+		HostName:     util.StrPtr("edge"),
+		ID:           util.IntPtr(1),
+		ProfileNames: []string{profileName},
+		TCPPort:      util.IntPtr(80),
+		Type:         tc.EdgeTypePrefix,
+		Interfaces: []tc.ServerInterfaceInfoV40{{
+			ServerInterfaceInfo: tc.ServerInterfaceInfo{
+				Name:        "eth0",
+				Monitor:     true,
+				IPAddresses: []tc.ServerIPAddress{{Address: "192.0.2.2/24", ServiceAddress: true}},
+			},
+		}},
+	}
+}
+
+// getProfileParams returns the parameters of the named profile.
+func getProfileParams(tx *sql.Tx, profileName string) ([]tc.Parameter, error) {
+	if _, ok, err := dbhelpers.GetProfileIDFromName(profileName, tx); err != nil {
+		return nil, fmt.Errorf("getting profile '%s': %w", profileName, err)
+	} else if !ok {
+		return nil, errors.New("profile '" + profileName + "' not found")
+	}
+
+	rows, err := tx.Query(`
+SELECT p.name, p.config_file, p.value
+FROM parameter AS p
+JOIN profile_parameter AS pp ON pp.parameter = p.id
+JOIN profile AS pr ON pr.id = pp.profile
+WHERE pr.name = $1
+`, profileName)
+	if err != nil {
+		return nil, fmt.Errorf("querying parameters of profile '%s': %w", profileName, err)
+	}
+	defer log.Close(rows, "closing profile parameter rows")
+
+	params := []tc.Parameter{}
+	for rows.Next() {
+		param := tc.Parameter{}
+		if err := rows.Scan(&param.Name, &param.ConfigFile, &param.Value); err != nil {
+			return nil, fmt.Errorf("scanning parameters of profile '%s': %w", profileName, err)
+		}
+		params = append(params, param)
+	}
+	return params, rows.Err()
+}
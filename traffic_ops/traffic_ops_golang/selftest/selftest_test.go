@@ -0,0 +1,87 @@
+package selftest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestRunSynthetic(t *testing.T) {
+	result, err := Run(nil, "")
+	if err != nil {
+		t.Fatalf("expected no error generating config for the synthetic profile, actual: %v", err)
+	}
+	if result.Profile != SyntheticProfileName {
+		t.Errorf("expected config to be generated for profile %s, actual: %s", SyntheticProfileName, result.Profile)
+	}
+	expected := []string{atscfg.RecordsFileName, atscfg.StorageFileName, atscfg.VolumeFileName, atscfg.IPAllowConfigFileName}
+	if strings.Join(result.Files, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected the config files %v to be generated, actual: %v", expected, result.Files)
+	}
+}
+
+func TestRunDesignatedProfile(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("opening a stub database connection: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id from profile").WithArgs("EDGE_TEST").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery("SELECT p.name, p.config_file, p.value").WithArgs("EDGE_TEST").WillReturnRows(
+		sqlmock.NewRows([]string{"name", "config_file", "value"}).
+			AddRow("CONFIG proxy.config.http.server_ports", atscfg.RecordsFileName, "STRING 8080").
+			AddRow("Drive_Prefix", atscfg.StorageFileName, "/dev/sd"))
+	mock.ExpectQuery("SELECT id from profile").WithArgs("NO_SUCH_PROFILE").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("beginning a transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := Run(tx, "EDGE_TEST")
+	if err != nil {
+		t.Fatalf("expected no error generating config for a designated profile, actual: %v", err)
+	}
+	if result.Profile != "EDGE_TEST" || len(result.Files) != 4 {
+		t.Errorf("expected 4 config files generated for EDGE_TEST, actual: %+v", result)
+	}
+
+	if _, err := Run(tx, "NO_SUCH_PROFILE"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected an error for a profile which doesn't exist, actual: %v", err)
+	}
+}
+
+func TestGenerateError(t *testing.T) {
+	// records.config can't be generated for a server without a profile
+	server := syntheticServer("EDGE_TEST")
+	server.ProfileNames = nil
+	if _, err := generate("EDGE_TEST", server, []tc.Parameter{}); err == nil || !strings.Contains(err.Error(), atscfg.RecordsFileName) {
+		t.Errorf("expected an error naming records.config, actual: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Package tlscerts selects the TLS certificate Traffic Ops serves to a client
+// by the server name it requested with SNI.
+package tlscerts
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+)
+
+// certificates are the loaded certificates of a Store.
+type certificates struct {
+	def    *tls.Certificate
+	byName map[string]*tls.Certificate
+}
+
+// Store holds the default certificate and the SNI certificates of Traffic Ops.
+// It is safe for use by multiple goroutines, and its certificates may be
+// reloaded while it's in use.
+type Store struct {
+	certPath string
+	keyPath  string
+	sni      map[string]config.SNICertificate
+	certs    atomic.Value // certificates
+}
+
+// Load loads the default certificate and key, and every SNI certificate and
+// key, returning an error if any of them can't be loaded, or don't match.
+func Load(certPath string, keyPath string, sni map[string]config.SNICertificate) (*Store, error) {
+	s := &Store{certPath: certPath, keyPath: keyPath, sni: map[string]config.SNICertificate{}}
+	for name, cert := range sni {
+		s.sni[strings.ToLower(strings.TrimSuffix(name, "."))] = cert
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload loads the certificate and key files of the Store again, e.g. after
+// they were renewed. If any of them can't be loaded, the certificates already
+// loaded are kept, and an error is returned.
+func (s *Store) Reload() error {
+	certs := certificates{byName: map[string]*tls.Certificate{}}
+	def, err := loadPair(s.certPath, s.keyPath)
+	if err != nil {
+		return fmt.Errorf("loading default certificate: %w", err)
+	}
+	certs.def = def
+	for name, pair := range s.sni {
+		if name == "" {
+			return errors.New("loading SNI certificate: server name cannot be blank")
+		}
+		cert, err := loadPair(pair.CertPath, pair.KeyPath)
+		if err != nil {
+			return fmt.Errorf("loading SNI certificate for '%s': %w", name, err)
+		}
+		certs.byName[name] = cert
+	}
+	s.certs.Store(certs)
+	return nil
+}
+
+func loadPair(certPath string, keyPath string) (*tls.Certificate, error) {
+	if certPath == "" || keyPath == "" {
+		return nil, errors.New("cert and key cannot be blank")
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("cert '%s', key '%s': %w", certPath, keyPath, err)
+	}
+	return &cert, nil
+}
+
+// GetCertificate returns the certificate for the server name requested by the
+// client. An exact match is preferred over a wildcard one, and the default
+// certificate is returned if neither matches. It's intended for use as the
+// GetCertificate of a tls.Config.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := s.certs.Load().(certificates)
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" {
+		return certs.def, nil
+	}
+	if cert, ok := certs.byName[name]; ok {
+		return cert, nil
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		if cert, ok := certs.byName["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	return certs.def, nil
+}
+
+// LoadClientCAs loads the PEM certificate authorities client certificates are
+// verified against, returning an error if the file can't be read or contains
+// no certificates.
+func LoadClientCAs(caPath string) (*x509.CertPool, error) {
+	caPEM, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA file '%s': %w", caPath, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("client CA file '%s' contains no PEM certificates", caPath)
+	}
+	return pool, nil
+}
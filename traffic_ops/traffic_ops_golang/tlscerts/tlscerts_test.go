@@ -0,0 +1,191 @@
+package tlscerts
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
+)
+
+// writeCert writes a self-signed certificate for the given name, and its key,
+// to dir, returning their paths.
+func writeCert(t *testing.T, dir string, name string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshalling key: %v", err)
+	}
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("writing certificate: %v", err)
+	}
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+	return certPath, keyPath
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestGetCertificate(t *testing.T) {
+	dir := t.TempDir()
+	defCert, defKey := writeCert(t, dir, "default.example.com")
+	aCert, aKey := writeCert(t, dir, "a.example.com")
+	wildCert, wildKey := writeCert(t, dir, "wild.example.net")
+
+	s, err := Load(defCert, defKey, map[string]config.SNICertificate{
+		"A.example.com":  {CertPath: aCert, KeyPath: aKey},
+		"*.example.net.": {CertPath: wildCert, KeyPath: wildKey},
+	})
+	if err != nil {
+		t.Fatalf("loading certificates: %v", err)
+	}
+
+	tests := map[string]string{
+		"":                    "default.example.com",
+		"a.example.com":       "a.example.com",
+		"A.EXAMPLE.COM.":      "a.example.com",
+		"b.example.com":       "default.example.com",
+		"to.example.net":      "wild.example.net",
+		"a.to.example.net":    "default.example.com",
+		"example.net":         "default.example.com",
+		"default.example.com": "default.example.com",
+	}
+	for serverName, expected := range tests {
+		cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		if err != nil {
+			t.Errorf("getting certificate for '%s': %v", serverName, err)
+			continue
+		}
+		if actual := commonName(t, cert); actual != expected {
+			t.Errorf("expected the certificate of '%s' for server name '%s', actual: '%s'", expected, serverName, actual)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	defCert, defKey := writeCert(t, dir, "default.example.com")
+	aCert, _ := writeCert(t, dir, "a.example.com")
+
+	if _, err := Load(defCert, defKey, map[string]config.SNICertificate{"a.example.com": {CertPath: aCert, KeyPath: defKey}}); err == nil {
+		t.Error("expected an error loading a mismatched certificate and key")
+	}
+	if _, err := Load(defCert, defKey, map[string]config.SNICertificate{"a.example.com": {CertPath: aCert}}); err == nil {
+		t.Error("expected an error loading a certificate without a key")
+	}
+	if _, err := Load(filepath.Join(dir, "missing.crt"), defKey, nil); err == nil {
+		t.Error("expected an error loading a missing default certificate")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	defCert, defKey := writeCert(t, dir, "default.example.com")
+	s, err := Load(defCert, defKey, nil)
+	if err != nil {
+		t.Fatalf("loading certificates: %v", err)
+	}
+
+	// renew the default certificate in place.
+	renewedCert, renewedKey := writeCert(t, dir, "renewed.example.com")
+	for from, to := range map[string]string{renewedCert: defCert, renewedKey: defKey} {
+		bytes, err := ioutil.ReadFile(from)
+		if err != nil {
+			t.Fatalf("reading renewed file: %v", err)
+		}
+		if err := ioutil.WriteFile(to, bytes, 0600); err != nil {
+			t.Fatalf("writing renewed file: %v", err)
+		}
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatalf("reloading certificates: %v", err)
+	}
+	cert, _ := s.GetCertificate(&tls.ClientHelloInfo{})
+	if actual := commonName(t, cert); actual != "renewed.example.com" {
+		t.Errorf("expected the renewed certificate after reloading, actual: '%s'", actual)
+	}
+
+	// a failed reload keeps the loaded certificates.
+	if err := ioutil.WriteFile(defKey, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("writing invalid key: %v", err)
+	}
+	if err := s.Reload(); err == nil {
+		t.Error("expected an error reloading an invalid key")
+	}
+	cert, _ = s.GetCertificate(&tls.ClientHelloInfo{})
+	if actual := commonName(t, cert); actual != "renewed.example.com" {
+		t.Errorf("expected the certificate to be kept after a failed reload, actual: '%s'", actual)
+	}
+}
+
+func TestLoadClientCAs(t *testing.T) {
+	dir := t.TempDir()
+	caCert, caKey := writeCert(t, dir, "ca.example.com")
+
+	pool, err := LoadClientCAs(caCert)
+	if err != nil {
+		t.Fatalf("loading client CAs: %v", err)
+	}
+	if pool == nil {
+		t.Fatal("expected a certificate pool")
+	}
+	if _, err := LoadClientCAs(caKey); err == nil {
+		t.Error("expected an error loading a client CA file without certificates")
+	}
+	if _, err := LoadClientCAs(filepath.Join(dir, "missing.crt")); err == nil {
+		t.Error("expected an error loading a missing client CA file")
+	}
+}
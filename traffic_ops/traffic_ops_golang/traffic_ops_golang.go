@@ -20,7 +20,9 @@ package main
  */
 
 import (
+	"context"
 	"crypto/tls"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -31,7 +33,6 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
-	"runtime/pprof"
 	"strings"
 	"time"
 
@@ -40,8 +41,11 @@ import (
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/plugin"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/profiler"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/routing"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/selftest"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/server"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/tlscerts"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/trafficvault"
 	_ "github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/trafficvault/backends" // init traffic vault backends
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/trafficvault/backends/disabled"
@@ -65,10 +69,13 @@ func main() {
 	showVersion := flag.Bool("version", false, "Show version and exit")
 	showPlugins := flag.Bool("plugins", false, "Show the list of plugins and exit")
 	showRoutes := flag.Bool("api-routes", false, "Show the list of API routes and exit")
+	openAPIFileName := flag.String("api-routes-openapi", "", "Write an OpenAPI 3.0 skeleton of the API routes, with their paths, methods, and required Permissions, to the given file and exit")
 	configFileName := flag.String("cfg", "", "The config file path")
 	dbConfigFileName := flag.String("dbcfg", "", "The db config file path")
 	riakConfigFileName := flag.String("riakcfg", "", "The riak config file path (DEPRECATED: use traffic_vault_backend = riak and traffic_vault_config in cdn.conf instead)")
 	backendConfigFileName := flag.String("backendcfg", "", "The backend config file path")
+	configSelfTest := flag.Bool("config-self-test", false, "Generate a few cache config files for a synthetic edge cache server at startup, and report Traffic Ops as not ready at /readyz if they can't be generated")
+	configSelfTestProfile := flag.String("config-self-test-profile", "", "The profile whose Parameters the config self-test uses, instead of its synthetic profile; implies --config-self-test")
 	flag.Parse()
 
 	// --versionが指定されていた場合
@@ -122,6 +129,34 @@ func main() {
 		os.Exit(0)
 	}
 
+	// --api-routes-openapiが指定されていた場合、APIのルート一覧からOpenAPIのスケルトンを生成してファイルに書き出し終了
+	if len(*openAPIFileName) != 0 {
+		fake := routing.ServerData{Config: config.NewFakeConfig()}
+		routes, _, _ := routing.Routes(fake)
+
+		// cdn.confが指定されていれば、disabled_routesのルートを無効として記載する
+		disabledRoutes := []int{}
+		if len(*configFileName) != 0 {
+			cfg, err := config.LoadCdnConfig(*configFileName)
+			if err != nil {
+				fmt.Printf("Loading cdn config from '%s': %v", *configFileName, err)
+				os.Exit(1)
+			}
+			disabledRoutes = cfg.DisabledRoutes
+		}
+
+		skeleton, err := routing.OpenAPISkeleton(routes, disabledRoutes, about.About.RPMVersion)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Generating OpenAPI skeleton: %v\n", err)
+			os.Exit(1)
+		}
+		if err := ioutil.WriteFile(*openAPIFileName, append(skeleton, '\n'), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Writing OpenAPI skeleton to '%s': %v\n", *openAPIFileName, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// 引数が2つ未満なければエラー。つまり2つは必須
 	if len(os.Args) < 2 {
 		flag.Usage()
@@ -154,6 +189,9 @@ func main() {
 		log.Warnln(err)
 	}
 
+	// ビルドのバージョンと設定のフィンガープリントを出力する
+	logStartupBanner(cfg)
+
 	// 主要な設定情報を出力するだけ
 	logConfig(cfg)
 
@@ -178,6 +216,13 @@ func main() {
 	}
 	defer db.Close()
 
+	// sqlx.Openは実際には接続しないので、ここで接続できることを確認しておく。接続できなければリクエストの処理中ではなく起動時にエラーとする
+	// startup_waitが設定されていれば、DBが起動するまでその時間だけ待つ
+	if err := waitForDependency("the database", cfg.StartupWait, func() error { return pingDB(db, cfg, sslStr, *dbConfigFileName) }); err != nil {
+		log.Errorln(err.Error())
+		os.Exit(dbUnavailableExitCode)
+	}
+
 	// DBへの設定を行う
 	db.SetMaxOpenConns(cfg.MaxDBConnections)     // max_db_connections設定
 	db.SetMaxIdleConns(cfg.DBMaxIdleConnections) // db_max_idle_connections設定
@@ -192,6 +237,13 @@ func main() {
 	// TrafficVaultに関する設定の取得を行う
 	trafficVault := setupTrafficVault(*riakConfigFileName, &cfg)
 
+	// startup_waitが設定されていれば、Traffic Vaultが起動するまで待つ。待っても起動しなければ、これまで通りTraffic Vaultなしで起動する
+	if cfg.TrafficVaultEnabled && cfg.StartupWait.MaxWait() > 0 {
+		if err := waitForDependency("Traffic Vault", cfg.StartupWait, func() error { return pingTrafficVault(db, trafficVault, cfg) }); err != nil {
+			log.Errorln(err.Error())
+		}
+	}
+
 	// cdn.confに指定された有効なプラグイン情報のオブジェクト情報を取得する。(cdn.confに指定された「plugin」、「plugin_config」の設定を参照する)
 	// traffic_opsのプラグインというのは「"${TO_DIR}/traffic_ops_golang/plugin/"*.go」に配置されたプラグインで、その中でAddPluginすることによって特定のプラグイン処理を読み込む(詳細はサンプルがあるのでそちらを参考にするとよさそう)
 	plugins := plugin.Get(cfg)
@@ -199,11 +251,14 @@ func main() {
 	// 設定: profiling_enabledを取得する
 	profiling := cfg.ProfilingEnabled
 
-	// HTTPサーバ「localhost:6060」として「/db-stats」、「/memory-stats」のプロファイリング用エンドポイントを起動する
+	// HTTPサーバ「localhost:6060」として「/db-stats」、「/memory-stats」、「/request-stats」、「/users-cache-stats」、「/metrics」のプロファイリング用エンドポイントを起動する
 	pprofMux := http.DefaultServeMux
 	http.DefaultServeMux = http.NewServeMux() // this is so we don't serve pprof over 443.
 	pprofMux.Handle("/db-stats", routing.DBStatsHandler(db))
 	pprofMux.Handle("/memory-stats", routing.MemoryStatsHandler())
+	pprofMux.Handle("/request-stats", routing.RequestStatsHandler(cfg.RequestLimit.MaxInFlight))
+	pprofMux.Handle("/metrics", routing.RouteMetricsHandler())
+	pprofMux.Handle("/users-cache-stats", routing.UsersCacheStatsHandler())
 	go func() {
 		// デバッグ用HTTPサーバ
 		debugServer := http.Server{
@@ -225,6 +280,19 @@ func main() {
 		}
 	}
 
+	routing.SetMaintenanceMode(cfg.Maintenance.Enabled)
+
+	// read_only.enabledが設定されていれば読み取り専用モードで起動する。DBがリカバリ中(読み取り専用のレプリカ)の間も読み取り専用モードになる
+	routing.SetReadOnlyMode(cfg.ReadOnly.Enabled)
+	if cfg.ReadOnly.RecoveryCheckIntervalSec > 0 {
+		routing.StartDBRecoveryCheck(db.DB, time.Duration(cfg.ReadOnly.RecoveryCheckIntervalSec)*time.Second, time.Duration(cfg.DBQueryTimeoutSeconds)*time.Second)
+	}
+
+	// --config-self-testが指定されていれば、キャッシュの設定ファイル生成を起動時に試し、失敗していれば/readyzで503を返す
+	if *configSelfTest || *configSelfTestProfile != "" {
+		runConfigSelfTest(db, cfg, *configSelfTestProfile)
+	}
+
 	// APIエンドポイントへの登録に必要なオブジェクトを生成する
 	mux := http.NewServeMux()
 	d := routing.ServerData{DB: db, Config: cfg, Profiling: &profiling, Plugins: plugins, TrafficVault: trafficVault, Mux: mux}
@@ -262,46 +330,85 @@ func main() {
 	httpServer.TLSConfig.InsecureSkipVerify = cfg.Insecure
 	// end deprecated block
 
-	// goroutineによりHTTPSサーバを起動する
-	go func() {
+	// TLSの秘密鍵のパスを取得する
+	if cfg.KeyPath == "" {
+		log.Errorf("key cannot be blank in %s", cfg.ConfigHypnotoad.Listen)
+		os.Exit(1)
+	}
 
-		// TLSの秘密鍵のパスを取得する
-		if cfg.KeyPath == "" {
-			log.Errorf("key cannot be blank in %s", cfg.ConfigHypnotoad.Listen)
-			os.Exit(1)
-		}
+	// TLS用のX509証明書のパスを取得する
+	if cfg.CertPath == "" {
+		log.Errorf("cert cannot be blank in %s", cfg.ConfigHypnotoad.Listen)
+		os.Exit(1)
+	}
 
-		// TLS用のX509証明書のパスを取得する
-		if cfg.CertPath == "" {
-			log.Errorf("cert cannot be blank in %s", cfg.ConfigHypnotoad.Listen)
-			os.Exit(1)
-		}
+	// TLS証明書のパスのファイルをopenする
+	if file, err := os.Open(cfg.CertPath); err != nil {
+		log.Errorf("cannot open %s for read: %s", cfg.CertPath, err.Error())
+		os.Exit(1)
+	} else {
+		file.Close()
+	}
 
-		// TLS証明書のパスのファイルをopenする
-		if file, err := os.Open(cfg.CertPath); err != nil {
-			log.Errorf("cannot open %s for read: %s", cfg.CertPath, err.Error())
-			os.Exit(1)
-		} else {
-			file.Close()
-		}
+	// TLSの秘密鍵のパスのファイルをopenする
+	if file, err := os.Open(cfg.KeyPath); err != nil {
+		log.Errorf("cannot open %s for read: %s", cfg.KeyPath, err.Error())
+		os.Exit(1)
+	} else {
+		file.Close()
+	}
+
+	// デフォルトの証明書とsni_certificatesの証明書を読み込む。SNIで要求されたサーバ名によって証明書を選択する
+	certs, err := tlscerts.Load(cfg.CertPath, cfg.KeyPath, cfg.SNICertificates)
+	if err != nil {
+		log.Errorf("loading certificates: %v\n", err)
+		os.Exit(1)
+	}
+	httpServer.TLSConfig.GetCertificate = certs.GetCertificate
 
-		// TLSの秘密鍵のパスのファイルをopenする
-		if file, err := os.Open(cfg.KeyPath); err != nil {
-			log.Errorf("cannot open %s for read: %s", cfg.KeyPath, err.Error())
+	// client_cert_authが設定されている場合には、クライアント証明書を指定されたCAで検証する
+	if cfg.ClientCertAuth.Enabled() {
+		clientCAs, err := tlscerts.LoadClientCAs(cfg.ClientCertAuth.CAFile)
+		if err != nil {
+			log.Errorf("loading client certificate authorities: %v\n", err)
 			os.Exit(1)
-		} else {
-			file.Close()
 		}
+		httpServer.TLSConfig.ClientCAs = clientCAs
+		httpServer.TLSConfig.ClientAuth = cfg.ClientCertAuth.ClientAuth()
+	}
+
+	// goroutineによりHTTPSサーバを起動する
+	go func() {
 
 		// HTTPSサーバを起動する
 		httpServer.Handler = mux
-		if err := httpServer.ListenAndServeTLS(cfg.CertPath, cfg.KeyPath); err != nil {
+		if err := httpServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 			log.Errorf("stopping server: %v\n", err)
 			os.Exit(1)
 		}
 
 	}()  // goroutineここまで
 
+	// internal_http_listenが設定されていれば、/healthz、/readyz、/metricsだけを平文のHTTPで提供する。APIはHTTPSでのみ提供する
+	if cfg.InternalHTTPListen != "" {
+		internalServer := &http.Server{
+			Addr:              cfg.InternalHTTPListen,
+			Handler:           routing.InternalHandler(),
+			ReadTimeout:       time.Duration(cfg.ReadTimeout) * time.Second,
+			ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout) * time.Second,
+			WriteTimeout:      time.Duration(cfg.WriteTimeout) * time.Second,
+			IdleTimeout:       time.Duration(cfg.IdleTimeout) * time.Second,
+			ErrorLog:          log.Error,
+		}
+		log.Infof("Listening for internal health checks and metrics on %s", cfg.InternalHTTPListen)
+		go func() {
+			if err := internalServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Errorf("stopping internal HTTP server: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// profilingLocationとcfg.LogLocationErrorのバリデーション処理を行う
 	profilingLocation, err := getProcessedProfilingLocation(cfg.ProfilingLocation, cfg.LogLocationError)  // 設定: profiling_location, log_location_error
 	if err != nil {
@@ -311,16 +418,26 @@ func main() {
 	// プロファイリング情報をログに出力する
 	log.Infof("profiling location: %s\n", profilingLocation)
 	log.Infof("profiling enabled set to %t\n", profiling)
+	profiler.SetDirectory(profilingLocation)
 
 	// `profiling_enabled=true`の場合、CPUプロファイリングの計測処理が行われる(特定のファイルに書かれる)
-	if profiling {
-		continuousProfile(&profiling, &profilingLocation, cfg.Version)
-	}
+	// 以降、profilingはSIGHUPによる設定のリロードか、APIからprofiler.SetContinuousで切り替える
+	profiler.InitContinuous(&profiling, cfg.Version)
+	// cdn.confのprofiling_enabledの値。変わった時だけ適用し、APIからの切り替えをSIGHUPで戻さない
+	configuredProfiling := profiling
+	// cdn.confのmaintenance.enabledの値。profiling_enabledと同様に、変わった時だけ適用する
+	configuredMaintenance := cfg.Maintenance.Enabled
 
 	// 次のsignalReload()に引き渡すための無名関数の定義を行う
 	reloadProfilingAndBackendConfig := func() {
 
-		setNewProfilingInfo(*configFileName, &profiling, &profilingLocation, cfg.Version)
+		setNewProfilingInfo(*configFileName, &profilingLocation, &configuredProfiling)
+		setNewMaintenanceMode(*configFileName, &configuredMaintenance)
+
+		// 更新された証明書を読み込み直す。読み込めなければ、これまでの証明書を使い続ける
+		if err := certs.Reload(); err != nil {
+			log.Errorf("could not reload certificates: %v", err)
+		}
 
 		// 指定されたbackend設定ファイルを構造体に変換して、セットする
 		backendConfig, err = getNewBackendConfig(backendConfigFileName)
@@ -331,10 +448,119 @@ func main() {
 		}
 	}
 
+	// SIGTERMかSIGINTを受信したらHTTPサーバを停止して、プラグインのOnShutdownを実行してから終了する
+	go signalShutdown(httpServer, plugins, cfg)
+
 	// SIGHUPを受信したらreloadProfilingAndBackendConfigの無名関数が実行される様にする
 	signalReloader(unix.SIGHUP, reloadProfilingAndBackendConfig)
 }
 
+// dbUnavailableExitCode is the exit code when the database can't be reached
+// at startup.
+const dbUnavailableExitCode = 3
+
+// pingDB checks that the database can be connected to, within the configured
+// DB query timeout, returning an error describing the connection which failed.
+func pingDB(db *sqlx.DB, cfg config.Config, sslMode string, dbConfigFile string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.DBQueryTimeoutSeconds)*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("unable to connect to the database '%s' at %s:%s as user '%s' (sslmode=%s) within %ds, check that the database is running and reachable, and the settings in '%s': %w",
+			cfg.DB.DBName, cfg.DB.Hostname, cfg.DB.Port, cfg.DB.User, sslMode, cfg.DBQueryTimeoutSeconds, dbConfigFile, err)
+	}
+	return nil
+}
+
+// pingTrafficVault checks the health of the Traffic Vault backend, within the
+// configured DB query timeout.
+func pingTrafficVault(db *sqlx.DB, tv trafficvault.TrafficVault, cfg config.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.DBQueryTimeoutSeconds)*time.Second)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction to ping Traffic Vault: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tv.Ping(tx, ctx); err != nil {
+		return fmt.Errorf("unable to ping Traffic Vault, check that it is running and reachable, and the traffic_vault_config: %w", err)
+	}
+	return nil
+}
+
+// runConfigSelfTest generates a few cache config files for a synthetic edge
+// cache server, with the Parameters of the given profile if it isn't empty,
+// within the configured DB query timeout, and reports the outcome at /readyz.
+func runConfigSelfTest(db *sqlx.DB, cfg config.Config, profile string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.DBQueryTimeoutSeconds)*time.Second)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		log.Errorf("config self-test failed: beginning transaction: %v\n", err)
+		routing.SetConfigSelfTest(profile, err)
+		return
+	}
+	defer tx.Rollback()
+
+	start := time.Now()
+	result, err := selftest.Run(tx, profile)
+	if err != nil {
+		log.Errorf("config self-test failed, Traffic Ops won't be ready until it's restarted with config generation fixed: %v\n", err)
+		routing.SetConfigSelfTest(result.Profile, err)
+		return
+	}
+	for _, warning := range result.Warnings {
+		log.Warnf("config self-test: profile '%s': %s\n", result.Profile, warning)
+	}
+	log.Infof("config self-test passed: generated %s for profile '%s' in %v\n", strings.Join(result.Files, ", "), result.Profile, time.Since(start))
+	routing.SetConfigSelfTest(result.Profile, nil)
+}
+
+// waitForDependency calls check until it succeeds or the max wait of the
+// given ConfigStartupWait is exhausted, logging each failure, and returns the
+// error of the last check. If waiting is disabled, check is called once.
+func waitForDependency(name string, wait config.ConfigStartupWait, check func() error) error {
+	deadline := time.Now().Add(wait.MaxWait())
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil {
+			if attempt > 1 {
+				log.Infof("%s is ready after %d attempts\n", name, attempt)
+			}
+			return nil
+		}
+		remaining := time.Until(deadline)
+		if remaining < wait.Interval() {
+			return err
+		}
+		log.Warnf("waiting for %s, retrying in %v (%v left): %v\n", name, wait.Interval(), remaining.Round(time.Second), err)
+		time.Sleep(wait.Interval())
+	}
+}
+
+// serverShutdownTimeout is how long to wait for in-flight requests to finish
+// when shutting down.
+const serverShutdownTimeout = 30 * time.Second
+
+// signalShutdown waits for a SIGTERM or SIGINT, then stops the server from
+// accepting requests, waits for in-flight requests to finish, and calls the
+// plugins' shutdown hooks before exiting.
+func signalShutdown(httpServer *http.Server, plugins plugin.Plugins, cfg config.Config) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, unix.SIGTERM, unix.SIGINT)
+	sig := <-c
+	log.Infof("received %v, shutting down\n", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Errorf("shutting down server: %v\n", err)
+	}
+	cancel()
+
+	plugins.OnShutdown(plugin.ShutdownData{Data: plugin.Data{SharedCfg: cfg.PluginSharedConfig, AppCfg: cfg}}, time.Duration(cfg.PluginShutdownTimeoutSec)*time.Second)
+	log.Infoln("shut down")
+	os.Exit(0)
+}
+
 func setupTrafficVault(riakConfigFileName string, cfg *config.Config) trafficvault.TrafficVault {
 
 	var err error
@@ -428,7 +654,7 @@ func getNewBackendConfig(backendConfigFileName *string) (config.BackendConfig, e
 	return backendConfig, nil
 }
 
-func setNewProfilingInfo(configFileName string, currentProfilingEnabled *bool, currentProfilingLocation *string, version string) {
+func setNewProfilingInfo(configFileName string, currentProfilingLocation *string, currentProfilingEnabled *bool) {
 
 	newProfilingEnabled, newProfilingLocation, err := reloadProfilingInfo(configFileName)
 	if err != nil {
@@ -438,20 +664,34 @@ func setNewProfilingInfo(configFileName string, currentProfilingEnabled *bool, c
 
 	if newProfilingLocation != "" && *currentProfilingLocation != newProfilingLocation {
 		*currentProfilingLocation = newProfilingLocation
+		profiler.SetDirectory(newProfilingLocation)
 		log.Infof("profiling location set to: %s\n", *currentProfilingLocation)
 	}
 
+	// profiling_enabledが変わった時だけ適用する。有効/無効の切り替えはAPIからの切り替えと直列化される
 	if *currentProfilingEnabled != newProfilingEnabled {
-		log.Infof("profiling enabled set to %t\n", newProfilingEnabled)
-		log.Infof("profiling location set to: %s\n", *currentProfilingLocation)
 		*currentProfilingEnabled = newProfilingEnabled
-		if *currentProfilingEnabled {
-			continuousProfile(currentProfilingEnabled, currentProfilingLocation, version)
-		}
+		profiler.SetContinuous(newProfilingEnabled)
 	}
 
 }
 
+// setNewMaintenanceMode applies the maintenance.enabled setting of the config
+// file, if it changed since it was last read, so that reloading the config
+// doesn't undo a switch made with the maintenance API endpoint.
+func setNewMaintenanceMode(configFileName string, currentMaintenanceEnabled *bool) {
+	cfg, err := config.LoadCdnConfig(configFileName)
+	if err != nil {
+		log.Errorln("reloading config: ", err.Error())
+		return
+	}
+
+	if *currentMaintenanceEnabled != cfg.Maintenance.Enabled {
+		*currentMaintenanceEnabled = cfg.Maintenance.Enabled
+		routing.SetMaintenanceMode(cfg.Maintenance.Enabled)
+	}
+}
+
 // errorLogLocationの値をバリデーションし、rawProfilingLocationのパスディレクトリが存在することを検証する。
 func getProcessedProfilingLocation(rawProfilingLocation string, errorLogLocation string) (string, error) {
 	profilingLocation := os.TempDir()
@@ -496,39 +736,6 @@ func reloadProfilingInfo(configFileName string) (bool, string, error) {
 	return cfg.ProfilingEnabled, profilingLocation, nil
 }
 
-func continuousProfile(profiling *bool, profilingDir *string, version string) {
-
-	// profilingが有効で、profiling用ディレクトリの設定が指定されていたら
-	if *profiling && *profilingDir != "" {
-		go func() {
-			for {
-
-				// プロファイル用のファイル名を「tocpu-<version>-<time>.pprof」として生成する
-				now := time.Now().UTC()
-				filename := filepath.Join(*profilingDir, fmt.Sprintf("tocpu-%s-%s.pprof", version, now.Format(time.RFC3339)))
-				f, err := os.Create(filename)
-				if err != nil {
-					log.Errorf("creating profile: %v\n", err)
-					log.Infof("Exiting profiling")
-					break
-				}
-
-				// プロファイリングを計測する。 see: https://pkg.go.dev/runtime/pprof
-				pprof.StartCPUProfile(f)
-				time.Sleep(time.Minute)
-				pprof.StopCPUProfile()
-
-				f.Close()
-
-				// profilingはコピーされた変数ではなく、continuousProfile()に渡ってきた参照値を見ているので、falseへの変更があればgoroutineが終了する
-				if !*profiling {
-					break
-				}
-			}
-		}()
-	}
-}
-
 func signalReloader(sig os.Signal, f func()) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, sig)  // ここでシグナルを受信するまでwaitする
@@ -538,6 +745,18 @@ func signalReloader(sig os.Signal, f func()) {
 	}
 }
 
+// logStartupBanner logs the build and the fingerprint of the effective config
+// as key=value pairs, and stores the fingerprint for the about endpoint, so
+// operators can confirm exactly which build and config are running.
+func logStartupBanner(cfg config.Config) {
+	fingerprint, err := cfg.Fingerprint()
+	if err != nil {
+		log.Errorf("fingerprinting config: %v\n", err)
+	}
+	about.SetConfigFingerprint(fingerprint)
+	log.Infof("Starting Traffic Ops: name=%s version=%s commits=%s commit_hash=%s release=%s rpm_version=%s go_version=%s config_fingerprint=%s\n", about.About.Name, about.About.Version, about.About.Commits, about.About.CommitHash, about.About.Release, about.About.RPMVersion, about.About.GoVersion, fingerprint)
+}
+
 func logConfig(cfg config.Config) {
 	// 設定に関するログをINFOレベルのログとして出力する
 	log.Infof(`Using Config values: